@@ -49,6 +49,33 @@ func (m *DBManager) LinkDiscordToLDAP(discordID, discordName, ldapUsername strin
     return nil
 }
 
+// DeleteDiscordLDAPMapping removes the mapping for a Discord ID and returns the
+// LDAP username it pointed to, or "" when no mapping existed.
+func (m *DBManager) DeleteDiscordLDAPMapping(discordID string) (string, error) {
+    utils.DebugLog("Database: Unlinking Discord ID %s", discordID)
+    if m == nil || m.db == nil {
+        return "", fmt.Errorf("database not initialized")
+    }
+
+    var ldapUsername string
+    err := m.db.QueryRow(`
+        DELETE FROM discord_ldap_mapping
+        WHERE discord_id = $1
+        RETURNING ldap_username
+    `, discordID).Scan(&ldapUsername)
+
+    if err == sql.ErrNoRows {
+        utils.DebugLog("No mapping to remove for Discord ID %s", discordID)
+        return "", nil
+    }
+    if err != nil {
+        utils.ErrorLog("Database error unlinking Discord ID: %v", err)
+        return "", err
+    }
+    utils.InfoLog("Unlinked Discord ID %s from LDAP user %s", discordID, ldapUsername)
+    return ldapUsername, nil
+}
+
 // GetLDAPUserByDiscordID retrieves the LDAP username for a Discord ID
 func (m *DBManager) GetLDAPUserByDiscordID(discordID string) (string, error) {
     utils.DebugLog("Database: Getting LDAP user for Discord ID %s", discordID)
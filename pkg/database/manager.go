@@ -19,8 +19,13 @@
 package database
 
 import (
+    "context"
     "database/sql"
     "fmt"
+    "net/url"
+    "os"
+    "strconv"
+    "strings"
     "time"
 
     "github.com/lucasduport/stream-share/pkg/utils"
@@ -29,44 +34,59 @@ import (
 
 // DBManager handles database operations
 type DBManager struct {
-    db          *sql.DB
-    initialized bool
+    db           *sql.DB
+    initialized  bool
+    normalizeIDs bool // store stream ids without extension, see streamKey
+    provider     string // provider key of this instance, see Provider
 }
 
+// defaultConnectTimeout bounds the startup ping when DB_CONNECT_TIMEOUT is unset.
+const defaultConnectTimeout = 10 * time.Second
+
 // NewDBManager creates a new database manager
 func NewDBManager(_ string) (*DBManager, error) {
     utils.InfoLog("Initializing PostgreSQL database connection")
 
-    host := utils.GetEnvOrDefault("DB_HOST", "localhost")
-    port := utils.GetEnvOrDefault("DB_PORT", "5432")
-    dbName := utils.GetEnvOrDefault("DB_NAME", "iptvproxy")
-    user := utils.GetEnvOrDefault("DB_USER", "postgres")
-    password := utils.GetEnvOrDefault("DB_PASSWORD", "")
-
-    connStr := fmt.Sprintf(
-        "host=%s port=%s dbname=%s user=%s password=%s sslmode=disable",
-        host, port, dbName, user, password,
-    )
-
-    utils.DebugLog("Connecting to PostgreSQL: host=%s port=%s dbname=%s user=%s", host, port, dbName, user)
+    connectTimeout := connectTimeout()
+    connStr := connectionString(connectionTimeoutSeconds(connectTimeout))
 
     db, err := sql.Open("postgres", connStr)
     if err != nil {
         return nil, fmt.Errorf("failed to open PostgreSQL database: %w", err)
     }
 
-    if err := db.Ping(); err != nil {
+    ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
+    defer cancel()
+    if err := db.PingContext(ctx); err != nil {
         utils.ErrorLog("Failed to connect to database: %v", err)
+        db.Close()
         return nil, fmt.Errorf("database connection test failed: %w", err)
     }
     utils.InfoLog("Database connection successful")
 
-    db.SetMaxOpenConns(10)
-    db.SetMaxIdleConns(5)
-    db.SetConnMaxLifetime(time.Hour)
+    maxOpen := poolSize("DB_MAX_OPEN", 10, 1)
+    maxIdle := poolSize("DB_MAX_IDLE", 5, 0)
+    if maxIdle > maxOpen {
+        utils.WarnLog("DB_MAX_IDLE (%d) is above DB_MAX_OPEN (%d), using %d", maxIdle, maxOpen, maxOpen)
+        maxIdle = maxOpen
+    }
+    lifetime := connLifetime()
+    db.SetMaxOpenConns(maxOpen)
+    db.SetMaxIdleConns(maxIdle)
+    db.SetConnMaxLifetime(lifetime)
+    utils.InfoLog("Database pool: max_open=%d max_idle=%d conn_lifetime=%v", maxOpen, maxIdle, lifetime)
 
-    manager := &DBManager{db: db}
-    if err := manager.initSchema(); err != nil {
+    manager := &DBManager{db: db, normalizeIDs: true}
+    if v := os.Getenv("DB_NORMALIZE_STREAM_IDS"); v != "" {
+        if b, err := strconv.ParseBool(v); err == nil {
+            manager.normalizeIDs = b
+        } else {
+            utils.WarnLog("Invalid DB_NORMALIZE_STREAM_IDS: %s", v)
+        }
+    }
+    utils.InfoLog("Stream id normalization: %v", manager.normalizeIDs)
+    manager.provider = providerFromEnv()
+    if err := manager.migrate(); err != nil {
         db.Close()
         return nil, err
     }
@@ -75,6 +95,127 @@ func NewDBManager(_ string) (*DBManager, error) {
     return manager, nil
 }
 
+// connectionString returns the PostgreSQL DSN. DATABASE_URL is used verbatim
+// when set; otherwise it is built from DB_HOST, DB_PORT, DB_NAME, DB_USER,
+// DB_PASSWORD and DB_SSLMODE (default disable). timeoutSeconds > 0 adds
+// connect_timeout to the built DSN.
+func connectionString(timeoutSeconds int) string {
+    if dsn := strings.TrimSpace(os.Getenv("DATABASE_URL")); dsn != "" {
+        if u, err := url.Parse(dsn); err == nil && u.Scheme != "" {
+            utils.DebugLog("Connecting to PostgreSQL: %s", u.Redacted())
+        } else {
+            utils.DebugLog("Connecting to PostgreSQL using DATABASE_URL")
+        }
+        return dsn
+    }
+
+    host := utils.GetEnvOrDefault("DB_HOST", "localhost")
+    port := utils.GetEnvOrDefault("DB_PORT", "5432")
+    dbName := utils.GetEnvOrDefault("DB_NAME", "iptvproxy")
+    user := utils.GetEnvOrDefault("DB_USER", "postgres")
+    password := utils.GetEnvOrDefault("DB_PASSWORD", "")
+    sslMode := sslMode()
+
+    connStr := fmt.Sprintf(
+        "host=%s port=%s dbname=%s user=%s password=%s sslmode=%s",
+        dsnValue(host), dsnValue(port), dsnValue(dbName), dsnValue(user), dsnValue(password), sslMode,
+    )
+    if timeoutSeconds > 0 {
+        connStr += fmt.Sprintf(" connect_timeout=%d", timeoutSeconds)
+    }
+
+    utils.DebugLog("Connecting to PostgreSQL: host=%s port=%s dbname=%s user=%s sslmode=%s", host, port, dbName, user, sslMode)
+    return connStr
+}
+
+// dsnValue quotes a key/value DSN value when it is empty or holds spaces,
+// quotes or backslashes, e.g. a generated password.
+func dsnValue(v string) string {
+    if v != "" && !strings.ContainsAny(v, " '\\\t") {
+        return v
+    }
+    return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
+}
+
+// sslMode reads DB_SSLMODE, one of the libpq modes lib/pq supports.
+func sslMode() string {
+    v := strings.ToLower(strings.TrimSpace(os.Getenv("DB_SSLMODE")))
+    switch v {
+    case "":
+        return "disable"
+    case "disable", "require", "verify-ca", "verify-full":
+        return v
+    }
+    utils.WarnLog("Invalid DB_SSLMODE: %s (use disable, require, verify-ca or verify-full)", v)
+    return "disable"
+}
+
+// connectTimeout reads DB_CONNECT_TIMEOUT, in seconds or as a duration such
+// as "15s". It bounds the startup ping; when set, it is also passed to the
+// driver as connect_timeout. Default 10s for the ping only.
+func connectTimeout() time.Duration {
+    v := strings.TrimSpace(os.Getenv("DB_CONNECT_TIMEOUT"))
+    if v == "" {
+        return defaultConnectTimeout
+    }
+    if n, err := strconv.Atoi(v); err == nil && n > 0 {
+        return time.Duration(n) * time.Second
+    }
+    if d, err := time.ParseDuration(v); err == nil && d > 0 {
+        return d
+    }
+    utils.WarnLog("Invalid DB_CONNECT_TIMEOUT: %s", v)
+    return defaultConnectTimeout
+}
+
+// connectionTimeoutSeconds is the connect_timeout to put in the DSN: the
+// configured timeout rounded up to whole seconds, or 0 when DB_CONNECT_TIMEOUT
+// is unset so the driver keeps its own default.
+func connectionTimeoutSeconds(d time.Duration) int {
+    if strings.TrimSpace(os.Getenv("DB_CONNECT_TIMEOUT")) == "" {
+        return 0
+    }
+    return int((d + time.Second - 1) / time.Second)
+}
+
+// maxPoolSize caps DB_MAX_OPEN and DB_MAX_IDLE; PostgreSQL itself allows 100
+// connections by default.
+const maxPoolSize = 500
+
+// poolSize reads a pool size between min and maxPoolSize from key, def when
+// unset or out of range.
+func poolSize(key string, def, min int) int {
+    v := strings.TrimSpace(os.Getenv(key))
+    if v == "" {
+        return def
+    }
+    if n, err := strconv.Atoi(v); err == nil && n >= min && n <= maxPoolSize {
+        return n
+    }
+    utils.WarnLog("Invalid %s: %s (expected %d to %d)", key, v, min, maxPoolSize)
+    return def
+}
+
+// connLifetime reads DB_CONN_LIFETIME, how long a pooled connection is reused,
+// in seconds or as a duration such as "30m" (default 1h). 0 keeps connections
+// forever; other values must be between a minute and a day.
+func connLifetime() time.Duration {
+    const def = time.Hour
+    v := strings.TrimSpace(os.Getenv("DB_CONN_LIFETIME"))
+    if v == "" {
+        return def
+    }
+    d, err := time.ParseDuration(v)
+    if n, aerr := strconv.Atoi(v); aerr == nil {
+        d, err = time.Duration(n)*time.Second, nil
+    }
+    if err == nil && (d == 0 || (d >= time.Minute && d <= 24*time.Hour)) {
+        return d
+    }
+    utils.WarnLog("Invalid DB_CONN_LIFETIME: %s (expected 0 or 1m to 24h)", v)
+    return def
+}
+
 // IsInitialized returns whether the database is initialized
 func (m *DBManager) IsInitialized() bool {
     return m != nil && m.initialized && m.db != nil
@@ -15,7 +15,7 @@
  * You should have received a copy of the GNU General Public License
  * along with this program.  If not, see <https://www.gnu.org/licenses/>.
  */
- 
+
 package database
 
 import (
@@ -24,83 +24,286 @@ import (
     "github.com/lucasduport/stream-share/pkg/utils"
 )
 
-// initSchema creates database tables if they don't exist
-func (m *DBManager) initSchema() error {
-    utils.InfoLog("Initializing database schema")
+// migration is one versioned schema change. Statements run in a single
+// transaction together with the schema_migrations bookkeeping row.
+type migration struct {
+    version    int
+    name       string
+    statements []string
+    // when, if set, decides whether the migration applies to this setup.
+    // A migration it turns down stays pending for a later start.
+    when func(m *DBManager) bool
+}
+
+// migrations is the ordered schema history. Append new entries with the next
+// version; never edit or reorder one that has shipped.
+var migrations = []migration{
+    {
+        version: 1,
+        name:    "baseline tables",
+        statements: []string{
+            `
+            CREATE TABLE IF NOT EXISTS discord_ldap_mapping (
+                discord_id TEXT PRIMARY KEY,
+                discord_name TEXT NOT NULL,
+                ldap_username TEXT NOT NULL UNIQUE,
+                created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                last_active TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+            )
+            `,
+            `
+            CREATE TABLE IF NOT EXISTS stream_history (
+                id SERIAL PRIMARY KEY,
+                username TEXT NOT NULL,
+                discord_id TEXT,
+                stream_id TEXT NOT NULL,
+                stream_type TEXT NOT NULL,
+                stream_title TEXT,
+                start_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                end_time TIMESTAMP,
+                ip_address TEXT,
+                user_agent TEXT
+            )
+            `,
+            `
+            CREATE TABLE IF NOT EXISTS temporary_links (
+                token TEXT PRIMARY KEY,
+                username TEXT NOT NULL,
+                url TEXT NOT NULL,
+                created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                expires_at TIMESTAMP NOT NULL,
+                stream_id TEXT,
+                title TEXT
+            )
+            `,
+            `
+            CREATE TABLE IF NOT EXISTS vod_cache (
+                stream_id TEXT PRIMARY KEY,
+                type TEXT NOT NULL,
+                title TEXT,
+                series_title TEXT,
+                season INTEGER,
+                episode INTEGER,
+                file_path TEXT NOT NULL,
+                requested_by TEXT,
+                downloaded_bytes BIGINT DEFAULT 0,
+                total_bytes BIGINT DEFAULT 0,
+                size_bytes BIGINT DEFAULT 0,
+                status TEXT NOT NULL,
+                created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                expires_at TIMESTAMP NOT NULL,
+                last_access TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+            )
+            `,
+            `
+            CREATE TABLE IF NOT EXISTS vod_requests (
+                token TEXT PRIMARY KEY,
+                username TEXT NOT NULL,
+                query TEXT NOT NULL,
+                results TEXT NOT NULL,
+                created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                expires_at TIMESTAMP NOT NULL
+            )
+            `,
+        },
+    },
+    {
+        version: 2,
+        name:    "stream_quality table",
+        statements: []string{
+            `
+            CREATE TABLE IF NOT EXISTS stream_quality (
+                id SERIAL PRIMARY KEY,
+                stream_id TEXT NOT NULL,
+                stream_type TEXT NOT NULL,
+                stream_title TEXT,
+                start_time TIMESTAMP NOT NULL,
+                end_time TIMESTAMP NOT NULL,
+                blocked_sends BIGINT DEFAULT 0,
+                blocked_ms BIGINT DEFAULT 0,
+                drop_events BIGINT DEFAULT 0,
+                dropped_chunks BIGINT DEFAULT 0,
+                stalls BIGINT DEFAULT 0
+            )
+            `,
+        },
+    },
+    {
+        // Tables created by early releases lack the progress and series columns
+        version: 3,
+        name:    "vod_cache progress and series columns",
+        statements: []string{
+            `ALTER TABLE vod_cache ADD COLUMN IF NOT EXISTS series_title TEXT`,
+            `ALTER TABLE vod_cache ADD COLUMN IF NOT EXISTS season INTEGER`,
+            `ALTER TABLE vod_cache ADD COLUMN IF NOT EXISTS episode INTEGER`,
+            `ALTER TABLE vod_cache ADD COLUMN IF NOT EXISTS downloaded_bytes BIGINT DEFAULT 0`,
+            `ALTER TABLE vod_cache ADD COLUMN IF NOT EXISTS total_bytes BIGINT DEFAULT 0`,
+            `ALTER TABLE vod_cache ADD COLUMN IF NOT EXISTS last_access TIMESTAMP DEFAULT CURRENT_TIMESTAMP`,
+        },
+    },
+    {
+        // stream_id is the primary key; expiry sweeps and the cache list
+        // filter on expires_at and sort on last_access
+        version: 4,
+        name:    "vod_cache indexes",
+        statements: []string{
+            `CREATE INDEX IF NOT EXISTS idx_vod_cache_expires_at ON vod_cache (expires_at)`,
+            `CREATE INDEX IF NOT EXISTS idx_vod_cache_last_access ON vod_cache (last_access DESC)`,
+        },
+    },
+    {
+        // Bot command and interaction that started a cache or recording
+        version: 5,
+        name:    "vod_cache origin columns",
+        statements: []string{
+            `ALTER TABLE vod_cache ADD COLUMN IF NOT EXISTS origin_command TEXT`,
+            `ALTER TABLE vod_cache ADD COLUMN IF NOT EXISTS origin_message_id TEXT`,
+        },
+    },
+    {
+        // Rolling download rate, written with the progress counters
+        version: 6,
+        name:    "vod_cache download rate",
+        statements: []string{
+            `ALTER TABLE vod_cache ADD COLUMN IF NOT EXISTS rate_bytes_per_sec BIGINT DEFAULT 0`,
+        },
+    },
+    {
+        // Why a download was marked failed
+        version: 7,
+        name:    "vod_cache failure reason",
+        statements: []string{
+            `ALTER TABLE vod_cache ADD COLUMN IF NOT EXISTS failure_reason TEXT`,
+        },
+    },
+    {
+        // Timeouts set with !timeout, so they survive a restart
+        version: 8,
+        name:    "user_timeouts table",
+        statements: []string{
+            `
+            CREATE TABLE IF NOT EXISTS user_timeouts (
+                username TEXT PRIMARY KEY,
+                expires_at TIMESTAMP NOT NULL,
+                created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+            )
+            `,
+        },
+    },
+    {
+        // Cache entries are keyed by provider too, so the same stream id
+        // from two providers doesn't collide. Existing rows move to the
+        // default provider.
+        version: 9,
+        name:    "vod_cache provider key",
+        statements: []string{
+            `ALTER TABLE vod_cache ADD COLUMN IF NOT EXISTS provider TEXT NOT NULL DEFAULT '` + DefaultProvider + `'`,
+            `ALTER TABLE vod_cache DROP CONSTRAINT IF EXISTS vod_cache_pkey`,
+            `ALTER TABLE vod_cache ADD PRIMARY KEY (provider, stream_id)`,
+        },
+    },
+    {
+        // Rows written before stream ids were normalized keep their
+        // extension and are missed by bare-id lookups. Of several cache
+        // entries for one id, the bare one or else the last used is kept.
+        version: 10,
+        name:    "normalize stored stream ids",
+        when:    func(m *DBManager) bool { return m.normalizeIDs },
+        statements: []string{
+            `
+            DELETE FROM vod_cache a USING vod_cache b
+            WHERE a.provider = b.provider AND a.stream_id <> b.stream_id
+                AND ` + normalizedStreamIDSQL("a.stream_id") + ` = ` + normalizedStreamIDSQL("b.stream_id") + `
+                AND a.stream_id <> ` + normalizedStreamIDSQL("a.stream_id") + `
+                AND (b.stream_id = ` + normalizedStreamIDSQL("b.stream_id") + `
+                    OR (COALESCE(b.last_access, 'epoch'), b.stream_id) > (COALESCE(a.last_access, 'epoch'), a.stream_id))
+            `,
+            `UPDATE vod_cache SET stream_id = ` + normalizedStreamIDSQL("stream_id") + ` WHERE stream_id <> ` + normalizedStreamIDSQL("stream_id"),
+            `UPDATE stream_history SET stream_id = ` + normalizedStreamIDSQL("stream_id") + ` WHERE stream_id <> ` + normalizedStreamIDSQL("stream_id"),
+            `UPDATE stream_quality SET stream_id = ` + normalizedStreamIDSQL("stream_id") + ` WHERE stream_id <> ` + normalizedStreamIDSQL("stream_id"),
+        },
+    },
+}
+
+// normalizedStreamIDSQL is the SQL form of NormalizeStreamID applied to col.
+func normalizedStreamIDSQL(col string) string {
+    return `regexp_replace(regexp_replace(` + col + `, '^\s+|\s+$', '', 'g'), '\.[^./]*$', '')`
+}
+
+// migrate applies every migration not yet recorded in schema_migrations, in
+// version order. The baseline uses IF NOT EXISTS so databases created before
+// versioning are adopted as-is.
+func (m *DBManager) migrate() error {
+    utils.InfoLog("Running database migrations")
 
     if m == nil || m.db == nil {
         return fmt.Errorf("database not initialized")
     }
 
     if _, err := m.db.Exec(`
-        CREATE TABLE IF NOT EXISTS discord_ldap_mapping (
-            discord_id TEXT PRIMARY KEY,
-            discord_name TEXT NOT NULL,
-            ldap_username TEXT NOT NULL UNIQUE,
-            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-            last_active TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+        CREATE TABLE IF NOT EXISTS schema_migrations (
+            version INTEGER PRIMARY KEY,
+            name TEXT NOT NULL,
+            applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
         )
     `); err != nil {
-        utils.ErrorLog("Failed to create discord_ldap_mapping table: %v", err)
-        return fmt.Errorf("failed to create discord_ldap_mapping table: %w", err)
+        utils.ErrorLog("Failed to create schema_migrations table: %v", err)
+        return fmt.Errorf("failed to create schema_migrations table: %w", err)
     }
 
-    if _, err := m.db.Exec(`
-        CREATE TABLE IF NOT EXISTS stream_history (
-            id SERIAL PRIMARY KEY,
-            username TEXT NOT NULL,
-            discord_id TEXT,
-            stream_id TEXT NOT NULL,
-            stream_type TEXT NOT NULL,
-            stream_title TEXT,
-            start_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-            end_time TIMESTAMP,
-            ip_address TEXT,
-            user_agent TEXT
-        )
-    `); err != nil {
-        utils.ErrorLog("Failed to create stream_history table: %v", err)
-        return fmt.Errorf("failed to create stream_history table: %w", err)
+    applied := make(map[int]bool)
+    rows, err := m.db.Query(`SELECT version FROM schema_migrations`)
+    if err != nil {
+        return fmt.Errorf("failed to read schema_migrations: %w", err)
     }
-
-    if _, err := m.db.Exec(`
-        CREATE TABLE IF NOT EXISTS temporary_links (
-            token TEXT PRIMARY KEY,
-            username TEXT NOT NULL,
-            url TEXT NOT NULL,
-            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-            expires_at TIMESTAMP NOT NULL,
-            stream_id TEXT,
-            title TEXT
-        )
-    `); err != nil {
-        utils.ErrorLog("Failed to create temporary_links table: %v", err)
-        return fmt.Errorf("failed to create temporary_links table: %w", err)
+    for rows.Next() {
+        var v int
+        if err := rows.Scan(&v); err != nil {
+            rows.Close()
+            return fmt.Errorf("failed to read schema_migrations: %w", err)
+        }
+        applied[v] = true
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return fmt.Errorf("failed to read schema_migrations: %w", err)
     }
 
-    if _, err := m.db.Exec(`
-        CREATE TABLE IF NOT EXISTS vod_cache (
-            stream_id TEXT PRIMARY KEY,
-            type TEXT NOT NULL,
-            title TEXT,
-            series_title TEXT,
-            season INTEGER,
-            episode INTEGER,
-            file_path TEXT NOT NULL,
-            requested_by TEXT,
-            downloaded_bytes BIGINT DEFAULT 0,
-            total_bytes BIGINT DEFAULT 0,
-            size_bytes BIGINT DEFAULT 0,
-            status TEXT NOT NULL,
-            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-            expires_at TIMESTAMP NOT NULL,
-            last_access TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-        )
-    `); err != nil {
-        utils.ErrorLog("Failed to create vod_cache table: %v", err)
-        return fmt.Errorf("failed to create vod_cache table: %w", err)
+    for _, mig := range migrations {
+        if applied[mig.version] {
+            utils.DebugLog("Migration %d (%s) already applied, skipping", mig.version, mig.name)
+            continue
+        }
+        if mig.when != nil && !mig.when(m) {
+            utils.InfoLog("Migration %d (%s) does not apply to this setup, leaving it pending", mig.version, mig.name)
+            continue
+        }
+        if err := m.applyMigration(mig); err != nil {
+            utils.ErrorLog("Migration %d (%s) failed: %v", mig.version, mig.name, err)
+            return fmt.Errorf("migration %d (%s) failed: %w", mig.version, mig.name, err)
+        }
+        utils.InfoLog("Applied migration %d (%s)", mig.version, mig.name)
     }
 
-    utils.InfoLog("Database schema initialized successfully")
+    utils.InfoLog("Database schema is at version %d", migrations[len(migrations)-1].version)
     return nil
 }
+
+// applyMigration runs one migration and records it atomically
+func (m *DBManager) applyMigration(mig migration) error {
+    tx, err := m.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback() // no-op once committed
+
+    for _, stmt := range mig.statements {
+        if _, err := tx.Exec(stmt); err != nil {
+            return err
+        }
+    }
+    if _, err := tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, mig.version, mig.name); err != nil {
+        return err
+    }
+    return tx.Commit()
+}
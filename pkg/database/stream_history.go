@@ -19,12 +19,17 @@
 package database
 
 import (
+    "database/sql"
     "fmt"
     "time"
 
+    "github.com/lucasduport/stream-share/pkg/types"
     "github.com/lucasduport/stream-share/pkg/utils"
 )
 
+// MaxHistoryPageSize bounds a single ListStreamHistory page.
+const MaxHistoryPageSize = 500
+
 // AddStreamHistory records a new stream session
 func (m *DBManager) AddStreamHistory(username, streamID, streamType, streamTitle, ipAddress, userAgent string) (int64, error) {
     utils.DebugLog("Database: Recording stream history - user: %s, stream: %s, type: %s", username, streamID, streamType)
@@ -41,7 +46,7 @@ func (m *DBManager) AddStreamHistory(username, streamID, streamType, streamTitle
           (username, discord_id, stream_id, stream_type, stream_title, ip_address, user_agent) 
         VALUES ($1, $2, $3, $4, $5, $6, $7)
         RETURNING id
-    `, username, discordID, streamID, streamType, streamTitle, ipAddress, userAgent).Scan(&id)
+    `, username, discordID, m.streamKey(streamID), streamType, streamTitle, ipAddress, userAgent).Scan(&id)
     if err != nil {
         utils.ErrorLog("Database error adding stream history: %v", err)
         return 0, err
@@ -89,3 +94,66 @@ func (m *DBManager) GetStreamHistoryStats() (map[string]interface{}, error) {
 
     return stats, nil
 }
+
+// ListStreamHistory returns history rows newest first using keyset pagination on id.
+// Pass cursor 0 for the first page and the returned cursor for the next one; a
+// zero next cursor means there are no more rows. An empty username lists everyone.
+func (m *DBManager) ListStreamHistory(username string, cursor int64, limit int) ([]types.StreamHistoryEntry, int64, error) {
+    if m == nil || m.db == nil {
+        return nil, 0, fmt.Errorf("database not initialized")
+    }
+    if limit <= 0 || limit > MaxHistoryPageSize {
+        limit = MaxHistoryPageSize
+    }
+
+    // Fetch one extra row to know whether another page exists
+    rows, err := m.db.Query(`
+        SELECT id, username, COALESCE(discord_id, ''), stream_id, stream_type, COALESCE(stream_title, ''),
+               start_time, end_time, COALESCE(ip_address, ''), COALESCE(user_agent, '')
+        FROM stream_history
+        WHERE ($1 = 0 OR id < $1) AND ($2 = '' OR username = $2)
+        ORDER BY id DESC
+        LIMIT $3
+    `, cursor, username, limit+1)
+    if err != nil {
+        utils.ErrorLog("Database error listing stream history: %v", err)
+        return nil, 0, err
+    }
+    defer rows.Close()
+
+    out := make([]types.StreamHistoryEntry, 0, limit)
+    for rows.Next() {
+        var e types.StreamHistoryEntry
+        var end sql.NullTime
+        if err := rows.Scan(&e.ID, &e.Username, &e.DiscordID, &e.StreamID, &e.StreamType, &e.StreamTitle,
+            &e.StartTime, &end, &e.IPAddress, &e.UserAgent); err != nil {
+            return nil, 0, err
+        }
+        if end.Valid {
+            t := end.Time
+            e.EndTime = &t
+            e.Duration = int64(t.Sub(e.StartTime).Seconds())
+        }
+        out = append(out, e)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, 0, err
+    }
+
+    var next int64
+    if len(out) > limit {
+        out = out[:limit]
+        next = out[limit-1].ID
+    }
+    return out, next, nil
+}
+
+// GetUserStreamHistory returns the most recent history rows of one user.
+func (m *DBManager) GetUserStreamHistory(username string, limit int) ([]types.StreamHistoryEntry, error) {
+    utils.DebugLog("Database: Getting stream history for %s (limit %d)", username, limit)
+    if username == "" {
+        return nil, fmt.Errorf("username is required")
+    }
+    entries, _, err := m.ListStreamHistory(username, 0, limit)
+    return entries, err
+}
@@ -0,0 +1,85 @@
+package database
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestListStreamHistoryPages walks every page of one user's history and checks
+// the pages are newest first, do not overlap and together hold every row.
+func TestListStreamHistoryPages(t *testing.T) {
+	m := testDB(t)
+	const user = "t1523user"
+	cleanup := func() {
+		if _, err := m.db.Exec(`DELETE FROM stream_history WHERE username IN ($1, 't1523other')`, user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+
+	want := map[int64]bool{}
+	for i := 0; i < 7; i++ {
+		id, err := m.AddStreamHistory(user, fmt.Sprintf("t1523s%d", i), "live", "", "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want[id] = true
+	}
+	// Another user's rows must not show up in the filtered pages
+	if _, err := m.AddStreamHistory("t1523other", "t1523x", "live", "", "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[int64]bool{}
+	var cursor, last int64
+	var pages int
+	for {
+		page, next, err := m.ListStreamHistory(user, cursor, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages++
+		if len(page) > 3 {
+			t.Fatalf("page %d has %d rows, limit 3", pages, len(page))
+		}
+		for _, e := range page {
+			if e.Username != user {
+				t.Errorf("row %d belongs to %q", e.ID, e.Username)
+			}
+			if seen[e.ID] {
+				t.Errorf("row %d returned twice", e.ID)
+			}
+			if last != 0 && e.ID >= last {
+				t.Errorf("row %d after %d, want newest first", e.ID, last)
+			}
+			seen[e.ID], last = true, e.ID
+		}
+		if next == 0 {
+			break
+		}
+		if pages > 10 {
+			t.Fatal("pagination does not terminate")
+		}
+		cursor = next
+	}
+
+	if pages != 3 {
+		t.Errorf("pages = %d, want 3", pages)
+	}
+	if len(seen) != len(want) {
+		t.Errorf("got %d rows, want %d", len(seen), len(want))
+	}
+	for id := range want {
+		if !seen[id] {
+			t.Errorf("row %d missing", id)
+		}
+	}
+}
+
+func TestListStreamHistoryNoDB(t *testing.T) {
+	var m *DBManager
+	if _, _, err := m.ListStreamHistory("", 0, 10); err == nil {
+		t.Error("ListStreamHistory without a database returned no error")
+	}
+}
@@ -0,0 +1,88 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package database
+
+import (
+    "os"
+    "path"
+    "regexp"
+    "strings"
+
+    "github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// streamKey returns the form of a stream id stored in and looked up from the
+// database. With DB_NORMALIZE_STREAM_IDS (the default) that is the bare id, so
+// "123.mp4" and "123" address the same rows whichever form the caller has.
+func (m *DBManager) streamKey(streamID string) string {
+    if !m.normalizeIDs {
+        return streamID
+    }
+    return NormalizeStreamID(streamID)
+}
+
+// NormalizeStreamID trims surrounding spaces and a container extension.
+func NormalizeStreamID(streamID string) string {
+    id := strings.TrimSpace(streamID)
+    return strings.TrimSuffix(id, path.Ext(id))
+}
+
+// NormalizesStreamIDs reports whether stream ids are stored in bare form.
+func (m *DBManager) NormalizesStreamIDs() bool {
+    return m != nil && m.normalizeIDs
+}
+
+// DefaultProvider is the provider key of a single-provider setup, and of
+// cache entries stored before entries were keyed by provider.
+const DefaultProvider = "default"
+
+// providerIDPattern limits provider keys to what is safe in a file name.
+var providerIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// providerFromEnv reads PROVIDER_ID, the key this instance stores its cache
+// entries under (default DefaultProvider).
+func providerFromEnv() string {
+    v := strings.TrimSpace(os.Getenv("PROVIDER_ID"))
+    if v == "" {
+        return DefaultProvider
+    }
+    if !providerIDPattern.MatchString(v) {
+        utils.WarnLog("Invalid PROVIDER_ID: %s", v)
+        return DefaultProvider
+    }
+    utils.InfoLog("Cache provider key: %s", v)
+    return v
+}
+
+// Provider returns the key of the provider this instance serves, to pass to
+// the vod_cache methods.
+func (m *DBManager) Provider() string {
+    if m == nil || m.provider == "" {
+        return DefaultProvider
+    }
+    return m.provider
+}
+
+// providerKey returns the provider key stored for provider.
+func providerKey(provider string) string {
+    if p := strings.TrimSpace(provider); p != "" {
+        return p
+    }
+    return DefaultProvider
+}
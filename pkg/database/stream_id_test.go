@@ -0,0 +1,171 @@
+package database
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/lucasduport/stream-share/pkg/types"
+)
+
+// testDB connects to the PostgreSQL database named by TEST_DATABASE_URL, with
+// every migration applied, and skips the test when it is unset.
+func testDB(t *testing.T) *DBManager {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	t.Setenv("DATABASE_URL", dsn)
+	t.Setenv("DB_NORMALIZE_STREAM_IDS", "")
+	t.Setenv("PROVIDER_ID", "")
+	m, err := NewDBManager("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+func TestNormalizeStreamID(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"123", "123"},
+		{"123.mp4", "123"},
+		{" 123.mkv ", "123"},
+		{"123.", "123"},
+		{"123.tar.gz", "123.tar"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeStreamID(tt.in); got != tt.want {
+			t.Errorf("NormalizeStreamID(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestStreamKey(t *testing.T) {
+	tests := []struct {
+		normalize bool
+		in, want  string
+	}{
+		{true, "123.mp4", "123"},
+		{true, "123", "123"},
+		{false, "123.mp4", "123.mp4"},
+	}
+	for _, tt := range tests {
+		m := &DBManager{normalizeIDs: tt.normalize}
+		if got := m.streamKey(tt.in); got != tt.want {
+			t.Errorf("normalize=%v: streamKey(%q) = %q, want %q", tt.normalize, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestVODCacheStreamIDForms(t *testing.T) {
+	m := testDB(t)
+	tests := []struct {
+		name           string
+		stored, lookup string
+	}{
+		{"stored with extension, looked up bare", "t1534a.mp4", "t1534a"},
+		{"stored bare, looked up with extension", "t1534b", "t1534b.mkv"},
+		{"same extension", "t1534c.mp4", "t1534c.mp4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer m.DeleteVODCache("", tt.stored) // nolint: errcheck
+			err := m.UpsertVODCache(&types.VODCacheEntry{
+				StreamID: tt.stored, Type: "movie", FilePath: "/cache/" + tt.stored,
+				Status: "ready", ExpiresAt: time.Now().Add(time.Hour),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			e, err := m.GetVODCache("", tt.lookup)
+			if err != nil {
+				t.Fatalf("GetVODCache(%q): %v", tt.lookup, err)
+			}
+			if want := NormalizeStreamID(tt.stored); e.StreamID != want {
+				t.Errorf("stream_id = %q, want %q", e.StreamID, want)
+			}
+		})
+	}
+}
+
+// TestStreamIDMigration runs the normalization migration over rows written
+// with their extension, as older releases did.
+func TestStreamIDMigration(t *testing.T) {
+	m := testDB(t)
+	var mig migration
+	for _, mg := range migrations {
+		if mg.name == "normalize stored stream ids" {
+			mig = mg
+		}
+	}
+	if mig.version == 0 {
+		t.Fatal("normalization migration not found")
+	}
+	if mig.when(&DBManager{normalizeIDs: false}) {
+		t.Error("migration applies with normalization off")
+	}
+
+	exec := func(q string, args ...interface{}) {
+		t.Helper()
+		if _, err := m.db.Exec(q, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cleanup := func() {
+		exec(`DELETE FROM vod_cache WHERE stream_id LIKE 't1534m%'`)
+		exec(`DELETE FROM stream_history WHERE stream_id LIKE 't1534m%'`)
+	}
+	cleanup()
+	defer cleanup()
+
+	insert := `INSERT INTO vod_cache (provider, stream_id, type, file_path, status, expires_at, last_access)
+		VALUES ('default', $1, 'movie', $2, 'ready', CURRENT_TIMESTAMP + interval '1 hour', $3)`
+	old := time.Now().Add(-time.Hour)
+	exec(insert, "t1534m1.mp4", "/cache/one", old)
+	exec(insert, "t1534m2.mp4", "/cache/two-old", old)
+	exec(insert, "t1534m2.mkv", "/cache/two-new", time.Now())
+	exec(insert, "t1534m3.mp4", "/cache/three-ext", time.Now())
+	exec(insert, "t1534m3", "/cache/three-bare", old)
+	exec(`INSERT INTO stream_history (username, stream_id, stream_type) VALUES ('alice', 't1534m1.mp4', 'movie')`)
+
+	for _, stmt := range mig.statements {
+		exec(stmt)
+	}
+
+	tests := []struct {
+		id, wantFile string
+	}{
+		{"t1534m1", "/cache/one"},
+		{"t1534m2", "/cache/two-new"},
+		{"t1534m3", "/cache/three-bare"},
+	}
+	for _, tt := range tests {
+		e, err := m.GetVODCache("", tt.id)
+		if err != nil {
+			t.Errorf("GetVODCache(%q): %v", tt.id, err)
+			continue
+		}
+		if e.FilePath != tt.wantFile {
+			t.Errorf("%s: file_path = %q, want %q", tt.id, e.FilePath, tt.wantFile)
+		}
+	}
+	var rows int
+	if err := m.db.QueryRow(`SELECT COUNT(*) FROM vod_cache WHERE stream_id LIKE 't1534m%'`).Scan(&rows); err != nil {
+		t.Fatal(err)
+	}
+	if rows != len(tests) {
+		t.Errorf("%d vod_cache rows left, want %d", rows, len(tests))
+	}
+	var history string
+	if err := m.db.QueryRow(`SELECT stream_id FROM stream_history WHERE stream_id LIKE 't1534m%'`).Scan(&history); err != nil {
+		t.Fatal(err)
+	}
+	if history != "t1534m1" {
+		t.Errorf("stream_history stream_id = %q, want t1534m1", history)
+	}
+}
@@ -0,0 +1,46 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package database
+
+import (
+    "fmt"
+
+    "github.com/lucasduport/stream-share/pkg/types"
+    "github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// SaveStreamQuality stores the delivery counters of a finished stream
+func (m *DBManager) SaveStreamQuality(s *types.StreamQualitySummary) error {
+    utils.DebugLog("Database: Saving quality summary for stream %s", s.StreamID)
+    if m == nil || m.db == nil {
+        return fmt.Errorf("database not initialized")
+    }
+    _, err := m.db.Exec(`
+        INSERT INTO stream_quality
+          (stream_id, stream_type, stream_title, start_time, end_time,
+           blocked_sends, blocked_ms, drop_events, dropped_chunks, stalls)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+    `, m.streamKey(s.StreamID), s.StreamType, s.StreamTitle, s.StartTime, s.EndTime,
+        s.BlockedSends, s.BlockedMillis, s.DropEvents, s.DroppedChunks, s.Stalls)
+    if err != nil {
+        utils.ErrorLog("Database error saving stream quality: %v", err)
+        return err
+    }
+    return nil
+}
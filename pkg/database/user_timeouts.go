@@ -0,0 +1,94 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package database
+
+import (
+    "fmt"
+    "time"
+
+    "github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// SetUserTimeout stores or replaces the timeout of a user, active until until.
+func (m *DBManager) SetUserTimeout(username string, until time.Time) error {
+    utils.DebugLog("Database: Setting timeout for %s until %v", username, until)
+    if m == nil || m.db == nil {
+        return fmt.Errorf("database not initialized")
+    }
+    _, err := m.db.Exec(`
+        INSERT INTO user_timeouts (username, expires_at)
+        VALUES ($1, $2)
+        ON CONFLICT (username) DO UPDATE SET expires_at = EXCLUDED.expires_at, created_at = CURRENT_TIMESTAMP
+    `, username, until)
+    if err != nil {
+        utils.ErrorLog("Database error setting user timeout: %v", err)
+        return err
+    }
+    return nil
+}
+
+// DeleteUserTimeout removes the timeout of a user and reports whether one existed.
+func (m *DBManager) DeleteUserTimeout(username string) (bool, error) {
+    if m == nil || m.db == nil {
+        return false, fmt.Errorf("database not initialized")
+    }
+    result, err := m.db.Exec(`DELETE FROM user_timeouts WHERE username = $1`, username)
+    if err != nil {
+        utils.ErrorLog("Database error deleting user timeout: %v", err)
+        return false, err
+    }
+    rows, _ := result.RowsAffected()
+    return rows > 0, nil
+}
+
+// ListActiveUserTimeouts returns the timeouts that have not expired yet, by username.
+func (m *DBManager) ListActiveUserTimeouts() (map[string]time.Time, error) {
+    if m == nil || m.db == nil {
+        return nil, fmt.Errorf("database not initialized")
+    }
+    rows, err := m.db.Query(`SELECT username, expires_at FROM user_timeouts WHERE expires_at > CURRENT_TIMESTAMP`)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    out := make(map[string]time.Time)
+    for rows.Next() {
+        var username string
+        var until time.Time
+        if err := rows.Scan(&username, &until); err != nil {
+            return nil, err
+        }
+        out[username] = until
+    }
+    return out, rows.Err()
+}
+
+// CleanupExpiredUserTimeouts removes timeouts that have run out.
+func (m *DBManager) CleanupExpiredUserTimeouts() (int64, error) {
+    if m == nil || m.db == nil {
+        return 0, fmt.Errorf("database not initialized")
+    }
+    result, err := m.db.Exec(`DELETE FROM user_timeouts WHERE expires_at < CURRENT_TIMESTAMP`)
+    if err != nil {
+        utils.ErrorLog("Database error cleaning up user timeouts: %v", err)
+        return 0, err
+    }
+    rows, _ := result.RowsAffected()
+    return rows, nil
+}
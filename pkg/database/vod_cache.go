@@ -22,17 +22,39 @@ import (
     "database/sql"
     "fmt"
 
+    "github.com/lib/pq"
     "github.com/lucasduport/stream-share/pkg/types"
     "github.com/lucasduport/stream-share/pkg/utils"
 )
 
-// UpsertVODCache stores or updates a cache entry
+// vodCacheColumns selects a vod_cache row in scanVODCache order. Optional
+// columns are coalesced: rows from before a migration may hold NULLs.
+const vodCacheColumns = `stream_id, type, COALESCE(title, ''), COALESCE(series_title, ''), COALESCE(season, 0), COALESCE(episode, 0),
+        file_path, COALESCE(requested_by, ''), COALESCE(downloaded_bytes, 0), COALESCE(total_bytes, 0), COALESCE(size_bytes, 0),
+        status, COALESCE(created_at, CURRENT_TIMESTAMP), expires_at, COALESCE(last_access, CURRENT_TIMESTAMP),
+        COALESCE(origin_command, ''), COALESCE(origin_message_id, ''), COALESCE(rate_bytes_per_sec, 0),
+        COALESCE(failure_reason, ''), provider`
+
+// scanVODCache reads one row selected with vodCacheColumns
+func scanVODCache(row interface{ Scan(...interface{}) error }) (*types.VODCacheEntry, error) {
+    var e types.VODCacheEntry
+    err := row.Scan(&e.StreamID, &e.Type, &e.Title, &e.SeriesTitle, &e.Season, &e.Episode, &e.FilePath, &e.RequestedBy,
+        &e.DownloadedBytes, &e.TotalBytes, &e.SizeBytes, &e.Status, &e.CreatedAt, &e.ExpiresAt, &e.LastAccess,
+        &e.OriginCommand, &e.OriginMessageID, &e.RateBytesPerSec, &e.FailureReason, &e.Provider)
+    if err != nil {
+        return nil, err
+    }
+    return &e, nil
+}
+
+// UpsertVODCache stores or updates a cache entry, keyed by its provider
+// (DefaultProvider when empty) and stream id
 func (m *DBManager) UpsertVODCache(e *types.VODCacheEntry) error {
     if m == nil || m.db == nil { return fmt.Errorf("database not initialized") }
     _, err := m.db.Exec(`
-        INSERT INTO vod_cache (stream_id, type, title, series_title, season, episode, file_path, requested_by, downloaded_bytes, total_bytes, size_bytes, status, created_at, expires_at, last_access)
-        VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,COALESCE($13, CURRENT_TIMESTAMP),$14,COALESCE($15, CURRENT_TIMESTAMP))
-        ON CONFLICT(stream_id) DO UPDATE SET
+        INSERT INTO vod_cache (stream_id, type, title, series_title, season, episode, file_path, requested_by, downloaded_bytes, total_bytes, size_bytes, status, created_at, expires_at, last_access, origin_command, origin_message_id, rate_bytes_per_sec, failure_reason, provider)
+        VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,COALESCE($13, CURRENT_TIMESTAMP),$14,COALESCE($15, CURRENT_TIMESTAMP),NULLIF($16, ''),NULLIF($17, ''),$18,NULLIF($19, ''),$20)
+        ON CONFLICT(provider, stream_id) DO UPDATE SET
           type = COALESCE(NULLIF(EXCLUDED.type, ''), vod_cache.type),
           title = COALESCE(NULLIF(EXCLUDED.title, ''), vod_cache.title),
           series_title = COALESCE(NULLIF(EXCLUDED.series_title, ''), vod_cache.series_title),
@@ -45,28 +67,77 @@ func (m *DBManager) UpsertVODCache(e *types.VODCacheEntry) error {
           size_bytes = CASE WHEN EXCLUDED.size_bytes IS NOT NULL AND EXCLUDED.size_bytes <> 0 THEN EXCLUDED.size_bytes ELSE vod_cache.size_bytes END,
           status = COALESCE(NULLIF(EXCLUDED.status, ''), vod_cache.status),
           expires_at = EXCLUDED.expires_at,
-          last_access = COALESCE(EXCLUDED.last_access, CURRENT_TIMESTAMP)
-    `, e.StreamID, e.Type, e.Title, e.SeriesTitle, e.Season, e.Episode, e.FilePath, e.RequestedBy, e.DownloadedBytes, e.TotalBytes, e.SizeBytes, e.Status, e.CreatedAt, e.ExpiresAt, e.LastAccess)
+          last_access = COALESCE(EXCLUDED.last_access, CURRENT_TIMESTAMP),
+          origin_command = COALESCE(EXCLUDED.origin_command, vod_cache.origin_command),
+          origin_message_id = COALESCE(EXCLUDED.origin_message_id, vod_cache.origin_message_id),
+          rate_bytes_per_sec = EXCLUDED.rate_bytes_per_sec,
+          failure_reason = CASE WHEN EXCLUDED.status = 'failed' THEN EXCLUDED.failure_reason
+                                WHEN COALESCE(EXCLUDED.status, '') <> '' THEN NULL
+                                ELSE vod_cache.failure_reason END
+    `, m.streamKey(e.StreamID), e.Type, e.Title, e.SeriesTitle, e.Season, e.Episode, e.FilePath, e.RequestedBy, e.DownloadedBytes, e.TotalBytes, e.SizeBytes, e.Status, e.CreatedAt, e.ExpiresAt, e.LastAccess, e.OriginCommand, e.OriginMessageID, e.RateBytesPerSec, e.FailureReason, providerKey(e.Provider))
     if err != nil { utils.ErrorLog("DB UpsertVODCache error: %v", err) }
     return err
 }
 
-// GetVODCache returns a cache entry for a stream id if exists and not expired
-func (m *DBManager) GetVODCache(streamID string) (*types.VODCacheEntry, error) {
+// GetVODCache returns the cache entry of a provider's stream id if exists and not expired
+func (m *DBManager) GetVODCache(provider, streamID string) (*types.VODCacheEntry, error) {
     if m == nil || m.db == nil { return nil, fmt.Errorf("database not initialized") }
-    row := m.db.QueryRow(`SELECT stream_id, type, title, series_title, season, episode, file_path, requested_by, downloaded_bytes, total_bytes, size_bytes, status, created_at, expires_at, last_access
-        FROM vod_cache WHERE stream_id=$1 AND expires_at > CURRENT_TIMESTAMP`, streamID)
-    var e types.VODCacheEntry
-    if err := row.Scan(&e.StreamID, &e.Type, &e.Title, &e.SeriesTitle, &e.Season, &e.Episode, &e.FilePath, &e.RequestedBy, &e.DownloadedBytes, &e.TotalBytes, &e.SizeBytes, &e.Status, &e.CreatedAt, &e.ExpiresAt, &e.LastAccess); err != nil {
-        return nil, err
+    row := m.db.QueryRow(`SELECT `+vodCacheColumns+`
+        FROM vod_cache WHERE provider=$1 AND stream_id=$2 AND expires_at > CURRENT_TIMESTAMP`, providerKey(provider), m.streamKey(streamID))
+    return scanVODCache(row)
+}
+
+// DeleteVODCache removes a cache entry and returns it, or nil when there was none
+func (m *DBManager) DeleteVODCache(provider, streamID string) (*types.VODCacheEntry, error) {
+    if m == nil || m.db == nil { return nil, fmt.Errorf("database not initialized") }
+    row := m.db.QueryRow(`DELETE FROM vod_cache WHERE provider=$1 AND stream_id=$2 RETURNING `+vodCacheColumns, providerKey(provider), m.streamKey(streamID))
+    e, err := scanVODCache(row)
+    if err == sql.ErrNoRows { return nil, nil }
+    if err != nil { utils.ErrorLog("DB DeleteVODCache error: %v", err) }
+    return e, err
+}
+
+// UpdateVODCacheProgress writes the byte counters and rate of several downloads in a
+// single statement. Rows that already left the downloading state are not touched,
+// so a late progress flush never overrides a final ready/failed write.
+func (m *DBManager) UpdateVODCacheProgress(entries []types.VODCacheEntry) error {
+    if m == nil || m.db == nil { return fmt.Errorf("database not initialized") }
+    if len(entries) == 0 { return nil }
+    providers := make([]string, len(entries))
+    ids := make([]string, len(entries))
+    downloaded := make([]int64, len(entries))
+    total := make([]int64, len(entries))
+    access := make([]string, len(entries))
+    rate := make([]int64, len(entries))
+    for i, e := range entries {
+        providers[i], ids[i] = providerKey(e.Provider), m.streamKey(e.StreamID)
+        downloaded[i], total[i], rate[i] = e.DownloadedBytes, e.TotalBytes, e.RateBytesPerSec
+        // last_access has no time zone: store the wall clock, as a single upsert does
+        access[i] = e.LastAccess.Format("2006-01-02 15:04:05.999999")
     }
-    return &e, nil
+    _, err := m.db.Exec(`UPDATE vod_cache v SET downloaded_bytes=u.downloaded, total_bytes=u.total, last_access=u.access, rate_bytes_per_sec=u.rate
+        FROM unnest($1::text[], $2::text[], $3::bigint[], $4::bigint[], $5::timestamp[], $6::bigint[]) AS u(provider, stream_id, downloaded, total, access, rate)
+        WHERE v.provider=u.provider AND v.stream_id=u.stream_id AND v.status='downloading'`,
+        pq.Array(providers), pq.Array(ids), pq.Array(downloaded), pq.Array(total), pq.Array(access), pq.Array(rate))
+    if err != nil { utils.ErrorLog("DB UpdateVODCacheProgress error for %d downloads: %v", len(entries), err) }
+    return err
+}
+
+// ClaimQueuedVODCache moves a queued entry to downloading when its download
+// leaves the queue. It reports false when the entry was deleted or changed
+// state meanwhile, in which case the download must not start.
+func (m *DBManager) ClaimQueuedVODCache(provider, streamID string) (bool, error) {
+    if m == nil || m.db == nil { return false, fmt.Errorf("database not initialized") }
+    res, err := m.db.Exec(`UPDATE vod_cache SET status='downloading', last_access=CURRENT_TIMESTAMP WHERE provider=$1 AND stream_id=$2 AND status='queued'`, providerKey(provider), m.streamKey(streamID))
+    if err != nil { return false, err }
+    n, _ := res.RowsAffected()
+    return n > 0, nil
 }
 
 // TouchVODCache updates last_access
-func (m *DBManager) TouchVODCache(streamID string) error {
+func (m *DBManager) TouchVODCache(provider, streamID string) error {
     if m == nil || m.db == nil { return fmt.Errorf("database not initialized") }
-    _, err := m.db.Exec(`UPDATE vod_cache SET last_access=CURRENT_TIMESTAMP WHERE stream_id=$1`, streamID)
+    _, err := m.db.Exec(`UPDATE vod_cache SET last_access=CURRENT_TIMESTAMP WHERE provider=$1 AND stream_id=$2`, providerKey(provider), m.streamKey(streamID))
     return err
 }
 
@@ -80,27 +151,52 @@ func (m *DBManager) CleanupExpiredCache() (int64, error) {
     return n, nil
 }
 
-// ListVODCache returns non-expired cache entries ordered by soonest expiry first. If limit<=0, returns all.
+// PurgeExpiredVODCache deletes expired rows that are no longer downloading and
+// returns them so the caller can remove the files. Rows whose file_path is in
+// keep (files being served right now) are left for a later sweep.
+func (m *DBManager) PurgeExpiredVODCache(keep []string) ([]types.VODCacheEntry, error) {
+    if m == nil || m.db == nil { return nil, fmt.Errorf("database not initialized") }
+    if keep == nil { keep = []string{} }
+    rows, err := m.db.Query(`DELETE FROM vod_cache
+        WHERE expires_at < CURRENT_TIMESTAMP AND status <> 'downloading' AND NOT (file_path = ANY($1))
+        RETURNING `+vodCacheColumns, pq.Array(keep))
+    if err != nil {
+        utils.ErrorLog("DB PurgeExpiredVODCache error: %v", err)
+        return nil, err
+    }
+    defer rows.Close()
+    purged := make([]types.VODCacheEntry, 0)
+    for rows.Next() {
+        e, err := scanVODCache(rows)
+        if err != nil {
+            return purged, err
+        }
+        purged = append(purged, *e)
+    }
+    return purged, rows.Err()
+}
+
+// ListVODCache returns non-expired cache entries, most recently used first. If limit<=0, returns all.
 func (m *DBManager) ListVODCache(limit int) ([]types.VODCacheEntry, error) {
     if m == nil || m.db == nil { return nil, fmt.Errorf("database not initialized") }
     var rows *sql.Rows
     var err error
     if limit > 0 {
-        rows, err = m.db.Query(`SELECT stream_id, type, title, series_title, season, episode, file_path, requested_by, downloaded_bytes, total_bytes, size_bytes, status, created_at, expires_at, last_access
-            FROM vod_cache WHERE expires_at > CURRENT_TIMESTAMP ORDER BY expires_at ASC LIMIT $1`, limit)
+        rows, err = m.db.Query(`SELECT `+vodCacheColumns+`
+            FROM vod_cache WHERE expires_at > CURRENT_TIMESTAMP ORDER BY last_access DESC LIMIT $1`, limit)
     } else {
-        rows, err = m.db.Query(`SELECT stream_id, type, title, series_title, season, episode, file_path, requested_by, downloaded_bytes, total_bytes, size_bytes, status, created_at, expires_at, last_access
-            FROM vod_cache WHERE expires_at > CURRENT_TIMESTAMP ORDER BY expires_at ASC`)
+        rows, err = m.db.Query(`SELECT `+vodCacheColumns+`
+            FROM vod_cache WHERE expires_at > CURRENT_TIMESTAMP ORDER BY last_access DESC`)
     }
     if err != nil { return nil, err }
     defer rows.Close()
     list := make([]types.VODCacheEntry, 0)
     for rows.Next() {
-        var e types.VODCacheEntry
-        if err := rows.Scan(&e.StreamID, &e.Type, &e.Title, &e.SeriesTitle, &e.Season, &e.Episode, &e.FilePath, &e.RequestedBy, &e.DownloadedBytes, &e.TotalBytes, &e.SizeBytes, &e.Status, &e.CreatedAt, &e.ExpiresAt, &e.LastAccess); err != nil {
+        e, err := scanVODCache(rows)
+        if err != nil {
             return nil, err
         }
-        list = append(list, e)
+        list = append(list, *e)
     }
-    return list, nil
+    return list, rows.Err()
 }
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lucasduport/stream-share/pkg/types"
+)
+
+// TestUpdateVODCacheProgress writes one batch over rows in every state and
+// checks that only the downloading rows of the right provider moved.
+func TestUpdateVODCacheProgress(t *testing.T) {
+	m := testDB(t)
+	rows := []struct {
+		provider, id, status string
+		wantMoved            bool
+	}{
+		{"", "t1587a", "downloading", true},
+		{"", "t1587b", "ready", false},
+		{"", "t1587c", "failed", false},
+		{"", "t1587d", "queued", false},
+		{"other", "t1587a", "downloading", false}, // same id, other provider
+	}
+	for _, r := range rows {
+		defer m.DeleteVODCache(r.provider, r.id) // nolint: errcheck
+		err := m.UpsertVODCache(&types.VODCacheEntry{
+			Provider: r.provider, StreamID: r.id, Type: "movie", FilePath: "/cache/" + r.id,
+			Status: r.status, DownloadedBytes: 10, TotalBytes: 1000, ExpiresAt: time.Now().Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var batch []types.VODCacheEntry
+	for _, id := range []string{"t1587a.mp4", "t1587b", "t1587c", "t1587d", "t1587missing"} {
+		batch = append(batch, types.VODCacheEntry{StreamID: id, DownloadedBytes: 500, TotalBytes: 1000, RateBytesPerSec: 42, LastAccess: time.Now()})
+	}
+	if err := m.UpdateVODCacheProgress(batch); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range rows {
+		e, err := m.GetVODCache(r.provider, r.id)
+		if err != nil {
+			t.Fatalf("GetVODCache(%q, %q): %v", r.provider, r.id, err)
+		}
+		want := int64(10)
+		if r.wantMoved {
+			want = 500
+		}
+		if e.DownloadedBytes != want || e.Status != r.status {
+			t.Errorf("%s/%s (%s): downloaded %d status %s, want %d %s", r.provider, r.id, r.status, e.DownloadedBytes, e.Status, want, r.status)
+		}
+		if r.wantMoved && e.RateBytesPerSec != 42 {
+			t.Errorf("%s: rate %d, want 42", r.id, e.RateBytesPerSec)
+		}
+	}
+
+	if err := m.UpdateVODCacheProgress(nil); err != nil {
+		t.Errorf("empty batch: %v", err)
+	}
+}
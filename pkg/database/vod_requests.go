@@ -0,0 +1,84 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package database
+
+import (
+    "encoding/json"
+    "fmt"
+
+    "github.com/lucasduport/stream-share/pkg/types"
+    "github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// SaveVODRequest stores a VOD search and its result set keyed by token
+func (m *DBManager) SaveVODRequest(req *types.VODRequest) error {
+    if m == nil || m.db == nil {
+        return fmt.Errorf("database not initialized")
+    }
+    results, err := json.Marshal(req.Results)
+    if err != nil {
+        return fmt.Errorf("failed to encode VOD results: %w", err)
+    }
+    utils.DebugLog("Database: Saving VOD request %s (%d results, expires %v)", req.Token, len(req.Results), req.ExpiresAt)
+    _, err = m.db.Exec(`
+        INSERT INTO vod_requests (token, username, query, results, created_at, expires_at)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        ON CONFLICT (token) DO UPDATE SET results = EXCLUDED.results, expires_at = EXCLUDED.expires_at
+    `, req.Token, req.Username, req.Query, string(results), req.CreatedAt, req.ExpiresAt)
+    if err != nil {
+        utils.ErrorLog("Database error saving VOD request: %v", err)
+        return err
+    }
+    return nil
+}
+
+// GetVODRequest retrieves a non-expired VOD request by token
+func (m *DBManager) GetVODRequest(token string) (*types.VODRequest, error) {
+    if m == nil || m.db == nil {
+        return nil, fmt.Errorf("database not initialized")
+    }
+    req := &types.VODRequest{}
+    var results string
+    err := m.db.QueryRow(`
+        SELECT token, username, query, results, created_at, expires_at
+        FROM vod_requests
+        WHERE token = $1 AND expires_at > CURRENT_TIMESTAMP
+    `, token).Scan(&req.Token, &req.Username, &req.Query, &results, &req.CreatedAt, &req.ExpiresAt)
+    if err != nil {
+        return nil, err
+    }
+    if err := json.Unmarshal([]byte(results), &req.Results); err != nil {
+        return nil, fmt.Errorf("failed to decode VOD results: %w", err)
+    }
+    return req, nil
+}
+
+// CleanupExpiredVODRequests removes expired VOD requests
+func (m *DBManager) CleanupExpiredVODRequests() (int64, error) {
+    if m == nil || m.db == nil {
+        return 0, fmt.Errorf("database not initialized")
+    }
+    result, err := m.db.Exec(`DELETE FROM vod_requests WHERE expires_at < CURRENT_TIMESTAMP`)
+    if err != nil {
+        utils.ErrorLog("Database error cleaning up expired VOD requests: %v", err)
+        return 0, err
+    }
+    rows, _ := result.RowsAffected()
+    return rows, nil
+}
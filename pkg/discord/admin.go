@@ -20,8 +20,12 @@ package discord
 
 import (
     "fmt"
+    "net/url"
+    "strings"
+    "time"
 
     "github.com/bwmarrin/discordgo"
+    "github.com/lucasduport/stream-share/pkg/utils"
 )
 
 // handleDisconnect forcibly disconnects a user (admin only).
@@ -44,3 +48,141 @@ func (b *Bot) handleTimeout(s *discordgo.Session, m *discordgo.MessageCreate, ar
     if err != nil || !ok { b.fail(m.ChannelID, "❌ Timeout Failed", fmt.Sprintf("We couldn't set a timeout for this user.\n\nError: `%v`", err)); return }
     b.success(m.ChannelID, "✅ Timeout Applied", fmt.Sprintf("User **%s** has been timed out for **%d** minutes.", username, minutes))
 }
+
+// handleUntimeout lifts a user's timeout before it runs out (admin only).
+func (b *Bot) handleUntimeout(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+    if !b.isAdmin(m.Member) { b.warn(m.ChannelID, "⛔ Not Allowed", "Only admins can lift timeouts."); return }
+    if len(args) != 1 || strings.TrimSpace(args[0]) == "" { b.info(m.ChannelID, "⏳ Lift Timeout", "Usage: `!untimeout <username>`"); return }
+    username := strings.TrimSpace(args[0])
+    ok, _, err := b.makeAPIRequest("POST", "/users/untimeout/"+url.PathEscape(username), nil)
+    if err != nil || !ok { b.fail(m.ChannelID, "❌ Untimeout Failed", fmt.Sprintf("We couldn't lift the timeout of this user.\n\nError: `%v`", err)); return }
+    b.success(m.ChannelID, "✅ Timeout Lifted", fmt.Sprintf("User **%s** can use the service again.", username))
+}
+
+// handleStopAll asks for confirmation before force-stopping every stream (admin only).
+// Usage: !stopall [block] — "block" also refuses new streams until !resume.
+func (b *Bot) handleStopAll(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+    if !b.isAdmin(m.Member) { b.warn(m.ChannelID, "⛔ Not Allowed", "Only admins can stop all streams."); return }
+    block := len(args) > 0 && strings.EqualFold(args[0], "block")
+    confirmID := "stopall_confirm"
+    desc := "This will stop **every** active stream and disconnect all viewers."
+    if block {
+        confirmID = "stopall_confirm_block"
+        desc += "\nNew streams will be **blocked** until `!resume`."
+    }
+    embed := &discordgo.MessageEmbed{Title: "🛑 Stop All Streams?", Description: desc, Color: colorWarn}
+    components := []discordgo.MessageComponent{
+        discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+            discordgo.Button{Style: discordgo.DangerButton, Label: "Stop everything", CustomID: confirmID},
+            discordgo.Button{Style: discordgo.SecondaryButton, Label: "Cancel", CustomID: "stopall_cancel"},
+        }},
+    }
+    if _, err := s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{embed}, Components: components}); err != nil {
+        utils.ErrorLog("Discord: failed to send stopall confirmation: %v", err)
+    }
+}
+
+// handleStopAllComponent handles the confirm/cancel buttons of !stopall.
+func (b *Bot) handleStopAllComponent(s *discordgo.Session, i *discordgo.InteractionCreate) {
+    if !b.isAdmin(i.Member) {
+        _ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseChannelMessageWithSource, Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral, Content: "Only admins can confirm this."}})
+        return
+    }
+    customID := i.MessageComponentData().CustomID
+    noComponents := []discordgo.MessageComponent{}
+    if customID == "stopall_cancel" {
+        _ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseUpdateMessage, Data: &discordgo.InteractionResponseData{
+            Embeds: []*discordgo.MessageEmbed{{Title: "Stop All Cancelled", Description: "No streams were stopped.", Color: colorInfo}}, Components: noComponents}})
+        return
+    }
+    _ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseDeferredMessageUpdate})
+
+    actor := "discord:" + b.interactionUserID(i)
+    if i.Member != nil && i.Member.User != nil { actor = "discord:" + i.Member.User.Username }
+    payload := map[string]interface{}{"block": customID == "stopall_confirm_block", "actor": actor}
+    ok, resp, err := b.makeAPIRequest("POST", "/admin/streams/stopall", payload)
+    embed := &discordgo.MessageEmbed{Title: "❌ Stop All Failed", Description: fmt.Sprintf("Error: `%v`", err), Color: colorError}
+    if err == nil && ok {
+        data, _ := resp.(map[string]interface{})
+        desc := fmt.Sprintf("Stopped **%d** streams and disconnected **%d** viewers.", getInt64(data, "streams_stopped"), getInt64(data, "viewers_disconnected"))
+        if blocked, _ := data["blocked"].(bool); blocked { desc += "\nNew streams are blocked. Use `!resume` to allow them again." }
+        embed = &discordgo.MessageEmbed{Title: "🛑 All Streams Stopped", Description: desc, Color: colorSuccess}
+    }
+    embeds := []*discordgo.MessageEmbed{embed}
+    if _, err := s.ChannelMessageEditComplex(&discordgo.MessageEdit{ID: i.Message.ID, Channel: i.Message.ChannelID, Embeds: &embeds, Components: &noComponents}); err != nil {
+        utils.WarnLog("Discord: failed to update stopall message: %v", err)
+    }
+}
+
+// handleResume allows new streams again after a blocking !stopall (admin only).
+func (b *Bot) handleResume(s *discordgo.Session, m *discordgo.MessageCreate, _ []string) {
+    if !b.isAdmin(m.Member) { b.warn(m.ChannelID, "⛔ Not Allowed", "Only admins can resume streaming."); return }
+    ok, _, err := b.makeAPIRequest("POST", "/admin/streams/resume", map[string]string{"actor": "discord:" + m.Author.Username})
+    if err != nil || !ok { b.fail(m.ChannelID, "❌ Resume Failed", fmt.Sprintf("We couldn't re-enable streaming.\n\nError: `%v`", err)); return }
+    b.success(m.ChannelID, "✅ Streaming Resumed", "New streams are allowed again.")
+}
+
+// handleKill force-stops a single stream and disconnects its viewers (admin only).
+func (b *Bot) handleKill(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+    if !b.isAdmin(m.Member) { b.warn(m.ChannelID, "⛔ Not Allowed", "Only admins can stop streams."); return }
+    if len(args) < 1 || strings.TrimSpace(args[0]) == "" { b.info(m.ChannelID, "Usage", "`!kill <streamid>`"); return }
+    streamID := strings.TrimSpace(args[0])
+    ok, resp, err := b.makeAPIRequest("POST", "/admin/streams/"+url.PathEscape(streamID)+"/stop", map[string]string{"actor": "discord:" + m.Author.Username})
+    if err != nil || !ok { b.fail(m.ChannelID, "❌ Stop Failed", fmt.Sprintf("We couldn't stop stream `%s`.\n\nError: `%v`", streamID, err)); return }
+    data, _ := resp.(map[string]interface{})
+    b.success(m.ChannelID, "🛑 Stream Stopped", fmt.Sprintf("Stopped stream `%s` and disconnected **%d** viewers.", streamID, getInt64(data, "viewers_disconnected")))
+}
+
+// handleValidate dry-runs the provider playlist, or the M3U at the given URL,
+// and reports what serving it would do (admin only). Nothing is cached.
+func (b *Bot) handleValidate(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+    if !b.isAdmin(m.Member) { b.warn(m.ChannelID, "⛔ Not Allowed", "Only admins can validate playlists."); return }
+    payload := map[string]string{"actor": "discord:" + m.Author.Username}
+    if len(args) > 0 && strings.TrimSpace(args[0]) != "" { payload["url"] = strings.TrimSpace(args[0]) }
+    // A full provider playlist can take a while to download
+    ok, resp, err := b.makeSlowAPIRequest("POST", "/admin/validate", payload, 3*time.Minute)
+    if err != nil || !ok { b.fail(m.ChannelID, "❌ Validation Failed", fmt.Sprintf("We couldn't check the playlist.\n\nError: `%v`", err)); return }
+    data, _ := resp.(map[string]interface{})
+    byType, _ := data["by_type"].(map[string]interface{})
+
+    desc := fmt.Sprintf("**%d** tracks in **%d** groups: %d live, %d movies, %d series.",
+        getInt64(data, "tracks"), getInt64(data, "groups"), getInt64(byType, "live"), getInt64(byType, "movie"), getInt64(byType, "series"))
+    if n := getInt64(data, "blocked"); n > 0 { desc += fmt.Sprintf("\n%d tracks are hidden by the blocklist.", n) }
+
+    issueLines := func(key string) string {
+        list, _ := data[key].([]interface{})
+        lines := []string{}
+        for _, it := range list {
+            if len(lines) == 5 { break }
+            issue, _ := it.(map[string]interface{})
+            lines = append(lines, fmt.Sprintf("• %s — %s", trimTo(getString(issue, "name"), 60), getString(issue, "error")))
+        }
+        return strings.Join(lines, "\n")
+    }
+    var fields []*discordgo.MessageEmbedField
+    malformed := getInt64(data, "malformed")
+    if malformed > 0 {
+        fields = append(fields, &discordgo.MessageEmbedField{Name: fmt.Sprintf("Malformed URIs (%d, would be dropped)", malformed), Value: issueLines("malformed_tracks")})
+    }
+    unresolvable := getInt64(data, "vod_unresolvable")
+    vod := fmt.Sprintf("%d with a playable extension, %d without", getInt64(data, "vod_resolvable"), unresolvable)
+    if unresolvable > 0 { vod += "\n" + issueLines("vod_issues") }
+    fields = append(fields, &discordgo.MessageEmbedField{Name: "Movies & series", Value: vod})
+    if empty, _ := data["empty_categories"].([]interface{}); len(empty) > 0 {
+        names := []string{}
+        for _, e := range empty {
+            if len(names) == 10 { names = append(names, fmt.Sprintf("… and %d more", len(empty)-10)); break }
+            names = append(names, fmt.Sprintf("%v", e))
+        }
+        fields = append(fields, &discordgo.MessageEmbedField{Name: fmt.Sprintf("Empty categories (%d)", len(empty)), Value: strings.Join(names, "\n")})
+    }
+    if warnings, _ := data["warnings"].([]interface{}); len(warnings) > 0 {
+        fields = append(fields, &discordgo.MessageEmbedField{Name: "Warnings", Value: trimTo(fmt.Sprintf("%v", warnings), 1000)})
+    }
+
+    if malformed > 0 || unresolvable > 0 {
+        b.warn(m.ChannelID, "⚠️ Playlist Has Issues", desc, fields...)
+        return
+    }
+    b.success(m.ChannelID, "✅ Playlist Looks Good", desc, fields...)
+}
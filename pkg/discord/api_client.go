@@ -20,13 +20,22 @@ package discord
 
 import (
     "bytes"
+    "compress/gzip"
     "encoding/json"
     "fmt"
+    "io"
     "net/http"
+    "time"
 )
 
 // makeAPIRequest centralizes internal API calls with auth headers and JSON handling.
 func (b *Bot) makeAPIRequest(method, endpoint string, body interface{}) (bool, interface{}, error) {
+    return b.makeSlowAPIRequest(method, endpoint, body, 0)
+}
+
+// makeSlowAPIRequest is makeAPIRequest for calls that may outlast the bot
+// client's timeout, such as a playlist validation; 0 keeps that timeout.
+func (b *Bot) makeSlowAPIRequest(method, endpoint string, body interface{}, timeout time.Duration) (bool, interface{}, error) {
     url := b.apiURL + "/api/internal" + endpoint
 
     var reqBody []byte
@@ -45,14 +54,32 @@ func (b *Bot) makeAPIRequest(method, endpoint string, body interface{}) (bool, i
     req.Header.Set("Content-Type", "application/json")
     req.Header.Set("X-API-Key", b.apiKey)
 
-    resp, err := b.client.Do(req)
+    client := b.client
+    if timeout > 0 {
+        c := *b.client
+        c.Timeout = timeout
+        client = &c
+    }
+    resp, err := client.Do(req)
     if err != nil {
         return false, nil, err
     }
     defer resp.Body.Close()
 
+    // The transport decompresses gzip it asked for itself; this covers a
+    // response that still arrives encoded (e.g. a custom transport)
+    var reader io.Reader = resp.Body
+    if !resp.Uncompressed && resp.Header.Get("Content-Encoding") == "gzip" {
+        gz, err := gzip.NewReader(resp.Body)
+        if err != nil {
+            return false, nil, err
+        }
+        defer gz.Close()
+        reader = gz
+    }
+
     var apiResp map[string]interface{}
-    if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+    if err := json.NewDecoder(reader).Decode(&apiResp); err != nil {
         return false, nil, err
     }
     if ok, _ := apiResp["success"].(bool); !ok {
@@ -117,11 +117,17 @@ func NewBot(token, adminRoleID, apiURL, apiKey string) (*Bot, error) {
 		cleanupInterval: 30 * time.Minute,
 		client:          &http.Client{Timeout: 10 * time.Second},
 		pendingVODSelect: make(map[string]*vodSelectContext),
+		pendingSeries:    make(map[string]*seriesBrowseContext),
+		cacheOrigins:     make(map[string]string),
 	}
 
 	// Optional: dev guild for registering guild-scoped commands during development
 	bot.devGuildID = os.Getenv("DISCORD_DEV_GUILD_ID")
 
+	if readyNotifyEnabled() {
+		bot.readyNotes = newReadyBatcher(readyBatchWindow(), bot.sendReadySummary)
+	}
+
 	// Register handlers
 	// Legacy messageCreate kept for now but can be removed once slash migration is complete.
 	// Commented out to prioritize slash commands migration.
@@ -197,6 +203,11 @@ func (b *Bot) cleanupExpiredVODSelects() {
 			delete(b.pendingVODSelect, msgID)
 		}
 	}
+	for msgID, ctx := range b.pendingSeries {
+		if ctx.Created.Before(cutoff) {
+			delete(b.pendingSeries, msgID)
+		}
+	}
 }
 
 // Starts VOD download for the given selection and informs the user
@@ -220,12 +231,15 @@ func (b *Bot) startVODDownloadFromSelection(s *discordgo.Session, channelID, use
 	}
 
 	// Send download request to API
-	downloadData := map[string]string{
+	downloadData := map[string]interface{}{
 		"username":  ldapUser,
 		"stream_id": selectedVOD.StreamID,
 		"title":     selectedVOD.Title,
 		"type":      selectedVOD.StreamType,
 	}
+	if len(selectedVOD.Parts) > 1 {
+		downloadData["parts"] = partStreamIDs(selectedVOD.Parts)
+	}
 	success, respData, err = b.makeAPIRequest("POST", "/vod/download", downloadData)
 	if err != nil || !success {
 		errMsg := "Failed to create download"
@@ -299,6 +313,23 @@ func (b *Bot) startVODDownloadFromSelection(s *discordgo.Session, channelID, use
 			discordgo.Button{Style: discordgo.LinkButton, Label: "Open Download", URL: downloadURL},
 		}},
 	}
+	// Multi-part movies: one button per part, five per row
+	if urls, ok := data["download_urls"].([]interface{}); ok && len(urls) > 1 {
+		components = components[:0]
+		var row []discordgo.MessageComponent
+		for n, u := range urls {
+			link, _ := u.(string)
+			if link == "" || n >= 25 { continue }
+			row = append(row, discordgo.Button{Style: discordgo.LinkButton, Label: fmt.Sprintf("Part %d", n+1), URL: link})
+			if len(row) == 5 {
+				components = append(components, discordgo.ActionsRow{Components: row})
+				row = nil
+			}
+		}
+		if len(row) > 0 {
+			components = append(components, discordgo.ActionsRow{Components: row})
+		}
+	}
 
 	if _, err := s.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{embed}, Components: components}); err != nil {
 		utils.ErrorLog("Discord: failed to send download embed: %v", err)
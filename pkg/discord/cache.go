@@ -20,6 +20,7 @@ package discord
 
 import (
     "fmt"
+    "net/url"
     "sort"
     "strconv"
     "strings"
@@ -99,9 +100,9 @@ func (b *Bot) handleCache(s *discordgo.Session, m *discordgo.MessageCreate, args
     // Single dropdown of 25 per page; enrich first page like /vod
     total := len(results)
     perPage := 25
-    b.enrichFirstPage(query, results, perPage)
+    b.enrichFirstPage(m.Author.ID, query, results, perPage)
     withButtons := total > perPage
-    ctx := &vodSelectContext{UserID: m.Author.ID, Channel: m.ChannelID, Query: fmt.Sprintf("cache:%s (for %dd)", query, days), Results: results, Page: 0, PerPage: perPage, Created: time.Now()}
+    ctx := &vodSelectContext{UserID: m.Author.ID, Channel: m.ChannelID, Query: fmt.Sprintf("cache:%s (for %dd)", query, days), Token: getString(dmap, "request_token"), Results: results, Page: 0, PerPage: perPage, Created: time.Now(), OriginID: m.ID}
     pages := (total+perPage-1)/perPage; if pages==0{pages=1}
     utils.DebugLog("Discord: Cache rendering %d results perPage=%d pages=%d", total, perPage, pages)
     start := 0; end := perPage; if end>total{end=total}
@@ -125,7 +126,7 @@ func (b *Bot) handleCache(s *discordgo.Session, m *discordgo.MessageCreate, args
 }
 
 // In handleInteractionCreate -> case "vod_select" continues to start a download. For caching, detect context.Query prefix and call cache API instead
-func (b *Bot) startVODCacheFromSelection(s *discordgo.Session, channelID, userID string, selected types.VODResult, days int) {
+func (b *Bot) startVODCacheFromSelection(s *discordgo.Session, channelID, userID string, selected types.VODResult, days int, originID string) {
     // Resolve LDAP
     ok, resp, err := b.makeAPIRequest("GET", "/discord/"+userID+"/ldap", nil)
     if err != nil || !ok { b.fail(channelID, "❌ Cache Failed", "Couldn't resolve your account."); return }
@@ -142,6 +143,11 @@ func (b *Bot) startVODCacheFromSelection(s *discordgo.Session, channelID, userID
         "season": selected.Season,
         "episode": selected.Episode,
         "days": days,
+        "origin_command": "/cache",
+        "origin_message_id": originID,
+    }
+    if len(selected.Parts) > 1 {
+        payload["parts"] = partStreamIDs(selected.Parts)
     }
     ok, resp, err = b.makeAPIRequest("POST", "/cache/start", payload)
     if err != nil || !ok { b.fail(channelID, "❌ Cache Failed", fmt.Sprintf("Couldn't start caching: %v", err)); return }
@@ -154,11 +160,26 @@ func (b *Bot) startVODCacheFromSelection(s *discordgo.Session, channelID, userID
     embed := &discordgo.MessageEmbed{Title: "💾 Caching", Description: fmt.Sprintf("%s\nExpires: %s\n\n%s", title, exp, renderBar(0, 0)), Color: colorInfo, Timestamp: time.Now().UTC().Format(time.RFC3339)}
     msg, _ := b.session.ChannelMessageSendEmbed(channelID, embed)
     if sid == "" { return }
+    b.readyNotes.queued(channelID, userID, selected)
+    // Multi-part movies are cached in order; follow each part in turn
+    sids := []string{sid}
+    if parts, ok := d["parts"].([]interface{}); ok && len(parts) > 1 {
+        sids = sids[:0]
+        for _, p := range parts {
+            if id, ok := p.(string); ok && id != "" { sids = append(sids, id) }
+        }
+    }
+    for _, id := range sids { b.rememberCacheOrigin(id, channelID) }
+    cur := 0
+    partLabel := func() string {
+        if len(sids) < 2 { return "" }
+        return fmt.Sprintf("\nPart %d/%d", cur+1, len(sids))
+    }
     // Poll progress for up to 12 hours or until ready/failed
     deadline := time.Now().Add(12*time.Hour)
     for time.Now().Before(deadline) {
         time.Sleep(2*time.Second)
-        ok, resp, err := b.makeAPIRequest("GET", "/cache/progress/"+sid, nil)
+        ok, resp, err := b.makeAPIRequest("GET", "/cache/progress/"+sids[cur], nil)
         if err != nil || !ok { continue }
         dm, _ := resp.(map[string]interface{})
         status := strings.ToLower(getString(dm, "status"))
@@ -166,17 +187,125 @@ func (b *Bot) startVODCacheFromSelection(s *discordgo.Session, channelID, userID
         total := getInt64(dm, "total_bytes")
         percent := int(getInt64(dm, "percent"))
         bar := renderBar(downloaded, total)
+        if (status == "ready" || percent >= 100) && cur < len(sids)-1 {
+            cur++
+            continue
+        }
         if status == "ready" || percent >= 100 {
             emb := &discordgo.MessageEmbed{Title: "✅ Cache Ready", Description: fmt.Sprintf("%s\nExpires: %s\n\n%s", title, exp, renderBar(total, total)), Color: colorSuccess, Timestamp: time.Now().UTC().Format(time.RFC3339)}
             _, _ = b.session.ChannelMessageEditEmbed(channelID, msg.ID, emb)
+            b.readyNotes.finished(channelID, userID, title, selected, true)
             break
         }
         if status == "failed" {
-            emb := &discordgo.MessageEmbed{Title: "❌ Cache Failed", Description: fmt.Sprintf("%s\nPlease retry later.", title), Color: colorError, Timestamp: time.Now().UTC().Format(time.RFC3339)}
+            hint := "Please retry later."
+            if reason := getString(dm, "failure_reason"); reason != "" { hint = "Reason: " + reason }
+            emb := &discordgo.MessageEmbed{Title: "❌ Cache Failed", Description: fmt.Sprintf("%s%s\n%s", title, partLabel(), hint), Color: colorError, Timestamp: time.Now().UTC().Format(time.RFC3339)}
             _, _ = b.session.ChannelMessageEditEmbed(channelID, msg.ID, emb)
+            b.readyNotes.finished(channelID, userID, title, selected, false)
             break
         }
-        emb := &discordgo.MessageEmbed{Title: "💾 Caching", Description: fmt.Sprintf("%s\nExpires: %s\n\n%s (%d%%)", title, exp, bar, percent), Color: colorInfo, Timestamp: time.Now().UTC().Format(time.RFC3339)}
+        if status == "queued" {
+            emb := &discordgo.MessageEmbed{Title: "⏳ Queued", Description: fmt.Sprintf("%s%s\nExpires: %s\n\nWaiting for other downloads to finish.", title, partLabel(), exp), Color: colorInfo, Timestamp: time.Now().UTC().Format(time.RFC3339)}
+            _, _ = b.session.ChannelMessageEditEmbed(channelID, msg.ID, emb)
+            continue
+        }
+        emb := &discordgo.MessageEmbed{Title: "💾 Caching", Description: fmt.Sprintf("%s%s\nExpires: %s\n\n%s (%d%%)%s", title, partLabel(), exp, bar, percent, renderRate(dm)), Color: colorInfo, Timestamp: time.Now().UTC().Format(time.RFC3339)}
         _, _ = b.session.ChannelMessageEditEmbed(channelID, msg.ID, emb)
     }
-}
\ No newline at end of file
+}
+
+// partStreamIDs returns the stream ids of a multi-part result in order
+func partStreamIDs(parts []types.VODPart) []string {
+    ids := make([]string, 0, len(parts))
+    for _, p := range parts { ids = append(ids, p.StreamID) }
+    return ids
+}
+
+// handleRecord records a live channel to the cache for N minutes.
+// Usage: !record <channel> <minutes> — channel is a stream id or a channel name.
+func (b *Bot) handleRecord(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+    if len(args) < 2 { b.info(m.ChannelID, "⏺️ Record Channel", "Usage: `!record <channel> <minutes>`"); return }
+    minutes, err := strconv.Atoi(args[len(args)-1])
+    if err != nil || minutes <= 0 { b.warn(m.ChannelID, "⏺️ Invalid Duration", "Minutes must be a positive number."); return }
+    channel := strings.Join(args[:len(args)-1], " ")
+
+    ok, resp, err := b.makeAPIRequest("GET", "/discord/"+m.Author.ID+"/ldap", nil)
+    data, _ := resp.(map[string]interface{})
+    ldapUser := getString(data, "ldap_user")
+    if err != nil || !ok || ldapUser == "" { b.warn(m.ChannelID, "🔗 Linking Required", "Link your account with `!link <ldap_username>`."); return }
+
+    ok, resp, err = b.makeAPIRequest("POST", "/recordings/start", map[string]interface{}{"channel": channel, "minutes": minutes, "username": ldapUser, "origin_command": "/record", "origin_message_id": m.ID})
+    if err != nil || !ok { b.fail(m.ChannelID, "❌ Recording Failed", fmt.Sprintf("We couldn't start the recording.\n\nError: `%v`", err)); return }
+    data, _ = resp.(map[string]interface{})
+    b.success(m.ChannelID, "⏺️ Recording Started", fmt.Sprintf("Recording **%s** for **%d** minutes.\nIt will appear in `!cached` once finished.\nID: `%s`", getString(data, "title"), minutes, getString(data, "id")))
+}
+
+// handleDelete removes a cached item before it expires (admin only).
+// Usage: !delete <title|stream_id> [--force] — --force also deletes items still downloading.
+func (b *Bot) handleDelete(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+    if !b.isAdmin(m.Member) { b.warn(m.ChannelID, "⛔ Not Allowed", "Only admins can delete cached items."); return }
+    force := false
+    words := make([]string, 0, len(args))
+    for _, a := range args {
+        if a == "--force" { force = true; continue }
+        words = append(words, a)
+    }
+    query := strings.TrimSpace(strings.Join(words, " "))
+    if query == "" { b.info(m.ChannelID, "🗑️ Delete Cached Item", "Usage: `!delete <title|stream_id> [--force]`"); return }
+
+    ok, resp, err := b.makeAPIRequest("GET", "/cache/list", nil)
+    if err != nil || !ok { b.fail(m.ChannelID, "❌ Delete Failed", "Couldn't fetch cached items."); return }
+    arr, _ := resp.([]interface{})
+
+    // An exact stream id wins; otherwise every title containing all query words
+    matches := make([]types.VODResult, 0)
+    tokens := strings.Fields(strings.ToLower(query))
+    for _, it := range arr {
+        e, _ := it.(map[string]interface{})
+        sid := getString(e, "stream_id")
+        title := strings.TrimSpace(getString(e, "title"))
+        if st := getString(e, "series_title"); st != "" && getInt64(e, "episode") > 0 {
+            title = fmt.Sprintf("%s S%02dE%02d", st, getInt64(e, "season"), getInt64(e, "episode"))
+        }
+        if title == "" { title = sid }
+        r := types.VODResult{ID: sid, StreamID: sid, Title: title, StreamType: getString(e, "type"), Category: getString(e, "status")}
+        if sz := getInt64(e, "size_bytes"); sz > 0 { r.Size = utils.HumanBytes(sz) }
+        if sid == query { matches = []types.VODResult{r}; break }
+        hay := strings.ToLower(title)
+        all := true
+        for _, t := range tokens { if !strings.Contains(hay, t) { all = false; break } }
+        if all { matches = append(matches, r) }
+    }
+
+    switch len(matches) {
+    case 0:
+        b.info(m.ChannelID, "🔎 No Match", fmt.Sprintf("No cached item matches `%s`.", query))
+    case 1:
+        b.deleteCachedItem(m.ChannelID, m.Author.Username, matches[0], force)
+    default:
+        q := "delete:" + query
+        if force { q = "delete-force:" + query }
+        ctx := &vodSelectContext{UserID: m.Author.ID, Channel: m.ChannelID, Query: q, Results: matches, Page: 0, PerPage: 25, Created: time.Now()}
+        msg, err := b.renderVODInteractiveMessage(s, ctx)
+        if err != nil { b.fail(m.ChannelID, "❌ Delete Failed", "Couldn't show the matching items."); return }
+        b.selectLock.Lock(); b.pendingVODSelect[msg.ID] = ctx; b.selectLock.Unlock()
+    }
+}
+
+// deleteCachedItem asks the server to drop one cache entry and reports the result.
+func (b *Bot) deleteCachedItem(channelID, actor string, item types.VODResult, force bool) {
+    endpoint := "/cache/" + url.PathEscape(item.StreamID) + "?actor=" + url.QueryEscape("discord:"+actor)
+    if force { endpoint += "&force=1" }
+    ok, resp, err := b.makeAPIRequest("DELETE", endpoint, nil)
+    if err != nil || !ok {
+        msg := fmt.Sprintf("Couldn't delete **%s**.\n\nError: `%v`", item.Title, err)
+        if err != nil && strings.Contains(err.Error(), "still downloading") {
+            msg = fmt.Sprintf("**%s** is still downloading. Run the command again with `--force` to delete it anyway.", item.Title)
+        }
+        b.fail(channelID, "❌ Delete Failed", msg)
+        return
+    }
+    d, _ := resp.(map[string]interface{})
+    b.success(channelID, "🗑️ Cached Item Deleted", fmt.Sprintf("**%s** was removed (%s freed).", item.Title, utils.HumanBytes(getInt64(d, "freed_bytes"))))
+}
@@ -21,6 +21,7 @@ package discord
 import (
     "fmt"
     "strings"
+    "time"
 
     "github.com/bwmarrin/discordgo"
 )
@@ -40,3 +41,38 @@ func (b *Bot) handleStatus(s *discordgo.Session, m *discordgo.MessageCreate, _ [
     if text != "" { desc += "\n\n" + text } else if streams == 0 { desc += "\n\nNo active streams." }
     b.info(m.ChannelID, "📊 IPTV Proxy Status", desc)
 }
+
+// handlePing probes the provider. Admins get latency, HTTP status and M3U
+// cache freshness; other members only see whether the provider is up.
+func (b *Bot) handlePing(s *discordgo.Session, m *discordgo.MessageCreate, _ []string) {
+    ok, data, err := b.makeAPIRequest("GET", "/upstream/ping", nil)
+    if err != nil || !ok { b.fail(m.ChannelID, "❌ Ping Failed", fmt.Sprintf("Failed to probe the provider: %v", err)); return }
+    mp, _ := data.(map[string]interface{})
+    up, _ := mp["up"].(bool)
+
+    if !b.isAdmin(m.Member) {
+        if up { b.success(m.ChannelID, "🟢 Provider Up", "The provider is answering normally.") } else { b.fail(m.ChannelID, "🔴 Provider Down", "The provider is not answering right now.") }
+        return
+    }
+
+    probeField := func(name, key string) *discordgo.MessageEmbedField {
+        p, _ := mp[key].(map[string]interface{})
+        value := fmt.Sprintf("HTTP %d in **%d ms**", getInt64(p, "status"), getInt64(p, "latency_ms"))
+        if e := getString(p, "error"); e != "" { value = fmt.Sprintf("Error after %d ms: `%s`", getInt64(p, "latency_ms"), e) }
+        return &discordgo.MessageEmbedField{Name: name, Value: value, Inline: true}
+    }
+    cacheValue := "Not cached yet"
+    if c, _ := mp["m3u_cache"].(map[string]interface{}); c != nil {
+        if cached, _ := c["cached"].(bool); cached {
+            state := "stale"
+            if fresh, _ := c["fresh"].(bool); fresh { state = "fresh" }
+            cacheValue = fmt.Sprintf("%s (%s old)", state, (time.Duration(getInt64(c, "age_seconds")) * time.Second).String())
+        }
+    }
+    fields := []*discordgo.MessageEmbedField{
+        probeField("player_api.php", "player_api"),
+        probeField("get.php", "get_php"),
+        {Name: "M3U cache", Value: fmt.Sprintf("%s, expires after %d h", cacheValue, getInt64(mp, "m3u_cache_hours"))},
+    }
+    if up { b.success(m.ChannelID, "🟢 Provider Up", "", fields...) } else { b.fail(m.ChannelID, "🔴 Provider Down", "", fields...) }
+}
@@ -23,6 +23,7 @@ import (
     "regexp"
     "strconv"
     "strings"
+    "time"
 
     "github.com/bwmarrin/discordgo"
     "github.com/lucasduport/stream-share/pkg/types"
@@ -64,6 +65,16 @@ func (b *Bot) interactionUserID(i *discordgo.InteractionCreate) string {
     return ""
 }
 
+// isAdmin reports whether the member holds the configured admin role.
+// When no admin role is configured, every member is treated as an admin.
+func (b *Bot) isAdmin(member *discordgo.Member) bool {
+    if b.adminRoleID == "" { return true }
+    if member == nil { return false }
+    for _, r := range member.Roles {
+        if r == b.adminRoleID { return true }
+    }
+    return false
+}
 
 func getInt64(m map[string]interface{}, k string) int64 {
     if v, ok := m[k]; ok {
@@ -102,6 +113,18 @@ func renderBar(done, total int64) string {
     return fmt.Sprintf("`[%s]` %d%% — %s", bar, pct, size)
 }
 
+// renderRate returns the download speed and ETA reported by /cache/progress,
+// or "" when the server sent none
+func renderRate(m map[string]interface{}) string {
+    rate := getInt64(m, "rate_bytes_per_sec")
+    if rate <= 0 { return "" }
+    out := fmt.Sprintf("\n%s/s", utils.HumanBytes(rate))
+    if _, ok := m["eta_seconds"]; ok {
+        out += fmt.Sprintf(" — ETA %s", (time.Duration(getInt64(m, "eta_seconds")) * time.Second).String())
+    }
+    return out
+}
+
 // parseQueryFilters splits the query on spaces and extracts optional SxxEyy tokens.
 // Returns lowercase tokens (space-split) and season/episode if present (0 if not).
 func parseQueryFilters(q string) (tokens []string, season, episode int) {
@@ -0,0 +1,82 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package discord
+
+import (
+    "fmt"
+    "net/url"
+    "strings"
+    "time"
+
+    "github.com/bwmarrin/discordgo"
+)
+
+// handleHistory lists recently watched titles with start/end times.
+// Usage: !history [username] — other users' history is admin only.
+func (b *Bot) handleHistory(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+    username := ""
+    if len(args) > 0 { username = strings.TrimSpace(args[0]) }
+    if username != "" && !b.isAdmin(m.Member) {
+        b.warn(m.ChannelID, "⛔ Not Allowed", "Only admins can view another user's history.")
+        return
+    }
+    if username == "" {
+        ok, resp, err := b.makeAPIRequest("GET", "/discord/"+m.Author.ID+"/ldap", nil)
+        data, _ := resp.(map[string]interface{})
+        username = getString(data, "ldap_user")
+        if err != nil || !ok || username == "" { b.warn(m.ChannelID, "🔗 Linking Required", "Link your account with `!link <ldap_username>`."); return }
+    }
+
+    ok, resp, err := b.makeAPIRequest("GET", "/history/"+url.PathEscape(username)+"?limit=30", nil)
+    if err != nil || !ok { b.fail(m.ChannelID, "❌ History Failed", fmt.Sprintf("Couldn't fetch watch history.\n\nError: `%v`", err)); return }
+    arr, _ := resp.([]interface{})
+    if len(arr) == 0 { b.info(m.ChannelID, "🕘 Watch History", fmt.Sprintf("No history for **%s** yet.", username)); return }
+
+    const per = 10
+    pages := (len(arr)+per-1)/per
+    for p := 0; p < pages; p++ {
+        start := p*per
+        end := start+per
+        if end > len(arr) { end = len(arr) }
+        lines := make([]string, 0, end-start)
+        for _, it := range arr[start:end] {
+            mapp, _ := it.(map[string]interface{})
+            title := strings.TrimSpace(getString(mapp, "stream_title"))
+            if title == "" { title = getString(mapp, "stream_type") + " " + getString(mapp, "stream_id") }
+            line := fmt.Sprintf("• %s — %s", title, historyTime(getString(mapp, "start_time")))
+            if endAt := getString(mapp, "end_time"); endAt != "" {
+                dur := time.Duration(getInt64(mapp, "duration_seconds")) * time.Second
+                line += fmt.Sprintf(" → %s (%s)", historyTime(endAt), dur.Round(time.Minute))
+            } else {
+                line += " → watching"
+            }
+            lines = append(lines, line)
+        }
+        desc := strings.Join(lines, "\n")
+        if pages > 1 { desc += fmt.Sprintf("\n\nPage %d/%d", p+1, pages) }
+        b.info(m.ChannelID, "🕘 Watch History — "+username, desc)
+    }
+}
+
+// historyTime renders an RFC3339 timestamp as a Discord timestamp (reader's timezone).
+func historyTime(v string) string {
+    t, err := time.Parse(time.RFC3339Nano, v)
+    if err != nil { return v }
+    return fmt.Sprintf("<t:%d:f>", t.Unix())
+}
@@ -33,6 +33,8 @@ func (b *Bot) handleInteractionCreate(s *discordgo.Session, i *discordgo.Interac
 
     msgID := i.Message.ID
     customID := i.MessageComponentData().CustomID
+    if strings.HasPrefix(customID, "stopall_") { b.handleStopAllComponent(s, i); return }
+    if strings.HasPrefix(customID, "series_") { b.handleSeriesComponent(s, i); return }
     switch customID {
     case "vod_prev":
         b.selectLock.RLock(); ctx, ok := b.pendingVODSelect[msgID]; b.selectLock.RUnlock(); if !ok { return }
@@ -42,7 +44,7 @@ func (b *Bot) handleInteractionCreate(s *discordgo.Session, i *discordgo.Interac
         _ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseDeferredMessageUpdate})
         // Enrich this page from server if not done yet
         if ctx.EnrichedPages == nil || !ctx.EnrichedPages[ctx.Page] {
-            payload := map[string]interface{}{"query": ctx.Query, "results": ctx.Results, "page": ctx.Page, "per_page": ctx.PerPage}
+            payload := map[string]interface{}{"query": ctx.Query, "results": ctx.Results, "page": ctx.Page, "per_page": ctx.PerPage, "discord_id": ctx.UserID}
             if ok2, resp2, err2 := b.makeAPIRequest("POST", "/vod/enrich", payload); err2 == nil && ok2 {
                 if mp2, _ := resp2.(map[string]interface{}); mp2 != nil {
                     if arr2, _ := mp2["results"].([]interface{}); len(arr2) == len(ctx.Results) {
@@ -59,7 +61,7 @@ func (b *Bot) handleInteractionCreate(s *discordgo.Session, i *discordgo.Interac
         ctx.Page++
         _ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseDeferredMessageUpdate})
         if ctx.EnrichedPages == nil || !ctx.EnrichedPages[ctx.Page] {
-            payload := map[string]interface{}{"query": ctx.Query, "results": ctx.Results, "page": ctx.Page, "per_page": ctx.PerPage}
+            payload := map[string]interface{}{"query": ctx.Query, "results": ctx.Results, "page": ctx.Page, "per_page": ctx.PerPage, "discord_id": ctx.UserID}
             if ok2, resp2, err2 := b.makeAPIRequest("POST", "/vod/enrich", payload); err2 == nil && ok2 {
                 if mp2, _ := resp2.(map[string]interface{}); mp2 != nil {
                     if arr2, _ := mp2["results"].([]interface{}); len(arr2) == len(ctx.Results) {
@@ -78,7 +80,17 @@ func (b *Bot) handleInteractionCreate(s *discordgo.Session, i *discordgo.Interac
         data := i.MessageComponentData(); if len(data.Values) == 0 { return }
         idx, err := strconv.Atoi(data.Values[0]); if err != nil || idx < 0 || idx >= len(ctx.Results) { return }
         selected := ctx.Results[idx]
-        if strings.HasPrefix(ctx.Query, "cache:") {
+        if strings.HasPrefix(ctx.Query, "delete:") || strings.HasPrefix(ctx.Query, "delete-force:") {
+            if !b.isAdmin(i.Member) { return }
+            _ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+                Type: discordgo.InteractionResponseChannelMessageWithSource,
+                Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral, Content: fmt.Sprintf("Deleting: %s", selected.Title)},
+            })
+            b.selectLock.Lock(); delete(b.pendingVODSelect, msgID); b.selectLock.Unlock()
+            actor := b.interactionUserID(i)
+            if i.Member != nil && i.Member.User != nil { actor = i.Member.User.Username }
+            go b.deleteCachedItem(ctx.Channel, actor, selected, strings.HasPrefix(ctx.Query, "delete-force:"))
+        } else if strings.HasPrefix(ctx.Query, "cache:") {
             days := 1
             if p := strings.LastIndex(ctx.Query, "for "); p != -1 {
                 var n int
@@ -90,7 +102,7 @@ func (b *Bot) handleInteractionCreate(s *discordgo.Session, i *discordgo.Interac
                 Type: discordgo.InteractionResponseChannelMessageWithSource,
                 Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral, Content: fmt.Sprintf("Caching: %s (days=%d)", selected.Title, days)},
             })
-            go b.startVODCacheFromSelection(s, ctx.Channel, ctx.UserID, selected, days)
+            go b.startVODCacheFromSelection(s, ctx.Channel, ctx.UserID, selected, days, ctx.OriginID)
         } else {
             // Ack interaction ephemerally to avoid timeout/failure state
             _ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
@@ -47,3 +47,16 @@ func (b *Bot) handleLink(s *discordgo.Session, m *discordgo.MessageCreate, args
     }
     b.success(m.ChannelID, "✅ Linked Successfully", fmt.Sprintf("Your Discord account is now linked to `%s`.\n\nYou're all set to use other commands.", confirmed))
 }
+
+// handleUnlink removes the link between a Discord user and their LDAP username.
+func (b *Bot) handleUnlink(s *discordgo.Session, m *discordgo.MessageCreate, _ []string) {
+    ok, resp, err := b.makeAPIRequest("DELETE", "/discord/"+m.Author.ID+"/link", nil)
+    if err != nil || !ok { b.fail(m.ChannelID, "❌ Unlink Failed", fmt.Sprintf("We couldn't unlink your account right now.\n\nError: `%v`", err)); return }
+
+    data, _ := resp.(map[string]interface{})
+    if unlinked, _ := data["unlinked"].(bool); !unlinked {
+        b.info(m.ChannelID, "🔗 Not Linked", "Your Discord account isn't linked to any IPTV account.\n\nUse `!link <ldap_username>` to link one.")
+        return
+    }
+    b.success(m.ChannelID, "✅ Unlinked", fmt.Sprintf("Your Discord account is no longer linked to `%s`.", getString(data, "ldap_user")))
+}
@@ -0,0 +1,201 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package discord
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+const (
+	// queueRefresh spaces the edits of a /queue message, well within the
+	// Discord edit rate limit
+	queueRefresh = 5 * time.Second
+	// queueMaxWatch stops following the queue after this long
+	queueMaxWatch = 6 * time.Hour
+	// maxQueueLines caps the downloads listed in one embed
+	maxQueueLines = 15
+)
+
+// handleQueue shows the downloads in progress with their percent, speed, ETA
+// and requester, and edits the message in place until all of them finished.
+// Usage: !queue
+func (b *Bot) handleQueue(s *discordgo.Session, m *discordgo.MessageCreate, _ []string) {
+	active, err := b.fetchQueue()
+	if err != nil {
+		b.fail(m.ChannelID, "❌ Queue Failed", "Couldn't fetch the downloads in progress.")
+		return
+	}
+	if len(active) == 0 {
+		b.info(m.ChannelID, "📥 Download Queue", "No downloads in progress.")
+		return
+	}
+	embed := renderQueue(active, nil)
+	msg, err := s.ChannelMessageSendEmbed(m.ChannelID, embed)
+	if err != nil {
+		utils.WarnLog("Discord: failed to send queue: %v", err)
+		return
+	}
+	go b.followQueue(m.ChannelID, msg.ID, active, embed.Description)
+}
+
+// followQueue refreshes a queue message every queueRefresh. Downloads that
+// leave the queue are listed with their final status; once none is left the
+// message is finalized.
+func (b *Bot) followQueue(channelID, msgID string, active []map[string]interface{}, last string) {
+	titles := make(map[string]string)
+	for _, e := range active {
+		titles[getString(e, "stream_id")] = cacheEntryTitle(e)
+	}
+	var finished []string
+	deadline := time.Now().Add(queueMaxWatch)
+	for time.Now().Before(deadline) {
+		time.Sleep(queueRefresh)
+		cur, err := b.fetchQueue()
+		if err != nil {
+			continue
+		}
+		still := make(map[string]bool, len(cur))
+		for _, e := range cur {
+			sid := getString(e, "stream_id")
+			still[sid] = true
+			titles[sid] = cacheEntryTitle(e)
+		}
+		for sid, title := range titles {
+			if !still[sid] {
+				finished = append(finished, b.queueOutcome(sid, title))
+				delete(titles, sid)
+			}
+		}
+		embed := renderQueue(cur, finished)
+		if len(cur) == 0 {
+			embed.Title, embed.Color = "✅ Download Queue Done", colorSuccess
+		}
+		if embed.Description != last || len(cur) == 0 {
+			if _, err := b.session.ChannelMessageEditEmbed(channelID, msgID, embed); err != nil {
+				utils.DebugLog("Discord: queue edit failed: %v", err)
+			}
+			last = embed.Description
+		}
+		if len(cur) == 0 {
+			return
+		}
+	}
+}
+
+// fetchQueue returns the cache entries still downloading.
+func (b *Bot) fetchQueue() ([]map[string]interface{}, error) {
+	ok, resp, err := b.makeAPIRequest("GET", "/cache/list?status=downloading", nil)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("cache list request failed")
+	}
+	arr, _ := resp.([]interface{})
+	out := make([]map[string]interface{}, 0, len(arr))
+	for _, it := range arr {
+		if e, ok := it.(map[string]interface{}); ok {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+// queueOutcome describes how a download that left the queue ended.
+func (b *Bot) queueOutcome(streamID, title string) string {
+	ok, resp, err := b.makeAPIRequest("GET", "/cache/progress/"+url.PathEscape(streamID), nil)
+	d, _ := resp.(map[string]interface{})
+	switch {
+	case err != nil || !ok:
+		return fmt.Sprintf("• %s — removed", title)
+	case strings.EqualFold(getString(d, "status"), "ready"):
+		return fmt.Sprintf("• ✅ %s — ready", title)
+	case strings.EqualFold(getString(d, "status"), "failed"):
+		if reason := getString(d, "failure_reason"); reason != "" {
+			return fmt.Sprintf("• ❌ %s — failed: %s", title, trimTo(reason, 80))
+		}
+		return fmt.Sprintf("• ❌ %s — failed", title)
+	}
+	return fmt.Sprintf("• %s — %s", title, getString(d, "status"))
+}
+
+// renderQueue builds the queue embed from the downloading entries and the
+// lines of the downloads that finished while it was shown.
+func renderQueue(active []map[string]interface{}, finished []string) *discordgo.MessageEmbed {
+	lines := make([]string, 0, len(active)+2)
+	for i, e := range active {
+		if i == maxQueueLines {
+			lines = append(lines, fmt.Sprintf("…and %d more", len(active)-maxQueueLines))
+			break
+		}
+		lines = append(lines, queueLine(e))
+	}
+	desc := strings.Join(lines, "\n")
+	if len(active) == 0 {
+		desc = "No downloads in progress."
+	}
+	if len(finished) > 0 {
+		shown := finished
+		if len(shown) > maxQueueLines {
+			shown = shown[len(shown)-maxQueueLines:]
+		}
+		desc += "\n\n**Finished**\n" + strings.Join(shown, "\n")
+	}
+	return &discordgo.MessageEmbed{
+		Title:       "📥 Download Queue",
+		Description: trimTo(desc, 4000),
+		Color:       colorInfo,
+		Footer:      &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("%d downloading", len(active))},
+		Timestamp:   time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+// queueLine renders one download: title, percent, size, speed, ETA and requester.
+func queueLine(e map[string]interface{}) string {
+	done, total := getInt64(e, "downloaded_bytes"), getInt64(e, "total_bytes")
+	line := "• **" + cacheEntryTitle(e) + "** — "
+	switch {
+	case total > 0:
+		pct := done * 100 / total
+		if pct > 100 {
+			pct = 100
+		}
+		line += fmt.Sprintf("%d%% (%s/%s)", pct, utils.HumanBytes(done), utils.HumanBytes(total))
+	case done > 0:
+		line += utils.HumanBytes(done)
+	default:
+		line += "starting…"
+	}
+	if rate := getInt64(e, "rate_bytes_per_sec"); rate > 0 {
+		line += fmt.Sprintf(" — %s/s", utils.HumanBytes(rate))
+		if _, ok := e["eta_seconds"]; ok {
+			line += ", ETA " + (time.Duration(getInt64(e, "eta_seconds")) * time.Second).String()
+		}
+	}
+	if by := strings.TrimSpace(getString(e, "requested_by")); by != "" {
+		line += " — by " + by
+	}
+	return line
+}
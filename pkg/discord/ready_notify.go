@@ -0,0 +1,291 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package discord
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/lucasduport/stream-share/pkg/types"
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// maxReadyLines caps the lines of one summary, well below the embed limit
+const maxReadyLines = 25
+
+// readyNotifyEnabled reports whether finished caches ping their requester
+// (CACHE_READY_NOTIFY, default true).
+func readyNotifyEnabled() bool {
+	v := strings.TrimSpace(os.Getenv("CACHE_READY_NOTIFY"))
+	if v == "" {
+		return true
+	}
+	on, err := strconv.ParseBool(v)
+	if err != nil {
+		utils.WarnLog("Invalid CACHE_READY_NOTIFY %q, using true", v)
+		return true
+	}
+	return on
+}
+
+// readyBatchWindow is how long completions are collected before one summary
+// is posted (CACHE_READY_BATCH_WINDOW, default 30s). 0 posts each one at once.
+func readyBatchWindow() time.Duration {
+	v := strings.TrimSpace(os.Getenv("CACHE_READY_BATCH_WINDOW"))
+	if v == "" {
+		return 30 * time.Second
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		if n, aerr := strconv.Atoi(v); aerr == nil {
+			d, err = time.Duration(n)*time.Second, nil
+		}
+	}
+	if err != nil || d < 0 {
+		utils.WarnLog("Invalid CACHE_READY_BATCH_WINDOW %q, using 30s", v)
+		return 30 * time.Second
+	}
+	return d
+}
+
+// readyKey groups notifications of one user in one channel
+type readyKey struct {
+	channelID string
+	userID    string
+}
+
+// readySeason identifies one season of a show requested by one user
+type readySeason struct {
+	readyKey
+	series string
+	season int
+}
+
+// readyItem is one finished cache waiting to be announced
+type readyItem struct {
+	title  string
+	series string
+	season int
+	ok     bool
+}
+
+// readyBatcher coalesces cache completions into one message per user and
+// channel, summarizing episodes of the same season on a single line.
+type readyBatcher struct {
+	window time.Duration
+	send   func(channelID, userID string, lines []string)
+
+	mu      sync.Mutex
+	pending map[readyKey][]readyItem
+	started map[readySeason]int // episodes queued and not announced yet
+}
+
+func newReadyBatcher(window time.Duration, send func(channelID, userID string, lines []string)) *readyBatcher {
+	return &readyBatcher{
+		window:  window,
+		send:    send,
+		pending: make(map[readyKey][]readyItem),
+		started: make(map[readySeason]int),
+	}
+}
+
+// queued counts an episode whose caching just started, so the summary can
+// tell how much of the season is done.
+func (rb *readyBatcher) queued(channelID, userID string, r types.VODResult) {
+	if rb == nil || r.SeriesTitle == "" || r.Season <= 0 {
+		return
+	}
+	rb.mu.Lock()
+	rb.started[readySeason{readyKey{channelID, userID}, r.SeriesTitle, r.Season}]++
+	rb.mu.Unlock()
+}
+
+// finished records the outcome of a cache. Failures are not announced here
+// but still count against the season total.
+func (rb *readyBatcher) finished(channelID, userID, title string, r types.VODResult, ok bool) {
+	if rb == nil {
+		return
+	}
+	key := readyKey{channelID, userID}
+	item := readyItem{title: title, ok: ok}
+	if r.SeriesTitle != "" && r.Season > 0 {
+		item.series, item.season = r.SeriesTitle, r.Season
+	}
+	rb.mu.Lock()
+	first := len(rb.pending[key]) == 0
+	rb.pending[key] = append(rb.pending[key], item)
+	rb.mu.Unlock()
+	if rb.window == 0 {
+		rb.flush(key)
+	} else if first {
+		time.AfterFunc(rb.window, func() { rb.flush(key) })
+	}
+}
+
+// flush posts the summary of everything collected for key.
+func (rb *readyBatcher) flush(key readyKey) {
+	rb.mu.Lock()
+	items := rb.pending[key]
+	delete(rb.pending, key)
+
+	type seasonCount struct{ done, failed int }
+	counts := make(map[readySeason]*seasonCount)
+	for _, it := range items {
+		if it.series == "" {
+			continue
+		}
+		s := readySeason{key, it.series, it.season}
+		if counts[s] == nil {
+			counts[s] = &seasonCount{}
+		}
+		if it.ok {
+			counts[s].done++
+		} else {
+			counts[s].failed++
+		}
+	}
+
+	lines := make([]string, 0, len(items))
+	for _, it := range items {
+		if !it.ok {
+			continue
+		}
+		if it.series == "" {
+			lines = append(lines, "**"+it.title+"**")
+			continue
+		}
+		s := readySeason{key, it.series, it.season}
+		c, pending := counts[s]
+		if !pending {
+			continue // season already summarized above
+		}
+		total := max(rb.started[s], c.done+c.failed)
+		if total == 1 {
+			lines = append(lines, "**"+it.title+"**")
+		} else {
+			lines = append(lines, fmt.Sprintf("**%s** — Season %d: %d/%d episodes cached", it.series, it.season, c.done, total))
+		}
+		delete(counts, s)
+		rb.settle(s, total, c.done+c.failed)
+	}
+	// Seasons where every finished episode failed
+	for s, c := range counts {
+		rb.settle(s, rb.started[s], c.done+c.failed)
+	}
+	rb.mu.Unlock()
+
+	if len(lines) == 0 {
+		return
+	}
+	if len(lines) > maxReadyLines {
+		extra := len(lines) - maxReadyLines
+		lines = append(lines[:maxReadyLines], fmt.Sprintf("…and %d more", extra))
+	}
+	rb.send(key.channelID, key.userID, lines)
+}
+
+// settle removes announced episodes from the season count. Callers hold mu.
+func (rb *readyBatcher) settle(s readySeason, total, announced int) {
+	if left := total - announced; left > 0 {
+		rb.started[s] = left
+	} else {
+		delete(rb.started, s)
+	}
+}
+
+// sendReadySummary pings the requester with the caches that became ready.
+func (b *Bot) sendReadySummary(channelID, userID string, lines []string) {
+	title := "✅ Cache Ready"
+	if len(lines) > 1 {
+		title = "✅ Caches Ready"
+	}
+	_, err := b.session.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Content: "<@" + userID + ">",
+		Embeds: []*discordgo.MessageEmbed{{
+			Title:       title,
+			Description: strings.Join(lines, "\n"),
+			Color:       colorSuccess,
+			Timestamp:   time.Now().UTC().Format(time.RFC3339),
+		}},
+		AllowedMentions: &discordgo.MessageAllowedMentions{Users: []string{userID}},
+	})
+	if err != nil {
+		utils.ErrorLog("Discord: failed to send cache ready summary: %v", err)
+	}
+}
+
+// rememberCacheOrigin keeps the channel a cache was started from, where the
+// ready DM falls back to when the requester does not accept DMs.
+func (b *Bot) rememberCacheOrigin(streamID, channelID string) {
+	b.originLock.Lock()
+	b.cacheOrigins[streamID] = channelID
+	b.originLock.Unlock()
+}
+
+// takeCacheOrigin returns and forgets the channel a cache was started from.
+func (b *Bot) takeCacheOrigin(streamID string) string {
+	b.originLock.Lock()
+	defer b.originLock.Unlock()
+	channelID := b.cacheOrigins[streamID]
+	delete(b.cacheOrigins, streamID)
+	return channelID
+}
+
+// NotifyCacheReady DMs the requester that a cached item is ready, with a
+// link to play it and the expiry of link and cache. When the DM cannot be
+// delivered (DMs disabled), the requester is mentioned in the channel the
+// cache was started from instead.
+func (b *Bot) NotifyCacheReady(discordID, streamID, title, playURL string, linkExpires, expires time.Time) error {
+	desc := fmt.Sprintf("**%s** is cached and ready to play.\nLink valid until: %s\nCached until: %s",
+		title, linkExpires.Format("2006-01-02 15:04"), expires.Format("2006-01-02 15:04"))
+	msg := &discordgo.MessageSend{
+		Embeds: []*discordgo.MessageEmbed{{
+			Title:       "✅ Cache Ready",
+			Description: desc,
+			Color:       colorSuccess,
+			Timestamp:   time.Now().UTC().Format(time.RFC3339),
+		}},
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+				discordgo.Button{Style: discordgo.LinkButton, Label: "Play / Download", URL: playURL},
+			}},
+		},
+	}
+	origin := b.takeCacheOrigin(streamID)
+	dm, err := b.session.UserChannelCreate(discordID)
+	if err == nil {
+		if _, err = b.session.ChannelMessageSendComplex(dm.ID, msg); err == nil {
+			return nil
+		}
+	}
+	if origin == "" {
+		return fmt.Errorf("DM to %s failed and no channel to fall back to: %w", discordID, err)
+	}
+	utils.WarnLog("Discord: ready DM to %s failed (%v); mentioning them in channel %s", discordID, err, origin)
+	msg.Content = "<@" + discordID + ">"
+	msg.Embeds[0].Footer = &discordgo.MessageEmbedFooter{Text: "Posted here because your DMs are closed"}
+	msg.AllowedMentions = &discordgo.MessageAllowedMentions{Users: []string{discordID}}
+	_, err = b.session.ChannelMessageSendComplex(origin, msg)
+	return err
+}
@@ -0,0 +1,123 @@
+package discord
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lucasduport/stream-share/pkg/types"
+)
+
+// readyMessage is one summary handed to the batcher's send function
+type readyMessage struct {
+	channelID, userID string
+	lines             []string
+}
+
+// recordReady returns a batcher whose summaries are collected instead of sent.
+func recordReady(window time.Duration) (*readyBatcher, func() []readyMessage) {
+	var mu sync.Mutex
+	var sent []readyMessage
+	rb := newReadyBatcher(window, func(channelID, userID string, lines []string) {
+		mu.Lock()
+		defer mu.Unlock()
+		sent = append(sent, readyMessage{channelID, userID, lines})
+	})
+	return rb, func() []readyMessage {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]readyMessage(nil), sent...)
+	}
+}
+
+func episode(n int) types.VODResult {
+	return types.VODResult{Title: fmt.Sprintf("Dark S02E%02d", n), SeriesTitle: "Dark", Season: 2, Episode: n}
+}
+
+func TestReadyBatcherSummarizesSeason(t *testing.T) {
+	rb, sent := recordReady(50 * time.Millisecond)
+	for n := 1; n <= 3; n++ {
+		rb.queued("chan", "alice", episode(n))
+	}
+	rb.finished("chan", "alice", "Dark S02E01", episode(1), true)
+	rb.finished("chan", "alice", "Dark S02E02", episode(2), false)
+	rb.finished("chan", "alice", "Heat", types.VODResult{Title: "Heat"}, true)
+	rb.finished("chan", "alice", "Dark S02E03", episode(3), true)
+	rb.finished("chan", "bob", "Heat", types.VODResult{Title: "Heat"}, true)
+
+	if got := sent(); len(got) != 0 {
+		t.Fatalf("sent before the window ended: %v", got)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	got := sent()
+	if len(got) != 2 {
+		t.Fatalf("sent %d messages, want one per user: %v", len(got), got)
+	}
+	byUser := map[string]readyMessage{}
+	for _, m := range got {
+		if m.channelID != "chan" {
+			t.Errorf("message sent to %q", m.channelID)
+		}
+		byUser[m.userID] = m
+	}
+	want := "**Dark** — Season 2: 2/3 episodes cached\n**Heat**"
+	if lines := strings.Join(byUser["alice"].lines, "\n"); lines != want {
+		t.Errorf("alice got\n%s\nwant\n%s", lines, want)
+	}
+	if lines := strings.Join(byUser["bob"].lines, "\n"); lines != "**Heat**" {
+		t.Errorf("bob got %q", lines)
+	}
+	if len(rb.started) != 0 || len(rb.pending) != 0 {
+		t.Errorf("batcher kept state: started %v, pending %v", rb.started, rb.pending)
+	}
+}
+
+func TestReadyBatcherNoWindow(t *testing.T) {
+	rb, sent := recordReady(0)
+	rb.queued("chan", "alice", episode(1))
+	rb.queued("chan", "alice", episode(2))
+	rb.finished("chan", "alice", "Dark S02E01", episode(1), true)
+	rb.finished("chan", "alice", "Dark S02E02", episode(2), true)
+	rb.finished("chan", "alice", "Heat", types.VODResult{Title: "Heat"}, false)
+
+	got := sent()
+	if len(got) != 2 {
+		t.Fatalf("sent %d messages, want 2: %v", len(got), got)
+	}
+	if got[0].lines[0] != "**Dark** — Season 2: 1/2 episodes cached" {
+		t.Errorf("first message = %v", got[0].lines)
+	}
+	// The rest of the season is a single episode, named as is
+	if got[1].lines[0] != "**Dark S02E02**" {
+		t.Errorf("second message = %v", got[1].lines)
+	}
+}
+
+func TestReadyBatcherDisabled(t *testing.T) {
+	var rb *readyBatcher
+	rb.queued("chan", "alice", episode(1))
+	rb.finished("chan", "alice", "Dark S02E01", episode(1), true)
+}
+
+func TestReadyBatchWindow(t *testing.T) {
+	tests := []struct {
+		env  string
+		want time.Duration
+	}{
+		{"", 30 * time.Second},
+		{"2m", 2 * time.Minute},
+		{"10", 10 * time.Second},
+		{"0", 0},
+		{"-5s", 30 * time.Second},
+		{"soon", 30 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Setenv("CACHE_READY_BATCH_WINDOW", tt.env)
+		if got := readyBatchWindow(); got != tt.want {
+			t.Errorf("readyBatchWindow(%q) = %v, want %v", tt.env, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package discord
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/lucasduport/stream-share/pkg/types"
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// maxSelectOptions is the most options Discord accepts in one select menu
+const maxSelectOptions = 25
+
+// seriesShow is one show matching a /series query
+type seriesShow struct {
+	ID    string
+	Title string
+}
+
+// seriesSeasonView is one season of the show being browsed, with its episodes
+// already in the shape the VOD picker expects
+type seriesSeasonView struct {
+	Season   int
+	Episodes []types.VODResult
+}
+
+// seriesBrowseContext tracks a /series message while the user picks a show and a season.
+type seriesBrowseContext struct {
+	UserID  string
+	Channel string
+	Query   string
+	Shows   []seriesShow
+	Show    seriesShow
+	Seasons []seriesSeasonView
+	Created time.Time
+}
+
+// handleSeries implements /series: pick a show, then a season, then an episode
+// from the usual VOD picker. Long-running shows stay browsable this way.
+func (b *Bot) handleSeries(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+	query := strings.TrimSpace(strings.Join(args, " "))
+	if query == "" {
+		b.info(m.ChannelID, "📺 Browse a Series", "Usage: `/series <title>`\n\nPick the season, then the episode.")
+		return
+	}
+	loading, err := s.ChannelMessageSendEmbed(m.ChannelID, &discordgo.MessageEmbed{
+		Title:       "🔎 Searching…",
+		Description: fmt.Sprintf("Looking for shows matching `%s`", query),
+		Color:       colorInfo,
+		Timestamp:   time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		utils.WarnLog("Discord: failed to send series search message: %v", err)
+		return
+	}
+
+	ok, resp, err := b.makeAPIRequest("GET", "/discord/"+m.Author.ID+"/ldap", nil)
+	data, _ := resp.(map[string]interface{})
+	ldapUser := getString(data, "ldap_user")
+	if err != nil || !ok || ldapUser == "" {
+		_ = editEmbed(s, loading, colorWarn, "🔗 Linking Required", "Link your account with `/link <ldap_username>`.")
+		return
+	}
+
+	// Strip any SxxEyy part: the season and episode are picked below
+	tokens, _, _ := parseQueryFilters(query)
+	ok, resp, err = b.makeAPIRequest("POST", "/vod/search", map[string]string{"username": ldapUser, "query": strings.Join(tokens, " ")})
+	if err != nil || !ok {
+		_ = editEmbed(s, loading, colorError, "❌ Search Failed", "Couldn't complete search.")
+		return
+	}
+	mp, _ := resp.(map[string]interface{})
+	arr, _ := mp["results"].([]interface{})
+	shows := distinctShows(toVODResults(arr))
+	if len(shows) == 0 {
+		_ = editEmbed(s, loading, colorInfo, "🔎 No Results", fmt.Sprintf("No shows matched `%s`.", query))
+		return
+	}
+
+	ctx := &seriesBrowseContext{UserID: m.Author.ID, Channel: m.ChannelID, Query: query, Shows: shows, Created: time.Now()}
+	b.selectLock.Lock()
+	b.pendingSeries[loading.ID] = ctx
+	b.selectLock.Unlock()
+	if len(shows) == 1 {
+		b.showSeasonPicker(s, loading.ID, ctx, shows[0])
+		return
+	}
+
+	one := 1
+	opts := make([]discordgo.SelectMenuOption, 0, min(len(shows), maxSelectOptions))
+	for i, sh := range shows {
+		if i == maxSelectOptions {
+			break
+		}
+		opts = append(opts, discordgo.SelectMenuOption{Label: trimTo(sh.Title, 100), Value: strconv.Itoa(i)})
+	}
+	desc := fmt.Sprintf("Query: `%s` — %d show(s)\nPick a show.", query, len(shows))
+	if len(shows) > maxSelectOptions {
+		desc += fmt.Sprintf("\nOnly the first %d are listed; refine the query to see the others.", maxSelectOptions)
+	}
+	b.editSeriesMessage(s, loading.ID, ctx.Channel, "📺 Series", desc, &discordgo.SelectMenu{CustomID: "series_show", Placeholder: "Pick a show…", MinValues: &one, MaxValues: 1, Options: opts})
+}
+
+// showSeasonPicker loads the seasons of show and turns msgID into a season dropdown.
+func (b *Bot) showSeasonPicker(s *discordgo.Session, msgID string, ctx *seriesBrowseContext, show seriesShow) {
+	ok, resp, err := b.makeAPIRequest("GET", "/series/"+url.PathEscape(show.ID)+"/info", nil)
+	data, _ := resp.(map[string]interface{})
+	if err != nil || !ok || data == nil {
+		b.editSeriesMessage(s, msgID, ctx.Channel, "❌ Series Unavailable", fmt.Sprintf("Couldn't load the seasons of **%s**.", show.Title), nil)
+		b.dropSeriesContext(msgID)
+		return
+	}
+	if name := getString(data, "name"); name != "" {
+		show.Title = name
+	}
+	ctx.Show = show
+	ctx.Seasons = seasonViews(show, data)
+	if len(ctx.Seasons) == 0 {
+		b.editSeriesMessage(s, msgID, ctx.Channel, "🔎 No Episodes", fmt.Sprintf("The provider lists no episodes for **%s**.", show.Title), nil)
+		b.dropSeriesContext(msgID)
+		return
+	}
+
+	one := 1
+	opts := make([]discordgo.SelectMenuOption, 0, min(len(ctx.Seasons), maxSelectOptions))
+	for i, sv := range ctx.Seasons {
+		if i == maxSelectOptions {
+			break
+		}
+		label := fmt.Sprintf("Season %d", sv.Season)
+		if sv.Season == 0 {
+			label = "Specials"
+		}
+		opts = append(opts, discordgo.SelectMenuOption{Label: label, Value: strconv.Itoa(i), Description: fmt.Sprintf("%d episode(s)", len(sv.Episodes))})
+	}
+	desc := fmt.Sprintf("**%s** — %d season(s)\nPick a season.", show.Title, len(ctx.Seasons))
+	b.editSeriesMessage(s, msgID, ctx.Channel, "📺 "+trimTo(show.Title, 200), desc, &discordgo.SelectMenu{CustomID: "series_season", Placeholder: "Pick a season…", MinValues: &one, MaxValues: 1, Options: opts})
+}
+
+// handleSeriesComponent handles the show and season dropdowns of /series.
+func (b *Bot) handleSeriesComponent(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	msgID := i.Message.ID
+	b.selectLock.RLock()
+	ctx, ok := b.pendingSeries[msgID]
+	b.selectLock.RUnlock()
+	if !ok || !b.isSameUser(ctx.UserID, i) {
+		return
+	}
+	data := i.MessageComponentData()
+	if len(data.Values) == 0 {
+		return
+	}
+	idx, err := strconv.Atoi(data.Values[0])
+	if err != nil || idx < 0 {
+		return
+	}
+	_ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseDeferredMessageUpdate})
+
+	switch data.CustomID {
+	case "series_show":
+		if idx >= len(ctx.Shows) {
+			return
+		}
+		b.showSeasonPicker(s, msgID, ctx, ctx.Shows[idx])
+	case "series_season":
+		if idx >= len(ctx.Seasons) {
+			return
+		}
+		sv := ctx.Seasons[idx]
+		// Hand the message over to the regular VOD picker for the episode choice
+		vctx := &vodSelectContext{
+			UserID:        ctx.UserID,
+			Channel:       ctx.Channel,
+			Query:         fmt.Sprintf("%s S%02d", ctx.Show.Title, sv.Season),
+			Results:       sv.Episodes,
+			PerPage:       maxSelectOptions,
+			Created:       time.Now(),
+			EnrichedPages: map[int]bool{},
+		}
+		b.enrichFirstPage(ctx.UserID, vctx.Query, vctx.Results, vctx.PerPage)
+		vctx.EnrichedPages[0] = true
+		b.selectLock.Lock()
+		delete(b.pendingSeries, msgID)
+		b.pendingVODSelect[msgID] = vctx
+		b.selectLock.Unlock()
+		if err := b.updateVODInteractiveMessage(s, msgID, vctx); err != nil {
+			utils.WarnLog("Discord: failed to show episodes: %v", err)
+		}
+	}
+}
+
+// editSeriesMessage replaces the /series message with an embed and an optional dropdown.
+func (b *Bot) editSeriesMessage(s *discordgo.Session, msgID, channelID, title, desc string, menu *discordgo.SelectMenu) {
+	embeds := []*discordgo.MessageEmbed{{Title: title, Description: desc, Color: colorInfo, Timestamp: time.Now().UTC().Format(time.RFC3339)}}
+	components := []discordgo.MessageComponent{}
+	if menu != nil {
+		components = append(components, discordgo.ActionsRow{Components: []discordgo.MessageComponent{*menu}})
+	}
+	if _, err := s.ChannelMessageEditComplex(&discordgo.MessageEdit{ID: msgID, Channel: channelID, Embeds: &embeds, Components: &components}); err != nil {
+		utils.WarnLog("Discord: failed to update series message: %v", err)
+	}
+}
+
+// dropSeriesContext forgets a /series message that reached a dead end.
+func (b *Bot) dropSeriesContext(msgID string) {
+	b.selectLock.Lock()
+	delete(b.pendingSeries, msgID)
+	b.selectLock.Unlock()
+}
+
+// distinctShows lists the shows behind the episode results, sorted by title.
+func distinctShows(results []types.VODResult) []seriesShow {
+	seen := make(map[string]bool)
+	shows := make([]seriesShow, 0)
+	for _, r := range results {
+		if r.StreamType != "series" || r.SeriesID == "" || seen[r.SeriesID] {
+			continue
+		}
+		seen[r.SeriesID] = true
+		title := r.SeriesTitle
+		if title == "" {
+			title = r.Title
+		}
+		shows = append(shows, seriesShow{ID: r.SeriesID, Title: title})
+	}
+	sort.SliceStable(shows, func(i, j int) bool { return strings.ToLower(shows[i].Title) < strings.ToLower(shows[j].Title) })
+	return shows
+}
+
+// seasonViews converts a /series/:id/info answer into per-season VOD results.
+func seasonViews(show seriesShow, data map[string]interface{}) []seriesSeasonView {
+	seasons, _ := data["seasons"].([]interface{})
+	out := make([]seriesSeasonView, 0, len(seasons))
+	for _, sv := range seasons {
+		sm, ok := sv.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		view := seriesSeasonView{Season: int(getInt64(sm, "season"))}
+		eps, _ := sm["episodes"].([]interface{})
+		for _, e := range eps {
+			em, ok := e.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			sid := getString(em, "stream_id")
+			if sid == "" {
+				continue
+			}
+			ep := int(getInt64(em, "episode"))
+			epTitle := getString(em, "title")
+			view.Episodes = append(view.Episodes, types.VODResult{
+				ID:           sid,
+				StreamID:     sid,
+				Title:        fmt.Sprintf("%s S%02dE%02d — %s", show.Title, view.Season, ep, epTitle),
+				Duration:     getString(em, "duration"),
+				StreamType:   "series",
+				SeriesID:     show.ID,
+				SeriesTitle:  show.Title,
+				Season:       view.Season,
+				Episode:      ep,
+				EpisodeTitle: epTitle,
+				AirDate:      getString(em, "air_date"),
+				Plot:         getString(em, "plot"),
+			})
+		}
+		if len(view.Episodes) > 0 {
+			out = append(out, view)
+		}
+	}
+	return out
+}
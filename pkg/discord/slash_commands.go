@@ -38,6 +38,13 @@ func (b *Bot) commandSpecs() []*discordgo.ApplicationCommand {
                 {Type: discordgo.ApplicationCommandOptionString, Name: "query", Description: "Title to search (supports S01E02)", Required: true},
             },
         },
+        {
+            Name:        "series",
+            Description: "Browse a show season by season",
+            Options: []*discordgo.ApplicationCommandOption{
+                {Type: discordgo.ApplicationCommandOptionString, Name: "title", Description: "Show title", Required: true},
+            },
+        },
         {
             Name:        "link",
             Description: "Link your Discord account to your IPTV (LDAP) user",
@@ -45,6 +52,10 @@ func (b *Bot) commandSpecs() []*discordgo.ApplicationCommand {
                 {Type: discordgo.ApplicationCommandOptionString, Name: "username", Description: "Your LDAP username", Required: true},
             },
         },
+        {
+            Name:        "unlink",
+            Description: "Remove the link between your Discord account and your IPTV user",
+        },
         {
             Name:        "cache",
             Description: "Cache a movie/episode on the server (max 14 days)",
@@ -57,10 +68,45 @@ func (b *Bot) commandSpecs() []*discordgo.ApplicationCommand {
             Name:        "cached",
             Description: "List cached items and when they expire",
         },
+        {
+            Name:        "library",
+            Description: "Get a playlist of the cached movies and episodes",
+        },
+        {
+            Name:        "queue",
+            Description: "Show downloads in progress with their progress and ETA",
+        },
+        {
+            Name:        "delete",
+            Description: "Delete a cached item before it expires (admin)",
+            Options: []*discordgo.ApplicationCommandOption{
+                {Type: discordgo.ApplicationCommandOptionString, Name: "query", Description: "Title or stream id of the cached item", Required: true},
+                {Type: discordgo.ApplicationCommandOptionBoolean, Name: "force", Description: "Also delete an item that is still downloading", Required: false},
+            },
+        },
+        {
+            Name:        "history",
+            Description: "Show recently watched titles",
+            Options: []*discordgo.ApplicationCommandOption{
+                {Type: discordgo.ApplicationCommandOptionString, Name: "username", Description: "LDAP user to inspect (admin only; defaults to you)", Required: false},
+            },
+        },
+        {
+            Name:        "record",
+            Description: "Record a live channel to the server cache",
+            Options: []*discordgo.ApplicationCommandOption{
+                {Type: discordgo.ApplicationCommandOptionString, Name: "channel", Description: "Channel name or stream id", Required: true},
+                {Type: discordgo.ApplicationCommandOptionInteger, Name: "minutes", Description: "How long to record (1–360)", Required: true, MinValue: floatPtr(1), MaxValue: 360},
+            },
+        },
         {
             Name:        "status",
             Description: "Show active streams and users",
         },
+        {
+            Name:        "ping",
+            Description: "Check whether the provider is up (admins also see latency)",
+        },
         {
             Name:        "disconnect",
             Description: "Forcibly disconnect a user",
@@ -76,6 +122,38 @@ func (b *Bot) commandSpecs() []*discordgo.ApplicationCommand {
                 {Type: discordgo.ApplicationCommandOptionInteger, Name: "minutes", Description: "Timeout duration in minutes (>0)", Required: true, MinValue: floatPtr(1)},
             },
         },
+        {
+            Name:        "untimeout",
+            Description: "Lift a user's timeout early",
+            Options: []*discordgo.ApplicationCommandOption{
+                {Type: discordgo.ApplicationCommandOptionString, Name: "username", Description: "Username to release", Required: true},
+            },
+        },
+        {
+            Name:        "stopall",
+            Description: "Stop every active stream (asks for confirmation)",
+            Options: []*discordgo.ApplicationCommandOption{
+                {Type: discordgo.ApplicationCommandOptionBoolean, Name: "block", Description: "Also block new streams until /resume", Required: false},
+            },
+        },
+        {
+            Name:        "resume",
+            Description: "Allow new streams again after a blocking stop-all",
+        },
+        {
+            Name:        "kill",
+            Description: "Force-stop one stream and disconnect its viewers",
+            Options: []*discordgo.ApplicationCommandOption{
+                {Type: discordgo.ApplicationCommandOptionString, Name: "streamid", Description: "ID of the stream to stop", Required: true},
+            },
+        },
+        {
+            Name:        "validate",
+            Description: "Dry-run the provider playlist and report problems",
+            Options: []*discordgo.ApplicationCommandOption{
+                {Type: discordgo.ApplicationCommandOptionString, Name: "url", Description: "Check this M3U URL instead of the configured one", Required: false},
+            },
+        },
     }
 }
 
@@ -160,12 +238,23 @@ func (b *Bot) handleApplicationCommand(s *discordgo.Session, i *discordgo.Intera
     mc := toMessageCreateFromInteraction(i, "")
     b.handleLink(s, mc, []string{username})
 
+    case "unlink":
+        _ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseChannelMessageWithSource, Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral, Content: "Unlinking…"}})
+        mc := toMessageCreateFromInteraction(i, "")
+        b.handleUnlink(s, mc, nil)
+
     case "vod":
         query := optString(i, "query")
         _ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseChannelMessageWithSource, Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral, Content: "Searching…"}})
     mc := toMessageCreateFromInteraction(i, "")
     b.handleVOD(s, mc, strings.Fields(query))
 
+    case "series":
+        title := optString(i, "title")
+        _ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseChannelMessageWithSource, Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral, Content: "Searching…"}})
+        mc := toMessageCreateFromInteraction(i, "")
+        b.handleSeries(s, mc, strings.Fields(title))
+
     case "cache":
         title := optString(i, "title")
         days := int(optInt(i, "days"))
@@ -178,11 +267,47 @@ func (b *Bot) handleApplicationCommand(s *discordgo.Session, i *discordgo.Intera
     mc := toMessageCreateFromInteraction(i, "")
         b.handleCachedList(s, mc)
 
+    case "library":
+        _ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseChannelMessageWithSource, Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral, Content: "Fetching library link…"}})
+        mc := toMessageCreateFromInteraction(i, "")
+        b.handleLibrary(s, mc)
+
+    case "queue":
+        _ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseChannelMessageWithSource, Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral, Content: "Fetching download queue…"}})
+        mc := toMessageCreateFromInteraction(i, "")
+        b.handleQueue(s, mc, nil)
+
+    case "delete":
+        _ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseChannelMessageWithSource, Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral, Content: "Looking up cached item…"}})
+        mc := toMessageCreateFromInteraction(i, "")
+        args := strings.Fields(optString(i, "query"))
+        if optBool(i, "force") { args = append(args, "--force") }
+        b.handleDelete(s, mc, args)
+
+    case "history":
+        _ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseChannelMessageWithSource, Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral, Content: "Fetching history…"}})
+        mc := toMessageCreateFromInteraction(i, "")
+        args := []string{}
+        if u := optString(i, "username"); u != "" { args = append(args, u) }
+        b.handleHistory(s, mc, args)
+
+    case "record":
+        channel := optString(i, "channel")
+        minutes := int(optInt(i, "minutes"))
+        _ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseChannelMessageWithSource, Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral, Content: "Starting recording…"}})
+        mc := toMessageCreateFromInteraction(i, "")
+        b.handleRecord(s, mc, append(strings.Fields(channel), strconv.Itoa(minutes)))
+
     case "status":
         _ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseChannelMessageWithSource, Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral, Content: "Getting status…"}})
     mc := toMessageCreateFromInteraction(i, "")
         b.handleStatus(s, mc, nil)
 
+    case "ping":
+        _ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseChannelMessageWithSource, Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral, Content: "Probing provider…"}})
+        mc := toMessageCreateFromInteraction(i, "")
+        b.handlePing(s, mc, nil)
+
     case "disconnect":
         username := optString(i, "username")
         _ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseChannelMessageWithSource, Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral, Content: "Disconnecting…"}})
@@ -195,6 +320,36 @@ func (b *Bot) handleApplicationCommand(s *discordgo.Session, i *discordgo.Intera
         _ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseChannelMessageWithSource, Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral, Content: "Applying timeout…"}})
     mc := toMessageCreateFromInteraction(i, "")
         b.handleTimeout(s, mc, []string{username, fmt.Sprintf("%d", minutes)})
+
+    case "untimeout":
+        username := optString(i, "username")
+        _ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseChannelMessageWithSource, Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral, Content: "Lifting timeout…"}})
+        mc := toMessageCreateFromInteraction(i, "")
+        b.handleUntimeout(s, mc, []string{username})
+
+    case "stopall":
+        _ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseChannelMessageWithSource, Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral, Content: "Awaiting confirmation…"}})
+        mc := toMessageCreateFromInteraction(i, "")
+        args := []string{}
+        if optBool(i, "block") { args = append(args, "block") }
+        b.handleStopAll(s, mc, args)
+
+    case "resume":
+        _ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseChannelMessageWithSource, Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral, Content: "Resuming…"}})
+        mc := toMessageCreateFromInteraction(i, "")
+        b.handleResume(s, mc, nil)
+
+    case "kill":
+        streamID := optString(i, "streamid")
+        _ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseChannelMessageWithSource, Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral, Content: "Stopping stream…"}})
+        mc := toMessageCreateFromInteraction(i, "")
+        b.handleKill(s, mc, []string{streamID})
+
+    case "validate":
+        playlistURL := optString(i, "url")
+        _ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseChannelMessageWithSource, Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral, Content: "Validating playlist…"}})
+        mc := toMessageCreateFromInteraction(i, "")
+        b.handleValidate(s, mc, []string{playlistURL})
     }
 }
 
@@ -211,12 +366,19 @@ func optInt(i *discordgo.InteractionCreate, name string) int64 {
     }
     return 0
 }
+func optBool(i *discordgo.InteractionCreate, name string) bool {
+    for _, o := range i.ApplicationCommandData().Options {
+        if o.Name == name { return o.BoolValue() }
+    }
+    return false
+}
 
 // toMessageCreateFromInteraction builds a minimal MessageCreate to reuse legacy handlers
 func toMessageCreateFromInteraction(i *discordgo.InteractionCreate, content string) *discordgo.MessageCreate {
-    mc := &discordgo.MessageCreate{Message: &discordgo.Message{ID: "", Content: content, Timestamp: time.Now(), ChannelID: channelIDFromInteraction(i)}}
+    mc := &discordgo.MessageCreate{Message: &discordgo.Message{ID: i.ID, Content: content, Timestamp: time.Now(), ChannelID: channelIDFromInteraction(i)}}
     if i.Member != nil && i.Member.User != nil {
         mc.Author = i.Member.User
+        mc.Member = i.Member
         mc.GuildID = i.GuildID
     } else if i.User != nil {
         mc.Author = i.User
@@ -40,8 +40,16 @@ type Bot struct {
 
     // Component-based selection contexts
     pendingVODSelect map[string]*vodSelectContext // messageID -> selection context
+    pendingSeries    map[string]*seriesBrowseContext // messageID -> /series browsing context
     selectLock       sync.RWMutex
 
+    // Batches cache-ready pings; nil when CACHE_READY_NOTIFY is off
+    readyNotes *readyBatcher
+
+    // Channel each cache was started from, for ready DMs that cannot be delivered
+    cacheOrigins map[string]string // streamID -> channelID
+    originLock   sync.Mutex
+
     // Slash commands
     devGuildID        string
     registeredCommands []*discordgo.ApplicationCommand
@@ -53,10 +61,14 @@ type vodSelectContext struct {
     UserID  string
     Channel string
     Query   string
+    // Token of the server-side stored search (GET /vod/request/:token)
+    Token   string
     Results []types.VODResult
     Page    int
     PerPage int
     Created time.Time
+    // Message or interaction id of the command that opened the picker
+    OriginID string
     // Tracks which pages have been enriched (full name, rating, size) to avoid redundant refreshes
     EnrichedPages map[int]bool
 }
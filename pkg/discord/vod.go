@@ -20,6 +20,7 @@ package discord
 
 import (
     "fmt"
+    "net/url"
     "strings"
     "time"
 
@@ -89,10 +90,10 @@ func (b *Bot) handleVOD(s *discordgo.Session, m *discordgo.MessageCreate, args [
     total := len(results)
     perPage := 25
     withButtons := total > perPage
-    ctx := &vodSelectContext{UserID: m.Author.ID, Channel: m.ChannelID, Query: query, Results: results, Page: 0, PerPage: perPage, Created: time.Now(), EnrichedPages: map[int]bool{}}
+    ctx := &vodSelectContext{UserID: m.Author.ID, Channel: m.ChannelID, Query: query, Token: getString(mp, "request_token"), Results: results, Page: 0, PerPage: perPage, Created: time.Now(), EnrichedPages: map[int]bool{}}
 
     // Enrich only the first page sizes/metadata from server to keep fast responses
-    b.enrichFirstPage(query, results, perPage)
+    b.enrichFirstPage(m.Author.ID, query, results, perPage)
 
     // Prepare current page options across multiple selects
     pages := (total + perPage - 1) / perPage
@@ -152,20 +153,7 @@ func (b *Bot) handleCachedList(s *discordgo.Session, m *discordgo.MessageCreate)
 		lines := make([]string, 0, end-start)
 		for _, it := range arr[start:end] {
 			mapp, _ := it.(map[string]interface{})
-			typ := getString(mapp, "type")
-			title := strings.TrimSpace(getString(mapp, "title"))
-			if typ == "series" {
-				st := getString(mapp, "series_title")
-				if strings.TrimSpace(st) != "" { title = st }
-				if title == "" { title = "Series" }
-				season := int(getInt64(mapp, "season"))
-				episode := int(getInt64(mapp, "episode"))
-				if season > 0 || episode > 0 {
-					title = fmt.Sprintf("%s S%02dE%02d", title, season, episode)
-				}
-			} else {
-				if title == "" { title = "Unknown title" }
-			}
+			title := cacheEntryTitle(mapp)
 			by := strings.TrimSpace(getString(mapp, "requested_by"))
 			leftSecs := int(getInt64(mapp, "time_left_seconds"))
 			// Humanize left: prioritize days, else hours
@@ -189,4 +177,40 @@ func (b *Bot) handleCachedList(s *discordgo.Session, m *discordgo.MessageCreate)
 		if pages > 1 { desc += fmt.Sprintf("\n\nPage %d/%d", p+1, pages) }
 		b.info(m.ChannelID, "💾 Cached Items", desc)
 	}
-}
\ No newline at end of file
+}
+
+// handleLibrary gives the link to the user's playlist of cached items.
+func (b *Bot) handleLibrary(s *discordgo.Session, m *discordgo.MessageCreate) {
+	ok, resp, err := b.makeAPIRequest("GET", "/discord/"+m.Author.ID+"/ldap", nil)
+	data, _ := resp.(map[string]interface{})
+	username := getString(data, "ldap_user")
+	if err != nil || !ok || username == "" { b.warn(m.ChannelID, "🔗 Linking Required", "Link your account with `!link <ldap_username>`."); return }
+
+	ok, resp, err = b.makeAPIRequest("GET", "/library/"+url.PathEscape(username), nil)
+	if err != nil || !ok { b.fail(m.ChannelID, "❌ Library Failed", "Couldn't get your library link."); return }
+	data, _ = resp.(map[string]interface{})
+	scope := "everything cached on the server"
+	if getString(data, "scope") == "requester" { scope = "the items you cached" }
+	desc := fmt.Sprintf("Add this playlist to your player, with your IPTV password at the end:\n`%s`\n\nIt lists %s (**%d** right now) and follows the cache as it changes.",
+		getString(data, "url"), scope, getInt64(data, "count"))
+	b.info(m.ChannelID, "📚 Your Library", desc)
+}
+
+// cacheEntryTitle names a /cache/list entry: the title of a movie, or the show
+// with SxxEyy for an episode
+func cacheEntryTitle(mapp map[string]interface{}) string {
+	title := strings.TrimSpace(getString(mapp, "title"))
+	if getString(mapp, "type") == "series" {
+		st := getString(mapp, "series_title")
+		if strings.TrimSpace(st) != "" { title = st }
+		if title == "" { title = "Series" }
+		season := int(getInt64(mapp, "season"))
+		episode := int(getInt64(mapp, "episode"))
+		if season > 0 || episode > 0 {
+			title = fmt.Sprintf("%s S%02dE%02d", title, season, episode)
+		}
+	} else if title == "" {
+		title = "Unknown title"
+	}
+	return title
+}
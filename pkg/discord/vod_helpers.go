@@ -46,9 +46,13 @@ func buildLabelForVOD(r types.VODResult) string {
 func buildDescriptionForVOD(r types.VODResult) string {
     parts := []string{}
     if r.StreamType != "" { parts = append(parts, strings.Title(r.StreamType)) }
+    if r.AirDate != "" { parts = append(parts, "📅 "+r.AirDate) }
+    if len(r.Parts) > 1 { parts = append(parts, fmt.Sprintf("%d parts", len(r.Parts))) }
     if r.Category != "" { parts = append(parts, r.Category) }
     if r.Size != "" { parts = append(parts, r.Size) }
     if r.Rating != "" { parts = append(parts, "⭐ "+r.Rating) }
+    // Plot goes last so the 100 rune limit trims it first
+    if r.Plot != "" { parts = append(parts, r.Plot) }
     return strings.Join(parts, "  •  ")
 }
 
@@ -91,7 +95,17 @@ func toVODResults(arr []interface{}) []types.VODResult {
             StreamID:    getString(rm, "StreamID"),
             Size:        getString(rm, "Size"),
             StreamType:  strings.ToLower(getString(rm, "StreamType")),
+            SeriesID:    getString(rm, "SeriesID"),
             SeriesTitle: getString(rm, "SeriesTitle"),
+            AirDate:     getString(rm, "AirDate"),
+            Plot:        getString(rm, "Plot"),
+        }
+        if parts, ok := rm["Parts"].([]interface{}); ok {
+            for _, p := range parts {
+                pm, ok := p.(map[string]interface{})
+                if !ok { continue }
+                vr.Parts = append(vr.Parts, types.VODPart{Part: int(getInt64(pm, "Part")), StreamID: getString(pm, "StreamID"), Title: getString(pm, "Title")})
+            }
         }
         if v, ok := rm["Season"].(float64); ok { vr.Season = int(v) }
         if v, ok := rm["Episode"].(float64); ok { vr.Episode = int(v) }
@@ -130,9 +144,9 @@ func sortVODResults(results []types.VODResult) {
 }
 
 // enrichFirstPage requests size enrichment for page 0 and mutates the results slice
-func (b *Bot) enrichFirstPage(query string, results []types.VODResult, perPage int) {
+func (b *Bot) enrichFirstPage(userID, query string, results []types.VODResult, perPage int) {
     if len(results) == 0 { return }
-    payload := map[string]interface{}{"query": query, "results": results, "page": 0, "per_page": perPage}
+    payload := map[string]interface{}{"query": query, "results": results, "page": 0, "per_page": perPage, "discord_id": userID}
     if ok2, resp2, err2 := b.makeAPIRequest("POST", "/vod/enrich", payload); err2 == nil && ok2 {
         if mp2, _ := resp2.(map[string]interface{}); mp2 != nil {
             if arr2, _ := mp2["results"].([]interface{}); len(arr2) == len(results) {
@@ -151,7 +165,7 @@ func (b *Bot) enrichFirstPage(query string, results []types.VODResult, perPage i
 func buildOptionsForRange(results []types.VODResult, start, end int) []discordgo.SelectMenuOption {
     if start < 0 { start = 0 }
     if end > len(results) { end = len(results) }
-    if start > end { start, end = end, end }
+    if start > end { start = end }
     opts := make([]discordgo.SelectMenuOption, 0, end-start)
     for i := start; i < end; i++ {
         r := results[i]
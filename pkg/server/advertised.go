@@ -0,0 +1,73 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// advertisedEndpoint is the public address players reach the proxy at, which
+// differs from the listen address behind a TLS-terminating reverse proxy.
+type advertisedEndpoint struct {
+	scheme string
+	host   string
+	port   int
+}
+
+// hostPort is host:port, as put in generated URLs.
+func (e advertisedEndpoint) hostPort() string {
+	return net.JoinHostPort(e.host, strconv.Itoa(e.port))
+}
+
+// advertised resolves the public address every generated URL uses: playlist
+// tracks, HLS manifests, logos, timeshift links and the login server_info.
+// ADVERTISED_SCHEME and ADVERTISED_HOST override --https and --hostname;
+// the port comes from --advertised-port (ADVERTISED_PORT), which defaults to
+// the listen port.
+func (c *Config) advertised() advertisedEndpoint {
+	e := advertisedEndpoint{scheme: "http", host: c.HostConfig.Hostname, port: c.AdvertisedPort}
+	if c.HTTPS {
+		e.scheme = "https"
+	}
+	if v := strings.ToLower(strings.TrimSpace(os.Getenv("ADVERTISED_SCHEME"))); v != "" {
+		if v == "http" || v == "https" {
+			e.scheme = v
+		} else {
+			utils.WarnLog("Invalid ADVERTISED_SCHEME: %s (use http or https)", v)
+		}
+	}
+	if v := strings.TrimSpace(os.Getenv("ADVERTISED_HOST")); v != "" {
+		if strings.ContainsAny(v, "/:@ ") {
+			utils.WarnLog("Invalid ADVERTISED_HOST: %s (expected a bare host name)", v)
+		} else {
+			e.host = v
+		}
+	}
+	return e
+}
+
+// advertisedOverride reports whether ADVERTISED_SCHEME or ADVERTISED_HOST is set.
+func advertisedOverride() bool {
+	return os.Getenv("ADVERTISED_SCHEME") != "" || os.Getenv("ADVERTISED_HOST") != ""
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lucasduport/stream-share/pkg/config"
+)
+
+// TestAdvertisedOverride listens on plain HTTP port 8080 under an internal
+// name and advertises https://iptv.example.com:443: every generated URL must
+// use the public address.
+func TestAdvertisedOverride(t *testing.T) {
+	resetExpDate(t)
+	t.Setenv("XTREAM_EXP_DATE", "")
+	t.Setenv("XTREAM_REAL_USER_INFO", "")
+	t.Setenv("REVERSE_PROXY", "")
+	t.Setenv("ADVERTISED_SCHEME", "HTTPS")
+	t.Setenv("ADVERTISED_HOST", "iptv.example.com")
+
+	c := &Config{
+		ProxyConfig: &config.ProxyConfig{
+			HostConfig:     &config.HostConfiguration{Hostname: "stream-share.internal", Port: 8080},
+			AdvertisedPort: 443,
+			XtreamBaseURL:  "http://provider.example:8080",
+			XtreamUser:     "puser",
+			XtreamPassword: "ppass",
+			User:           "alice",
+			Password:       "secret",
+			CustomEndpoint: "/tv/",
+		},
+		endpointAntiColision: "abcd",
+	}
+	const public = "https://iptv.example.com:443/tv"
+
+	if got := c.publicBaseURL(); got != public {
+		t.Errorf("publicBaseURL = %q, want %q", got, public)
+	}
+	if got, _ := c.replaceURL("http://provider.example:8080/live/puser/ppass/1.ts", 3, false); got != public+"/abcd/alice/secret/3/1.ts" {
+		t.Errorf("replaceURL (m3u) = %q", got)
+	}
+	if got, _ := c.replaceURL("http://provider.example:8080/live/puser/ppass/1.ts", 3, true); got != public+"/live/alice/secret/1.ts" {
+		t.Errorf("replaceURL (xtream) = %q", got)
+	}
+	manifest := c.rewriteHLSManifest("#EXTM3U\n#EXTINF:6.0,\nhttp://provider.example:8080/hls/puser/ppass/1/seg1.ts\n")
+	if !strings.Contains(manifest, "\n"+public+"/hls/alice/secret/1/seg1.ts\n") {
+		t.Errorf("HLS manifest =\n%s", manifest)
+	}
+	if got := c.downloadBaseURL(); got != "https://iptv.example.com:443" {
+		t.Errorf("downloadBaseURL = %q", got)
+	}
+
+	info := c.localLoginResponse()["server_info"].(map[string]interface{})
+	want := map[string]string{"url": "https://iptv.example.com", "port": "443", "https_port": "443", "server_protocol": "https"}
+	for k, v := range want {
+		if info[k] != v {
+			t.Errorf("server_info %s = %v, want %q", k, info[k], v)
+		}
+	}
+}
+
+func TestAdvertised(t *testing.T) {
+	c := &Config{ProxyConfig: &config.ProxyConfig{
+		HostConfig:     &config.HostConfiguration{Hostname: "listen.local", Port: 8080},
+		AdvertisedPort: 8080,
+		HTTPS:          true,
+	}}
+	tests := []struct {
+		name, scheme, host string
+		want               advertisedEndpoint
+	}{
+		{"listen config", "", "", advertisedEndpoint{"https", "listen.local", 8080}},
+		{"scheme override", "http", "", advertisedEndpoint{"http", "listen.local", 8080}},
+		{"host override", "", "tv.example.com", advertisedEndpoint{"https", "tv.example.com", 8080}},
+		{"invalid scheme ignored", "ftp", "", advertisedEndpoint{"https", "listen.local", 8080}},
+		{"host with a port ignored", "", "tv.example.com:443", advertisedEndpoint{"https", "listen.local", 8080}},
+		{"URL as host ignored", "", "https://tv.example.com", advertisedEndpoint{"https", "listen.local", 8080}},
+	}
+	for _, tt := range tests {
+		t.Setenv("ADVERTISED_SCHEME", tt.scheme)
+		t.Setenv("ADVERTISED_HOST", tt.host)
+		if got := c.advertised(); got != tt.want {
+			t.Errorf("%s: advertised = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
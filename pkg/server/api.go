@@ -46,16 +46,17 @@ func (c *Config) setupInternalAPI(r *gin.Engine) {
 	api := r.Group("/api/internal")
 	api.Use(c.apiKeyAuth())
 
+	// Compress JSON answers; registered before the recovery handlers so
+	// their error responses go through it too
+	api.Use(gzipJSON())
+
 	// Add recovery middleware to prevent panics from taking down the server
 	api.Use(gin.Recovery())
 	api.Use(func(ctx *gin.Context) {
 		defer func() {
 			if err := recover(); err != nil {
-				utils.ErrorLog("API PANIC RECOVERED: %v\nStack trace: %s", err, debug.Stack())
-				ctx.AbortWithStatusJSON(http.StatusInternalServerError, types.APIResponse{
-					Success: false,
-					Error:   fmt.Sprintf("Internal server error: %v", err),
-				})
+				reqLog(ctx).ErrorLog("API PANIC RECOVERED: %v\nStack trace: %s", err, debug.Stack())
+				abortJSON(ctx, http.StatusInternalServerError, errCodeInternal, fmt.Sprintf("Internal server error: %v", err))
 			}
 		}()
 		ctx.Next()
@@ -66,13 +67,35 @@ func (c *Config) setupInternalAPI(r *gin.Engine) {
 	api.GET("/users/:username", c.getUserInfo)
 	api.POST("/users/disconnect/:username", c.disconnectUser)
 	api.POST("/users/timeout/:username", c.timeoutUser)
+	api.POST("/users/untimeout/:username", c.untimeoutUser)
 
 	// Stream management endpoints
 	api.GET("/streams", c.getAllStreams)
-	api.GET("/streams/:streamid", c.getStreamInfo)
+	validStreamID := validateStreamIDs("streamid")
+	api.GET("/streams/:streamid", validStreamID, c.getStreamInfo)
+
+	// Stream history (keyset paginated) and CSV export
+	api.GET("/history", c.listStreamHistory)
+	api.GET("/history/export.csv", c.exportStreamHistoryCSV)
+	api.GET("/history/:username", c.getUserStreamHistory)
+
+	// Admin endpoints
+	api.POST("/admin/streams/stopall", c.stopAllStreams)
+	api.POST("/admin/streams/resume", c.resumeStreams)
+	api.POST("/admin/streams/:id/stop", c.stopStreamByID)
+	api.GET("/admin/features", c.getFeatures)
+	api.POST("/admin/apicache/flush", c.flushAPICache)
+	api.GET("/admin/overview", c.adminOverview)
+	api.GET("/admin/sessions", c.listSessions)
+	api.POST("/admin/validate", c.validatePlaylist)
+	if dashboardEnabled() {
+		// Registered outside the group: the page also takes the key as ?key=
+		r.GET("/api/internal/admin/dashboard", dashboardAuth, c.adminDashboard)
+	}
 
 	// Discord integration endpoints
 	api.POST("/discord/link", c.linkDiscordUser)
+	api.DELETE("/discord/:discordid/link", c.unlinkDiscordUser)
 	api.GET("/discord/:discordid/ldap", c.getLDAPFromDiscord)
 
 	// VOD search and download endpoints
@@ -80,19 +103,30 @@ func (c *Config) setupInternalAPI(r *gin.Engine) {
 	api.POST("/vod/enrich", c.enrichVODPage)
 	api.POST("/vod/download", c.createVODDownload)
 	api.GET("/vod/status/:requestid", c.getVODRequestStatus)
+	api.GET("/vod/request/:token", c.getVODRequest)
+	api.GET("/series/:id/info", validateStreamIDs("id"), c.getSeriesInfo)
 
 	// Caching endpoints (used by Discord)
 	api.POST("/cache/start", c.startCache)
-	api.GET("/cache/by-stream/:streamid", c.getCacheByStream)
-	api.GET("/cache/progress/:streamid", c.getCacheProgress)
+	api.GET("/cache/by-stream/:streamid", validStreamID, c.getCacheByStream)
+	api.GET("/cache/progress/:streamid", validStreamID, c.getCacheProgress)
 	api.GET("/cache/list", c.listCache)
+	api.DELETE("/cache/:streamid", validStreamID, c.deleteCache)
+	// Link to a user's /library.m3u playlist
+	api.GET("/library/:username", c.getLibraryLink)
+
+	// Live recordings (finished files are listed under /cache/list)
+	api.POST("/recordings/start", c.startRecording)
+	api.POST("/recordings/stop/:id", validateStreamIDs("id"), c.stopRecording)
+	api.GET("/recordings", c.listRecordings)
 
 	// Status summary for Discord and dashboards
 	api.GET("/status", c.statusSummary)
+	api.GET("/upstream/ping", c.upstreamPing)
 
 	// Debug endpoint to verify API is working
 	api.GET("/ping", func(ctx *gin.Context) {
-		utils.DebugLog("API ping received")
+		reqLog(ctx).DebugLog("API ping received")
 		ctx.JSON(http.StatusOK, types.APIResponse{
 			Success: true,
 			Message: "API is running",
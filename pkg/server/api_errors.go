@@ -0,0 +1,64 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package server
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucasduport/stream-share/pkg/types"
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// Error codes answered in the "code" field of failed responses. They are part
+// of the API: clients match on them, so existing values must not change.
+const (
+	errCodeBadRequest            = "BAD_REQUEST"
+	errCodeInvalidParameter      = "INVALID_PARAMETER"
+	errCodeUnauthorized          = "UNAUTHORIZED"
+	errCodeTooManyAttempts       = "TOO_MANY_ATTEMPTS"
+	errCodeAuthUnavailable       = "AUTH_UNAVAILABLE"
+	errCodeForbidden             = "FORBIDDEN"
+	errCodeNotFound              = "NOT_FOUND"
+	errCodeConflict              = "CONFLICT"
+	errCodeUserTimedOut          = "USER_TIMED_OUT"
+	errCodeStreamBlocked         = "STREAM_BLOCKED"
+	errCodeStreamsBlocked        = "STREAMS_BLOCKED"
+	errCodeStreamLimit           = "STREAM_LIMIT"
+	errCodeStreamNotActive       = "STREAM_NOT_ACTIVE"
+	errCodeDatabaseUnavailable   = "DATABASE_UNAVAILABLE"
+	errCodeUpstreamError         = "UPSTREAM_ERROR"
+	errCodeUpstreamEmptyPlaylist = "UPSTREAM_EMPTY_PLAYLIST"
+	errCodeUpstreamEmptyResponse = "UPSTREAM_EMPTY_RESPONSE"
+	errCodeInternal              = "INTERNAL_ERROR"
+)
+
+// abortJSON stops the handler chain with a {success:false, error, code} body.
+// The message is also attached to the context so gin's logger still prints it.
+func abortJSON(ctx *gin.Context, status int, code, msg string) {
+	_ = ctx.Error(errors.New(msg))
+	ctx.AbortWithStatusJSON(status, types.APIResponse{Success: false, Error: msg, Code: code})
+}
+
+// abortError is abortJSON for failures with an underlying error: err is
+// logged and kept on the context, while the client only sees msg so upstream
+// URLs and credentials never leak into responses.
+func abortError(ctx *gin.Context, status int, code, msg string, err error) {
+	_ = ctx.Error(utils.PrintErrorAndReturn(err))
+	ctx.AbortWithStatusJSON(status, types.APIResponse{Success: false, Error: msg, Code: code})
+}
@@ -20,6 +20,8 @@ package server
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -32,43 +34,84 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/go-ldap/ldap/v3"
 	"github.com/google/uuid"
-	"github.com/lucasduport/stream-share/pkg/types"
 	"github.com/lucasduport/stream-share/pkg/utils"
 )
 
-var internalAPIKey string
+var (
+	internalAPIKey  string     // primary key, also handed to the Discord bot
+	internalAPIKeys [][32]byte // sha256 of every accepted key
+)
 
 func init() {
-	// Generate a random API key at startup or use from environment
-	envKey := os.Getenv("INTERNAL_API_KEY")
-	if envKey != "" {
-		internalAPIKey = envKey
+	internalAPIKey, internalAPIKeys = loadAPIKeys()
+}
+
+// loadAPIKeys returns the primary internal API key, from INTERNAL_API_KEY or
+// generated at random, and the hashes of every accepted key. API_KEYS
+// (comma-separated) adds extra accepted keys so they can be rotated.
+func loadAPIKeys() (string, [][32]byte) {
+	var extra []string
+	for _, k := range strings.Split(os.Getenv("API_KEYS"), ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			extra = append(extra, k)
+		}
+	}
+
+	var primary string
+	envKey := strings.TrimSpace(os.Getenv("INTERNAL_API_KEY"))
+	switch {
+	case envKey != "":
+		primary = envKey
 		utils.InfoLog("Using API key from environment")
-	} else {
-		internalAPIKey = uuid.New().String()
-		utils.InfoLog("Generated new internal API key: %s", internalAPIKey)
+	case len(extra) > 0:
+		primary = extra[0]
+		utils.InfoLog("Using first API_KEYS entry as the internal API key")
+	default:
+		primary = uuid.New().String()
+		utils.InfoLog("Generated new internal API key: %s", primary)
+	}
+
+	hashes := [][32]byte{sha256.Sum256([]byte(primary))}
+	for _, k := range extra {
+		hashes = append(hashes, sha256.Sum256([]byte(k)))
+	}
+	if len(extra) > 0 {
+		utils.InfoLog("Accepting %d internal API keys", len(hashes))
 	}
+	return primary, hashes
 }
 
 func GetAPIKey() string {
 	return internalAPIKey
 }
 
+// validAPIKey reports whether key matches one of the accepted keys. Hashes are
+// compared so the timing reveals neither content nor length, and every key is
+// checked so the position of a match doesn't show either.
+func validAPIKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	sum := sha256.Sum256([]byte(key))
+	match := 0
+	for i := range internalAPIKeys {
+		match |= subtle.ConstantTimeCompare(sum[:], internalAPIKeys[i][:])
+	}
+	return match == 1
+}
+
 // apiKeyAuth middleware validates the internal API key
 func (c *Config) apiKeyAuth() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		key := ctx.GetHeader("X-API-Key")
-		utils.DebugLog("API Key auth check - received key: %s...", utils.MaskString(key))
-
-		if key != internalAPIKey {
-			utils.DebugLog("API authentication failed - invalid key: %s", utils.MaskString(key))
-			ctx.AbortWithStatusJSON(401, types.APIResponse{
-				Success: false,
-				Error:   "Invalid API key",
-			})
+		reqLog(ctx).DebugLog("API Key auth check - received key: %s...", utils.MaskString(key))
+
+		if !validAPIKey(key) {
+			reqLog(ctx).DebugLog("API authentication failed - invalid key: %s", utils.MaskString(key))
+			abortJSON(ctx, http.StatusUnauthorized, errCodeUnauthorized, "Invalid API key")
 			return
 		}
-		utils.DebugLog("API authentication successful for endpoint: %s", ctx.Request.URL.Path)
+		reqLog(ctx).DebugLog("API authentication successful for endpoint: %s", ctx.Request.URL.Path)
 		ctx.Next()
 	}
 }
@@ -83,18 +126,20 @@ type authRequest struct {
 // authenticate validates form/query credentials using LDAP (if enabled) or
 // local credentials. Used for GET/POST endpoints.
 func (c *Config) authenticate(ctx *gin.Context) {
-    utils.DebugLog("-> Incoming URL: %s", ctx.Request.URL)
+    reqLog(ctx).DebugLog("-> Incoming URL: %s", ctx.Request.URL)
     var authReq authRequest
-    if err := ctx.Bind(&authReq); err != nil {
-        utils.DebugLog("Bind error: %v", err)
-        ctx.AbortWithError(http.StatusBadRequest, err)
+    if err := ctx.ShouldBind(&authReq); err != nil {
+        reqLog(ctx).DebugLog("Bind error: %v", err)
+        abortJSON(ctx, http.StatusBadRequest, errCodeBadRequest, "username and password are required")
         return
     }
+    if !authAllowed(ctx, authReq.Username) { return }
 
     // Only use LDAP authentication to validate client access
     if c.ProxyConfig.LDAPEnabled {
-        utils.DebugLog("LDAP authentication enabled for user: %s", authReq.Username)
-        ok := ldapAuthenticate(
+        reqLog(ctx).DebugLog("LDAP authentication enabled for user: %s", authReq.Username)
+        ok, err := ldapAuthenticate(
+            reqLog(ctx),
             c.ProxyConfig.LDAPServer,
             c.ProxyConfig.LDAPBaseDN,
             c.ProxyConfig.LDAPBindDN,
@@ -105,49 +150,60 @@ func (c *Config) authenticate(ctx *gin.Context) {
             authReq.Username,
             authReq.Password,
         )
+        if err != nil {
+            abortError(ctx, http.StatusServiceUnavailable, errCodeAuthUnavailable, "Authentication service unavailable", err)
+            return
+        }
         if !ok {
-            utils.DebugLog("LDAP authentication failed for user: %s", authReq.Username)
-            ctx.AbortWithStatus(http.StatusUnauthorized)
+            reqLog(ctx).DebugLog("LDAP authentication failed for user: %s", authReq.Username)
+            authFailed(ctx, authReq.Username)
+            abortJSON(ctx, http.StatusUnauthorized, errCodeUnauthorized, "Invalid credentials")
             return
         }
-        utils.DebugLog("LDAP authentication succeeded for user: %s", authReq.Username)
+        reqLog(ctx).DebugLog("LDAP authentication succeeded for user: %s", authReq.Username)
+        authSucceeded(authReq.Username)
         return
     }
 
     // If LDAP is not enabled, fallback to local credentials
-    utils.DebugLog("Local authentication for user: %s", authReq.Username)
+    reqLog(ctx).DebugLog("Local authentication for user: %s", authReq.Username)
     if c.ProxyConfig.User.String() != authReq.Username || c.ProxyConfig.Password.String() != authReq.Password {
-        utils.DebugLog("Local authentication failed for user: %s", authReq.Username)
-        ctx.AbortWithStatus(http.StatusUnauthorized)
+        reqLog(ctx).DebugLog("Local authentication failed for user: %s", authReq.Username)
+        authFailed(ctx, authReq.Username)
+        abortJSON(ctx, http.StatusUnauthorized, errCodeUnauthorized, "Invalid credentials")
+        return
     }
+    authSucceeded(authReq.Username)
 }
 
 // appAuthenticate validates credentials for application/x-www-form-urlencoded
 // bodies (player_api POST). It replays the body to allow downstream reading.
 func (c *Config) appAuthenticate(ctx *gin.Context) {
-    utils.DebugLog("-> Incoming URL: %s", ctx.Request.URL)
+    reqLog(ctx).DebugLog("-> Incoming URL: %s", ctx.Request.URL)
 
     contents, err := ioutil.ReadAll(ctx.Request.Body)
     if err != nil {
-        ctx.AbortWithError(http.StatusInternalServerError, err) // nolint: errcheck
+        abortError(ctx, http.StatusInternalServerError, errCodeInternal, "Could not read request body", err)
         return
     }
 
     q, err := url.ParseQuery(string(contents))
     if err != nil {
-        ctx.AbortWithError(http.StatusInternalServerError, err) // nolint: errcheck
+        abortError(ctx, http.StatusBadRequest, errCodeBadRequest, "Invalid form body", err)
         return
     }
     if len(q["username"]) == 0 || len(q["password"]) == 0 {
-        ctx.AbortWithError(http.StatusBadRequest, fmt.Errorf("bad body url query parameters")) // nolint: errcheck
+        abortJSON(ctx, http.StatusBadRequest, errCodeBadRequest, "bad body url query parameters")
         return
     }
     log.Printf("[stream-share] %v | %s |App Auth\n", time.Now().Format("2006/01/02 - 15:04:05"), ctx.ClientIP())
+    if !authAllowed(ctx, q["username"][0]) { return }
 
     // Use LDAP authentication if enabled
     if c.ProxyConfig.LDAPEnabled {
-        utils.DebugLog("LDAP app authentication for user: %s", q["username"][0])
-        ok := ldapAuthenticate(
+        reqLog(ctx).DebugLog("LDAP app authentication for user: %s", q["username"][0])
+        ok, err := ldapAuthenticate(
+            reqLog(ctx),
             c.ProxyConfig.LDAPServer,
             c.ProxyConfig.LDAPBaseDN,
             c.ProxyConfig.LDAPBindDN,
@@ -158,45 +214,58 @@ func (c *Config) appAuthenticate(ctx *gin.Context) {
             q["username"][0],
             q["password"][0],
         )
+        if err != nil {
+            abortError(ctx, http.StatusServiceUnavailable, errCodeAuthUnavailable, "Authentication service unavailable", err)
+            return
+        }
         if !ok {
-            utils.DebugLog("LDAP app authentication failed for user: %s", q["username"][0])
-            ctx.AbortWithStatus(http.StatusUnauthorized)
+            reqLog(ctx).DebugLog("LDAP app authentication failed for user: %s", q["username"][0])
+            authFailed(ctx, q["username"][0])
+            abortJSON(ctx, http.StatusUnauthorized, errCodeUnauthorized, "Invalid credentials")
             return
         }
-        utils.DebugLog("LDAP app authentication succeeded for user: %s", q["username"][0])
+        reqLog(ctx).DebugLog("LDAP app authentication succeeded for user: %s", q["username"][0])
     } else if c.ProxyConfig.User.String() != q["username"][0] || c.ProxyConfig.Password.String() != q["password"][0] {
-        utils.DebugLog("Local app authentication failed for user: %s", q["username"][0])
-        ctx.AbortWithStatus(http.StatusUnauthorized)
+        reqLog(ctx).DebugLog("Local app authentication failed for user: %s", q["username"][0])
+        authFailed(ctx, q["username"][0])
+        abortJSON(ctx, http.StatusUnauthorized, errCodeUnauthorized, "Invalid credentials")
         return
     }
+    authSucceeded(q["username"][0])
 
     ctx.Request.Body = ioutil.NopCloser(bytes.NewReader(contents))
 }
 
-// ldapAuthenticate binds with an optional service account, finds the user DN,
-// optionally validates group membership, then attempts a user bind.
-func ldapAuthenticate(server, baseDN, bindDN, bindPassword, userAttr, groupAttr, requiredGroup, username, password string) bool {
-    utils.DebugLog("LDAP DialURL: %s", server)
-    l, err := ldap.DialURL(server)
-    if err != nil {
-        utils.DebugLog("LDAP DialURL error: %v", err)
-        return false
+// ldapAuthenticate checks credentials against LDAP, answering from the short
+// LDAP_CACHE_TTL cache when the same credentials were verified recently. A
+// non-nil error means the directory could not give a verdict; it is not
+// cached and must not count as a failed login.
+func ldapAuthenticate(log utils.RequestLogger, server, baseDN, bindDN, bindPassword, userAttr, groupAttr, requiredGroup, username, password string) (bool, error) {
+    ttl := ldapCacheTTL()
+    if ttl <= 0 {
+        return ldapVerify(log, server, baseDN, bindDN, bindPassword, userAttr, groupAttr, requiredGroup, username, password)
     }
-    defer l.Close()
-
-    // Bind with service account
-    if bindDN != "" && bindPassword != "" {
-        utils.DebugLog("LDAP service bind attempt: DN=%s", bindDN)
-        if err := l.Bind(bindDN, bindPassword); err != nil {
-            utils.DebugLog("LDAP service bind error: %v", err)
-            return false
-        }
-        utils.DebugLog("LDAP service bind succeeded")
+    key := ldapCacheKey(server, username, password)
+    if ok, hit := ldapCache.get(key); hit {
+        log.DebugLog("LDAP cache hit for user: %s (ok=%v)", username, ok)
+        return ok, nil
     }
+    ok, err := ldapVerify(log, server, baseDN, bindDN, bindPassword, userAttr, groupAttr, requiredGroup, username, password)
+    if err != nil {
+        return false, err
+    }
+    ldapCache.put(key, username, ok, ttl)
+    return ok, nil
+}
 
+// ldapVerify binds with an optional service account, finds the user DN,
+// optionally validates group membership, then attempts a user bind. Unknown
+// users, missing groups and rejected passwords are a false verdict; failures
+// to reach or query the directory are returned as errors.
+func ldapVerify(log utils.RequestLogger, server, baseDN, bindDN, bindPassword, userAttr, groupAttr, requiredGroup, username, password string) (bool, error) {
     // Search for user DN
     filter := fmt.Sprintf("(%s=%s)", userAttr, ldap.EscapeFilter(username))
-    utils.DebugLog("LDAP search: baseDN=%s, filter=%s", baseDN, filter)
+    log.DebugLog("LDAP search: baseDN=%s, filter=%s", baseDN, filter)
     searchRequest := ldap.NewSearchRequest(
         baseDN,
         ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 1, 0, false,
@@ -204,24 +273,49 @@ func ldapAuthenticate(server, baseDN, bindDN, bindPassword, userAttr, groupAttr,
         []string{"dn", groupAttr}, // Include group attribute
         nil,
     )
-    sr, err := l.Search(searchRequest)
+
+    var l *ldap.Conn // connection for the user bind
+    var sr *ldap.SearchResult
+    var err error
+    if bindDN != "" && bindPassword != "" && ldapPoolEnabled() {
+        // Search on the shared service-bound connection
+        sr, err = ldapPool.search(server, bindDN, bindPassword, searchRequest)
+    } else {
+        log.DebugLog("LDAP DialURL: %s", server)
+        if l, err = ldap.DialURL(server); err != nil {
+            log.DebugLog("LDAP DialURL error: %v", err)
+            return false, fmt.Errorf("LDAP dial: %w", err)
+        }
+        defer l.Close()
+
+        // Bind with service account
+        if bindDN != "" && bindPassword != "" {
+            log.DebugLog("LDAP service bind attempt: DN=%s", bindDN)
+            if err := l.Bind(bindDN, bindPassword); err != nil {
+                log.DebugLog("LDAP service bind error: %v", err)
+                return false, fmt.Errorf("LDAP service bind: %w", err)
+            }
+            log.DebugLog("LDAP service bind succeeded")
+        }
+        sr, err = l.Search(searchRequest)
+    }
     if err != nil {
-        utils.DebugLog("LDAP search error: %v", err)
-        return false
+        log.DebugLog("LDAP search error: %v", err)
+        return false, fmt.Errorf("LDAP search: %w", err)
     }
     if len(sr.Entries) == 0 {
-        utils.DebugLog("LDAP search: no entries found for user: %s", username)
-        return false
+        log.DebugLog("LDAP search: no entries found for user: %s", username)
+        return false, nil
     }
     userDN := sr.Entries[0].DN
-    utils.DebugLog("LDAP user DN found: %s", userDN)
+    log.DebugLog("LDAP user DN found: %s", userDN)
 
     // Check group membership if requiredGroup is specified
     if requiredGroup != "" && groupAttr != "" {
         hasGroup := false
         for _, entry := range sr.Entries {
             for _, groupValue := range entry.GetAttributeValues(groupAttr) {
-                utils.DebugLog("LDAP user group: %s", groupValue)
+                log.DebugLog("LDAP user group: %s", groupValue)
                 if strings.Contains(strings.ToLower(groupValue), strings.ToLower(requiredGroup)) {
                     hasGroup = true
                     break
@@ -229,18 +323,29 @@ func ldapAuthenticate(server, baseDN, bindDN, bindPassword, userAttr, groupAttr,
             }
         }
         if !hasGroup {
-            utils.DebugLog("LDAP user %s is not a member of required group: %s", username, requiredGroup)
-            return false
+            log.DebugLog("LDAP user %s is not a member of required group: %s", username, requiredGroup)
+            return false, nil
         }
-        utils.DebugLog("LDAP user %s is a member of required group: %s", username, requiredGroup)
+        log.DebugLog("LDAP user %s is a member of required group: %s", username, requiredGroup)
     }
 
     // Try to bind as user
-    utils.DebugLog("LDAP user bind attempt: DN=%s", userDN)
+    if l == nil {
+        log.DebugLog("LDAP DialURL: %s", server)
+        if l, err = ldap.DialURL(server); err != nil {
+            log.DebugLog("LDAP DialURL error: %v", err)
+            return false, fmt.Errorf("LDAP dial: %w", err)
+        }
+        defer l.Close()
+    }
+    log.DebugLog("LDAP user bind attempt: DN=%s", userDN)
     if err := l.Bind(userDN, password); err != nil {
-        utils.DebugLog("LDAP user bind error: %v", err)
-        return false
+        log.DebugLog("LDAP user bind error: %v", err)
+        if ldap.IsErrorAnyOf(err, ldap.LDAPResultInvalidCredentials, ldap.ErrorEmptyPassword) {
+            return false, nil
+        }
+        return false, fmt.Errorf("LDAP user bind: %w", err)
     }
-    utils.DebugLog("LDAP user bind succeeded for user: %s", username)
-    return true
+    log.DebugLog("LDAP user bind succeeded for user: %s", username)
+    return true, nil
 }
@@ -0,0 +1,263 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// authLimiter counts failed logins per client IP and per username over a
+// sliding window. Reaching the threshold locks the key out, for twice as long
+// on each new lockout. Counters live in memory, so every node limits on its own.
+type authLimiter struct {
+	mu sync.Mutex
+	authThresholds
+	entries map[string]*authFailures // "ip:<addr>" or "user:<name>"
+}
+
+// authThresholds are the limiter settings, which a reload can change.
+type authThresholds struct {
+	window     time.Duration
+	maxPerIP   int
+	maxPerUser int
+	lockout    time.Duration // first lockout
+	maxLockout time.Duration
+}
+
+type authFailures struct {
+	failures    []time.Time // inside the window, oldest first
+	lockouts    int
+	lockedUntil time.Time
+}
+
+var (
+	authLimiterOnce sync.Once
+	authLimits      *authLimiter
+)
+
+// authRateLimiter returns the shared limiter, starting its cleanup loop on
+// first use. It is nil when AUTH_RATE_LIMIT is off.
+func authRateLimiter() *authLimiter {
+	authLimiterOnce.Do(func() {
+		if !envFlag("AUTH_RATE_LIMIT", true) {
+			utils.InfoLog("Authentication rate limiting disabled")
+			return
+		}
+		t, ok := authThresholdsFromEnv()
+		if !ok {
+			utils.WarnLog("AUTH_FAILURE_WINDOW and AUTH_LOCKOUT must be positive, rate limiting disabled")
+			return
+		}
+		authLimits = &authLimiter{authThresholds: t, entries: make(map[string]*authFailures)}
+		go authLimits.run()
+	})
+	return authLimits
+}
+
+// authThresholdsFromEnv reads the AUTH_* thresholds. ok is false when the
+// window or the first lockout is not positive.
+func authThresholdsFromEnv() (t authThresholds, ok bool) {
+	t = authThresholds{
+		window:     envDuration("AUTH_FAILURE_WINDOW", 10*time.Minute),
+		maxPerIP:   envCount("AUTH_MAX_FAILURES_PER_IP", 20),
+		maxPerUser: envCount("AUTH_MAX_FAILURES_PER_USER", 5),
+		lockout:    envDuration("AUTH_LOCKOUT", time.Minute),
+		maxLockout: envDuration("AUTH_MAX_LOCKOUT", time.Hour),
+	}
+	return t, t.window > 0 && t.lockout > 0
+}
+
+// reloadAuthThresholds applies the AUTH_* thresholds from the environment to
+// the running limiter. Counters and running lockouts are kept. Turning the
+// limiter on or off with AUTH_RATE_LIMIT needs a restart.
+func reloadAuthThresholds() {
+	l := authRateLimiter()
+	if l == nil {
+		return
+	}
+	t, ok := authThresholdsFromEnv()
+	if !ok {
+		utils.WarnLog("AUTH_FAILURE_WINDOW and AUTH_LOCKOUT must be positive, keeping the current limits")
+		return
+	}
+	l.setThresholds(t)
+}
+
+// setThresholds replaces the limiter settings; they apply from the next
+// failed attempt.
+func (l *authLimiter) setThresholds(t authThresholds) {
+	l.mu.Lock()
+	l.authThresholds = t
+	l.mu.Unlock()
+}
+
+// thresholds returns the limiter settings in effect.
+func (l *authLimiter) thresholds() authThresholds {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.authThresholds
+}
+
+// blocked returns how long ip or username stays locked out, 0 when neither is.
+func (l *authLimiter) blocked(ip, username string) time.Duration {
+	if l == nil {
+		return 0
+	}
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var wait time.Duration
+	for _, key := range []string{"ip:" + ip, "user:" + username} {
+		if e, ok := l.entries[key]; ok && e.lockedUntil.After(now) {
+			wait = max(wait, e.lockedUntil.Sub(now))
+		}
+	}
+	return wait
+}
+
+// fail records a failed attempt for ip and username and locks out the keys
+// that reached their threshold.
+func (l *authLimiter) fail(ip, username string) {
+	if l == nil {
+		return
+	}
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, k := range []struct {
+		key   string
+		limit int
+	}{{"ip:" + ip, l.maxPerIP}, {"user:" + username, l.maxPerUser}} {
+		if k.limit <= 0 {
+			continue
+		}
+		e := l.entries[k.key]
+		if e == nil {
+			e = &authFailures{}
+			l.entries[k.key] = e
+		}
+		e.failures = append(e.prune(now, l.window), now)
+		if len(e.failures) < k.limit {
+			continue
+		}
+		d := l.lockout << e.lockouts
+		if d > l.maxLockout || d <= 0 {
+			d = l.maxLockout
+		}
+		e.lockouts++
+		e.lockedUntil = now.Add(d)
+		e.failures = nil
+		utils.WarnLog("Auth: locking out %s for %v after %d failed attempts", maskAuthKey(k.key), d, k.limit)
+	}
+}
+
+// succeed clears the failures and lockout history of username. The IP counter
+// is left to expire with the window, so a valid account cannot be used to
+// reset it while guessing others.
+func (l *authLimiter) succeed(username string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	delete(l.entries, "user:"+username)
+	l.mu.Unlock()
+}
+
+// prune drops failures older than window.
+func (e *authFailures) prune(now time.Time, window time.Duration) []time.Time {
+	i := 0
+	for i < len(e.failures) && now.Sub(e.failures[i]) > window {
+		i++
+	}
+	return e.failures[i:]
+}
+
+func (l *authLimiter) run() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		l.cleanup()
+	}
+}
+
+// cleanup forgets keys with no recent failure and no running lockout. The
+// lockout count is kept until the last lockout is a window old, so repeat
+// offenders keep escalating.
+func (l *authLimiter) cleanup() {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, e := range l.entries {
+		e.failures = e.prune(now, l.window)
+		if len(e.failures) == 0 && now.Sub(e.lockedUntil) > l.window {
+			delete(l.entries, key)
+		}
+	}
+}
+
+// maskAuthKey masks the username or address of a limiter key for logs.
+func maskAuthKey(key string) string {
+	kind, v, _ := strings.Cut(key, ":")
+	return kind + " " + utils.MaskString(v)
+}
+
+// authAllowed answers 429 with Retry-After when the client IP or username is
+// locked out, before any credential check is made.
+func authAllowed(ctx *gin.Context, username string) bool {
+	wait := authRateLimiter().blocked(ctx.ClientIP(), username)
+	if wait <= 0 {
+		return true
+	}
+	reqLog(ctx).DebugLog("Auth: refusing %s from %s, locked out for %v", utils.MaskString(username), utils.MaskString(ctx.ClientIP()), wait)
+	ctx.Header("Retry-After", strconv.Itoa(int(wait.Round(time.Second)/time.Second)+1))
+	abortJSON(ctx, http.StatusTooManyRequests, errCodeTooManyAttempts, "Too many failed login attempts, try again later")
+	return false
+}
+
+// authFailed records a failed login and logs it with masked credentials.
+func authFailed(ctx *gin.Context, username string) {
+	reqLog(ctx).WarnLog("Auth: failed login for %s from %s (%s)", utils.MaskString(username), utils.MaskString(ctx.ClientIP()), ctx.Request.URL.Path)
+	authRateLimiter().fail(ctx.ClientIP(), username)
+}
+
+// authSucceeded resets the failure counter of username.
+func authSucceeded(username string) { authRateLimiter().succeed(username) }
+
+// authRateLimitFeatures describes the limiter for the features endpoint.
+func authRateLimitFeatures() interface{} {
+	l := authRateLimiter()
+	if l == nil {
+		return false
+	}
+	t := l.thresholds()
+	return map[string]interface{}{
+		"window":       t.window.String(),
+		"max_per_ip":   t.maxPerIP,
+		"max_per_user": t.maxPerUser,
+		"lockout":      t.lockout.String(),
+		"max_lockout":  t.maxLockout.String(),
+	}
+}
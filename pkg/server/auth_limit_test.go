@@ -0,0 +1,74 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAuthLimiterSetThresholds(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxPerUser int
+		wantLocked int // failures after which the user is locked out, 0 never
+	}{
+		{"lower threshold", 2, 2},
+		{"higher threshold", 4, 4},
+		{"counter disabled", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &authLimiter{
+				authThresholds: authThresholds{window: time.Minute, maxPerUser: 3, lockout: time.Minute, maxLockout: time.Hour},
+				entries:        make(map[string]*authFailures),
+			}
+			next := l.thresholds()
+			next.maxPerUser = tt.maxPerUser
+			l.setThresholds(next)
+
+			for i := 1; i <= 5; i++ {
+				l.fail("192.0.2.1", "alice")
+				locked := l.blocked("192.0.2.2", "alice") > 0
+				if want := tt.wantLocked > 0 && i >= tt.wantLocked; locked != want {
+					t.Fatalf("after %d failures: locked = %v, want %v", i, locked, want)
+				}
+			}
+		})
+	}
+}
+
+func TestReloadAuthThresholds(t *testing.T) {
+	l := authRateLimiter()
+	if l == nil {
+		t.Skip("rate limiting disabled in this environment")
+	}
+	before := l.thresholds()
+	t.Cleanup(func() { l.setThresholds(before) })
+	// Restored after the test, as reload sets them process-wide
+	for _, k := range []string{"AUTH_FAILURE_WINDOW", "AUTH_MAX_FAILURES_PER_IP", "AUTH_MAX_FAILURES_PER_USER", "AUTH_LOCKOUT", "AUTH_MAX_LOCKOUT"} {
+		t.Setenv(k, "")
+	}
+
+	file := filepath.Join(t.TempDir(), "reload.env")
+	t.Setenv("RELOAD_ENV_FILE", file)
+	content := "AUTH_FAILURE_WINDOW=2m\nAUTH_MAX_FAILURES_PER_IP=7\nAUTH_MAX_FAILURES_PER_USER=2\nAUTH_LOCKOUT=30s\nAUTH_MAX_LOCKOUT=5m\n"
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	(&Config{}).reload()
+
+	want := authThresholds{window: 2 * time.Minute, maxPerIP: 7, maxPerUser: 2, lockout: 30 * time.Second, maxLockout: 5 * time.Minute}
+	if got := l.thresholds(); got != want {
+		t.Errorf("thresholds = %+v, want %+v", got, want)
+	}
+
+	// An invalid window keeps the limits in effect
+	if err := os.WriteFile(file, []byte("AUTH_FAILURE_WINDOW=0\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	(&Config{}).reload()
+	if got := l.thresholds(); got != want {
+		t.Errorf("after invalid reload: thresholds = %+v, want %+v", got, want)
+	}
+}
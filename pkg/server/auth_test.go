@@ -0,0 +1,45 @@
+package server
+
+import "testing"
+
+func TestValidAPIKey(t *testing.T) {
+	t.Setenv("INTERNAL_API_KEY", "primary-key")
+	t.Setenv("API_KEYS", "old-key, next-key")
+	key, keys := internalAPIKey, internalAPIKeys
+	t.Cleanup(func() { internalAPIKey, internalAPIKeys = key, keys })
+	internalAPIKey, internalAPIKeys = loadAPIKeys()
+
+	if GetAPIKey() != "primary-key" {
+		t.Errorf("GetAPIKey() = %q, want primary-key", GetAPIKey())
+	}
+	tests := []struct {
+		name, key string
+		want      bool
+	}{
+		{"primary key", "primary-key", true},
+		{"rotated secondary key", "old-key", true},
+		{"next secondary key", "next-key", true},
+		{"empty key", "", false},
+		{"wrong key", "primary-kez", false},
+		{"prefix of a key", "primary", false},
+		{"list as a key", "old-key, next-key", false},
+	}
+	for _, tt := range tests {
+		if got := validAPIKey(tt.key); got != tt.want {
+			t.Errorf("%s: validAPIKey(%q) = %v, want %v", tt.name, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestLoadAPIKeysPrimaryFromAPIKeys(t *testing.T) {
+	t.Setenv("INTERNAL_API_KEY", "")
+	t.Setenv("API_KEYS", " first-key ,second-key")
+	primary, keys := loadAPIKeys()
+	if primary != "first-key" {
+		t.Errorf("primary = %q, want first-key", primary)
+	}
+	// The primary key is hashed once for itself and once as an API_KEYS entry
+	if len(keys) != 3 {
+		t.Errorf("%d accepted key hashes, want 3", len(keys))
+	}
+}
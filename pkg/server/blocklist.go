@@ -0,0 +1,221 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package server
+
+import (
+	"bufio"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jamesnetherton/m3u"
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// blocklist holds the stream ids and categories that are never proxied.
+// BLOCKED_STREAM_IDS and BLOCKED_CATEGORIES are read once; BLOCKLIST_FILE is
+// read again whenever it changes, so lists can be edited without a restart.
+type blocklist struct {
+	mu         sync.Mutex
+	file       string
+	fileMod    time.Time
+	fileSize   int64
+	checked    time.Time
+	ids        map[string]bool
+	categories map[string]bool
+}
+
+// blocklistCheckEvery bounds how often BLOCKLIST_FILE is stat'ed.
+const blocklistCheckEvery = 5 * time.Second
+
+var (
+	streamBlocklistOnce sync.Once
+	streamBlocklist     *blocklist
+)
+
+// blockedStreams returns the shared blocklist, reloading BLOCKLIST_FILE when
+// it changed since the last look.
+func blockedStreams() *blocklist {
+	streamBlocklistOnce.Do(func() {
+		streamBlocklist = &blocklist{file: strings.TrimSpace(os.Getenv("BLOCKLIST_FILE"))}
+		streamBlocklist.load()
+		if n, m := streamBlocklist.counts(); n+m > 0 {
+			utils.InfoLog("Blocklist: %d stream ids and %d categories blocked", n, m)
+		}
+	})
+	streamBlocklist.refresh()
+	return streamBlocklist
+}
+
+// load rebuilds the lists from the environment and the file.
+func (b *blocklist) load() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ids := map[string]bool{}
+	categories := map[string]bool{}
+	for _, id := range strings.Split(os.Getenv("BLOCKED_STREAM_IDS"), ",") {
+		addBlockedID(ids, id)
+	}
+	for _, cat := range strings.Split(os.Getenv("BLOCKED_CATEGORIES"), ",") {
+		addBlockedCategory(categories, cat)
+	}
+	if b.file != "" {
+		if fi, err := os.Stat(b.file); err == nil {
+			b.fileMod, b.fileSize = fi.ModTime(), fi.Size()
+		} else {
+			b.fileMod, b.fileSize = time.Time{}, -1
+		}
+		if f, err := os.Open(b.file); err == nil {
+			sc := bufio.NewScanner(f)
+			for sc.Scan() {
+				line := strings.TrimSpace(sc.Text())
+				if line == "" || strings.HasPrefix(line, "#") {
+					continue
+				}
+				kind, value, ok := strings.Cut(line, ":")
+				switch strings.ToLower(strings.TrimSpace(kind)) {
+				case "id", "stream":
+					addBlockedID(ids, value)
+				case "category":
+					addBlockedCategory(categories, value)
+				default:
+					if !ok {
+						addBlockedID(ids, line) // a bare line is a stream id
+					} else {
+						utils.WarnLog("Blocklist: ignoring line %q in %s", line, b.file)
+					}
+				}
+			}
+			f.Close()
+		} else {
+			utils.WarnLog("Blocklist: cannot read BLOCKLIST_FILE %s: %v", b.file, err)
+		}
+	}
+	b.ids, b.categories = ids, categories
+}
+
+// refresh reloads the lists when BLOCKLIST_FILE was modified. Cached
+// playlists are dropped so the next request regenerates them.
+func (b *blocklist) refresh() {
+	if b.file == "" {
+		return
+	}
+	b.mu.Lock()
+	if time.Since(b.checked) < blocklistCheckEvery {
+		b.mu.Unlock()
+		return
+	}
+	b.checked = time.Now()
+	mod, size := time.Time{}, int64(-1)
+	if fi, err := os.Stat(b.file); err == nil {
+		mod, size = fi.ModTime(), fi.Size()
+	}
+	changed := !mod.Equal(b.fileMod) || size != b.fileSize
+	b.mu.Unlock()
+	if !changed {
+		return
+	}
+	b.load()
+	n, m := b.counts()
+	utils.InfoLog("Blocklist reloaded from %s: %d stream ids and %d categories blocked", b.file, n, m)
+	// Not inline: marshallInto may run with the playlist cache locked
+	go dropCachedXtreamM3u()
+}
+
+func (b *blocklist) counts() (int, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.ids), len(b.categories)
+}
+
+func addBlockedID(ids map[string]bool, id string) {
+	id = strings.TrimSpace(id)
+	id = strings.TrimSuffix(id, path.Ext(id))
+	if id != "" {
+		ids[id] = true
+	}
+}
+
+func addBlockedCategory(categories map[string]bool, cat string) {
+	if cat = strings.ToLower(strings.TrimSpace(cat)); cat != "" {
+		categories[cat] = true
+	}
+}
+
+// streamBlocked reports whether a stream id, with or without its container
+// extension, is blocked.
+func (b *blocklist) streamBlocked(id string) bool {
+	base := path.Base(id)
+	id = strings.TrimSuffix(base, path.Ext(base))
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.ids[id]
+}
+
+// categoryBlocked reports whether a category is blocked by id or by name
+// (case-insensitive).
+func (b *blocklist) categoryBlocked(id, name string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.categories) == 0 {
+		return false
+	}
+	return b.categories[strings.ToLower(strings.TrimSpace(id))] || b.categories[strings.ToLower(strings.TrimSpace(name))]
+}
+
+// refuseBlockedStream answers 403 when id is blocked and reports whether it did.
+func refuseBlockedStream(ctx *gin.Context, id string) bool {
+	if id == "" || !blockedStreams().streamBlocked(id) {
+		return false
+	}
+	reqLog(ctx).WarnLog("Refused blocked stream %s for %s", id, ctx.ClientIP())
+	abortJSON(ctx, http.StatusForbidden, errCodeStreamBlocked, "stream "+strings.TrimSuffix(id, path.Ext(id))+" is blocked on this server")
+	return true
+}
+
+// rejectBlockedStreams is route middleware refusing blocked stream ids in the
+// named path params, before cached files or upstream are looked at.
+func rejectBlockedStreams(params ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		for _, name := range params {
+			if refuseBlockedStream(ctx, ctx.Param(name)) {
+				return
+			}
+		}
+		ctx.Next()
+	}
+}
+
+// trackBlocked reports whether a playlist track points to a blocked stream
+// or belongs to a blocked category (its group-title).
+func (b *blocklist) trackBlocked(track m3u.Track) bool {
+	if u, err := url.Parse(track.URI); err == nil && b.streamBlocked(u.Path) {
+		return true
+	}
+	for _, tag := range track.Tags {
+		if tag.Name == "group-title" && b.categoryBlocked("", tag.Value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/lucasduport/stream-share/pkg/database"
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// defaultCacheDirName is the directory under the system temp dir used when
+// CACHE_FOLDER is unset.
+const defaultCacheDirName = "stream-share-cache"
+
+var (
+	cacheDirOnce sync.Once
+	cacheDirPath string
+	cacheDirErr  error
+)
+
+// cacheDir returns the directory holding cached media, recordings and the VOD
+// M3U cache. It is resolved, created and checked for writability once.
+func cacheDir() string {
+	cacheDirOnce.Do(func() { cacheDirPath, cacheDirErr = resolveCacheDir() })
+	return cacheDirPath
+}
+
+// cacheFileName returns the name under cacheDir of a cached file of
+// provider. Files of the default provider keep the bare name; others are
+// prefixed with the provider key, so the same stream id from two providers
+// never shares a file.
+func cacheFileName(provider, name string) string {
+	if provider == "" || provider == database.DefaultProvider {
+		return name
+	}
+	return provider + "_" + name
+}
+
+// initCacheDir resolves the cache directory at startup. It only fails when
+// CACHE_FOLDER_STRICT=true and CACHE_FOLDER cannot be used.
+func initCacheDir() error {
+	cacheDir()
+	return cacheDirErr
+}
+
+func resolveCacheDir() (string, error) {
+	def := filepath.Join(os.TempDir(), defaultCacheDirName)
+	dir := strings.TrimSpace(os.Getenv("CACHE_FOLDER"))
+	if dir == "" {
+		dir = def
+	}
+	resolved, err := prepareCacheDir(dir)
+	if err == nil {
+		utils.InfoLog("Cache folder: %s", resolved)
+		return resolved, nil
+	}
+	if envFlag("CACHE_FOLDER_STRICT", false) {
+		return "", fmt.Errorf("cache folder %q is not usable: %w", dir, err)
+	}
+	if dir != def {
+		utils.WarnLog("Cache folder %q is not usable (%v), falling back to %s", dir, err, def)
+		if resolved, err = prepareCacheDir(def); err == nil {
+			return resolved, nil
+		}
+	}
+	utils.ErrorLog("Cache folder %q is not usable: %v", def, err)
+	return def, nil
+}
+
+// prepareCacheDir makes dir absolute, creates it, resolves symlinks and checks
+// that files can be created in it.
+func prepareCacheDir(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(abs, 0o755); err != nil {
+		return "", err
+	}
+	if real, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = real
+	}
+	f, err := os.CreateTemp(abs, ".write-check-*")
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return abs, nil
+}
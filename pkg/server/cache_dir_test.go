@@ -0,0 +1,126 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/lucasduport/stream-share/pkg/config"
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// resetCacheDir makes the next cacheDir call resolve CACHE_FOLDER again.
+func resetCacheDir(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		cacheDirOnce = sync.Once{}
+		cacheDirPath, cacheDirErr = "", nil
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestResolveCacheDir(t *testing.T) {
+	root := t.TempDir()
+	target := filepath.Join(root, "real")
+	if err := os.Mkdir(target, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	notADir := filepath.Join(root, "file")
+	if err := os.WriteFile(notADir, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	def, err := filepath.EvalSymlinks(os.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	def = filepath.Join(def, defaultCacheDirName)
+
+	tests := []struct {
+		name, folder, strict string
+		want                 string
+		wantErr              bool
+	}{
+		{name: "default", want: def},
+		{name: "symlink resolved", folder: filepath.Join(root, "link"), want: target},
+		{name: "unclean path", folder: root + "/link/../real/", want: target},
+		{name: "created when missing", folder: filepath.Join(root, "new", "cache"), want: filepath.Join(target, "..", "new", "cache")},
+		{name: "unusable falls back", folder: filepath.Join(notADir, "cache"), want: def},
+		{name: "unusable strict", folder: filepath.Join(notADir, "cache"), strict: "true", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CACHE_FOLDER", tt.folder)
+			t.Setenv("CACHE_FOLDER_STRICT", tt.strict)
+			got, err := resolveCacheDir()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("resolveCacheDir = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != filepath.Clean(tt.want) {
+				t.Errorf("resolveCacheDir = %q, want %q", got, filepath.Clean(tt.want))
+			}
+			if st, err := os.Stat(got); err != nil || !st.IsDir() {
+				t.Errorf("%s was not created: %v", got, err)
+			}
+		})
+	}
+}
+
+// TestCacheConsumersShareDir checks that the media cache, the VOD playlist
+// cache, the logo key and the reported folder all live in the one resolved
+// directory, whatever form CACHE_FOLDER was given in.
+func TestCacheConsumersShareDir(t *testing.T) {
+	resetCacheDir(t)
+	root := t.TempDir()
+	target := filepath.Join(root, "real")
+	if err := os.Mkdir(target, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CACHE_FOLDER", root+"/link/./")
+	t.Setenv("LOGO_SIGNING_KEY", "")
+	// A fresh playlist is used as is, without any download
+	if err := os.WriteFile(filepath.Join(target, "vod_cache.m3u"), []byte("#EXTM3U\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Config{ProxyConfig: &config.ProxyConfig{
+		HostConfig:         &config.HostConfiguration{Hostname: "iptv.example", Port: 8080},
+		XtreamBaseURL:      "http://provider.example",
+		M3UCacheExpiration: 1,
+	}}
+	if got := cacheDir(); got != target {
+		t.Fatalf("cacheDir = %q, want %q", got, target)
+	}
+	m3u, err := c.ensureVODM3UCache(utils.RequestLogger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, media := c.cacheTarget(utils.RequestLogger{}, "movie", cacheDir(), "42.mkv")
+	loadLogoSigningKey()
+	consumers := map[string]string{
+		"vod playlist": filepath.Dir(m3u),
+		"media cache":  filepath.Dir(media),
+		"features":     c.effectiveFeatures()["cache"].(map[string]interface{})["folder"].(string),
+	}
+	if _, err := os.Stat(filepath.Join(target, ".logo-signing-key")); err != nil {
+		t.Errorf("logo signing key not stored in the cache folder: %v", err)
+	}
+	for name, dir := range consumers {
+		if dir != target {
+			t.Errorf("%s uses %q, want %q", name, dir, target)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/lucasduport/stream-share/pkg/types"
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// addSizeFields adds a human-readable twin of every byte count a cache
+// response carries. The raw *_bytes fields stay for programmatic consumers.
+func addSizeFields(out map[string]interface{}, downloaded, total, size int64) {
+	out["downloaded_human"] = utils.HumanBytes(downloaded)
+	if total > 0 {
+		out["total_human"] = utils.HumanBytes(total)
+	}
+	// size_human is the best known size of the whole file
+	switch {
+	case size > 0:
+		out["size_human"] = utils.HumanBytes(size)
+	case total > 0:
+		out["size_human"] = utils.HumanBytes(total)
+	default:
+		out["size_human"] = utils.HumanBytes(downloaded)
+	}
+}
+
+// addDurationField sets duration_seconds when it is known without ffprobe:
+// from the mvhd header of an MP4 on disk, or else (when withM3U) from the
+// #EXTINF length of the already cached VOD playlist.
+func (c *Config) addDurationField(out map[string]interface{}, e *types.VODCacheEntry, withM3U bool) {
+	if secs := cachedFileDuration(e.FilePath); secs > 0 {
+		out["duration_seconds"] = secs
+		return
+	}
+	if !withM3U {
+		return
+	}
+	// Only read a playlist that is already there; never fetch one for this
+	m3uPath := filepath.Join(cacheDir(), "vod_cache.m3u")
+	if _, err := os.Stat(m3uPath); err != nil {
+		return
+	}
+	basePath := "movie"
+	if strings.EqualFold(e.Type, "series") {
+		basePath = "series"
+	}
+	if secs := findDurationInM3U(m3uPath, basePath, e.StreamID); secs > 0 {
+		out["duration_seconds"] = secs
+	}
+}
+
+// cachedFileDuration returns the duration in seconds of the cached file, or
+// of its .part while downloading, when it is an MP4 with a readable moov.
+func cachedFileDuration(filePath string) int64 {
+	if filePath == "" {
+		return 0
+	}
+	for _, p := range []string{filePath, filePath + ".part"} {
+		f, err := os.Open(p)
+		if err != nil {
+			continue
+		}
+		st, err := f.Stat()
+		secs := int64(0)
+		if err == nil {
+			secs = mp4Duration(f, st.Size())
+		}
+		f.Close()
+		return secs
+	}
+	return 0
+}
+
+// mp4Duration reads the movie duration from moov/mvhd. It only walks box
+// headers, so a moov-at-end file costs a few reads, not a scan of mdat.
+func mp4Duration(r io.ReaderAt, size int64) int64 {
+	moov, moovEnd, ok := findMP4Box(r, 0, size, "moov")
+	if !ok {
+		return 0
+	}
+	mvhd, _, ok := findMP4Box(r, moov, moovEnd, "mvhd")
+	if !ok {
+		return 0
+	}
+	// version(1) flags(3), then creation/modification times, timescale, duration
+	buf := make([]byte, 32)
+	if _, err := r.ReadAt(buf[:1], mvhd); err != nil {
+		return 0
+	}
+	var timescale, duration uint64
+	if buf[0] == 1 {
+		if mvhd+32 > moovEnd {
+			return 0
+		}
+		if _, err := r.ReadAt(buf, mvhd); err != nil {
+			return 0
+		}
+		timescale = uint64(binary.BigEndian.Uint32(buf[20:24]))
+		duration = binary.BigEndian.Uint64(buf[24:32])
+	} else {
+		if mvhd+20 > moovEnd {
+			return 0
+		}
+		if _, err := r.ReadAt(buf[:20], mvhd); err != nil {
+			return 0
+		}
+		timescale = uint64(binary.BigEndian.Uint32(buf[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(buf[16:20]))
+	}
+	if timescale == 0 || duration == 0 || duration == 0xffffffff || duration == ^uint64(0) {
+		return 0
+	}
+	return int64(duration / timescale)
+}
+
+// findMP4Box looks for a box of the given type among the boxes between off
+// and end, returning the range of its payload.
+func findMP4Box(r io.ReaderAt, off, end int64, boxType string) (int64, int64, bool) {
+	hdr := make([]byte, 16)
+	for off+8 <= end {
+		if _, err := r.ReadAt(hdr[:8], off); err != nil {
+			return 0, 0, false
+		}
+		boxSize := int64(binary.BigEndian.Uint32(hdr[:4]))
+		headerLen := int64(8)
+		switch boxSize {
+		case 0: // runs to the end of the enclosing range
+			boxSize = end - off
+		case 1:
+			if off+16 > end {
+				return 0, 0, false
+			}
+			if _, err := r.ReadAt(hdr[8:16], off+8); err != nil {
+				return 0, 0, false
+			}
+			boxSize = int64(binary.BigEndian.Uint64(hdr[8:16]))
+			headerLen = 16
+		}
+		if boxSize < headerLen {
+			return 0, 0, false
+		}
+		if string(hdr[4:8]) == boxType {
+			if off+boxSize > end {
+				return 0, 0, false // still being written
+			}
+			return off + headerLen, off + boxSize, true
+		}
+		off += boxSize
+	}
+	return 0, 0, false
+}
+
+// findDurationInM3U returns the #EXTINF length, in seconds, of the entry for
+// streamID. VOD playlists often carry -1 or 0 there, which yields 0.
+func findDurationInM3U(filePath, basePath, streamID string) int64 {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	var lastLength int64
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#EXTINF:") {
+			rest := line[len("#EXTINF:"):]
+			if i := strings.IndexAny(rest, " ,"); i != -1 {
+				rest = rest[:i]
+			}
+			lastLength = 0
+			if n, err := strconv.ParseFloat(rest, 64); err == nil && n > 0 {
+				lastLength = int64(n)
+			}
+			continue
+		}
+		if !(strings.HasPrefix(line, "http://") || strings.HasPrefix(line, "https://")) {
+			continue
+		}
+		if !strings.Contains(line, "/"+basePath+"/") {
+			lastLength = 0
+			continue
+		}
+		u, err := url.Parse(line)
+		if err == nil && strings.HasPrefix(path.Base(u.Path), streamID+".") {
+			return lastLength
+		}
+		lastLength = 0
+	}
+	return 0
+}
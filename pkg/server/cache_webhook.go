@@ -0,0 +1,177 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// cacheEvent is the body POSTed to CACHE_WEBHOOK_URL when a cache download
+// ends.
+type cacheEvent struct {
+	StreamID      string    `json:"stream_id"`
+	Type          string    `json:"type,omitempty"`
+	Title         string    `json:"title"`
+	Status        string    `json:"status"`
+	RequestedBy   string    `json:"requested_by"`
+	Bytes         int64     `json:"bytes"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	FailureReason string    `json:"failure_reason,omitempty"`
+}
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+var (
+	readyDMMu   sync.Mutex
+	readyDMSent = make(map[string]time.Time) // streamID|user -> expiry of the announced cache
+)
+
+// cacheWebhookURL reads CACHE_WEBHOOK_URL; empty turns notifications off.
+func cacheWebhookURL() string {
+	return strings.TrimSpace(os.Getenv("CACHE_WEBHOOK_URL"))
+}
+
+// notifyCacheDone reports the end of a cache download ("ready" or "failed")
+// to CACHE_WEBHOOK_URL. Title, requester and expiry come from the stored
+// entry. Delivery runs in its own goroutine, so the download never waits on it.
+func (c *Config) notifyCacheDone(streamID, status, reason string, size int64) {
+	hook := cacheWebhookURL()
+	if hook == "" {
+		return
+	}
+	ev := cacheEvent{StreamID: streamID, Status: status, Bytes: size, FailureReason: reason}
+	if c.db != nil {
+		if e, err := c.db.GetVODCache(c.db.Provider(), streamID); err == nil && e != nil {
+			ev.Type, ev.Title, ev.RequestedBy, ev.ExpiresAt = e.Type, e.Title, e.RequestedBy, e.ExpiresAt
+			if ev.Bytes == 0 {
+				ev.Bytes = e.DownloadedBytes // how far a failed download got
+			}
+		}
+	}
+	go deliverCacheWebhook(hook, ev)
+}
+
+// deliverCacheWebhook POSTs ev, retrying CACHE_WEBHOOK_RETRIES times (default
+// 3) with a doubling delay on network errors and non-2xx answers.
+func deliverCacheWebhook(hook string, ev cacheEvent) {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		utils.ErrorLog("Cache webhook: encode event for %s: %v", ev.StreamID, err)
+		return
+	}
+	retries := envCount("CACHE_WEBHOOK_RETRIES", 3)
+	delay := 2 * time.Second
+	for attempt := 0; ; attempt++ {
+		err = postCacheWebhook(hook, body)
+		if err == nil {
+			utils.DebugLog("Cache webhook: delivered %s event for %s", ev.Status, ev.StreamID)
+			return
+		}
+		if attempt >= retries {
+			utils.WarnLog("Cache webhook: giving up on %s event for %s after %d attempts: %v", ev.Status, ev.StreamID, attempt+1, err)
+			return
+		}
+		utils.DebugLog("Cache webhook: attempt %d for %s failed: %v", attempt+1, ev.StreamID, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func postCacheWebhook(hook string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, hook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "stream-share")
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// notifyReadyDM has the Discord bot DM the user who requested a cache once it
+// is ready (CACHE_READY_DM, default true). The DM carries a /download link
+// served from the cache. A cache is announced once per requester until it
+// expires, however many attempts the download took.
+func (c *Config) notifyReadyDM(streamID, upstream string) {
+	if c.discordBot == nil || c.db == nil || c.sessionManager == nil || !envFlag("CACHE_READY_DM", true) {
+		return
+	}
+	e, err := c.db.GetVODCache(c.db.Provider(), streamID)
+	if err != nil || e == nil || e.RequestedBy == "" {
+		return // started by a player, nobody to tell
+	}
+	key := streamID + "|" + e.RequestedBy
+	now := time.Now()
+	readyDMMu.Lock()
+	for k, exp := range readyDMSent {
+		if exp.Before(now) {
+			delete(readyDMSent, k)
+		}
+	}
+	if _, sent := readyDMSent[key]; sent {
+		readyDMMu.Unlock()
+		utils.DebugLog("Cache ready DM for %s already sent to %s", streamID, e.RequestedBy)
+		return
+	}
+	readyDMSent[key] = e.ExpiresAt
+	readyDMMu.Unlock()
+
+	discordID, _, err := c.db.GetDiscordByLDAPUser(e.RequestedBy)
+	if err != nil || discordID == "" {
+		utils.DebugLog("Cache ready DM for %s skipped: %s has no linked Discord account", streamID, e.RequestedBy)
+		return
+	}
+	title := e.Title
+	if e.SeriesTitle != "" && e.Episode > 0 {
+		title = fmt.Sprintf("%s — S%02dE%02d", e.SeriesTitle, e.Season, e.Episode)
+	}
+	if title == "" {
+		title = streamID
+	}
+	token, err := c.sessionManager.GenerateTemporaryLink(e.RequestedBy, streamID, title, upstream)
+	if err != nil {
+		utils.WarnLog("Cache ready DM for %s: could not create a link: %v", streamID, err)
+		return
+	}
+	linkExpires := now.Add(24 * time.Hour)
+	if link, err := c.sessionManager.GetTemporaryLink(token); err == nil {
+		linkExpires = link.ExpiresAt
+	}
+	playURL := c.downloadBaseURL() + "/download/" + token
+	go func() {
+		if err := c.discordBot.NotifyCacheReady(discordID, streamID, title, playURL, linkExpires, e.ExpiresAt); err != nil {
+			utils.WarnLog("Cache ready DM for %s to %s failed: %v", streamID, e.RequestedBy, err)
+		}
+	}()
+}
@@ -0,0 +1,130 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package server
+
+import (
+	"os"
+	"strings"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// internalAPIPrefix is the path of the route group holding the admin, VOD and
+// cache endpoints, which get the strict CORS policy.
+const internalAPIPrefix = "/api/internal"
+
+// corsPolicy is one CORS configuration read from the environment.
+type corsPolicy struct {
+	origins     []string // "*" allows every origin; empty allows none
+	methods     []string
+	headers     []string
+	credentials bool
+}
+
+// publicCORSPolicy applies to playlists and streams. It defaults to any
+// origin, as cors.Default() did, so web players keep working.
+func publicCORSPolicy() corsPolicy {
+	return corsPolicy{
+		origins:     envList("CORS_ALLOWED_ORIGINS", []string{"*"}),
+		methods:     envList("CORS_ALLOWED_METHODS", []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD"}),
+		headers:     envList("CORS_ALLOWED_HEADERS", []string{"Origin", "Content-Length", "Content-Type"}),
+		credentials: envFlag("CORS_ALLOW_CREDENTIALS", false),
+	}
+}
+
+// internalCORSPolicy applies to the internal API. It defaults to no origin at
+// all: browsers may only call it from pages served by the proxy itself.
+func internalCORSPolicy() corsPolicy {
+	return corsPolicy{
+		origins:     envList("CORS_INTERNAL_ALLOWED_ORIGINS", nil),
+		methods:     envList("CORS_INTERNAL_ALLOWED_METHODS", []string{"GET", "POST", "DELETE"}),
+		headers:     envList("CORS_INTERNAL_ALLOWED_HEADERS", []string{"Origin", "Content-Length", "Content-Type", "X-API-Key"}),
+		credentials: envFlag("CORS_INTERNAL_ALLOW_CREDENTIALS", false),
+	}
+}
+
+// envList reads a comma-separated list from key, def when unset.
+func envList(key string, def []string) []string {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return def
+	}
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// config turns the policy into a gin-contrib/cors configuration. Origins the
+// library would reject are dropped with a warning instead of panicking.
+func (p corsPolicy) config(name string) cors.Config {
+	cfg := cors.DefaultConfig()
+	cfg.AllowMethods = p.methods
+	cfg.AllowHeaders = p.headers
+	cfg.AllowCredentials = p.credentials
+
+	var origins []string
+	for _, o := range p.origins {
+		switch {
+		case o == "*":
+			cfg.AllowAllOrigins = true
+			return cfg
+		case strings.Count(o, "*") > 1:
+			utils.WarnLog("Ignoring %s origin %q: only one * is allowed", name, o)
+		case strings.Contains(o, "*"):
+			cfg.AllowWildcard = true
+			origins = append(origins, o)
+		case strings.HasPrefix(o, "http://") || strings.HasPrefix(o, "https://"):
+			origins = append(origins, strings.TrimSuffix(o, "/"))
+		default:
+			utils.WarnLog("Ignoring %s origin %q: it must start with http:// or https://", name, o)
+		}
+	}
+	if len(origins) == 0 {
+		// Every cross-origin request is refused with 403
+		cfg.AllowOriginFunc = func(string) bool { return false }
+		return cfg
+	}
+	cfg.AllowOrigins = origins
+	return cfg
+}
+
+// corsMiddleware applies the internal policy under /api/internal and the
+// public one everywhere else. It is installed on the engine rather than on
+// the route groups so preflight requests, which match no route, get it too.
+func corsMiddleware() gin.HandlerFunc {
+	public := cors.New(publicCORSPolicy().config("CORS_ALLOWED_ORIGINS"))
+	internal := cors.New(internalCORSPolicy().config("CORS_INTERNAL_ALLOWED_ORIGINS"))
+	return func(ctx *gin.Context) {
+		origin := ctx.GetHeader("Origin")
+		// Same-origin requests may carry Origin too; they are not CORS
+		if origin == "" || origin == "http://"+ctx.Request.Host || origin == "https://"+ctx.Request.Host {
+			return
+		}
+		if strings.HasPrefix(ctx.Request.URL.Path, internalAPIPrefix) {
+			internal(ctx)
+			return
+		}
+		public(ctx)
+	}
+}
@@ -0,0 +1,174 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"html/template"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// dashboardEnabled reports whether /api/internal/admin/dashboard is served (ADMIN_DASHBOARD, default false).
+func dashboardEnabled() bool { return envFlag("ADMIN_DASHBOARD", false) }
+
+// dashboardAuth accepts the API key from X-API-Key or, since a browser can't
+// set headers when opening a page, from the ?key= query parameter.
+func dashboardAuth(ctx *gin.Context) {
+	key := ctx.GetHeader("X-API-Key")
+	if key == "" {
+		key = ctx.Query("key")
+	}
+	if !validAPIKey(key) {
+		reqLog(ctx).DebugLog("Dashboard authentication failed - invalid key: %s", utils.MaskString(key))
+		abortJSON(ctx, http.StatusUnauthorized, errCodeUnauthorized, "Invalid API key")
+		return
+	}
+	ctx.Set("dashboard_key", key)
+	ctx.Next()
+}
+
+// adminDashboard renders the overview as an HTML page that refreshes itself
+// from /api/internal/admin/overview.
+func (c *Config) adminDashboard(ctx *gin.Context) {
+	if c.sessionManager == nil {
+		ctx.String(http.StatusInternalServerError, "Session manager not initialized")
+		return
+	}
+	ctx.Header("Content-Type", "text/html; charset=utf-8")
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Header("Referrer-Policy", "no-referrer")
+	data := struct {
+		Key      string
+		Overview map[string]interface{}
+	}{ctx.GetString("dashboard_key"), c.overviewData()}
+	if err := dashboardTemplate.Execute(ctx.Writer, data); err != nil {
+		reqLog(ctx).ErrorLog("Dashboard render error: %v", err)
+	}
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"human": func(n int64) string { return utils.HumanBytes(n) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>StreamShare status</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+h2 { margin-top: 1.5em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: 4px 8px; border-bottom: 1px solid #ddd; }
+progress { width: 12em; }
+.muted { color: #888; }
+.ERROR { color: #b00; }
+.WARN { color: #a60; }
+</style>
+</head>
+<body>
+<h1>StreamShare status</h1>
+<p class="muted">Users: <span id="users">{{.Overview.users_count}}</span> &middot; Recordings: <span id="recordings">{{.Overview.recordings}}</span> &middot; New streams blocked: <span id="blocked">{{.Overview.streams_blocked}}</span> &middot; Updated <span id="updated">now</span></p>
+
+<h2>Active streams</h2>
+<table>
+<thead><tr><th>Title</th><th>Type</th><th>Viewers</th><th>Duration</th></tr></thead>
+<tbody id="streams">
+{{range .Overview.streams}}<tr><td>{{or .stream_title .stream_id}}</td><td>{{.stream_type}}</td><td>{{len .viewers}}</td><td>{{.duration}}</td></tr>
+{{else}}<tr><td colspan="4" class="muted">No active streams</td></tr>
+{{end}}</tbody>
+</table>
+
+<h2>Downloads</h2>
+<table>
+<thead><tr><th>Title</th><th>Requested by</th><th>Progress</th><th></th></tr></thead>
+<tbody id="downloads">
+{{range .Overview.downloads}}<tr><td>{{or .title .stream_id}}</td><td>{{.requested_by}}</td><td><progress max="100" value="{{printf "%.0f" .percent}}"></progress></td><td>{{human .downloaded_bytes}}</td></tr>
+{{else}}<tr><td colspan="4" class="muted">No downloads running</td></tr>
+{{end}}</tbody>
+</table>
+
+<h2>Recent errors</h2>
+<table>
+<thead><tr><th>Time</th><th>Level</th><th>Message</th></tr></thead>
+<tbody id="errors">
+{{range .Overview.recent_errors}}<tr><td>{{.Time.Format "2006-01-02 15:04:05"}}</td><td class="{{.Level}}">{{.Level}}</td><td>{{.Message}}</td></tr>
+{{else}}<tr><td colspan="3" class="muted">Nothing logged</td></tr>
+{{end}}</tbody>
+</table>
+
+<script>
+const key = {{.Key}};
+
+function row(cells, cls) {
+	const tr = document.createElement("tr");
+	cells.forEach((c, i) => {
+		const td = document.createElement("td");
+		if (c instanceof Node) td.appendChild(c); else td.textContent = c;
+		if (cls && cls[i]) td.className = cls[i];
+		tr.appendChild(td);
+	});
+	return tr;
+}
+
+function fill(id, rows, empty, cols) {
+	const body = document.getElementById(id);
+	body.replaceChildren();
+	if (rows.length === 0) {
+		const tr = row([empty], ["muted"]);
+		tr.firstChild.colSpan = cols;
+		body.appendChild(tr);
+	}
+	rows.forEach(r => body.appendChild(r));
+}
+
+function human(n) {
+	const units = ["B", "KB", "MB", "GB", "TB"];
+	let i = 0;
+	while (n >= 1024 && i < units.length - 1) { n /= 1024; i++; }
+	return n.toFixed(i ? 1 : 0) + " " + units[i];
+}
+
+async function refresh() {
+	try {
+		const res = await fetch("overview", { headers: { "X-API-Key": key } });
+		if (!res.ok) return;
+		const d = (await res.json()).data;
+		document.getElementById("users").textContent = d.users_count;
+		document.getElementById("recordings").textContent = d.recordings;
+		document.getElementById("blocked").textContent = d.streams_blocked;
+		document.getElementById("updated").textContent = new Date().toLocaleTimeString();
+		fill("streams", d.streams.map(s => row([s.stream_title || s.stream_id, s.stream_type, s.viewers.length, s.duration])), "No active streams", 4);
+		fill("downloads", d.downloads.map(x => {
+			const p = document.createElement("progress");
+			p.max = 100;
+			p.value = x.percent;
+			return row([x.title || x.stream_id, x.requested_by || "", p, human(x.downloaded_bytes)]);
+		}), "No downloads running", 4);
+		fill("errors", d.recent_errors.map(e => row([new Date(e.time).toLocaleString(), e.level, e.message], [null, e.level])), "Nothing logged", 3);
+	} catch (e) {
+		document.getElementById("updated").textContent = "failed (" + e + ")";
+	}
+}
+
+setInterval(refresh, 5000);
+</script>
+</body>
+</html>
+`))
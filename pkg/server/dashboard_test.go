@@ -0,0 +1,134 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucasduport/stream-share/pkg/session"
+	"github.com/lucasduport/stream-share/pkg/types"
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// dashboardConfig starts a stream on a new session manager, logs an error and
+// sets the API key to "dashboard-key".
+func dashboardConfig(t *testing.T) *Config {
+	t.Helper()
+	t.Setenv("INTERNAL_API_KEY", "dashboard-key")
+	t.Setenv("API_KEYS", "")
+	key, keys := internalAPIKey, internalAPIKeys
+	t.Cleanup(func() { internalAPIKey, internalAPIKeys = key, keys })
+	internalAPIKey, internalAPIKeys = loadAPIKeys()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for {
+			if _, err := w.Write(make([]byte, 512)); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(5 * time.Millisecond):
+			}
+		}
+	}))
+	t.Cleanup(upstream.Close)
+	streamURL, _ := url.Parse(upstream.URL + "/live/u/p/7.ts")
+
+	sm := session.NewSessionManager(nil)
+	t.Cleanup(func() { sm.StopStream("7") })
+	if _, err := sm.RequestStream(context.Background(), "alice", "7", "live", "Dashboard News", streamURL); err != nil {
+		t.Fatal(err)
+	}
+	utils.ErrorLog("dashboard test: upstream refused the login")
+	return &Config{sessionManager: sm}
+}
+
+func TestAdminDashboard(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c := dashboardConfig(t)
+	r := gin.New()
+	r.GET("/api/internal/admin/dashboard", dashboardAuth, c.adminDashboard)
+
+	get := func(target, header string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if header != "" {
+			req.Header.Set("X-API-Key", header)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	for _, tt := range []struct {
+		name, target, header string
+	}{
+		{"missing key", "/api/internal/admin/dashboard", ""},
+		{"wrong header key", "/api/internal/admin/dashboard", "wrong-key"},
+		{"wrong query key", "/api/internal/admin/dashboard?key=wrong-key", ""},
+	} {
+		if w := get(tt.target, tt.header); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: status %d, want 401", tt.name, w.Code)
+		}
+	}
+
+	if w := get("/api/internal/admin/dashboard", "dashboard-key"); w.Code != http.StatusOK {
+		t.Errorf("X-API-Key: status %d, want 200", w.Code)
+	}
+	w := get("/api/internal/admin/dashboard?key=dashboard-key", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("?key=: status %d, want 200", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Content-Type = %q, want text/html", ct)
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		"<td>Dashboard News</td><td>live</td><td>1</td>",
+		"dashboard test: upstream refused the login",
+		`const key = "dashboard-key";`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("dashboard is missing %q", want)
+		}
+	}
+}
+
+// The handler only lists downloads from the database, so render the overview
+// with a downloading cache entry directly.
+func TestAdminDashboardDownloads(t *testing.T) {
+	c := dashboardConfig(t)
+	overview := c.overviewData()
+	overview["downloads"] = downloadsOverview([]types.VODCacheEntry{
+		{StreamID: "42", Title: "Heat", RequestedBy: "bob", Status: "downloading", DownloadedBytes: 3 << 20, TotalBytes: 4 << 20},
+		{StreamID: "43", Title: "Ronin", RequestedBy: "bob", Status: "complete", DownloadedBytes: 4 << 20, TotalBytes: 4 << 20},
+	})
+
+	var buf bytes.Buffer
+	data := struct {
+		Key      string
+		Overview map[string]interface{}
+	}{"dashboard-key", overview}
+	if err := dashboardTemplate.Execute(&buf, data); err != nil {
+		t.Fatal(err)
+	}
+	body := buf.String()
+	for _, want := range []string{
+		"<td>Dashboard News</td>",
+		`<td>Heat</td><td>bob</td><td><progress max="100" value="75"></progress></td><td>` + utils.HumanBytes(3<<20) + "</td>",
+		"dashboard test: upstream refused the login",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("dashboard is missing %q", want)
+		}
+	}
+	if strings.Contains(body, "Ronin") {
+		t.Error("a finished download is listed")
+	}
+}
@@ -0,0 +1,111 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// downloadLimits guards cache downloads against entries that never end, such
+// as live channels listed as movies by the provider.
+type downloadLimits struct {
+	maxBytes    int64         // VOD_MAX_BYTES, 0 = unlimited
+	maxDuration time.Duration // VOD_MAX_DURATION, only without a known size; 0 = unlimited
+	started     time.Time
+}
+
+// errDownloadLimit aborts a download that went over one of its limits. It is
+// never retried.
+type errDownloadLimit struct{ reason string }
+
+func (e errDownloadLimit) Error() string { return e.reason }
+
+// vodDownloadLimits reads the limits of a download starting now.
+func vodDownloadLimits() *downloadLimits {
+	l := &downloadLimits{started: time.Now()}
+	if v := strings.TrimSpace(os.Getenv("VOD_MAX_BYTES")); v != "" {
+		if n, err := parseByteSize(v); err == nil && n >= 0 {
+			l.maxBytes = n
+		} else {
+			utils.WarnLog("Invalid VOD_MAX_BYTES: %s", v)
+		}
+	}
+	if v := strings.TrimSpace(os.Getenv("VOD_MAX_DURATION")); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			l.maxDuration = d
+		} else if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			l.maxDuration = time.Duration(n) * time.Second
+		} else {
+			utils.WarnLog("Invalid VOD_MAX_DURATION: %s", v)
+		}
+	}
+	return l
+}
+
+// check returns an errDownloadLimit once downloaded goes over the size cap,
+// or once the time budget is spent on a download whose size upstream never
+// advertised.
+func (l *downloadLimits) check(downloaded int64, sized bool) error {
+	if l == nil {
+		return nil
+	}
+	if l.maxBytes > 0 && downloaded > l.maxBytes {
+		return errDownloadLimit{fmt.Sprintf("exceeded VOD_MAX_BYTES (%s > %s)", utils.HumanBytes(downloaded), utils.HumanBytes(l.maxBytes))}
+	}
+	if !sized && l.maxDuration > 0 {
+		if spent := time.Since(l.started); spent > l.maxDuration {
+			return errDownloadLimit{fmt.Sprintf("exceeded VOD_MAX_DURATION without Content-Length (%v, %s downloaded)", spent.Round(time.Second), utils.HumanBytes(downloaded))}
+		}
+	}
+	return nil
+}
+
+// parseByteSize parses a byte count with an optional K, M, G or T suffix
+// (powers of 1024), e.g. "50G" or "53687091200".
+func parseByteSize(v string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(v))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+	mult := int64(1)
+	if n := len(s); n > 0 {
+		switch s[n-1] {
+		case 'K':
+			mult = 1 << 10
+		case 'M':
+			mult = 1 << 20
+		case 'G':
+			mult = 1 << 30
+		case 'T':
+			mult = 1 << 40
+		}
+		if mult > 1 {
+			s = strings.TrimSpace(s[:n-1])
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return n * mult, nil
+}
@@ -0,0 +1,227 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lucasduport/stream-share/pkg/types"
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// statusQueued marks a cache entry waiting for a download slot.
+const statusQueued = "queued"
+
+// downloadQueue caps how many cache downloads run at once. Downloads over
+// the cap wait in FIFO order; each one starts when a running one ends.
+//
+// It also keeps the registry of stream ids with a download in progress, so
+// concurrent requests for the same stream start it only once.
+type downloadQueue struct {
+	mu      sync.Mutex
+	limit   int // 0: no cap
+	running int
+	waiting []*queuedDownload
+	active  map[string]bool // stream id -> its file is being written
+}
+
+// queuedDownload is one submitted job: the stream ids it downloads, in
+// order (several for a multi-part movie), and the function doing it.
+type queuedDownload struct {
+	ids []string
+	run func()
+}
+
+var (
+	downloadsOnce sync.Once
+	downloads     *downloadQueue
+)
+
+// cacheDownloadLimit reads MAX_CONCURRENT_CACHE_DOWNLOADS (default 0, no cap).
+func cacheDownloadLimit() int {
+	if v := strings.TrimSpace(os.Getenv("MAX_CONCURRENT_CACHE_DOWNLOADS")); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			return n
+		}
+		utils.WarnLog("Invalid MAX_CONCURRENT_CACHE_DOWNLOADS: %s", v)
+	}
+	return 0
+}
+
+// cacheDownloads returns the shared queue.
+func cacheDownloads() *downloadQueue {
+	downloadsOnce.Do(func() { downloads = &downloadQueue{limit: cacheDownloadLimit(), active: map[string]bool{}} })
+	return downloads
+}
+
+// submit runs job now when a slot is free and reports true; otherwise it
+// queues it behind the jobs already waiting.
+func (q *downloadQueue) submit(job *queuedDownload) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.limit == 0 || q.running < q.limit {
+		q.running++
+		go q.exec(job)
+		return true
+	}
+	q.waiting = append(q.waiting, job)
+	utils.InfoLog("Cache: %d downloads running, %s queued at position %d", q.running, job.ids[0], len(q.waiting))
+	return false
+}
+
+// exec runs job, then hands its slot to the oldest waiting job.
+func (q *downloadQueue) exec(job *queuedDownload) {
+	for job != nil {
+		job.run()
+		q.mu.Lock()
+		job = nil
+		// A lowered cap (reload) takes effect as running downloads end
+		if len(q.waiting) > 0 && (q.limit == 0 || q.running <= q.limit) {
+			job = q.waiting[0]
+			q.waiting = q.waiting[1:]
+		} else {
+			q.running--
+		}
+		q.mu.Unlock()
+	}
+}
+
+// setLimit changes the cap. Waiting jobs a higher cap makes room for start
+// right away; a lower one lets running downloads finish.
+func (q *downloadQueue) setLimit(n int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.limit = n
+	for len(q.waiting) > 0 && (q.limit == 0 || q.running < q.limit) {
+		job := q.waiting[0]
+		q.waiting = q.waiting[1:]
+		q.running++
+		go q.exec(job)
+	}
+}
+
+// cancel drops streamID from the waiting jobs, and a job once it has no id
+// left. A job that already started is not affected.
+func (q *downloadQueue) cancel(streamID string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	found := false
+	kept := q.waiting[:0]
+	for _, job := range q.waiting {
+		ids := job.ids[:0]
+		for _, id := range job.ids {
+			if id == streamID {
+				found = true
+				delete(q.active, id)
+				continue
+			}
+			ids = append(ids, id)
+		}
+		job.ids = ids
+		if len(ids) > 0 {
+			kept = append(kept, job)
+		}
+	}
+	q.waiting = kept
+	return found
+}
+
+// register claims streamID for a new download. When another request
+// claimed it first it returns false, and whether that download already
+// writes the file.
+func (q *downloadQueue) register(streamID string) (bool, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if running, ok := q.active[streamID]; ok {
+		return false, running
+	}
+	q.active[streamID] = false
+	return true, false
+}
+
+// writing marks the download of streamID as started.
+func (q *downloadQueue) writing(streamID string) {
+	q.mu.Lock()
+	q.active[streamID] = true
+	q.mu.Unlock()
+}
+
+// release ends the claim register took on streamID.
+func (q *downloadQueue) release(streamID string) {
+	q.mu.Lock()
+	delete(q.active, streamID)
+	q.mu.Unlock()
+}
+
+// cacheJob is one file of a submitted download.
+type cacheJob struct {
+	upstream, dest, streamID string
+}
+
+// queueCacheDownload submits jobs, run one after another, to the download
+// queue. Their ids must be registered, and their entries already stored with
+// status queued; each one is claimed before its download starts, so entries
+// deleted while waiting are skipped. It reports whether the download started
+// right away. The downloads log with log, tagged with the request that queued
+// them.
+func (c *Config) queueCacheDownload(log utils.RequestLogger, jobs []cacheJob, expires time.Time) bool {
+	if len(jobs) == 0 {
+		return true
+	}
+	ids := make([]string, len(jobs))
+	for i, j := range jobs {
+		ids[i] = j.streamID
+	}
+	job := &queuedDownload{ids: ids}
+	q := cacheDownloads()
+	job.run = func() {
+		for _, j := range jobs {
+			q.writing(j.streamID)
+			if ok, err := c.db.ClaimQueuedVODCache(c.db.Provider(), j.streamID); !ok {
+				q.release(j.streamID)
+				if err != nil {
+					log.WarnLog("Cache: could not start %s: %v", j.streamID, err)
+				} else {
+					log.InfoLog("Cache: %s left the queue before its download started, skipping it", j.streamID)
+				}
+				continue
+			}
+			c.fetchToFile(log, j.upstream, j.dest, j.streamID, expires)
+			q.release(j.streamID)
+		}
+	}
+	return q.submit(job)
+}
+
+// autoCache starts caching a VOD item a player asked for that isn't cached.
+// It reports whether the download runs (or ran already), in which case the
+// caller serves the growing file. Otherwise the download waits in the queue
+// and the caller streams from the provider in the meantime.
+func (c *Config) autoCache(log utils.RequestLogger, streamID, typ, upstream, dest string, expires time.Time) bool {
+	if fresh, running := cacheDownloads().register(streamID); !fresh {
+		// Another request started it first: attach to its file once written
+		return running
+	}
+	_ = c.db.UpsertVODCache(&types.VODCacheEntry{Provider: c.db.Provider(), StreamID: streamID, Type: typ, FilePath: dest, Status: statusQueued, ExpiresAt: expires, CreatedAt: time.Now()})
+	return c.queueCacheDownload(log, []cacheJob{{upstream, dest, streamID}}, expires)
+}
@@ -0,0 +1,251 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lucasduport/stream-share/pkg/config"
+	"github.com/lucasduport/stream-share/pkg/database"
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// eventually fails the test when cond is still false after a few seconds.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDownloadQueueLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int
+		newLimit int // applied once the first jobs run; -1 keeps limit
+		jobs     int
+	}{
+		{"no cap", 0, -1, 5},
+		{"cap of one", 1, -1, 5},
+		{"cap of three", 3, -1, 8},
+		{"cap lowered", 3, 1, 8},
+		{"cap raised", 1, 3, 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &downloadQueue{limit: tt.limit, active: map[string]bool{}}
+			release := make(chan struct{})
+			done := make(chan struct{})
+
+			var mu sync.Mutex
+			running, started, peak := 0, 0, 0
+			lowered, peakAfter := false, 0
+			stats := func() (int, int) {
+				mu.Lock()
+				defer mu.Unlock()
+				return started, peak
+			}
+			for i := 0; i < tt.jobs; i++ {
+				q.submit(&queuedDownload{ids: []string{strconv.Itoa(i)}, run: func() {
+					mu.Lock()
+					running++
+					started++
+					peak = max(peak, running)
+					if lowered {
+						peakAfter = max(peakAfter, running)
+					}
+					mu.Unlock()
+					<-release
+					mu.Lock()
+					running--
+					mu.Unlock()
+					done <- struct{}{}
+				}})
+			}
+
+			first := tt.jobs
+			if tt.limit > 0 {
+				first = min(tt.limit, tt.jobs)
+			}
+			eventually(t, "the first jobs to start", func() bool { s, _ := stats(); return s == first })
+			if tt.newLimit >= 0 {
+				mu.Lock()
+				lowered = tt.newLimit < tt.limit
+				mu.Unlock()
+				q.setLimit(tt.newLimit)
+				want := max(first, min(tt.newLimit, tt.jobs))
+				eventually(t, "jobs the new cap makes room for", func() bool { s, _ := stats(); return s == want })
+			}
+			time.Sleep(20 * time.Millisecond) // no job over the cap starts late
+			if s, _ := stats(); s != max(first, min(tt.newLimit, tt.jobs)) {
+				t.Fatalf("%d jobs started before any finished", s)
+			}
+
+			for i := 0; i < tt.jobs; i++ {
+				release <- struct{}{}
+				<-done
+			}
+			eventually(t, "every job to run", func() bool { s, _ := stats(); return s == tt.jobs })
+			eventually(t, "the queue to drain", func() bool {
+				q.mu.Lock()
+				defer q.mu.Unlock()
+				return q.running == 0 && len(q.waiting) == 0
+			})
+
+			_, p := stats()
+			want := tt.jobs
+			if tt.limit > 0 {
+				want = max(tt.limit, tt.newLimit)
+			}
+			if p > want {
+				t.Errorf("%d jobs ran at once, cap %d", p, want)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if lowered && peakAfter > tt.newLimit {
+				t.Errorf("%d jobs ran at once after the cap was lowered to %d", peakAfter, tt.newLimit)
+			}
+		})
+	}
+}
+
+// testDB connects to the PostgreSQL database named by TEST_DATABASE_URL, and
+// skips the test when it is unset.
+func testDB(t *testing.T) *database.DBManager {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	t.Setenv("DATABASE_URL", dsn)
+	db, err := database.NewDBManager("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// movieUpstream serves a small movie slowly enough for concurrent requests to
+// overlap, and counts the requests it got.
+func movieUpstream(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var hits atomic.Int32
+	body := append([]byte("\x00\x00\x00\x18ftypmp42"), make([]byte, 64*1024)...)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		w.Header().Set("Content-Type", "video/mp4")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Write(body) // nolint: errcheck
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits
+}
+
+func TestDownloadRegisterOnce(t *testing.T) {
+	tests := []struct {
+		name     string
+		requests int
+	}{
+		{"single request", 1},
+		{"two requests", 2},
+		{"many requests", 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream, hits := movieUpstream(t)
+			q := &downloadQueue{active: map[string]bool{}}
+			var fresh atomic.Int32
+			var wg sync.WaitGroup
+			start := make(chan struct{})
+			for i := 0; i < tt.requests; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					<-start
+					if ok, _ := q.register("42"); !ok {
+						return
+					}
+					fresh.Add(1)
+					q.submit(&queuedDownload{ids: []string{"42"}, run: func() {
+						q.writing("42")
+						defer q.release("42")
+						resp, err := http.Get(upstream.URL + "/movie/u/p/42.mp4")
+						if err != nil {
+							t.Error(err)
+							return
+						}
+						io.Copy(io.Discard, resp.Body) // nolint: errcheck
+						resp.Body.Close()
+					}})
+				}()
+			}
+			close(start)
+			wg.Wait()
+			eventually(t, "the download to end", func() bool {
+				q.mu.Lock()
+				defer q.mu.Unlock()
+				_, ok := q.active["42"]
+				return !ok
+			})
+			if n := fresh.Load(); n != 1 {
+				t.Errorf("%d requests started the download, want 1", n)
+			}
+			if n := hits.Load(); n != 1 {
+				t.Errorf("%d upstream fetches, want 1", n)
+			}
+		})
+	}
+}
+
+// TestAutoCacheSingleFetch opens the same uncached movie from several players
+// at once and checks the provider is asked for it once.
+func TestAutoCacheSingleFetch(t *testing.T) {
+	db := testDB(t)
+	upstream, hits := movieUpstream(t)
+	old := config.CacheFolder
+	config.CacheFolder = t.TempDir()
+	t.Cleanup(func() { config.CacheFolder = old })
+
+	c := &Config{ProxyConfig: &config.ProxyConfig{XtreamBaseURL: upstream.URL}, db: db}
+	id := "t1592" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	t.Cleanup(func() { db.DeleteVODCache(db.Provider(), id) }) // nolint: errcheck
+	dest := filepath.Join(config.CacheFolder, id+".mp4")
+	expires := time.Now().Add(time.Hour)
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			c.autoCache(utils.RequestLogger{}, id, "movie", upstream.URL+"/movie/u/p/"+id+".mp4", dest, expires)
+		}()
+	}
+	close(start)
+	wg.Wait()
+	eventually(t, "the cached file", func() bool { _, err := os.Stat(dest); return err == nil })
+	eventually(t, "the download to end", func() bool {
+		q := cacheDownloads()
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		_, ok := q.active[id]
+		return !ok
+	})
+	if n := hits.Load(); n != 1 {
+		t.Errorf("%d upstream fetches, want 1", n)
+	}
+}
@@ -0,0 +1,124 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// rateSampleEvery is the minimum spacing between two rate samples, so a fast
+// download does not keep thousands of them per window.
+const rateSampleEvery = 250 * time.Millisecond
+
+// rateWindow reads VOD_RATE_WINDOW ("10s" or seconds, default 10s), the span
+// the download rate is averaged over. 0 turns rate and ETA reporting off.
+func rateWindow() time.Duration {
+	if v := strings.TrimSpace(os.Getenv("VOD_RATE_WINDOW")); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			return d
+		} else if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			return time.Duration(n) * time.Second
+		}
+		utils.WarnLog("Invalid VOD_RATE_WINDOW: %s", v)
+	}
+	return 10 * time.Second
+}
+
+type rateSample struct {
+	at    time.Time
+	bytes int64
+}
+
+// rateMeter computes a download rate over a sliding window of byte counter
+// samples. It is owned by a single download goroutine.
+type rateMeter struct {
+	window  time.Duration
+	samples []rateSample
+}
+
+func newRateMeter(window time.Duration) *rateMeter {
+	return &rateMeter{window: window}
+}
+
+// reset forgets all samples, e.g. before a retry, so the wait is not counted.
+func (r *rateMeter) reset() { r.samples = r.samples[:0] }
+
+// add records the byte counter at now and drops samples older than the window.
+func (r *rateMeter) add(now time.Time, bytes int64) {
+	if r.window <= 0 {
+		return
+	}
+	if n := len(r.samples); n > 1 && now.Sub(r.samples[n-2].at) < rateSampleEvery {
+		// Keep the window edges exact but do not grow for every read
+		r.samples[n-1] = rateSample{now, bytes}
+	} else {
+		r.samples = append(r.samples, rateSample{now, bytes})
+	}
+	cut := 0
+	for cut < len(r.samples)-2 && now.Sub(r.samples[cut+1].at) >= r.window {
+		cut++
+	}
+	if cut > 0 {
+		r.samples = append(r.samples[:0], r.samples[cut:]...)
+	}
+}
+
+// rate returns the average bytes per second across the window, or 0 until two
+// samples are available.
+func (r *rateMeter) rate() int64 {
+	if len(r.samples) < 2 {
+		return 0
+	}
+	first, last := r.samples[0], r.samples[len(r.samples)-1]
+	elapsed := last.at.Sub(first.at).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return int64(float64(last.bytes-first.bytes) / elapsed)
+}
+
+// etaSeconds estimates the time left for a download. ok is false when the
+// total size or the rate is unknown.
+func etaSeconds(downloaded, total, rate int64) (eta int64, ok bool) {
+	if total <= 0 || rate <= 0 {
+		return 0, false
+	}
+	left := total - downloaded
+	if left < 0 {
+		left = 0
+	}
+	return (left + rate - 1) / rate, true
+}
+
+// addRateFields adds rate_bytes_per_sec and, when the total is known,
+// eta_seconds to a progress response for a running download.
+func addRateFields(out map[string]interface{}, status string, downloaded, total, rate int64) {
+	if status != "downloading" || rateWindow() <= 0 {
+		return
+	}
+	out["rate_bytes_per_sec"] = rate
+	if eta, ok := etaSeconds(downloaded, total, rate); ok {
+		out["eta_seconds"] = eta
+	}
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateMeter(t *testing.T) {
+	const mb = 1024 * 1024
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := newRateMeter(10 * time.Second)
+
+	if got := m.rate(); got != 0 {
+		t.Errorf("rate without samples = %d, want 0", got)
+	}
+	m.add(t0, 0)
+	if got := m.rate(); got != 0 {
+		t.Errorf("rate with one sample = %d, want 0", got)
+	}
+
+	// 1MB/s for 10s, then 3MB/s for 10s: the window only sees the second part
+	var bytes int64
+	for s := 1; s <= 20; s++ {
+		if s <= 10 {
+			bytes += mb
+		} else {
+			bytes += 3 * mb
+		}
+		m.add(t0.Add(time.Duration(s)*time.Second), bytes)
+		if s == 10 {
+			if got := m.rate(); got != mb {
+				t.Errorf("rate after 10s = %d, want %d", got, mb)
+			}
+		}
+	}
+	if got := m.rate(); got != 3*mb {
+		t.Errorf("rate after 20s = %d, want %d", got, 3*mb)
+	}
+	if n := len(m.samples); n > 12 {
+		t.Errorf("%d samples kept for a 10s window sampled every second", n)
+	}
+
+	// Reads closer than rateSampleEvery replace the last sample
+	before := len(m.samples)
+	for i := 1; i <= 100; i++ {
+		bytes += 1024
+		m.add(t0.Add(20*time.Second+time.Duration(i)*time.Millisecond), bytes)
+	}
+	if n := len(m.samples); n > before+1 {
+		t.Errorf("%d samples after 100 reads within 100ms, want at most %d", n, before+1)
+	}
+
+	m.reset()
+	if got := m.rate(); got != 0 {
+		t.Errorf("rate after reset = %d, want 0", got)
+	}
+
+	off := newRateMeter(0)
+	off.add(t0, 0)
+	off.add(t0.Add(time.Second), mb)
+	if got := off.rate(); got != 0 {
+		t.Errorf("rate with the window off = %d, want 0", got)
+	}
+}
+
+func TestEtaSeconds(t *testing.T) {
+	tests := []struct {
+		name                    string
+		downloaded, total, rate int64
+		want                    int64
+		wantOK                  bool
+	}{
+		{"exact", 400, 1000, 100, 6, true},
+		{"rounded up", 401, 1000, 100, 6, true},
+		{"done", 1000, 1000, 100, 0, true},
+		{"past the total", 1200, 1000, 100, 0, true},
+		{"unknown total", 400, 0, 100, 0, false},
+		{"no rate yet", 400, 1000, 0, 0, false},
+	}
+	for _, tt := range tests {
+		eta, ok := etaSeconds(tt.downloaded, tt.total, tt.rate)
+		if eta != tt.want || ok != tt.wantOK {
+			t.Errorf("%s: etaSeconds = (%d, %v), want (%d, %v)", tt.name, eta, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestAddRateFields(t *testing.T) {
+	tests := []struct {
+		name, window, status string
+		total                int64
+		wantRate, wantETA    bool
+	}{
+		{"downloading", "", "downloading", 1000, true, true},
+		{"no content length", "", "downloading", 0, true, false},
+		{"ready", "", "ready", 1000, false, false},
+		{"reporting off", "0", "downloading", 1000, false, false},
+	}
+	for _, tt := range tests {
+		t.Setenv("VOD_RATE_WINDOW", tt.window)
+		out := map[string]interface{}{}
+		addRateFields(out, tt.status, 400, tt.total, 100)
+		rate, hasRate := out["rate_bytes_per_sec"]
+		eta, hasETA := out["eta_seconds"]
+		if hasRate != tt.wantRate || hasETA != tt.wantETA {
+			t.Errorf("%s: fields = %v", tt.name, out)
+			continue
+		}
+		if hasRate && rate != int64(100) {
+			t.Errorf("%s: rate = %v, want 100", tt.name, rate)
+		}
+		if hasETA && eta != int64(6) {
+			t.Errorf("%s: eta = %v, want 6", tt.name, eta)
+		}
+	}
+}
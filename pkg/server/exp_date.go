@@ -0,0 +1,221 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lucasduport/stream-share/pkg/utils"
+	xtreamapi "github.com/lucasduport/stream-share/pkg/xtream"
+)
+
+// providerExpTTL is how long the provider's account details are reused before
+// they are fetched again in the background.
+const providerExpTTL = time.Hour
+
+var (
+	expDateOnce  sync.Once
+	expDateMode  string // rolling, provider or fixed
+	expDateFixed string // unix timestamp when expDateMode is fixed
+
+	providerExp struct {
+		sync.Mutex
+		value      providerAccount
+		ok         bool
+		fetched    time.Time
+		refreshing bool
+	}
+)
+
+// providerAccount is what the provider login call says about the account.
+// Empty fields were not reported.
+type providerAccount struct {
+	expDate        string // unix timestamp
+	maxConnections string
+	status         string
+}
+
+// loadExpDateMode reads XTREAM_EXP_DATE: "rolling" (default) advertises one
+// year from now, "provider" passes through the provider account's exp_date,
+// and a date (2006-01-02, RFC 3339 or a unix timestamp) is advertised as is.
+func loadExpDateMode() {
+	v := strings.TrimSpace(os.Getenv("XTREAM_EXP_DATE"))
+	switch strings.ToLower(v) {
+	case "", "rolling":
+		expDateMode = "rolling"
+	case "provider":
+		expDateMode = "provider"
+	default:
+		if ts, ok := parseExpDate(v); ok {
+			expDateMode, expDateFixed = "fixed", ts
+		} else {
+			utils.WarnLog("Invalid XTREAM_EXP_DATE: %s", v)
+			expDateMode = "rolling"
+		}
+	}
+}
+
+// parseExpDate converts a configured expiry into a unix timestamp string.
+func parseExpDate(v string) (string, bool) {
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+		return strconv.FormatInt(n, 10), true
+	}
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if t, err := time.Parse(layout, v); err == nil {
+			return strconv.FormatInt(t.Unix(), 10), true
+		}
+	}
+	return "", false
+}
+
+// loginExpDate returns the exp_date advertised in the local login response.
+// The provider and fixed sources fall back to the rolling date when they
+// have nothing to offer.
+func (c *Config) loginExpDate(now time.Time) string {
+	expDateOnce.Do(loadExpDateMode)
+	switch expDateMode {
+	case "fixed":
+		return expDateFixed
+	case "provider":
+		if exp := c.providerExpDate(); exp != "" {
+			return exp
+		}
+	}
+	return strconv.FormatInt(now.Add(365*24*time.Hour).Unix(), 10)
+}
+
+// providerExpDate returns the provider account expiry, "" when unknown.
+func (c *Config) providerExpDate() string {
+	account, _ := c.providerAccountInfo()
+	return account.expDate
+}
+
+// providerAccountInfo returns the provider account details; ok is false when
+// the provider could not be read. The first call fetches them; later calls
+// return the remembered value and refresh it in the background once it is
+// older than providerExpTTL.
+func (c *Config) providerAccountInfo() (providerAccount, bool) {
+	providerExp.Lock()
+	value, ok, fetched := providerExp.value, providerExp.ok, providerExp.fetched
+	if !fetched.IsZero() && time.Since(fetched) > providerExpTTL && !providerExp.refreshing {
+		providerExp.refreshing = true
+		go c.refreshProviderAccountInfo()
+	}
+	providerExp.Unlock()
+
+	if fetched.IsZero() {
+		return c.refreshProviderAccountInfo()
+	}
+	return value, ok
+}
+
+func (c *Config) refreshProviderAccountInfo() (providerAccount, bool) {
+	account, err := c.fetchProviderAccountInfo()
+	if err != nil {
+		utils.WarnLog("Could not read the provider account details: %v", err)
+	}
+	providerExp.Lock()
+	providerExp.value, providerExp.ok = account, err == nil
+	providerExp.fetched, providerExp.refreshing = time.Now(), false
+	providerExp.Unlock()
+	return account, err == nil
+}
+
+// fetchProviderAccountInfo reads user_info from the provider login call.
+// Accounts without an expiry report a null exp_date, which yields "".
+func (c *Config) fetchProviderAccountInfo() (providerAccount, error) {
+	client, err := xtreamapi.New(c.XtreamUser.String(), c.XtreamPassword.String(), c.XtreamBaseURL, "")
+	if err != nil {
+		return providerAccount{}, err
+	}
+	resp, _, _, err := client.Action(c.ProxyConfig, "", nil)
+	if err != nil {
+		return providerAccount{}, err
+	}
+	login, _ := resp.(map[string]interface{})
+	info, _ := login["user_info"].(map[string]interface{})
+	if info == nil {
+		return providerAccount{}, fmt.Errorf("login response has no user_info")
+	}
+
+	account := providerAccount{
+		maxConnections: userInfoString(info["max_connections"]),
+		status:         userInfoString(info["status"]),
+	}
+	switch v := info["exp_date"].(type) {
+	case nil:
+	case json.Number:
+		account.expDate = v.String()
+	case string:
+		if ts, ok := parseExpDate(strings.TrimSpace(v)); ok {
+			account.expDate = ts
+		}
+	case float64:
+		account.expDate = strconv.FormatInt(int64(v), 10)
+	default:
+		return providerAccount{}, fmt.Errorf("unexpected exp_date %v", v)
+	}
+	return account, nil
+}
+
+// userInfoString renders a user_info value that providers send either as a
+// string or as a number; null yields "".
+func userInfoString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(v)
+	case json.Number:
+		return v.String()
+	case float64:
+		return strconv.FormatInt(int64(v), 10)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// applyProviderUserInfo replaces the fabricated exp_date, max_connections
+// and status of a local user_info with the provider's, when
+// XTREAM_REAL_USER_INFO is set. A fixed XTREAM_EXP_DATE still wins, and
+// nothing changes when the provider can't be read.
+func (c *Config) applyProviderUserInfo(info map[string]interface{}) {
+	if !envFlag("XTREAM_REAL_USER_INFO", false) {
+		return
+	}
+	account, ok := c.providerAccountInfo()
+	if !ok {
+		return
+	}
+	if account.expDate != "" && expDateMode != "fixed" {
+		info["exp_date"] = account.expDate
+	}
+	if account.maxConnections != "" {
+		info["max_connections"] = account.maxConnections
+	}
+	if account.status != "" {
+		info["status"] = account.status
+	}
+}
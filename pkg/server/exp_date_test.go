@@ -0,0 +1,70 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lucasduport/stream-share/pkg/config"
+)
+
+// resetExpDate forgets the loaded XTREAM_EXP_DATE and the remembered provider
+// account, so each test reads both afresh.
+func resetExpDate(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		expDateOnce = sync.Once{}
+		expDateMode, expDateFixed = "", ""
+		providerExp.Lock()
+		providerExp.value, providerExp.ok = providerAccount{}, false
+		providerExp.fetched, providerExp.refreshing = time.Time{}, false
+		providerExp.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+// providerLogin serves body as the provider's player_api login answer.
+func providerLogin(t *testing.T, body string) *Config {
+	t.Helper()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body)) // nolint: errcheck
+	}))
+	t.Cleanup(upstream.Close)
+	return &Config{ProxyConfig: &config.ProxyConfig{XtreamBaseURL: upstream.URL, XtreamUser: "user", XtreamPassword: "pass"}}
+}
+
+func TestLoginExpDate(t *testing.T) {
+	t.Setenv("API_CACHE_SECONDS", "0")
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	rolling := strconv.FormatInt(now.Add(365*24*time.Hour).Unix(), 10)
+
+	tests := []struct {
+		name, env, provider string
+		want                string
+	}{
+		{name: "rolling by default", want: rolling},
+		{name: "rolling", env: "rolling", want: rolling},
+		{name: "fixed date", env: "2030-01-02", want: "1893542400"},
+		{name: "fixed RFC 3339", env: "2030-01-02T00:00:00Z", want: "1893542400"},
+		{name: "fixed unix timestamp", env: "1893542400", want: "1893542400"},
+		{name: "invalid falls back to rolling", env: "next year", want: rolling},
+		{name: "provider string", env: "provider", provider: `{"user_info":{"exp_date":"1893542400"}}`, want: "1893542400"},
+		{name: "provider number", env: "provider", provider: `{"user_info":{"exp_date":1893542400}}`, want: "1893542400"},
+		{name: "provider without expiry", env: "provider", provider: `{"user_info":{"exp_date":null}}`, want: rolling},
+		{name: "provider unreadable", env: "provider", provider: `<html>down</html>`, want: rolling},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetExpDate(t)
+			t.Setenv("XTREAM_EXP_DATE", tt.env)
+			c := providerLogin(t, tt.provider)
+			if got := c.loginExpDate(now); got != tt.want {
+				t.Errorf("loginExpDate = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
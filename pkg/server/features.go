@@ -0,0 +1,208 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucasduport/stream-share/pkg/types"
+	"github.com/lucasduport/stream-share/pkg/utils"
+	xtreamapi "github.com/lucasduport/stream-share/pkg/xtream"
+)
+
+// envFlag reports a boolean env var using the repo's accepted truthy spellings.
+func envFlag(key string, def bool) bool {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv(key))) {
+	case "1", "true", "yes":
+		return true
+	case "0", "false", "no":
+		return false
+	}
+	return def
+}
+
+// envDuration reads a duration ("30s" or seconds) from key, def when unset or invalid.
+func envDuration(key string, def time.Duration) time.Duration {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return def
+	}
+	if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+		return d
+	} else if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+		return time.Duration(n) * time.Second
+	}
+	utils.WarnLog("Invalid %s: %s", key, v)
+	return def
+}
+
+// envCount reads a non-negative integer from key, def when unset or invalid.
+func envCount(key string, def int) int {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return def
+	}
+	if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+		return n
+	}
+	utils.WarnLog("Invalid %s: %s", key, v)
+	return def
+}
+
+// effectiveFeatures is the single source of truth for what is enabled: every
+// env-driven flag, limit and timeout as actually applied. Secrets are masked.
+func (c *Config) effectiveFeatures() map[string]interface{} {
+	retries, backoff := downloadRetryPolicy()
+	limits := vodDownloadLimits()
+	blockedIDs, blockedCategories := blockedStreams().counts()
+	m3uTimeout, m3uMaxBytes := vodM3ULimits()
+
+	features := map[string]interface{}{
+		"server": map[string]interface{}{
+			"hostname":        c.HostConfig.Hostname,
+			"port":            c.HostConfig.Port,
+			"advertised_port": c.AdvertisedPort,
+			"public_url":      c.publicBaseURL(),
+			"https":           c.HTTPS,
+			"custom_endpoint": c.CustomEndpoint,
+			"reverse_proxy":   envFlag("REVERSE_PROXY", false),
+		},
+		"upstream": map[string]interface{}{
+			"xtream_base_url":   c.XtreamBaseURL,
+			"xtream_user":       utils.MaskString(c.XtreamUser.String()),
+			"max_json_bytes":    xtreamapi.MaxJSONBytes(),
+			"api_cache":         xtreamapi.APICacheTTL().String(),
+			"pass_unknown":      envFlag("XTREAM_PASSTHROUGH_ACTIONS", true),
+			"m3u_remote":        c.RemoteURL != nil && c.RemoteURL.String() != "",
+			"m3u_cache_minutes": c.M3UCacheExpiration,
+			"m3u_fetch_workers": m3uFetchConcurrency(),
+			"m3u_tvg_chno":      envFlag("M3U_TVG_CHNO", false),
+			"m3u_catchup":       envFlag("M3U_CATCHUP", false),
+			"m3u_catchup_src":   envFlag("M3U_CATCHUP_SOURCE", false),
+			"user_agent":        utils.GetIPTVUserAgent(),
+			"user_agent_hosts":  os.Getenv("XTREAM_USER_AGENTS") != "",
+			"accept_language":   utils.GetLanguageHeader(),
+			"query_allowlist":   streamQueryAllowlist(),
+			"stream_id_policy":  streamIDPolicy(),
+			"epg_decode":        xtreamapi.DecodeEPGText(),
+			"sanitize_level":    xtreamapi.MaxSanitizeLevel().String(),
+			"exp_date":          os.Getenv("XTREAM_EXP_DATE"),
+			"real_user_info":    envFlag("XTREAM_REAL_USER_INFO", false),
+			"hls_drop_cue_out":  envFlag("HLS_DROP_CUE_OUT", false),
+			"hls_drop_segments": os.Getenv("HLS_DROP_SEGMENTS"),
+		},
+		"auth": map[string]interface{}{
+			"ldap_enabled":        c.LDAPEnabled,
+			"ldap_server":         c.LDAPServer,
+			"ldap_required_group": c.LDAPRequiredGroup,
+			"ldap_cache_ttl":      ldapCacheTTL().String(),
+			"ldap_pool":           ldapPoolEnabled(),
+			"local_user":          utils.MaskString(c.User.String()),
+			"internal_api_keys":   len(internalAPIKeys),
+			"admin_dashboard":     dashboardEnabled(),
+			"rate_limit":          authRateLimitFeatures(),
+			"cors_origins":        strings.Join(publicCORSPolicy().origins, ","),
+			"cors_internal":       strings.Join(internalCORSPolicy().origins, ","),
+		},
+		"streaming": map[string]interface{}{
+			"multiplexing":       c.sessionManager != nil,
+			"force_multiplexing": os.Getenv("FORCE_MULTIPLEXING") == "true",
+			"quality_metrics":    envFlag("STREAM_QUALITY_METRICS", false),
+			"quality_persist":    envFlag("STREAM_QUALITY_METRICS", false) && envFlag("STREAM_QUALITY_PERSIST", false),
+			"blocked_ids":        blockedIDs,
+			"blocked_categories": blockedCategories,
+			"blocklist_file":     os.Getenv("BLOCKLIST_FILE"),
+			"reload_env_file":    os.Getenv("RELOAD_ENV_FILE") != "",
+		},
+		"cache": map[string]interface{}{
+			"folder":           cacheDir(),
+			"provider":         c.db.Provider(),
+			"folder_strict":    envFlag("CACHE_FOLDER_STRICT", false),
+			"ext_probe":        envFlag("VOD_EXT_PROBE", false),
+			"default_ext":      map[string]string{"movie": vodDefaultExt("movie"), "series": vodDefaultExt("series")},
+			"download_retries": retries,
+			"download_backoff": backoff.String(),
+			"max_downloads":    cacheDownloadLimit(),
+			"library_scope":    libraryScope(),
+			"max_bytes":        limits.maxBytes,
+			"max_duration":     limits.maxDuration.String(),
+			"webhook":          cacheWebhookURL() != "",
+			"vod_m3u_timeout":  m3uTimeout.String(),
+			"vod_m3u_max":      m3uMaxBytes,
+			"ready_dm":         c.discordBot != nil && envFlag("CACHE_READY_DM", true),
+			"mp4_progressive":  mp4ProgressiveMode(),
+			"progressive_min":  progressiveMinBytes(),
+			"progress_write":   progressInterval().String(),
+			"rate_window":      rateWindow().String(),
+			"record_origin":    envFlag("RECORD_COMMAND_ORIGIN", true),
+		},
+		"logos": map[string]interface{}{
+			"proxy":     logoProxyEnabled(),
+			"cache_ttl": logoCacheTTL().String(),
+		},
+		"vod": map[string]interface{}{
+			"episode_details": envFlag("VOD_EPISODE_DETAILS", true),
+			"multipart":       multiPartPattern() != nil,
+			"search_fuzzy":    envFlag("VOD_SEARCH_FUZZY", true),
+			"title_rules":     len(loadTitleStripRules()),
+		},
+		"discord": map[string]interface{}{
+			"enabled":       c.discordBot != nil,
+			"admin_role_id": os.Getenv("DISCORD_ADMIN_ROLE_ID"),
+			"ready_notify":  envFlag("CACHE_READY_NOTIFY", true),
+			"ready_batch":   os.Getenv("CACHE_READY_BATCH_WINDOW"),
+		},
+		"logging": map[string]interface{}{
+			"debug":              utils.DebugLogging(),
+			"log_level":          os.Getenv("LOG_LEVEL"),
+			"log_file":           os.Getenv("LOG_FILE"),
+			"error_detail_level": os.Getenv("ERROR_DETAIL_LEVEL"),
+		},
+		"database": map[string]interface{}{
+			"connected":     c.db != nil,
+			"required":      envFlag("DB_REQUIRED", true),
+			"normalize_ids": c.db.NormalizesStreamIDs(),
+		},
+	}
+	if c.sessionManager != nil {
+		features["session"] = c.sessionManager.Settings()
+	}
+	return features
+}
+
+// logFeatures writes the effective configuration as one startup log block.
+func (c *Config) logFeatures() {
+	b, err := json.MarshalIndent(c.effectiveFeatures(), "", "  ")
+	if err != nil {
+		utils.WarnLog("Could not render effective features: %v", err)
+		return
+	}
+	utils.InfoLog("Effective configuration:\n%s", b)
+}
+
+// getFeatures reports the effective flags, limits and timeouts.
+func (c *Config) getFeatures(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, types.APIResponse{Success: true, Data: c.effectiveFeatures()})
+}
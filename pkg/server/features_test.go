@@ -0,0 +1,94 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucasduport/stream-share/pkg/config"
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// TestGetFeatures checks that /admin/features reports the loaded config and
+// env as applied, and never the secrets themselves.
+func TestGetFeatures(t *testing.T) {
+	t.Setenv("XTREAM_MAX_JSON_BYTES", "2048")
+	t.Setenv("VOD_EPISODE_DETAILS", "false")
+	t.Setenv("STREAM_QUALITY_METRICS", "yes")
+	t.Setenv("STREAM_QUALITY_PERSIST", "")
+	t.Setenv("STREAM_ID_POLICY", "sanitize")
+	t.Setenv("REVERSE_PROXY", "")
+	defer utils.SetDebugLogging(utils.DebugLogging())
+	utils.SetDebugLogging(true)
+
+	c := &Config{ProxyConfig: &config.ProxyConfig{
+		HostConfig:         &config.HostConfiguration{Hostname: "iptv.example", Port: 8080},
+		AdvertisedPort:     443,
+		HTTPS:              true,
+		XtreamBaseURL:      "http://provider.example",
+		XtreamUser:         "provider-user",
+		XtreamPassword:     "provider-secret",
+		User:               "local-user",
+		Password:           "local-secret",
+		M3UCacheExpiration: 5,
+		LDAPEnabled:        true,
+		LDAPServer:         "ldap://ldap.example",
+		LDAPBindPassword:   "ldap-secret",
+	}}
+
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Request = httptest.NewRequest("GET", "/api/internal/admin/features", nil)
+	c.getFeatures(ctx)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	for _, secret := range []string{"provider-secret", "local-secret", "ldap-secret", "provider-user", "local-user"} {
+		if strings.Contains(w.Body.String(), secret) {
+			t.Errorf("features expose %q", secret)
+		}
+	}
+
+	var resp struct {
+		Success bool
+		Data    map[string]map[string]interface{}
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		section, key string
+		want         interface{}
+	}{
+		{"server", "hostname", "iptv.example"},
+		{"server", "port", 8080.0},
+		{"server", "advertised_port", 443.0},
+		{"server", "https", true},
+		{"server", "reverse_proxy", false},
+		{"upstream", "xtream_base_url", "http://provider.example"},
+		{"upstream", "xtream_user", utils.MaskString("provider-user")},
+		{"upstream", "max_json_bytes", 2048.0},
+		{"upstream", "m3u_cache_minutes", 5.0},
+		{"upstream", "stream_id_policy", "sanitize"},
+		{"auth", "ldap_enabled", true},
+		{"auth", "ldap_server", "ldap://ldap.example"},
+		{"auth", "local_user", utils.MaskString("local-user")},
+		{"streaming", "multiplexing", false},
+		{"streaming", "quality_metrics", true},
+		{"streaming", "quality_persist", false},
+		{"vod", "episode_details", false},
+		{"logging", "debug", true},
+		{"database", "connected", false},
+	}
+	for _, tt := range tests {
+		if got := resp.Data[tt.section][tt.key]; got != tt.want {
+			t.Errorf("%s.%s = %v, want %v", tt.section, tt.key, got, tt.want)
+		}
+	}
+	if _, ok := resp.Data["session"]; ok {
+		t.Error("session settings reported without a session manager")
+	}
+}
@@ -0,0 +1,67 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import "sync"
+
+// flight is one run of a shared job; err is set before done is closed.
+type flight struct {
+	done chan struct{}
+	err  error
+}
+
+// flightGroup runs one job per key at a time: callers asking for a key that
+// is already running share that run instead of starting their own. Jobs run
+// in their own goroutine, detached from any request, so a caller that goes
+// away neither cancels the run nor leaves its context to the callers waiting
+// on it.
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// start returns the running flight for key, or starts fn as a new one.
+func (g *flightGroup) start(key string, fn func() error) *flight {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if f, ok := g.flights[key]; ok {
+		return f
+	}
+	if g.flights == nil {
+		g.flights = make(map[string]*flight)
+	}
+	f := &flight{done: make(chan struct{})}
+	g.flights[key] = f
+	go func() {
+		f.err = fn()
+		g.mu.Lock()
+		delete(g.flights, key)
+		g.mu.Unlock()
+		close(f.done)
+	}()
+	return f
+}
+
+// do runs fn for key, or waits for the run already in progress, and returns
+// its error.
+func (g *flightGroup) do(key string, fn func() error) error {
+	f := g.start(key, fn)
+	<-f.done
+	return f.err
+}
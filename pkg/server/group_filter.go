@@ -0,0 +1,205 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// groupFilter trims a playlist by group-title. Patterns are unanchored,
+// case-insensitive regular expressions; a group is kept when it matches an
+// include pattern (or there are none) and matches no exclude pattern, so
+// exclude wins when both match.
+type groupFilter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+	spec    string // canonical form, part of the variant's ETag
+}
+
+// groupFilterParams are the query parameters read by parseGroupFilter. They
+// are never forwarded to the provider.
+var groupFilterParams = []string{"include_groups", "exclude_groups"}
+
+// parseGroupFilter reads include_groups and exclude_groups from q. It returns
+// nil when neither is set.
+func parseGroupFilter(q url.Values) (*groupFilter, error) {
+	include, err := compileGroupPatterns("include_groups", q.Get("include_groups"))
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := compileGroupPatterns("exclude_groups", q.Get("exclude_groups"))
+	if err != nil {
+		return nil, err
+	}
+	if len(include) == 0 && len(exclude) == 0 {
+		return nil, nil
+	}
+	return &groupFilter{
+		include: include,
+		exclude: exclude,
+		spec:    "include=" + joinPatterns(include) + "&exclude=" + joinPatterns(exclude),
+	}, nil
+}
+
+// requestGroupFilter parses the group filter of the request's query. It
+// answers 400 and returns false when a pattern does not compile.
+func requestGroupFilter(ctx *gin.Context) (*groupFilter, bool) {
+	groups, err := parseGroupFilter(ctx.Request.URL.Query())
+	if err != nil {
+		abortJSON(ctx, http.StatusBadRequest, errCodeInvalidParameter, err.Error())
+		return nil, false
+	}
+	return groups, true
+}
+
+// isGroupFilterParam reports whether key is one of groupFilterParams.
+func isGroupFilterParam(key string) bool {
+	for _, p := range groupFilterParams {
+		if key == p {
+			return true
+		}
+	}
+	return false
+}
+
+func compileGroupPatterns(name, v string) ([]*regexp.Regexp, error) {
+	var out []*regexp.Regexp
+	for _, p := range strings.Split(v, ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		re, err := regexp.Compile("(?i)" + p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s pattern %q: %v", name, p, err)
+		}
+		out = append(out, re)
+	}
+	return out, nil
+}
+
+func joinPatterns(res []*regexp.Regexp) string {
+	parts := make([]string, len(res))
+	for i, re := range res {
+		parts[i] = strings.TrimPrefix(re.String(), "(?i)")
+	}
+	return strings.Join(parts, ",")
+}
+
+// keepGroup reports whether a group named group passes the filter. A nil
+// filter keeps everything.
+func (f *groupFilter) keepGroup(group string) bool {
+	if f == nil {
+		return true
+	}
+	for _, re := range f.exclude {
+		if re.MatchString(group) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, re := range f.include {
+		if re.MatchString(group) {
+			return true
+		}
+	}
+	return false
+}
+
+// groupTitleAttr finds the group-title of an #EXTINF line as m3uAttr writes it.
+var groupTitleAttr = regexp.MustCompile(`\sgroup-title="([^"]*)"`)
+
+// filterPlaylist copies the M3U in r to w, leaving out the entries whose
+// group-title f rejects; entries without one are an empty group. An entry
+// runs from its #EXTINF line to its URI, so the kept URIs, and the track
+// routes in them, are those of the full playlist.
+func (f *groupFilter) filterPlaylist(w io.Writer, r io.Reader) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	keep := true
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.HasPrefix(line, "#EXTINF") {
+			group := ""
+			if m := groupTitleAttr.FindStringSubmatch(line); m != nil {
+				group = m[1]
+			}
+			keep = f.keepGroup(group)
+		}
+		if keep {
+			if _, err := io.WriteString(w, line+"\n"); err != nil {
+				return err
+			}
+		}
+		if line != "" && !strings.HasPrefix(line, "#") {
+			keep = true // the URI ends the entry
+		}
+	}
+	return sc.Err()
+}
+
+// serveFilteredPlaylist sends the playlist file at path with only the tracks
+// groups keeps. Variants are cut from the cached file as it is sent, so a
+// filter costs no upstream fetch and no cache entry. A nil groups sends the
+// file as is.
+func serveFilteredPlaylist(ctx *gin.Context, path string, groups *groupFilter) {
+	if groups == nil {
+		servePlaylistFile(ctx, path)
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		abortError(ctx, http.StatusInternalServerError, errCodeInternal, "Could not read playlist", err)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		abortError(ctx, http.StatusInternalServerError, errCodeInternal, "Could not read playlist", err)
+		return
+	}
+	var body bytes.Buffer
+	if err := groups.filterPlaylist(&body, f); err != nil {
+		abortError(ctx, http.StatusInternalServerError, errCodeInternal, "Could not read playlist", err)
+		return
+	}
+
+	// The variant changes with the file and with the filter
+	if etag, err := fileETag(path); err == nil {
+		sum := sha256.Sum256([]byte(etag + groups.spec))
+		ctx.Header("ETag", fmt.Sprintf(`"%s"`, hex.EncodeToString(sum[:16])))
+	} else {
+		reqLog(ctx).DebugLog("Playlist ETag for %s unavailable: %v", path, err)
+	}
+	ctx.Header("Cache-Control", "no-cache")
+	http.ServeContent(ctx.Writer, ctx.Request, filepath.Base(path), fi.ModTime(), bytes.NewReader(body.Bytes()))
+}
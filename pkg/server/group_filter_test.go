@@ -0,0 +1,229 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jamesnetherton/m3u"
+	"github.com/lucasduport/stream-share/pkg/config"
+)
+
+func TestGroupFilterKeep(t *testing.T) {
+	groups := []string{"Sports", "Sports Replay", "UK | News", "News", "Adult", "Kids", ""}
+	tests := []struct {
+		name, include, exclude string
+		want                   []string
+	}{
+		{"no filter", "", "", groups},
+		{"include only", "sport", "", []string{"Sports", "Sports Replay"}},
+		{"exclude only", "", "adult, ^$", []string{"Sports", "Sports Replay", "UK | News", "News", "Kids"}},
+		{"exclude wins over include", "sport,news", "replay", []string{"Sports", "UK | News", "News"}},
+		{"overlapping includes", "sports,sports replay,^news$", "", []string{"Sports", "Sports Replay", "News"}},
+		{"everything excluded", "sport", "s", nil},
+		{"anchored regex", `^uk \|`, "", []string{"UK | News"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := parseGroupFilter(url.Values{"include_groups": {tt.include}, "exclude_groups": {tt.exclude}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (f == nil) != (tt.include == "" && tt.exclude == "") {
+				t.Errorf("filter = %v", f)
+			}
+			var kept []string
+			for _, g := range groups {
+				if f.keepGroup(g) {
+					kept = append(kept, g)
+				}
+			}
+			if strings.Join(kept, ";") != strings.Join(tt.want, ";") {
+				t.Errorf("kept %q, want %q", kept, tt.want)
+			}
+		})
+	}
+
+	if _, err := parseGroupFilter(url.Values{"exclude_groups": {"news,(adult"}}); err == nil {
+		t.Error("invalid pattern accepted")
+	}
+	a, _ := parseGroupFilter(url.Values{"include_groups": {" sport , news"}})
+	b, _ := parseGroupFilter(url.Values{"include_groups": {"sport,news"}})
+	c, _ := parseGroupFilter(url.Values{"include_groups": {"sport"}, "exclude_groups": {"news"}})
+	if a.spec != b.spec || a.spec == c.spec {
+		t.Errorf("specs %q, %q, %q", a.spec, b.spec, c.spec)
+	}
+}
+
+// TestFilteredM3U checks a filtered playlist keeps the track routes of the
+// full one, every kept track pointing at the index it is registered under,
+// and that variants are cut from the full file without being cached.
+func TestFilteredM3U(t *testing.T) {
+	t.Cleanup(dropCachedXtreamM3u)
+	var tracks []m3u.Track
+	for i, g := range []string{"Sports", "News", "Sports Replay", "Adult", "News", "Sports"} {
+		tracks = append(tracks, m3u.Track{
+			Name:   "Channel " + strconv.Itoa(i),
+			Length: -1,
+			URI:    "http://provider.example/live/puser/ppass/" + strconv.Itoa(100+i) + ".ts",
+			Tags:   []m3u.Tag{{Name: "group-title", Value: g}},
+		})
+	}
+	c := &Config{
+		ProxyConfig: &config.ProxyConfig{
+			HostConfig:     &config.HostConfiguration{Hostname: "iptv.example", Port: 8080},
+			XtreamUser:     "puser",
+			XtreamPassword: "ppass",
+			User:           "alice",
+			Password:       "secret",
+		},
+		playlist:             &m3u.Playlist{Tracks: append([]m3u.Track(nil), tracks...)},
+		endpointAntiColision: "abcd",
+	}
+	f, err := os.Create(filepath.Join(t.TempDir(), "proxy.m3u"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.marshallInto(f, false); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	c.proxyfiedM3UPath = f.Name()
+
+	get := func(query string, header http.Header) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = httptest.NewRequest(http.MethodGet, "/m3u?"+query, nil)
+		for k, v := range header {
+			ctx.Request.Header[k] = v
+		}
+		c.getM3U(ctx)
+		ctx.Writer.WriteHeaderNow() // as gin does once the handlers return
+		return w
+	}
+	// track index -> stream file, from ".../abcd/alice/secret/<index>/<file>"
+	routes := func(body string) map[int]string {
+		t.Helper()
+		out := map[int]string{}
+		for _, line := range strings.Split(body, "\n") {
+			if !strings.HasPrefix(line, "http") {
+				continue
+			}
+			u, err := url.Parse(line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+			if len(parts) != 5 || parts[0] != "abcd" || parts[1] != "alice" || parts[2] != "secret" {
+				t.Fatalf("track URL %q", line)
+			}
+			i, err := strconv.Atoi(parts[3])
+			if err != nil {
+				t.Fatalf("track URL %q", line)
+			}
+			out[i] = parts[4]
+		}
+		return out
+	}
+
+	w := get("include_groups=sport,news&exclude_groups=replay", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("filtered playlist answered %d", w.Code)
+	}
+	got := routes(w.Body.String())
+	if len(got) != 4 {
+		t.Errorf("filtered playlist has %d tracks, want 4: %v", len(got), got)
+	}
+	for i, file := range got {
+		if i >= len(tracks) {
+			t.Errorf("route %d serves %s, past the %d registered tracks", i, file, len(tracks))
+			continue
+		}
+		if path.Base(tracks[i].URI) != file {
+			t.Errorf("route %d serves %s, registered for %s", i, file, path.Base(tracks[i].URI))
+		}
+		if g := tracks[i].Tags[0].Value; g == "Sports Replay" || g == "Adult" {
+			t.Errorf("track of group %q kept", g)
+		}
+	}
+	if !strings.HasPrefix(w.Body.String(), "#EXTM3U\n") {
+		t.Errorf("filtered playlist lost its header:\n%s", w.Body.String())
+	}
+
+	full := get("", nil)
+	if all := routes(full.Body.String()); len(all) != len(tracks) {
+		t.Errorf("unfiltered playlist has %d tracks, want %d", len(all), len(tracks))
+	}
+	etag := w.Header().Get("ETag")
+	if etag == "" || etag == full.Header().Get("ETag") {
+		t.Errorf("filtered ETag %q, unfiltered %q", etag, full.Header().Get("ETag"))
+	}
+	if w := get("exclude_groups=replay&include_groups=sport,news", http.Header{"If-None-Match": {etag}}); w.Code != http.StatusNotModified {
+		t.Errorf("revalidated filtered playlist answered %d, want 304", w.Code)
+	}
+
+	xtreamM3uCacheLock.RLock()
+	cached := len(xtreamM3uCache)
+	xtreamM3uCacheLock.RUnlock()
+	if cached != 0 {
+		t.Errorf("%d playlist variants cached, want none", cached)
+	}
+}
+
+// TestFilteredGetPHP checks that get.php variants with different filters
+// share one provider fetch and one cache entry.
+func TestFilteredGetPHP(t *testing.T) {
+	t.Cleanup(dropCachedXtreamM3u)
+	var fetches atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Write([]byte("#EXTM3U\n" + // nolint: errcheck
+			"#EXTINF:-1 group-title=\"News\",Channel 1\nhttp://provider/live/puser/ppass/1.ts\n" +
+			"#EXTINF:-1 group-title=\"Sports\",Channel 2\nhttp://provider/live/puser/ppass/2.ts\n"))
+	}))
+	defer upstream.Close()
+
+	c := &Config{ProxyConfig: &config.ProxyConfig{
+		HostConfig:         &config.HostConfiguration{Hostname: "iptv.example", Port: 8080},
+		XtreamBaseURL:      upstream.URL,
+		XtreamUser:         "puser",
+		XtreamPassword:     "ppass",
+		User:               "alice",
+		Password:           "secret",
+		M3UCacheExpiration: 1,
+	}}
+	for i, tt := range []struct{ query, want, not string }{
+		{"include_groups=news", "/1.ts", "/2.ts"},
+		{"include_groups=sport", "/2.ts", "/1.ts"},
+		{"exclude_groups=news,x" + strconv.Itoa(1), "/2.ts", "/1.ts"},
+		{"exclude_groups=news,x" + strconv.Itoa(2), "/2.ts", "/1.ts"},
+		{"", "/1.ts", ""},
+	} {
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = httptest.NewRequest(http.MethodGet, "/get.php?username=alice&password=secret&type=m3u_plus&"+tt.query, nil)
+		c.xtreamGet(ctx)
+		body := w.Body.String()
+		if w.Code != http.StatusOK || !strings.Contains(body, tt.want) || (tt.not != "" && strings.Contains(body, tt.not)) {
+			t.Errorf("request %d (%s) answered %d:\n%s", i, tt.query, w.Code, body)
+		}
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("%d provider fetches, want 1", n)
+	}
+	xtreamM3uCacheLock.RLock()
+	cached := len(xtreamM3uCache)
+	xtreamM3uCacheLock.RUnlock()
+	if cached != 1 {
+		t.Errorf("%d playlists cached, want 1", cached)
+	}
+}
@@ -0,0 +1,145 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"compress/gzip"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// gzipJSON compresses the responses of the internal JSON API for clients that
+// accept gzip. Only textual bodies (JSON, CSV, text) are compressed, and a
+// body that already has a Content-Encoding is passed through. Never use it on
+// streaming routes: video doesn't shrink and buffering in the compressor
+// would delay delivery.
+func gzipJSON() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !acceptsGzip(ctx.Request.Header.Get("Accept-Encoding")) {
+			ctx.Next()
+			return
+		}
+		w := &gzipWriter{ResponseWriter: ctx.Writer}
+		ctx.Writer = w
+		defer w.finish(ctx.Request.URL.Path)
+		ctx.Next()
+	}
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip.
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "gzip" && name != "*" {
+			continue
+		}
+		// "gzip;q=0" explicitly refuses it
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if q, err := strconv.ParseFloat(v, 64); err == nil && q == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// compressibleType reports whether a Content-Type is worth compressing.
+func compressibleType(ct string) bool {
+	ct = strings.ToLower(ct)
+	return strings.Contains(ct, "json") || strings.HasPrefix(ct, "text/")
+}
+
+// gzipWriter decides on the first body write whether to compress, once the
+// handler has set Content-Type and any Content-Encoding of its own.
+type gzipWriter struct {
+	gin.ResponseWriter
+	gz      *gzip.Writer
+	decided bool
+	raw     int
+	out     countingWriter
+}
+
+// countingWriter counts the compressed bytes written to the client.
+type countingWriter struct {
+	w io.Writer
+	n int
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += n
+	return n, err
+}
+
+func (w *gzipWriter) decide() {
+	if w.decided {
+		return
+	}
+	w.decided = true
+	h := w.Header()
+	if h.Get("Content-Encoding") != "" || !compressibleType(h.Get("Content-Type")) {
+		return
+	}
+	h.Set("Content-Encoding", "gzip")
+	h.Add("Vary", "Accept-Encoding")
+	h.Del("Content-Length")
+	w.out = countingWriter{w: w.ResponseWriter}
+	w.gz = gzip.NewWriter(&w.out)
+}
+
+func (w *gzipWriter) Write(p []byte) (int, error) {
+	w.decide()
+	if w.gz == nil {
+		return w.ResponseWriter.Write(p)
+	}
+	w.raw += len(p)
+	return w.gz.Write(p)
+}
+
+func (w *gzipWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush pushes what the compressor holds so far to the client.
+func (w *gzipWriter) Flush() {
+	if w.gz != nil {
+		_ = w.gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// finish writes the gzip trailer and logs how much was saved.
+func (w *gzipWriter) finish(path string) {
+	if w.gz == nil {
+		return
+	}
+	if err := w.gz.Close(); err != nil {
+		utils.DebugLog("gzip %s: %v", path, err)
+		return
+	}
+	if w.raw > 0 {
+		utils.DebugLog("gzip %s: %d -> %d bytes (%.0f%% smaller)", path, w.raw, w.out.n, 100-float64(w.out.n)*100/float64(w.raw))
+	}
+}
@@ -0,0 +1,251 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucasduport/stream-share/pkg/types"
+	"github.com/lucasduport/stream-share/pkg/utils"
+	xtreamapi "github.com/lucasduport/stream-share/pkg/xtream"
+)
+
+// stopAllStreams force-stops every active stream (panic button). With
+// "block": true, new streams are refused until resumeStreams is called.
+func (c *Config) stopAllStreams(ctx *gin.Context) {
+	var req struct {
+		Block bool   `json:"block"`
+		Actor string `json:"actor"`
+	}
+	// Body is optional
+	_ = ctx.ShouldBindJSON(&req)
+
+	if c.sessionManager == nil {
+		reqLog(ctx).ErrorLog("Session manager is nil in stopAllStreams")
+		abortJSON(ctx, http.StatusInternalServerError, errCodeInternal, "Session manager not initialized")
+		return
+	}
+
+	stopped, viewers := c.sessionManager.StopAllStreams(req.Block)
+	utils.AuditLog(req.Actor, "streams.stopall", "ip=%s streams=%d viewers=%d block=%v", ctx.ClientIP(), stopped, viewers, req.Block)
+
+	ctx.JSON(http.StatusOK, types.APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Stopped %d streams, disconnected %d viewers", stopped, viewers),
+		Data: map[string]interface{}{
+			"streams_stopped":      stopped,
+			"viewers_disconnected": viewers,
+			"blocked":              c.sessionManager.StreamsBlocked(),
+		},
+	})
+}
+
+// stopStreamByID force-stops one active stream and disconnects its viewers.
+func (c *Config) stopStreamByID(ctx *gin.Context) {
+	var req struct {
+		Actor string `json:"actor"`
+	}
+	_ = ctx.ShouldBindJSON(&req)
+
+	if c.sessionManager == nil {
+		reqLog(ctx).ErrorLog("Session manager is nil in stopStreamByID")
+		abortJSON(ctx, http.StatusInternalServerError, errCodeInternal, "Session manager not initialized")
+		return
+	}
+
+	streamID := ctx.Param("id")
+	viewers, ok := c.sessionManager.StopStream(streamID)
+	if !ok {
+		abortJSON(ctx, http.StatusNotFound, errCodeStreamNotActive, fmt.Sprintf("Stream %s is not active", streamID))
+		return
+	}
+	utils.AuditLog(req.Actor, "streams.stop", "ip=%s stream=%s viewers=%d", ctx.ClientIP(), streamID, viewers)
+
+	ctx.JSON(http.StatusOK, types.APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Stopped stream %s, disconnected %d viewers", streamID, viewers),
+		Data: map[string]interface{}{
+			"stream_id":            streamID,
+			"viewers_disconnected": viewers,
+		},
+	})
+}
+
+// resumeStreams lifts a block placed by stopAllStreams.
+func (c *Config) resumeStreams(ctx *gin.Context) {
+	var req struct {
+		Actor string `json:"actor"`
+	}
+	_ = ctx.ShouldBindJSON(&req)
+
+	if c.sessionManager == nil {
+		reqLog(ctx).ErrorLog("Session manager is nil in resumeStreams")
+		abortJSON(ctx, http.StatusInternalServerError, errCodeInternal, "Session manager not initialized")
+		return
+	}
+
+	c.sessionManager.SetStreamsBlocked(false)
+	utils.AuditLog(req.Actor, "streams.resume", "ip=%s", ctx.ClientIP())
+
+	ctx.JSON(http.StatusOK, types.APIResponse{
+		Success: true,
+		Message: "New streams are allowed again",
+		Data:    map[string]interface{}{"blocked": false},
+	})
+}
+
+// flushAPICache drops the cached player_api catalog answers so the next
+// request refetches them from the provider.
+func (c *Config) flushAPICache(ctx *gin.Context) {
+	var req struct {
+		Actor string `json:"actor"`
+	}
+	_ = ctx.ShouldBindJSON(&req)
+
+	n := xtreamapi.FlushActionCache()
+	utils.AuditLog(req.Actor, "apicache.flush", "ip=%s entries=%d", ctx.ClientIP(), n)
+
+	ctx.JSON(http.StatusOK, types.APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Flushed %d cached API responses", n),
+		Data:    map[string]interface{}{"flushed": n},
+	})
+}
+
+// adminOverview returns every active stream with its viewers and, when
+// STREAM_QUALITY_METRICS is on, its delivery quality counters, along with
+// running cache downloads and recent warnings and errors.
+func (c *Config) adminOverview(ctx *gin.Context) {
+	if c.sessionManager == nil {
+		reqLog(ctx).ErrorLog("Session manager is nil in adminOverview")
+		abortJSON(ctx, http.StatusInternalServerError, errCodeInternal, "Session manager not initialized")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, types.APIResponse{
+		Success: true,
+		Data:    c.overviewData(),
+	})
+}
+
+// listSessions returns every user session, including the HLS rendition each
+// player picked (hls_variant), so admins can see who pulls 4K and who SD.
+func (c *Config) listSessions(ctx *gin.Context) {
+	if c.sessionManager == nil {
+		reqLog(ctx).ErrorLog("Session manager is nil in listSessions")
+		abortJSON(ctx, http.StatusInternalServerError, errCodeInternal, "Session manager not initialized")
+		return
+	}
+
+	all := c.sessionManager.GetAllSessions()
+	sort.Slice(all, func(i, j int) bool { return all[i].Username < all[j].Username })
+	sessions := make([]map[string]interface{}, 0, len(all))
+	for _, s := range all {
+		sessions = append(sessions, map[string]interface{}{
+			"username":     s.Username,
+			"discord_name": s.DiscordName,
+			"stream_id":    s.StreamID,
+			"stream_type":  s.StreamType,
+			"ip_address":   s.IPAddress,
+			"user_agent":   s.UserAgent,
+			"started_at":   s.StartTime,
+			"last_active":  s.LastActive,
+			"hls_variant":  s.HLSVariant,
+		})
+	}
+
+	ctx.JSON(http.StatusOK, types.APIResponse{Success: true, Data: sessions})
+}
+
+// overviewData gathers what adminOverview and the dashboard show: active
+// streams with their viewers, running cache downloads and recent errors.
+func (c *Config) overviewData() map[string]interface{} {
+	quality := c.sessionManager.StreamQuality()
+	streams := make([]map[string]interface{}, 0)
+	for _, s := range c.sessionManager.GetAllStreams() {
+		if !s.Active {
+			continue
+		}
+		viewers := s.GetViewers()
+		names := make([]string, 0, len(viewers))
+		for u := range viewers {
+			names = append(names, u)
+		}
+		item := map[string]interface{}{
+			"stream_id":    s.StreamID,
+			"stream_type":  s.StreamType,
+			"stream_title": s.StreamTitle,
+			"viewers":      names,
+			"started_at":   s.StartTime,
+			"duration":     time.Since(s.StartTime).Truncate(time.Second).String(),
+		}
+		if q, ok := quality[s.StreamID]; ok {
+			item["quality"] = q
+		}
+		streams = append(streams, item)
+	}
+
+	var list []types.VODCacheEntry
+	if c.db != nil {
+		var err error
+		if list, err = c.db.ListVODCache(0); err != nil {
+			utils.WarnLog("Overview: failed to list cache downloads: %v", err)
+		}
+	}
+	downloads := downloadsOverview(list)
+
+	return map[string]interface{}{
+		"streams":         streams,
+		"downloads":       downloads,
+		"recent_errors":   utils.RecentLogs(),
+		"users_count":     len(c.sessionManager.GetAllSessions()),
+		"recordings":      len(c.sessionManager.ListRecordings()),
+		"streams_blocked": c.sessionManager.StreamsBlocked(),
+		"quality_metrics": envFlag("STREAM_QUALITY_METRICS", false),
+	}
+}
+
+// downloadsOverview lists the cache entries still downloading with their progress.
+func downloadsOverview(list []types.VODCacheEntry) []map[string]interface{} {
+	downloads := make([]map[string]interface{}, 0)
+	for _, e := range list {
+		if e.Status != "downloading" {
+			continue
+		}
+		percent := 0.0
+		if e.TotalBytes > 0 {
+			percent = float64(e.DownloadedBytes) * 100 / float64(e.TotalBytes)
+		}
+		downloads = append(downloads, map[string]interface{}{
+			"stream_id":        e.StreamID,
+			"type":             e.Type,
+			"title":            e.Title,
+			"requested_by":     e.RequestedBy,
+			"origin_command":   e.OriginCommand,
+			"downloaded_bytes": e.DownloadedBytes,
+			"total_bytes":      e.TotalBytes,
+			"percent":          percent,
+		})
+	}
+	return downloads
+}
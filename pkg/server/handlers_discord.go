@@ -23,12 +23,11 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/lucasduport/stream-share/pkg/types"
-	"github.com/lucasduport/stream-share/pkg/utils"
 )
 
 // linkDiscordUser links a Discord user ID to an LDAP username
 func (c *Config) linkDiscordUser(ctx *gin.Context) {
-	utils.DebugLog("API: Request to link Discord user to LDAP")
+	reqLog(ctx).DebugLog("API: Request to link Discord user to LDAP")
 
 	var req struct {
 		DiscordID   string `json:"discord_id"`
@@ -38,35 +37,26 @@ func (c *Config) linkDiscordUser(ctx *gin.Context) {
 	}
 
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		utils.ErrorLog("API: Invalid Discord link request: %v", err)
-		ctx.JSON(http.StatusBadRequest, types.APIResponse{
-			Success: false,
-			Error:   "Invalid request: " + err.Error(),
-		})
+		reqLog(ctx).ErrorLog("API: Invalid Discord link request: %v", err)
+		abortJSON(ctx, http.StatusBadRequest, errCodeBadRequest, "Invalid request: "+err.Error())
 		return
 	}
 
-	utils.DebugLog("API: Linking Discord ID %s (%s) to LDAP user %s", req.DiscordID, req.DiscordName, req.LDAPUser)
+	reqLog(ctx).DebugLog("API: Linking Discord ID %s (%s) to LDAP user %s", req.DiscordID, req.DiscordName, req.LDAPUser)
 
 	if c.db == nil {
-		utils.ErrorLog("Database is nil in linkDiscordUser")
-		ctx.JSON(http.StatusInternalServerError, types.APIResponse{
-			Success: false,
-			Error:   "Database not initialized",
-		})
+		reqLog(ctx).ErrorLog("Database is nil in linkDiscordUser")
+		abortJSON(ctx, http.StatusInternalServerError, errCodeDatabaseUnavailable, "Database not initialized")
 		return
 	}
 
 	if err := c.db.LinkDiscordToLDAP(req.DiscordID, req.DiscordName, req.LDAPUser); err != nil {
-		utils.ErrorLog("API: Failed to link Discord to LDAP: %v", err)
-		ctx.JSON(http.StatusInternalServerError, types.APIResponse{
-			Success: false,
-			Error:   "Failed to link accounts: " + err.Error(),
-		})
+		reqLog(ctx).ErrorLog("API: Failed to link Discord to LDAP: %v", err)
+		abortJSON(ctx, http.StatusInternalServerError, errCodeInternal, "Failed to link accounts: "+err.Error())
 		return
 	}
 
-	utils.InfoLog("Successfully linked Discord ID %s (%s) to LDAP user %s", req.DiscordID, req.DiscordName, req.LDAPUser)
+	reqLog(ctx).InfoLog("Successfully linked Discord ID %s (%s) to LDAP user %s", req.DiscordID, req.DiscordName, req.LDAPUser)
 
 	ctx.JSON(http.StatusOK, types.APIResponse{
 		Success: true,
@@ -79,31 +69,54 @@ func (c *Config) linkDiscordUser(ctx *gin.Context) {
 	})
 }
 
+// unlinkDiscordUser removes the LDAP mapping of a Discord ID
+func (c *Config) unlinkDiscordUser(ctx *gin.Context) {
+	discordID := ctx.Param("discordid")
+	reqLog(ctx).DebugLog("API: Unlinking Discord ID: %s", discordID)
+
+	if c.db == nil {
+		reqLog(ctx).ErrorLog("Database is nil in unlinkDiscordUser")
+		abortJSON(ctx, http.StatusInternalServerError, errCodeDatabaseUnavailable, "Database not initialized")
+		return
+	}
+
+	ldapUser, err := c.db.DeleteDiscordLDAPMapping(discordID)
+	if err != nil {
+		abortJSON(ctx, http.StatusInternalServerError, errCodeInternal, "Failed to unlink account: "+err.Error())
+		return
+	}
+	if ldapUser != "" && c.sessionManager != nil {
+		c.sessionManager.ClearDiscordInfo(ldapUser)
+	}
+
+	ctx.JSON(http.StatusOK, types.APIResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"unlinked":  ldapUser != "",
+			"ldap_user": ldapUser,
+		},
+	})
+}
+
 // getLDAPFromDiscord gets the LDAP username for a Discord ID
 func (c *Config) getLDAPFromDiscord(ctx *gin.Context) {
 	discordID := ctx.Param("discordid")
-	utils.DebugLog("API: Getting LDAP user for Discord ID: %s", discordID)
+	reqLog(ctx).DebugLog("API: Getting LDAP user for Discord ID: %s", discordID)
 
 	if c.db == nil {
-		utils.ErrorLog("Database is nil in getLDAPFromDiscord")
-		ctx.JSON(http.StatusInternalServerError, types.APIResponse{
-			Success: false,
-			Error:   "Database not initialized",
-		})
+		reqLog(ctx).ErrorLog("Database is nil in getLDAPFromDiscord")
+		abortJSON(ctx, http.StatusInternalServerError, errCodeDatabaseUnavailable, "Database not initialized")
 		return
 	}
 
 	ldapUser, err := c.db.GetLDAPUserByDiscordID(discordID)
 	if err != nil {
-		utils.DebugLog("API: Discord user not linked: %v", err)
-		ctx.JSON(http.StatusNotFound, types.APIResponse{
-			Success: false,
-			Error:   "Discord user not linked: " + err.Error(),
-		})
+		reqLog(ctx).DebugLog("API: Discord user not linked: %v", err)
+		abortJSON(ctx, http.StatusNotFound, errCodeNotFound, "Discord user not linked: "+err.Error())
 		return
 	}
 
-	utils.DebugLog("API: Found LDAP user %s for Discord ID %s", ldapUser, discordID)
+	reqLog(ctx).DebugLog("API: Found LDAP user %s for Discord ID %s", ldapUser, discordID)
 	ctx.JSON(http.StatusOK, types.APIResponse{
 		Success: true,
 		Data: map[string]string{
@@ -0,0 +1,131 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucasduport/stream-share/pkg/database"
+	"github.com/lucasduport/stream-share/pkg/types"
+)
+
+// listStreamHistory returns one page of stream history.
+// Query: username, limit (<=500), cursor (next_cursor of the previous page).
+func (c *Config) listStreamHistory(ctx *gin.Context) {
+	if c.db == nil {
+		abortJSON(ctx, http.StatusInternalServerError, errCodeDatabaseUnavailable, "Database not initialized")
+		return
+	}
+	cursor, _ := strconv.ParseInt(ctx.Query("cursor"), 10, 64)
+	limit, _ := strconv.Atoi(ctx.DefaultQuery("limit", "100"))
+
+	entries, next, err := c.db.ListStreamHistory(ctx.Query("username"), cursor, limit)
+	if err != nil {
+		abortJSON(ctx, http.StatusInternalServerError, errCodeInternal, err.Error())
+		return
+	}
+	ctx.JSON(http.StatusOK, types.APIResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"entries":     entries,
+			"next_cursor": next,
+		},
+	})
+}
+
+// getUserStreamHistory returns a user's most recent streams (limit <= 500, default 20).
+func (c *Config) getUserStreamHistory(ctx *gin.Context) {
+	if c.db == nil {
+		abortJSON(ctx, http.StatusInternalServerError, errCodeDatabaseUnavailable, "Database not initialized")
+		return
+	}
+	limit, _ := strconv.Atoi(ctx.DefaultQuery("limit", "20"))
+	entries, err := c.db.GetUserStreamHistory(ctx.Param("username"), limit)
+	if err != nil {
+		abortJSON(ctx, http.StatusInternalServerError, errCodeInternal, err.Error())
+		return
+	}
+	ctx.JSON(http.StatusOK, types.APIResponse{Success: true, Data: entries})
+}
+
+// exportStreamHistoryCSV streams the whole history as CSV, page by page, so the
+// table is never loaded into memory at once. gzip=1 compresses the download.
+func (c *Config) exportStreamHistoryCSV(ctx *gin.Context) {
+	if c.db == nil {
+		abortJSON(ctx, http.StatusInternalServerError, errCodeDatabaseUnavailable, "Database not initialized")
+		return
+	}
+	username := ctx.Query("username")
+	compress := ctx.Query("gzip") == "1" || ctx.Query("gzip") == "true"
+
+	filename := "stream_history_" + time.Now().Format("20060102_150405") + ".csv"
+	var out io.Writer = ctx.Writer
+	if compress {
+		ctx.Header("Content-Type", "application/gzip")
+		ctx.Header("Content-Disposition", `attachment; filename="`+filename+`.gz"`)
+		gz := gzip.NewWriter(ctx.Writer)
+		defer gz.Close()
+		out = gz
+	} else {
+		ctx.Header("Content-Type", "text/csv; charset=utf-8")
+		ctx.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	}
+	ctx.Status(http.StatusOK)
+
+	w := csv.NewWriter(out)
+	_ = w.Write([]string{"id", "username", "discord_id", "stream_id", "stream_type", "stream_title", "start_time", "end_time", "ip_address", "user_agent"})
+
+	var cursor int64
+	rows := 0
+	for {
+		entries, next, err := c.db.ListStreamHistory(username, cursor, database.MaxHistoryPageSize)
+		if err != nil {
+			// Headers are already sent; log and truncate the export
+			reqLog(ctx).ErrorLog("History export aborted after %d rows: %v", rows, err)
+			break
+		}
+		for _, e := range entries {
+			end := ""
+			if e.EndTime != nil {
+				end = e.EndTime.UTC().Format(time.RFC3339)
+			}
+			_ = w.Write([]string{
+				strconv.FormatInt(e.ID, 10), e.Username, e.DiscordID, e.StreamID, e.StreamType, e.StreamTitle,
+				e.StartTime.UTC().Format(time.RFC3339), end, e.IPAddress, e.UserAgent,
+			})
+		}
+		rows += len(entries)
+		w.Flush()
+		if err := w.Error(); err != nil {
+			reqLog(ctx).WarnLog("History export: client write failed after %d rows: %v", rows, err)
+			return
+		}
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+	reqLog(ctx).DebugLog("History export: wrote %d rows", rows)
+}
@@ -0,0 +1,181 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucasduport/stream-share/pkg/session"
+	"github.com/lucasduport/stream-share/pkg/types"
+	"github.com/lucasduport/stream-share/pkg/utils"
+	xtreamapi "github.com/lucasduport/stream-share/pkg/xtream"
+)
+
+// maxRecordingMinutes caps a single recording request.
+const maxRecordingMinutes = 6 * 60
+
+// resolveLiveStreamID turns a channel number or name into a live stream ID,
+// trying the M3U channel index first and then the provider's live list.
+func (c *Config) resolveLiveStreamID(channel string) (string, string, error) {
+	channel = strings.TrimSpace(channel)
+	if _, err := strconv.Atoi(normalizeStreamID(channel)); err == nil {
+		id := normalizeStreamID(channel)
+		name, _ := c.getChannelNameByID(id)
+		return id, name, nil
+	}
+	if id, ok := c.findChannelIDByName(channel); ok {
+		name, _ := c.getChannelNameByID(id)
+		return id, name, nil
+	}
+
+	cli, err := xtreamapi.New(c.XtreamUser.String(), c.XtreamPassword.String(), c.XtreamBaseURL, utils.UserAgentFor(c.XtreamBaseURL))
+	if err != nil {
+		return "", "", err
+	}
+	resp, _, _, err := cli.Action(c.ProxyConfig, "get_live_streams", url.Values{})
+	if err != nil {
+		return "", "", err
+	}
+	arr, _ := resp.([]interface{})
+	names := make(map[string]string, len(arr))
+	for _, it := range arr {
+		if m, ok := it.(map[string]interface{}); ok {
+			names[fmt.Sprintf("%v", m["stream_id"])] = fmt.Sprintf("%v", m["name"])
+		}
+	}
+	if id, ok := matchChannelName(names, channel); ok {
+		return id, names[id], nil
+	}
+	return "", "", fmt.Errorf("no unique live channel matches %q", channel)
+}
+
+// startRecording opens a live channel and records it to the cache folder.
+func (c *Config) startRecording(ctx *gin.Context) {
+	var req struct {
+		Channel  string `json:"channel"`
+		Minutes  int    `json:"minutes"`
+		Username string `json:"username"`
+		// Bot command and message/interaction id that asked for the recording
+		OriginCommand   string `json:"origin_command"`
+		OriginMessageID string `json:"origin_message_id"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		abortJSON(ctx, http.StatusBadRequest, errCodeBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+	if req.Minutes <= 0 || req.Minutes > maxRecordingMinutes {
+		abortJSON(ctx, http.StatusBadRequest, errCodeInvalidParameter, fmt.Sprintf("minutes must be between 1 and %d", maxRecordingMinutes))
+		return
+	}
+	if strings.TrimSpace(req.Channel) == "" {
+		abortJSON(ctx, http.StatusBadRequest, errCodeInvalidParameter, "channel is required")
+		return
+	}
+	if c.sessionManager == nil {
+		reqLog(ctx).ErrorLog("Session manager is nil in startRecording")
+		abortJSON(ctx, http.StatusInternalServerError, errCodeInternal, "Session manager not initialized")
+		return
+	}
+
+	id, name, err := c.resolveLiveStreamID(req.Channel)
+	if err != nil {
+		abortJSON(ctx, http.StatusNotFound, errCodeNotFound, err.Error())
+		return
+	}
+	if name == "" {
+		name = "Channel " + id
+	}
+
+	// Same key as the multiplexed /live/ handler so viewers and the recorder share one upstream
+	streamID := id + ".ts"
+	upstream, err := url.Parse(fmt.Sprintf("%s/live/%s/%s/%s", c.XtreamBaseURL, c.XtreamUser, c.XtreamPassword, streamID))
+	if err != nil {
+		abortError(ctx, http.StatusInternalServerError, errCodeInternal, "Could not build upstream URL", err)
+		return
+	}
+	if err := c.sessionManager.OpenStream(streamID, "live", name, upstream); err != nil {
+		if errors.Is(err, session.ErrStreamsBlocked) {
+			abortJSON(ctx, http.StatusServiceUnavailable, errCodeStreamsBlocked, err.Error())
+			return
+		}
+		abortJSON(ctx, http.StatusInternalServerError, errCodeUpstreamError, err.Error())
+		return
+	}
+
+	dest := filepath.Join(cacheDir(), "recordings", fmt.Sprintf("%s-%s.ts", id, time.Now().Format("20060102-1504")))
+
+	rec, err := c.sessionManager.StartRecording(streamID, time.Duration(req.Minutes)*time.Minute, dest)
+	if err != nil {
+		abortJSON(ctx, http.StatusInternalServerError, errCodeInternal, err.Error())
+		return
+	}
+	originCmd, originMsg := requestOrigin(req.OriginCommand, req.OriginMessageID)
+	c.sessionManager.SetRecordingOrigin(rec.ID, originCmd, originMsg)
+	c.sessionManager.SetRecordingRequester(rec.ID, req.Username, name)
+	utils.AuditLog(req.Username, "recording.start", "channel=%s minutes=%d id=%s origin=%s", id, req.Minutes, rec.ID, formatOrigin(originCmd, originMsg))
+
+	ctx.JSON(http.StatusOK, types.APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Recording %s for %d minutes", name, req.Minutes),
+		Data: map[string]interface{}{
+			"id":        rec.ID,
+			"stream_id": id,
+			"title":     name,
+			"ends_at":   rec.EndsAt,
+		},
+	})
+}
+
+// stopRecording ends a running recording early and keeps what was captured.
+func (c *Config) stopRecording(ctx *gin.Context) {
+	id := ctx.Param("id")
+	if c.sessionManager == nil || !c.sessionManager.StopRecording(id) {
+		abortJSON(ctx, http.StatusNotFound, errCodeNotFound, "Recording not found")
+		return
+	}
+	ctx.JSON(http.StatusOK, types.APIResponse{Success: true, Message: "Recording stopped", Data: map[string]interface{}{"id": id}})
+}
+
+// listRecordings returns the recordings in progress; finished ones are in /cache/list.
+func (c *Config) listRecordings(ctx *gin.Context) {
+	if c.sessionManager == nil {
+		ctx.JSON(http.StatusOK, types.APIResponse{Success: true, Data: []interface{}{}})
+		return
+	}
+	out := make([]map[string]interface{}, 0)
+	for _, rec := range c.sessionManager.ListRecordings() {
+		out = append(out, map[string]interface{}{
+			"id":            rec.ID,
+			"stream_id":     rec.StreamID,
+			"file_path":     rec.FilePath,
+			"started_at":    rec.StartedAt,
+			"ends_at":       rec.EndsAt,
+			"bytes_written": rec.BytesWritten(),
+		})
+	}
+	ctx.JSON(http.StatusOK, types.APIResponse{Success: true, Data: out})
+}
@@ -21,22 +21,20 @@ package server
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/lucasduport/stream-share/pkg/types"
-	"github.com/lucasduport/stream-share/pkg/utils"
+	xtreamapi "github.com/lucasduport/stream-share/pkg/xtream"
 )
 
 // statusSummary returns a compact summary of who is watching what
 func (c *Config) statusSummary(ctx *gin.Context) {
 	if c.sessionManager == nil {
-		utils.ErrorLog("Session manager is nil in statusSummary")
-		ctx.JSON(http.StatusInternalServerError, types.APIResponse{
-			Success: false,
-			Error:   "Session manager not initialized",
-		})
+		reqLog(ctx).ErrorLog("Session manager is nil in statusSummary")
+		abortJSON(ctx, http.StatusInternalServerError, errCodeInternal, "Session manager not initialized")
 		return
 	}
 
@@ -124,3 +122,52 @@ func (c *Config) statusSummary(ctx *gin.Context) {
 		},
 	})
 }
+
+// upstreamPing times the provider's player_api.php login call and get.php
+// playlist endpoint, and reports how old the cached M3U is.
+func (c *Config) upstreamPing(ctx *gin.Context) {
+	client, err := xtreamapi.New(c.XtreamUser.String(), c.XtreamPassword.String(), c.XtreamBaseURL, "")
+	if err != nil {
+		abortJSON(ctx, http.StatusInternalServerError, errCodeInternal, err.Error())
+		return
+	}
+
+	probe := func(path string, q url.Values) map[string]interface{} {
+		status, latency, err := client.Probe(ctx.Request.Context(), path, q)
+		out := map[string]interface{}{"status": status, "latency_ms": latency.Milliseconds()}
+		if err != nil {
+			out["error"] = err.Error()
+		}
+		return out
+	}
+	playerAPI := probe("player_api.php", nil)
+	getPHP := probe("get.php", url.Values{"type": {"m3u_plus"}, "output": {"ts"}})
+
+	// The newest cached playlist tells whether clients are served fresh data
+	cache := map[string]interface{}{"cached": false}
+	xtreamM3uCacheLock.RLock()
+	var newest time.Time
+	for _, meta := range xtreamM3uCache {
+		if meta.Time.After(newest) {
+			newest = meta.Time
+		}
+	}
+	xtreamM3uCacheLock.RUnlock()
+	if !newest.IsZero() {
+		age := time.Since(newest)
+		cache["cached"] = true
+		cache["age_seconds"] = int64(age.Seconds())
+		cache["fresh"] = age.Hours() < float64(c.M3UCacheExpiration)
+	}
+
+	ctx.JSON(http.StatusOK, types.APIResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"up":              playerAPI["status"] == http.StatusOK,
+			"player_api":      playerAPI,
+			"get_php":         getPHP,
+			"m3u_cache_hours": c.M3UCacheExpiration,
+			"m3u_cache":       cache,
+		},
+	})
+}
@@ -21,27 +21,24 @@ package server
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/lucasduport/stream-share/pkg/types"
-	"github.com/lucasduport/stream-share/pkg/utils"
 )
 
 // getAllUsers returns information about all active users
 func (c *Config) getAllUsers(ctx *gin.Context) {
-	utils.DebugLog("API: Getting all users")
+	reqLog(ctx).DebugLog("API: Getting all users")
 
 	if c.sessionManager == nil {
-		utils.ErrorLog("Session manager is nil in getAllUsers")
-		ctx.JSON(http.StatusInternalServerError, types.APIResponse{
-			Success: false,
-			Error:   "Session manager not initialized",
-		})
+		reqLog(ctx).ErrorLog("Session manager is nil in getAllUsers")
+		abortJSON(ctx, http.StatusInternalServerError, errCodeInternal, "Session manager not initialized")
 		return
 	}
 
 	sessions := c.sessionManager.GetAllSessions()
-	utils.DebugLog("API: Found %d active user sessions", len(sessions))
+	reqLog(ctx).DebugLog("API: Found %d active user sessions", len(sessions))
 
 	ctx.JSON(http.StatusOK, types.APIResponse{
 		Success: true,
@@ -52,28 +49,22 @@ func (c *Config) getAllUsers(ctx *gin.Context) {
 // getUserInfo returns information about a specific user
 func (c *Config) getUserInfo(ctx *gin.Context) {
 	username := ctx.Param("username")
-	utils.DebugLog("API: Getting info for user: %s", username)
+	reqLog(ctx).DebugLog("API: Getting info for user: %s", username)
 
 	if c.sessionManager == nil {
-		utils.ErrorLog("Session manager is nil in getUserInfo")
-		ctx.JSON(http.StatusInternalServerError, types.APIResponse{
-			Success: false,
-			Error:   "Session manager not initialized",
-		})
+		reqLog(ctx).ErrorLog("Session manager is nil in getUserInfo")
+		abortJSON(ctx, http.StatusInternalServerError, errCodeInternal, "Session manager not initialized")
 		return
 	}
 
 	session := c.sessionManager.GetUserSession(username)
 	if session == nil {
-		utils.DebugLog("API: User not found: %s", username)
-		ctx.JSON(http.StatusNotFound, types.APIResponse{
-			Success: false,
-			Error:   "User not found",
-		})
+		reqLog(ctx).DebugLog("API: User not found: %s", username)
+		abortJSON(ctx, http.StatusNotFound, errCodeNotFound, "User not found")
 		return
 	}
 
-	utils.DebugLog("API: Found user session for %s, streaming: %s", username, session.StreamID)
+	reqLog(ctx).DebugLog("API: Found user session for %s, streaming: %s", username, session.StreamID)
 	ctx.JSON(http.StatusOK, types.APIResponse{
 		Success: true,
 		Data:    session,
@@ -83,19 +74,17 @@ func (c *Config) getUserInfo(ctx *gin.Context) {
 // disconnectUser forcibly disconnects a user from all streams
 func (c *Config) disconnectUser(ctx *gin.Context) {
 	username := ctx.Param("username")
-	utils.DebugLog("API: Disconnecting user: %s", username)
+	reqLog(ctx).DebugLog("API: Disconnecting user: %s", username)
 
 	if c.sessionManager == nil {
-		utils.ErrorLog("Session manager is nil in disconnectUser")
-		ctx.JSON(http.StatusInternalServerError, types.APIResponse{
-			Success: false,
-			Error:   "Session manager not initialized",
-		})
+		reqLog(ctx).ErrorLog("Session manager is nil in disconnectUser")
+		abortJSON(ctx, http.StatusInternalServerError, errCodeInternal, "Session manager not initialized")
 		return
 	}
 
 	c.sessionManager.DisconnectUser(username)
-	utils.InfoLog("User %s forcibly disconnected via API", username)
+	invalidateLDAPCache(username)
+	reqLog(ctx).InfoLog("User %s forcibly disconnected via API", username)
 
 	ctx.JSON(http.StatusOK, types.APIResponse{
 		Success: true,
@@ -106,38 +95,58 @@ func (c *Config) disconnectUser(ctx *gin.Context) {
 // timeoutUser temporarily blocks a user for a specified duration
 func (c *Config) timeoutUser(ctx *gin.Context) {
 	username := ctx.Param("username")
-	utils.DebugLog("API: Timeout request for user: %s", username)
+	reqLog(ctx).DebugLog("API: Timeout request for user: %s", username)
 
 	var req struct {
 		Minutes int `json:"minutes"`
 	}
 
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		utils.ErrorLog("API: Invalid timeout request: %v", err)
-		ctx.JSON(http.StatusBadRequest, types.APIResponse{
-			Success: false,
-			Error:   "Invalid request: " + err.Error(),
-		})
+		reqLog(ctx).ErrorLog("API: Invalid timeout request: %v", err)
+		abortJSON(ctx, http.StatusBadRequest, errCodeBadRequest, "Invalid request: "+err.Error())
 		return
 	}
 
 	if c.sessionManager == nil {
-		utils.ErrorLog("Session manager is nil in timeoutUser")
-		ctx.JSON(http.StatusInternalServerError, types.APIResponse{
-			Success: false,
-			Error:   "Session manager not initialized",
-		})
+		reqLog(ctx).ErrorLog("Session manager is nil in timeoutUser")
+		abortJSON(ctx, http.StatusInternalServerError, errCodeInternal, "Session manager not initialized")
 		return
 	}
 
-	// Disconnect the user
-	c.sessionManager.DisconnectUser(username)
-	utils.InfoLog("User %s timed out for %d minutes", username, req.Minutes)
+	if req.Minutes <= 0 {
+		abortJSON(ctx, http.StatusBadRequest, errCodeInvalidParameter, "minutes must be a positive number")
+		return
+	}
 
-	// TODO: Implement actual timeout mechanism
+	until := c.sessionManager.TimeoutUser(username, time.Duration(req.Minutes)*time.Minute)
+	c.sessionManager.DisconnectUser(username)
+	reqLog(ctx).InfoLog("User %s timed out for %d minutes", username, req.Minutes)
 
 	ctx.JSON(http.StatusOK, types.APIResponse{
 		Success: true,
 		Message: fmt.Sprintf("User %s timed out for %d minutes", username, req.Minutes),
+		Data:    map[string]interface{}{"until": until},
+	})
+}
+
+// untimeoutUser lifts a timeout before it runs out.
+func (c *Config) untimeoutUser(ctx *gin.Context) {
+	username := ctx.Param("username")
+
+	if c.sessionManager == nil {
+		reqLog(ctx).ErrorLog("Session manager is nil in untimeoutUser")
+		abortJSON(ctx, http.StatusInternalServerError, errCodeInternal, "Session manager not initialized")
+		return
+	}
+
+	if !c.sessionManager.ClearUserTimeout(username) {
+		abortJSON(ctx, http.StatusNotFound, errCodeNotFound, fmt.Sprintf("User %s is not timed out", username))
+		return
+	}
+	reqLog(ctx).InfoLog("Timeout of user %s lifted", username)
+
+	ctx.JSON(http.StatusOK, types.APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Timeout of user %s lifted", username),
 	})
 }
@@ -31,7 +31,6 @@ import (
 	"time"
 	"io"
 	"strconv"
-	"sort"
 	"sync"
 
 	"github.com/gin-gonic/gin"
@@ -40,15 +39,19 @@ import (
 	"github.com/lucasduport/stream-share/pkg/utils"
 )
 
-// Optional timeout-aware session manager interface (non-breaking)
-type timeoutAware interface {
-	// Returns (true, until) when user is timed out; (false, zeroTime) otherwise.
-	IsUserTimedOut(username string) (bool, time.Time)
+// rejectTimedOut answers 403 and returns true when username is timed out.
+func (c *Config) rejectTimedOut(ctx *gin.Context, username, action string) bool {
+	if c.sessionManager == nil || username == "" { return false }
+	timedOut, until := c.sessionManager.IsUserTimedOut(username)
+	if !timedOut { return false }
+	reqLog(ctx).WarnLog("%s blocked for timed-out user %s (until %s)", action, username, until.Format(time.RFC3339))
+	abortJSON(ctx, http.StatusForbidden, errCodeUserTimedOut, fmt.Sprintf("User '%s' is currently timed out until %s", username, until.Format(time.RFC3339)))
+	return true
 }
 
 // searchVOD searches for VOD content matching the query
 func (c *Config) searchVOD(ctx *gin.Context) {
-	utils.DebugLog("API: VOD search request received")
+	reqLog(ctx).DebugLog("API: VOD search request received")
 
 	var req struct {
 		Username string `json:"username"`
@@ -56,41 +59,24 @@ func (c *Config) searchVOD(ctx *gin.Context) {
 	}
 
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		utils.ErrorLog("API: Invalid VOD search request: %v", err)
-		ctx.JSON(http.StatusBadRequest, types.APIResponse{
-			Success: false,
-			Error:   "Invalid request: " + err.Error(),
-		})
+		reqLog(ctx).ErrorLog("API: Invalid VOD search request: %v", err)
+		abortJSON(ctx, http.StatusBadRequest, errCodeBadRequest, "Invalid request: "+err.Error())
 		return
 	}
 
-	utils.DebugLog("API: Searching VOD for user %s, query: %s", req.Username, req.Query)
+	reqLog(ctx).DebugLog("API: Searching VOD for user %s, query: %s", req.Username, req.Query)
 
 	// Enforce timeout if supported by session manager
-	if c.sessionManager != nil {
-		if sm, ok := interface{}(c.sessionManager).(timeoutAware); ok {
-			if timedOut, until := sm.IsUserTimedOut(req.Username); timedOut {
-				utils.WarnLog("API: VOD search blocked for timed-out user %s (until %s)", req.Username, until.Format(time.RFC3339))
-				ctx.JSON(http.StatusForbidden, types.APIResponse{
-					Success: false,
-					Error:   fmt.Sprintf("User '%s' is currently timed out until %s", req.Username, until.Format(time.RFC3339)),
-				})
-				return
-			}
-		}
-	}
+	if c.rejectTimedOut(ctx, req.Username, "VOD search") { return }
 
-	results, err := c.searchXtreamVOD(req.Query)
+	results, err := c.searchXtreamVOD(reqLog(ctx), req.Query)
 	if err != nil {
-		utils.ErrorLog("API: VOD search failed: %v", err)
-		ctx.JSON(http.StatusInternalServerError, types.APIResponse{
-			Success: false,
-			Error:   "Failed to search VOD: " + err.Error(),
-		})
+		reqLog(ctx).ErrorLog("API: VOD search failed: %v", err)
+		abortJSON(ctx, http.StatusInternalServerError, errCodeInternal, "Failed to search VOD: "+err.Error())
 		return
 	}
 
-	utils.DebugLog("API: Found %d VOD results for query: %s", len(results), req.Query)
+	reqLog(ctx).DebugLog("API: Found %d VOD results for query: %s", len(results), req.Query)
 
 	token := uuid.New().String()
 	vodRequest := &types.VODRequest{
@@ -102,7 +88,9 @@ func (c *Config) searchVOD(ctx *gin.Context) {
 		Token:     token,
 	}
 
-	// TODO: Store the VOD request in the database
+	if c.sessionManager != nil {
+		c.sessionManager.StoreVODRequest(vodRequest)
+	}
 
 	ctx.JSON(http.StatusOK, types.APIResponse{
 		Success: true,
@@ -114,20 +102,31 @@ func (c *Config) searchVOD(ctx *gin.Context) {
 	})
 }
 
+// maxEnrichPerPage bounds how many results one /vod/enrich call probes.
+const maxEnrichPerPage = 50
+
 // enrichVODPage enriches only the current page of VOD results with metadata that may be slow to compute (e.g., size).
-// It takes the full result list with minimal fields and returns the same list with the specified page enriched.
+// It takes the full result list with minimal fields and returns the same list, in the same order, with the specified page enriched.
+// The caller is identified by username or discord_id so timed-out users are refused like on the other VOD endpoints.
 func (c *Config) enrichVODPage(ctx *gin.Context) {
 	var req struct {
-		Query   string           `json:"query"`
-		Results []types.VODResult `json:"results"`
-		Page    int              `json:"page"`
-		PerPage int              `json:"per_page"`
+		Username  string            `json:"username"`
+		DiscordID string            `json:"discord_id"`
+		Query     string            `json:"query"`
+		Results   []types.VODResult `json:"results"`
+		Page      int               `json:"page"`
+		PerPage   int               `json:"per_page"`
 	}
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, types.APIResponse{Success: false, Error: "Invalid request: " + err.Error()})
+		abortJSON(ctx, http.StatusBadRequest, errCodeBadRequest, "Invalid request: "+err.Error())
 		return
 	}
+	if req.Username == "" && req.DiscordID != "" && c.db != nil {
+		req.Username, _ = c.db.GetLDAPUserByDiscordID(req.DiscordID)
+	}
+	if c.rejectTimedOut(ctx, req.Username, "VOD enrich") { return }
 	if req.PerPage <= 0 { req.PerPage = 25 }
+	if req.PerPage > maxEnrichPerPage { req.PerPage = maxEnrichPerPage }
 	total := len(req.Results)
 	if total == 0 {
 		ctx.JSON(http.StatusOK, types.APIResponse{Success: true, Data: map[string]interface{}{"results": req.Results}})
@@ -143,7 +142,7 @@ func (c *Config) enrichVODPage(ctx *gin.Context) {
 
 	// Build an index of movie streamID -> extension from the cached VOD M3U once
 	extIndex := map[string]string{}
-	if m3uPath, err := c.ensureVODM3UCache(); err == nil {
+	if m3uPath, err := c.ensureVODM3UCache(reqLog(ctx)); err == nil {
 		if idx, err2 := parseVODM3UExtensions(m3uPath); err2 == nil { extIndex = idx }
 	}
 	// Shared HTTP client with per-request timeout
@@ -185,7 +184,7 @@ func (c *Config) enrichVODPage(ctx *gin.Context) {
 				// Range GET
 				reqHTTP, _ := http.NewRequest("GET", vodURL, nil)
 				reqHTTP.Header.Set("Range", "bytes=0-0")
-				reqHTTP.Header.Set("User-Agent", utils.GetIPTVUserAgent())
+				reqHTTP.Header.Set("User-Agent", utils.UserAgentFor(reqHTTP.URL.Host))
 				reqHTTP.Header.Set("Accept-Encoding", "identity")
 				reqHTTP.Header.Set("Accept-Language", utils.GetLanguageHeader())
 				reqHTTP.Header.Set("Accept", "*/*")
@@ -213,64 +212,44 @@ func (c *Config) enrichVODPage(ctx *gin.Context) {
 		wg.Wait()
 	}
 
-	// Keep ordering stable for the client
-	sort.SliceStable(req.Results, func(i, j int) bool { return strings.ToLower(req.Results[i].Title) < strings.ToLower(req.Results[j].Title) })
+	// Keep the caller's order: the bot maps sizes back by index
 	ctx.JSON(http.StatusOK, types.APIResponse{Success: true, Data: map[string]interface{}{"results": req.Results}})
 }
 
 // createVODDownload creates a temporary download link for VOD content
 func (c *Config) createVODDownload(ctx *gin.Context) {
-	utils.DebugLog("API: VOD download request received")
+	reqLog(ctx).DebugLog("API: VOD download request received")
 
 	var req struct {
 		Username string `json:"username"`
 		StreamID string `json:"stream_id"`
 		Title    string `json:"title"`
 		Type     string `json:"type"` // movie or series
+		Parts    []string `json:"parts"` // stream ids of a multi-part movie, in order
 	}
 
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		utils.ErrorLog("API: Invalid VOD download request: %v", err)
-		ctx.JSON(http.StatusBadRequest, types.APIResponse{
-			Success: false,
-			Error:   "Invalid request: " + err.Error(),
-		})
+		reqLog(ctx).ErrorLog("API: Invalid VOD download request: %v", err)
+		abortJSON(ctx, http.StatusBadRequest, errCodeBadRequest, "Invalid request: "+err.Error())
 		return
 	}
 
-	utils.DebugLog("API: Creating download for user %s, stream %s, title %s", req.Username, req.StreamID, req.Title)
+	reqLog(ctx).DebugLog("API: Creating download for user %s, stream %s, title %s", req.Username, req.StreamID, req.Title)
 
 	// Enforce timeout if supported by session manager
-	if c.sessionManager != nil {
-		if sm, ok := interface{}(c.sessionManager).(timeoutAware); ok {
-			if timedOut, until := sm.IsUserTimedOut(req.Username); timedOut {
-				utils.WarnLog("API: VOD download blocked for timed-out user %s (until %s)", req.Username, until.Format(time.RFC3339))
-				ctx.JSON(http.StatusForbidden, types.APIResponse{
-					Success: false,
-					Error:   fmt.Sprintf("User '%s' is currently timed out until %s", req.Username, until.Format(time.RFC3339)),
-				})
-				return
-			}
-		}
-	}
+	if c.rejectTimedOut(ctx, req.Username, "VOD download") { return }
 
 	if c.sessionManager == nil {
-		utils.ErrorLog("Session manager is nil in createVODDownload")
-		ctx.JSON(http.StatusInternalServerError, types.APIResponse{
-			Success: false,
-			Error:   "Session manager not initialized",
-		})
+		reqLog(ctx).ErrorLog("Session manager is nil in createVODDownload")
+		abortJSON(ctx, http.StatusInternalServerError, errCodeInternal, "Session manager not initialized")
 		return
 	}
 
 	// Check if the user is currently streaming something
 	userSession := c.sessionManager.GetUserSession(req.Username)
 	if userSession != nil && userSession.StreamID != "" && userSession.StreamType == "live" {
-		utils.WarnLog("User %s tried to download while streaming %s", req.Username, userSession.StreamID)
-		ctx.JSON(http.StatusConflict, types.APIResponse{
-			Success: false,
-			Error:   "User is currently watching a live stream. Please stop streaming first.",
-		})
+		reqLog(ctx).WarnLog("User %s tried to download while streaming %s", req.Username, userSession.StreamID)
+		abortJSON(ctx, http.StatusConflict, errCodeConflict, "User is currently watching a live stream. Please stop streaming first.")
 		return
 	}
 
@@ -279,33 +258,77 @@ func (c *Config) createVODDownload(ctx *gin.Context) {
 	if strings.ToLower(req.Type) == "series" {
 		basePath = "series"
 	}
-	finalID := req.StreamID
-	if path.Ext(finalID) == "" {
-		// Try to resolve extension from cached M3U (movie/series), then fall back
-		if ext := c.findVODExtensionInCache(basePath, finalID); ext != "" {
-			utils.DebugLog("VOD extension resolved from cache: %s%s", finalID, ext)
-			finalID = finalID + ext
-		} else if basePath == "series" { 
-			// Some providers predominantly use .mkv for series
-			utils.DebugLog("VOD extension not found in cache for series id=%s; defaulting to .mkv", finalID)
-			finalID = finalID + ".mkv"
+	newToken := func(streamID, title string) (string, error) {
+		finalID := streamID
+		if path.Ext(finalID) == "" {
+			// Try to resolve extension from cached M3U (movie/series), then fall back
+			if ext := c.findVODExtensionInCache(reqLog(ctx), basePath, finalID); ext != "" {
+				reqLog(ctx).DebugLog("VOD extension resolved from cache: %s%s", finalID, ext)
+				finalID = finalID + ext
+			} else if ext, ok := c.configuredVODExtension(reqLog(ctx), basePath, finalID); ok {
+				reqLog(ctx).DebugLog("VOD extension from VOD_DEFAULT_EXT: %s%s", finalID, ext)
+				finalID = finalID + ext
+			} else if basePath == "series" { 
+				// Some providers predominantly use .mkv for series
+				reqLog(ctx).DebugLog("VOD extension not found in cache for series id=%s; defaulting to .mkv", finalID)
+				finalID = finalID + ".mkv"
+			}
 		}
+		vodURL := fmt.Sprintf("%s/%s/%s/%s/%s", c.XtreamBaseURL, basePath, c.XtreamUser, c.XtreamPassword, finalID)
+		reqLog(ctx).DebugLog("API: VOD URL created: %s", utils.MaskURL(vodURL))
+
+		// Generate a temporary download token
+		return c.sessionManager.GenerateTemporaryLink(req.Username, streamID, title, vodURL)
 	}
-	vodURL := fmt.Sprintf("%s/%s/%s/%s/%s", c.XtreamBaseURL, basePath, c.XtreamUser, c.XtreamPassword, finalID)
-	utils.DebugLog("API: VOD URL created: %s", utils.MaskURL(vodURL))
 
-	// Generate a temporary download token
-	token, err := c.sessionManager.GenerateTemporaryLink(req.Username, req.StreamID, req.Title, vodURL)
-	if err != nil {
-		utils.ErrorLog("API: Failed to generate temporary link: %v", err)
-		ctx.JSON(http.StatusInternalServerError, types.APIResponse{
-			Success: false,
-			Error:   "Failed to generate download link: " + err.Error(),
-		})
-		return
+	// Multi-part movies get one link per part, in playback order
+	ids := []string{req.StreamID}
+	if len(req.Parts) > 1 { ids = req.Parts }
+	if !cleanStreamIDs(ids) { abortJSON(ctx, http.StatusBadRequest, errCodeInvalidParameter, "invalid stream_id"); return }
+	tokens := make([]string, 0, len(ids))
+	for n, id := range ids {
+		title := req.Title
+		if len(ids) > 1 { title = fmt.Sprintf("%s — Part %d", req.Title, n+1) }
+		token, err := newToken(id, title)
+		if err != nil {
+			reqLog(ctx).ErrorLog("API: Failed to generate temporary link: %v", err)
+			abortJSON(ctx, http.StatusInternalServerError, errCodeInternal, "Failed to generate download link: "+err.Error())
+			return
+		}
+		tokens = append(tokens, token)
 	}
+	token := tokens[0]
 
 	// Create a proxied download URL with REVERSE_PROXY behavior
+	base := c.downloadBaseURL()
+	downloadURL := base + "/download/" + token
+	downloadURLs := make([]string, 0, len(tokens))
+	for _, tk := range tokens {
+		downloadURLs = append(downloadURLs, base+"/download/"+tk)
+	}
+
+	reqLog(ctx).InfoLog("Created VOD download link for user %s, title: %s, token: %s", req.Username, req.Title, token)
+
+	ctx.JSON(http.StatusOK, types.APIResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"download_url": downloadURL,
+			"download_urls": downloadURLs,
+			"token":        token,
+			"expires_at":   time.Now().Add(24 * time.Hour),
+		},
+	})
+}
+
+// downloadBaseURL is the scheme and host put in /download links. The
+// ADVERTISED_* address wins when set; otherwise, behind REVERSE_PROXY the
+// port is left out, or the scheme and host of DISCORD_API_URL are used when
+// it is set.
+func (c *Config) downloadBaseURL() string {
+	if advertisedOverride() {
+		e := c.advertised()
+		return fmt.Sprintf("%s://%s", e.scheme, e.hostPort())
+	}
 	protocol := "http"
 	if c.ProxyConfig.HTTPS { protocol = "https" }
 	hostPart := fmt.Sprintf("%s:%d", c.HostConfig.Hostname, c.HostConfig.Port)
@@ -325,24 +348,11 @@ func (c *Config) createVODDownload(ctx *gin.Context) {
 			hostPart = c.HostConfig.Hostname
 		}
 	}
-	downloadURL := fmt.Sprintf("%s://%s/download/%s", protocol, hostPart, token)
-
-	utils.InfoLog("Created VOD download link for user %s, title: %s, token: %s", req.Username, req.Title, token)
-
-	ctx.JSON(http.StatusOK, types.APIResponse{
-		Success: true,
-		Data: map[string]interface{}{
-			"download_url": downloadURL,
-			"token":        token,
-			"expires_at":   time.Now().Add(24 * time.Hour),
-		},
-	})
+	return fmt.Sprintf("%s://%s", protocol, hostPart)
 }
 
-// pickVODExtension tries a small set of common extensions and returns the first that appears valid for the upstream.
-// It performs quick HEAD requests with a short timeout. Falls back to .mp4 if none are conclusive.
-func (c *Config) pickVODExtension(ctx *gin.Context, basePath, streamID string) string {
-	// Allow override via env
+// vodExtOrder returns the extensions pickVODExtension tries, from VOD_EXT_ORDER.
+func vodExtOrder() []string {
 	order := []string{".mp4", ".ts", ".mkv", ""}
 	if v := strings.TrimSpace(utils.GetEnvOrDefault("VOD_EXT_ORDER", "")); v != "" {
 		// comma-separated, keep only known values to avoid surprises
@@ -354,69 +364,170 @@ func (c *Config) pickVODExtension(ctx *gin.Context, basePath, streamID string) s
 		}
 		if len(tmp) > 0 { order = tmp }
 	}
+	return order
+}
+
+// pickVODExtension tries a small set of common extensions and returns the first that appears valid for the upstream.
+// It performs quick HEAD requests with a short timeout. Falls back to .mp4 if none are conclusive.
+func (c *Config) pickVODExtension(log utils.RequestLogger, basePath, streamID string) string {
+	for _, ext := range vodExtOrder() {
+		if c.probeVODExtension(log, basePath, streamID, ext) { return ext }
+	}
+	return ".mp4"
+}
+
+// probeVODExtension reports whether the provider serves streamID with ext, with
+// a HEAD request or, for providers that refuse HEAD, a one-byte GET.
+func (c *Config) probeVODExtension(log utils.RequestLogger, basePath, streamID, ext string) bool {
 	client := &http.Client{ Timeout: 3 * time.Second }
-	for _, ext := range order {
-		url := fmt.Sprintf("%s/%s/%s/%s/%s%s", c.XtreamBaseURL, basePath, c.XtreamUser, c.XtreamPassword, streamID, ext)
-		req, _ := http.NewRequestWithContext(context.Background(), "HEAD", url, nil)
-		req.Header.Set("User-Agent", utils.GetIPTVUserAgent())
-		req.Header.Set("Accept-Encoding", "identity")
-		req.Header.Set("Accept", "*/*")
-		resp, err := client.Do(req)
-		if err != nil { 
-			// Providers often RST HEAD; keep this low-noise
-			utils.DebugLog("VOD probe skipped/noisy for %s: %v", utils.MaskURL(url), err)
-			continue 
-		}
-		resp.Body.Close()
-		// Accept 2xx and 206
-		if (resp.StatusCode >= 200 && resp.StatusCode < 300) || resp.StatusCode == http.StatusPartialContent {
-			utils.DebugLog("VOD probe (HEAD) ok %d for %s", resp.StatusCode, utils.MaskURL(url))
-			return ext
-		}
-		// Some providers return non-standard 461 or block HEAD; try GET range fallback
+	url := fmt.Sprintf("%s/%s/%s/%s/%s%s", c.XtreamBaseURL, basePath, c.XtreamUser, c.XtreamPassword, streamID, ext)
+	req, _ := http.NewRequestWithContext(context.Background(), "HEAD", url, nil)
+	req.Header.Set("User-Agent", utils.UserAgentFor(req.URL.Host))
+	req.Header.Set("Accept-Encoding", "identity")
+	req.Header.Set("Accept", "*/*")
+	resp, err := client.Do(req)
+	if err != nil { 
+		// Providers often RST HEAD; keep this low-noise
+		log.DebugLog("VOD probe skipped/noisy for %s: %v", utils.MaskURL(url), err)
+		return false
+	}
+	resp.Body.Close()
+	// Accept 2xx and 206
+	if (resp.StatusCode >= 200 && resp.StatusCode < 300) || resp.StatusCode == http.StatusPartialContent {
+		log.DebugLog("VOD probe (HEAD) ok %d for %s", resp.StatusCode, utils.MaskURL(url))
+		return true
+	}
+	// Some providers return non-standard 461 or block HEAD; try GET range fallback
 	if resp.StatusCode == 461 || resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusBadRequest {
-			utils.DebugLog("VOD probe (HEAD) status %d for %s, trying GET range fallback", resp.StatusCode, utils.MaskURL(url))
-			getReq, _ := http.NewRequestWithContext(context.Background(), "GET", url, nil)
-			getReq.Header.Set("User-Agent", utils.GetIPTVUserAgent())
-			getReq.Header.Set("Range", "bytes=0-0")
-			if getResp, getErr := client.Do(getReq); getErr == nil {
-				io.Copy(io.Discard, getResp.Body)
-				getResp.Body.Close()
-				if (getResp.StatusCode >= 200 && getResp.StatusCode < 300) || getResp.StatusCode == http.StatusPartialContent {
-					utils.DebugLog("VOD probe (GET range) ok %d for %s", getResp.StatusCode, utils.MaskURL(url))
-					return ext
-				}
-				utils.DebugLog("VOD probe (GET range) status %d for %s", getResp.StatusCode, utils.MaskURL(url))
-			} else {
-		utils.DebugLog("VOD probe (GET range) noisy for %s: %v", utils.MaskURL(url), getErr)
+		log.DebugLog("VOD probe (HEAD) status %d for %s, trying GET range fallback", resp.StatusCode, utils.MaskURL(url))
+		getReq, _ := http.NewRequestWithContext(context.Background(), "GET", url, nil)
+		getReq.Header.Set("User-Agent", utils.UserAgentFor(getReq.URL.Host))
+		getReq.Header.Set("Range", "bytes=0-0")
+		if getResp, getErr := client.Do(getReq); getErr == nil {
+			io.Copy(io.Discard, getResp.Body)
+			getResp.Body.Close()
+			if (getResp.StatusCode >= 200 && getResp.StatusCode < 300) || getResp.StatusCode == http.StatusPartialContent {
+				log.DebugLog("VOD probe (GET range) ok %d for %s", getResp.StatusCode, utils.MaskURL(url))
+				return true
 			}
+			log.DebugLog("VOD probe (GET range) status %d for %s", getResp.StatusCode, utils.MaskURL(url))
 		} else {
-			utils.DebugLog("VOD probe (HEAD) status %d for %s", resp.StatusCode, utils.MaskURL(url))
+			log.DebugLog("VOD probe (GET range) noisy for %s: %v", utils.MaskURL(url), getErr)
 		}
+	} else {
+		log.DebugLog("VOD probe (HEAD) status %d for %s", resp.StatusCode, utils.MaskURL(url))
 	}
-	return ".mp4"
+	return false
+}
+
+// vodDefaultExt reads the container a provider uses for basePath ("movie" or
+// "series"): VOD_DEFAULT_EXT_MOVIE / VOD_DEFAULT_EXT_SERIES, else VOD_DEFAULT_EXT.
+// Empty when none is set.
+func vodDefaultExt(basePath string) string {
+	for _, key := range []string{"VOD_DEFAULT_EXT_" + strings.ToUpper(basePath), "VOD_DEFAULT_EXT"} {
+		v := strings.ToLower(strings.TrimSpace(os.Getenv(key)))
+		if v == "" { continue }
+		if !strings.HasPrefix(v, ".") { v = "." + v }
+		if len(v) < 2 || len(v) > 6 || strings.ContainsAny(v[1:], "./\\?#") {
+			utils.WarnLog("Invalid %s: %s", key, v)
+			continue
+		}
+		return v
+	}
+	return ""
+}
+
+// configuredVODExtension returns the VOD_DEFAULT_EXT of basePath for streamID
+// without trying every extension: a single probe confirms it. When the
+// provider refuses it, the VOD_EXT_ORDER extensions are probed, and the default
+// is kept if none of them answers either. ok is false when no default is set.
+func (c *Config) configuredVODExtension(log utils.RequestLogger, basePath, streamID string) (ext string, ok bool) {
+	def := vodDefaultExt(basePath)
+	if def == "" { return "", false }
+	if c.probeVODExtension(log, basePath, streamID, def) { return def, true }
+	for _, ext := range vodExtOrder() {
+		if ext == def { continue }
+		if c.probeVODExtension(log, basePath, streamID, ext) {
+			log.InfoLog("VOD: %s %s is not served as %s, using %q", basePath, streamID, def, ext)
+			return ext, true
+		}
+	}
+	log.DebugLog("VOD: no extension confirmed for %s %s, keeping default %s", basePath, streamID, def)
+	return def, true
 }
 
-// getVODRequestStatus gets the status of a VOD download request
+// streamVODExtension resolves the extension of an uncached movie or episode
+// before caching it: the M3U first, then VOD_DEFAULT_EXT, then fallback.
+func (c *Config) streamVODExtension(log utils.RequestLogger, basePath, streamID, fallback string) string {
+	if ext := c.findVODExtensionInCache(log, basePath, streamID); ext != "" { return ext }
+	if ext, ok := c.configuredVODExtension(log, basePath, streamID); ok { return ext }
+	return fallback
+}
+
+// getVODRequest returns the stored result set of a previous VOD search
+func (c *Config) getVODRequest(ctx *gin.Context) {
+	token := ctx.Param("token")
+	reqLog(ctx).DebugLog("API: Getting VOD request for token: %s", token)
+
+	if c.sessionManager == nil {
+		abortJSON(ctx, http.StatusInternalServerError, errCodeInternal, "Session manager not initialized")
+		return
+	}
+	vodRequest, err := c.sessionManager.GetVODRequest(token)
+	if err != nil || vodRequest == nil {
+		abortJSON(ctx, http.StatusNotFound, errCodeNotFound, "VOD request not found or expired")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, types.APIResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"request_token": vodRequest.Token,
+			"username":      vodRequest.Username,
+			"query":         vodRequest.Query,
+			"results":       vodRequest.Results,
+			"created_at":    vodRequest.CreatedAt,
+			"expires_at":    vodRequest.ExpiresAt,
+		},
+	})
+}
+
+// getVODRequestStatus gets the status of a VOD search request by token
 func (c *Config) getVODRequestStatus(ctx *gin.Context) {
 	requestID := ctx.Param("requestid")
-	utils.DebugLog("API: Getting VOD request status for ID: %s", requestID)
+	reqLog(ctx).DebugLog("API: Getting VOD request status for ID: %s", requestID)
+
+	if c.sessionManager == nil {
+		abortJSON(ctx, http.StatusInternalServerError, errCodeInternal, "Session manager not initialized")
+		return
+	}
+	vodRequest, err := c.sessionManager.GetVODRequest(requestID)
+	if err != nil || vodRequest == nil {
+		ctx.JSON(http.StatusNotFound, types.APIResponse{
+			Success: false,
+			Error:   "VOD request not found or expired",
+			Code:    errCodeNotFound,
+			Data:    map[string]interface{}{"status": "expired"},
+		})
+		return
+	}
 
-	// TODO: Implement actual status checking from database
 	ctx.JSON(http.StatusOK, types.APIResponse{
 		Success: true,
 		Data: map[string]interface{}{
-			"status":   "completed",
-			"progress": 100,
+			"status":       "completed",
+			"progress":     100,
+			"result_count": len(vodRequest.Results),
+			"expires_at":   vodRequest.ExpiresAt,
 		},
 	})
 }
 
 // findVODExtensionInCache tries to locate the original extension for a given stream ID
 // by scanning the cached VOD M3U or series entries. Returns empty string if unknown.
-func (c *Config) findVODExtensionInCache(basePath, streamID string) string {
+func (c *Config) findVODExtensionInCache(log utils.RequestLogger, basePath, streamID string) string {
 	// First scan the cached VOD M3U for both movies and series
-	if m3uPath, err := c.ensureVODM3UCache(); err == nil {
+	if m3uPath, err := c.ensureVODM3UCache(log); err == nil {
 		if ext := findExtInM3U(m3uPath, basePath, streamID); ext != "" {
 			return ext
 		}
@@ -431,8 +542,29 @@ func (c *Config) findVODExtensionInCache(basePath, streamID string) string {
 	return ""
 }
 
+// requestOrigin returns the bot command and message id sent with an API
+// request, or empty strings when RECORD_COMMAND_ORIGIN=false.
+func requestOrigin(command, messageID string) (string, string) {
+	if !envFlag("RECORD_COMMAND_ORIGIN", true) {
+		return "", ""
+	}
+	return strings.TrimSpace(command), strings.TrimSpace(messageID)
+}
+
+// formatOrigin renders an origin for the audit log.
+func formatOrigin(command, messageID string) string {
+	if command == "" && messageID == "" {
+		return "api"
+	}
+	return strings.TrimSpace(command + " " + messageID)
+}
+
 // startCache starts caching a given VOD or series episode to local disk for a limited number of days (max 14)
 func (c *Config) startCache(ctx *gin.Context) {
+	if c.db == nil {
+		abortJSON(ctx, http.StatusServiceUnavailable, errCodeDatabaseUnavailable, "VOD cache is unavailable: database not initialized")
+		return
+	}
 	var req struct {
 		Username    string `json:"username"`
 		StreamID    string `json:"stream_id"`
@@ -442,112 +574,160 @@ func (c *Config) startCache(ctx *gin.Context) {
 		Season      int    `json:"season"`
 		Episode     int    `json:"episode"`
 		Days        int    `json:"days"`
+		Parts       []string `json:"parts"` // stream ids of a multi-part movie, in order
+		// Bot command and message/interaction id that asked for the cache
+		OriginCommand   string `json:"origin_command"`
+		OriginMessageID string `json:"origin_message_id"`
 	}
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, types.APIResponse{Success: false, Error: "Invalid request: " + err.Error()})
+		abortJSON(ctx, http.StatusBadRequest, errCodeBadRequest, "Invalid request: "+err.Error())
 		return
 	}
 	if req.Days <= 0 || req.Days >= 15 {
-		ctx.JSON(http.StatusBadRequest, types.APIResponse{Success: false, Error: "days must be between 1 and 14"})
+		abortJSON(ctx, http.StatusBadRequest, errCodeInvalidParameter, "days must be between 1 and 14")
 		return
 	}
-	if req.StreamID == "" { ctx.JSON(http.StatusBadRequest, types.APIResponse{Success:false, Error:"stream_id is required"}); return }
+	if req.StreamID == "" { abortJSON(ctx, http.StatusBadRequest, errCodeInvalidParameter, "stream_id is required"); return }
 	t := strings.ToLower(strings.TrimSpace(req.Type))
 	if t != "movie" && t != "series" { t = "movie" }
 
+	// Multi-part movies are cached part by part, in order
+	ids := []string{req.StreamID}
+	if len(req.Parts) > 1 { ids = req.Parts }
+	if !cleanStreamIDs(ids) { abortJSON(ctx, http.StatusBadRequest, errCodeInvalidParameter, "invalid stream_id"); return }
+
 	// If already cached and valid, return it
-	if c.db != nil {
-		if entry, err := c.db.GetVODCache(req.StreamID); err == nil && entry != nil && entry.Status == "ready" {
-			_ = c.db.TouchVODCache(req.StreamID)
+	pending := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if c.db != nil {
+			if entry, err := c.db.GetVODCache(c.db.Provider(), id); err == nil && entry != nil && entry.Status == "ready" {
+				_ = c.db.TouchVODCache(c.db.Provider(), id)
+				continue
+			}
+		}
+		// A player or an earlier request already started this one
+		if fresh, _ := cacheDownloads().register(id); !fresh { continue }
+		pending = append(pending, id)
+	}
+	if len(pending) == 0 && c.db != nil {
+		if entry, err := c.db.GetVODCache(c.db.Provider(), ids[0]); err == nil && entry != nil {
 			ctx.JSON(http.StatusOK, types.APIResponse{Success: true, Data: map[string]interface{}{
 				"cached": true,
 				"stream_id": entry.StreamID,
 				"status": entry.Status,
 				"expires_at": entry.ExpiresAt,
+				"parts": ids,
 			}})
 			return
 		}
 	}
 
 	// Determine target folder
-	baseDir := os.Getenv("CACHE_FOLDER")
-	if strings.TrimSpace(baseDir) == "" { baseDir = filepath.Join(os.TempDir(), "stream-share-cache") }
-	_ = os.MkdirAll(baseDir, 0o755)
+	baseDir := cacheDir()
 
-	// Resolve extension to build proper upstream URL
 	basePath := "movie"
 	if t == "series" { basePath = "series" }
-	finalID := req.StreamID
+	expires := time.Now().Add(time.Duration(req.Days) * 24 * time.Hour)
+	originCmd, originMsg := requestOrigin(req.OriginCommand, req.OriginMessageID)
+	jobs := make([]cacheJob, 0, len(pending))
+	for _, id := range pending {
+		upstream, filename := c.cacheTarget(reqLog(ctx), basePath, baseDir, id)
+
+		// Build a safe, user-friendly title to persist (prefer M3U title)
+		var safeTitle string
+		if tt := c.findVODTitleInCache(reqLog(ctx), basePath, id); strings.TrimSpace(tt) != "" {
+			safeTitle = strings.TrimSpace(tt)
+		}
+		// Fallbacks when M3U title not found
+		if safeTitle == "" && t == "series" && strings.TrimSpace(req.SeriesTitle) != "" && (req.Season > 0 || req.Episode > 0) {
+			safeTitle = fmt.Sprintf("%s — S%02dE%02d", req.SeriesTitle, req.Season, req.Episode)
+		}
+		if safeTitle == "" {
+			safeTitle = strings.TrimSpace(req.Title)
+			if safeTitle != "" && len(ids) > 1 {
+				for n, pid := range ids {
+					if pid == id { safeTitle = fmt.Sprintf("%s — Part %d", safeTitle, n+1) }
+				}
+			}
+		}
+		if safeTitle == "" { safeTitle = "Unknown title" }
+
+		// Persist a pending entry; it turns to downloading when its turn comes
+		if c.db != nil {
+			_ = c.db.UpsertVODCache(&types.VODCacheEntry{Provider: c.db.Provider(), StreamID: id, Type: t, Title: safeTitle, SeriesTitle: req.SeriesTitle, Season: req.Season, Episode: req.Episode, FilePath: filename, RequestedBy: req.Username, Status: statusQueued, CreatedAt: time.Now(), ExpiresAt: expires, OriginCommand: originCmd, OriginMessageID: originMsg})
+		}
+		jobs = append(jobs, cacheJob{upstream, filename, id})
+	}
+	utils.AuditLog(req.Username, "cache.start", "stream=%s parts=%d days=%d origin=%s", ids[0], len(jobs), req.Days, formatOrigin(originCmd, originMsg))
+
+	// Background download, capped by MAX_CONCURRENT_CACHE_DOWNLOADS; parts run
+	// one after another so the first one becomes playable as early as possible
+	status := statusQueued
+	if c.queueCacheDownload(reqLog(ctx), jobs, expires) {
+		status = "downloading"
+	}
+
+	ctx.JSON(http.StatusOK, types.APIResponse{Success: true, Data: map[string]interface{}{
+		"cached": false,
+		"stream_id": ids[0],
+		"status": status,
+		"expires_at": expires,
+		"parts": ids,
+	}})
+}
+
+// cacheTarget resolves the upstream URL and local file for caching streamID
+// under basePath ("movie" or "series").
+func (c *Config) cacheTarget(log utils.RequestLogger, basePath, baseDir, streamID string) (string, string) {
+	finalID := streamID
 	if path.Ext(finalID) == "" {
 		// 1) Try to resolve from cached M3U first (movie/series)
-		if ext := c.findVODExtensionInCache(basePath, finalID); ext != "" {
-			utils.DebugLog("Cache: using M3U extension %s for %s", ext, finalID)
+		if ext := c.findVODExtensionInCache(log, basePath, finalID); ext != "" {
+			log.DebugLog("Cache: using M3U extension %s for %s", ext, finalID)
+			finalID += ext
+		} else if ext, ok := c.configuredVODExtension(log, basePath, finalID); ok {
+			// 2) Container configured for the provider, checked with one probe
+			log.DebugLog("Cache: using default extension %s for %s", ext, finalID)
 			finalID += ext
 		} else {
-			// 2) Optional: allow network probing only if explicitly enabled
+			// 3) Optional: allow network probing only if explicitly enabled
 			probeEnv := strings.ToLower(strings.TrimSpace(os.Getenv("VOD_EXT_PROBE")))
 			if probeEnv == "1" || probeEnv == "true" || probeEnv == "yes" {
-				if ext := c.pickVODExtension(nil, basePath, finalID); ext != "" {
-					utils.DebugLog("Cache: probed extension %s for %s due to VOD_EXT_PROBE", ext, finalID)
+				if ext := c.pickVODExtension(log, basePath, finalID); ext != "" {
+					log.DebugLog("Cache: probed extension %s for %s due to VOD_EXT_PROBE", ext, finalID)
 					finalID += ext
 				}
 			}
-			// 3) Still unknown? Use sane defaults without probing
+			// 4) Still unknown? Use sane defaults without probing
 			if path.Ext(finalID) == "" {
 				def := ".mp4"; if basePath == "series" { def = ".mkv" }
-				utils.DebugLog("Cache: defaulting extension %s for %s", def, finalID)
+				log.DebugLog("Cache: defaulting extension %s for %s", def, finalID)
 				finalID += def
 			}
 		}
 	}
-	upstream := fmt.Sprintf("%s/%s/%s/%s/%s", c.XtreamBaseURL, basePath, c.XtreamUser, c.XtreamPassword, finalID)
+	upstream := fmt.Sprintf("%s/%s/%s/%s/%s", c.XtreamBaseURL, basePath, c.XtreamUser, c.XtreamPassword, url.PathEscape(finalID))
 
-	// Build local filename as <id>.<ext> for consistency
+	// Build local filename as <id>.<ext> for consistency, see cacheFileName
 	ext := path.Ext(finalID)
 	if ext == "" { ext = ".mp4" }
+	// HLS entries are cached as the aggregated TS stream
+	if strings.EqualFold(ext, ".m3u8") { ext = ".ts" }
 	// ensure we use the bare stream id without any accidental extension
-	idOnly := strings.TrimSuffix(req.StreamID, path.Ext(req.StreamID))
-	filename := filepath.Join(baseDir, idOnly+ext)
-
-	// Build a safe, user-friendly title to persist (prefer M3U title)
-	var safeTitle string
-	if tt := c.findVODTitleInCache(basePath, req.StreamID); strings.TrimSpace(tt) != "" {
-		safeTitle = strings.TrimSpace(tt)
-	}
-	// Fallbacks when M3U title not found
-	if safeTitle == "" && t == "series" && strings.TrimSpace(req.SeriesTitle) != "" && (req.Season > 0 || req.Episode > 0) {
-		safeTitle = fmt.Sprintf("%s — S%02dE%02d", req.SeriesTitle, req.Season, req.Episode)
-	}
-	if safeTitle == "" {
-		safeTitle = strings.TrimSpace(req.Title)
-	}
-	if safeTitle == "" { safeTitle = "Unknown title" }
-
-	// Persist a pending entry
-	expires := time.Now().Add(time.Duration(req.Days) * 24 * time.Hour)
-	if c.db != nil {
-		_ = c.db.UpsertVODCache(&types.VODCacheEntry{StreamID: req.StreamID, Type: t, Title: safeTitle, SeriesTitle: req.SeriesTitle, Season: req.Season, Episode: req.Episode, FilePath: filename, RequestedBy: req.Username, Status: "downloading", CreatedAt: time.Now(), ExpiresAt: expires})
-	}
-
-	// Spawn background download
-	go c.fetchToFile(upstream, filename, req.StreamID, expires)
-
-	ctx.JSON(http.StatusOK, types.APIResponse{Success: true, Data: map[string]interface{}{
-		"cached": false,
-		"stream_id": req.StreamID,
-		"status": "downloading",
-		"expires_at": expires,
-	}})
+	idOnly := strings.TrimSuffix(streamID, path.Ext(streamID))
+	// Never leave baseDir, even with STREAM_ID_POLICY=off
+	idOnly = filepath.Base(filepath.Clean("/" + idOnly))
+	return upstream, filepath.Join(baseDir, cacheFileName(c.db.Provider(), idOnly+ext))
 }
 
 // getCacheByStream returns cache info for a stream id
 func (c *Config) getCacheByStream(ctx *gin.Context) {
 	id := ctx.Param("streamid")
 	if id == "" || c.db == nil {
-		ctx.JSON(http.StatusNotFound, types.APIResponse{Success:false, Error:"not found"})
+		abortJSON(ctx, http.StatusNotFound, errCodeNotFound, "not found")
 		return
 	}
-	if e, err := c.db.GetVODCache(id); err == nil {
+	if e, err := c.db.GetVODCache(c.db.Provider(), id); err == nil {
 		// Do not expose internal file paths
 		resp := map[string]interface{}{
 			"stream_id": e.StreamID,
@@ -562,18 +742,21 @@ func (c *Config) getCacheByStream(ctx *gin.Context) {
 			"season": e.Season,
 			"episode": e.Episode,
 		}
+		addSizeFields(resp, e.DownloadedBytes, e.TotalBytes, e.SizeBytes)
+		c.addDurationField(resp, e, true)
+		addRateFields(resp, e.Status, e.DownloadedBytes, e.TotalBytes, e.RateBytesPerSec)
 		ctx.JSON(http.StatusOK, types.APIResponse{Success:true, Data: resp})
 	} else {
-		ctx.JSON(http.StatusNotFound, types.APIResponse{Success:false, Error: err.Error()})
+		abortJSON(ctx, http.StatusNotFound, errCodeNotFound, err.Error())
 	}
 }
 
 // getCacheProgress returns minimal progress info for a given stream id
 func (c *Config) getCacheProgress(ctx *gin.Context) {
 	id := ctx.Param("streamid")
-	if id == "" || c.db == nil { ctx.JSON(http.StatusNotFound, types.APIResponse{Success:false, Error:"not found"}); return }
-	e, err := c.db.GetVODCache(id)
-	if err != nil { ctx.JSON(http.StatusNotFound, types.APIResponse{Success:false, Error: err.Error()}); return }
+	if id == "" || c.db == nil { abortJSON(ctx, http.StatusNotFound, errCodeNotFound, "not found"); return }
+	e, err := c.db.GetVODCache(c.db.Provider(), id)
+	if err != nil { abortJSON(ctx, http.StatusNotFound, errCodeNotFound, err.Error()); return }
 	// Compute percentage
 	var percent int
 	if e.TotalBytes > 0 {
@@ -582,7 +765,7 @@ func (c *Config) getCacheProgress(ctx *gin.Context) {
 	} else if strings.ToLower(e.Status) == "ready" && e.SizeBytes > 0 {
 		percent = 100
 	}
-	ctx.JSON(http.StatusOK, types.APIResponse{Success:true, Data: map[string]interface{}{
+	out := map[string]interface{}{
 		"stream_id": e.StreamID,
 		"status": e.Status,
 		"downloaded_bytes": e.DownloadedBytes,
@@ -594,17 +777,25 @@ func (c *Config) getCacheProgress(ctx *gin.Context) {
 		"season": e.Season,
 		"episode": e.Episode,
 		"requested_by": e.RequestedBy,
-	}})
+	}
+	if e.FailureReason != "" { out["failure_reason"] = e.FailureReason }
+	addSizeFields(out, e.DownloadedBytes, e.TotalBytes, e.SizeBytes)
+	c.addDurationField(out, e, true)
+	addRateFields(out, e.Status, e.DownloadedBytes, e.TotalBytes, e.RateBytesPerSec)
+	ctx.JSON(http.StatusOK, types.APIResponse{Success:true, Data: out})
 }
 
-// listCache returns active cache entries without exposing file paths
+// listCache returns active cache entries without exposing file paths.
+// ?status=downloading keeps only the entries in that state.
 func (c *Config) listCache(ctx *gin.Context) {
 	if c.db == nil { ctx.JSON(http.StatusOK, types.APIResponse{Success:true, Data: []interface{}{}}); return }
 	list, err := c.db.ListVODCache(0)
-	if err != nil { ctx.JSON(http.StatusInternalServerError, types.APIResponse{Success:false, Error: err.Error()}); return }
+	if err != nil { abortJSON(ctx, http.StatusInternalServerError, errCodeInternal, err.Error()); return }
 	out := make([]map[string]interface{}, 0, len(list))
 	now := time.Now()
+	status := strings.TrimSpace(ctx.Query("status"))
 	for _, e := range list {
+		if status != "" && !strings.EqualFold(e.Status, status) { continue }
 		left := e.ExpiresAt.Sub(now)
 		if left < 0 { left = 0 }
 		item := map[string]interface{}{
@@ -621,77 +812,235 @@ func (c *Config) listCache(ctx *gin.Context) {
 			"size_bytes": e.SizeBytes,
 			"expires_at": e.ExpiresAt,
 			"time_left_seconds": int(left.Seconds()),
+			"origin_command": e.OriginCommand,
+			"origin_message_id": e.OriginMessageID,
 		}
+		if e.FailureReason != "" { item["failure_reason"] = e.FailureReason }
+		addSizeFields(item, e.DownloadedBytes, e.TotalBytes, e.SizeBytes)
+		// MP4 headers only here: scanning the playlist per entry is not cheap
+		c.addDurationField(item, &e, false)
+		addRateFields(item, e.Status, e.DownloadedBytes, e.TotalBytes, e.RateBytesPerSec)
 		out = append(out, item)
 	}
 	ctx.JSON(http.StatusOK, types.APIResponse{Success:true, Data: out})
 }
 
-// fetchToFile downloads from upstream URL to a local file; marks DB entry ready/failed
-func (c *Config) fetchToFile(upstream, dest, streamID string, expires time.Time) {
-	utils.InfoLog("Caching start: %s -> %s", utils.MaskURL(upstream), dest)
+// deleteCache removes a cache entry and its file before it expires. Entries
+// still downloading are refused unless ?force=1.
+func (c *Config) deleteCache(ctx *gin.Context) {
+	id := ctx.Param("streamid")
+	force := ctx.Query("force") == "1" || strings.EqualFold(ctx.Query("force"), "true")
+	if c.db == nil { abortJSON(ctx, http.StatusServiceUnavailable, errCodeDatabaseUnavailable, "database not initialized"); return }
+	if entry, err := c.db.GetVODCache(c.db.Provider(), id); err == nil && entry != nil && entry.Status == "downloading" && !force {
+		abortJSON(ctx, http.StatusConflict, errCodeConflict, "entry is still downloading; pass force=1 to delete it anyway")
+		return
+	}
+	// A download still waiting for a slot never starts
+	cacheDownloads().cancel(id)
+	entry, err := c.db.DeleteVODCache(c.db.Provider(), id)
+	if err != nil { abortJSON(ctx, http.StatusInternalServerError, errCodeInternal, err.Error()); return }
+	if entry == nil { abortJSON(ctx, http.StatusNotFound, errCodeNotFound, "cache entry not found"); return }
+
+	var freed int64
+	for _, p := range []string{entry.FilePath, entry.FilePath + ".part"} {
+		if st, err := os.Stat(p); err == nil && !st.IsDir() {
+			if err := os.Remove(p); err != nil { reqLog(ctx).WarnLog("Cache delete: could not remove %s: %v", p, err); continue }
+			freed += st.Size()
+		}
+	}
+	utils.AuditLog(ctx.Query("actor"), "cache.delete", "ip=%s stream=%s title=%q freed=%d force=%v", ctx.ClientIP(), id, entry.Title, freed, force)
+	ctx.JSON(http.StatusOK, types.APIResponse{Success:true, Data: map[string]interface{}{
+		"stream_id": entry.StreamID,
+		"title": entry.Title,
+		"status": entry.Status,
+		"freed_bytes": freed,
+		"freed_human": utils.HumanBytes(freed),
+	}})
+}
+
+// errDownloadFatal marks fetch errors that retrying cannot fix (local disk).
+type errDownloadFatal struct{ err error }
+
+func (e errDownloadFatal) Error() string { return e.err.Error() }
+
+// downloadRetryPolicy reads VOD_DOWNLOAD_RETRIES (default 3) and
+// VOD_DOWNLOAD_BACKOFF (initial delay, "5s" or seconds, default 2s).
+func downloadRetryPolicy() (int, time.Duration) {
+	retries, backoff := 3, 2*time.Second
+	if v := strings.TrimSpace(os.Getenv("VOD_DOWNLOAD_RETRIES")); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 { retries = n } else { utils.WarnLog("Invalid VOD_DOWNLOAD_RETRIES: %s", v) }
+	}
+	if v := strings.TrimSpace(os.Getenv("VOD_DOWNLOAD_BACKOFF")); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			backoff = d
+		} else if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			backoff = time.Duration(n) * time.Second
+		} else {
+			utils.WarnLog("Invalid VOD_DOWNLOAD_BACKOFF: %s", v)
+		}
+	}
+	return retries, backoff
+}
+
+// maxCacheRedirects caps the redirect chain of a cache download.
+const maxCacheRedirects = 5
+
+// cacheClient fetches cache downloads. Providers often redirect to tokenized
+// CDN URLs; every hop gets the user agent of its host and the Range of the
+// original request. No timeout: downloads can take hours.
+var cacheClient = &http.Client{
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxCacheRedirects {
+			return fmt.Errorf("stopped after %d redirects", len(via))
+		}
+		req.Header.Set("User-Agent", utils.UserAgentFor(req.URL.Host))
+		if rng := via[0].Header.Get("Range"); rng != "" { req.Header.Set("Range", rng) }
+		return nil
+	},
+}
+
+// fetchToFile downloads from upstream URL to a local file; marks DB entry ready/failed.
+// Interrupted transfers are retried with exponential backoff, resuming from the
+// bytes already on disk; the entry is only marked failed once retries run out.
+func (c *Config) fetchToFile(log utils.RequestLogger, upstream, dest, streamID string, expires time.Time) {
+	log.InfoLog("Caching start: %s -> %s", utils.MaskURL(upstream), dest)
 	tmp := dest + ".part"
 	// Create file
 	f, err := os.Create(tmp)
-	if err != nil { utils.ErrorLog("Cache: create file error: %v", err); c.cacheFail(streamID); return }
+	if err != nil { log.ErrorLog("Cache: create file error: %v", err); c.cacheFail(streamID, fmt.Sprintf("create file: %v", err)); return }
 	defer f.Close()
-	// Request with UA and support for resume in future
-	req, _ := http.NewRequestWithContext(context.Background(), "GET", upstream, nil)
-	req.Header.Set("User-Agent", utils.GetIPTVUserAgent())
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil { utils.ErrorLog("Cache: upstream error: %v", err); c.cacheFail(streamID); return }
-	defer resp.Body.Close()
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		utils.ErrorLog("Cache: upstream status %d", resp.StatusCode)
-		c.cacheFail(streamID); return
-	}
-	// Progress: known total?
-	var total int64
-	if cl := resp.Header.Get("Content-Length"); cl != "" {
-		if v, err := strconv.ParseInt(cl, 10, 64); err == nil { total = v }
-	}
-	var downloaded int64
-	buf := make([]byte, 256*1024)
-	lastUpdate := time.Now()
-	for {
-		nr, er := resp.Body.Read(buf)
-		if nr > 0 {
-			if _, ew := f.Write(buf[:nr]); ew != nil { utils.ErrorLog("Cache: write error: %v", ew); c.cacheFail(streamID); return }
-			downloaded += int64(nr)
-			// Periodically persist progress (throttle)
-			if c.db != nil && time.Since(lastUpdate) > 1*time.Second {
-				_ = c.db.UpsertVODCache(&types.VODCacheEntry{StreamID: streamID, FilePath: dest, DownloadedBytes: downloaded, TotalBytes: total, Status: "downloading", ExpiresAt: expires, LastAccess: time.Now()})
-				lastUpdate = time.Now()
-			}
+
+	retries, backoff := downloadRetryPolicy()
+	var downloaded, total int64
+	var hls hlsResume
+	meter := newRateMeter(rateWindow())
+	limits := vodDownloadLimits()
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			delay := backoff << (attempt - 1)
+			if delay > 5*time.Minute || delay <= 0 { delay = 5 * time.Minute }
+			log.WarnLog("Cache: retrying %s (attempt %d/%d) from byte %d in %v", streamID, attempt, retries, downloaded, delay)
+			time.Sleep(delay)
 		}
-		if er != nil {
-			if er == io.EOF { break }
-			utils.ErrorLog("Cache: read error: %v", er); c.cacheFail(streamID); return
+		// Each attempt starts from the provider URL, so an expired CDN token
+		// (403 on resume) is replaced by a freshly resolved one
+		err = c.fetchAttempt(log, f, upstream, dest, streamID, expires, &downloaded, &total, meter, &hls, limits)
+		if err == nil { break }
+		if lim, ok := err.(errDownloadLimit); ok {
+			// Most likely a live channel listed as a movie: drop what was fetched
+			log.ErrorLog("Cache: aborting %s at %s: %s; the entry is probably a live stream", streamID, utils.HumanBytes(downloaded), lim.reason)
+			f.Close()
+			if err := os.Remove(tmp); err != nil { log.WarnLog("Cache: could not remove %s: %v", tmp, err) }
+			c.cacheFail(streamID, lim.reason); return
+		}
+		if _, fatal := err.(errDownloadFatal); fatal || attempt >= retries {
+			log.ErrorLog("Cache: giving up on %s at byte %d after %d attempts: %v", streamID, downloaded, attempt+1, err)
+			c.cacheFail(streamID, fmt.Sprintf("gave up after %d attempts: %v", attempt+1, err)); return
 		}
+		log.WarnLog("Cache: attempt %d for %s failed at byte %d: %v", attempt+1, streamID, downloaded, err)
 	}
+
 	n := downloaded
-	if err != nil { utils.ErrorLog("Cache: copy error: %v", err); c.cacheFail(streamID); return }
-	if err := f.Sync(); err != nil { utils.WarnLog("Cache: fsync warning: %v", err) }
-	if err := os.Rename(tmp, dest); err != nil { utils.ErrorLog("Cache: rename error: %v", err); c.cacheFail(streamID); return }
-	utils.InfoLog("Caching done: %s (%s)", dest, utils.HumanBytes(n))
+	if err := f.Sync(); err != nil { log.WarnLog("Cache: fsync warning: %v", err) }
+	if err := os.Rename(tmp, dest); err != nil { log.ErrorLog("Cache: rename error: %v", err); c.cacheFail(streamID, fmt.Sprintf("rename: %v", err)); return }
+	log.InfoLog("Caching done: %s (%s)", dest, utils.HumanBytes(n))
+	c.progressWriter().forget(streamID)
 	if c.db != nil {
 		// Try to resolve and store the M3U title on completion (best-effort)
 		basePath := "movie"
 		if strings.Contains(upstream, "/series/") { basePath = "series" }
 		var finalTitle string
-		if t := c.findVODTitleInCache(basePath, streamID); strings.TrimSpace(t) != "" {
+		if t := c.findVODTitleInCache(log, basePath, streamID); strings.TrimSpace(t) != "" {
 			finalTitle = strings.TrimSpace(t)
 		}
-		entry := &types.VODCacheEntry{StreamID: streamID, FilePath: dest, DownloadedBytes: n, TotalBytes: n, SizeBytes: n, Status: "ready", ExpiresAt: expires, LastAccess: time.Now()}
+		entry := &types.VODCacheEntry{Provider: c.db.Provider(), StreamID: streamID, FilePath: dest, DownloadedBytes: n, TotalBytes: n, SizeBytes: n, Status: "ready", ExpiresAt: expires, LastAccess: time.Now()}
 		if finalTitle != "" { entry.Title = finalTitle }
 		_ = c.db.UpsertVODCache(entry)
 	}
+	c.notifyCacheDone(streamID, "ready", "", n)
+	c.notifyReadyDM(streamID, upstream)
 }
 
-func (c *Config) cacheFail(streamID string) {
+// fetchAttempt performs one GET, resuming at *downloaded with a Range request,
+// and appends to f. It returns nil once the whole body has been written.
+// meter tracks the transfer rate of this attempt. When upstream answers with
+// an HLS playlist the segments are aggregated instead, resuming through hls.
+// The transfer is aborted with an errDownloadLimit once it goes over limits.
+func (c *Config) fetchAttempt(log utils.RequestLogger, f *os.File, upstream, dest, streamID string, expires time.Time, downloaded, total *int64, meter *rateMeter, hls *hlsResume, limits *downloadLimits) error {
+	req, _ := http.NewRequestWithContext(context.Background(), "GET", upstream, nil)
+	req.Header.Set("User-Agent", utils.UserAgentFor(req.URL.Host))
+	if *downloaded > 0 && !hls.active { req.Header.Set("Range", fmt.Sprintf("bytes=%d-", *downloaded)) }
+	resp, err := cacheClient.Do(req)
+	if err != nil { return fmt.Errorf("upstream error: %w", err) }
+	defer resp.Body.Close()
+	if final := *resp.Request.URL; final.String() != upstream {
+		final.RawQuery = "" // CDN tokens
+		log.InfoLog("Cache: %s redirected to %s (HTTP %d)", streamID, utils.MaskURL(final.String()), resp.StatusCode)
+	}
+	if resp.StatusCode == http.StatusOK && isHLSResponse(resp) {
+		return c.fetchHLS(log, f, resp, streamID, downloaded, total, meter, hls, limits)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && *total > 0 && *downloaded >= *total:
+		return nil // nothing left to fetch
+	case resp.StatusCode == http.StatusPartialContent && *downloaded > 0:
+		// Resuming: Content-Range carries the full size ("bytes 100-999/1000")
+		if cr := resp.Header.Get("Content-Range"); cr != "" {
+			if i := strings.LastIndex(cr, "/"); i >= 0 {
+				if v, err := strconv.ParseInt(cr[i+1:], 10, 64); err == nil { *total = v }
+			}
+		}
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		if *downloaded > 0 {
+			// Range ignored by the provider: start over
+			log.WarnLog("Cache: upstream ignored resume for %s, restarting from byte 0", streamID)
+			if err := f.Truncate(0); err != nil { return errDownloadFatal{err} }
+			if _, err := f.Seek(0, io.SeekStart); err != nil { return errDownloadFatal{err} }
+			*downloaded = 0
+		}
+		// Progress: known total?
+		if cl := resp.Header.Get("Content-Length"); cl != "" {
+			if v, err := strconv.ParseInt(cl, 10, 64); err == nil { *total = v }
+		}
+	default:
+		return fmt.Errorf("upstream status %d", resp.StatusCode)
+	}
+
+	buf := make([]byte, 256*1024)
+	pw := c.progressWriter()
+	meter.reset()
+	meter.add(time.Now(), *downloaded)
+	for {
+		nr, er := resp.Body.Read(buf)
+		if nr > 0 {
+			if _, ew := f.Write(buf[:nr]); ew != nil { return errDownloadFatal{fmt.Errorf("write error: %w", ew)} }
+			*downloaded += int64(nr)
+			meter.add(time.Now(), *downloaded)
+			// Persisted in batches by the progress writer
+			pw.record(streamID, *downloaded, *total, meter.rate())
+			if err := limits.check(*downloaded, *total > 0); err != nil { return err }
+		}
+		if er != nil {
+			if er != io.EOF { return fmt.Errorf("read error: %w", er) }
+			break
+		}
+	}
+	// A clean EOF before the advertised size is a truncated transfer
+	if *total > 0 && *downloaded < *total {
+		return fmt.Errorf("short body: %d of %d bytes", *downloaded, *total)
+	}
+	return nil
+}
+
+// cacheFail marks a download failed; reason is kept on the entry for the
+// progress and list endpoints.
+func (c *Config) cacheFail(streamID, reason string) {
+	c.progressWriter().forget(streamID)
 	if c.db != nil {
-		_ = c.db.UpsertVODCache(&types.VODCacheEntry{StreamID: streamID, Status: "failed", LastAccess: time.Now(), ExpiresAt: time.Now().Add(2*time.Hour)})
+		_ = c.db.UpsertVODCache(&types.VODCacheEntry{Provider: c.db.Provider(), StreamID: streamID, Status: "failed", FailureReason: reason, LastAccess: time.Now(), ExpiresAt: time.Now().Add(2*time.Hour)})
 	}
+	c.notifyCacheDone(streamID, "failed", reason, 0)
 }
 
 // sanitizeFilename makes a safe filename
@@ -740,11 +1089,7 @@ func findTitleInM3U(filePath, basePath, streamID string) string {
 		if line == "" { continue }
 		if strings.HasPrefix(line, "#EXTINF") {
 			// Capture the text after the comma as the display title
-			if idx := strings.LastIndex(line, ","); idx != -1 && idx+1 < len(line) {
-				lastExtinf = strings.TrimSpace(line[idx+1:])
-			} else {
-				lastExtinf = ""
-			}
+			lastExtinf = extinfTitle(line)
 			continue
 		}
 		if !(strings.HasPrefix(line, "http://") || strings.HasPrefix(line, "https://")) { continue }
@@ -762,8 +1107,8 @@ func findTitleInM3U(filePath, basePath, streamID string) string {
 }
 
 // findVODTitleInCache tries to locate the display title for a given stream ID from cached M3U(s)
-func (c *Config) findVODTitleInCache(basePath, streamID string) string {
-	if m3uPath, err := c.ensureVODM3UCache(); err == nil {
+func (c *Config) findVODTitleInCache(log utils.RequestLogger, basePath, streamID string) string {
+	if m3uPath, err := c.ensureVODM3UCache(log); err == nil {
 		if t := findTitleInM3U(m3uPath, basePath, streamID); t != "" { return t }
 	}
 	c.ensureChannelIndex()
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucasduport/stream-share/pkg/config"
+)
+
+func TestRequestOrigin(t *testing.T) {
+	tests := []struct {
+		env, command, messageID string
+		wantCommand, wantID     string
+		wantLog                 string
+	}{
+		{"", " /cache ", " 1234 ", "/cache", "1234", "/cache 1234"},
+		{"true", "!cache", "", "!cache", "", "!cache"},
+		{"false", "/cache", "1234", "", "", "api"},
+		{"", "", "", "", "", "api"},
+	}
+	for _, tt := range tests {
+		t.Setenv("RECORD_COMMAND_ORIGIN", tt.env)
+		command, id := requestOrigin(tt.command, tt.messageID)
+		if command != tt.wantCommand || id != tt.wantID {
+			t.Errorf("requestOrigin(%q, %q) with %q = (%q, %q), want (%q, %q)", tt.command, tt.messageID, tt.env, command, id, tt.wantCommand, tt.wantID)
+		}
+		if got := formatOrigin(command, id); got != tt.wantLog {
+			t.Errorf("formatOrigin(%q, %q) = %q, want %q", command, id, got, tt.wantLog)
+		}
+	}
+}
+
+// TestStartCacheRecordsOrigin caches a movie the way the bot asks for it and
+// checks the entry keeps the originating command and message id, also once
+// the download has finished.
+func TestStartCacheRecordsOrigin(t *testing.T) {
+	db := testDB(t)
+	t.Setenv("RECORD_COMMAND_ORIGIN", "")
+	upstream, _ := movieUpstream(t)
+	old := config.CacheFolder
+	config.CacheFolder = t.TempDir()
+	t.Cleanup(func() { config.CacheFolder = old })
+
+	c := &Config{ProxyConfig: &config.ProxyConfig{XtreamBaseURL: upstream.URL, XtreamUser: "u", XtreamPassword: "p"}, db: db}
+	id := "t1537" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	t.Cleanup(func() { db.DeleteVODCache(db.Provider(), id) }) // nolint: errcheck
+
+	body := `{"username":"alice","stream_id":"` + id + `","type":"movie","title":"Heat","days":1,` +
+		`"origin_command":"/cache","origin_message_id":"112233445566778899"}`
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/api/internal/vod/cache", strings.NewReader(body))
+	ctx.Request.Header.Set("Content-Type", "application/json")
+	c.startCache(ctx)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body.String())
+	}
+
+	check := func(when string) {
+		e, err := db.GetVODCache(db.Provider(), id)
+		if err != nil {
+			t.Fatalf("%s: %v", when, err)
+		}
+		if e.OriginCommand != "/cache" || e.OriginMessageID != "112233445566778899" {
+			t.Errorf("%s: origin = (%q, %q), want (/cache, 112233445566778899)", when, e.OriginCommand, e.OriginMessageID)
+		}
+	}
+	check("queued")
+	eventually(t, "the download to end", func() bool {
+		e, err := db.GetVODCache(db.Provider(), id)
+		return err == nil && e.Status == "ready"
+	})
+	check("ready")
+}
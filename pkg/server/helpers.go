@@ -22,19 +22,22 @@ import (
     "fmt"
     "io"
     "net/http"
+    "net/url"
     "path"
     "strings"
     "os"
     "strconv"
 
     "github.com/gin-gonic/gin"
+    "github.com/lucasduport/stream-share/pkg/session"
     "github.com/lucasduport/stream-share/pkg/utils"
 )
 
 // isVODPath reports whether the given URL path likely targets VOD content
 // (movie or series) based on known path segments or file extensions.
-// prepareVODHeaders returns a clean set of headers for strict VOD providers.
-func prepareVODHeaders(ctx *gin.Context) http.Header {
+// prepareVODHeaders returns a clean set of headers for strict VOD providers;
+// host picks the user agent.
+func prepareVODHeaders(ctx *gin.Context, host string) http.Header {
     clean := http.Header{}
     // Accept
     if v := ctx.Request.Header.Get("Accept"); v != "" { clean.Set("Accept", v) } else { clean.Set("Accept", "*/*") }
@@ -45,7 +48,7 @@ func prepareVODHeaders(ctx *gin.Context) http.Header {
     // Connection
     clean.Set("Connection", "keep-alive")
     // UA and encoding
-    clean.Set("User-Agent", utils.GetIPTVUserAgent())
+    clean.Set("User-Agent", utils.UserAgentFor(host))
     clean.Set("Accept-Encoding", "identity")
     return clean
 }
@@ -83,6 +86,29 @@ func contentTypeForPath(p string) string {
     }
 }
 
+// sniffVideoContentType inspects the first bytes of a cached file and returns
+// the container it actually holds (MP4, Matroska or MPEG-TS). When the header is
+// not a known video signature, or too short to tell, fallback is returned.
+func sniffVideoContentType(r io.ReaderAt, fallback string) string {
+    head := make([]byte, 512)
+    n, _ := r.ReadAt(head, 0)
+    head = head[:n]
+    sniffed := ""
+    switch {
+    case len(head) >= 8 && string(head[4:8]) == "ftyp":
+        sniffed = "video/mp4"
+    case len(head) >= 4 && head[0] == 0x1A && head[1] == 0x45 && head[2] == 0xDF && head[3] == 0xA3:
+        sniffed = "video/x-matroska"
+    case len(head) > 376 && head[0] == 0x47 && head[188] == 0x47 && head[376] == 0x47:
+        sniffed = "video/mp2t"
+    }
+    if sniffed == "" { return fallback }
+    if sniffed != fallback {
+        utils.DebugLog("Cached file sniffed as %s (extension suggested %s)", sniffed, fallback)
+    }
+    return sniffed
+}
+
 // setNoBufferingHeaders configures common headers to minimize intermediary
 // buffering and keep the connection alive during long-running streams.
 func setNoBufferingHeaders(ctx *gin.Context, contentType string) {
@@ -135,11 +161,13 @@ func serveLocalFileRange(ctx *gin.Context, filePath string, contentType string,
         return
     }
     defer f.Close()
+    defer session.AcquireCachedFile(filePath)()
 
     size := fi.Size()
     modTime := fi.ModTime()
 
     // Common headers
+    contentType = sniffVideoContentType(f, contentType)
     if contentType == "" { contentType = "application/octet-stream" }
     ctx.Header("Content-Type", contentType)
     ctx.Header("Accept-Ranges", "bytes")
@@ -248,4 +276,67 @@ func parseRange(h string, size int64) (int64, int64, bool) {
     return start, end, true
 }
 
-func max64(a, b int64) int64 { if a > b { return a } ; return b }
\ No newline at end of file
+// openRangeStart returns start when h is a single open-ended "bytes=start-"
+// range, the form players use to seek in a file of unknown length.
+func openRangeStart(h string) (int64, bool) {
+    h = strings.TrimSpace(h)
+    if !strings.HasPrefix(strings.ToLower(h), "bytes=") {
+        return 0, false
+    }
+    spec := strings.TrimSpace(h[len("bytes="):])
+    if strings.Contains(spec, ",") || !strings.HasSuffix(spec, "-") {
+        return 0, false
+    }
+    start, err := strconv.ParseInt(strings.TrimSuffix(spec, "-"), 10, 64)
+    if err != nil || start < 0 {
+        return 0, false
+    }
+    return start, true
+}
+
+func max64(a, b int64) int64 { if a > b { return a } ; return b }
+// streamQueryAllowlist parses STREAM_QUERY_ALLOWLIST (comma-separated) into the
+// set of query parameters allowed to reach upstream stream URLs. Empty by default.
+func streamQueryAllowlist() map[string]bool {
+    allowed := map[string]bool{}
+    for _, k := range strings.Split(os.Getenv("STREAM_QUERY_ALLOWLIST"), ",") {
+        if k = strings.TrimSpace(k); k != "" { allowed[k] = true }
+    }
+    return allowed
+}
+
+// upstreamStreamURL returns a copy of target with the allowlisted client
+// parameters added. target's own parameters, such as provider tokens, are
+// kept as they are; only what the client sends is filtered. The proxy's own
+// "title" parameter is never forwarded.
+func upstreamStreamURL(target *url.URL, clientQuery url.Values) *url.URL {
+    allowed := streamQueryAllowlist()
+    out := *target
+    q := target.Query()
+    q.Del("title")
+    for k, vv := range clientQuery {
+        if k == "title" || !allowed[k] { continue }
+        if _, seen := q[k]; seen { continue }
+        q[k] = vv
+    }
+    out.RawQuery = q.Encode()
+    return &out
+}
+
+// parseStreamTypeSizes parses "256" (every stream type) or "live:256,movie:128"
+// into streamType -> value; "" is the key for every type.
+func parseStreamTypeSizes(v string) (map[string]int, error) {
+    out := map[string]int{}
+    for _, part := range strings.Split(v, ",") {
+        part = strings.TrimSpace(part)
+        if part == "" { continue }
+        typ, num := "", part
+        if i := strings.Index(part, ":"); i >= 0 {
+            typ, num = strings.ToLower(strings.TrimSpace(part[:i])), strings.TrimSpace(part[i+1:])
+        }
+        n, err := strconv.Atoi(num)
+        if err != nil || n <= 0 { return nil, fmt.Errorf("invalid size %q", part) }
+        out[typ] = n
+    }
+    return out, nil
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestUpstreamStreamURL(t *testing.T) {
+	tests := []struct {
+		name      string
+		allowlist string
+		target    string
+		client    string
+		want      url.Values
+	}{
+		{
+			name:   "client parameters dropped by default",
+			target: "http://provider/live/u/p/1.ts",
+			client: "quality=hd&foo=bar",
+			want:   url.Values{},
+		},
+		{
+			name:      "allowlisted client parameters forwarded",
+			allowlist: "quality, token",
+			target:    "http://provider/live/u/p/1.ts",
+			client:    "quality=hd&foo=bar",
+			want:      url.Values{"quality": {"hd"}},
+		},
+		{
+			name:   "provider parameters kept",
+			target: "http://provider/live/u/p/1.ts?token=abc&exp=1",
+			client: "foo=bar",
+			want:   url.Values{"token": {"abc"}, "exp": {"1"}},
+		},
+		{
+			name:      "provider parameter wins over the client's",
+			allowlist: "token",
+			target:    "http://provider/live/u/p/1.ts?token=abc",
+			client:    "token=forged",
+			want:      url.Values{"token": {"abc"}},
+		},
+		{
+			name:      "title never forwarded",
+			allowlist: "title",
+			target:    "http://provider/live/u/p/1.ts?title=News",
+			client:    "title=News",
+			want:      url.Values{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("STREAM_QUERY_ALLOWLIST", tt.allowlist)
+			target, err := url.Parse(tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			client, err := url.ParseQuery(tt.client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := upstreamStreamURL(target, client)
+			if got.RawQuery != tt.want.Encode() {
+				t.Errorf("query = %q, want %q", got.RawQuery, tt.want.Encode())
+			}
+			if got.Path != target.Path || got.Host != target.Host {
+				t.Errorf("url = %s, want the path and host of %s", got, target)
+			}
+		})
+	}
+}
@@ -0,0 +1,386 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+const (
+	maxHLSPlaylistBytes = 8 << 20
+	maxHLSSegmentBytes  = 512 << 20
+	hlsSegmentTimeout   = 2 * time.Minute
+)
+
+// hlsKey is the EXT-X-KEY in effect for a segment
+type hlsKey struct {
+	uri string
+	iv  []byte // nil: derived from the media sequence number
+}
+
+// hlsSegment is one media segment of a VOD playlist
+type hlsSegment struct {
+	uri      *url.URL
+	seq      uint64
+	duration float64
+	key      *hlsKey
+	rng      string // "bytes=a-b" for EXT-X-BYTERANGE segments
+}
+
+// hlsPlaylist is a parsed playlist: variants for a master playlist, segments
+// for a media playlist
+type hlsPlaylist struct {
+	variants []*url.URL // best first
+	segments []hlsSegment
+	vod      bool
+	fmp4     bool
+}
+
+// hlsResume remembers how far an HLS cache download got, so a retry continues
+// after the last complete segment instead of starting over.
+type hlsResume struct {
+	active   bool
+	segments int   // segment count of the playlist being fetched
+	next     int   // next segment to fetch
+	offset   int64 // file size after segment next-1
+}
+
+// isHLSResponse reports whether resp carries an HLS playlist rather than the file itself.
+func isHLSResponse(resp *http.Response) bool {
+	if mt, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil {
+		switch strings.ToLower(mt) {
+		case "application/vnd.apple.mpegurl", "application/x-mpegurl", "audio/mpegurl", "audio/x-mpegurl":
+			return true
+		}
+	}
+	return strings.HasSuffix(strings.ToLower(resp.Request.URL.Path), ".m3u8")
+}
+
+// fetchHLS caches an HLS VOD as one TS file: the segments of the playlist in
+// resp are downloaded in order, decrypted when the playlist uses AES-128,
+// and appended to f. Live playlists cannot be cached and fail the entry.
+func (c *Config) fetchHLS(log utils.RequestLogger, f *os.File, resp *http.Response, streamID string, downloaded, total *int64, meter *rateMeter, st *hlsResume, limits *downloadLimits) error {
+	pl, err := readHLSPlaylist(resp.Body, resp.Request.URL)
+	if err != nil {
+		return err
+	}
+	// Master playlist: cache the best variant
+	if len(pl.variants) > 0 {
+		variant := pl.variants[0]
+		body, final, err := hlsGet(variant, "")
+		if err != nil {
+			return fmt.Errorf("variant playlist: %w", err)
+		}
+		if pl, err = readHLSPlaylist(bytes.NewReader(body), final); err != nil {
+			return err
+		}
+		if len(pl.variants) > 0 {
+			return errDownloadFatal{fmt.Errorf("nested HLS master playlists are not supported")}
+		}
+	}
+	switch {
+	case !pl.vod:
+		return errDownloadFatal{fmt.Errorf("live HLS playlist, only VOD playlists can be cached")}
+	case pl.fmp4:
+		return errDownloadFatal{fmt.Errorf("fragmented MP4 HLS (EXT-X-MAP) is not supported")}
+	case len(pl.segments) == 0:
+		return errDownloadFatal{fmt.Errorf("HLS playlist has no segments")}
+	}
+
+	// Continue after the last complete segment of an earlier attempt, as long
+	// as the playlist still has the same shape
+	if !st.active || st.segments != len(pl.segments) {
+		st.active, st.segments, st.next, st.offset = true, len(pl.segments), 0, 0
+		log.InfoLog("Cache: %s is HLS, aggregating %d segments", streamID, len(pl.segments))
+	}
+	if err := f.Truncate(st.offset); err != nil {
+		return errDownloadFatal{err}
+	}
+	if _, err := f.Seek(st.offset, io.SeekStart); err != nil {
+		return errDownloadFatal{err}
+	}
+	*downloaded = st.offset
+
+	var totalDur, doneDur float64
+	for i, seg := range pl.segments {
+		totalDur += seg.duration
+		if i < st.next {
+			doneDur += seg.duration
+		}
+	}
+	keys := make(map[string][]byte)
+	pw := c.progressWriter()
+	meter.reset()
+	meter.add(time.Now(), *downloaded)
+	for i := st.next; i < len(pl.segments); i++ {
+		seg := pl.segments[i]
+		data, _, err := hlsGet(seg.uri, seg.rng)
+		if err != nil {
+			return fmt.Errorf("segment %d/%d: %w", i+1, len(pl.segments), err)
+		}
+		if seg.key != nil {
+			key, ok := keys[seg.key.uri]
+			if !ok {
+				u, err := url.Parse(seg.key.uri)
+				if err != nil {
+					return errDownloadFatal{fmt.Errorf("bad key URI: %w", err)}
+				}
+				if key, _, err = hlsGet(u, ""); err != nil {
+					return fmt.Errorf("segment key: %w", err)
+				}
+				if len(key) != 16 {
+					return errDownloadFatal{fmt.Errorf("segment key is %d bytes, want 16", len(key))}
+				}
+				keys[seg.key.uri] = key
+			}
+			if data, err = decryptHLSSegment(data, key, seg); err != nil {
+				return errDownloadFatal{fmt.Errorf("segment %d: %w", i+1, err)}
+			}
+		}
+		if _, err := f.Write(data); err != nil {
+			return errDownloadFatal{fmt.Errorf("write error: %w", err)}
+		}
+		*downloaded += int64(len(data))
+		st.next, st.offset = i+1, *downloaded
+		doneDur += seg.duration
+		// Size is unknown until the end; extrapolate from the duration done
+		if doneDur > 0 && totalDur > 0 {
+			*total = int64(float64(*downloaded) * totalDur / doneDur)
+		} else {
+			*total = *downloaded * int64(len(pl.segments)) / int64(i+1)
+		}
+		meter.add(time.Now(), *downloaded)
+		pw.record(streamID, *downloaded, *total, meter.rate())
+		// A VOD playlist has a known end, so only the size cap applies
+		if err := limits.check(*downloaded, true); err != nil {
+			return err
+		}
+	}
+	*total = *downloaded
+	return nil
+}
+
+// hlsGet fetches a playlist, key or segment with the cache client and returns
+// the body and the final URL after redirects.
+func hlsGet(u *url.URL, rng string) ([]byte, *url.URL, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), hlsSegmentTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("User-Agent", utils.UserAgentFor(req.URL.Host))
+	if rng != "" {
+		req.Header.Set("Range", rng)
+	}
+	resp, err := cacheClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return nil, nil, fmt.Errorf("upstream status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxHLSSegmentBytes+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(body) > maxHLSSegmentBytes {
+		return nil, nil, errDownloadFatal{fmt.Errorf("response over %d bytes", maxHLSSegmentBytes)}
+	}
+	return body, resp.Request.URL, nil
+}
+
+// readHLSPlaylist parses a master or media playlist; URIs are resolved against base.
+func readHLSPlaylist(r io.Reader, base *url.URL) (*hlsPlaylist, error) {
+	pl := &hlsPlaylist{}
+	var (
+		seq         uint64
+		duration    float64
+		key         *hlsKey
+		rng         string
+		rangeEnd    int64
+		variantBW   = -1
+		nextVariant = false
+		bandwidths  []int
+	)
+	sc := bufio.NewScanner(io.LimitReader(r, maxHLSPlaylistBytes))
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	first := true
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		if first {
+			if line != "#EXTM3U" {
+				return nil, errDownloadFatal{fmt.Errorf("not an HLS playlist")}
+			}
+			first = false
+			continue
+		}
+		tag, value, _ := strings.Cut(line, ":")
+		switch {
+		case tag == "#EXT-X-STREAM-INF":
+			nextVariant = true
+			variantBW = 0
+			if bw, ok := hlsAttrs(value)["BANDWIDTH"]; ok {
+				variantBW, _ = strconv.Atoi(bw)
+			}
+		case tag == "#EXT-X-MEDIA-SEQUENCE":
+			seq, _ = strconv.ParseUint(value, 10, 64)
+		case tag == "#EXT-X-ENDLIST":
+			pl.vod = true
+		case tag == "#EXT-X-PLAYLIST-TYPE":
+			if strings.EqualFold(value, "VOD") {
+				pl.vod = true
+			}
+		case tag == "#EXT-X-MAP":
+			pl.fmp4 = true
+		case tag == "#EXTINF":
+			d, _, _ := strings.Cut(value, ",")
+			duration, _ = strconv.ParseFloat(d, 64)
+		case tag == "#EXT-X-BYTERANGE":
+			n, o, hasOffset := strings.Cut(value, "@")
+			length, _ := strconv.ParseInt(n, 10, 64)
+			start := rangeEnd
+			if hasOffset {
+				start, _ = strconv.ParseInt(o, 10, 64)
+			}
+			rng = fmt.Sprintf("bytes=%d-%d", start, start+length-1)
+			rangeEnd = start + length
+		case tag == "#EXT-X-KEY":
+			attrs := hlsAttrs(value)
+			switch strings.ToUpper(attrs["METHOD"]) {
+			case "NONE":
+				key = nil
+			case "AES-128":
+				u, err := base.Parse(attrs["URI"])
+				if err != nil || attrs["URI"] == "" {
+					return nil, errDownloadFatal{fmt.Errorf("bad EXT-X-KEY URI %q", attrs["URI"])}
+				}
+				key = &hlsKey{uri: u.String()}
+				if iv := attrs["IV"]; iv != "" {
+					b, err := hex.DecodeString(strings.TrimPrefix(strings.TrimPrefix(iv, "0x"), "0X"))
+					if err != nil || len(b) != 16 {
+						return nil, errDownloadFatal{fmt.Errorf("bad EXT-X-KEY IV %q", iv)}
+					}
+					key.iv = b
+				}
+			default:
+				return nil, errDownloadFatal{fmt.Errorf("HLS encryption %q is not supported", attrs["METHOD"])}
+			}
+		case strings.HasPrefix(line, "#"):
+			// Other tags don't matter for aggregation
+		default:
+			u, err := base.Parse(line)
+			if err != nil {
+				return nil, errDownloadFatal{fmt.Errorf("bad playlist URI %q", line)}
+			}
+			if nextVariant {
+				// Keep variants sorted by bandwidth, best first
+				i := 0
+				for i < len(bandwidths) && bandwidths[i] >= variantBW {
+					i++
+				}
+				pl.variants = append(pl.variants[:i], append([]*url.URL{u}, pl.variants[i:]...)...)
+				bandwidths = append(bandwidths[:i], append([]int{variantBW}, bandwidths[i:]...)...)
+				nextVariant = false
+				continue
+			}
+			pl.segments = append(pl.segments, hlsSegment{uri: u, seq: seq, duration: duration, key: key, rng: rng})
+			seq++
+			duration, rng = 0, ""
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read playlist: %w", err)
+	}
+	if first {
+		return nil, errDownloadFatal{fmt.Errorf("empty HLS playlist")}
+	}
+	return pl, nil
+}
+
+// hlsAttrs parses an attribute list such as `METHOD=AES-128,URI="k.key"`.
+func hlsAttrs(s string) map[string]string {
+	out := make(map[string]string)
+	for s != "" {
+		name, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			break
+		}
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+			rest = "," + rest
+		}
+		out[strings.ToUpper(strings.TrimSpace(name))] = value
+		s = strings.TrimPrefix(strings.TrimLeft(rest, " "), ",")
+	}
+	return out
+}
+
+// decryptHLSSegment undoes AES-128 CBC with PKCS#7 padding. Without an explicit
+// IV the segment's media sequence number is used, as the HLS spec requires.
+func decryptHLSSegment(data, key []byte, seg hlsSegment) ([]byte, error) {
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("encrypted segment size %d is not a multiple of %d", len(data), aes.BlockSize)
+	}
+	iv := seg.key.iv
+	if iv == nil {
+		iv = make([]byte, aes.BlockSize)
+		binary.BigEndian.PutUint64(iv[8:], seg.seq)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+	pad := int(out[len(out)-1])
+	if pad == 0 || pad > aes.BlockSize || pad > len(out) || !bytes.Equal(out[len(out)-pad:], bytes.Repeat([]byte{byte(pad)}, pad)) {
+		return nil, fmt.Errorf("bad padding, wrong key?")
+	}
+	return out[:len(out)-pad], nil
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lucasduport/stream-share/pkg/config"
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// encryptHLSSegment is the provider side of decryptHLSSegment: AES-128 CBC
+// with PKCS#7 padding and the media sequence number as IV.
+func encryptHLSSegment(t *testing.T, data, key []byte, seq uint64) []byte {
+	t.Helper()
+	pad := aes.BlockSize - len(data)%aes.BlockSize
+	data = append(append([]byte(nil), data...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+	iv := make([]byte, aes.BlockSize)
+	binary.BigEndian.PutUint64(iv[8:], seq)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make([]byte, len(data))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, data)
+	return out
+}
+
+// hlsUpstream serves a master playlist, its VOD variant with two segments
+// (the second AES-128 encrypted), and a live playlist.
+func hlsUpstream(t *testing.T, seg1, seg2 []byte) *httptest.Server {
+	t.Helper()
+	key := []byte("0123456789abcdef")
+	files := map[string][]byte{
+		"/movie/u/p/42.m3u8": []byte("#EXTM3U\n" +
+			"#EXT-X-STREAM-INF:BANDWIDTH=800000\nlow/index.m3u8\n" +
+			"#EXT-X-STREAM-INF:BANDWIDTH=2400000\nhigh/index.m3u8\n"),
+		"/movie/u/p/high/index.m3u8": []byte("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:10\n#EXT-X-MEDIA-SEQUENCE:5\n" +
+			"#EXTINF:10.0,\nseg1.ts\n" +
+			"#EXT-X-KEY:METHOD=AES-128,URI=\"/keys/1\"\n" +
+			"#EXTINF:10.0,\nseg2.ts\n" +
+			"#EXT-X-ENDLIST\n"),
+		"/movie/u/p/high/seg1.ts": seg1,
+		"/movie/u/p/high/seg2.ts": encryptHLSSegment(t, seg2, key, 6),
+		"/keys/1":                 key,
+		"/movie/u/p/43.m3u8": []byte("#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXT-X-MEDIA-SEQUENCE:100\n" +
+			"#EXTINF:10.0,\nseg100.ts\n#EXTINF:10.0,\nseg101.ts\n"),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if filepath.Ext(r.URL.Path) == ".m3u8" {
+			w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		} else {
+			w.Header().Set("Content-Type", "video/mp2t")
+		}
+		w.Write(body) // nolint: errcheck
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// TestFetchHLSVOD caches a movie the provider only has as HLS: the best
+// variant is picked and its segments are decrypted and joined in order.
+func TestFetchHLSVOD(t *testing.T) {
+	t.Setenv("CACHE_WEBHOOK_URL", "")
+	t.Setenv("VOD_DOWNLOAD_RETRIES", "0")
+	seg1 := append([]byte{0x47}, bytes.Repeat([]byte("first segment "), 40)...)
+	seg2 := append([]byte{0x47}, bytes.Repeat([]byte("second segment "), 40)...)
+	upstream := hlsUpstream(t, seg1, seg2)
+	c := &Config{ProxyConfig: &config.ProxyConfig{}}
+	dir := t.TempDir()
+
+	_, dest := c.cacheTarget(utils.RequestLogger{}, "movie", dir, "42.m3u8")
+	if filepath.Ext(dest) != ".ts" {
+		t.Errorf("HLS entry cached as %s, want a .ts file", dest)
+	}
+	c.fetchToFile(utils.RequestLogger{}, upstream.URL+"/movie/u/p/42.m3u8", dest, "42", time.Now().Add(time.Hour))
+	got, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := append(append([]byte(nil), seg1...), seg2...); !bytes.Equal(got, want) {
+		t.Errorf("cached %d bytes, want the %d bytes of both segments in order", len(got), len(want))
+	}
+	if _, err := os.Stat(dest + ".part"); !os.IsNotExist(err) {
+		t.Errorf("partial file left behind: %v", err)
+	}
+
+	// A live playlist has no end and must not be cached
+	live := filepath.Join(dir, "43.ts")
+	c.fetchToFile(utils.RequestLogger{}, upstream.URL+"/movie/u/p/43.m3u8", live, "43", time.Now().Add(time.Hour))
+	if _, err := os.Stat(live); !os.IsNotExist(err) {
+		t.Errorf("live playlist was cached: %v", err)
+	}
+}
+
+func TestReadHLSPlaylist(t *testing.T) {
+	base, _ := http.NewRequest("GET", "http://provider.example/vod/1/index.m3u8", nil)
+	pl, err := readHLSPlaylist(bytes.NewReader([]byte("#EXTM3U\n#EXT-X-PLAYLIST-TYPE:VOD\n#EXT-X-MEDIA-SEQUENCE:3\n"+
+		"#EXT-X-KEY:METHOD=AES-128,URI=\"https://keys.example/k\",IV=0x000102030405060708090a0b0c0d0e0f\n"+
+		"#EXTINF:4.0,\n#EXT-X-BYTERANGE:1000@0\nall.ts\n"+
+		"#EXT-X-KEY:METHOD=NONE\n"+
+		"#EXTINF:6.5,\n#EXT-X-BYTERANGE:500\nall.ts\n")), base.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pl.vod || pl.fmp4 || len(pl.variants) != 0 || len(pl.segments) != 2 {
+		t.Fatalf("playlist = %+v", pl)
+	}
+	s0, s1 := pl.segments[0], pl.segments[1]
+	if s0.uri.String() != "http://provider.example/vod/1/all.ts" || s0.seq != 3 || s0.duration != 4 || s0.rng != "bytes=0-999" {
+		t.Errorf("segment 0 = %+v", s0)
+	}
+	if s0.key == nil || s0.key.uri != "https://keys.example/k" || len(s0.key.iv) != 16 || s0.key.iv[15] != 0x0f {
+		t.Errorf("segment 0 key = %+v", s0.key)
+	}
+	if s1.seq != 4 || s1.duration != 6.5 || s1.rng != "bytes=1000-1499" || s1.key != nil {
+		t.Errorf("segment 1 = %+v", s1)
+	}
+
+	for name, body := range map[string]string{
+		"not a playlist": "<html></html>\n",
+		"sample-aes":     "#EXTM3U\n#EXT-X-KEY:METHOD=SAMPLE-AES,URI=\"k\"\n",
+		"bad IV":         "#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"k\",IV=0x01\n",
+	} {
+		if _, err := readHLSPlaylist(bytes.NewReader([]byte(body)), base.URL); err == nil {
+			t.Errorf("%s: parsed without an error", name)
+		} else if _, fatal := err.(errDownloadFatal); !fatal {
+			t.Errorf("%s: error %v is retried", name, err)
+		}
+	}
+}
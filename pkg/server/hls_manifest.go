@@ -0,0 +1,91 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// hlsURIAttr matches the URI="..." attribute of tags such as #EXT-X-KEY,
+// #EXT-X-MEDIA or #EXT-X-I-FRAME-STREAM-INF.
+var hlsURIAttr = regexp.MustCompile(`URI="([^"]*)"`)
+
+// rewriteHLSManifest makes an upstream m3u8 safe to hand to clients. Absolute
+// URIs on the provider host, or on one of upstreamHosts (the host that served
+// the manifest), are pointed back through the proxy; this covers variant and
+// segment lines as well as URI attributes. Relative URIs keep their form and
+// only get the provider credentials swapped for the proxy ones. URIs on other
+// hosts (e.g. a third-party key server) are left alone.
+func (c *Config) rewriteHLSManifest(body string, upstreamHosts ...string) string {
+	hosts := make(map[string]bool, len(upstreamHosts)+1)
+	if u, err := url.Parse(c.XtreamBaseURL); err == nil && u.Host != "" {
+		hosts[strings.ToLower(u.Host)] = true
+	}
+	for _, h := range upstreamHosts {
+		if h != "" {
+			hosts[strings.ToLower(h)] = true
+		}
+	}
+
+	lines := strings.Split(body, "\n")
+	for i, line := range lines {
+		uri := strings.TrimSpace(line)
+		switch {
+		case uri == "":
+		case strings.HasPrefix(uri, "#"):
+			lines[i] = hlsURIAttr.ReplaceAllStringFunc(line, func(attr string) string {
+				return `URI="` + c.proxyHLSURI(hlsURIAttr.FindStringSubmatch(attr)[1], hosts) + `"`
+			})
+		default:
+			lines[i] = strings.Replace(line, uri, c.proxyHLSURI(uri, hosts), 1)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// proxyHLSURI rewrites a single manifest URI, see rewriteHLSManifest.
+func (c *Config) proxyHLSURI(uri string, hosts map[string]bool) string {
+	u, err := url.Parse(uri)
+	if err != nil || !u.IsAbs() {
+		return c.swapHLSCredentials(uri)
+	}
+	if !hosts[strings.ToLower(u.Host)] && !hosts[strings.ToLower(u.Hostname())] {
+		return uri
+	}
+	out := c.publicBaseURL() + c.swapHLSCredentials(u.EscapedPath())
+	if u.RawQuery != "" {
+		q := u.Query()
+		if q.Get("username") == c.XtreamUser.String() && q.Get("password") == c.XtreamPassword.String() {
+			q.Set("username", c.User.String())
+			q.Set("password", c.Password.String())
+			out += "?" + q.Encode()
+		} else {
+			out += "?" + u.RawQuery
+		}
+	}
+	return out
+}
+
+// swapHLSCredentials replaces the provider credential path segment with the
+// proxy credentials.
+func (c *Config) swapHLSCredentials(s string) string {
+	return strings.ReplaceAll(s, "/"+c.XtreamUser.String()+"/"+c.XtreamPassword.String()+"/", "/"+c.User.String()+"/"+c.Password.String()+"/")
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lucasduport/stream-share/pkg/config"
+)
+
+func TestRewriteHLSManifest(t *testing.T) {
+	c := &Config{ProxyConfig: &config.ProxyConfig{
+		HostConfig:     &config.HostConfiguration{Hostname: "iptv.example", Port: 8000},
+		AdvertisedPort: 8000,
+		XtreamBaseURL:  "http://provider.example:8080",
+		XtreamUser:     "puser",
+		XtreamPassword: "ppass",
+		User:           "alice",
+		Password:       "secret",
+	}}
+	proxy := c.publicBaseURL()
+
+	tests := []struct {
+		name, body, want string
+		hosts            []string
+	}{
+		{
+			name: "master playlist",
+			body: "#EXTM3U\n" +
+				"#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"aud\",NAME=\"en\",URI=\"http://provider.example:8080/live/puser/ppass/1/audio.m3u8\"\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=1280000,AUDIO=\"aud\"\n" +
+				"http://provider.example:8080/live/puser/ppass/1/low.m3u8\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=2560000,AUDIO=\"aud\"\n" +
+				"/live/puser/ppass/1/high.m3u8\n",
+			want: "#EXTM3U\n" +
+				"#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"aud\",NAME=\"en\",URI=\"" + proxy + "/live/alice/secret/1/audio.m3u8\"\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=1280000,AUDIO=\"aud\"\n" +
+				proxy + "/live/alice/secret/1/low.m3u8\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=2560000,AUDIO=\"aud\"\n" +
+				"/live/alice/secret/1/high.m3u8\n",
+		},
+		{
+			name: "media playlist on the serving host",
+			body: "#EXTM3U\r\n#EXT-X-TARGETDURATION:6\r\n#EXTINF:6.0,\r\nhttp://cdn.provider.example/hls/puser/ppass/1/seg1.ts\r\n#EXTINF:6.0,\r\nseg2.ts\r\n",
+			hosts: []string{"cdn.provider.example"},
+			want:  "#EXTM3U\r\n#EXT-X-TARGETDURATION:6\r\n#EXTINF:6.0,\r\n" + proxy + "/hls/alice/secret/1/seg1.ts\r\n#EXTINF:6.0,\r\nseg2.ts\r\n",
+		},
+		{
+			name: "AES key",
+			body: "#EXT-X-KEY:METHOD=AES-128,URI=\"http://provider.example:8080/key?username=puser&password=ppass&id=1\",IV=0x1\n",
+			want: "#EXT-X-KEY:METHOD=AES-128,URI=\"" + proxy + "/key?id=1&password=secret&username=alice\",IV=0x1\n",
+		},
+		{
+			name: "relative key and segment",
+			body: "#EXT-X-KEY:METHOD=AES-128,URI=\"key.bin\"\n#EXTINF:6.0,\n../seg1.ts?token=abc\n",
+			want: "#EXT-X-KEY:METHOD=AES-128,URI=\"key.bin\"\n#EXTINF:6.0,\n../seg1.ts?token=abc\n",
+		},
+		{
+			name: "third-party hosts untouched",
+			body: "#EXT-X-KEY:METHOD=AES-128,URI=\"https://keys.example/k/1\"\n#EXTINF:6.0,\nhttps://cdn.other.example/seg1.ts\n",
+			want: "#EXT-X-KEY:METHOD=AES-128,URI=\"https://keys.example/k/1\"\n#EXTINF:6.0,\nhttps://cdn.other.example/seg1.ts\n",
+		},
+		{
+			name: "foreign query credentials kept",
+			body: "http://provider.example:8080/hls/1.ts?token=abc\n",
+			want: proxy + "/hls/1.ts?token=abc\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := c.rewriteHLSManifest(tt.body, tt.hosts...)
+			if got != tt.want {
+				t.Errorf("rewriteHLSManifest =\n%s\nwant\n%s", got, tt.want)
+			}
+			if strings.Contains(got, "ppass") || strings.Contains(got, "provider.example") {
+				t.Errorf("manifest still leaks the provider: %s", got)
+			}
+		})
+	}
+}
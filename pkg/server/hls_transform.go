@@ -0,0 +1,365 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// A manifest rule decides, segment by segment, what is removed from the live
+// HLS media playlists the proxy relays, e.g. ad breaks spliced in by the
+// provider. Each stream gets its own filter from every rule; the filter sees
+// every segment exactly once and in order, across playlist refreshes, so it
+// may keep state such as "inside an ad break".
+type manifestRule struct {
+	name      string
+	newFilter func() segmentFilter
+}
+
+// segmentFilter reports whether a segment is dropped.
+type segmentFilter func(seg *hlsManifestSegment) bool
+
+// hlsManifestSegment is one media segment: its URI, the tags before it and its
+// media sequence number in the upstream playlist.
+type hlsManifestSegment struct {
+	seq  int64
+	tags []string
+	uri  string
+}
+
+// hasTag reports whether the segment carries a tag starting with prefix.
+func (s *hlsManifestSegment) hasTag(prefix string) bool {
+	for _, t := range s.tags {
+		if strings.HasPrefix(t, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// discontinuity reports whether the segment starts with #EXT-X-DISCONTINUITY.
+func (s *hlsManifestSegment) discontinuity() bool {
+	for _, t := range s.tags {
+		if t == "#EXT-X-DISCONTINUITY" {
+			return true
+		}
+	}
+	return false
+}
+
+var manifestRules struct {
+	sync.RWMutex
+	rules []manifestRule
+}
+
+// registerManifestRule adds a rule applied to every relayed media playlist.
+func registerManifestRule(r manifestRule) {
+	manifestRules.Lock()
+	defer manifestRules.Unlock()
+	manifestRules.rules = append(manifestRules.rules, r)
+	utils.InfoLog("HLS manifest rule enabled: %s", r.name)
+}
+
+// loadManifestRules registers the built-in rules enabled by the environment:
+// HLS_DROP_CUE_OUT removes ad breaks marked with #EXT-X-CUE-OUT/#EXT-X-CUE-IN,
+// HLS_DROP_SEGMENTS removes segments whose URI matches a regular expression.
+func loadManifestRules() {
+	if envFlag("HLS_DROP_CUE_OUT", false) {
+		registerManifestRule(manifestRule{name: "drop cue-out spans", newFilter: cueOutFilter})
+	}
+	if v := os.Getenv("HLS_DROP_SEGMENTS"); v != "" {
+		re, err := regexp.Compile(v)
+		if err != nil {
+			utils.WarnLog("Invalid HLS_DROP_SEGMENTS: %v", err)
+			return
+		}
+		registerManifestRule(manifestRule{
+			name: fmt.Sprintf("drop segments matching %q", v),
+			newFilter: func() segmentFilter {
+				return func(seg *hlsManifestSegment) bool { return re.MatchString(seg.uri) }
+			},
+		})
+	}
+}
+
+// cueOutFilter drops the segments from an #EXT-X-CUE-OUT up to the next
+// #EXT-X-CUE-IN. A playlist whose window starts inside a break is recognised
+// by #EXT-X-CUE-OUT-CONT.
+func cueOutFilter() segmentFilter {
+	inBreak := false
+	return func(seg *hlsManifestSegment) bool {
+		switch {
+		case seg.hasTag("#EXT-X-CUE-IN"):
+			inBreak = false
+		case seg.hasTag("#EXT-X-CUE-OUT-CONT"):
+			inBreak = true
+		case seg.hasTag("#EXT-X-CUE-OUT"):
+			inBreak = true
+		}
+		return inBreak
+	}
+}
+
+// segmentDecision is what happened to one upstream segment.
+type segmentDecision struct {
+	dropped bool
+	// discDelta is the change in discontinuities: -1 for a dropped segment
+	// that had one, +1 for a kept one that gained one at a splice.
+	discDelta int64
+}
+
+// hlsStreamState keeps the decisions of one media playlist across refreshes,
+// so a segment keeps the same sequence number in every refresh and the
+// discontinuity sequence stays in step.
+type hlsStreamState struct {
+	filters     []segmentFilter
+	next        int64 // first sequence number not decided yet
+	windowStart int64 // decisions below this were folded into the totals
+	decisions   map[int64]segmentDecision
+	dropsBefore int64 // segments dropped below windowStart
+	discBefore  int64 // discontinuity change below windowStart
+	pendingDisc bool  // a dropped run had a discontinuity the next kept segment takes over
+	used        time.Time
+}
+
+// hlsStateTTL is how long the state of a playlist nobody refreshes is kept.
+const hlsStateTTL = 10 * time.Minute
+
+var hlsStates = struct {
+	sync.Mutex
+	byKey map[string]*hlsStreamState
+}{byKey: make(map[string]*hlsStreamState)}
+
+var manifestRulesOnce sync.Once
+
+// transformHLSManifest applies the manifest rules to a media playlist; key
+// identifies the playlist across refreshes (its upstream path). Master
+// playlists, VOD playlists and manifests nothing is dropped from pass through
+// unchanged.
+func transformHLSManifest(key, manifest string) string {
+	manifestRulesOnce.Do(loadManifestRules)
+	manifestRules.RLock()
+	rules := manifestRules.rules
+	manifestRules.RUnlock()
+	if len(rules) == 0 || strings.Contains(manifest, "#EXT-X-STREAM-INF") || strings.Contains(manifest, "#EXT-X-ENDLIST") {
+		return manifest
+	}
+
+	pl := parseMediaPlaylist(manifest)
+	if len(pl.segments) == 0 {
+		return manifest
+	}
+
+	hlsStates.Lock()
+	defer hlsStates.Unlock()
+	now := time.Now()
+	for k, st := range hlsStates.byKey {
+		if now.Sub(st.used) > hlsStateTTL {
+			delete(hlsStates.byKey, k)
+		}
+	}
+
+	st := hlsStates.byKey[key]
+	if st == nil || pl.mediaSeq < st.windowStart {
+		// New playlist, or the provider restarted its numbering
+		st = &hlsStreamState{next: pl.mediaSeq, windowStart: pl.mediaSeq, decisions: make(map[int64]segmentDecision)}
+		for _, r := range rules {
+			st.filters = append(st.filters, r.newFilter())
+		}
+		hlsStates.byKey[key] = st
+	}
+	st.used = now
+	if pl.mediaSeq > st.next {
+		// Segments we never saw went by: they count as kept
+		st.next = pl.mediaSeq
+	}
+	st.decide(pl.segments)
+	st.fold(pl.mediaSeq)
+	return st.render(pl)
+}
+
+// decide runs the filters over the segments not seen before.
+func (st *hlsStreamState) decide(segments []*hlsManifestSegment) {
+	for _, seg := range segments {
+		if seg.seq < st.next {
+			continue
+		}
+		drop := false
+		for _, f := range st.filters {
+			// Every filter sees every segment, to keep its state right
+			if f(seg) {
+				drop = true
+			}
+		}
+		d := segmentDecision{dropped: drop}
+		switch {
+		case drop && seg.discontinuity():
+			d.discDelta = -1
+			st.pendingDisc = true
+		case drop:
+		case st.pendingDisc:
+			// The splice point needs one discontinuity, however many were dropped
+			if !seg.discontinuity() {
+				d.discDelta = 1
+			}
+			st.pendingDisc = false
+		}
+		st.decisions[seg.seq] = d
+		st.next = seg.seq + 1
+	}
+}
+
+// fold moves the decisions of segments that left the window into the totals.
+func (st *hlsStreamState) fold(windowStart int64) {
+	for seq, d := range st.decisions {
+		if seq >= windowStart {
+			continue
+		}
+		if d.dropped {
+			st.dropsBefore++
+		}
+		st.discBefore += d.discDelta
+		delete(st.decisions, seq)
+	}
+	st.windowStart = windowStart
+}
+
+// render writes the playlist without the dropped segments. The media
+// sequence becomes the first kept segment's upstream number minus every
+// segment dropped before it; the discontinuity sequence moves by the
+// discontinuities removed or added before the window.
+func (st *hlsStreamState) render(pl *hlsMediaPlaylist) string {
+	var body strings.Builder
+	dropped := st.dropsBefore // dropped segments numbered before the first kept one
+	firstKept := int64(-1)
+	lastKey, lastMap := "", "" // in effect upstream
+	sentKey, sentMap := "", "" // in effect in our output
+	for _, seg := range pl.segments {
+		for _, t := range seg.tags {
+			if strings.HasPrefix(t, "#EXT-X-KEY") {
+				lastKey = t
+			} else if strings.HasPrefix(t, "#EXT-X-MAP") {
+				lastMap = t
+			}
+		}
+		d := st.decisions[seg.seq]
+		if d.dropped {
+			if firstKept < 0 {
+				dropped++
+			}
+			continue
+		}
+		if firstKept < 0 {
+			firstKept = seg.seq
+		}
+		if d.discDelta > 0 {
+			body.WriteString("#EXT-X-DISCONTINUITY\n")
+		}
+		// Keys and init sections set on a dropped segment still apply
+		if lastKey != sentKey && !seg.hasTag("#EXT-X-KEY") {
+			body.WriteString(lastKey + "\n")
+		}
+		if lastMap != sentMap && !seg.hasTag("#EXT-X-MAP") {
+			body.WriteString(lastMap + "\n")
+		}
+		sentKey, sentMap = lastKey, lastMap
+		for _, t := range seg.tags {
+			body.WriteString(t + "\n")
+		}
+		body.WriteString(seg.uri + "\n")
+	}
+
+	// With every segment dropped, the sequence is the next kept segment's
+	mediaSeq := st.next - dropped
+	if firstKept >= 0 {
+		mediaSeq = firstKept - dropped
+	}
+
+	var b strings.Builder
+	for _, h := range pl.header {
+		b.WriteString(h + "\n")
+	}
+	b.WriteString("#EXT-X-MEDIA-SEQUENCE:" + strconv.FormatInt(mediaSeq, 10) + "\n")
+	if disc := pl.discSeq + st.discBefore; pl.hasDiscSeq || disc != 0 {
+		b.WriteString("#EXT-X-DISCONTINUITY-SEQUENCE:" + strconv.FormatInt(disc, 10) + "\n")
+	}
+	b.WriteString(body.String())
+	for _, t := range pl.trailer {
+		b.WriteString(t + "\n")
+	}
+	return b.String()
+}
+
+// hlsMediaPlaylist is a media playlist split into its header, segments and
+// the tags after the last segment.
+type hlsMediaPlaylist struct {
+	header     []string
+	mediaSeq   int64
+	discSeq    int64
+	hasDiscSeq bool
+	segments   []*hlsManifestSegment
+	trailer    []string
+}
+
+func parseMediaPlaylist(manifest string) *hlsMediaPlaylist {
+	pl := &hlsMediaPlaylist{}
+	var tags []string
+	inHeader := true
+	for _, line := range strings.Split(manifest, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"):
+			pl.mediaSeq, _ = strconv.ParseInt(strings.TrimPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"), 10, 64)
+		case strings.HasPrefix(line, "#EXT-X-DISCONTINUITY-SEQUENCE:"):
+			pl.discSeq, _ = strconv.ParseInt(strings.TrimPrefix(line, "#EXT-X-DISCONTINUITY-SEQUENCE:"), 10, 64)
+			pl.hasDiscSeq = true
+		case inHeader && isPlaylistHeaderTag(line):
+			pl.header = append(pl.header, line)
+		case strings.HasPrefix(line, "#"):
+			inHeader = false
+			tags = append(tags, line)
+		default:
+			inHeader = false
+			pl.segments = append(pl.segments, &hlsManifestSegment{seq: pl.mediaSeq + int64(len(pl.segments)), tags: tags, uri: line})
+			tags = nil
+		}
+	}
+	pl.trailer = tags
+	return pl
+}
+
+// isPlaylistHeaderTag reports whether a tag describes the whole playlist
+// rather than the segment after it.
+func isPlaylistHeaderTag(line string) bool {
+	for _, p := range []string{"#EXTM3U", "#EXT-X-VERSION", "#EXT-X-TARGETDURATION", "#EXT-X-PLAYLIST-TYPE", "#EXT-X-INDEPENDENT-SEGMENTS", "#EXT-X-START", "#EXT-X-ALLOW-CACHE", "#EXT-X-SERVER-CONTROL", "#EXT-X-PART-INF"} {
+		if strings.HasPrefix(line, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,178 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// useManifestRules makes transformHLSManifest apply rules, with no state left
+// from earlier playlists.
+func useManifestRules(t *testing.T, rules ...manifestRule) {
+	t.Helper()
+	reset := func(rules []manifestRule) {
+		manifestRulesOnce = sync.Once{}
+		manifestRulesOnce.Do(func() {})
+		manifestRules.Lock()
+		manifestRules.rules = rules
+		manifestRules.Unlock()
+		hlsStates.Lock()
+		hlsStates.byKey = make(map[string]*hlsStreamState)
+		hlsStates.Unlock()
+	}
+	reset(rules)
+	t.Cleanup(func() {
+		reset(nil)
+		manifestRulesOnce = sync.Once{}
+	})
+}
+
+var cueOutRule = manifestRule{name: "drop cue-out spans", newFilter: cueOutFilter}
+
+// liveWindow renders segments first..last of a live playlist where segments
+// 101 and 102 are an ad break. The ad break starts with a discontinuity; the
+// return to the show only has one when spliceDisc is set.
+func liveWindow(first, last int64, discSeq int, spliceDisc bool) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:6\n#EXT-X-MEDIA-SEQUENCE:%d\n#EXT-X-DISCONTINUITY-SEQUENCE:%d\n", first, discSeq)
+	for seq := first; seq <= last; seq++ {
+		switch seq {
+		case 101:
+			b.WriteString("#EXT-X-DISCONTINUITY\n#EXT-X-CUE-OUT:DURATION=12\n")
+		case 102:
+			b.WriteString("#EXT-X-CUE-OUT-CONT:ElapsedTime=6,Duration=12\n")
+		case 103:
+			if spliceDisc {
+				b.WriteString("#EXT-X-DISCONTINUITY\n")
+			}
+			b.WriteString("#EXT-X-CUE-IN\n")
+		}
+		name := "show"
+		if seq == 101 || seq == 102 {
+			name = "ad"
+		}
+		fmt.Fprintf(&b, "#EXTINF:6.0,\n%s%d.ts\n", name, seq)
+	}
+	return b.String()
+}
+
+func TestTransformHLSManifestCueOut(t *testing.T) {
+	useManifestRules(t, cueOutRule)
+
+	got := transformHLSManifest("/live/u/p/1.m3u8", liveWindow(100, 104, 0, true))
+	want := "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:6\n" +
+		"#EXT-X-MEDIA-SEQUENCE:100\n#EXT-X-DISCONTINUITY-SEQUENCE:0\n" +
+		"#EXTINF:6.0,\nshow100.ts\n" +
+		"#EXT-X-DISCONTINUITY\n#EXT-X-CUE-IN\n#EXTINF:6.0,\nshow103.ts\n" +
+		"#EXTINF:6.0,\nshow104.ts\n"
+	if got != want {
+		t.Errorf("trimmed manifest =\n%s\nwant\n%s", got, want)
+	}
+
+	// VOD and master playlists pass through untouched
+	vod := liveWindow(100, 104, 0, true) + "#EXT-X-ENDLIST\n"
+	master := "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1280000\nlow.m3u8\n"
+	for name, m := range map[string]string{"vod": vod, "master": master} {
+		if got := transformHLSManifest("/live/u/p/"+name+".m3u8", m); got != m {
+			t.Errorf("%s playlist changed:\n%s", name, got)
+		}
+	}
+}
+
+// playlistView is what a player gets out of one refresh: the number of each
+// segment and the discontinuity sequence of each one.
+type playlistView struct {
+	seq  map[string]int64
+	disc map[string]int64
+}
+
+func viewPlaylist(t *testing.T, manifest string) playlistView {
+	t.Helper()
+	pl := parseMediaPlaylist(manifest)
+	v := playlistView{seq: map[string]int64{}, disc: map[string]int64{}}
+	disc := pl.discSeq
+	for _, seg := range pl.segments {
+		if seg.discontinuity() {
+			disc++
+		}
+		v.seq[seg.uri] = seg.seq
+		v.disc[seg.uri] = disc
+	}
+	return v
+}
+
+// TestTransformHLSManifestRefresh slides the live window over the ad break and
+// checks every kept segment keeps its media sequence and discontinuity
+// sequence numbers from one refresh to the next.
+func TestTransformHLSManifestRefresh(t *testing.T) {
+	for _, spliceDisc := range []bool{true, false} {
+		t.Run(fmt.Sprintf("discontinuity at the splice %v", spliceDisc), func(t *testing.T) {
+			useManifestRules(t, cueOutRule)
+			seen := playlistView{seq: map[string]int64{}, disc: map[string]int64{}}
+			discSeq := 0 // upstream, bumped as discontinuities leave the window
+			for first := int64(99); first <= 104; first++ {
+				if first == 102 || (spliceDisc && first == 104) {
+					discSeq++
+				}
+				out := transformHLSManifest("/live/u/p/1.m3u8", liveWindow(first, first+4, discSeq, spliceDisc))
+				if strings.Contains(out, "ad10") || strings.Contains(out, "CUE-OUT") {
+					t.Fatalf("window %d kept the ad break:\n%s", first, out)
+				}
+				v := viewPlaylist(t, out)
+				for uri, seq := range v.seq {
+					if old, ok := seen.seq[uri]; ok && old != seq {
+						t.Errorf("window %d: %s is segment %d, was %d", first, uri, seq, old)
+					}
+					if old, ok := seen.disc[uri]; ok && old != v.disc[uri] {
+						t.Errorf("window %d: %s is in discontinuity %d, was %d", first, uri, v.disc[uri], old)
+					}
+					seen.seq[uri], seen.disc[uri] = seq, v.disc[uri]
+				}
+			}
+			// Kept segments are numbered without gaps, the show resuming in a
+			// new discontinuity
+			for i, uri := range []string{"show99.ts", "show100.ts", "show103.ts", "show104.ts", "show105.ts"} {
+				if seen.seq[uri] != 99+int64(i) {
+					t.Errorf("%s is segment %d, want %d", uri, seen.seq[uri], 99+i)
+				}
+			}
+			if seen.disc["show103.ts"] != seen.disc["show100.ts"]+1 {
+				t.Errorf("discontinuity of show103.ts = %d, of show100.ts = %d", seen.disc["show103.ts"], seen.disc["show100.ts"])
+			}
+		})
+	}
+}
+
+// TestTransformHLSManifestJoinMidBreak starts watching during an ad break.
+func TestTransformHLSManifestJoinMidBreak(t *testing.T) {
+	useManifestRules(t, cueOutRule)
+	got := transformHLSManifest("/live/u/p/1.m3u8", liveWindow(102, 104, 3, false))
+	want := "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:6\n" +
+		"#EXT-X-MEDIA-SEQUENCE:102\n#EXT-X-DISCONTINUITY-SEQUENCE:3\n" +
+		"#EXT-X-CUE-IN\n#EXTINF:6.0,\nshow103.ts\n" +
+		"#EXTINF:6.0,\nshow104.ts\n"
+	if got != want {
+		t.Errorf("manifest =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestLoadManifestRules(t *testing.T) {
+	useManifestRules(t)
+	manifestRulesOnce = sync.Once{}
+	t.Setenv("HLS_DROP_CUE_OUT", "")
+	t.Setenv("HLS_DROP_SEGMENTS", `/ads/`)
+
+	m := "#EXTM3U\n#EXT-X-MEDIA-SEQUENCE:7\n#EXTINF:6.0,\nshow7.ts\n#EXTINF:6.0,\nhttp://cdn.example/ads/spot.ts\n#EXTINF:6.0,\nshow9.ts\n"
+	got := transformHLSManifest("/live/u/p/2.m3u8", m)
+	want := "#EXTM3U\n#EXT-X-MEDIA-SEQUENCE:7\n#EXTINF:6.0,\nshow7.ts\n#EXTINF:6.0,\nshow9.ts\n"
+	if got != want {
+		t.Errorf("manifest =\n%s\nwant\n%s", got, want)
+	}
+	manifestRules.RLock()
+	n := len(manifestRules.rules)
+	manifestRules.RUnlock()
+	if n != 1 {
+		t.Errorf("%d rules loaded, want only HLS_DROP_SEGMENTS", n)
+	}
+}
@@ -0,0 +1,120 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucasduport/stream-share/pkg/types"
+)
+
+// hlsVariantTTL is how long a variant URI handed out in a master playlist
+// is remembered; players re-fetch the master long before that.
+const hlsVariantTTL = time.Hour
+
+// hlsVariantEntry is a variant URI seen in a master playlist served to a user.
+type hlsVariantEntry struct {
+	variant  types.HLSVariant
+	username string
+	seen     time.Time
+}
+
+// hlsVariants maps the proxy path of each variant playlist to the variant it
+// stands for, so the player's pick can be recognised when it fetches it.
+var hlsVariants = struct {
+	sync.Mutex
+	byPath map[string]hlsVariantEntry
+}{byPath: make(map[string]hlsVariantEntry)}
+
+// parseHLSVariants returns the #EXT-X-STREAM-INF entries of a master
+// playlist, keyed by the URI on the line that follows each of them. Media
+// playlists have none.
+func parseHLSVariants(manifest string) map[string]types.HLSVariant {
+	out := make(map[string]types.HLSVariant)
+	var pending *types.HLSVariant
+	for _, line := range strings.Split(manifest, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+			attrs := hlsAttrs(strings.TrimPrefix(line, "#EXT-X-STREAM-INF:"))
+			v := types.HLSVariant{Resolution: attrs["RESOLUTION"], Codecs: attrs["CODECS"]}
+			v.Bandwidth, _ = strconv.Atoi(attrs["BANDWIDTH"])
+			pending = &v
+		case strings.HasPrefix(line, "#"):
+		default:
+			if pending != nil {
+				out[line] = *pending
+				pending = nil
+			}
+		}
+	}
+	return out
+}
+
+// trackHLSVariants records which rendition a player picked. It is called with
+// every manifest the proxy serves, after rewriting: a master playlist has its
+// variant URIs remembered, and a request for one of them is attributed to the
+// user the master was served to. The manifest itself is never changed.
+func (c *Config) trackHLSVariants(ctx *gin.Context, manifest string) {
+	now := time.Now()
+	reqPath := ctx.Request.URL.Path
+
+	hlsVariants.Lock()
+	defer hlsVariants.Unlock()
+
+	owner, picked := hlsVariants.byPath[reqPath]
+	username := ctx.GetString("username")
+	if username == "" {
+		username = owner.username
+	}
+	if picked && username != "" && c.sessionManager != nil {
+		v := owner.variant
+		v.SelectedAt = now
+		c.sessionManager.SetHLSVariant(username, &v)
+	}
+
+	variants := parseHLSVariants(manifest)
+	if len(variants) == 0 {
+		return
+	}
+	streamID := strings.TrimSuffix(ctx.Param("id"), path.Ext(ctx.Param("id")))
+	if streamID == "" {
+		streamID = owner.variant.StreamID
+	}
+	for p, e := range hlsVariants.byPath {
+		if now.Sub(e.seen) > hlsVariantTTL {
+			delete(hlsVariants.byPath, p)
+		}
+	}
+	for uri, v := range variants {
+		u, err := url.Parse(uri)
+		if err != nil {
+			continue
+		}
+		v.StreamID = streamID
+		hlsVariants.byPath[ctx.Request.URL.ResolveReference(u).Path] = hlsVariantEntry{variant: v, username: username, seen: now}
+	}
+}
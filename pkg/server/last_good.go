@@ -0,0 +1,153 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lucasduport/stream-share/pkg/config"
+	"github.com/lucasduport/stream-share/pkg/utils"
+	xtreamapi "github.com/lucasduport/stream-share/pkg/xtream"
+)
+
+// staleHeader marks a player_api answer served from the last-good copy while
+// the provider fails.
+const staleHeader = "X-Stream-Share-Stale"
+
+// lastGoodRefresh is how old the last-good copy of an answer gets before a
+// new answer replaces it; large catalogs aren't rewritten on every request.
+const lastGoodRefresh = time.Minute
+
+// lastGoodPath is where the last good answer to action with q is kept, under
+// CacheFolder. The player's credentials are left out of the key: every user
+// sees the same provider catalog. "" when no CacheFolder is configured.
+func lastGoodPath(action string, q url.Values) string {
+	if config.CacheFolder == "" {
+		return ""
+	}
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		if k != "username" && k != "password" && k != "action" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(action)
+	for _, k := range keys {
+		b.WriteString("&" + k + "=" + strings.Join(q[k], ","))
+	}
+	sum := sha256.Sum256([]byte(b.String()))
+	return filepath.Join(config.CacheFolder, "last-good", action+"_"+hex.EncodeToString(sum[:8])+".json")
+}
+
+// storeLastGood keeps a successful, non-empty catalog answer on disk for
+// loadLastGood. It is written to a temporary file first, so a crash never
+// leaves a truncated copy behind.
+func storeLastGood(action string, q url.Values, resp interface{}) {
+	path := lastGoodPath(action, q)
+	if path == "" || !xtreamapi.IsCatalogAction(action) || emptyAnswer(resp) {
+		return
+	}
+	if fi, err := os.Stat(path); err == nil && time.Since(fi.ModTime()) < lastGoodRefresh {
+		return
+	}
+	b, err := json.Marshal(resp)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		utils.WarnLog("Last-good cache: %v", err)
+		return
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		utils.WarnLog("Last-good cache: %v", err)
+		return
+	}
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name()) // nolint: errcheck
+		utils.WarnLog("Last-good cache: failed to store %s: %v", action, err)
+	}
+}
+
+// loadLastGood returns the last good answer to action with q and when it was
+// stored.
+func loadLastGood(action string, q url.Values) (interface{}, time.Time, bool) {
+	path := lastGoodPath(action, q)
+	if path == "" || !xtreamapi.IsCatalogAction(action) {
+		return nil, time.Time{}, false
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, time.Time{}, false
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, time.Time{}, false
+	}
+	// Numbers stay json.Number, as in a live answer
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		utils.WarnLog("Last-good cache: unreadable copy of %s: %v", action, err)
+		return nil, time.Time{}, false
+	}
+	return v, fi.ModTime(), true
+}
+
+// emptyAnswer reports whether resp carries nothing worth keeping, like the
+// fallbacks served when the provider fails.
+func emptyAnswer(resp interface{}) bool {
+	switch t := resp.(type) {
+	case nil:
+		return true
+	case []interface{}:
+		return len(t) == 0
+	case []map[string]interface{}:
+		return len(t) == 0
+	case map[string]interface{}:
+		for _, v := range t {
+			if !emptyAnswer(v) {
+				return false
+			}
+		}
+		return true
+	case string:
+		return strings.TrimSpace(t) == ""
+	}
+	return false
+}
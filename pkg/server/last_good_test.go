@@ -0,0 +1,99 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucasduport/stream-share/pkg/config"
+)
+
+func TestEmptyAnswer(t *testing.T) {
+	tests := []struct {
+		name string
+		resp interface{}
+		want bool
+	}{
+		{"nil", nil, true},
+		{"empty array", []interface{}{}, true},
+		{"empty typed array", []map[string]interface{}{}, true},
+		{"typed array", []map[string]interface{}{{"category_id": "1"}}, false},
+		{"empty object", map[string]interface{}{}, true},
+		{"shaped empty object", map[string]interface{}{"info": map[string]interface{}{}, "episodes": []interface{}{}}, true},
+		{"blank string", " ", true},
+		{"array", []interface{}{map[string]interface{}{"stream_id": "1"}}, false},
+		{"object", map[string]interface{}{"info": map[string]interface{}{"name": "x"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := emptyAnswer(tt.resp); got != tt.want {
+				t.Errorf("emptyAnswer(%#v) = %v, want %v", tt.resp, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestPlayerAPILastGood checks that only real provider answers are kept, and
+// that a later unusable answer is replaced by the kept copy.
+func TestPlayerAPILastGood(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("API_CACHE_SECONDS", "0")
+	dir := t.TempDir()
+	old := config.CacheFolder
+	config.CacheFolder = dir
+	t.Cleanup(func() { config.CacheFolder = old })
+
+	body := "<html>maintenance</html>"
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body)) // nolint: errcheck
+	}))
+	defer upstream.Close()
+
+	c := &Config{ProxyConfig: &config.ProxyConfig{XtreamBaseURL: upstream.URL}}
+	q := url.Values{"action": {"get_live_categories"}}
+	call := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = httptest.NewRequest(http.MethodGet, "/player_api.php", nil)
+		c.xtreamPlayerAPI(ctx, q)
+		return w
+	}
+
+	steps := []struct {
+		name      string
+		body      string
+		wantStale bool
+		wantName  string
+		wantKept  bool
+	}{
+		{"html answer is not kept", "<html>maintenance</html>", false, "Default Category", false},
+		{"real answer is kept", `[{"category_id":"7","category_name":"News"}]`, false, "News", true},
+		{"html answer serves the kept copy", "<html>maintenance</html>", true, "News", true},
+		{"empty answer serves the kept copy", "", true, "News", true},
+	}
+	for _, st := range steps {
+		body = st.body
+		w := call()
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want 200", st.name, w.Code)
+		}
+		if got := w.Header().Get(staleHeader) == "true"; got != st.wantStale {
+			t.Errorf("%s: stale = %v, want %v", st.name, got, st.wantStale)
+		}
+		var cats []map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &cats); err != nil || len(cats) != 1 {
+			t.Fatalf("%s: body %q: %v", st.name, w.Body.String(), err)
+		}
+		if got := cats[0]["category_name"]; got != st.wantName {
+			t.Errorf("%s: category_name = %v, want %s", st.name, got, st.wantName)
+		}
+		_, err := os.Stat(lastGoodPath("get_live_categories", q))
+		if kept := err == nil; kept != st.wantKept {
+			t.Errorf("%s: kept = %v, want %v", st.name, kept, st.wantKept)
+		}
+	}
+}
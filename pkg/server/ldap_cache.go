@@ -0,0 +1,185 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"crypto/sha256"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// ldapAuthCache remembers recent LDAP verdicts so players opening many segment
+// requests don't cost one LDAP round-trip each. Entries are keyed by a hash of
+// server, username and password; credentials are never kept in memory.
+type ldapAuthCache struct {
+	mu      sync.Mutex
+	entries map[[32]byte]ldapCacheEntry
+}
+
+type ldapCacheEntry struct {
+	username string
+	ok       bool
+	expires  time.Time
+}
+
+var (
+	ldapCache = &ldapAuthCache{entries: make(map[[32]byte]ldapCacheEntry)}
+	ldapPool  = &ldapServiceConn{}
+
+	ldapCacheTTLOnce sync.Once
+	ldapCacheTTLVal  time.Duration
+)
+
+// ldapCacheTTL reads LDAP_CACHE_TTL ("30s" or seconds, default 60s, 0 disables).
+func ldapCacheTTL() time.Duration {
+	ldapCacheTTLOnce.Do(func() {
+		ldapCacheTTLVal = 60 * time.Second
+		v := strings.TrimSpace(os.Getenv("LDAP_CACHE_TTL"))
+		if v == "" {
+			return
+		}
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			ldapCacheTTLVal = d
+		} else if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			ldapCacheTTLVal = time.Duration(n) * time.Second
+		} else {
+			utils.WarnLog("Invalid LDAP_CACHE_TTL: %s", v)
+		}
+	})
+	return ldapCacheTTLVal
+}
+
+// ldapPoolEnabled reports whether the service-bind search connection is reused (LDAP_POOL, default true).
+func ldapPoolEnabled() bool { return envFlag("LDAP_POOL", true) }
+
+func ldapCacheKey(server, username, password string) [32]byte {
+	return sha256.Sum256([]byte(server + "\x00" + username + "\x00" + password))
+}
+
+func (c *ldapAuthCache) get(key [32]byte) (ok, hit bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, found := c.entries[key]
+	if !found {
+		return false, false
+	}
+	if time.Now().After(e.expires) {
+		delete(c.entries, key)
+		return false, false
+	}
+	return e.ok, true
+}
+
+func (c *ldapAuthCache) put(key [32]byte, username string, ok bool, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	// Repeated wrong passwords each add an entry; drop stale ones as we go
+	if len(c.entries) >= 1024 {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	c.entries[key] = ldapCacheEntry{username: username, ok: ok, expires: now.Add(ttl)}
+}
+
+// invalidate forgets every cached verdict of a user.
+func (c *ldapAuthCache) invalidate(username string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for k, e := range c.entries {
+		if e.username == username {
+			delete(c.entries, k)
+			n++
+		}
+	}
+	return n
+}
+
+// invalidateLDAPCache drops a user's cached LDAP verdicts, so the next request
+// is checked against the directory again.
+func invalidateLDAPCache(username string) {
+	if n := ldapCache.invalidate(username); n > 0 {
+		utils.DebugLog("LDAP cache: dropped %d entries for %s", n, username)
+	}
+}
+
+// ldapServiceConn is a single connection bound as the service account and
+// reused for user searches. User binds never happen on it, so it keeps the
+// service identity.
+type ldapServiceConn struct {
+	mu     sync.Mutex
+	conn   *ldap.Conn
+	server string
+	bindDN string
+}
+
+// search runs req on the pooled connection, redialing once if it went stale.
+func (p *ldapServiceConn) search(server, bindDN, bindPassword string, req *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		if p.conn == nil || p.conn.IsClosing() || p.server != server || p.bindDN != bindDN {
+			if err := p.dialLocked(server, bindDN, bindPassword); err != nil {
+				return nil, err
+			}
+		}
+		sr, err := p.conn.Search(req)
+		if err == nil || attempt > 0 {
+			if err != nil {
+				p.closeLocked()
+			}
+			return sr, err
+		}
+		utils.DebugLog("LDAP pooled search failed, redialing: %v", err)
+		p.closeLocked()
+	}
+}
+
+func (p *ldapServiceConn) dialLocked(server, bindDN, bindPassword string) error {
+	p.closeLocked()
+	utils.DebugLog("LDAP DialURL (pooled): %s", server)
+	l, err := ldap.DialURL(server)
+	if err != nil {
+		return err
+	}
+	if err := l.Bind(bindDN, bindPassword); err != nil {
+		l.Close()
+		return err
+	}
+	p.conn, p.server, p.bindDN = l, server, bindDN
+	return nil
+}
+
+func (p *ldapServiceConn) closeLocked() {
+	if p.conn != nil {
+		p.conn.Close()
+		p.conn = nil
+	}
+}
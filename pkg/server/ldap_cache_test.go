@@ -0,0 +1,257 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucasduport/stream-share/pkg/config"
+	"github.com/lucasduport/stream-share/pkg/types"
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// fakeLDAP is a minimal LDAP server: it accepts the service and user binds
+// below, answers every search with one user entry, and counts connections
+// and binds. While down is set it hangs up on every connection.
+type fakeLDAP struct {
+	url          string
+	conns, binds atomic.Int32
+	down         atomic.Bool
+}
+
+const (
+	fakeServiceDN, fakeServicePassword = "cn=svc,dc=example", "svc-pass"
+	fakeUserDN, fakeUserPassword       = "uid=alice,dc=example", "alice-pass"
+)
+
+func newFakeLDAP(t *testing.T) *fakeLDAP {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	f := &fakeLDAP{url: "ldap://" + ln.Addr().String()}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			f.conns.Add(1)
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+// berTLV encodes one BER element with a short or long form length.
+func berTLV(tag byte, content []byte) []byte {
+	n := len(content)
+	switch {
+	case n < 0x80:
+		return append([]byte{tag, byte(n)}, content...)
+	case n < 0x100:
+		return append([]byte{tag, 0x81, byte(n)}, content...)
+	default:
+		return append([]byte{tag, 0x82, byte(n >> 8), byte(n)}, content...)
+	}
+}
+
+// berRead reads one BER element and returns its tag and content.
+func berRead(r *bufio.Reader) (byte, []byte, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	l, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n := int(l)
+	if l&0x80 != 0 {
+		n = 0
+		for i := 0; i < int(l&0x7f); i++ {
+			b, err := r.ReadByte()
+			if err != nil {
+				return 0, nil, err
+			}
+			n = n<<8 | int(b)
+		}
+	}
+	content := make([]byte, n)
+	_, err = io.ReadFull(r, content)
+	return tag, content, err
+}
+
+// berSplit splits a constructed element's content into its children.
+func berSplit(content []byte) [][]byte {
+	var out [][]byte
+	r := bufio.NewReader(bytes.NewReader(content))
+	for {
+		_, c, err := berRead(r)
+		if err != nil {
+			return out
+		}
+		out = append(out, c)
+	}
+}
+
+func (f *fakeLDAP) serve(conn net.Conn) {
+	defer conn.Close()
+	if f.down.Load() {
+		return
+	}
+	r := bufio.NewReader(conn)
+	for {
+		_, msg, err := berRead(r)
+		if err != nil {
+			return
+		}
+		// LDAPMessage: messageID, then the protocol op
+		idEnd := 2 + int(msg[1])
+		id := berTLV(0x02, msg[2:idEnd])
+		op := msg[idEnd]
+		result := func(tag byte, code byte) []byte {
+			return berTLV(0x30, append(id, berTLV(tag, concat(berTLV(0x0a, []byte{code}), berTLV(0x04, nil), berTLV(0x04, nil)))...))
+		}
+		switch op {
+		case 0x60: // bindRequest: version, name, [0] simple password
+			f.binds.Add(1)
+			parts := berSplit(berSplit(msg[idEnd:])[0])
+			code := byte(49) // invalidCredentials
+			if len(parts) >= 3 {
+				dn, pw := string(parts[1]), string(parts[2])
+				if (dn == fakeServiceDN && pw == fakeServicePassword) || (dn == fakeUserDN && pw == fakeUserPassword) {
+					code = 0
+				}
+			}
+			conn.Write(result(0x61, code)) // nolint: errcheck
+		case 0x63: // searchRequest
+			entry := berTLV(0x30, append(id, berTLV(0x64, concat(berTLV(0x04, []byte(fakeUserDN)), berTLV(0x30, nil)))...))
+			conn.Write(concat(entry, result(0x65, 0))) // nolint: errcheck
+		default: // unbind and anything else
+			return
+		}
+	}
+}
+
+// TestLDAPAuthCache checks that a second auth within the TTL, right or wrong,
+// does not reach the directory, and that invalidation forces a new check.
+func TestLDAPAuthCache(t *testing.T) {
+	t.Setenv("LDAP_POOL", "true")
+	if ldapCacheTTL() <= 0 {
+		t.Skip("LDAP_CACHE_TTL disables the cache")
+	}
+	oldCache := ldapCache
+	ldapCache = &ldapAuthCache{entries: make(map[[32]byte]ldapCacheEntry)}
+	t.Cleanup(func() {
+		ldapPool.mu.Lock()
+		ldapPool.closeLocked()
+		ldapPool.mu.Unlock()
+		ldapCache = oldCache
+	})
+
+	srv := newFakeLDAP(t)
+	auth := func(password string) bool {
+		ok, err := ldapAuthenticate(utils.RequestLogger{}, srv.url, "dc=example", fakeServiceDN, fakeServicePassword, "uid", "memberOf", "", "alice", password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+	steps := []struct {
+		name       string
+		password   string
+		invalidate bool
+		want       bool
+		wantBinds  int32 // binds this step, 0 when answered from the cache
+	}{
+		{"first auth dials", fakeUserPassword, false, true, 2}, // service bind + user bind
+		{"second auth is cached", fakeUserPassword, false, true, 0},
+		{"wrong password dials", "wrong", false, false, 1}, // pooled search, user bind
+		{"wrong password is cached", "wrong", false, false, 0},
+		{"invalidated auth dials again", fakeUserPassword, true, true, 1},
+	}
+	for _, st := range steps {
+		if st.invalidate {
+			invalidateLDAPCache("alice")
+		}
+		before := srv.binds.Load()
+		if got := auth(st.password); got != st.want {
+			t.Errorf("%s: auth = %v, want %v", st.name, got, st.want)
+		}
+		if got := srv.binds.Load() - before; got != st.wantBinds {
+			t.Errorf("%s: %d binds, want %d", st.name, got, st.wantBinds)
+		}
+	}
+	// One pooled service connection plus one connection per user bind
+	deadline := time.Now().Add(time.Second)
+	for srv.conns.Load() != 4 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := srv.conns.Load(); got != 4 {
+		t.Errorf("%d LDAP connections, want 4", got)
+	}
+}
+
+// TestLDAPOutage checks that a directory that can't be reached is neither
+// cached as a rejection nor counted as a failed login.
+func TestLDAPOutage(t *testing.T) {
+	t.Setenv("LDAP_POOL", "false")
+	oldCache := ldapCache
+	ldapCache = &ldapAuthCache{entries: make(map[[32]byte]ldapCacheEntry)}
+	t.Cleanup(func() { ldapCache = oldCache })
+
+	srv := newFakeLDAP(t)
+	srv.down.Store(true)
+	if ok, err := ldapAuthenticate(utils.RequestLogger{}, srv.url, "dc=example", fakeServiceDN, fakeServicePassword, "uid", "memberOf", "", "alice", fakeUserPassword); ok || err == nil {
+		t.Fatalf("auth with the directory down = %v, %v, want an error", ok, err)
+	}
+
+	c := &Config{ProxyConfig: &config.ProxyConfig{
+		LDAPEnabled:       true,
+		LDAPServer:        srv.url,
+		LDAPBaseDN:        "dc=example",
+		LDAPBindDN:        fakeServiceDN,
+		LDAPBindPassword:  fakeServicePassword,
+		LDAPUserAttribute: "uid",
+	}}
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Request = httptest.NewRequest(http.MethodGet, "/alice/"+fakeUserPassword+"/1.ts", nil)
+	ctx.Params = gin.Params{{Key: "username", Value: "alice"}, {Key: "password", Value: fakeUserPassword}}
+	c.authWithPathCredentials()(ctx)
+	var resp types.APIResponse
+	json.Unmarshal(w.Body.Bytes(), &resp) // nolint: errcheck
+	if w.Code != http.StatusServiceUnavailable || resp.Code != errCodeAuthUnavailable {
+		t.Errorf("login with the directory down answered %d %q, want 503 %s", w.Code, resp.Code, errCodeAuthUnavailable)
+	}
+	if l := authRateLimiter(); l != nil {
+		l.mu.Lock()
+		_, counted := l.entries["user:alice"]
+		l.mu.Unlock()
+		if counted {
+			t.Error("the outage counted as a failed login")
+		}
+	}
+
+	// Back up: the credentials are checked again, not answered from the cache
+	srv.down.Store(false)
+	before := srv.binds.Load()
+	ok, err := ldapAuthenticate(utils.RequestLogger{}, srv.url, "dc=example", fakeServiceDN, fakeServicePassword, "uid", "memberOf", "", "alice", fakeUserPassword)
+	if !ok || err != nil {
+		t.Errorf("auth once the directory is back = %v, %v, want true", ok, err)
+	}
+	if got := srv.binds.Load() - before; got != 2 {
+		t.Errorf("%d binds once the directory is back, want 2", got)
+	}
+}
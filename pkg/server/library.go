@@ -0,0 +1,159 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jamesnetherton/m3u"
+	"github.com/lucasduport/stream-share/pkg/types"
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// Library scopes, set with LIBRARY_SCOPE.
+const (
+	libraryScopeAll       = "all"       // every cached item, the cache being shared
+	libraryScopeRequester = "requester" // only items the user asked to cache
+)
+
+// libraryScope reads LIBRARY_SCOPE (default all).
+func libraryScope() string {
+	switch v := strings.ToLower(strings.TrimSpace(os.Getenv("LIBRARY_SCOPE"))); v {
+	case "", libraryScopeAll:
+		return libraryScopeAll
+	case libraryScopeRequester:
+		return libraryScopeRequester
+	default:
+		utils.WarnLog("Invalid LIBRARY_SCOPE: %s", v)
+		return libraryScopeAll
+	}
+}
+
+// libraryEntries returns the ready movies and episodes of this provider's
+// cache that username may see, sorted by type then title.
+func (c *Config) libraryEntries(username string) ([]types.VODCacheEntry, error) {
+	list, err := c.db.ListVODCache(0)
+	if err != nil {
+		return nil, err
+	}
+	scope := libraryScope()
+	provider := c.db.Provider()
+	blocked := blockedStreams()
+	out := make([]types.VODCacheEntry, 0, len(list))
+	for _, e := range list {
+		if e.Status != "ready" || (e.Type != "movie" && e.Type != "series") {
+			continue
+		}
+		if e.Provider != provider || blocked.streamBlocked(e.StreamID) {
+			continue
+		}
+		if scope == libraryScopeRequester && !strings.EqualFold(e.RequestedBy, username) {
+			continue
+		}
+		out = append(out, e)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Type != out[j].Type {
+			return out[i].Type == "movie"
+		}
+		return strings.ToLower(libraryTitle(out[i])) < strings.ToLower(libraryTitle(out[j]))
+	})
+	return out, nil
+}
+
+// libraryTitle is the name shown for a cached item: the show and episode
+// number for an episode, else its stored title.
+func libraryTitle(e types.VODCacheEntry) string {
+	if e.Type == "series" && strings.TrimSpace(e.SeriesTitle) != "" && (e.Season > 0 || e.Episode > 0) {
+		return fmt.Sprintf("%s S%02dE%02d", strings.TrimSpace(e.SeriesTitle), e.Season, e.Episode)
+	}
+	if t := strings.TrimSpace(e.Title); t != "" {
+		return t
+	}
+	return e.StreamID
+}
+
+// libraryGroup is the group-title of a cached item.
+func libraryGroup(e types.VODCacheEntry) string {
+	if e.Type == "series" {
+		return "Cached series"
+	}
+	return "Cached movies"
+}
+
+// libraryM3U serves /library.m3u: the cached movies and episodes, pointing
+// at this proxy's local copies with the caller's credentials. It is built
+// from the database on each request, so it always matches the cache.
+func (c *Config) libraryM3U(ctx *gin.Context) {
+	if c.db == nil {
+		abortJSON(ctx, http.StatusServiceUnavailable, errCodeDatabaseUnavailable, "VOD cache is unavailable: database not initialized")
+		return
+	}
+	username, password := ctx.Query("username"), ctx.Query("password")
+	entries, err := c.libraryEntries(username)
+	if err != nil {
+		abortError(ctx, http.StatusInternalServerError, errCodeInternal, "Could not list the cache", err)
+		return
+	}
+
+	public := c.advertised()
+	var buf bytes.Buffer
+	buf.WriteString("#EXTM3U\n")
+	for _, e := range entries {
+		title := libraryTitle(e)
+		ext := path.Ext(e.FilePath)
+		uri := fmt.Sprintf("%s://%s/%s/%s/%s/%s%s", public.scheme, public.hostPort(), e.Type,
+			url.PathEscape(username), url.PathEscape(password), url.PathEscape(e.StreamID), ext)
+		fmt.Fprintf(&buf, "#EXTINF:-1 %s %s,%s\n%s\n",
+			m3uAttr(m3u.Tag{Name: "tvg-name", Value: title}),
+			m3uAttr(m3u.Tag{Name: "group-title", Value: libraryGroup(e)}),
+			strings.NewReplacer("\r", " ", "\n", " ").Replace(title), uri)
+	}
+	ctx.Header("Content-Disposition", `attachment; filename="library.m3u"`)
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Data(http.StatusOK, "audio/x-mpegurl", buf.Bytes())
+}
+
+// getLibraryLink tells the bot where a user's library playlist is. The
+// password is left for the user to fill in.
+func (c *Config) getLibraryLink(ctx *gin.Context) {
+	if c.db == nil {
+		abortJSON(ctx, http.StatusServiceUnavailable, errCodeDatabaseUnavailable, "VOD cache is unavailable: database not initialized")
+		return
+	}
+	username := ctx.Param("username")
+	entries, err := c.libraryEntries(username)
+	if err != nil {
+		abortError(ctx, http.StatusInternalServerError, errCodeInternal, "Could not list the cache", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, types.APIResponse{Success: true, Data: map[string]interface{}{
+		"url":   fmt.Sprintf("%s/library.m3u?username=%s&password=", c.publicBaseURL(), url.QueryEscape(username)),
+		"count": len(entries),
+		"scope": libraryScope(),
+	}})
+}
@@ -0,0 +1,147 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// liveOutputFormats are the live containers the proxy serves, advertised as
+// allowed_output_formats. Both are passed through from the provider: nothing
+// is transcoded or transmuxed, so rtmp is never offered.
+var liveOutputFormats = []string{"m3u8", "ts"}
+
+// liveProbeTTL is how long a variant probe result is reused.
+const liveProbeTTL = 10 * time.Minute
+
+var liveProbes = struct {
+	sync.Mutex
+	m map[string]liveProbe // upstream URL without credentials -> result
+}{m: make(map[string]liveProbe)}
+
+type liveProbe struct {
+	ok bool
+	at time.Time
+}
+
+// requestedLiveFormat returns "hls" or "ts" from ?output= or, failing that,
+// the extension of the requested id.
+func requestedLiveFormat(ctx *gin.Context, id string) string {
+	switch strings.ToLower(ctx.Query("output")) {
+	case "hls", "m3u8":
+		return "hls"
+	case "ts", "mpegts":
+		return "ts"
+	}
+	if strings.EqualFold(path.Ext(id), ".m3u8") {
+		return "hls"
+	}
+	return "ts"
+}
+
+// serveLive serves a live channel in the format the client asked for, falling
+// back to the other one when the provider lacks it: HLS requests get the TS
+// stream, TS requests get the provider's HLS playlist. serveTS proxies a TS URL.
+func (c *Config) serveLive(ctx *gin.Context, id string, serveTS func(*url.URL)) {
+	bare := strings.TrimSuffix(id, path.Ext(id))
+	variant := func(ext string) *url.URL {
+		u, err := url.Parse(fmt.Sprintf("%s/live/%s/%s/%s%s", c.XtreamBaseURL, c.XtreamUser, c.XtreamPassword, bare, ext))
+		if err != nil {
+			reqLog(ctx).ErrorLog("Failed to parse upstream URL: %v", err)
+		}
+		return u
+	}
+
+	if requestedLiveFormat(ctx, id) == "hls" {
+		hlsURL := variant(".m3u8")
+		if hlsURL != nil && c.liveVariantAvailable(ctx, hlsURL) {
+			c.hlsXtreamStream(ctx, hlsURL)
+			return
+		}
+		reqLog(ctx).InfoLog("Live %s: provider has no HLS variant, serving TS instead", bare)
+		if tsURL := variant(".ts"); tsURL != nil {
+			serveTS(tsURL)
+			return
+		}
+		abortJSON(ctx, http.StatusInternalServerError, errCodeInternal, "Could not build upstream URL")
+		return
+	}
+
+	tsURL := variant(path.Ext(id))
+	if tsURL == nil {
+		abortJSON(ctx, http.StatusInternalServerError, errCodeInternal, "Could not build upstream URL")
+		return
+	}
+	// A running stream is joined without touching the provider, so skip the probe
+	running := false
+	if c.sessionManager != nil {
+		_, running = c.sessionManager.GetStreamInfo(path.Base(tsURL.Path))
+	}
+	if !running && !c.liveVariantAvailable(ctx, tsURL) {
+		if hlsURL := variant(".m3u8"); hlsURL != nil && c.liveVariantAvailable(ctx, hlsURL) {
+			reqLog(ctx).InfoLog("Live %s: provider has no TS variant, serving its HLS playlist instead", bare)
+			c.hlsXtreamStream(ctx, hlsURL)
+			return
+		}
+	}
+	serveTS(tsURL)
+}
+
+// liveVariantAvailable reports whether the provider answers u without an
+// error status. Only the response headers are read; results are cached for
+// liveProbeTTL so players reconnecting do not probe again.
+func (c *Config) liveVariantAvailable(ctx *gin.Context, u *url.URL) bool {
+	key := path.Base(u.Path)
+	liveProbes.Lock()
+	p, ok := liveProbes.m[key]
+	liveProbes.Unlock()
+	if ok && time.Since(p.at) < liveProbeTTL {
+		return p.ok
+	}
+
+	available := false
+	req, err := http.NewRequestWithContext(ctx.Request.Context(), "GET", u.String(), nil)
+	if err == nil {
+		req.Header.Set("User-Agent", utils.UserAgentFor(req.URL.Host))
+		client := &http.Client{Timeout: 10 * time.Second}
+		if resp, err := client.Do(req); err == nil {
+			resp.Body.Close()
+			available = resp.StatusCode < 400
+			reqLog(ctx).DebugLog("Live probe %s: HTTP %d", key, resp.StatusCode)
+		} else {
+			reqLog(ctx).DebugLog("Live probe %s failed: %v", key, err)
+		}
+	}
+	// A client that went away says nothing about the provider
+	if ctx.Request.Context().Err() == nil {
+		liveProbes.Lock()
+		liveProbes.m[key] = liveProbe{ok: available, at: time.Now()}
+		liveProbes.Unlock()
+	}
+	return available
+}
@@ -0,0 +1,245 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"container/list"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+const maxLogoBytes = 1 << 20 // logos above this are refused
+
+type cachedLogo struct {
+	data        []byte
+	contentType string
+	fetchedAt   time.Time
+}
+
+// logoCacheEntry is the value of a logoCacheOrder element.
+type logoCacheEntry struct {
+	target string
+	logo   cachedLogo
+}
+
+var (
+	logoCache      = map[string]*list.Element{} // target -> element in logoCacheOrder
+	logoCacheOrder = list.New()                 // LRU order of the cached logos, most recent first
+	logoCacheBytes int
+	logoCacheMax   = 64 << 20 // total size of the cached logos
+	logoCacheLock  sync.Mutex
+	logoClient     = &http.Client{Timeout: 10 * time.Second}
+
+	logoKeyOnce sync.Once
+	logoKey     []byte
+)
+
+// logoProxyEnabled reports whether PROXY_LOGOS routes tvg-logo through /logo.
+func logoProxyEnabled() bool {
+	return envFlag("PROXY_LOGOS", false)
+}
+
+// logoCacheTTL reads LOGO_CACHE_HOURS (default 24).
+func logoCacheTTL() time.Duration {
+	if v := strings.TrimSpace(os.Getenv("LOGO_CACHE_HOURS")); v != "" {
+		if h, err := strconv.Atoi(v); err == nil && h > 0 {
+			return time.Duration(h) * time.Hour
+		}
+		utils.WarnLog("Invalid LOGO_CACHE_HOURS: %s", v)
+	}
+	return 24 * time.Hour
+}
+
+// logoSigningKey returns the secret logo URLs are signed with. It is kept apart
+// from the API keys, so rotating API_KEYS leaves the logo URLs of playlists
+// players already downloaded valid. LOGO_SIGNING_KEY sets it; otherwise a
+// random key is generated once and kept in the cache directory.
+func logoSigningKey() []byte {
+	logoKeyOnce.Do(func() { logoKey = loadLogoSigningKey() })
+	return logoKey
+}
+
+func loadLogoSigningKey() []byte {
+	if k := strings.TrimSpace(os.Getenv("LOGO_SIGNING_KEY")); k != "" {
+		return []byte(k)
+	}
+	path := ""
+	if dir := cacheDir(); dir != "" {
+		path = filepath.Join(dir, ".logo-signing-key")
+		if data, err := os.ReadFile(path); err == nil && len(data) >= 32 {
+			return data
+		}
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		utils.ErrorLog("Could not generate a logo signing key: %v", err)
+		return []byte(GetAPIKey())
+	}
+	if path != "" {
+		if err := os.WriteFile(path, key, 0o600); err != nil {
+			utils.WarnLog("Could not save the logo signing key to %s, logo URLs change on restart: %v", path, err)
+		}
+	}
+	return key
+}
+
+// logoSignature is the HMAC of a logo target keyed with logoSigningKey, so
+// only URLs written into our own playlists can be fetched through /logo.
+func logoSignature(target string) []byte {
+	mac := hmac.New(sha256.New, logoSigningKey())
+	mac.Write([]byte(target))
+	return mac.Sum(nil)[:16]
+}
+
+// signLogoURL encodes target and its signature into the single "u" parameter.
+func signLogoURL(target string) string {
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(target)) + "." + enc.EncodeToString(logoSignature(target))
+}
+
+// verifyLogoURL decodes a "u" parameter and returns the target if the signature matches.
+func verifyLogoURL(signed string) (string, bool) {
+	enc := base64.RawURLEncoding
+	i := strings.LastIndex(signed, ".")
+	if i <= 0 {
+		return "", false
+	}
+	target, err1 := enc.DecodeString(signed[:i])
+	sig, err2 := enc.DecodeString(signed[i+1:])
+	if err1 != nil || err2 != nil || !hmac.Equal(sig, logoSignature(string(target))) {
+		return "", false
+	}
+	return string(target), true
+}
+
+// proxiedLogoURL returns the /logo URL for an upstream logo, or the logo itself
+// when the proxy is disabled or the value isn't an http(s) URL.
+func (c *Config) proxiedLogoURL(logo string) string {
+	if !logoProxyEnabled() {
+		return logo
+	}
+	if u, err := url.Parse(logo); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return logo
+	}
+	return c.publicBaseURL() + "/logo?u=" + signLogoURL(logo)
+}
+
+// fetchLogo returns a logo from the cache or downloads it.
+func fetchLogo(target string) (cachedLogo, error) {
+	if entry, ok := cachedLogoFor(target); ok && time.Since(entry.fetchedAt) < logoCacheTTL() {
+		return entry, nil
+	}
+
+	req, err := http.NewRequest("GET", target, nil)
+	if err != nil {
+		return cachedLogo{}, err
+	}
+	req.Header.Set("User-Agent", utils.UserAgentFor(req.URL.Host))
+	resp, err := logoClient.Do(req)
+	if err != nil {
+		return cachedLogo{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return cachedLogo{}, fmt.Errorf("logo upstream status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxLogoBytes+1))
+	if err != nil {
+		return cachedLogo{}, err
+	}
+	if len(data) > maxLogoBytes {
+		return cachedLogo{}, fmt.Errorf("logo larger than %d bytes", maxLogoBytes)
+	}
+	ct := resp.Header.Get("Content-Type")
+	if !strings.HasPrefix(ct, "image/") {
+		ct = http.DetectContentType(data)
+		if !strings.HasPrefix(ct, "image/") {
+			return cachedLogo{}, fmt.Errorf("logo is not an image (%s)", ct)
+		}
+	}
+
+	entry := cachedLogo{data: data, contentType: ct, fetchedAt: time.Now()}
+	storeLogo(target, entry)
+	return entry, nil
+}
+
+// cachedLogoFor returns the cached logo of target, expired or not, and marks
+// it as recently used.
+func cachedLogoFor(target string) (cachedLogo, bool) {
+	logoCacheLock.Lock()
+	defer logoCacheLock.Unlock()
+	e, ok := logoCache[target]
+	if !ok {
+		return cachedLogo{}, false
+	}
+	logoCacheOrder.MoveToFront(e)
+	return e.Value.(*logoCacheEntry).logo, true
+}
+
+// storeLogo caches the logo of target, then drops the least recently used
+// logos until the cache fits in logoCacheMax bytes.
+func storeLogo(target string, logo cachedLogo) {
+	logoCacheLock.Lock()
+	defer logoCacheLock.Unlock()
+	if e, ok := logoCache[target]; ok {
+		logoCacheBytes -= len(e.Value.(*logoCacheEntry).logo.data)
+		logoCacheOrder.Remove(e)
+	}
+	logoCache[target] = logoCacheOrder.PushFront(&logoCacheEntry{target: target, logo: logo})
+	logoCacheBytes += len(logo.data)
+	for logoCacheBytes > logoCacheMax {
+		oldest := logoCacheOrder.Back()
+		old := oldest.Value.(*logoCacheEntry)
+		logoCacheOrder.Remove(oldest)
+		delete(logoCache, old.target)
+		logoCacheBytes -= len(old.logo.data)
+	}
+}
+
+// serveLogo handles GET /logo?u=<signed>.
+func (c *Config) serveLogo(ctx *gin.Context) {
+	target, ok := verifyLogoURL(ctx.Query("u"))
+	if !ok {
+		abortJSON(ctx, http.StatusForbidden, errCodeForbidden, "Invalid logo signature")
+		return
+	}
+	logo, err := fetchLogo(target)
+	if err != nil {
+		reqLog(ctx).DebugLog("Logo proxy: %s: %v", utils.MaskURL(target), err)
+		abortJSON(ctx, http.StatusBadGateway, errCodeUpstreamError, "Could not fetch logo")
+		return
+	}
+	ctx.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(logoCacheTTL().Seconds())))
+	ctx.Data(http.StatusOK, logo.contentType, logo.data)
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLogoURLSigning(t *testing.T) {
+	const target = "http://logos.example/ch1.png"
+	signed := signLogoURL(target)
+	if got, ok := verifyLogoURL(signed); !ok || got != target {
+		t.Fatalf("verifyLogoURL(signLogoURL) = %q, %v", got, ok)
+	}
+
+	// Rotating the API key must not invalidate logo URLs already handed out
+	key := internalAPIKey
+	internalAPIKey = "rotated-key"
+	_, ok := verifyLogoURL(signed)
+	internalAPIKey = key
+	if !ok {
+		t.Error("logo URL rejected after the API key changed")
+	}
+
+	other := signLogoURL("http://evil.example/x.png")
+	tests := []struct {
+		name, signed string
+	}{
+		{"other target with this signature", other[:strings.LastIndex(other, ".")] + signed[strings.LastIndex(signed, "."):]},
+		{"truncated signature", signed[:len(signed)-2]},
+		{"no signature", signed[:strings.LastIndex(signed, ".")]},
+		{"empty", ""},
+		{"not base64", "%%%.%%%"},
+	}
+	for _, tt := range tests {
+		if got, ok := verifyLogoURL(tt.signed); ok {
+			t.Errorf("%s: accepted, target %q", tt.name, got)
+		}
+	}
+}
+
+func TestFetchLogoCache(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n0000")
+	var hits atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if r.URL.Path == "/page.html" {
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html></html>")) // nolint: errcheck
+			return
+		}
+		w.Write(png) // nolint: errcheck
+	}))
+	defer upstream.Close()
+	target := upstream.URL + "/logo.png"
+
+	for i := 0; i < 2; i++ {
+		logo, err := fetchLogo(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if logo.contentType != "image/png" || string(logo.data) != string(png) {
+			t.Fatalf("logo = %q (%s)", logo.data, logo.contentType)
+		}
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("%d upstream fetches for two requests, want 1", n)
+	}
+
+	// An entry older than LOGO_CACHE_HOURS is fetched again
+	e, _ := cachedLogoFor(target)
+	e.fetchedAt = time.Now().Add(-logoCacheTTL() - time.Minute)
+	storeLogo(target, e)
+	if _, err := fetchLogo(target); err != nil {
+		t.Fatal(err)
+	}
+	if n := hits.Load(); n != 2 {
+		t.Errorf("%d upstream fetches after expiry, want 2", n)
+	}
+
+	if _, err := fetchLogo(upstream.URL + "/page.html"); err == nil {
+		t.Error("an HTML page was accepted as a logo")
+	}
+}
+
+func TestLogoCacheEviction(t *testing.T) {
+	logoCacheLock.Lock()
+	max := logoCacheMax
+	logoCacheMax = 3000
+	logoCacheLock.Unlock()
+	t.Cleanup(func() {
+		logoCacheLock.Lock()
+		logoCacheMax = max
+		logoCacheLock.Unlock()
+	})
+
+	logo := func(n int) cachedLogo {
+		return cachedLogo{data: make([]byte, n), contentType: "image/png", fetchedAt: time.Now()}
+	}
+	storeLogo("http://logos.example/a.png", logo(1000))
+	storeLogo("http://logos.example/b.png", logo(1000))
+	storeLogo("http://logos.example/c.png", logo(1000))
+	// a becomes the most recently used, so b is the first to go
+	if _, ok := cachedLogoFor("http://logos.example/a.png"); !ok {
+		t.Fatal("a.png not cached")
+	}
+	storeLogo("http://logos.example/d.png", logo(1000))
+
+	for target, want := range map[string]bool{
+		"http://logos.example/a.png": true,
+		"http://logos.example/b.png": false,
+		"http://logos.example/c.png": true,
+		"http://logos.example/d.png": true,
+	} {
+		if _, ok := cachedLogoFor(target); ok != want {
+			t.Errorf("%s cached = %v, want %v", target, ok, want)
+		}
+	}
+
+	// Replacing an entry accounts for its new size
+	storeLogo("http://logos.example/c.png", logo(2000))
+	logoCacheLock.Lock()
+	size := logoCacheBytes
+	logoCacheLock.Unlock()
+	if size > 3000 {
+		t.Errorf("cache holds %d bytes, over its %d byte budget", size, 3000)
+	}
+	if _, ok := cachedLogoFor("http://logos.example/c.png"); !ok {
+		t.Error("the replaced c.png was evicted")
+	}
+}
@@ -86,11 +86,7 @@ func (c *Config) ensureChannelIndex() {
 			continue
 		}
 		if strings.HasPrefix(line, "#EXTINF:") {
-			if idx := strings.LastIndex(line, ","); idx != -1 && idx+1 < len(line) {
-				lastTitle = strings.TrimSpace(line[idx+1:])
-			} else {
-				lastTitle = ""
-			}
+			lastTitle = extinfTitle(line)
 			continue
 		}
 		if strings.HasPrefix(line, "http://") || strings.HasPrefix(line, "https://") {
@@ -123,3 +119,34 @@ func (c *Config) getChannelNameByID(streamID string) (string, bool) {
 	name, ok := channelIndex[normalizeStreamID(streamID)]
 	return name, ok
 }
+
+// findChannelIDByName returns the stream ID of the channel whose name matches
+// (case-insensitive), falling back to a unique partial match.
+func (c *Config) findChannelIDByName(name string) (string, bool) {
+	c.ensureChannelIndex()
+	channelIndexMu.RLock()
+	defer channelIndexMu.RUnlock()
+	return matchChannelName(channelIndex, name)
+}
+
+// matchChannelName looks name up in an id -> name table: an exact
+// case-insensitive match wins, otherwise a single partial match is accepted.
+func matchChannelName(index map[string]string, name string) (string, bool) {
+	q := strings.ToLower(strings.TrimSpace(name))
+	if q == "" {
+		return "", false
+	}
+	partial := ""
+	partials := 0
+	for id, n := range index {
+		ln := strings.ToLower(n)
+		if ln == q {
+			return id, true
+		}
+		if strings.Contains(ln, q) {
+			partial = id
+			partials++
+		}
+	}
+	return partial, partials == 1
+}
@@ -0,0 +1,90 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/jamesnetherton/m3u"
+)
+
+// catchupStartPlaceholder is timeshiftStartLayout written with the
+// placeholders players fill in with the programme start.
+const catchupStartPlaceholder = "{Y}-{m}-{d}:{H}-{M}"
+
+// m3uTagOptions says which optional tags generated tracks carry. All are off
+// by default so a minimal playlist stays minimal.
+type m3uTagOptions struct {
+	channelNumber bool // tvg-chno from the provider's num (M3U_TVG_CHNO)
+	catchup       bool // catchup and catchup-days on archived channels (M3U_CATCHUP)
+	catchupSource bool // catchup-source pointing at this proxy (M3U_CATCHUP_SOURCE)
+}
+
+func loadM3UTagOptions() m3uTagOptions {
+	return m3uTagOptions{
+		channelNumber: envFlag("M3U_TVG_CHNO", false),
+		catchup:       envFlag("M3U_CATCHUP", false),
+		catchupSource: envFlag("M3U_CATCHUP_SOURCE", false),
+	}
+}
+
+// extraTrackTags returns the optional tags of a live stream from
+// get_live_streams, in the order they are written after the standard ones.
+func (c *Config) extraTrackTags(opts m3uTagOptions, stream map[string]interface{}, streamID string) []m3u.Tag {
+	var tags []m3u.Tag
+	if opts.channelNumber {
+		if num := toInt(stream["num"]); num > 0 {
+			tags = append(tags, m3u.Tag{Name: "tvg-chno", Value: strconv.Itoa(num)})
+		}
+	}
+	if !opts.catchup || toInt(stream["tv_archive"]) != 1 {
+		return tags
+	}
+	// Without a source, "xc" lets the player derive the timeshift URL from
+	// the stream URL the Xtream way
+	mode := "xc"
+	if opts.catchupSource {
+		mode = "default"
+	}
+	tags = append(tags, m3u.Tag{Name: "catchup", Value: mode})
+	if days := toInt(stream["tv_archive_duration"]); days > 0 {
+		tags = append(tags, m3u.Tag{Name: "catchup-days", Value: strconv.Itoa(days)})
+	}
+	if opts.catchupSource {
+		tags = append(tags, m3u.Tag{Name: "catchup-source", Value: c.catchupSourceURL(streamID)})
+	}
+	return tags
+}
+
+// catchupSourceURL is the catchup-source template of a channel. It uses the
+// proxy's timeshift route with local credentials, like buildTimeshiftURL;
+// {duration:60} is the programme length in minutes.
+func (c *Config) catchupSourceURL(streamID string) string {
+	return c.publicBaseURL() + "/timeshift/" + c.User.PathEscape() + "/" + c.Password.PathEscape() +
+		"/{duration:60}/" + catchupStartPlaceholder + "/" + normalizeStreamID(streamID) + ".ts"
+}
+
+// m3uAttr formats a tag as name="value" for an #EXTINF line. M3U has no
+// escape sequence, so double quotes become single ones and line breaks
+// spaces; anything else, backslashes and non-ASCII included, is kept as is.
+func m3uAttr(tag m3u.Tag) string {
+	value := strings.NewReplacer(`"`, `'`, "\r\n", " ", "\n", " ", "\r", " ").Replace(tag.Value)
+	return tag.Name + `="` + value + `"`
+}
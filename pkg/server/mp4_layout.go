@@ -0,0 +1,151 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// mp4Layout tells whether an MP4's moov atom (the index players need before
+// they can start) comes before or after the media data.
+type mp4Layout int
+
+const (
+	mp4LayoutUnknown   mp4Layout = iota // not enough bytes yet to tell
+	mp4LayoutFaststart                  // moov before mdat: playable while downloading
+	mp4LayoutMoovAtEnd                  // mdat first: unplayable until complete
+	mp4LayoutNotMP4                     // not an ISO-BMFF file
+)
+
+// detectMP4Layout walks the top-level boxes of the first size bytes of r.
+func detectMP4Layout(r io.ReaderAt, size int64) mp4Layout {
+	var off int64
+	hdr := make([]byte, 16)
+	for first := true; ; first = false {
+		if off+8 > size {
+			return mp4LayoutUnknown
+		}
+		if _, err := r.ReadAt(hdr[:8], off); err != nil {
+			return mp4LayoutUnknown
+		}
+		boxSize := int64(binary.BigEndian.Uint32(hdr[:4]))
+		boxType := string(hdr[4:8])
+		if first && boxType != "ftyp" && boxType != "moov" && boxType != "free" && boxType != "skip" && boxType != "wide" {
+			return mp4LayoutNotMP4
+		}
+		switch boxType {
+		case "moov":
+			return mp4LayoutFaststart
+		case "mdat":
+			return mp4LayoutMoovAtEnd
+		}
+		switch boxSize {
+		case 0: // box runs to end of file without moov or mdat
+			return mp4LayoutNotMP4
+		case 1: // 64-bit largesize follows the type
+			if off+16 > size {
+				return mp4LayoutUnknown
+			}
+			if _, err := r.ReadAt(hdr[8:16], off+8); err != nil {
+				return mp4LayoutUnknown
+			}
+			boxSize = int64(binary.BigEndian.Uint64(hdr[8:16]))
+		}
+		if boxSize < 8 {
+			return mp4LayoutNotMP4
+		}
+		off += boxSize
+	}
+}
+
+// progressiveMinBytes reads PROGRESSIVE_MIN_BYTES: bytes a growing file must
+// hold before it is served at all (default 0).
+func progressiveMinBytes() int64 {
+	if v := strings.TrimSpace(os.Getenv("PROGRESSIVE_MIN_BYTES")); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n >= 0 {
+			return n
+		}
+		utils.WarnLog("Invalid PROGRESSIVE_MIN_BYTES: %s", v)
+	}
+	return 0
+}
+
+// mp4ProgressiveMode reads MP4_PROGRESSIVE: "auto" (default) serves faststart
+// files while downloading and holds moov-at-end files until complete,
+// "always" serves immediately and "wait" always waits for the full file.
+func mp4ProgressiveMode() string {
+	switch m := strings.ToLower(strings.TrimSpace(os.Getenv("MP4_PROGRESSIVE"))); m {
+	case "always", "wait":
+		return m
+	}
+	return "auto"
+}
+
+// waitUntilServable blocks until the growing partPath may be served: it holds
+// PROGRESSIVE_MIN_BYTES and, for MP4, applies MP4_PROGRESSIVE. It returns false
+// when the client went away. The download finishing always unblocks it.
+func waitUntilServable(ctx *gin.Context, partPath, contentType string) bool {
+	ext := strings.ToLower(path.Ext(strings.TrimSuffix(partPath, ".part")))
+	isMP4 := contentType == "video/mp4" || ext == ".mp4" || ext == ".m4v" || ext == ".mov"
+	mode := mp4ProgressiveMode()
+	minBytes := progressiveMinBytes()
+	if (!isMP4 || mode == "always") && minBytes == 0 {
+		return true
+	}
+
+	logged := false
+	for {
+		st, err := os.Stat(partPath)
+		if err != nil {
+			return true // finished (or gone): serve whatever is there
+		}
+		ready := st.Size() >= minBytes
+		if ready && isMP4 && mode != "always" {
+			ready = false
+			if mode == "auto" {
+				if f, err := os.Open(partPath); err == nil {
+					layout := detectMP4Layout(f, st.Size())
+					f.Close()
+					ready = layout == mp4LayoutFaststart || layout == mp4LayoutNotMP4
+				}
+			}
+		}
+		if ready {
+			return true
+		}
+		if !logged {
+			reqLog(ctx).InfoLog("Progressive serve of %s held until the file is playable (mode=%s, min_bytes=%d)", path.Base(partPath), mode, minBytes)
+			logged = true
+		}
+		select {
+		case <-ctx.Request.Context().Done():
+			return false
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
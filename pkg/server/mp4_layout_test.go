@@ -0,0 +1,125 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// box returns an MP4 box with the given type and payload size.
+func box(typ string, payload int) []byte {
+	b := make([]byte, 8+payload)
+	binary.BigEndian.PutUint32(b, uint32(len(b)))
+	copy(b[4:], typ)
+	return b
+}
+
+// largeBox returns a box using the 64-bit largesize header.
+func largeBox(typ string, payload int) []byte {
+	b := make([]byte, 16+payload)
+	binary.BigEndian.PutUint32(b, 1)
+	copy(b[4:], typ)
+	binary.BigEndian.PutUint64(b[8:], uint64(len(b)))
+	return b
+}
+
+func concat(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+
+var (
+	faststartMP4 = concat(box("ftyp", 16), box("moov", 64), box("mdat", 256))
+	moovAtEndMP4 = concat(box("ftyp", 16), box("mdat", 256), box("moov", 64))
+)
+
+func TestDetectMP4Layout(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		size int64 // bytes available; -1 for the whole data
+		want mp4Layout
+	}{
+		{"faststart", faststartMP4, -1, mp4LayoutFaststart},
+		{"moov at end", moovAtEndMP4, -1, mp4LayoutMoovAtEnd},
+		{"free box before moov", concat(box("ftyp", 16), box("free", 32), box("moov", 64)), -1, mp4LayoutFaststart},
+		{"largesize box before mdat", concat(box("ftyp", 16), largeBox("free", 32), box("mdat", 64)), -1, mp4LayoutMoovAtEnd},
+		{"only ftyp downloaded", faststartMP4, 24, mp4LayoutUnknown},
+		{"partial box header", faststartMP4, 28, mp4LayoutUnknown},
+		{"mpeg-ts", append([]byte{0x47, 0x40, 0x00, 0x10}, make([]byte, 184)...), -1, mp4LayoutNotMP4},
+		{"zero-size box", concat(box("ftyp", 16), make([]byte, 8)), -1, mp4LayoutNotMP4},
+		{"empty", nil, -1, mp4LayoutUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			size := tt.size
+			if size < 0 {
+				size = int64(len(tt.data))
+			}
+			if got := detectMP4Layout(bytes.NewReader(tt.data), size); got != tt.want {
+				t.Errorf("detectMP4Layout = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWaitUntilServable(t *testing.T) {
+	t.Setenv("PROGRESSIVE_MIN_BYTES", "")
+	tests := []struct {
+		name, mode, file string
+		data             []byte
+		want             bool
+	}{
+		{"faststart served", "auto", "movie.mp4", faststartMP4, true},
+		{"moov at end held", "auto", "movie.mp4", moovAtEndMP4, false},
+		{"moov at end served when always", "always", "movie.mp4", moovAtEndMP4, true},
+		{"faststart held when wait", "wait", "movie.mp4", faststartMP4, false},
+		{"not an mp4", "wait", "movie.mkv", moovAtEndMP4, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MP4_PROGRESSIVE", tt.mode)
+			part := filepath.Join(t.TempDir(), tt.file+".part")
+			if err := os.WriteFile(part, tt.data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			// A held file never becomes servable here, so the deadline ends the wait
+			rctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+			ctx.Request = httptest.NewRequest("GET", "/movie", nil).WithContext(rctx)
+			if got := waitUntilServable(ctx, part, ""); got != tt.want {
+				t.Errorf("waitUntilServable = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWaitUntilServableFinished(t *testing.T) {
+	t.Setenv("MP4_PROGRESSIVE", "auto")
+	t.Setenv("PROGRESSIVE_MIN_BYTES", "1000000")
+	part := filepath.Join(t.TempDir(), "movie.mp4.part")
+	if err := os.WriteFile(part, moovAtEndMP4, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		os.Remove(part) // the download finished and was renamed
+	}()
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest("GET", "/movie", nil)
+	done := make(chan bool)
+	go func() { done <- waitUntilServable(ctx, part, "video/mp4") }()
+	select {
+	case ok := <-done:
+		if !ok {
+			t.Error("waitUntilServable = false after the download finished")
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("waitUntilServable still waiting after the download finished")
+	}
+}
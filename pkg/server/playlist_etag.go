@@ -0,0 +1,115 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// etagEntry is the ETag of a file at a given size and modification time.
+type etagEntry struct {
+	size int64
+	mod  time.Time
+	etag string
+}
+
+var (
+	fileETagLock sync.Mutex
+	fileETags    = make(map[string]etagEntry)
+)
+
+// fileETag returns a strong ETag for the content of path. The hash is only
+// recomputed when the size or modification time of the file changed, so
+// frequent polls of a large playlist cost a stat.
+func fileETag(path string) (string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	fileETagLock.Lock()
+	e, ok := fileETags[path]
+	fileETagLock.Unlock()
+	if ok && e.size == fi.Size() && e.mod.Equal(fi.ModTime()) {
+		return e.etag, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	etag := fmt.Sprintf(`"%s"`, hex.EncodeToString(h.Sum(nil)[:16]))
+
+	fileETagLock.Lock()
+	fileETags[path] = etagEntry{size: fi.Size(), mod: fi.ModTime(), etag: etag}
+	fileETagLock.Unlock()
+	return etag, nil
+}
+
+// servePlaylistFile sends a generated playlist with validators: players that
+// send a matching If-None-Match or If-Modified-Since get a 304 instead of the
+// whole file.
+func servePlaylistFile(ctx *gin.Context, path string) {
+	if etag, err := fileETag(path); err == nil {
+		ctx.Header("ETag", etag)
+	} else {
+		reqLog(ctx).DebugLog("Playlist ETag for %s unavailable: %v", path, err)
+	}
+	// Cached copies must be revalidated, the playlist changes on refresh
+	ctx.Header("Cache-Control", "no-cache")
+	// http.ServeContent answers the conditional request from these headers
+	ctx.File(path)
+}
+
+// forcedPlaylistRefresh reports whether a playlist request asks to skip the
+// M3U cache with ?refresh=1. Regenerating a playlist is expensive, so only
+// callers holding the internal API key (X-API-Key or ?key=) may; other
+// requests are served from the cache as usual.
+func forcedPlaylistRefresh(ctx *gin.Context) bool {
+	switch strings.ToLower(strings.TrimSpace(ctx.Query("refresh"))) {
+	case "1", "true", "yes":
+	default:
+		return false
+	}
+	key := ctx.GetHeader("X-API-Key")
+	if key == "" {
+		key = ctx.Query("key")
+	}
+	user := ctx.Request.FormValue("username")
+	if !validAPIKey(key) {
+		reqLog(ctx).WarnLog("Playlist refresh requested by %s from %s without a valid API key, serving the cache", utils.MaskString(user), ctx.ClientIP())
+		return false
+	}
+	utils.AuditLog(user, "playlist.refresh", "ip=%s path=%s", ctx.ClientIP(), ctx.Request.URL.Path)
+	return true
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucasduport/stream-share/pkg/config"
+)
+
+func TestForcedPlaylistRefresh(t *testing.T) {
+	tests := []struct {
+		name, query, header string
+		want                bool
+	}{
+		{"no refresh asked", "key=" + GetAPIKey(), "", false},
+		{"key in the header", "refresh=1", GetAPIKey(), true},
+		{"key in the query", "refresh=true&key=" + GetAPIKey(), "", true},
+		{"wrong key", "refresh=1&key=wrong", "", false},
+		{"no key", "refresh=yes", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+			ctx.Request = httptest.NewRequest("GET", "/get.php?username=alice&password=secret&"+tt.query, nil)
+			if tt.header != "" {
+				ctx.Request.Header.Set("X-API-Key", tt.header)
+			}
+			if got := forcedPlaylistRefresh(ctx); got != tt.want {
+				t.Errorf("forcedPlaylistRefresh = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestForcedPlaylistRefreshKeyNotLogged checks that the API key given with
+// ?refresh=1&key= is masked in the access log line.
+func TestForcedPlaylistRefreshKeyNotLogged(t *testing.T) {
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest("GET", "/get.php?username=alice&password=secret&refresh=1&key="+GetAPIKey(), nil)
+	if got := (&Config{ProxyConfig: &config.ProxyConfig{}}).maskedRequestPath(ctx); strings.Contains(got, GetAPIKey()) {
+		t.Errorf("maskedRequestPath = %q, contains the API key", got)
+	}
+}
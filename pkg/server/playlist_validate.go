@@ -0,0 +1,267 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jamesnetherton/m3u"
+	"github.com/lucasduport/stream-share/pkg/types"
+	"github.com/lucasduport/stream-share/pkg/utils"
+	xtreamapi "github.com/lucasduport/stream-share/pkg/xtream"
+)
+
+// maxReportIssues caps each list of problem tracks in a validation report;
+// the counts always cover every track.
+const maxReportIssues = 25
+
+// playlistReport is the outcome of a dry-run playlist validation.
+type playlistReport struct {
+	Source          string         `json:"source"`
+	Tracks          int            `json:"tracks"`
+	ByType          map[string]int `json:"by_type"`
+	Groups          int            `json:"groups"`
+	Blocked         int            `json:"blocked"`
+	EmptyCategories []string       `json:"empty_categories"`
+	Malformed       int            `json:"malformed"`
+	MalformedTracks []trackIssue   `json:"malformed_tracks"`
+	VODResolvable   int            `json:"vod_resolvable"`
+	VODUnresolvable int            `json:"vod_unresolvable"`
+	VODIssues       []trackIssue   `json:"vod_issues"`
+	Warnings        []string       `json:"warnings,omitempty"`
+}
+
+// trackIssue is one track a validation flagged; the URI has the provider
+// credentials masked.
+type trackIssue struct {
+	Index int    `json:"index"`
+	Name  string `json:"name"`
+	URI   string `json:"uri"`
+	Error string `json:"error"`
+}
+
+// validatePlaylist fetches the provider playlist and reports what serving it
+// would do, without touching the live playlist or the playlist cache. With
+// {"url": "..."} a candidate M3U is checked instead of the configured one.
+func (c *Config) validatePlaylist(ctx *gin.Context) {
+	var req struct {
+		URL   string `json:"url"`
+		Actor string `json:"actor"`
+	}
+	// Body is optional
+	_ = ctx.ShouldBindJSON(&req)
+
+	source := req.URL
+	if source != "" {
+		u, err := url.Parse(source)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			abortJSON(ctx, http.StatusBadRequest, errCodeInvalidParameter, "url must be an http(s) URL")
+			return
+		}
+	} else {
+		source = c.playlistSourceURL()
+		if source == "" {
+			abortJSON(ctx, http.StatusBadRequest, errCodeBadRequest, "No playlist source is configured")
+			return
+		}
+	}
+
+	playlist, err := m3u.Parse(source)
+	if err != nil {
+		abortError(ctx, http.StatusBadGateway, errCodeUpstreamError, "Could not fetch or parse the playlist", err)
+		return
+	}
+
+	report := c.checkPlaylist(&playlist)
+	report.Source = c.maskPlaylistURL(source)
+	// Provider categories only describe the configured account
+	if req.URL == "" && c.XtreamBaseURL != "" {
+		report.EmptyCategories, report.Warnings = c.emptyProviderCategories(&playlist)
+	}
+	utils.AuditLog(req.Actor, "playlist.validate", "ip=%s tracks=%d malformed=%d", ctx.ClientIP(), report.Tracks, report.Malformed)
+
+	ctx.JSON(http.StatusOK, types.APIResponse{Success: true, Data: report})
+}
+
+// playlistSourceURL is the playlist the proxy serves: the configured M3U, or
+// the Xtream provider's get.php.
+func (c *Config) playlistSourceURL() string {
+	if c.RemoteURL != nil && c.RemoteURL.String() != "" {
+		return c.RemoteURL.String()
+	}
+	if c.XtreamBaseURL != "" {
+		return fmt.Sprintf("%s/get.php?username=%s&password=%s&type=m3u_plus&output=ts", c.XtreamBaseURL, c.XtreamUser, c.XtreamPassword)
+	}
+	return ""
+}
+
+// checkPlaylist runs each track through replaceURL the way marshallInto does,
+// collecting the tracks it would drop instead of logging them.
+func (c *Config) checkPlaylist(playlist *m3u.Playlist) *playlistReport {
+	report := &playlistReport{
+		ByType:          map[string]int{},
+		EmptyCategories: []string{},
+		MalformedTracks: []trackIssue{},
+		VODIssues:       []trackIssue{},
+	}
+	groups := map[string]bool{}
+	blocked := blockedStreams()
+	flag := func(list *[]trackIssue, i int, track m3u.Track, problem string) {
+		if len(*list) < maxReportIssues {
+			*list = append(*list, trackIssue{Index: i, Name: track.Name, URI: c.maskProviderCredentials(track.URI), Error: c.maskProviderCredentials(problem)})
+		}
+	}
+
+	for i, track := range playlist.Tracks {
+		report.Tracks++
+		kind := trackKind(track.URI)
+		report.ByType[kind]++
+		groups[trackGroup(track)] = true
+		if blocked.trackBlocked(track) {
+			report.Blocked++
+		}
+
+		if strings.TrimSpace(track.URI) == "" {
+			report.Malformed++
+			flag(&report.MalformedTracks, i, track, "empty URI")
+			continue
+		}
+		if _, err := c.replaceURL(track.URI, i, false); err != nil {
+			report.Malformed++
+			flag(&report.MalformedTracks, i, track, err.Error())
+			continue
+		}
+
+		if kind != "movie" && kind != "series" {
+			continue
+		}
+		u, _ := url.Parse(track.URI)
+		switch ext := strings.ToLower(path.Ext(u.Path)); ext {
+		case ".mp4", ".mkv", ".ts":
+			report.VODResolvable++
+		case "":
+			report.VODUnresolvable++
+			flag(&report.VODIssues, i, track, "no file extension")
+		default:
+			report.VODUnresolvable++
+			flag(&report.VODIssues, i, track, "unsupported extension "+ext)
+		}
+	}
+	report.Groups = len(groups)
+	return report
+}
+
+// trackKind classifies a track by its URI the way multiplexedStream does.
+func trackKind(uri string) string {
+	switch {
+	case strings.Contains(uri, "/movie/"):
+		return "movie"
+	case strings.Contains(uri, "/series/"):
+		return "series"
+	default:
+		return "live"
+	}
+}
+
+// trackGroup returns a track's group-title, "" when it has none.
+func trackGroup(track m3u.Track) string {
+	for _, tag := range track.Tags {
+		if tag.Name == "group-title" {
+			return tag.Value
+		}
+	}
+	return ""
+}
+
+// emptyProviderCategories lists the provider's live, VOD and series
+// categories that have no track in playlist. Categories that could not be
+// fetched are reported as warnings.
+func (c *Config) emptyProviderCategories(playlist *m3u.Playlist) ([]string, []string) {
+	client, err := xtreamapi.New(c.XtreamUser.String(), c.XtreamPassword.String(), c.XtreamBaseURL, utils.UserAgentFor(c.XtreamBaseURL))
+	if err != nil {
+		return []string{}, []string{err.Error()}
+	}
+
+	present := map[string]bool{}
+	for _, track := range playlist.Tracks {
+		present[trackKind(track.URI)+"/"+trackGroup(track)] = true
+	}
+
+	empty, warnings := []string{}, []string(nil)
+	for _, kind := range []struct{ name, action string }{
+		{"live", "get_live_categories"},
+		{"movie", "get_vod_categories"},
+		{"series", "get_series_categories"},
+	} {
+		resp, _, _, err := client.Action(c.ProxyConfig, kind.action, url.Values{})
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("%s: %v", kind.action, err))
+			continue
+		}
+		categories, _ := resp.([]interface{})
+		for _, item := range categories {
+			category, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name := fmt.Sprintf("%v", category["category_name"])
+			if !present[kind.name+"/"+name] {
+				empty = append(empty, kind.name+": "+name)
+			}
+		}
+	}
+	sort.Strings(empty)
+	return empty, warnings
+}
+
+// maskPlaylistURL hides the credentials of a playlist URL, whether they are
+// the provider's or given in its query.
+func (c *Config) maskPlaylistURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return c.maskProviderCredentials(raw)
+	}
+	q := u.Query()
+	if v := q.Get("username"); v != "" {
+		q.Set("username", utils.MaskString(v))
+	}
+	if q.Get("password") != "" {
+		q.Set("password", "******")
+	}
+	u.RawQuery = q.Encode()
+	u.User = nil
+	return c.maskProviderCredentials(u.String())
+}
+
+// maskProviderCredentials hides the provider username and password in s.
+func (c *Config) maskProviderCredentials(s string) string {
+	if u := c.XtreamUser.String(); u != "" {
+		s = strings.ReplaceAll(s, u, utils.MaskString(u))
+	}
+	if p := c.XtreamPassword.String(); p != "" {
+		s = strings.ReplaceAll(s, p, "******")
+	}
+	return s
+}
@@ -0,0 +1,217 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lucasduport/stream-share/pkg/database"
+	"github.com/lucasduport/stream-share/pkg/types"
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// progressWriter coalesces download progress: each download only records its
+// latest counters, and one statement per interval persists those that moved
+// enough since they were last written (see progressDue).
+type progressWriter struct {
+	db       *database.DBManager
+	save     func([]types.VODCacheEntry) error // db.UpdateVODCacheProgress
+	interval time.Duration
+	minDelta int64         // bytes downloaded that always warrant a write
+	maxAge   time.Duration // longest a changed download goes unwritten
+
+	mu      sync.Mutex
+	pending map[string]types.VODCacheEntry // stream id -> latest unwritten progress
+	written map[string]progressMark        // stream id -> last persisted progress
+
+	stop      chan struct{} // closed by close to end run
+	done      chan struct{} // closed once run made its final flush
+	closeOnce sync.Once
+}
+
+// progressMark is the progress of a download as last written to the database.
+type progressMark struct {
+	downloaded int64
+	at         time.Time
+}
+
+// defaultProgressDeltaMB is the VOD_PROGRESS_DELTA_MB default.
+const defaultProgressDeltaMB = 50
+
+var (
+	progressOnce sync.Once
+	progress     *progressWriter
+)
+
+// progressInterval reads VOD_PROGRESS_INTERVAL ("2s" or seconds, default 1s).
+func progressInterval() time.Duration {
+	if v := strings.TrimSpace(os.Getenv("VOD_PROGRESS_INTERVAL")); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		} else if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return time.Duration(n) * time.Second
+		}
+		utils.WarnLog("Invalid VOD_PROGRESS_INTERVAL: %s", v)
+	}
+	return time.Second
+}
+
+// progressDeltaBytes reads VOD_PROGRESS_DELTA_MB, how much a download must
+// advance before its progress is written again (default 50).
+func progressDeltaBytes() int64 {
+	if v := strings.TrimSpace(os.Getenv("VOD_PROGRESS_DELTA_MB")); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return int64(n) << 20
+		}
+		utils.WarnLog("Invalid VOD_PROGRESS_DELTA_MB: %s", v)
+	}
+	return defaultProgressDeltaMB << 20
+}
+
+// progressWriter returns the shared writer, starting its flush loop on first use.
+func (c *Config) progressWriter() *progressWriter {
+	progressOnce.Do(func() {
+		interval := progressInterval()
+		progress = &progressWriter{
+			db:       c.db,
+			interval: interval,
+			minDelta: progressDeltaBytes(),
+			// Slow downloads still refresh their rate and ETA now and then
+			maxAge:  10 * interval,
+			pending: make(map[string]types.VODCacheEntry),
+			written: make(map[string]progressMark),
+		}
+		if c.db != nil {
+			progress.save = c.db.UpdateVODCacheProgress
+			progress.start()
+		}
+	})
+	return progress
+}
+
+// closeProgressWriter writes the pending progress of the shared writer, if
+// one was started, and stops it.
+func closeProgressWriter() {
+	// Once more, so a writer created concurrently is complete, and none after
+	progressOnce.Do(func() {})
+	if progress != nil {
+		progress.close()
+	}
+}
+
+// record replaces the pending progress of a download.
+func (p *progressWriter) record(streamID string, downloaded, total, rate int64) {
+	if p.save == nil {
+		return
+	}
+	provider := ""
+	if p.db != nil {
+		provider = p.db.Provider()
+	}
+	p.mu.Lock()
+	p.pending[streamID] = types.VODCacheEntry{Provider: provider, StreamID: streamID, DownloadedBytes: downloaded, TotalBytes: total, RateBytesPerSec: rate, LastAccess: time.Now()}
+	p.mu.Unlock()
+}
+
+// forget drops pending progress ahead of a final ready/failed write, which is
+// always written at once by the caller.
+func (p *progressWriter) forget(streamID string) {
+	p.mu.Lock()
+	delete(p.pending, streamID)
+	delete(p.written, streamID)
+	p.mu.Unlock()
+}
+
+// progressDue reports whether e moved enough since last to be written: by
+// minDelta bytes or 1% of the file, or at all once maxAge has passed. A
+// download's first progress is always due.
+func (p *progressWriter) progressDue(e types.VODCacheEntry, last progressMark, ok bool, now time.Time) bool {
+	if !ok {
+		return true
+	}
+	delta := e.DownloadedBytes - last.downloaded
+	switch {
+	case delta >= p.minDelta:
+		return true
+	case e.TotalBytes > 0 && delta*100 >= e.TotalBytes:
+		return true
+	default:
+		return now.Sub(last.at) >= p.maxAge
+	}
+}
+
+// start runs the flush loop until close.
+func (p *progressWriter) start() {
+	p.stop = make(chan struct{})
+	p.done = make(chan struct{})
+	go p.run()
+}
+
+func (p *progressWriter) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.flush(false)
+		case <-p.stop:
+			p.flush(true)
+			return
+		}
+	}
+}
+
+// close stops the flush loop once it wrote every pending entry, due or not.
+func (p *progressWriter) close() {
+	if p.stop == nil {
+		return
+	}
+	p.closeOnce.Do(func() { close(p.stop) })
+	<-p.done
+}
+
+// flush persists the pending entries that are due, or all of them when all
+// is set, in a single statement. The others stay pending for a later flush.
+func (p *progressWriter) flush(all bool) {
+	now := time.Now()
+	p.mu.Lock()
+	var batch []types.VODCacheEntry
+	for id, e := range p.pending {
+		last, ok := p.written[id]
+		if !all && !p.progressDue(e, last, ok, now) {
+			continue
+		}
+		batch = append(batch, e)
+		p.written[id] = progressMark{downloaded: e.DownloadedBytes, at: now}
+		delete(p.pending, id)
+	}
+	p.mu.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+
+	if err := p.save(batch); err != nil {
+		utils.WarnLog("Cache: failed to persist progress of %d downloads: %v", len(batch), err)
+	}
+}
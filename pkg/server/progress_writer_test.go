@@ -0,0 +1,138 @@
+package server
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lucasduport/stream-share/pkg/types"
+)
+
+// savedBatches records the batches a progressWriter writes.
+type savedBatches struct {
+	mu      sync.Mutex
+	batches [][]types.VODCacheEntry
+}
+
+func (s *savedBatches) save(batch []types.VODCacheEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches = append(s.batches, batch)
+	return nil
+}
+
+func (s *savedBatches) get() [][]types.VODCacheEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]types.VODCacheEntry(nil), s.batches...)
+}
+
+func testProgressWriter(saved *savedBatches, interval time.Duration) *progressWriter {
+	return &progressWriter{
+		save:     saved.save,
+		interval: interval,
+		minDelta: 1000,
+		maxAge:   time.Hour,
+		pending:  make(map[string]types.VODCacheEntry),
+		written:  make(map[string]progressMark),
+	}
+}
+
+func TestProgressWriterFlush(t *testing.T) {
+	saved := &savedBatches{}
+	p := testProgressWriter(saved, time.Hour)
+
+	// Many updates between two flushes are one write of the latest counters
+	for n := int64(1); n <= 10; n++ {
+		p.record("a", n*10, 0, 5)
+	}
+	p.record("b", 10, 100000, 5)
+	p.flush(false)
+	batches := saved.get()
+	if len(batches) != 1 || len(batches[0]) != 2 {
+		t.Fatalf("first flush wrote %v, want one batch of both downloads", batches)
+	}
+	for _, e := range batches[0] {
+		if e.StreamID == "a" && e.DownloadedBytes != 100 {
+			t.Errorf("a written at %d bytes, want the latest 100", e.DownloadedBytes)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		id        string
+		bytes     int64
+		total     int64
+		wantWrite bool
+	}{
+		{"below the delta", "a", 500, 0, false},
+		{"delta reached", "a", 1100, 0, true},
+		{"1% of a known size", "b", 1010, 100000, true},
+		{"no change", "b", 1010, 100000, false},
+	}
+	for _, tt := range tests {
+		before := len(saved.get())
+		p.record(tt.id, tt.bytes, tt.total, 5)
+		p.flush(false)
+		if wrote := len(saved.get()) > before; wrote != tt.wantWrite {
+			t.Errorf("%s: wrote = %v, want %v", tt.name, wrote, tt.wantWrite)
+		}
+	}
+
+	// forget drops what a final ready/failed write replaces
+	p.record("a", 5000, 0, 5)
+	p.forget("a")
+	p.flush(true)
+	batches = saved.get()
+	for _, e := range batches[len(batches)-1] {
+		if e.StreamID == "a" {
+			t.Error("forgotten progress was written")
+		}
+	}
+}
+
+func TestProgressWriterInterval(t *testing.T) {
+	saved := &savedBatches{}
+	p := testProgressWriter(saved, 50*time.Millisecond)
+	p.start()
+	defer p.close()
+
+	// A download moving by the delta on every update is written once per
+	// interval, however often it reports
+	deadline := time.Now().Add(500 * time.Millisecond)
+	var n int64
+	for time.Now().Before(deadline) {
+		n += 1000
+		p.record("a", n, 0, 5)
+		time.Sleep(time.Millisecond)
+	}
+	if writes := len(saved.get()); writes < 5 || writes > 11 {
+		t.Errorf("%d writes in 500ms at a 50ms interval, want about 10", writes)
+	}
+}
+
+func TestProgressWriterCloseFlushes(t *testing.T) {
+	saved := &savedBatches{}
+	p := testProgressWriter(saved, time.Hour)
+	p.start()
+
+	p.record("a", 10, 0, 5)
+	p.flush(false)
+	// Below the delta: only written by the final flush
+	p.record("a", 20, 0, 5)
+	p.record("b", 30, 0, 5)
+	p.close()
+
+	batches := saved.get()
+	if len(batches) != 2 {
+		t.Fatalf("%d writes, want the first flush and the final one", len(batches))
+	}
+	got := map[string]int64{}
+	for _, e := range batches[1] {
+		got[e.StreamID] = e.DownloadedBytes
+	}
+	if len(got) != 2 || got["a"] != 20 || got["b"] != 30 {
+		t.Errorf("final flush wrote %v, want a=20 b=30", got)
+	}
+	p.close() // closing twice is harmless
+}
@@ -32,18 +32,26 @@ import (
     "github.com/lucasduport/stream-share/pkg/utils"
 )
 
-// getM3U sends the proxified M3U file generated during bootstrap.
+// getM3U sends the proxified M3U file generated during bootstrap, trimmed by
+// include_groups/exclude_groups when they are set.
 func (c *Config) getM3U(ctx *gin.Context) {
+    groups, ok := requestGroupFilter(ctx)
+    if !ok {
+        return
+    }
     ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename=%q`, c.M3UFileName))
     ctx.Header("Content-Type", "application/octet-stream")
-    ctx.File(c.proxyfiedM3UPath)
+    serveFilteredPlaylist(ctx, c.proxyfiedM3UPath, groups)
 }
 
 // reverseProxy forwards a track request to the upstream using Xtream creds.
 func (c *Config) reverseProxy(ctx *gin.Context) {
+    if refuseBlockedStream(ctx, path.Base(c.track.URI)) {
+        return
+    }
     rpURL, err := url.Parse(c.track.URI)
     if err != nil {
-        ctx.AbortWithError(http.StatusInternalServerError, err) // nolint: errcheck
+        abortError(ctx, http.StatusInternalServerError, errCodeInternal, "Could not build upstream URL", err)
         return
     }
 
@@ -53,18 +61,21 @@ func (c *Config) reverseProxy(ctx *gin.Context) {
     q.Set("password", c.XtreamPassword.String())
     rpURL.RawQuery = q.Encode()
 
-    utils.DebugLog("-> Upstream username: %s, password: %s", c.XtreamUser.String(), c.XtreamPassword.String())
-    utils.DebugLog("-> Final upstream URL: %s", rpURL.String())
+    reqLog(ctx).DebugLog("-> Upstream username: %s, password: %s", c.XtreamUser.String(), c.XtreamPassword.String())
+    reqLog(ctx).DebugLog("-> Final upstream URL: %s", rpURL.String())
 
     c.stream(ctx, rpURL)
 }
 
 // m3u8ReverseProxy forwards HLS index/chunk requests to upstream using Xtream creds.
 func (c *Config) m3u8ReverseProxy(ctx *gin.Context) {
+    if refuseBlockedStream(ctx, path.Base(c.track.URI)) {
+        return
+    }
     id := ctx.Param("id")
     rpURL, err := url.Parse(strings.ReplaceAll(c.track.URI, path.Base(c.track.URI), id))
     if err != nil {
-        ctx.AbortWithError(http.StatusInternalServerError, err) // nolint: errcheck
+        abortError(ctx, http.StatusInternalServerError, errCodeInternal, "Could not build upstream URL", err)
         return
     }
 
@@ -73,8 +84,8 @@ func (c *Config) m3u8ReverseProxy(ctx *gin.Context) {
     q.Set("password", c.XtreamPassword.String())
     rpURL.RawQuery = q.Encode()
 
-    utils.DebugLog("-> Upstream username: %s, password: %s", c.XtreamUser.String(), c.XtreamPassword.String())
-    utils.DebugLog("-> Final upstream URL: %s", rpURL.String())
+    reqLog(ctx).DebugLog("-> Upstream username: %s, password: %s", c.XtreamUser.String(), c.XtreamPassword.String())
+    reqLog(ctx).DebugLog("-> Final upstream URL: %s", rpURL.String())
 
     c.stream(ctx, rpURL)
 }
@@ -82,8 +93,8 @@ func (c *Config) m3u8ReverseProxy(ctx *gin.Context) {
 // stream proxies the content from upstream to the client, preserving status
 // and most headers, while normalizing VOD header sets for stricter providers.
 func (c *Config) stream(ctx *gin.Context, oriURL *url.URL) {
-    utils.DebugLog("-> Streaming request URL: %s", ctx.Request.URL)
-    utils.DebugLog("-> Proxying to upstream URL: %s", oriURL.String())
+    reqLog(ctx).DebugLog("-> Streaming request URL: %s", ctx.Request.URL)
+    reqLog(ctx).DebugLog("-> Proxying to upstream URL: %s", oriURL.String())
 
     // Configure HTTP transport suitable for long-lived streaming
     transport := &http.Transport{
@@ -105,8 +116,8 @@ func (c *Config) stream(ctx *gin.Context, oriURL *url.URL) {
     // Prepare the upstream request (bound to client context so it cancels if client disconnects)
     req, err := http.NewRequestWithContext(ctx.Request.Context(), "GET", oriURL.String(), nil)
     if err != nil {
-        utils.ErrorLog("Failed to create request: %v", err)
-        ctx.AbortWithError(http.StatusInternalServerError, utils.PrintErrorAndReturn(err))
+        reqLog(ctx).ErrorLog("Failed to create request: %v", err)
+        abortError(ctx, http.StatusInternalServerError, errCodeInternal, "Could not build upstream request", err)
         return
     }
 
@@ -115,11 +126,11 @@ func (c *Config) stream(ctx *gin.Context, oriURL *url.URL) {
     isVOD := isVODPath(p)
 
     if isVOD {
-        req.Header = prepareVODHeaders(ctx)
+        req.Header = prepareVODHeaders(ctx, req.URL.Host)
     } else {
         // Non-VOD: copy and normalize minimally
         mergeHttpHeader(req.Header, ctx.Request.Header)
-        req.Header.Set("User-Agent", utils.GetIPTVUserAgent())
+        req.Header.Set("User-Agent", utils.UserAgentFor(req.URL.Host))
         req.Header.Del("Accept-Encoding")
         req.Header.Set("Accept-Encoding", "identity")
         if req.Header.Get("Accept") == "" { req.Header.Set("Accept", "*/*") }
@@ -129,20 +140,30 @@ func (c *Config) stream(ctx *gin.Context, oriURL *url.URL) {
     // Execute the upstream request
     resp, err := client.Do(req)
     if err != nil {
-        utils.DebugLog("-> Upstream request error: %v", err)
-        ctx.AbortWithError(http.StatusInternalServerError, utils.PrintErrorAndReturn(err))
+        reqLog(ctx).DebugLog("-> Upstream request error: %v", err)
+        abortError(ctx, http.StatusInternalServerError, errCodeUpstreamError, "Upstream request failed", err)
         return
     }
     defer resp.Body.Close()
 
-    utils.DebugLog("-> Upstream response status: %d", resp.StatusCode)
+    reqLog(ctx).DebugLog("-> Upstream response status: %d", resp.StatusCode)
     if resp.StatusCode == 461 {
-        utils.DebugLog("Upstream returned 461 (often blocks HEAD/Range or unexpected headers). UA=%q, AE=%q", req.Header.Get("User-Agent"), req.Header.Get("Accept-Encoding"))
+        reqLog(ctx).DebugLog("Upstream returned 461 (often blocks HEAD/Range or unexpected headers). UA=%q, AE=%q", req.Header.Get("User-Agent"), req.Header.Get("Accept-Encoding"))
     }
 
     // Copy response headers and status code
     mergeHttpHeader(ctx.Writer.Header(), resp.Header)
-    ctx.Status(resp.StatusCode)
+    status := resp.StatusCode
+    if isVOD && status == http.StatusPartialContent {
+        if ctx.Request.Header.Get("Range") == "" && strings.HasPrefix(resp.Header.Get("Content-Range"), "bytes 0-") {
+            // Only the default "bytes=0-" sent for strict providers: the client
+            // asked for the whole file, so answer it as such
+            status = http.StatusOK
+            ctx.Writer.Header().Del("Content-Range")
+        }
+        if ctx.Writer.Header().Get("Accept-Ranges") == "" { ctx.Writer.Header().Set("Accept-Ranges", "bytes") }
+    }
+    ctx.Status(status)
 
     // Stream the response body to the client with flushes
     w := ctx.Writer
@@ -152,7 +173,7 @@ func (c *Config) stream(ctx *gin.Context, oriURL *url.URL) {
         // Respect client cancellation
         select {
         case <-ctx.Request.Context().Done():
-            utils.DebugLog("Client cancelled stream for URL: %s", ctx.Request.URL)
+            reqLog(ctx).DebugLog("Client cancelled stream for URL: %s", ctx.Request.URL)
             return
         default:
         }
@@ -160,14 +181,14 @@ func (c *Config) stream(ctx *gin.Context, oriURL *url.URL) {
         n, rerr := resp.Body.Read(buf)
         if n > 0 {
             if _, werr := w.Write(buf[:n]); werr != nil {
-                utils.DebugLog("Client write error: %v", werr)
+                reqLog(ctx).DebugLog("Client write error: %v", werr)
                 return
             }
             if f, ok := w.(http.Flusher); ok { f.Flush() }
         }
         if rerr != nil {
             if rerr != io.EOF {
-                utils.DebugLog("Upstream read error: %v", rerr)
+                reqLog(ctx).DebugLog("Upstream read error: %v", rerr)
             }
             return
         }
@@ -0,0 +1,195 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// reloadableSettings are the settings a reload applies to the running
+// server. Changing any other one needs a restart.
+var reloadableSettings = map[string]bool{
+	"SESSION_TIMEOUT_MINUTES":        true,
+	"STREAM_TIMEOUT_MINUTES":         true,
+	"TEMP_LINK_HOURS":                true,
+	"TEMP_LINK_CACHE_SIZE":           true,
+	"CLIENT_STALL_TIMEOUT":           true,
+	"UPSTREAM_READ_TIMEOUT":          true,
+	"STREAM_PREROLL_CHUNKS":          true,
+	"MAX_VIEWERS_PER_STREAM":         true,
+	"STREAM_LINGER_SECONDS":          true,
+	"STREAM_QUALITY_METRICS":         true,
+	"STREAM_QUALITY_PERSIST":         true,
+	"MEMORY_PROFILE":                 true,
+	"STREAM_RING_CHUNKS":             true,
+	"STREAM_CHUNK_KB":                true,
+	"MAX_CONCURRENT_CACHE_DOWNLOADS": true,
+	"VOD_MAX_BYTES":                  true,
+	"VOD_MAX_DURATION":               true,
+	"VOD_DOWNLOAD_RETRIES":           true,
+	"VOD_DOWNLOAD_BACKOFF":           true,
+	"AUTH_FAILURE_WINDOW":            true,
+	"AUTH_MAX_FAILURES_PER_IP":       true,
+	"AUTH_MAX_FAILURES_PER_USER":     true,
+	"AUTH_LOCKOUT":                   true,
+	"AUTH_MAX_LOCKOUT":               true,
+	"DEBUG_LOGGING":                  true,
+}
+
+// watchReload reloads the settings on every SIGHUP.
+func (c *Config) watchReload() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	for range ch {
+		c.reload()
+	}
+}
+
+// reload re-reads RELOAD_ENV_FILE and applies the reloadable settings that
+// changed, keeping sessions and streams running. A process can't see changes
+// to its own environment, hence the file.
+func (c *Config) reload() {
+	file := strings.TrimSpace(os.Getenv("RELOAD_ENV_FILE"))
+	if file == "" {
+		utils.WarnLog("Reload: SIGHUP received but RELOAD_ENV_FILE is not set, nothing to re-read")
+		return
+	}
+	values, err := readEnvFile(file)
+	if err != nil {
+		utils.ErrorLog("Reload: could not read %s: %v", file, err)
+		return
+	}
+	utils.InfoLog("Reload: SIGHUP received, re-reading %s", file)
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	before := c.tunables()
+	applied := 0
+	for _, k := range keys {
+		if os.Getenv(k) == values[k] {
+			continue
+		}
+		if !reloadableSettings[k] {
+			// Values are not logged: the file may hold secrets
+			utils.WarnLog("Reload: %s changed but only takes effect after a restart, ignored", k)
+			continue
+		}
+		os.Setenv(k, values[k])
+		applied++
+	}
+	if applied == 0 {
+		utils.InfoLog("Reload: no reloadable setting changed")
+		return
+	}
+	c.applyTunables()
+
+	after := c.tunables()
+	names := make([]string, 0, len(after))
+	for name := range after {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if before[name] != after[name] {
+			utils.InfoLog("Reload: %s %s -> %s", name, before[name], after[name])
+		}
+	}
+	utils.InfoLog("Reload: %d setting(s) applied", applied)
+}
+
+// applyTunables applies the reloadable settings from the environment. VOD
+// download limits and retries are read by each download, so they need
+// nothing here.
+func (c *Config) applyTunables() {
+	c.applySessionSettings()
+	cacheDownloads().setLimit(cacheDownloadLimit())
+	reloadAuthThresholds()
+	utils.SetDebugLogging(os.Getenv("DEBUG_LOGGING") == "true")
+}
+
+// tunables reports the reloadable settings in effect, to log what a reload
+// changed.
+func (c *Config) tunables() map[string]string {
+	out := map[string]string{}
+	if c.sessionManager != nil {
+		for k, v := range c.sessionManager.Settings() {
+			out[k] = fmt.Sprint(v)
+		}
+	}
+	limits := vodDownloadLimits()
+	retries, backoff := downloadRetryPolicy()
+	out["max_cache_downloads"] = fmt.Sprint(cacheDownloadLimit())
+	out["vod_max_bytes"] = fmt.Sprint(limits.maxBytes)
+	out["vod_max_duration"] = limits.maxDuration.String()
+	out["download_retries"] = fmt.Sprint(retries)
+	out["download_backoff"] = backoff.String()
+	if l := authRateLimiter(); l != nil {
+		t := l.thresholds()
+		out["auth_failure_window"] = t.window.String()
+		out["auth_max_failures_per_ip"] = fmt.Sprint(t.maxPerIP)
+		out["auth_max_failures_per_user"] = fmt.Sprint(t.maxPerUser)
+		out["auth_lockout"] = t.lockout.String()
+		out["auth_max_lockout"] = t.maxLockout.String()
+	}
+	out["debug_logging"] = fmt.Sprint(utils.DebugLogging())
+	return out
+}
+
+// readEnvFile parses a KEY=VALUE file as used by docker compose env_file:
+// blank lines and # comments are skipped, an "export " prefix and quotes
+// around the value are dropped.
+func readEnvFile(name string) (map[string]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	values := map[string]string{}
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		text = strings.TrimPrefix(text, "export ")
+		k, v, ok := strings.Cut(text, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			utils.WarnLog("Reload: %s:%d is not KEY=VALUE, skipped", name, line)
+			continue
+		}
+		v = strings.TrimSpace(v)
+		if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+			v = v[1 : len(v)-1]
+		}
+		values[k] = v
+	}
+	return values, sc.Err()
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lucasduport/stream-share/pkg/session"
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+func TestReloadSkipsNonReloadable(t *testing.T) {
+	l := authRateLimiter()
+	if l != nil {
+		before := l.thresholds()
+		t.Cleanup(func() { l.setThresholds(before) })
+	}
+	debug := utils.DebugLogging()
+	t.Cleanup(func() { utils.SetDebugLogging(debug) })
+	for _, k := range []string{"INTERNAL_API_KEY", "CACHE_FOLDER", "AUTH_MAX_FAILURES_PER_IP"} {
+		t.Setenv(k, "")
+	}
+	t.Setenv("DEBUG_LOGGING", "false")
+	utils.SetDebugLogging(false)
+
+	file := filepath.Join(t.TempDir(), "reload.env")
+	t.Setenv("RELOAD_ENV_FILE", file)
+	content := "# comment\nINTERNAL_API_KEY=new-key\nexport CACHE_FOLDER=\"/elsewhere\"\nAUTH_MAX_FAILURES_PER_IP=9\nDEBUG_LOGGING=true\n"
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Request goroutines keep logging while the reload flips debug logging
+	stop := make(chan struct{})
+	logged := make(chan struct{})
+	go func() {
+		defer close(logged)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				utils.DebugLog("request log during reload")
+			}
+		}
+	}()
+	key := GetAPIKey()
+	(&Config{}).reload()
+	close(stop)
+	<-logged
+
+	for _, k := range []string{"INTERNAL_API_KEY", "CACHE_FOLDER"} {
+		if v := os.Getenv(k); v != "" {
+			t.Errorf("%s reloaded to %q, it needs a restart", k, v)
+		}
+	}
+	if GetAPIKey() != key {
+		t.Error("the API key changed on reload")
+	}
+	if !utils.DebugLogging() {
+		t.Error("DEBUG_LOGGING=true not applied")
+	}
+	if l != nil && l.thresholds().maxPerIP != 9 {
+		t.Errorf("AUTH_MAX_FAILURES_PER_IP = %d after reload, want 9", l.thresholds().maxPerIP)
+	}
+}
+
+// TestReloadWhileStreaming applies the session settings over and over while
+// viewers join, are served and leave a stream; run with -race.
+func TestReloadWhileStreaming(t *testing.T) {
+	l := authRateLimiter()
+	if l != nil {
+		before := l.thresholds()
+		t.Cleanup(func() { l.setThresholds(before) })
+	}
+	debug := utils.DebugLogging()
+	t.Cleanup(func() { utils.SetDebugLogging(debug) })
+	t.Setenv("DEBUG_LOGGING", "")
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chunk := make([]byte, 512)
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(2 * time.Millisecond):
+			}
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer upstream.Close()
+	streamURL, _ := url.Parse(upstream.URL + "/live/u/p/1.ts")
+
+	sm := session.NewSessionManager(nil)
+	sm.SetBufferSize("", 8, 512)
+	c := &Config{sessionManager: sm}
+	defer sm.StopStream("1")
+
+	stop := make(chan struct{})
+	served := make(chan error)
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				close(served)
+				return
+			default:
+			}
+			user := fmt.Sprintf("viewer%d", i%4)
+			if _, err := sm.RequestStream(context.Background(), user, "1", "live", "Channel", streamURL); err != nil {
+				served <- err
+				return
+			}
+			if ch, ok := sm.GetClientChannel("1", user); ok {
+				<-ch
+			}
+			if _, err := sm.GenerateTemporaryLink(user, "42", "Heat", "http://provider/movie/u/p/42.mkv"); err != nil {
+				served <- err
+				return
+			}
+			if i%4 == 3 {
+				sm.RemoveClient(context.Background(), "1", user)
+			}
+		}
+	}()
+
+	preroll := 0
+	for i := 0; i < 50; i++ {
+		preroll = 1 + i%3
+		n := fmt.Sprint(preroll)
+		for _, k := range []string{"SESSION_TIMEOUT_MINUTES", "STREAM_TIMEOUT_MINUTES", "TEMP_LINK_HOURS",
+			"CLIENT_STALL_TIMEOUT", "UPSTREAM_READ_TIMEOUT", "STREAM_PREROLL_CHUNKS"} {
+			t.Setenv(k, n)
+		}
+		c.applyTunables()
+		sm.Settings()
+		time.Sleep(time.Millisecond)
+	}
+	close(stop)
+	if err := <-served; err != nil {
+		t.Fatal(err)
+	}
+
+	if got := sm.Settings()["join_preroll_chunks"]; got != preroll {
+		t.Errorf("join_preroll_chunks = %v after the last reload, want %d", got, preroll)
+	}
+}
@@ -0,0 +1,55 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucasduport/stream-share/pkg/utils"
+	uuid "github.com/satori/go.uuid"
+)
+
+// requestIDHeader carries the correlation id in both directions.
+const requestIDHeader = "X-Request-ID"
+
+// validRequestID limits inbound ids to something safe to log and echo.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// requestID gives every request a correlation id: the client's X-Request-ID
+// when it is sane, a new UUID otherwise. The id is echoed in the response,
+// kept as "request_id" in the gin context and on the request's context, where
+// reqLog picks it up.
+func requestID() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.GetHeader(requestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = uuid.NewV4().String()
+		}
+		ctx.Set("request_id", id)
+		ctx.Request = ctx.Request.WithContext(utils.WithRequestID(ctx.Request.Context(), id))
+		ctx.Header(requestIDHeader, id)
+		ctx.Next()
+	}
+}
+
+// reqLog returns a logger tagging each line with the request's id.
+func reqLog(ctx *gin.Context) utils.RequestLogger {
+	return utils.ForRequest(ctx.Request.Context())
+}
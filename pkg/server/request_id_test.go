@@ -0,0 +1,71 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucasduport/stream-share/pkg/utils"
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(requestID())
+	var seen string
+	r.GET("/ping", func(ctx *gin.Context) {
+		seen = ctx.GetString("request_id")
+		// Warnings are kept by utils.RecentLogs with their prefix
+		reqLog(ctx).WarnLog("request id test for %s", ctx.Query("n"))
+		ctx.Status(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name, inbound string
+		echoed        bool
+	}{
+		{"valid id", "abc-123_x.y:z", true},
+		{"missing id", "", false},
+		{"invalid characters", "bad id\r\nX-Injected: 1", false},
+		{"too long", strings.Repeat("a", 129), false},
+		{"format verb", "%s%d", false},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen = ""
+			req := httptest.NewRequest(http.MethodGet, "/ping?n="+string(rune('a'+i)), nil)
+			if tt.inbound != "" {
+				req.Header.Set(requestIDHeader, tt.inbound)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			id := w.Header().Get(requestIDHeader)
+			if tt.echoed {
+				if id != tt.inbound {
+					t.Errorf("%s = %q, want the inbound %q", requestIDHeader, id, tt.inbound)
+				}
+			} else if _, err := uuid.FromString(id); err != nil || id == tt.inbound {
+				t.Errorf("%s = %q, want a new UUID", requestIDHeader, id)
+			}
+			if seen != id {
+				t.Errorf("request_id in the gin context = %q, want %q", seen, id)
+			}
+
+			want := "[req=" + id + "] request id test for " + string(rune('a'+i))
+			found := false
+			for _, e := range utils.RecentLogs() {
+				if e.Message == want {
+					found = true
+					break
+				}
+			}
+			if !found {
+				t.Errorf("no log line %q", want)
+			}
+		})
+	}
+}
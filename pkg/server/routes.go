@@ -61,14 +61,21 @@ func (c *Config) xtreamRoutes(r *gin.RouterGroup) {
 	r.GET("/player_api.php", c.authenticate, c.xtreamPlayerAPIGET)
 	r.POST("/player_api.php", c.appAuthenticate, c.xtreamPlayerAPIPOST)
 	r.GET("/xmltv.php", c.authenticate, c.xtreamXMLTV)
-	r.GET(fmt.Sprintf("/%s/%s/:id", c.XtreamUser.String(), c.XtreamPassword.String()), c.xtreamStreamHandler)
-	r.GET(fmt.Sprintf("/live/%s/%s/:id", c.XtreamUser.String(), c.XtreamPassword.String()), c.xtreamStreamLive)
-	r.GET(fmt.Sprintf("/timeshift/%s/%s/:duration/:start/:id", c.XtreamUser.String(), c.XtreamPassword.String()), c.xtreamStreamTimeshift)
-	r.GET(fmt.Sprintf("/movie/%s/%s/:id", c.XtreamUser.String(), c.XtreamPassword.String()), c.xtreamStreamMovie)
-	r.GET(fmt.Sprintf("/series/%s/%s/:id", c.XtreamUser.String(), c.XtreamPassword.String()), c.xtreamStreamSeries)
-	r.GET(fmt.Sprintf("/hlsr/:token/%s/%s/:channel/:hash/:chunk", c.XtreamUser.String(), c.XtreamPassword.String()), c.xtreamHlsrStream)
-	r.GET("/hls/:token/:chunk", c.xtreamHlsStream)
+	// Playlist of the ready cache entries, built from the database
+	r.GET("/library.m3u", c.authenticate, c.libraryM3U)
+	// Stream ids end up in upstream URLs and cache file names: STREAM_ID_POLICY applies
+	validID := validateStreamIDs("id")
+	notBlocked := rejectBlockedStreams("id")
+	r.GET(fmt.Sprintf("/%s/%s/:id", c.XtreamUser.String(), c.XtreamPassword.String()), validID, notBlocked, c.xtreamStreamHandler)
+	r.GET(fmt.Sprintf("/live/%s/%s/:id", c.XtreamUser.String(), c.XtreamPassword.String()), validID, notBlocked, c.xtreamStreamLive)
+	r.GET(fmt.Sprintf("/timeshift/%s/%s/:duration/:start/:id", c.XtreamUser.String(), c.XtreamPassword.String()), validID, notBlocked, c.xtreamStreamTimeshift)
+	r.GET(fmt.Sprintf("/movie/%s/%s/:id", c.XtreamUser.String(), c.XtreamPassword.String()), validID, notBlocked, c.xtreamStreamMovie)
+	r.GET(fmt.Sprintf("/series/%s/%s/:id", c.XtreamUser.String(), c.XtreamPassword.String()), validID, notBlocked, c.xtreamStreamSeries)
+	r.GET(fmt.Sprintf("/hlsr/:token/%s/%s/:channel/:hash/:chunk", c.XtreamUser.String(), c.XtreamPassword.String()), validateStreamIDs("channel", "hash", "chunk"), c.xtreamHlsrStream)
+	r.GET("/hls/:token/:chunk", validateStreamIDs("chunk"), c.xtreamHlsStream)
 	r.GET("/play/:token/:type", c.xtreamStreamPlay)
+	// Signed, cached channel logos (PROXY_LOGOS)
+	r.GET("/logo", c.serveLogo)
 }
 
 // m3uRoutes exposes a proxified, credential-rewritten M3U and its track endpoints.
@@ -84,7 +91,7 @@ func (c *Config) m3uRoutes(r *gin.RouterGroup) {
 		}
 
 		if strings.HasSuffix(track.URI, ".m3u8") {
-			r.GET(fmt.Sprintf("/%s/%s/%s/%d/:id", c.endpointAntiColision, c.XtreamUser.String(), c.XtreamPassword.String(), i), trackConfig.m3u8ReverseProxy)
+			r.GET(fmt.Sprintf("/%s/%s/%s/%d/:id", c.endpointAntiColision, c.XtreamUser.String(), c.XtreamPassword.String(), i), validateStreamIDs("id"), trackConfig.m3u8ReverseProxy)
 		} else {
 			r.GET(fmt.Sprintf("/%s/%s/%s/%d/%s", c.endpointAntiColision, c.XtreamUser.String(), c.XtreamPassword.String(), i, path.Base(track.URI)), trackConfig.reverseProxy)
 		}
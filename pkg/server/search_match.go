@@ -0,0 +1,218 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/lucasduport/stream-share/pkg/types"
+	"golang.org/x/text/unicode/norm"
+)
+
+// searchArticles are ignored when matching titles, so "the matrix" finds
+// "Matrix, The" and "l'odyssée" finds "Odyssée".
+var searchArticles = map[string]bool{
+	"the": true, "a": true, "an": true,
+	"le": true, "la": true, "les": true, "l": true,
+	"el": true, "los": true, "las": true,
+	"der": true, "die": true, "das": true,
+}
+
+// foldLetters covers letters that do not decompose into a base letter and a mark.
+var foldLetters = strings.NewReplacer("ß", "ss", "æ", "ae", "œ", "oe", "ø", "o", "ł", "l", "đ", "d", "þ", "th")
+
+// foldTitle lowercases s, strips diacritics (é -> e) and turns punctuation into
+// spaces.
+func foldTitle(s string) string {
+	s = foldLetters.Replace(strings.ToLower(s))
+	var b strings.Builder
+	b.Grow(len(s))
+	space := true
+	for _, r := range norm.NFD.String(s) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			continue
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+			space = false
+		case !space:
+			b.WriteByte(' ')
+			space = true
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// titleWords returns the folded words of s without articles. A title made of
+// articles only keeps them.
+func titleWords(s string) []string {
+	words := strings.Fields(foldTitle(s))
+	out := words[:0:0]
+	for _, w := range words {
+		if !searchArticles[w] {
+			out = append(out, w)
+		}
+	}
+	if len(out) == 0 {
+		return words
+	}
+	return out
+}
+
+// Match scores, best first. Fuzzy matches always rank below these.
+const (
+	matchNone = iota
+	matchWords
+	matchPrefix
+	matchExact
+)
+
+// titleMatcher matches catalog titles against a search query with
+// diacritics folded and articles ignored.
+type titleMatcher struct {
+	words []string
+}
+
+func newTitleMatcher(query string) *titleMatcher {
+	return &titleMatcher{words: titleWords(query)}
+}
+
+// score tells how well title matches: every query word must appear in it.
+// Titles equal to the query rank first, then titles starting with it.
+func (m *titleMatcher) score(title string) int {
+	if len(m.words) == 0 {
+		return matchWords
+	}
+	words := titleWords(title)
+	joined := " " + strings.Join(words, " ") + " "
+	for _, w := range m.words {
+		if !strings.Contains(joined, w) {
+			return matchNone
+		}
+	}
+	query := strings.Join(m.words, " ")
+	switch {
+	case strings.TrimSpace(joined) == query:
+		return matchExact
+	case strings.HasPrefix(joined, " "+query+" "):
+		return matchPrefix
+	}
+	return matchWords
+}
+
+// fuzzyDistance is the fallback for typos: every query word must be within a
+// small edit distance of a title word (1 from 4 letters, 2 from 8). Shorter
+// words must still appear as is. It returns the summed distance.
+func (m *titleMatcher) fuzzyDistance(title string) (int, bool) {
+	if len(m.words) == 0 {
+		return 0, false
+	}
+	words := titleWords(title)
+	total := 0
+	for _, q := range m.words {
+		limit := 0
+		if n := len([]rune(q)); n >= 8 {
+			limit = 2
+		} else if n >= 4 {
+			limit = 1
+		}
+		best := -1
+		for _, w := range words {
+			if strings.Contains(w, q) {
+				best = 0
+				break
+			}
+			if d := editDistance(q, w); d <= limit && (best < 0 || d < best) {
+				best = d
+			}
+		}
+		if best < 0 {
+			return 0, false
+		}
+		total += best
+	}
+	return total, true
+}
+
+// editDistance returns the optimal string alignment distance between a and b:
+// insertions, deletions, substitutions and swaps of adjacent letters count 1.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	rows := [3][]int{make([]int, len(rb)+1), make([]int, len(rb)+1), make([]int, len(rb)+1)}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		prev2, prev, cur := rows[(i+1)%3], rows[(i+2)%3], rows[i%3]
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+	}
+	return rows[len(ra)%3][len(rb)]
+}
+
+// rankedResults collects search results with their match quality.
+type rankedResults struct {
+	strict []rankedResult
+	fuzzy  []rankedResult
+}
+
+type rankedResult struct {
+	r     types.VODResult
+	score int // match score, or edit distance for fuzzy results
+}
+
+// add files r under its strict score, or as a fuzzy candidate when fuzzy
+// search is enabled.
+func (rr *rankedResults) add(m *titleMatcher, title string, r types.VODResult, fuzzy bool) {
+	if s := m.score(title); s != matchNone {
+		rr.strict = append(rr.strict, rankedResult{r, s})
+	} else if fuzzy && len(rr.strict) == 0 {
+		if d, ok := m.fuzzyDistance(title); ok {
+			rr.fuzzy = append(rr.fuzzy, rankedResult{r, d})
+		}
+	}
+}
+
+// results returns strict matches best first, or the fuzzy matches closest
+// first when nothing matched strictly. Ties keep catalog order.
+func (rr *rankedResults) results() []types.VODResult {
+	list := rr.strict
+	better := func(i, j int) bool { return list[i].score > list[j].score }
+	if len(list) == 0 {
+		list = rr.fuzzy
+		better = func(i, j int) bool { return list[i].score < list[j].score }
+	}
+	sort.SliceStable(list, better)
+	out := make([]types.VODResult, 0, len(list))
+	for _, e := range list {
+		out = append(out, e.r)
+	}
+	return out
+}
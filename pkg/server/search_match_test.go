@@ -0,0 +1,154 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFoldTitle(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"Amélie", "amelie"},
+		{"L'Odyssée de Pi", "l odyssee de pi"},
+		{"Matrix, The", "matrix the"},
+		{"Straße & Œuvre", "strasse oeuvre"},
+		{"  Spider-Man: No Way Home ", "spider man no way home"},
+	}
+	for _, tt := range tests {
+		if got := foldTitle(tt.in); got != tt.want {
+			t.Errorf("foldTitle(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTitleMatcher(t *testing.T) {
+	tests := []struct {
+		query, title string
+		want         int
+		fuzzy        bool // when want is matchNone: matched by the fuzzy fallback
+	}{
+		{"the matrix", "Matrix, The", matchExact, false},
+		{"the matrix", "The Matrix Reloaded", matchPrefix, false},
+		{"matrix", "Animatrix Matrix Stories", matchWords, false},
+		{"amelie", "Amélie", matchExact, false},
+		{"AMÉLIE", "Le Fabuleux Destin d'Amélie Poulain", matchWords, false},
+		{"l'odyssee", "Odyssée", matchExact, false},
+		{"matirx", "The Matrix", matchNone, true},   // swapped letters
+		{"inceptoin", "Inception", matchNone, true}, // swapped letters, long word
+		{"intersteller", "Interstellar", matchNone, true},
+		{"gladiatr", "Gladiator", matchNone, true}, // one letter missing
+		{"cat", "Car", matchNone, false},           // short words must match as is
+		{"matrix", "Inception", matchNone, false},
+	}
+	for _, tt := range tests {
+		m := newTitleMatcher(tt.query)
+		if got := m.score(tt.title); got != tt.want {
+			t.Errorf("score(%q, %q) = %d, want %d", tt.query, tt.title, got, tt.want)
+		}
+		if tt.want != matchNone {
+			continue
+		}
+		if _, ok := m.fuzzyDistance(tt.title); ok != tt.fuzzy {
+			t.Errorf("fuzzyDistance(%q, %q) matched = %v, want %v", tt.query, tt.title, ok, tt.fuzzy)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"matrix", "matrix", 0},
+		{"matirx", "matrix", 1},
+		{"matrx", "matrix", 1},
+		{"matriks", "matrix", 2},
+		{"kitten", "sitting", 3},
+		{"amélie", "amelie", 1},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+// TestSearchM3UNormalized runs normalized and fuzzy queries through the VOD and
+// series playlist searches.
+func TestSearchM3UNormalized(t *testing.T) {
+	t.Setenv("VOD_SEARCH_FUZZY", "")
+	t.Setenv("VOD_MULTIPART", "")
+	m3u := `#EXTM3U
+#EXTINF:-1 group-title="Movies",The Matrix Reloaded
+http://provider/movie/u/p/2.mp4
+#EXTINF:-1 group-title="Movies",Matrix, The
+http://provider/movie/u/p/1.mp4
+#EXTINF:-1 group-title="Movies",Amélie
+http://provider/movie/u/p/3.mp4
+#EXTINF:-1 group-title="Movies",Gladiator
+http://provider/movie/u/p/4.mp4
+#EXTINF:-1 group-title="Series",La Casa de Papel S01E01
+http://provider/series/u/p/10.mkv
+#EXTINF:-1 group-title="Series",La Casa de Papel S01E02
+http://provider/series/u/p/11.mkv
+#EXTINF:-1 group-title="Series",Élite S02E01
+http://provider/series/u/p/20.mkv
+`
+	path := filepath.Join(t.TempDir(), "vod.m3u")
+	if err := os.WriteFile(path, []byte(m3u), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	movies := []struct {
+		query string
+		want  []string // stream ids, in rank order
+	}{
+		{"the matrix", []string{"1.mp4", "2.mp4"}}, // exact before prefix
+		{"amelie", []string{"3.mp4"}},
+		{"gladaitor", []string{"4.mp4"}}, // typo, fuzzy fallback
+		{"matrix gladiator", nil},
+	}
+	for _, tt := range movies {
+		results, err := searchVODInM3UFile(path, tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, r := range results {
+			ids = append(ids, r.StreamID)
+		}
+		if strings.Join(ids, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("movies %q = %v, want %v", tt.query, ids, tt.want)
+		}
+	}
+
+	series := []struct {
+		query string
+		want  []string
+	}{
+		{"casa de papel s01e02", []string{"11.mkv"}},
+		{"elite", []string{"20.mkv"}},
+		{"casa de papl", []string{"10.mkv", "11.mkv"}},
+	}
+	for _, tt := range series {
+		results, err := searchSeriesInM3UFile(path, tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, r := range results {
+			ids = append(ids, r.StreamID)
+		}
+		if strings.Join(ids, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("series %q = %v, want %v", tt.query, ids, tt.want)
+		}
+	}
+
+	t.Setenv("VOD_SEARCH_FUZZY", "false")
+	if results, _ := searchVODInM3UFile(path, "gladaitor"); len(results) != 0 {
+		t.Errorf("typo matched with VOD_SEARCH_FUZZY=false: %v", results)
+	}
+}
@@ -0,0 +1,147 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucasduport/stream-share/pkg/types"
+	"github.com/lucasduport/stream-share/pkg/utils"
+	xtreamapi "github.com/lucasduport/stream-share/pkg/xtream"
+)
+
+// seriesEpisode is one episode of a season in /series/:id/info
+type seriesEpisode struct {
+	Episode   int    `json:"episode"`
+	Title     string `json:"title"`
+	StreamID  string `json:"stream_id"`
+	Extension string `json:"container_extension,omitempty"`
+	Duration  string `json:"duration,omitempty"`
+	AirDate   string `json:"air_date,omitempty"`
+	Plot      string `json:"plot,omitempty"`
+}
+
+// seriesSeason groups the episodes of one season, in episode order
+type seriesSeason struct {
+	Season   int             `json:"season"`
+	Episodes []seriesEpisode `json:"episodes"`
+}
+
+// getSeriesInfo returns the seasons and episodes of a series so clients can
+// browse it season by season instead of through one flat episode list. The
+// provider answer is kept by the Xtream action cache (API_CACHE_SECONDS), so
+// navigating back and forth does not hit the provider each time.
+func (c *Config) getSeriesInfo(ctx *gin.Context) {
+	seriesID := ctx.Param("id")
+	cli, err := xtreamapi.New(c.XtreamUser.String(), c.XtreamPassword.String(), c.XtreamBaseURL, utils.UserAgentFor(c.XtreamBaseURL))
+	if err != nil {
+		abortJSON(ctx, http.StatusInternalServerError, errCodeInternal, err.Error())
+		return
+	}
+	resp, httpcode, _, err := cli.Action(c.ProxyConfig, "get_series_info", url.Values{"series_id": {seriesID}})
+	if err != nil {
+		reqLog(ctx).WarnLog("API: get_series_info failed for id=%s: %v (HTTP %d)", seriesID, err, httpcode)
+		abortJSON(ctx, http.StatusBadGateway, errCodeUpstreamError, "Provider request failed")
+		return
+	}
+	info, _ := resp.(map[string]interface{})
+	name, seasons := parseSeriesInfo(info)
+	if len(seasons) == 0 {
+		abortJSON(ctx, http.StatusNotFound, errCodeNotFound, "Series not found or has no episodes")
+		return
+	}
+	ctx.JSON(http.StatusOK, types.APIResponse{Success: true, Data: map[string]interface{}{
+		"series_id": seriesID,
+		"name":      name,
+		"seasons":   seasons,
+	}})
+}
+
+// parseSeriesInfo turns a get_series_info answer into sorted seasons. The
+// season comes from the episodes map key, then the episode itself; episode
+// numbers missing from the provider are read from "S01E02" style titles.
+func parseSeriesInfo(info map[string]interface{}) (string, []seriesSeason) {
+	var name string
+	if im, ok := info["info"].(map[string]interface{}); ok {
+		name = strings.TrimSpace(fmt.Sprintf("%v", firstNonEmpty(im["name"], im["title"])))
+	}
+	bySeason := make(map[int][]seriesEpisode)
+	add := func(key int, em map[string]interface{}) {
+		streamID := fmt.Sprintf("%v", firstNonEmpty(em["id"], em["stream_id"]))
+		if streamID == "" || streamID == "<nil>" {
+			return
+		}
+		title := strings.TrimSpace(fmt.Sprintf("%v", firstNonEmpty(em["title"])))
+		season, episode := key, toInt(em["episode_num"])
+		if season == 0 {
+			season = toInt(em["season"])
+		}
+		if season == 0 || episode == 0 {
+			_, s, e := parseQueryTokens(title)
+			if season == 0 {
+				season = s
+			}
+			if episode == 0 {
+				episode = e
+			}
+		}
+		ep := seriesEpisode{Episode: episode, Title: title, StreamID: streamID}
+		if ext := fmt.Sprintf("%v", firstNonEmpty(em["container_extension"])); ext != "" {
+			ep.Extension = ext
+		}
+		if sub, ok := em["info"].(map[string]interface{}); ok {
+			ep.Duration = fmt.Sprintf("%v", firstNonEmpty(sub["duration"]))
+		}
+		ep.AirDate, ep.Plot = episodeDetails(em)
+		bySeason[season] = append(bySeason[season], ep)
+	}
+	// Most providers key episodes by season; a few send a flat array
+	switch eps := info["episodes"].(type) {
+	case map[string]interface{}:
+		for key, v := range eps {
+			n, _ := strconv.Atoi(key)
+			list, _ := v.([]interface{})
+			for _, e := range list {
+				if em, ok := e.(map[string]interface{}); ok {
+					add(n, em)
+				}
+			}
+		}
+	case []interface{}:
+		for _, e := range eps {
+			if em, ok := e.(map[string]interface{}); ok {
+				add(0, em)
+			}
+		}
+	}
+
+	seasons := make([]seriesSeason, 0, len(bySeason))
+	for n, list := range bySeason {
+		sort.SliceStable(list, func(i, j int) bool { return list[i].Episode < list[j].Episode })
+		seasons = append(seasons, seriesSeason{Season: n, Episodes: list})
+	}
+	sort.Slice(seasons, func(i, j int) bool { return seasons[i].Season < seasons[j].Season })
+	return name, seasons
+}
@@ -20,19 +20,22 @@ package server
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"path"
 	"path/filepath"
 	"strconv"
+	"syscall"
 	"time"
 	"strings"
 
-	"github.com/gin-contrib/cors"
 	"github.com/jamesnetherton/m3u"
 	"github.com/lucasduport/stream-share/pkg/config"
 	"github.com/lucasduport/stream-share/pkg/database"
@@ -88,7 +91,13 @@ func NewServer(config *config.ProxyConfig) (*Config, error) {
 	}
 
 	// Initialize debug logging from environment variable
-	utils.Config.DebugLoggingEnabled = os.Getenv("DEBUG_LOGGING") == "true"
+	utils.SetDebugLogging(os.Getenv("DEBUG_LOGGING") == "true")
+
+	// Resolve CACHE_FOLDER once so every cache consumer shares one directory
+	if err := initCacheDir(); err != nil {
+		return nil, err
+	}
+	utils.LogUserAgents()
 
 	// Create server configuration
 	serverConfig := &Config{
@@ -106,7 +115,13 @@ func NewServer(config *config.ProxyConfig) (*Config, error) {
 	utils.InfoLog("Bootstrap: Forcing PostgreSQL database initialization")
 	db, err := database.NewDBManager("") // path unused for postgres
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize database: %w", err)
+		// DB_REQUIRED=false keeps live and M3U proxying up without Postgres
+		if envFlag("DB_REQUIRED", true) {
+			return nil, fmt.Errorf("failed to initialize database: %w", err)
+		}
+		utils.WarnLog("Bootstrap: database unavailable, continuing without it (DB_REQUIRED=false): %v", err)
+		utils.WarnLog("Bootstrap: VOD cache, stream history and Discord account linking are disabled; temporary links are kept in memory only")
+		db = nil
 	}
 	serverConfig.db = db
 	serverConfig.sessionManager = session.NewSessionManager(db)
@@ -120,32 +135,7 @@ func NewServer(config *config.ProxyConfig) (*Config, error) {
 	}
 
 	// Configure session parameters from environment variables
-	if serverConfig.sessionManager != nil {
-		if v := os.Getenv("SESSION_TIMEOUT_MINUTES"); v != "" {
-			if mins, err := strconv.Atoi(v); err == nil && mins > 0 {
-				serverConfig.sessionManager.SetSessionTimeout(time.Duration(mins) * time.Minute)
-				utils.InfoLog("Session timeout set to %d minutes", mins)
-			} else {
-				utils.WarnLog("Invalid SESSION_TIMEOUT_MINUTES: %s", v)
-			}
-		}
-		if v := os.Getenv("STREAM_TIMEOUT_MINUTES"); v != "" {
-			if mins, err := strconv.Atoi(v); err == nil && mins > 0 {
-				serverConfig.sessionManager.SetStreamTimeout(time.Duration(mins) * time.Minute)
-				utils.InfoLog("Stream timeout set to %d minutes", mins)
-			} else {
-				utils.WarnLog("Invalid STREAM_TIMEOUT_MINUTES: %s", v)
-			}
-		}
-		if v := os.Getenv("TEMP_LINK_HOURS"); v != "" {
-			if hours, err := strconv.Atoi(v); err == nil && hours > 0 {
-				serverConfig.sessionManager.SetTempLinkTimeout(time.Duration(hours) * time.Hour)
-				utils.InfoLog("Temporary link timeout set to %d hours", hours)
-			} else {
-				utils.WarnLog("Invalid TEMP_LINK_HOURS: %s", v)
-			}
-		}
-	}
+	serverConfig.applySessionSettings()
 
 	// Initialize Discord bot if token is provided
 	discordToken := os.Getenv("DISCORD_BOT_TOKEN")
@@ -202,6 +192,9 @@ func (c *Config) Serve() error {
 			time.Minute, time.Minute, time.Hour)
 	}
 
+	// SIGHUP re-reads RELOAD_ENV_FILE without dropping streams
+	go c.watchReload()
+
 	if err := c.playlistInitialization(); err != nil {
 		utils.ErrorLog("Playlist initialization failed: %v", err)
 		return err
@@ -216,8 +209,10 @@ func (c *Config) Serve() error {
 		defer c.discordBot.Stop()
 	}
 
-	router := gin.Default()
-	router.Use(cors.Default())
+	// gin.Default's logger would print credentials from stream paths; use ours instead
+	router := gin.New()
+	router.Use(gin.Recovery(), requestID(), c.accessLog())
+	router.Use(corsMiddleware())
 	utils.InfoLog("Setting up routes and internal API...")
 
 	// Setup API routes for Discord bot and other internal tools
@@ -233,9 +228,110 @@ func (c *Config) Serve() error {
 	// Add temporary link download route
 	router.GET("/download/:token", c.handleTemporaryLink)
 
+	c.logFeatures()
+
 	// Add a message to indicate the server is ready
 	utils.InfoLog("[stream-share] Server is ready and listening on :%d", c.HostConfig.Port)
-	return router.Run(fmt.Sprintf(":%d", c.HostConfig.Port))
+	return serveUntilStopped(&http.Server{Addr: fmt.Sprintf(":%d", c.HostConfig.Port), Handler: router})
+}
+
+// serveUntilStopped serves until SIGINT or SIGTERM, then stops accepting
+// requests and writes the pending download progress before returning.
+func serveUntilStopped(srv *http.Server) error {
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.ListenAndServe() }()
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	select {
+	case err := <-errCh:
+		closeProgressWriter()
+		return err
+	case s := <-sig:
+		utils.InfoLog("[stream-share] %v received, shutting down", s)
+	}
+	// Streams never finish on their own: give requests a moment, then go
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		utils.WarnLog("Shutdown: %v", err)
+	}
+	closeProgressWriter()
+	return nil
+}
+
+// accessLog logs every request with status, bytes and duration. Non-2xx
+// responses are logged at warn level; user agent and referer are added when
+// DEBUG_LOGGING is enabled.
+func (c *Config) accessLog() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		ctx.Next()
+
+		status := ctx.Writer.Status()
+		size := ctx.Writer.Size()
+		if size < 0 {
+			size = 0
+		}
+		user := ctx.GetString("username")
+		if user == "" {
+			user = "-"
+		}
+		line := fmt.Sprintf("%s %s ip=%s user=%s status=%d bytes=%d dur=%s req=%s",
+			ctx.Request.Method, c.maskedRequestPath(ctx), ctx.ClientIP(), user, status, size, time.Since(start).Round(time.Millisecond), ctx.GetString("request_id"))
+		if utils.DebugLogging() {
+			line += fmt.Sprintf(" ua=%q referer=%q", ctx.Request.UserAgent(), ctx.Request.Referer())
+		}
+		if status < 200 || status > 299 {
+			utils.WarnLog("HTTP %s", line)
+			return
+		}
+		utils.InfoLog("HTTP %s", line)
+	}
+}
+
+// maskedRequestPath returns the request path and query with credentials masked:
+// :username/:password path params, username/password/key query params and the
+// literal proxy/Xtream credentials used by the fixed-credential routes.
+func (c *Config) maskedRequestPath(ctx *gin.Context) string {
+	secrets := map[string]string{}
+	addSecret := func(v, masked string) {
+		if v != "" {
+			secrets[v] = masked
+		}
+	}
+	// Usernames keep a recognisable prefix; passwords are hidden completely
+	addSecret(ctx.Param("username"), utils.MaskString(ctx.Param("username")))
+	addSecret(c.User.String(), utils.MaskString(c.User.String()))
+	addSecret(c.XtreamUser.String(), utils.MaskString(c.XtreamUser.String()))
+	addSecret(ctx.Param("password"), "******")
+	addSecret(c.Password.String(), "******")
+	addSecret(c.XtreamPassword.String(), "******")
+
+	segments := strings.Split(ctx.Request.URL.Path, "/")
+	for i, seg := range segments {
+		if masked, ok := secrets[seg]; ok {
+			segments[i] = masked
+		}
+	}
+	p := strings.Join(segments, "/")
+
+	if ctx.Request.URL.RawQuery == "" {
+		return p
+	}
+	q := ctx.Request.URL.Query()
+	if v := q.Get("username"); v != "" {
+		q.Set("username", utils.MaskString(v))
+	}
+	if q.Get("password") != "" {
+		q.Set("password", "******")
+	}
+	// The internal API key, accepted as ?key= where a browser can't set headers
+	if q.Get("key") != "" {
+		q.Set("key", "******")
+	}
+	return p + "?" + q.Encode()
 }
 
 // Add direct streaming routes with proxy credentials
@@ -245,27 +341,22 @@ func (c *Config) addProxyCredentialRoutes(router *gin.Engine) {
 	utils.InfoLog("[stream-share] Setting up direct stream routes with proxy credentials")
 
 	// Root level (generic)
-	router.GET("/:username/:password/:id", c.authWithPathCredentials(), c.xtreamProxyCredentialsStreamHandler)
+	router.GET("/:username/:password/:id", c.authWithPathCredentials(), rejectBlockedStreams("id"), c.xtreamProxyCredentialsStreamHandler)
 
 	// Live
-	router.GET("/live/:username/:password/:id", c.authWithPathCredentials(), c.xtreamProxyCredentialsLiveStreamHandler)
+	router.GET("/live/:username/:password/:id", c.authWithPathCredentials(), rejectBlockedStreams("id"), c.xtreamProxyCredentialsLiveStreamHandler)
 
 	// Movie
-	router.GET("/movie/:username/:password/:id", c.authWithPathCredentials(), c.xtreamProxyCredentialsMovieStreamHandler)
+	router.GET("/movie/:username/:password/:id", c.authWithPathCredentials(), rejectBlockedStreams("id"), c.xtreamProxyCredentialsMovieStreamHandler)
 
 	// Series
-	router.GET("/series/:username/:password/:id", c.authWithPathCredentials(), c.xtreamProxyCredentialsSeriesStreamHandler)
+	router.GET("/series/:username/:password/:id", c.authWithPathCredentials(), rejectBlockedStreams("id"), c.xtreamProxyCredentialsSeriesStreamHandler)
 
 	// Timeshift
-	router.GET("/timeshift/:username/:password/:duration/:start/:id", c.authWithPathCredentials(), func(ctx *gin.Context) {
-		duration := ctx.Param("duration")
-		start := ctx.Param("start")
-		id := ctx.Param("id")
-		utils.DebugLog("Timeshift request with proxy credentials: duration=%s, start=%s, id=%s", duration, start, id)
-		rpURL, err := url.Parse(fmt.Sprintf("%s/timeshift/%s/%s/%s/%s/%s", c.XtreamBaseURL, c.XtreamUser, c.XtreamPassword, duration, start, id))
-		if err != nil {
-			utils.ErrorLog("Failed to parse upstream URL: %v", err)
-			ctx.AbortWithStatus(http.StatusInternalServerError)
+	router.GET("/timeshift/:username/:password/:duration/:start/:id", c.authWithPathCredentials(), rejectBlockedStreams("id"), func(ctx *gin.Context) {
+		reqLog(ctx).DebugLog("Timeshift request with proxy credentials: duration=%s, start=%s, id=%s", ctx.Param("duration"), ctx.Param("start"), ctx.Param("id"))
+		rpURL := c.timeshiftUpstreamURL(ctx)
+		if rpURL == nil {
 			return
 		}
 		c.multiplexedStream(ctx, rpURL)
@@ -285,11 +376,15 @@ func (c *Config) authWithPathCredentials() gin.HandlerFunc {
 		ip := ctx.ClientIP()
 		userAgent := ctx.Request.UserAgent()
 
-		utils.DebugLog("Path credentials auth check: username=%s, IP=%s", username, ip)
+		reqLog(ctx).DebugLog("Path credentials auth check: username=%s, IP=%s", username, ip)
+		if !authAllowed(ctx, username) {
+			return
+		}
 
 		// If LDAP is enabled, authenticate against LDAP
 		if c.ProxyConfig.LDAPEnabled {
-			ok := ldapAuthenticate(
+			ok, err := ldapAuthenticate(
+				reqLog(ctx),
 				c.ProxyConfig.LDAPServer,
 				c.ProxyConfig.LDAPBaseDN,
 				c.ProxyConfig.LDAPBindDN,
@@ -300,24 +395,38 @@ func (c *Config) authWithPathCredentials() gin.HandlerFunc {
 				username,
 				password,
 			)
+			if err != nil {
+				abortError(ctx, http.StatusServiceUnavailable, errCodeAuthUnavailable, "Authentication service unavailable", err)
+				return
+			}
 			if !ok {
-				utils.DebugLog("LDAP authentication failed for user in path: %s", username)
-				ctx.AbortWithStatus(http.StatusUnauthorized)
+				reqLog(ctx).DebugLog("LDAP authentication failed for user in path: %s", username)
+				authFailed(ctx, username)
+				abortJSON(ctx, http.StatusUnauthorized, errCodeUnauthorized, "Invalid credentials")
 				return
 			}
-			utils.DebugLog("LDAP authentication succeeded for user in path: %s", username)
+			reqLog(ctx).DebugLog("LDAP authentication succeeded for user in path: %s", username)
 		} else if c.ProxyConfig.User.String() != username || c.ProxyConfig.Password.String() != password {
-			utils.DebugLog("Local authentication failed for user in path: %s", username)
-			ctx.AbortWithStatus(http.StatusUnauthorized)
+			reqLog(ctx).DebugLog("Local authentication failed for user in path: %s", username)
+			authFailed(ctx, username)
+			abortJSON(ctx, http.StatusUnauthorized, errCodeUnauthorized, "Invalid credentials")
+			return
+		}
+		authSucceeded(username)
+
+		// Timed-out users keep failing here until the timeout ends. Temporary
+		// links skip this check on purpose: they can only be created outside
+		// a timeout, so downloads requested earlier still complete.
+		if c.rejectTimedOut(ctx, username, "Playback") {
 			return
 		}
 
 		// Register or update the user session and set username in context for later logs
 		if c.sessionManager == nil {
-			utils.ErrorLog("authWithPathCredentials: sessionManager is NIL - cannot register user session")
+			reqLog(ctx).ErrorLog("authWithPathCredentials: sessionManager is NIL - cannot register user session")
 		} else {
 			c.sessionManager.RegisterUser(username, ip, userAgent)
-			utils.InfoLog("authWithPathCredentials: session registered for user=%s ip=%s", username, ip)
+			reqLog(ctx).InfoLog("authWithPathCredentials: session registered for user=%s ip=%s", username, ip)
 		}
 		ctx.Set("username", username)
 
@@ -334,30 +443,42 @@ func (c *Config) handleTemporaryLink(ctx *gin.Context) {
 	// Get the temporary link from session manager
 	tempLink, err := c.sessionManager.GetTemporaryLink(token)
 	if err != nil {
-		utils.DebugLog("Temporary link not found: %v", err)
-		ctx.AbortWithStatus(http.StatusNotFound)
+		reqLog(ctx).DebugLog("Temporary link not found: %v", err)
+		abortJSON(ctx, http.StatusNotFound, errCodeNotFound, "Link not found or expired")
+		return
+	}
+	if refuseBlockedStream(ctx, tempLink.StreamID) {
 		return
 	}
 
-	// If cached locally, serve from disk (normalize ID without extension)
+	// If cached locally, serve from disk (normalize ID without extension). Both
+	// paths honor Range, so downloads can resume and saved files can be seeked.
 	if c.db != nil && tempLink.StreamID != "" {
 		idRaw := strings.TrimSuffix(tempLink.StreamID, path.Ext(tempLink.StreamID))
-		if entry, err := c.db.GetVODCache(idRaw); err == nil && entry != nil && entry.Status == "ready" {
-			utils.InfoLog("Download via cache for stream %s -> %s", tempLink.StreamID, entry.FilePath)
+		if entry, err := c.db.GetVODCache(c.db.Provider(), idRaw); err == nil && entry != nil && (entry.Status == "ready" || entry.Status == "downloading") {
 			ext := strings.ToLower(path.Ext(entry.FilePath)); if ext == "" { ext = ".mp4" }
-			_ = c.db.TouchVODCache(idRaw)
+			_ = c.db.TouchVODCache(c.db.Provider(), idRaw)
 			var ct string
 			switch ext { case ".ts": ct = "video/mp2t"; case ".mkv": ct = "video/x-matroska"; case ".mp4": ct = "video/mp4"; default: ct = "application/octet-stream" }
-			serveLocalFileRange(ctx, entry.FilePath, ct, tempLink.Title+ext, true)
-			return
+			filename := sanitizeFilename(tempLink.Title) + ext
+			if entry.Status == "ready" {
+				reqLog(ctx).InfoLog("Download via cache for stream %s -> %s", tempLink.StreamID, entry.FilePath)
+				serveLocalFileRange(ctx, entry.FilePath, ct, filename, true)
+				return
+			}
+			if _, err := os.Stat(entry.FilePath + ".part"); err == nil {
+				reqLog(ctx).InfoLog("Download via cache (still downloading) for stream %s -> %s", tempLink.StreamID, entry.FilePath)
+				serveGrowingFileRange(ctx, entry.FilePath, ct, filename, true, entry.TotalBytes)
+				return
+			}
 		}
 	}
 
-	// Fallback: proxy upstream URL
+	// Fallback: proxy upstream URL; the client's Range is passed through
 	targetURL, err := url.Parse(tempLink.URL)
-	if err != nil { utils.ErrorLog("Invalid URL in temporary link: %v", err); ctx.AbortWithStatus(http.StatusInternalServerError); return }
+	if err != nil { reqLog(ctx).ErrorLog("Invalid URL in temporary link: %v", err); abortJSON(ctx, http.StatusInternalServerError, errCodeInternal, "Invalid link target"); return }
 	ext := strings.ToLower(path.Ext(targetURL.Path)); if ext == "" { ext = ".mp4" }
-	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s%s"`, tempLink.Title, ext))
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s%s"`, sanitizeFilename(tempLink.Title), ext))
 	c.stream(ctx, targetURL)
 }
 
@@ -378,6 +499,9 @@ func (c *Config) multiplexedStream(ctx *gin.Context, targetURL *url.URL) {
 
 	// Extract stream ID and type
 	streamID := path.Base(targetURL.Path)
+	if refuseBlockedStream(ctx, streamID) {
+		return
+	}
 	// Normalize stream id for cache lookup (strip extension if present)
 	streamIDRaw := strings.TrimSuffix(streamID, path.Ext(streamID))
 	streamType := "unknown"
@@ -394,51 +518,79 @@ func (c *Config) multiplexedStream(ctx *gin.Context, targetURL *url.URL) {
 
 	// Title from query parameter or fallback to stream ID
 	streamTitle := targetURL.Query().Get("title")
+	if streamTitle == "" {
+		streamTitle = ctx.Query("title")
+	}
 	if streamTitle == "" {
 		streamTitle = streamID
 	}
 
-	utils.DebugLog("Multiplexed stream request: user=%s, id=%s, type=%s, title=%s, upstream=%s",
+	// Only allowlisted query params reach upstream; some providers reject unknown ones
+	targetURL = upstreamStreamURL(targetURL, ctx.Request.URL.Query())
+
+	reqLog(ctx).DebugLog("Multiplexed stream request: user=%s, id=%s, type=%s, title=%s, upstream=%s",
 		username, streamID, streamType, streamTitle, targetURL.String())
 
 	// If VOD and cached locally, serve from disk to avoid upstream connection
 	if c.db != nil && (streamType == "movie" || streamType == "series") {
-		if entry, err := c.db.GetVODCache(streamIDRaw); err == nil && entry != nil && entry.Status == "ready" {
+		if entry, err := c.db.GetVODCache(c.db.Provider(), streamIDRaw); err == nil && entry != nil && entry.Status == "ready" {
 			if fi, statErr := os.Stat(entry.FilePath); statErr == nil && !fi.IsDir() {
-				utils.InfoLog("Multiplex: serving cached %s for %s from %s", streamType, streamIDRaw, entry.FilePath)
+				reqLog(ctx).InfoLog("Multiplex: serving cached %s for %s from %s", streamType, streamIDRaw, entry.FilePath)
 				// Content-Type based on file extension
 				var ct string
 				if ext := strings.ToLower(path.Ext(entry.FilePath)); ext == ".ts" { ct = "video/mp2t" } else if ext == ".mkv" { ct = "video/x-matroska" } else { ct = "video/mp4" }
-				_ = c.db.TouchVODCache(streamIDRaw)
+				_ = c.db.TouchVODCache(c.db.Provider(), streamIDRaw)
 				serveLocalFileRange(ctx, entry.FilePath, ct, "", false)
 				return
 			}
-			utils.WarnLog("Multiplex: cached %s missing on disk for stream %s at %s; falling back to upstream", streamType, streamIDRaw, entry.FilePath)
+			reqLog(ctx).WarnLog("Multiplex: cached %s missing on disk for stream %s at %s; falling back to upstream", streamType, streamIDRaw, entry.FilePath)
 		}
 	}
 
 	if c.sessionManager == nil {
-		utils.ErrorLog("Multiplex: sessionManager is NIL, falling back to direct streaming")
+		reqLog(ctx).ErrorLog("Multiplex: sessionManager is NIL, falling back to direct streaming")
 		c.stream(ctx, targetURL)
 		return
 	}
 
+	// Live viewers may start some chunks behind the live edge, e.g. to seek
+	// back after a reconnect
+	behind := -1
+	if v := ctx.Query("behind"); v != "" && streamType == "live" {
+		n, convErr := strconv.Atoi(v)
+		if convErr != nil || n < 0 {
+			abortJSON(ctx, http.StatusBadRequest, errCodeInvalidParameter, "behind must be a number of chunks >= 0")
+			return
+		}
+		behind = n
+	}
+
 	// Request the stream through the session manager for multiplexing
-	buffer, err := c.sessionManager.RequestStream(username, streamID, streamType, streamTitle, targetURL)
+	buffer, err := c.sessionManager.RequestStreamBehind(ctx.Request.Context(), username, streamID, streamType, streamTitle, targetURL, behind)
+	if errors.Is(err, session.ErrStreamsBlocked) {
+		reqLog(ctx).WarnLog("Multiplex: refusing stream %s for user=%s: %v", streamID, username, err)
+		abortJSON(ctx, http.StatusServiceUnavailable, errCodeStreamsBlocked, err.Error())
+		return
+	}
+	if errors.Is(err, session.ErrStreamAtCapacity) {
+		reqLog(ctx).WarnLog("Multiplex: refusing stream %s for user=%s: %v", streamID, username, err)
+		abortJSON(ctx, http.StatusServiceUnavailable, errCodeStreamLimit, "Stream at capacity, try again later")
+		return
+	}
 	if err != nil {
-		utils.ErrorLog("Multiplex: RequestStream failed for user=%s streamID=%s err=%v", username, streamID, err)
-		ctx.AbortWithStatus(http.StatusInternalServerError)
+		reqLog(ctx).ErrorLog("Multiplex: RequestStream failed for user=%s streamID=%s err=%v", username, streamID, err)
+		abortJSON(ctx, http.StatusInternalServerError, errCodeUpstreamError, "Could not start stream")
 		return
 	}
 	if buffer == nil {
-		utils.WarnLog("Multiplex: buffer returned is NIL for streamID=%s (user=%s)", streamID, username)
+		reqLog(ctx).WarnLog("Multiplex: buffer returned is NIL for streamID=%s (user=%s)", streamID, username)
 	}
 
 	// Get the channel for this client
 	dataChan, exists := c.sessionManager.GetClientChannel(streamID, username)
 	if !exists {
-		utils.ErrorLog("Failed to get client channel for user=%s, streamID=%s", username, streamID)
-		ctx.AbortWithStatus(http.StatusInternalServerError)
+		reqLog(ctx).ErrorLog("Failed to get client channel for user=%s, streamID=%s", username, streamID)
+		abortJSON(ctx, http.StatusInternalServerError, errCodeInternal, "Could not join stream")
 		return
 	}
 
@@ -446,22 +598,22 @@ func (c *Config) multiplexedStream(ctx *gin.Context, targetURL *url.URL) {
 	setNoBufferingHeaders(ctx, contentTypeForPath(targetURL.Path))
 
 	// Stream data to the client
-	utils.InfoLog("Starting multiplexed stream for user %s (stream %s)", username, streamID)
+	reqLog(ctx).InfoLog("Starting multiplexed stream for user %s (stream %s)", username, streamID)
 
 	ctx.Stream(func(w io.Writer) bool {
 		// Wait for data from channel
 		data, ok := <-dataChan
 		if !ok {
 			// Channel closed, end streaming
-			utils.DebugLog("Stream channel closed for user %s (stream %s)", username, streamID)
+			reqLog(ctx).DebugLog("Stream channel closed for user %s (stream %s)", username, streamID)
 			return false
 		}
 
 		// Write data to client
 		if _, err := w.Write(data); err != nil {
 			// Client disconnected
-			utils.DebugLog("Client write error for user %s (stream %s): %v", username, streamID, err)
-			c.sessionManager.RemoveClient(streamID, username)
+			reqLog(ctx).DebugLog("Client write error for user %s (stream %s): %v", username, streamID, err)
+			c.sessionManager.RemoveClient(ctx.Request.Context(), streamID, username)
 			return false
 		}
 
@@ -474,8 +626,8 @@ func (c *Config) multiplexedStream(ctx *gin.Context, targetURL *url.URL) {
 	})
 
 	// Clean up after streaming is done
-	utils.InfoLog("Stream ended for user %s (stream %s)", username, streamID)
-	c.sessionManager.RemoveClient(streamID, username)
+	reqLog(ctx).InfoLog("Stream ended for user %s (stream %s)", username, streamID)
+	c.sessionManager.RemoveClient(ctx.Request.Context(), streamID, username)
 }
 
 // playlistInitialization writes a proxified M3U file to disk if a playlist was parsed.
@@ -500,18 +652,24 @@ func (c *Config) marshallInto(into *os.File, xtream bool) error {
 	filteredTrack := make([]m3u.Track, 0, len(c.playlist.Tracks))
 
 	ret := 0
+	blocked := blockedStreams()
 	into.WriteString("#EXTM3U\n") // nolint: errcheck
 	for i, track := range c.playlist.Tracks {
+		if blocked.trackBlocked(track) {
+			ret++
+			continue
+		}
 		var buffer bytes.Buffer
 
 		buffer.WriteString("#EXTINF:")                       // nolint: errcheck
 		buffer.WriteString(fmt.Sprintf("%d ", track.Length)) // nolint: errcheck
+		// Tags are written in the order they were generated or parsed
 		for i := range track.Tags {
 			if i == len(track.Tags)-1 {
-				buffer.WriteString(fmt.Sprintf("%s=%q", track.Tags[i].Name, track.Tags[i].Value)) // nolint: errcheck
+				buffer.WriteString(m3uAttr(track.Tags[i])) // nolint: errcheck
 				continue
 			}
-			buffer.WriteString(fmt.Sprintf("%s=%q ", track.Tags[i].Name, track.Tags[i].Value)) // nolint: errcheck
+			buffer.WriteString(m3uAttr(track.Tags[i]) + " ") // nolint: errcheck
 		}
 
 		uri, err := c.replaceURL(track.URI, i-ret, xtream)
@@ -538,10 +696,7 @@ func (c *Config) replaceURL(uri string, trackIndex int, xtream bool) (string, er
 		return "", err
 	}
 
-	protocol := "http"
-	if c.HTTPS {
-		protocol = "https"
-	}
+	public := c.advertised()
 
 	customEnd := strings.Trim(c.CustomEndpoint, "/")
 	if customEnd != "" {
@@ -571,11 +726,10 @@ func (c *Config) replaceURL(uri string, trackIndex int, xtream bool) (string, er
 	}
 
 	newURI := fmt.Sprintf(
-		"%s://%s%s:%d%s%s",
-		protocol,
+		"%s://%s%s%s%s",
+		public.scheme,
 		basicAuth,
-		c.HostConfig.Hostname,
-		c.AdvertisedPort,
+		public.hostPort(),
 		customEnd,
 		uriPath,
 	)
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucasduport/stream-share/pkg/config"
+)
+
+func TestMaskedRequestPath(t *testing.T) {
+	tests := []struct {
+		name, target string
+		secrets      []string
+	}{
+		{"dashboard key", "/api/internal/admin/dashboard?key=s3cr3t-api-key", []string{"s3cr3t-api-key"}},
+		{"xtream credentials", "/player_api.php?username=alice-long-name&password=hunter2&action=get_live_streams", []string{"alice-long-name", "hunter2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+			ctx.Request = httptest.NewRequest("GET", tt.target, nil)
+			got := (&Config{ProxyConfig: &config.ProxyConfig{}}).maskedRequestPath(ctx)
+			for _, secret := range tt.secrets {
+				if strings.Contains(got, secret) {
+					t.Errorf("maskedRequestPath = %q, contains %q", got, secret)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// applySessionSettings configures the session manager from the environment.
+// It runs at startup and again on every reload, see reload.go; settings not
+// set keep their current value.
+func (c *Config) applySessionSettings() {
+	sm := c.sessionManager
+	if sm == nil {
+		return
+	}
+	if v := os.Getenv("SESSION_TIMEOUT_MINUTES"); v != "" {
+		if mins, err := strconv.Atoi(v); err == nil && mins > 0 {
+			sm.SetSessionTimeout(time.Duration(mins) * time.Minute)
+			utils.InfoLog("Session timeout set to %d minutes", mins)
+		} else {
+			utils.WarnLog("Invalid SESSION_TIMEOUT_MINUTES: %s", v)
+		}
+	}
+	if v := os.Getenv("STREAM_TIMEOUT_MINUTES"); v != "" {
+		if mins, err := strconv.Atoi(v); err == nil && mins > 0 {
+			sm.SetStreamTimeout(time.Duration(mins) * time.Minute)
+			utils.InfoLog("Stream timeout set to %d minutes", mins)
+		} else {
+			utils.WarnLog("Invalid STREAM_TIMEOUT_MINUTES: %s", v)
+		}
+	}
+	if v := os.Getenv("TEMP_LINK_CACHE_SIZE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			sm.SetMaxTempLinks(n)
+			utils.InfoLog("In-memory temporary link cache capped at %d entries", n)
+		} else {
+			utils.WarnLog("Invalid TEMP_LINK_CACHE_SIZE: %s", v)
+		}
+	}
+	if v := os.Getenv("CLIENT_STALL_TIMEOUT"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+			sm.SetClientStallTimeout(time.Duration(secs) * time.Second)
+			utils.InfoLog("Client stall timeout set to %d seconds", secs)
+		} else {
+			utils.WarnLog("Invalid CLIENT_STALL_TIMEOUT: %s", v)
+		}
+	}
+	if v := os.Getenv("UPSTREAM_READ_TIMEOUT"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+			sm.SetUpstreamReadTimeout(time.Duration(secs) * time.Second)
+			utils.InfoLog("Upstream read timeout set to %d seconds", secs)
+		} else {
+			utils.WarnLog("Invalid UPSTREAM_READ_TIMEOUT: %s", v)
+		}
+	}
+	if v := os.Getenv("STREAM_PREROLL_CHUNKS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			sm.SetJoinPreroll(n)
+			utils.InfoLog("Viewers joining a running stream start %d chunks behind live", n)
+		} else {
+			utils.WarnLog("Invalid STREAM_PREROLL_CHUNKS: %s", v)
+		}
+	}
+	if v := os.Getenv("MAX_VIEWERS_PER_STREAM"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			sm.SetMaxViewersPerStream(n)
+			utils.InfoLog("Streams are capped at %d viewers (0 is unlimited)", n)
+		} else {
+			utils.WarnLog("Invalid MAX_VIEWERS_PER_STREAM: %s", v)
+		}
+	}
+	if v := os.Getenv("STREAM_LINGER_SECONDS"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+			sm.SetStreamLinger(time.Duration(secs) * time.Second)
+			utils.InfoLog("Streams outlive their last viewer by %d seconds", secs)
+		} else {
+			utils.WarnLog("Invalid STREAM_LINGER_SECONDS: %s", v)
+		}
+	}
+	// Per-stream delivery counters (blocked sends, drops, stalls); a reload
+	// may also turn them off
+	quality, persist := envFlag("STREAM_QUALITY_METRICS", false), envFlag("STREAM_QUALITY_PERSIST", false)
+	sm.SetQualityMetrics(quality, persist)
+	if quality {
+		utils.InfoLog("Stream quality metrics enabled (persist=%v)", persist)
+	}
+	// Buffer preset first; STREAM_RING_CHUNKS and STREAM_CHUNK_KB refine it
+	if v := os.Getenv("MEMORY_PROFILE"); v != "" {
+		if err := sm.SetMemoryProfile(v); err == nil {
+			utils.InfoLog("Stream buffers use the %s memory profile", strings.ToLower(strings.TrimSpace(v)))
+		} else {
+			utils.WarnLog("Invalid MEMORY_PROFILE: %v", err)
+		}
+	}
+	// Ring geometry per stream type, e.g. STREAM_RING_CHUNKS=live:256,movie:128
+	if v := os.Getenv("STREAM_RING_CHUNKS"); v != "" {
+		if sizes, err := parseStreamTypeSizes(v); err == nil {
+			// The catch-all entry first so per-type values win
+			if n, ok := sizes[""]; ok {
+				sm.SetBufferSize("", n, 0)
+			}
+			for typ, n := range sizes {
+				if typ != "" {
+					sm.SetBufferSize(typ, n, 0)
+				}
+			}
+			utils.InfoLog("Stream ring capacity set from STREAM_RING_CHUNKS=%s", v)
+		} else {
+			utils.WarnLog("Invalid STREAM_RING_CHUNKS: %s (%v)", v, err)
+		}
+	}
+	if v := os.Getenv("STREAM_CHUNK_KB"); v != "" {
+		if sizes, err := parseStreamTypeSizes(v); err == nil {
+			if kb, ok := sizes[""]; ok {
+				sm.SetBufferSize("", 0, kb*1024)
+			}
+			for typ, kb := range sizes {
+				if typ != "" {
+					sm.SetBufferSize(typ, 0, kb*1024)
+				}
+			}
+			utils.InfoLog("Stream chunk size set from STREAM_CHUNK_KB=%s", v)
+		} else {
+			utils.WarnLog("Invalid STREAM_CHUNK_KB: %s (%v)", v, err)
+		}
+	}
+	if v := os.Getenv("TEMP_LINK_HOURS"); v != "" {
+		if hours, err := strconv.Atoi(v); err == nil && hours > 0 {
+			sm.SetTempLinkTimeout(time.Duration(hours) * time.Hour)
+			utils.InfoLog("Temporary link timeout set to %d hours", hours)
+		} else {
+			utils.WarnLog("Invalid TEMP_LINK_HOURS: %s", v)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// streamIDPattern accepts provider stream ids (digits with an optional
+// container extension) and our own ids such as recordings: letters, digits
+// and . _ -, starting with a letter or digit, at most 128 characters.
+var streamIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,127}$`)
+
+// streamIDPolicy reads STREAM_ID_POLICY: "reject" (default) answers 400 to ids
+// with other characters, "sanitize" drops those characters, "off" accepts ids
+// as they come.
+func streamIDPolicy() string {
+	switch v := strings.ToLower(strings.TrimSpace(os.Getenv("STREAM_ID_POLICY"))); v {
+	case "", "reject":
+		return "reject"
+	case "sanitize", "off":
+		return v
+	default:
+		utils.WarnLog("Invalid STREAM_ID_POLICY: %s", v)
+		return "reject"
+	}
+}
+
+// safeStreamID reports whether id can go into upstream URLs and cache file
+// names as is: no path separators, no "..".
+func safeStreamID(id string) bool {
+	return streamIDPattern.MatchString(id) && !strings.Contains(id, "..")
+}
+
+// cleanStreamID applies the STREAM_ID_POLICY to id and returns the id to use,
+// or false when it must be rejected.
+func cleanStreamID(id string) (string, bool) {
+	policy := streamIDPolicy()
+	if policy == "off" || safeStreamID(id) {
+		return id, true
+	}
+	if policy != "sanitize" {
+		return "", false
+	}
+	s := strings.Map(func(r rune) rune {
+		if r < 0x80 && (r == '.' || r == '_' || r == '-' || r >= '0' && r <= '9' || r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z') {
+			return r
+		}
+		return -1
+	}, id)
+	for strings.Contains(s, "..") {
+		s = strings.ReplaceAll(s, "..", ".")
+	}
+	s = strings.TrimLeft(s, "._-")
+	if len(s) > 128 {
+		s = s[:128]
+	}
+	return s, safeStreamID(s)
+}
+
+// cleanStreamIDs applies cleanStreamID to ids taken from a request body, in
+// place. It returns false as soon as one must be rejected.
+func cleanStreamIDs(ids []string) bool {
+	for i, id := range ids {
+		clean, ok := cleanStreamID(id)
+		if !ok {
+			utils.WarnLog("Rejected stream id %q", id)
+			return false
+		}
+		ids[i] = clean
+	}
+	return true
+}
+
+// validateStreamIDs is route middleware applying the STREAM_ID_POLICY to the
+// named path params before the handler sees them.
+func validateStreamIDs(params ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		for _, name := range params {
+			for i := range ctx.Params {
+				if ctx.Params[i].Key != name {
+					continue
+				}
+				id, ok := cleanStreamID(ctx.Params[i].Value)
+				if !ok {
+					reqLog(ctx).WarnLog("Rejected %s %q from %s", name, ctx.Params[i].Value, ctx.ClientIP())
+					abortJSON(ctx, http.StatusBadRequest, errCodeInvalidParameter, "invalid "+name)
+					return
+				}
+				ctx.Params[i].Value = id
+			}
+		}
+		ctx.Next()
+	}
+}
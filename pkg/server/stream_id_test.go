@@ -0,0 +1,78 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+var streamIDPolicyTests = []struct {
+	policy, id string
+	want       string // "" when the id is rejected
+}{
+	{"reject", "12345", "12345"},
+	{"reject", "12345.mkv", "12345.mkv"},
+	{"reject", "rec_abc-1", "rec_abc-1"},
+	{"reject", "../../etc/passwd", ""},
+	{"reject", "..", ""},
+	{"reject", "12..34", ""},
+	{"reject", "12/34", ""},
+	{"reject", `12\34`, ""},
+	{"reject", "12 34", ""},
+	{"sanitize", "12345.mp4", "12345.mp4"},
+	{"sanitize", "../../etc/passwd", "etcpasswd"},
+	{"sanitize", "12/../34.ts", "12.34.ts"},
+	{"sanitize", "..", ""},
+	{"sanitize", "/", ""},
+	{"sanitize", "12%2F34", "122F34"},
+	{"off", "../../etc/passwd", "../../etc/passwd"},
+	{"off", "12345", "12345"},
+	{"", "../x", ""}, // reject is the default
+	{"bogus", "../x", ""},
+}
+
+func TestValidateStreamIDs(t *testing.T) {
+	for _, tt := range streamIDPolicyTests {
+		t.Run(tt.policy+"/"+tt.id, func(t *testing.T) {
+			t.Setenv("STREAM_ID_POLICY", tt.policy)
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			ctx.Request = httptest.NewRequest("GET", "/movie/u/p/x", nil)
+			ctx.Params = gin.Params{{Key: "id", Value: tt.id}, {Key: "other", Value: "../kept"}}
+			validateStreamIDs("id")(ctx)
+
+			if tt.want == "" {
+				if !ctx.IsAborted() || w.Code != 400 {
+					t.Errorf("not rejected: aborted=%v status=%d id=%q", ctx.IsAborted(), w.Code, ctx.Param("id"))
+				}
+				return
+			}
+			if ctx.IsAborted() {
+				t.Fatalf("rejected with status %d", w.Code)
+			}
+			if got := ctx.Param("id"); got != tt.want {
+				t.Errorf("id = %q, want %q", got, tt.want)
+			}
+			if got := ctx.Param("other"); got != "../kept" {
+				t.Errorf("unlisted param changed to %q", got)
+			}
+		})
+	}
+}
+
+func TestCleanStreamIDs(t *testing.T) {
+	for _, tt := range streamIDPolicyTests {
+		t.Run(tt.policy+"/"+tt.id, func(t *testing.T) {
+			t.Setenv("STREAM_ID_POLICY", tt.policy)
+			ids := []string{"100", tt.id}
+			ok := cleanStreamIDs(ids)
+			if ok != (tt.want != "") {
+				t.Fatalf("cleanStreamIDs = %v, want %v", ok, tt.want != "")
+			}
+			if ok && (ids[0] != "100" || ids[1] != tt.want) {
+				t.Errorf("ids = %q, want [100 %s]", ids, tt.want)
+			}
+		})
+	}
+}
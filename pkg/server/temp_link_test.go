@@ -0,0 +1,120 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucasduport/stream-share/pkg/config"
+	"github.com/lucasduport/stream-share/pkg/session"
+	"github.com/lucasduport/stream-share/pkg/types"
+)
+
+// tempLinkFile writes a 1000 byte file whose bytes all differ from their
+// neighbours, so a misplaced range shows in the body.
+func tempLinkFile(t *testing.T) (string, []byte) {
+	t.Helper()
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	p := filepath.Join(t.TempDir(), "movie.mkv")
+	if err := os.WriteFile(p, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return p, data
+}
+
+// getTempLink requests a temporary link with an optional Range header.
+func getTempLink(c *Config, token, rangeHdr string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Request = httptest.NewRequest(http.MethodGet, "/download/"+token, nil)
+	if rangeHdr != "" {
+		ctx.Request.Header.Set("Range", rangeHdr)
+	}
+	ctx.Params = gin.Params{{Key: "token", Value: token}}
+	c.handleTemporaryLink(ctx)
+	return w
+}
+
+func checkRange(t *testing.T, w *httptest.ResponseRecorder, data []byte) {
+	t.Helper()
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("status = %d, want 206", w.Code)
+	}
+	want := "bytes 100-199/" + strconv.Itoa(len(data))
+	if got := w.Header().Get("Content-Range"); got != want {
+		t.Errorf("Content-Range = %q, want %q", got, want)
+	}
+	if got := w.Header().Get("Accept-Ranges"); got != "bytes" {
+		t.Errorf("Accept-Ranges = %q, want bytes", got)
+	}
+	if got := w.Header().Get("Content-Disposition"); got != `attachment; filename="Heat.mkv"` {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+	if !bytes.Equal(w.Body.Bytes(), data[100:200]) {
+		t.Errorf("body is %d bytes, not bytes 100-199 of the file", w.Body.Len())
+	}
+}
+
+// TestTemporaryLinkRangeLocal resumes a download from a temporary link whose
+// movie is in the local cache.
+func TestTemporaryLinkRangeLocal(t *testing.T) {
+	db := testDB(t)
+	file, data := tempLinkFile(t)
+	id := "t1541" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	now := time.Now()
+	if err := db.UpsertVODCache(&types.VODCacheEntry{
+		StreamID: id, Type: "movie", Title: "Heat", FilePath: file, Status: "ready",
+		SizeBytes: int64(len(data)), CreatedAt: now, ExpiresAt: now.Add(time.Hour), LastAccess: now,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.DeleteVODCache(db.Provider(), id) }) // nolint: errcheck
+
+	sm := session.NewSessionManager(db)
+	// The upstream is never reached while the file is cached
+	token, err := sm.GenerateTemporaryLink("alice", id, "Heat", "http://127.0.0.1:1/movie/u/p/"+id+".mkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Config{ProxyConfig: &config.ProxyConfig{}, db: db, sessionManager: sm}
+
+	checkRange(t, getTempLink(c, token, "bytes=100-199"), data)
+
+	w := getTempLink(c, token, "")
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), data) {
+		t.Errorf("full download: status %d, %d bytes", w.Code, w.Body.Len())
+	}
+}
+
+// TestTemporaryLinkRangeUpstream checks the client's Range reaches the
+// provider when the movie is not cached, and the partial answer is kept.
+func TestTemporaryLinkRangeUpstream(t *testing.T) {
+	file, data := tempLinkFile(t)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, file)
+	}))
+	t.Cleanup(upstream.Close)
+
+	sm := session.NewSessionManager(nil)
+	token, err := sm.GenerateTemporaryLink("alice", "42", "Heat", upstream.URL+"/movie/u/p/42.mkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Config{ProxyConfig: &config.ProxyConfig{}, sessionManager: sm}
+
+	checkRange(t, getTempLink(c, token, "bytes=100-199"), data)
+
+	w := getTempLink(c, token, "")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Range") != "" || !bytes.Equal(w.Body.Bytes(), data) {
+		t.Errorf("full download: status %d, Content-Range %q, %d bytes", w.Code, w.Header().Get("Content-Range"), w.Body.Len())
+	}
+}
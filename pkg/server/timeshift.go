@@ -0,0 +1,284 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucasduport/stream-share/pkg/utils"
+	xtreamapi "github.com/lucasduport/stream-share/pkg/xtream"
+)
+
+// timeshiftStartLayout is the Xtream catch-up start format (e.g. 2025-01-31:20-30).
+const timeshiftStartLayout = "2006-01-02:15-04"
+
+// archiveWindow describes how far back a live channel can be replayed.
+// An enabled window with zero days means the length is unknown.
+type archiveWindow struct {
+	Enabled bool
+	Days    int
+}
+
+var (
+	archiveWindows      = map[string]archiveWindow{}
+	archiveWindowsAt    time.Time
+	archiveWindowsErr   error
+	archiveWindowsErrAt time.Time
+	archiveWindowsLock  sync.RWMutex
+	archiveWindowsTTL   = 15 * time.Minute
+	// archiveWindowsRetry is how long a failed refresh is remembered before
+	// get_live_streams is asked again.
+	archiveWindowsRetry = time.Minute
+)
+
+// archiveFlights runs one get_live_streams refresh at a time for all the
+// listings and timeshift requests that find the table stale.
+var archiveFlights flightGroup
+
+// channelArchiveWindow returns the advertised archive window for a live stream,
+// refreshing the per-channel table from get_live_streams when it is stale.
+// When the refresh fails the previous table keeps being served.
+func (c *Config) channelArchiveWindow(streamID string) (archiveWindow, error) {
+	streamID = normalizeStreamID(streamID)
+
+	if err := c.refreshArchiveWindows(); err != nil {
+		archiveWindowsLock.RLock()
+		loaded := !archiveWindowsAt.IsZero()
+		archiveWindowsLock.RUnlock()
+		if !loaded {
+			return archiveWindow{}, err
+		}
+		utils.DebugLog("Timeshift: serving stale archive windows: %v", err)
+	}
+
+	archiveWindowsLock.RLock()
+	w, ok := archiveWindows[streamID]
+	archiveWindowsLock.RUnlock()
+	if !ok {
+		return w, fmt.Errorf("unknown live stream %s", streamID)
+	}
+	return w, nil
+}
+
+// archiveWindowsState reports whether the table is fresh, and the last refresh
+// error while it is still inside its retry delay.
+func archiveWindowsState() (fresh bool, err error) {
+	archiveWindowsLock.RLock()
+	defer archiveWindowsLock.RUnlock()
+	if time.Since(archiveWindowsAt) < archiveWindowsTTL {
+		return true, nil
+	}
+	if archiveWindowsErr != nil && time.Since(archiveWindowsErrAt) < archiveWindowsRetry {
+		return false, archiveWindowsErr
+	}
+	return false, nil
+}
+
+// refreshArchiveWindows reloads the table once it is older than
+// archiveWindowsTTL, unless the last attempt failed less than
+// archiveWindowsRetry ago, in which case that error is returned.
+func (c *Config) refreshArchiveWindows() error {
+	if fresh, err := archiveWindowsState(); fresh || err != nil {
+		return err
+	}
+	return archiveFlights.do("get_live_streams", func() error {
+		// A refresh that finished while this one was being started already answered
+		if fresh, err := archiveWindowsState(); fresh || err != nil {
+			return err
+		}
+		table, err := c.fetchArchiveWindows()
+		archiveWindowsLock.Lock()
+		defer archiveWindowsLock.Unlock()
+		if err != nil {
+			archiveWindowsErr, archiveWindowsErrAt = err, time.Now()
+			return err
+		}
+		archiveWindows, archiveWindowsAt, archiveWindowsErr = table, time.Now(), nil
+		utils.DebugLog("Timeshift: refreshed archive windows for %d channels", len(table))
+		return nil
+	})
+}
+
+// fetchArchiveWindows builds the per-channel archive table from get_live_streams.
+func (c *Config) fetchArchiveWindows() (map[string]archiveWindow, error) {
+	cli, err := xtreamapi.New(c.XtreamUser.String(), c.XtreamPassword.String(), c.XtreamBaseURL, utils.UserAgentFor(c.XtreamBaseURL))
+	if err != nil {
+		return nil, err
+	}
+	resp, httpcode, _, err := cli.Action(c.ProxyConfig, "get_live_streams", url.Values{})
+	if err != nil {
+		utils.WarnLog("Timeshift: get_live_streams failed (HTTP %d): %v", httpcode, err)
+		return nil, err
+	}
+	arr, isArr := resp.([]interface{})
+	if !isArr {
+		return nil, fmt.Errorf("unexpected get_live_streams format: %T", resp)
+	}
+
+	table := make(map[string]archiveWindow, len(arr))
+	for _, it := range arr {
+		m, isMap := it.(map[string]interface{})
+		if !isMap {
+			continue
+		}
+		id := fmt.Sprintf("%v", m["stream_id"])
+		if id == "" || id == "<nil>" {
+			continue
+		}
+		table[id] = archiveWindow{Enabled: toInt(m["tv_archive"]) == 1, Days: toInt(m["tv_archive_duration"])}
+	}
+	return table, nil
+}
+
+// parseTimeshiftStart accepts the Xtream start layout or a unix timestamp.
+func parseTimeshiftStart(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil && n > 0 {
+		return time.Unix(n, 0), nil
+	}
+	t, err := time.ParseInLocation(timeshiftStartLayout, s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("start must be %q or a unix timestamp", "YYYY-MM-DD:HH-MM")
+	}
+	return t, nil
+}
+
+// validateTimeshift checks duration (minutes) and start against the channel's
+// archive window, clamping the duration so the request stays inside it.
+func validateTimeshift(durationRaw, startRaw string, w archiveWindow) (int, time.Time, error) {
+	duration, err := strconv.Atoi(strings.TrimSpace(durationRaw))
+	if err != nil || duration <= 0 {
+		return 0, time.Time{}, fmt.Errorf("duration must be a positive number of minutes")
+	}
+	start, err := parseTimeshiftStart(startRaw)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	if !w.Enabled {
+		return 0, time.Time{}, fmt.Errorf("this channel has no catch-up archive")
+	}
+
+	now := time.Now()
+	if !start.Before(now) {
+		return 0, time.Time{}, fmt.Errorf("start must be in the past")
+	}
+	if w.Days > 0 {
+		if start.Before(now.Add(-time.Duration(w.Days) * 24 * time.Hour)) {
+			return 0, time.Time{}, fmt.Errorf("start is outside the %d day archive", w.Days)
+		}
+		if maxMinutes := w.Days * 24 * 60; duration > maxMinutes {
+			duration = maxMinutes
+		}
+	}
+	if maxMinutes := int(now.Sub(start).Minutes()); duration > maxMinutes {
+		duration = maxMinutes
+	}
+	if duration <= 0 {
+		duration = 1
+	}
+	return duration, start, nil
+}
+
+// publicBaseURL is the externally reachable root of this proxy, including the custom endpoint.
+func (c *Config) publicBaseURL() string {
+	e := c.advertised()
+	customEnd := strings.Trim(c.CustomEndpoint, "/")
+	if customEnd != "" {
+		customEnd = "/" + customEnd
+	}
+	return fmt.Sprintf("%s://%s%s", e.scheme, e.hostPort(), customEnd)
+}
+
+// buildTimeshiftURL returns a proxy timeshift URL for the given program window.
+func (c *Config) buildTimeshiftURL(streamID string, start time.Time, durationMinutes int) string {
+	return fmt.Sprintf("%s/timeshift/%s/%s/%d/%s/%s.ts",
+		c.publicBaseURL(),
+		c.User.PathEscape(), c.Password.PathEscape(),
+		durationMinutes, start.Format(timeshiftStartLayout), normalizeStreamID(streamID))
+}
+
+// timeshiftUpstreamURL validates the timeshift path params and returns the
+// upstream URL. On malformed input it answers 400 and returns nil.
+func (c *Config) timeshiftUpstreamURL(ctx *gin.Context) *url.URL {
+	id := ctx.Param("id")
+	w, err := c.channelArchiveWindow(id)
+	if err != nil {
+		// Archive length unknown: still validate the params but skip clamping
+		reqLog(ctx).DebugLog("Timeshift: archive lookup failed for %s: %v", id, err)
+		w = archiveWindow{Enabled: true}
+	}
+	duration, start, err := validateTimeshift(ctx.Param("duration"), ctx.Param("start"), w)
+	if err != nil {
+		abortJSON(ctx, http.StatusBadRequest, errCodeInvalidParameter, "Invalid timeshift request: "+err.Error())
+		return nil
+	}
+	rpURL, err := url.Parse(fmt.Sprintf("%s/timeshift/%s/%s/%d/%s/%s", c.XtreamBaseURL, c.XtreamUser, c.XtreamPassword, duration, start.Format(timeshiftStartLayout), id))
+	if err != nil {
+		abortError(ctx, http.StatusInternalServerError, errCodeInternal, "Could not build upstream URL", err)
+		return nil
+	}
+	return rpURL
+}
+
+// decorateSimpleDataTable adds the channel archive window and a ready-to-use
+// timeshift_url on every listing that has an archive.
+func (c *Config) decorateSimpleDataTable(resp interface{}, streamID string) interface{} {
+	m, ok := resp.(map[string]interface{})
+	if !ok || strings.TrimSpace(streamID) == "" || len(m) == 0 {
+		return resp
+	}
+	w, err := c.channelArchiveWindow(streamID)
+	if err != nil {
+		utils.DebugLog("Timeshift: no archive info for %s: %v", streamID, err)
+		return resp
+	}
+	archive := map[string]interface{}{"tv_archive": 0, "tv_archive_duration": w.Days}
+	if w.Enabled && w.Days > 0 {
+		archive["tv_archive"] = 1
+		archive["archive_start"] = time.Now().Add(-time.Duration(w.Days) * 24 * time.Hour).Unix()
+		archive["archive_end"] = time.Now().Unix()
+	}
+	m["archive"] = archive
+
+	listings, _ := m["epg_listings"].([]interface{})
+	for _, it := range listings {
+		l, ok := it.(map[string]interface{})
+		if !ok || toInt(l["has_archive"]) != 1 {
+			continue
+		}
+		startTS, err1 := parseInt64(fmt.Sprintf("%v", l["start_timestamp"]))
+		stopTS, err2 := parseInt64(fmt.Sprintf("%v", l["stop_timestamp"]))
+		if err1 != nil || err2 != nil || stopTS <= startTS {
+			continue
+		}
+		duration, start, err := validateTimeshift(strconv.FormatInt((stopTS-startTS+59)/60, 10), strconv.FormatInt(startTS, 10), w)
+		if err != nil {
+			continue
+		}
+		l["timeshift_url"] = c.buildTimeshiftURL(streamID, start, duration)
+	}
+	return m
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lucasduport/stream-share/pkg/config"
+)
+
+// resetArchiveWindows empties the archive table for the test and restores it afterwards.
+func resetArchiveWindows(t *testing.T) {
+	archiveWindowsLock.Lock()
+	table, at, err, errAt := archiveWindows, archiveWindowsAt, archiveWindowsErr, archiveWindowsErrAt
+	archiveWindows, archiveWindowsAt, archiveWindowsErr, archiveWindowsErrAt = map[string]archiveWindow{}, time.Time{}, nil, time.Time{}
+	archiveWindowsLock.Unlock()
+	t.Cleanup(func() {
+		archiveWindowsLock.Lock()
+		archiveWindows, archiveWindowsAt, archiveWindowsErr, archiveWindowsErrAt = table, at, err, errAt
+		archiveWindowsLock.Unlock()
+	})
+}
+
+func TestChannelArchiveWindowRefresh(t *testing.T) {
+	t.Setenv("API_CACHE_SECONDS", "0")
+	resetArchiveWindows(t)
+
+	var hits atomic.Int32
+	var down atomic.Bool
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if down.Load() {
+			http.Error(w, "maintenance", http.StatusServiceUnavailable)
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte(`[{"stream_id":5,"tv_archive":1,"tv_archive_duration":3},{"stream_id":6,"tv_archive":0}]`)) // nolint: errcheck
+	}))
+	defer upstream.Close()
+	c := &Config{ProxyConfig: &config.ProxyConfig{XtreamBaseURL: upstream.URL, XtreamUser: "u", XtreamPassword: "p"}}
+
+	// Without a table an outage is an error
+	down.Store(true)
+	if _, err := c.channelArchiveWindow("5"); err == nil {
+		t.Fatal("no error without an archive table")
+	}
+	before := hits.Load()
+	if _, err := c.channelArchiveWindow("5"); err == nil {
+		t.Fatal("no error while backing off")
+	}
+	if hits.Load() != before {
+		t.Error("get_live_streams retried before archiveWindowsRetry")
+	}
+
+	// Concurrent lookups share one refresh
+	down.Store(false)
+	archiveWindowsLock.Lock()
+	archiveWindowsErrAt = time.Now().Add(-archiveWindowsRetry)
+	archiveWindowsLock.Unlock()
+	hits.Store(0)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if w, err := c.channelArchiveWindow("5"); err != nil || w != (archiveWindow{Enabled: true, Days: 3}) {
+				t.Errorf("channelArchiveWindow(5) = %+v, %v", w, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := hits.Load(); n != 1 {
+		t.Errorf("%d get_live_streams requests for 10 concurrent lookups, want 1", n)
+	}
+
+	// A failed refresh of a stale table keeps serving it and backs off
+	down.Store(true)
+	archiveWindowsLock.Lock()
+	archiveWindowsAt = time.Now().Add(-archiveWindowsTTL)
+	archiveWindowsLock.Unlock()
+	hits.Store(0)
+	for i := 0; i < 3; i++ {
+		if w, err := c.channelArchiveWindow("5"); err != nil || w.Days != 3 {
+			t.Errorf("stale lookup %d = %+v, %v, want the previous window", i, w, err)
+		}
+		if _, err := c.channelArchiveWindow("99"); err == nil {
+			t.Error("unknown channel found in the stale table")
+		}
+	}
+	failed := hits.Load()
+	if failed == 0 {
+		t.Fatal("stale table not refreshed")
+	}
+	if _, err := c.channelArchiveWindow("5"); err != nil || hits.Load() != failed {
+		t.Errorf("lookup during the retry delay: err %v, %d new requests", err, hits.Load()-failed)
+	}
+
+	// Once the delay is over the refresh is tried again
+	down.Store(false)
+	archiveWindowsLock.Lock()
+	archiveWindowsErrAt = time.Now().Add(-archiveWindowsRetry)
+	archiveWindowsLock.Unlock()
+	if w, err := c.channelArchiveWindow("6"); err != nil || w.Enabled {
+		t.Errorf("channelArchiveWindow(6) = %+v, %v", w, err)
+	}
+	if hits.Load() != failed+1 {
+		t.Errorf("%d requests after the retry delay, want 1", hits.Load()-failed)
+	}
+}
@@ -0,0 +1,101 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// defaultTitleStripRules remove the branding providers put around titles:
+// "|FR| " country tags, "[VIP]"-style brackets, leading decorations and a
+// trailing quality marker.
+var defaultTitleStripRules = []string{
+	`^\s*\|[A-Za-z0-9]{2,4}\|\s*`,
+	`\s*\[(?i:vip|hd|fhd|uhd|4k|sd|hevc|multi[- ]?subs?|vostfr|vip ?hd)\]\s*`,
+	`^[\s★☆◉●•▶►]+`,
+	`\s+(?:FHD|UHD|HEVC)$`,
+}
+
+// titleStripRules is a compiled rule set. Its zero value strips nothing.
+type titleStripRules []*regexp.Regexp
+
+var (
+	titleRulesMu   sync.Mutex
+	titleRulesEnv  string
+	titleRulesLast titleStripRules
+	titleRulesInit bool
+)
+
+// loadTitleStripRules returns the rules from TITLE_STRIP_RULES: regular
+// expressions separated by ";;" or new lines, whose matches are removed from
+// titles. Unset uses defaultTitleStripRules, "off" disables stripping. The
+// compiled set is reused until the variable changes.
+func loadTitleStripRules() titleStripRules {
+	env := os.Getenv("TITLE_STRIP_RULES")
+	titleRulesMu.Lock()
+	defer titleRulesMu.Unlock()
+	if titleRulesInit && env == titleRulesEnv {
+		return titleRulesLast
+	}
+
+	exprs := defaultTitleStripRules
+	switch v := strings.TrimSpace(env); strings.ToLower(v) {
+	case "":
+	case "off", "none", "false", "0":
+		exprs = nil
+	default:
+		exprs = strings.FieldsFunc(strings.ReplaceAll(v, ";;", "\n"), func(r rune) bool { return r == '\n' })
+	}
+	var rules titleStripRules
+	for _, expr := range exprs {
+		if expr = strings.TrimSpace(expr); expr == "" {
+			continue
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			utils.WarnLog("Invalid TITLE_STRIP_RULES entry %q: %v", expr, err)
+			continue
+		}
+		rules = append(rules, re)
+	}
+	titleRulesEnv, titleRulesLast, titleRulesInit = env, rules, true
+	return rules
+}
+
+// clean returns title without the parts the rules match and with its spaces
+// collapsed. A title the rules would empty is returned unchanged.
+func (rules titleStripRules) clean(title string) string {
+	if len(rules) == 0 {
+		return title
+	}
+	out := title
+	for _, re := range rules {
+		out = re.ReplaceAllString(out, " ")
+	}
+	out = strings.Join(strings.Fields(out), " ")
+	if out == "" {
+		return title
+	}
+	return out
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTitleStripRules(t *testing.T) {
+	tests := []struct {
+		name, env, title, want string
+	}{
+		{"country tag", "", "|FR| Le Dîner de cons", "Le Dîner de cons"},
+		{"country tag without space", "", "|UK|The Office", "The Office"},
+		{"bracket tag prefix", "", "[VIP] The Matrix", "The Matrix"},
+		{"bracket tag suffix", "", "The Matrix [FHD]", "The Matrix"},
+		{"several tags", "", "|EN| [VIP HD] Dune [MULTI-SUB]", "Dune"},
+		{"decorations", "", "★★ Heat", "Heat"},
+		{"quality suffix", "", "Planet Earth II UHD", "Planet Earth II"},
+		{"quality word inside kept", "", "HEVC Explained", "HEVC Explained"},
+		{"year and pipes kept", "", "Heat (1995) | Director's Cut", "Heat (1995) | Director's Cut"},
+		{"never emptied", "", "[VIP]", "[VIP]"},
+		{"stripping off", "off", "|FR| [VIP] Heat", "|FR| [VIP] Heat"},
+		{"custom rules", `^VOD - ;;\s+\(MULTI\)$`, "VOD - Heat (MULTI)", "Heat"},
+		{"custom rules replace the defaults", `^VOD - `, "|FR| Heat", "|FR| Heat"},
+		{"invalid rule skipped", "(unclosed;;^VOD - ", "VOD - Heat", "Heat"},
+	}
+	for _, tt := range tests {
+		t.Setenv("TITLE_STRIP_RULES", tt.env)
+		if got := loadTitleStripRules().clean(tt.title); got != tt.want {
+			t.Errorf("%s: clean(%q) = %q, want %q", tt.name, tt.title, got, tt.want)
+		}
+	}
+}
+
+// TestSearchStripsTitles checks search results show the stripped title and
+// keep the provider's for stream-ID resolution.
+func TestSearchStripsTitles(t *testing.T) {
+	t.Setenv("TITLE_STRIP_RULES", "")
+	t.Setenv("VOD_MULTIPART", "")
+	m3u := `#EXTM3U
+#EXTINF:-1 group-title="Movies",|FR| [VIP] Heat
+http://provider/movie/u/p/1.mp4
+#EXTINF:-1 group-title="Series",|EN| Dark S02E03
+http://provider/series/u/p/10.mkv
+`
+	path := filepath.Join(t.TempDir(), "vod.m3u")
+	if err := os.WriteFile(path, []byte(m3u), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	movies, err := searchVODInM3UFile(path, "heat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(movies) != 1 || movies[0].Title != "Heat" || movies[0].RawTitle != "|FR| [VIP] Heat" {
+		t.Errorf("movies = %+v", movies)
+	}
+
+	series, err := searchSeriesInM3UFile(path, "dark s02e03")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series) != 1 || series[0].Title != "Dark S02E03" || series[0].SeriesTitle != "Dark" || series[0].RawTitle != "|EN| Dark S02E03" {
+		t.Errorf("series = %+v", series)
+	}
+}
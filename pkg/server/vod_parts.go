@@ -0,0 +1,144 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/lucasduport/stream-share/pkg/types"
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// defaultMultiPartRegex matches a trailing "CD1", "Part 2", "pt.3", "(Disc 1)"
+// marker. The first capture group must hold the part number.
+const defaultMultiPartRegex = `(?i)[\s._-]*[\[(]?\s*(?:cd|part|pt|disc|disk)[\s._-]*(\d{1,2})\s*[\])]?\s*$`
+
+var (
+	multiPartOnce sync.Once
+	multiPartRe   *regexp.Regexp
+)
+
+// multiPartPattern returns the compiled VOD_MULTIPART_REGEX, or nil when
+// grouping is disabled with VOD_MULTIPART=false.
+func multiPartPattern() *regexp.Regexp {
+	multiPartOnce.Do(func() {
+		if !envFlag("VOD_MULTIPART", true) {
+			return
+		}
+		expr := defaultMultiPartRegex
+		if v := strings.TrimSpace(os.Getenv("VOD_MULTIPART_REGEX")); v != "" {
+			if re, err := regexp.Compile(v); err == nil && re.NumSubexp() >= 1 {
+				expr = v
+			} else {
+				utils.WarnLog("Invalid VOD_MULTIPART_REGEX (needs one capture group for the part number): %s", v)
+			}
+		}
+		multiPartRe = regexp.MustCompile(expr)
+	})
+	return multiPartRe
+}
+
+// splitPartTitle returns the title without its part marker and the part number.
+func splitPartTitle(re *regexp.Regexp, title string) (string, int, bool) {
+	loc := re.FindStringSubmatchIndex(title)
+	if loc == nil || loc[2] < 0 {
+		return title, 0, false
+	}
+	n, err := strconv.Atoi(title[loc[2]:loc[3]])
+	if err != nil || n <= 0 {
+		return title, 0, false
+	}
+	base := strings.TrimRight(strings.TrimSpace(title[:loc[0]]), "-–—:,")
+	if base == "" {
+		return title, 0, false
+	}
+	return strings.TrimSpace(base), n, true
+}
+
+// groupMultiPartResults merges movie results that are parts of the same title
+// into one result listing its parts in order. A lone "Part 1" stays as is.
+func groupMultiPartResults(results []types.VODResult) []types.VODResult {
+	re := multiPartPattern()
+	if re == nil || len(results) < 2 {
+		return results
+	}
+
+	type group struct {
+		first int // index of the earliest result, where the merged one goes
+		base  string
+		parts []types.VODPart
+	}
+	groups := make(map[string]*group)
+	for i, r := range results {
+		if r.StreamType != "movie" {
+			continue
+		}
+		base, n, ok := splitPartTitle(re, r.Title)
+		if !ok {
+			continue
+		}
+		key := strings.ToLower(base) + "\x00" + strings.ToLower(r.Category)
+		g, exists := groups[key]
+		if !exists {
+			g = &group{first: i, base: base}
+			groups[key] = g
+		}
+		g.parts = append(g.parts, types.VODPart{Part: n, StreamID: r.StreamID, Title: r.Title})
+	}
+
+	merged := make(map[int]*group)
+	member := make(map[string]bool)
+	for _, g := range groups {
+		if len(g.parts) < 2 {
+			continue
+		}
+		sort.SliceStable(g.parts, func(i, j int) bool { return g.parts[i].Part < g.parts[j].Part })
+		merged[g.first] = g
+		for _, p := range g.parts {
+			member[p.StreamID] = true
+		}
+	}
+	if len(merged) == 0 {
+		return results
+	}
+
+	out := make([]types.VODResult, 0, len(results))
+	for i, r := range results {
+		if g, ok := merged[i]; ok {
+			r.Title = g.base
+			r.ID = g.parts[0].StreamID
+			r.StreamID = g.parts[0].StreamID
+			r.Parts = g.parts
+			r.SizeBytes, r.Size = 0, ""
+			out = append(out, r)
+			continue
+		}
+		if r.StreamType == "movie" && member[r.StreamID] {
+			continue
+		}
+		out = append(out, r)
+	}
+	utils.DebugLog("VOD search: grouped multi-part movies: %d -> %d results", len(results), len(out))
+	return out
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestSplitPartTitle(t *testing.T) {
+	re := regexp.MustCompile(defaultMultiPartRegex)
+	tests := []struct {
+		title, wantBase string
+		wantPart        int
+		wantOK          bool
+	}{
+		{"Heat Part 1", "Heat", 1, true},
+		{"Heat - Part 2", "Heat", 2, true},
+		{"Heat CD2", "Heat", 2, true},
+		{"Heat (Disc 3)", "Heat", 3, true},
+		{"Heat pt.4", "Heat", 4, true},
+		{"Heat [cd 1]", "Heat", 1, true},
+		{"Heat", "Heat", 0, false},
+		{"Part 1", "Part 1", 0, false},
+		{"Heat Part 0", "Heat Part 0", 0, false},
+		{"Heat Part 2 Extended", "Heat Part 2 Extended", 0, false},
+	}
+	for _, tt := range tests {
+		base, n, ok := splitPartTitle(re, tt.title)
+		if base != tt.wantBase || n != tt.wantPart || ok != tt.wantOK {
+			t.Errorf("splitPartTitle(%q) = (%q, %d, %v), want (%q, %d, %v)", tt.title, base, n, ok, tt.wantBase, tt.wantPart, tt.wantOK)
+		}
+	}
+}
+
+// TestSearchVODGroupsParts checks that Part 1/Part 2 entries found in the VOD
+// M3U come back as one result with the parts in playback order.
+func TestSearchVODGroupsParts(t *testing.T) {
+	t.Setenv("VOD_MULTIPART", "")
+	t.Setenv("VOD_SEARCH_FUZZY", "false")
+	m3u := `#EXTM3U
+#EXTINF:-1 group-title="Movies",Heat Part 2
+http://provider/movie/u/p/102.mp4
+#EXTINF:-1 group-title="Movies",Heat (1995)
+http://provider/movie/u/p/200.mp4
+#EXTINF:-1 group-title="Movies",Heat Part 1
+http://provider/movie/u/p/101.mp4
+#EXTINF:-1 group-title="Kids",Heat Part 1
+http://provider/movie/u/p/301.mp4
+`
+	path := filepath.Join(t.TempDir(), "vod.m3u")
+	if err := os.WriteFile(path, []byte(m3u), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := searchVODInM3UFile(path, "heat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var grouped, others int
+	for _, r := range results {
+		if len(r.Parts) == 0 {
+			others++
+			continue
+		}
+		grouped++
+		if r.Title != "Heat" || r.Category != "Movies" {
+			t.Errorf("grouped result = %q in %q, want Heat in Movies", r.Title, r.Category)
+		}
+		if len(r.Parts) != 2 || r.Parts[0].Part != 1 || r.Parts[0].StreamID != "101.mp4" || r.Parts[1].Part != 2 || r.Parts[1].StreamID != "102.mp4" {
+			t.Errorf("parts = %+v, want 101.mp4 then 102.mp4", r.Parts)
+		}
+		if r.StreamID != "101.mp4" {
+			t.Errorf("stream id = %q, want the first part", r.StreamID)
+		}
+	}
+	// "Heat (1995)" and the lone Kids "Heat Part 1" stay separate
+	if grouped != 1 || others != 2 {
+		t.Errorf("got %d grouped and %d other results, want 1 and 2: %+v", grouped, others, results)
+	}
+}
@@ -20,6 +20,7 @@ package server
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -62,29 +63,29 @@ func setCachedSize(streamID string, size int64) {
 }
 
 // searchXtreamVOD searches movies and series using the Xtream API only (no M3U mixing)
-func (c *Config) searchXtreamVOD(query string) ([]types.VODResult, error) {
-	utils.DebugLog("Searching VOD with query: %s", query)
+func (c *Config) searchXtreamVOD(log utils.RequestLogger, query string) ([]types.VODResult, error) {
+	log.DebugLog("Searching VOD with query: %s", query)
 
 	// Validate Xtream configuration
 	if c.XtreamBaseURL == "" || c.XtreamUser.String() == "" || c.XtreamPassword.String() == "" {
-		utils.ErrorLog("Xtream configuration is incomplete")
+		log.ErrorLog("Xtream configuration is incomplete")
 		return nil, fmt.Errorf("xtream configuration is incomplete")
 	}
 
 	results := make([]types.VODResult, 0, 50)
 	// Movies via API
-	if movies, err := c.searchXtreamMovies(query); err == nil && len(movies) > 0 {
-		utils.DebugLog("VOD search: movie API results: %d (first: %s)", len(movies), func() string { if len(movies)>0 { return movies[0].Title }; return "" }())
+	if movies, err := c.searchXtreamMovies(log, query); err == nil && len(movies) > 0 {
+		log.DebugLog("VOD search: movie API results: %d (first: %s)", len(movies), func() string { if len(movies)>0 { return movies[0].Title }; return "" }())
 		results = append(results, movies...)
 	} else if err != nil {
-		utils.WarnLog("VOD search: movie API search error: %v", err)
+		log.WarnLog("VOD search: movie API search error: %v", err)
 	}
 	// Series via API
-	if seriesResults, err := c.searchXtreamSeries(query); err == nil && len(seriesResults) > 0 {
-		utils.DebugLog("VOD search: series API results: %d (first: %s)", len(seriesResults), func() string { if len(seriesResults)>0 { return seriesResults[0].Title }; return "" }())
+	if seriesResults, err := c.searchXtreamSeries(log, query); err == nil && len(seriesResults) > 0 {
+		log.DebugLog("VOD search: series API results: %d (first: %s)", len(seriesResults), func() string { if len(seriesResults)>0 { return seriesResults[0].Title }; return "" }())
 		results = append(results, seriesResults...)
 	} else if err != nil {
-		utils.WarnLog("VOD search: series API search error: %v", err)
+		log.WarnLog("VOD search: series API search error: %v", err)
 	}
 
 	// Deduplicate by (StreamType, StreamID), keep the richer entry
@@ -92,16 +93,18 @@ func (c *Config) searchXtreamVOD(query string) ([]types.VODResult, error) {
 		before := len(results)
 		results = dedupeVODResults(results)
 		if len(results) != before {
-			utils.DebugLog("VOD search: deduplicated results: %d -> %d", before, len(results))
+			log.DebugLog("VOD search: deduplicated results: %d -> %d", before, len(results))
 		}
 	}
+	// Merge CD1/CD2, Part 1/Part 2 entries into one result
+	results = groupMultiPartResults(results)
 
 	// Do NOT probe sizes here to keep the search ultra-fast and avoid client timeouts.
 	// We'll enrich sizes lazily per page via /vod/enrich.
 	maxProbe := 0
 	// Build an index of movie streamID -> extension from the cached VOD M3U once
 	extIndex := map[string]string{}
-	if m3uPath, err := c.ensureVODM3UCache(); err == nil {
+	if m3uPath, err := c.ensureVODM3UCache(log); err == nil {
 		if idx, err2 := parseVODM3UExtensions(m3uPath); err2 == nil {
 			extIndex = idx
 		}
@@ -152,7 +155,7 @@ func (c *Config) searchXtreamVOD(query string) ([]types.VODResult, error) {
 					// GET with Range
 					req, _ := http.NewRequest("GET", vodURL, nil)
 					req.Header.Set("Range", "bytes=0-0")
-					req.Header.Set("User-Agent", utils.GetIPTVUserAgent())
+					req.Header.Set("User-Agent", utils.UserAgentFor(req.URL.Host))
 					req.Header.Set("Accept-Encoding", "identity")
 					req.Header.Set("Accept-Language", utils.GetLanguageHeader())
 					req.Header.Set("Accept", "*/*")
@@ -192,21 +195,22 @@ func (c *Config) searchXtreamVOD(query string) ([]types.VODResult, error) {
 
 	// Sort results by title for stable ordering
 	sort.SliceStable(results, func(i, j int) bool { return strings.ToLower(results[i].Title) < strings.ToLower(results[j].Title) })
-	utils.DebugLog("VOD search returned %d results for query: %s", len(results), query)
+	log.DebugLog("VOD search returned %d results for query: %s", len(results), query)
 	return results, nil
 }
 
 // searchXtreamMovies queries the Xtream API for VOD movies and filters by tokens.
-func (c *Config) searchXtreamMovies(query string) ([]types.VODResult, error) {
+func (c *Config) searchXtreamMovies(log utils.RequestLogger, query string) ([]types.VODResult, error) {
 	q := strings.TrimSpace(query)
 	if q == "" { return nil, nil }
 	tokens, _, _ := parseQueryTokens(q) // season/episode tokens ignored for movies
-	utils.DebugLog("Movies search: using Xtream client (baseURL=%s, user=%s)", c.XtreamBaseURL, utils.MaskString(c.XtreamUser.String()))
-	cli, err := xtreamapi.New(c.XtreamUser.String(), c.XtreamPassword.String(), c.XtreamBaseURL, utils.GetIPTVUserAgent())
+	strip := loadTitleStripRules()
+	log.DebugLog("Movies search: using Xtream client (baseURL=%s, user=%s)", c.XtreamBaseURL, utils.MaskString(c.XtreamUser.String()))
+	cli, err := xtreamapi.New(c.XtreamUser.String(), c.XtreamPassword.String(), c.XtreamBaseURL, utils.UserAgentFor(c.XtreamBaseURL))
 	if err != nil { return nil, err }
 	resp, httpcode, contentType, err := cli.Action(c.ProxyConfig, "get_vod_streams", url.Values{})
 	if err != nil {
-		utils.WarnLog("Movies search: get_vod_streams failed (HTTP %d, CT=%s): %v", httpcode, contentType, err)
+		log.WarnLog("Movies search: get_vod_streams failed (HTTP %d, CT=%s): %v", httpcode, contentType, err)
 		return nil, err
 	}
 	arr, ok := resp.([]interface{})
@@ -228,7 +232,8 @@ func (c *Config) searchXtreamMovies(query string) ([]types.VODResult, error) {
 
 		out = append(out, types.VODResult{
 			ID:         streamID,
-			Title:      name,
+			Title:      strip.clean(name),
+			RawTitle:   name,
 			Category:   category,
 			Duration:   duration,
 			Year:       year,
@@ -237,7 +242,7 @@ func (c *Config) searchXtreamMovies(query string) ([]types.VODResult, error) {
 			StreamType: "movie",
 		})
 	}
-	utils.DebugLog("Movies search: returning %d results", len(out))
+	log.DebugLog("Movies search: returning %d results", len(out))
 	return out, nil
 }
 
@@ -288,66 +293,115 @@ func isRicher(a, b types.VODResult) bool {
 	return false
 }
 
-func (c *Config) ensureVODM3UCache() (string, error) {
-	vodM3UMu.Lock()
-	defer vodM3UMu.Unlock()
-
-	// Cache directory preference: CACHE_FOLDER env or temp dir
-	cacheDir := os.Getenv("CACHE_FOLDER")
-	if cacheDir == "" {
-		cacheDir = filepath.Join(os.TempDir(), ".stream-share")
-	}
-	if err := os.MkdirAll(cacheDir, 0o755); err != nil {
-		return "", err
-	}
-
-	cacheFile := filepath.Join(cacheDir, "vod_cache.m3u")
+// ensureVODM3UCache returns the path of the cached m3u_plus playlist used for
+// VOD lookups. A stale file is returned at once and refreshed in the
+// background; without any file the caller waits for the first download.
+// vodM3UMu only guards the decision: the download runs without it, and
+// concurrent callers share one download.
+func (c *Config) ensureVODM3UCache(log utils.RequestLogger) (string, error) {
+	cacheFile := filepath.Join(cacheDir(), "vod_cache.m3u")
 
+	vodM3UMu.Lock()
 	// Check freshness vs. configured M3U cache expiration (hours)
 	expHours := c.M3UCacheExpiration
 	info, err := os.Stat(cacheFile)
 	if err == nil {
 		age := time.Since(info.ModTime())
 		if age.Hours() < float64(expHours) {
-			utils.DebugLog("Using cached VOD M3U: %s (age: %v)", cacheFile, age)
+			vodM3UMu.Unlock()
+			log.DebugLog("Using cached VOD M3U: %s (age: %v)", cacheFile, age)
 			return cacheFile, nil
 		}
 		// If expired but present, return stale file immediately and refresh in background to avoid blocking
-		stalePath := cacheFile
-		go func() {
-			// best-effort refresh
-			if err := c.refreshVODM3U(stalePath); err != nil {
-				utils.WarnLog("Failed background VOD M3U refresh: %v", err)
-			}
-		}()
-		utils.DebugLog("Using stale VOD M3U while refreshing in background: %s (age: %v)", cacheFile, age)
-		return stalePath, nil
+		c.startVODM3UFetch(log, cacheFile)
+		vodM3UMu.Unlock()
+		log.DebugLog("Using stale VOD M3U while refreshing in background: %s (age: %v)", cacheFile, age)
+		return cacheFile, nil
 	}
 
-	// No cache present: fetch synchronously
-	if err := c.refreshVODM3U(cacheFile); err != nil { return "", err }
+	// No cache present: wait for the download
+	fetch := c.startVODM3UFetch(log, cacheFile)
+	vodM3UMu.Unlock()
+	<-fetch.done
+	if fetch.err != nil { return "", fetch.err }
 	return cacheFile, nil
 }
 
-// refreshVODM3U downloads the VOD M3U into cacheFile path.
-func (c *Config) refreshVODM3U(cacheFile string) error {
+// vodM3UFlights runs the playlist download, once for all concurrent callers.
+var vodM3UFlights flightGroup
+
+// startVODM3UFetch starts downloading the playlist into cacheFile, or returns
+// the download already running.
+func (c *Config) startVODM3UFetch(log utils.RequestLogger, cacheFile string) *flight {
+	return vodM3UFlights.start(cacheFile, func() error {
+		err := c.refreshVODM3U(log, cacheFile)
+		if err != nil {
+			log.WarnLog("Failed VOD M3U refresh: %v", err)
+		}
+		return err
+	})
+}
+
+// vodM3ULimits reads VOD_M3U_TIMEOUT, the time the whole playlist download
+// may take ("90s" or seconds, default 2m), and VOD_M3U_MAX_BYTES, its largest
+// accepted size (default 1G, 0 for no cap).
+func vodM3ULimits() (time.Duration, int64) {
+	timeout := envDuration("VOD_M3U_TIMEOUT", 2*time.Minute)
+	if timeout <= 0 {
+		timeout = 2 * time.Minute
+	}
+	maxBytes := int64(1 << 30)
+	if v := strings.TrimSpace(os.Getenv("VOD_M3U_MAX_BYTES")); v != "" {
+		if n, err := parseByteSize(v); err == nil && n >= 0 {
+			maxBytes = n
+		} else {
+			utils.WarnLog("Invalid VOD_M3U_MAX_BYTES: %s", v)
+		}
+	}
+	return timeout, maxBytes
+}
+
+// refreshVODM3U downloads the VOD M3U into cacheFile path. The playlist is
+// written next to it and renamed into place once complete, so a failed or
+// oversized download leaves the previous file untouched.
+func (c *Config) refreshVODM3U(log utils.RequestLogger, cacheFile string) error {
 	getURL := fmt.Sprintf("%s/get.php?username=%s&password=%s&type=m3u_plus&output=m3u8",
 		c.XtreamBaseURL, c.XtreamUser.String(), c.XtreamPassword.String())
-	utils.InfoLog("Refreshing VOD M3U from Xtream: %s", utils.MaskURL(getURL))
-	req, err := http.NewRequest("GET", getURL, nil)
+	log.InfoLog("Refreshing VOD M3U from Xtream: %s", utils.MaskURL(getURL))
+	timeout, maxBytes := vodM3ULimits()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", getURL, nil)
 	if err != nil { return err }
-	req.Header.Set("User-Agent", utils.GetIPTVUserAgent())
-	// Short timeout for refresh to avoid tying resources
-	client := &http.Client{Timeout: 6 * time.Second}
-	resp, err := client.Do(req)
+	req.Header.Set("User-Agent", utils.UserAgentFor(req.URL.Host))
+	started := time.Now()
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil { return err }
 	defer resp.Body.Close()
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 { return fmt.Errorf("backend returned %d for M3U request", resp.StatusCode) }
-	f, err := os.Create(cacheFile)
+
+	tmp := cacheFile + ".tmp"
+	f, err := os.Create(tmp)
 	if err != nil { return err }
-	defer f.Close()
-	if _, err := io.Copy(f, resp.Body); err != nil { return err }
-	utils.InfoLog("Stored VOD M3U to %s", cacheFile)
+	var body io.Reader = resp.Body
+	if maxBytes > 0 {
+		// One byte over the cap tells an oversized playlist from one that fits exactly
+		body = io.LimitReader(resp.Body, maxBytes+1)
+	}
+	n, err := io.Copy(f, body)
+	if err == nil && maxBytes > 0 && n > maxBytes {
+		err = fmt.Errorf("playlist larger than VOD_M3U_MAX_BYTES (%s)", utils.HumanBytes(maxBytes))
+	}
+	if err == nil && n == 0 {
+		err = fmt.Errorf("backend returned an empty playlist")
+	}
+	if cerr := f.Close(); err == nil { err = cerr }
+	if err == nil { err = os.Rename(tmp, cacheFile) }
+	if err != nil {
+		os.Remove(tmp) // nolint: errcheck
+		return fmt.Errorf("VOD M3U download after %s: %w", time.Since(started).Round(time.Millisecond), err)
+	}
+	log.InfoLog("Stored VOD M3U to %s (%s in %s)", cacheFile, utils.HumanBytes(n), time.Since(started).Round(time.Millisecond))
 	return nil
 }
 
@@ -358,10 +412,12 @@ func searchVODInM3UFile(m3uPath string, query string) ([]types.VODResult, error)
 	}
 	defer f.Close()
 
-	q := strings.TrimSpace(query)
+	matcher := newTitleMatcher(query)
+	fuzzy := envFlag("VOD_SEARCH_FUZZY", true)
+	strip := loadTitleStripRules()
 	sc := bufio.NewScanner(f)
 	lastEXTINF := ""
-	results := make([]types.VODResult, 0, 50)
+	var ranked rankedResults
 
 	for sc.Scan() {
 		line := strings.TrimSpace(sc.Text())
@@ -387,9 +443,7 @@ func searchVODInM3UFile(m3uPath string, query string) ([]types.VODResult, error)
 			title := ""
 			category := ""
 			if lastEXTINF != "" {
-				if idx := strings.LastIndex(lastEXTINF, ","); idx != -1 && idx+1 < len(lastEXTINF) {
-					title = strings.TrimSpace(lastEXTINF[idx+1:])
-				}
+				title = extinfTitle(lastEXTINF)
 				// Extract group-title="..."
 				attrs := lastEXTINF
 				if i := strings.Index(attrs, " "); i != -1 {
@@ -407,17 +461,14 @@ func searchVODInM3UFile(m3uPath string, query string) ([]types.VODResult, error)
 				title = path.Base(u.Path)
 			}
 
-			// Filter by query if provided: simple all-words contains (case-insensitive)
-			if q != "" && !simpleAllWordsContains(q, title) {
-				continue
-			}
-
 			// StreamID is the last path segment
 			streamID := path.Base(u.Path)
 
-			results = append(results, types.VODResult{
+			// Filtered by query: all words (accents and articles ignored), else fuzzy
+			ranked.add(matcher, title, types.VODResult{
 				ID:       streamID,
-				Title:    title,
+				Title:    strip.clean(title),
+				RawTitle: title,
 				Category: category,
 				Duration: "",
 				Year:     "",
@@ -426,7 +477,7 @@ func searchVODInM3UFile(m3uPath string, query string) ([]types.VODResult, error)
 				StreamType: "movie",
 				SizeBytes: 0,
 				Size:      "",
-			})
+			}, fuzzy)
 
 			// Reset lastEXTINF after pairing with URL
 			lastEXTINF = ""
@@ -435,7 +486,25 @@ func searchVODInM3UFile(m3uPath string, query string) ([]types.VODResult, error)
 	if err := sc.Err(); err != nil {
 		return nil, err
 	}
-	return results, nil
+	return groupMultiPartResults(ranked.results()), nil
+}
+
+// extinfTitle returns the display title of an #EXTINF line: everything after
+// the first comma outside quoted attributes, so titles such as "Matrix, The"
+// stay whole.
+func extinfTitle(line string) string {
+	quoted := false
+	for i, r := range line {
+		switch r {
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				return strings.TrimSpace(line[i+1:])
+			}
+		}
+	}
+	return ""
 }
 
 // parseVODM3UExtensions scans the cached VOD M3U once and builds a map of streamID -> extension.
@@ -480,17 +549,6 @@ func parseInt64(s string) (int64, error) {
 	return n, err
 }
 
-// simpleAllWordsContains: split query by spaces and ensure each word is contained (case-insensitive) in text.
-func simpleAllWordsContains(query, text string) bool {
-	q := strings.TrimSpace(query)
-	if q == "" { return true }
-	t := strings.ToLower(text)
-	for _, w := range strings.Fields(strings.ToLower(q)) {
-		if !strings.Contains(t, w) { return false }
-	}
-	return true
-}
-
 // parseQueryTokens splits the query into tokens and extracts optional s/e (e.g., s02e04, s2e4, or separate s02 e04).
 // Returns lowercase tokens and season/episode numbers (0 if missing). Season/Episode tokens are removed from tokens.
 func parseQueryTokens(q string) (tokens []string, season, episode int) {
@@ -538,9 +596,12 @@ func searchSeriesInM3UFile(m3uPath string, query string) ([]types.VODResult, err
 
 	q := strings.TrimSpace(query)
 	qTokens, qSeason, qEpisode := parseQueryTokens(q)
+	matcher := newTitleMatcher(strings.Join(qTokens, " "))
+	fuzzy := envFlag("VOD_SEARCH_FUZZY", true)
+	strip := loadTitleStripRules()
 	sc := bufio.NewScanner(f)
 	lastEXTINF := ""
-	results := make([]types.VODResult, 0, 50)
+	var ranked rankedResults
 	// Regexes to extract S/E and split title
 	reSE := regexp.MustCompile(`(?i)\bS(\d{1,2})\s*[EExx×](\d{1,2})\b`)
 
@@ -553,17 +614,13 @@ func searchSeriesInM3UFile(m3uPath string, query string) ([]types.VODResult, err
 			if !strings.Contains(u.Path, "/series/") { continue }
 			title := ""; category := ""
 			if lastEXTINF != "" {
-				if idx := strings.LastIndex(lastEXTINF, ","); idx != -1 && idx+1 < len(lastEXTINF) {
-					title = strings.TrimSpace(lastEXTINF[idx+1:])
-				}
+				title = extinfTitle(lastEXTINF)
 				attrs := lastEXTINF
 				if i := strings.Index(attrs, " "); i != -1 { attrs = attrs[i+1:] }
 				const key = `group-title="`
 				if pos := strings.Index(attrs, key); pos != -1 { start := pos + len(key); if end := strings.Index(attrs[start:], `"`); end != -1 { category = attrs[start:start+end] } }
 			}
 			if title == "" { title = path.Base(u.Path) }
-			// Token-based match: require all non-season tokens; enforce numeric season/episode if specified
-			if len(qTokens) > 0 && !allTokensIn(qTokens, title) { lastEXTINF = ""; continue }
 			// Extract S/E
 			season, episode := 0, 0
 			if m := reSE.FindStringSubmatch(title); m != nil {
@@ -572,13 +629,18 @@ func searchSeriesInM3UFile(m3uPath string, query string) ([]types.VODResult, err
 			}
 			if qSeason > 0 && season > 0 && season != qSeason { lastEXTINF = ""; continue }
 			if qEpisode > 0 && episode > 0 && episode != qEpisode { lastEXTINF = ""; continue }
-			seriesTitle := title
+			// Branding is stripped from what is shown; matching uses the raw title
+			shown := strip.clean(title)
+			seriesTitle := shown
 			if i := reSE.FindStringIndex(seriesTitle); i != nil { seriesTitle = strings.TrimSpace(strings.Trim(seriesTitle[:i[0]], "-—–:|• ")) }
 			// StreamID is the last path segment
 			streamID := path.Base(u.Path)
-			results = append(results, types.VODResult{
+			// Match the non-season tokens (accents and articles ignored, fuzzy
+			// fallback); season/episode are enforced above
+			ranked.add(matcher, title, types.VODResult{
 				ID:           streamID,
-				Title:        title,
+				Title:        shown,
+				RawTitle:     title,
 				Category:     category,
 				Duration:     "",
 				Year:         "",
@@ -589,41 +651,48 @@ func searchSeriesInM3UFile(m3uPath string, query string) ([]types.VODResult, err
 				Season:       season,
 				Episode:      episode,
 				EpisodeTitle: "",
-			})
+			}, fuzzy)
 			lastEXTINF = ""
 		}
 	}
 	if err := sc.Err(); err != nil { return nil, err }
-	return results, nil
+	return ranked.results(), nil
 }
 
 // searchXtreamSeries searches series and flattens episodes matching the query
-func (c *Config) searchXtreamSeries(query string) ([]types.VODResult, error) {
+func (c *Config) searchXtreamSeries(log utils.RequestLogger, query string) ([]types.VODResult, error) {
 	q := strings.TrimSpace(query)
 	if q == "" {
 		return nil, nil
 	}
 	qTokens, qSeason, qEpisode := parseQueryTokens(q)
+	// VOD_EPISODE_DETAILS=false drops air date/plot from results (smaller payloads)
+	withDetails := true
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("VOD_EPISODE_DETAILS"))) {
+	case "0", "false", "no":
+		withDetails = false
+	}
 	// Use resilient client to avoid FlexInt unmarshaling issues
-	utils.DebugLog("Series search: using resilient Xtream client (baseURL=%s, user=%s)", c.XtreamBaseURL, utils.MaskString(c.XtreamUser.String()))
-	cli, err := xtreamapi.New(c.XtreamUser.String(), c.XtreamPassword.String(), c.XtreamBaseURL, utils.GetIPTVUserAgent())
+	log.DebugLog("Series search: using resilient Xtream client (baseURL=%s, user=%s)", c.XtreamBaseURL, utils.MaskString(c.XtreamUser.String()))
+	cli, err := xtreamapi.New(c.XtreamUser.String(), c.XtreamPassword.String(), c.XtreamBaseURL, utils.UserAgentFor(c.XtreamBaseURL))
 	if err != nil {
-		utils.WarnLog("Series search: failed to create resilient client: %v", err)
+		log.WarnLog("Series search: failed to create resilient client: %v", err)
 		return nil, err
 	}
 
 	resp, httpcode, contentType, err := cli.Action(c.ProxyConfig, "get_series", url.Values{})
 	if err != nil {
-		utils.WarnLog("Series search: get_series failed (HTTP %d, CT=%s): %v", httpcode, contentType, err)
+		log.WarnLog("Series search: get_series failed (HTTP %d, CT=%s): %v", httpcode, contentType, err)
 		return nil, err
 	}
 
 	arr, ok := resp.([]interface{})
 	if !ok {
-		utils.WarnLog("Series search: unexpected get_series format: %T", resp)
+		log.WarnLog("Series search: unexpected get_series format: %T", resp)
 		return nil, fmt.Errorf("unexpected get_series format: %T", resp)
 	}
 
+	strip := loadTitleStripRules()
 	out := make([]types.VODResult, 0, 50)
 	for _, item := range arr {
 		m, ok := item.(map[string]interface{})
@@ -643,16 +712,16 @@ func (c *Config) searchXtreamSeries(query string) ([]types.VODResult, error) {
 		genre := fmt.Sprintf("%v", m["genre"]) // may be empty
 		year := fmt.Sprintf("%v", firstNonEmpty(m["releaseDate"], m["release_date"]))
 
-		utils.DebugLog("Series search: candidate '%s' (id=%s, genre=%s, year=%s)", seriesName, seriesID, genre, year)
-		utils.DebugLog("Series search: fetching series info for '%s' (series_id=%s)", seriesName, seriesID)
+		log.DebugLog("Series search: candidate '%s' (id=%s, genre=%s, year=%s)", seriesName, seriesID, genre, year)
+		log.DebugLog("Series search: fetching series info for '%s' (series_id=%s)", seriesName, seriesID)
 		infoResp, httpcode, contentType, err := cli.Action(c.ProxyConfig, "get_series_info", url.Values{"series_id": {seriesID}})
 		if err != nil {
-			utils.WarnLog("Series search: get_series_info failed for id=%s: %v (HTTP %d, CT=%s)", seriesID, err, httpcode, contentType)
+			log.WarnLog("Series search: get_series_info failed for id=%s: %v (HTTP %d, CT=%s)", seriesID, err, httpcode, contentType)
 			continue
 		}
 		im, ok := infoResp.(map[string]interface{})
 		if !ok {
-			utils.WarnLog("Series search: unexpected series_info format for id=%s: %T", seriesID, infoResp)
+			log.WarnLog("Series search: unexpected series_info format for id=%s: %T", seriesID, infoResp)
 			continue
 		}
 		epsBySeason, ok := im["episodes"].(map[string]interface{})
@@ -689,48 +758,73 @@ func (c *Config) searchXtreamSeries(query string) ([]types.VODResult, error) {
 					duration = fmt.Sprintf("%v", infoSub["duration"]) // may be ""
 					rating = fmt.Sprintf("%v", firstNonEmpty(infoSub["rating"], infoSub["vote_average"]))
 				}
+				var airDate, plot string
+				if withDetails {
+					airDate, plot = episodeDetails(em)
+				}
 
 		out = append(out, types.VODResult{
 					ID:           streamID,
-					Title:        fmt.Sprintf("%s S%02dE%02d — %s", seriesName, seasonNum, epNum, title),
+					Title:        fmt.Sprintf("%s S%02dE%02d — %s", strip.clean(seriesName), seasonNum, epNum, title),
+					RawTitle:     fmt.Sprintf("%s S%02dE%02d — %s", seriesName, seasonNum, epNum, title),
 					Category:     genre,
 					Duration:     duration,
 					Year:         year,
 					Rating:       rating,
 					StreamID:     streamID,
 					StreamType:   "series",
-					SeriesTitle:  seriesName,
+					SeriesID:     seriesID,
+					SeriesTitle:  strip.clean(seriesName),
 					Season:       seasonNum,
 					Episode:      epNum,
 					EpisodeTitle: title,
+					AirDate:      airDate,
+					Plot:         plot,
 				})
 		totalEps++
 			}
 		}
-	utils.DebugLog("Series search: '%s' yielded %d episode entries after filtering", seriesName, totalEps)
+	log.DebugLog("Series search: '%s' yielded %d episode entries after filtering", seriesName, totalEps)
 	}
-	utils.DebugLog("Series search: returning %d results", len(out))
+	log.DebugLog("Series search: returning %d results", len(out))
 	return out, nil
 }
 
+// episodeDetails extracts the air date and plot of a get_series_info episode.
+// Providers disagree on key names and placement, so both the info sub-object
+// and the episode itself are checked; missing values come back empty.
+func episodeDetails(em map[string]interface{}) (string, string) {
+	info, _ := em["info"].(map[string]interface{})
+	if info == nil {
+		info = map[string]interface{}{}
+	}
+	airDate := fmt.Sprintf("%v", firstNonEmpty(info["releasedate"], info["air_date"], info["release_date"], em["air_date"], em["releasedate"]))
+	plot := fmt.Sprintf("%v", firstNonEmpty(info["plot"], info["overview"], info["description"], em["plot"], em["overview"]))
+	// Keep only the date part of timestamps like "2019-04-14 00:00:00"
+	if len(airDate) > 10 && airDate[4] == '-' && airDate[7] == '-' {
+		airDate = airDate[:10]
+	}
+	return strings.TrimSpace(airDate), strings.Join(strings.Fields(plot), " ")
+}
+
 // logRawXtreamSeriesDiagnostics performs raw calls to Xtream API to collect JSON payloads
 // for series and a matching series_info to help diagnose unmarshaling issues in third-party clients.
-func (c *Config) logRawXtreamSeriesDiagnostics(q string) {
+func (c *Config) logRawXtreamSeriesDiagnostics(log utils.RequestLogger, q string) {
 	// Create our resilient client that parses into generic interfaces
-	cli, err := xtreamapi.New(c.XtreamUser.String(), c.XtreamPassword.String(), c.XtreamBaseURL, utils.GetIPTVUserAgent())
+	cli, err := xtreamapi.New(c.XtreamUser.String(), c.XtreamPassword.String(), c.XtreamBaseURL, utils.UserAgentFor(c.XtreamBaseURL))
 	if err != nil {
-		utils.WarnLog("Diagnostics: failed to create raw Xtream client: %v", err)
+		log.WarnLog("Diagnostics: failed to create raw Xtream client: %v", err)
 		return
 	}
 
 	// Fetch series list
 	resp, httpcode, contentType, err := cli.Action(c.ProxyConfig, "get_series", url.Values{})
 	if err != nil {
-		utils.WarnLog("Diagnostics: get_series failed: %v (HTTP %d, CT=%s)", err, httpcode, contentType)
+		log.WarnLog("Diagnostics: get_series failed: %v (HTTP %d, CT=%s)", err, httpcode, contentType)
 		return
 	}
 	// Write raw to file if debugging enabled
-	if b, ok := tryJSONMarshal(resp); ok {
+	if b, ok := tryJSONMarshal(log, resp); ok {
 		filename := fmt.Sprintf("series_raw_%s.json", time.Now().Format("20060102_150405"))
 		utils.WriteResponseToFile(filename, b, contentType)
 	}
@@ -746,31 +840,31 @@ func (c *Config) logRawXtreamSeriesDiagnostics(q string) {
 			if name == "" { continue }
 			if strings.Contains(strings.ToLower(name), q) {
 				seriesID = fmt.Sprintf("%v", m["series_id"])
-				utils.DebugLog("Diagnostics: matched series '%s' with id=%s", name, seriesID)
+				log.DebugLog("Diagnostics: matched series '%s' with id=%s", name, seriesID)
 				break
 			}
 		}
 	}
 	if seriesID == "" {
-		utils.DebugLog("Diagnostics: no matching series found for query %q to fetch series_info", q)
+		log.DebugLog("Diagnostics: no matching series found for query %q to fetch series_info", q)
 		return
 	}
 	infoResp, httpcode, contentType, err := cli.Action(c.ProxyConfig, "get_series_info", url.Values{"series_id": {seriesID}})
 	if err != nil {
-		utils.WarnLog("Diagnostics: get_series_info failed for id=%s: %v (HTTP %d, CT=%s)", seriesID, err, httpcode, contentType)
+		log.WarnLog("Diagnostics: get_series_info failed for id=%s: %v (HTTP %d, CT=%s)", seriesID, err, httpcode, contentType)
 		return
 	}
-	if b, ok := tryJSONMarshal(infoResp); ok {
+	if b, ok := tryJSONMarshal(log, infoResp); ok {
 		filename := fmt.Sprintf("series_info_%s_%s.json", seriesID, time.Now().Format("20060102_150405"))
 		utils.WriteResponseToFile(filename, b, contentType)
 	}
 }
 
 // tryJSONMarshal marshals v to pretty JSON bytes for logging
-func tryJSONMarshal(v interface{}) ([]byte, bool) {
+func tryJSONMarshal(log utils.RequestLogger, v interface{}) ([]byte, bool) {
 	b, err := json.MarshalIndent(v, "", "  ")
 	if err != nil {
-		utils.DebugLog("Diagnostics: failed to marshal JSON: %v", err)
+		log.DebugLog("Diagnostics: failed to marshal JSON: %v", err)
 		return nil, false
 	}
 	return b, true
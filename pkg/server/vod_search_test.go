@@ -0,0 +1,79 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestEpisodeDetails(t *testing.T) {
+	tests := []struct {
+		name     string
+		episode  string
+		wantDate string
+		wantPlot string
+	}{
+		{
+			name:     "info sub-object",
+			episode:  `{"id":"101","title":"Pilot","info":{"releasedate":"2019-04-14","plot":"The first one.","duration":"00:42:00"}}`,
+			wantDate: "2019-04-14",
+			wantPlot: "The first one.",
+		},
+		{
+			name:     "timestamp trimmed and plot whitespace collapsed",
+			episode:  `{"id":"102","info":{"air_date":"2019-04-21 00:00:00","overview":"  Two\n lines\tof plot "}}`,
+			wantDate: "2019-04-21",
+			wantPlot: "Two lines of plot",
+		},
+		{
+			name:     "keys on the episode itself",
+			episode:  `{"id":"103","air_date":"2019-04-28","overview":"Third."}`,
+			wantDate: "2019-04-28",
+			wantPlot: "Third.",
+		},
+		{
+			name:     "info wins over the episode",
+			episode:  `{"id":"104","plot":"outer","info":{"plot":"inner"}}`,
+			wantPlot: "inner",
+		},
+		{
+			name:    "details omitted",
+			episode: `{"id":"105","title":"Bare","info":{"duration":"00:42:00"}}`,
+		},
+		{
+			name:    "info is not an object",
+			episode: `{"id":"106","info":[]}`,
+		},
+		{
+			name:    "null values",
+			episode: `{"id":"107","info":{"releasedate":null,"plot":null}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var em map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.episode), &em); err != nil {
+				t.Fatal(err)
+			}
+			date, plot := episodeDetails(em)
+			if date != tt.wantDate || plot != tt.wantPlot {
+				t.Errorf("episodeDetails = (%q, %q), want (%q, %q)", date, plot, tt.wantDate, tt.wantPlot)
+			}
+		})
+	}
+}
+
+func TestExtinfTitle(t *testing.T) {
+	tests := []struct{ line, want string }{
+		{`#EXTINF:-1 tvg-id="x" group-title="Movies",The Matrix`, "The Matrix"},
+		{`#EXTINF:-1 group-title="Movies",Matrix, The`, "Matrix, The"},
+		{`#EXTINF:-1 tvg-name="Matrix, The" group-title="Action, Sci-Fi",Matrix, The`, "Matrix, The"},
+		{`#EXTINF:-1,  Heat `, "Heat"},
+		{`#EXTINF:-1 group-title="Movies"`, ""},
+	}
+	for _, tt := range tests {
+		if got := extinfTitle(tt.line); got != tt.want {
+			t.Errorf("extinfTitle(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
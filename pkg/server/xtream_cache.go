@@ -19,11 +19,14 @@
 package server
 
 import (
+    "errors"
+    "net/http"
     "os"
     "path/filepath"
     "sync"
     "time"
 
+    "github.com/gin-gonic/gin"
     "github.com/jamesnetherton/m3u"
     "github.com/lucasduport/stream-share/pkg/utils"
     uuid "github.com/satori/go.uuid"
@@ -59,3 +62,45 @@ func (c *Config) cacheXtreamM3u(playlist *m3u.Playlist, cacheName string) error
     utils.DebugLog("Cached Xtream M3U at %s for key %s", path, cacheName)
     return nil
 }
+
+// dropCachedXtreamM3u forgets every cached playlist, so the next request
+// builds a fresh one.
+func dropCachedXtreamM3u() {
+    xtreamM3uCacheLock.Lock()
+    defer xtreamM3uCacheLock.Unlock()
+    for key, meta := range xtreamM3uCache {
+        os.Remove(meta.string) // nolint: errcheck
+        delete(xtreamM3uCache, key)
+    }
+}
+
+// errEmptyPlaylist is returned when the provider answers get.php with no tracks.
+var errEmptyPlaylist = errors.New("Xtream backend returned empty playlist")
+
+// m3uFlights runs one regeneration per playlist cache key: ten players asking
+// for a stale playlist at once cause one upstream fetch.
+var m3uFlights flightGroup
+
+// refreshXtreamGetM3u fetches the provider's get.php playlist at m3uURL and
+// caches it under m3uURL, once for all concurrent callers.
+func (c *Config) refreshXtreamGetM3u(m3uURL string) error {
+    return m3uFlights.do(m3uURL, func() error {
+        playlist, err := m3u.Parse(m3uURL)
+        if err != nil {
+            return err
+        }
+        if len(playlist.Tracks) == 0 {
+            return errEmptyPlaylist
+        }
+        return c.cacheXtreamM3u(&playlist, m3uURL)
+    })
+}
+
+// abortPlaylistError answers a playlist that could not be built.
+func abortPlaylistError(ctx *gin.Context, err error) {
+    if errors.Is(err, errEmptyPlaylist) {
+        abortError(ctx, http.StatusBadGateway, errCodeUpstreamEmptyPlaylist, err.Error(), err)
+        return
+    }
+    abortError(ctx, http.StatusInternalServerError, errCodeInternal, "Could not build playlist", err)
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lucasduport/stream-share/pkg/config"
+)
+
+// TestRefreshXtreamGetM3uOnce checks that concurrent requests for a stale
+// playlist cause a single provider fetch and all get its result.
+func TestRefreshXtreamGetM3uOnce(t *testing.T) {
+	var fetches atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("#EXTM3U\n#EXTINF:-1 group-title=\"News\",Channel 1\nhttp://provider/live/u/p/1.ts\n")) // nolint: errcheck
+	}))
+	defer upstream.Close()
+	t.Cleanup(dropCachedXtreamM3u)
+
+	c := &Config{ProxyConfig: &config.ProxyConfig{HostConfig: &config.HostConfiguration{Hostname: "proxy", Port: 8080}}}
+	m3uURL := upstream.URL + "/get.php?username=u&password=p"
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- c.refreshXtreamGetM3u(m3uURL)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("%d provider fetches for 10 concurrent requests, want 1", n)
+	}
+
+	xtreamM3uCacheLock.RLock()
+	_, ok := xtreamM3uCache[m3uURL]
+	xtreamM3uCacheLock.RUnlock()
+	if !ok {
+		t.Error("playlist not cached")
+	}
+}
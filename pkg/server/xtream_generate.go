@@ -21,42 +21,47 @@ package server
 import (
     "fmt"
     "net/url"
+    "os"
+    "strconv"
+    "strings"
+    "sync"
+    "sync/atomic"
 
-    "github.com/gin-gonic/gin"
     "github.com/jamesnetherton/m3u"
     "github.com/lucasduport/stream-share/pkg/utils"
     xtreamapi "github.com/lucasduport/stream-share/pkg/xtream"
 )
 
 // xtreamGenerateM3u constructs an M3U playlist by calling Xtream categories
-// and streams endpoints and rewriting URIs to this proxy.
-func (c *Config) xtreamGenerateM3u(ctx *gin.Context, extension string) (*m3u.Playlist, error) {
-    client, err := xtreamapi.New(c.XtreamUser.String(), c.XtreamPassword.String(), c.XtreamBaseURL, ctx.Request.UserAgent())
+// and streams endpoints and rewriting URIs to this proxy. log is tagged with
+// the request that started the generation.
+func (c *Config) xtreamGenerateM3u(log utils.RequestLogger, extension string) (*m3u.Playlist, error) {
+    client, err := xtreamapi.New(c.XtreamUser.String(), c.XtreamPassword.String(), c.XtreamBaseURL, utils.UserAgentFor(c.XtreamBaseURL))
     if err != nil {
         return nil, utils.PrintErrorAndReturn(err)
     }
 
-    utils.DebugLog("========== GENERATING M3U PLAYLIST ==========")
-    utils.DebugLog("Requesting live categories...")
+    log.DebugLog("========== GENERATING M3U PLAYLIST ==========")
+    log.DebugLog("Requesting live categories...")
 
     // Use the robust Action method to get categories
     catResp, httpCode, contentType, err := client.Action(c.ProxyConfig, "get_live_categories", url.Values{})
     if err != nil {
-        utils.DebugLog("Failed to get live categories: %v", err)
+        log.DebugLog("Failed to get live categories: %v", err)
         return nil, utils.PrintErrorAndReturn(err)
     }
 
-    utils.DebugLog("Live categories response - HTTP Status: %d, Content-Type: %s", httpCode, contentType)
+    log.DebugLog("Live categories response - HTTP Status: %d, Content-Type: %s", httpCode, contentType)
     utils.DumpStructToLog("live_categories", catResp)
 
     // Type assert the response to the expected format
     catData, ok := catResp.([]interface{})
     if !ok {
-        utils.DebugLog("Unexpected format for live categories: %T - %+v", catResp, catResp)
+        log.DebugLog("Unexpected format for live categories: %T - %+v", catResp, catResp)
         return nil, utils.PrintErrorAndReturn(fmt.Errorf("unexpected format for live categories: %T", catResp))
     }
 
-    utils.DebugLog("Found %d live categories", len(catData))
+    log.DebugLog("Found %d live categories", len(catData))
 
     // this is specific to xtream API,
     // prefix with "live" if there is an extension.
@@ -66,84 +71,146 @@ func (c *Config) xtreamGenerateM3u(ctx *gin.Context, extension string) (*m3u.Pla
         prefix = "live/"
     }
 
-    var playlist = new(m3u.Playlist)
-    playlist.Tracks = make([]m3u.Track, 0)
-
+    type categoryJob struct{ id, name string }
+    jobs := make([]categoryJob, 0, len(catData))
+    blocked := blockedStreams()
     for i, categoryItem := range catData {
         categoryMap, ok := categoryItem.(map[string]interface{})
         if !ok {
-            utils.DebugLog("WARNING: Category item #%d is not a map: %T - %+v", i, categoryItem, categoryItem)
+            log.DebugLog("WARNING: Category item #%d is not a map: %T - %+v", i, categoryItem, categoryItem)
             continue
         }
+        job := categoryJob{fmt.Sprintf("%v", categoryMap["category_id"]), fmt.Sprintf("%v", categoryMap["category_name"])}
+        if blocked.categoryBlocked(job.id, job.name) {
+            log.DebugLog("Skipping blocked category %s (ID: %s)", job.name, job.id)
+            continue
+        }
+        jobs = append(jobs, job)
+    }
 
-        categoryID := fmt.Sprintf("%v", categoryMap["category_id"])
-        categoryName := fmt.Sprintf("%v", categoryMap["category_name"])
-        utils.DebugLog("Processing category: %s (ID: %s)", categoryName, categoryID)
+    // Categories are fetched by a bounded pool; each result lands in its own
+    // slot so the playlist keeps the provider's category order.
+    type categoryResult struct {
+        tracks []m3u.Track
+        err    error
+    }
+    results := make([]categoryResult, len(jobs))
+    var failed atomic.Bool // the playlist can't be complete anymore, stop fetching
+    next := make(chan int)
+    var wg sync.WaitGroup
+    workers := m3uFetchConcurrency()
+    if workers > len(jobs) { workers = len(jobs) }
+    for w := 0; w < workers; w++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for i := range next {
+                if failed.Load() { continue }
+                tracks, err := c.categoryTracks(log, client, jobs[i].id, jobs[i].name, prefix, extension)
+                results[i] = categoryResult{tracks, err}
+                if err != nil { failed.Store(true) }
+            }
+        }()
+    }
+    for i := range jobs { next <- i }
+    close(next)
+    wg.Wait()
 
-        // Use the robust Action method to get live streams for each category
-        utils.DebugLog("Requesting streams for category %s...", categoryID)
-        liveResp, httpCode, contentType, err := client.Action(c.ProxyConfig, "get_live_streams", url.Values{"category_id": {categoryID}})
-        if err != nil {
-            utils.DebugLog("Failed to get live streams for category %s: %v", categoryID, err)
-            return nil, utils.PrintErrorAndReturn(err)
+    // A playlist missing categories would be cached as if complete: any
+    // failing category fails the generation
+    var playlist = new(m3u.Playlist)
+    playlist.Tracks = make([]m3u.Track, 0)
+    for i, r := range results {
+        if r.err != nil {
+            log.DebugLog("Failed to get live streams for category %s: %v", jobs[i].id, r.err)
+            return nil, utils.PrintErrorAndReturn(r.err)
         }
+        playlist.Tracks = append(playlist.Tracks, r.tracks...)
+    }
 
-        utils.DebugLog("Streams response - HTTP Status: %d, Content-Type: %s", httpCode, contentType)
-        utils.DumpStructToLog(fmt.Sprintf("streams_cat_%s", categoryID), liveResp)
+    log.DebugLog("Playlist generation complete: %d total tracks", len(playlist.Tracks))
+    return playlist, nil
+}
 
-        liveData, ok := liveResp.([]interface{})
-        if !ok {
-            utils.DebugLog("WARNING: Unexpected format for streams in category '%s': %T", categoryName, liveResp)
-            continue
-        }
+// categoryTracks fetches the live streams of one category and turns them
+// into playlist tracks. Log lines carry the category id, since several
+// categories are fetched at once.
+func (c *Config) categoryTracks(log utils.RequestLogger, client *xtreamapi.Client, categoryID, categoryName, prefix, extension string) ([]m3u.Track, error) {
+    log.DebugLog("[category %s] Requesting streams for %s...", categoryID, categoryName)
+    liveResp, httpCode, contentType, err := client.Action(c.ProxyConfig, "get_live_streams", url.Values{"category_id": {categoryID}})
+    if err != nil {
+        log.DebugLog("[category %s] Failed to get live streams: %v", categoryID, err)
+        return nil, err
+    }
 
-        utils.DebugLog("Found %d streams in category: %s", len(liveData), categoryName)
+    log.DebugLog("[category %s] Streams response - HTTP Status: %d, Content-Type: %s", categoryID, httpCode, contentType)
+    utils.DumpStructToLog(fmt.Sprintf("streams_cat_%s", categoryID), liveResp)
 
-        for j, streamItem := range liveData {
-            streamMap, ok := streamItem.(map[string]interface{})
-            if !ok {
-                utils.DebugLog("WARNING: Stream #%d in category '%s' is not a map: %T", j, categoryName, streamItem)
-                continue
-            }
+    liveData, ok := liveResp.([]interface{})
+    if !ok {
+        log.DebugLog("[category %s] WARNING: Unexpected format for streams in category '%s': %T", categoryID, categoryName, liveResp)
+        return nil, nil
+    }
 
-            // Validate required fields
-            streamName, hasName := streamMap["name"].(string)
-            streamID, hasID := streamMap["stream_id"].(string)
+    log.DebugLog("[category %s] Found %d streams in category: %s", categoryID, len(liveData), categoryName)
 
-            if !hasName || !hasID {
-                utils.DebugLog("WARNING: Stream missing required fields - Name: %v, ID: %v", streamMap["name"], streamMap["stream_id"])
-                continue
-            }
+    tagOpts := loadM3UTagOptions()
+    strip := loadTitleStripRules()
+    tracks := make([]m3u.Track, 0, len(liveData))
+    for j, streamItem := range liveData {
+        streamMap, ok := streamItem.(map[string]interface{})
+        if !ok {
+            log.DebugLog("[category %s] WARNING: Stream #%d is not a map: %T", categoryID, j, streamItem)
+            continue
+        }
 
-            track := m3u.Track{
-                Name:   streamName,
-                Length: -1,
-                URI:    "",
-                Tags:   nil,
-            }
+        // Validate required fields
+        streamName, hasName := streamMap["name"].(string)
+        streamID, hasID := streamMap["stream_id"].(string)
 
-            //TODO: Add more tag if needed.
-            if epgID, ok := streamMap["epg_channel_id"].(string); ok && epgID != "" {
-                track.Tags = append(track.Tags, m3u.Tag{Name: "tvg-id", Value: epgID})
-            }
-            if name, ok := streamMap["name"].(string); ok && name != "" {
-                track.Tags = append(track.Tags, m3u.Tag{Name: "tvg-name", Value: name})
-            }
-            if logo, ok := streamMap["stream_icon"].(string); ok && logo != "" {
-                track.Tags = append(track.Tags, m3u.Tag{Name: "tvg-logo", Value: logo})
-            }
-            if categoryName != "" {
-                track.Tags = append(track.Tags, m3u.Tag{Name: "group-title", Value: categoryName})
-            }
+        if !hasName || !hasID {
+            log.DebugLog("[category %s] WARNING: Stream missing required fields - Name: %v, ID: %v", categoryID, streamMap["name"], streamMap["stream_id"])
+            continue
+        }
 
-            streamID = fmt.Sprintf("%v", streamMap["stream_id"])
-            track.URI = fmt.Sprintf("%s/%s%s/%s/%s%s", c.XtreamBaseURL, prefix, c.XtreamUser, c.XtreamPassword, streamID, extension)
+        // tvg-name below keeps the provider's name for EPG matching
+        track := m3u.Track{
+            Name:   strip.clean(streamName),
+            Length: -1,
+            URI:    "",
+            Tags:   nil,
+        }
 
-            utils.DebugLog("Added stream: %s (ID: %s)", track.Name, streamID)
-            playlist.Tracks = append(playlist.Tracks, track)
+        //TODO: Add more tag if needed.
+        if epgID, ok := streamMap["epg_channel_id"].(string); ok && epgID != "" {
+            track.Tags = append(track.Tags, m3u.Tag{Name: "tvg-id", Value: epgID})
+        }
+        if name, ok := streamMap["name"].(string); ok && name != "" {
+            track.Tags = append(track.Tags, m3u.Tag{Name: "tvg-name", Value: name})
+        }
+        if logo, ok := streamMap["stream_icon"].(string); ok && logo != "" {
+            track.Tags = append(track.Tags, m3u.Tag{Name: "tvg-logo", Value: c.proxiedLogoURL(logo)})
+        }
+        if categoryName != "" {
+            track.Tags = append(track.Tags, m3u.Tag{Name: "group-title", Value: categoryName})
         }
+
+        streamID = fmt.Sprintf("%v", streamMap["stream_id"])
+        track.Tags = append(track.Tags, c.extraTrackTags(tagOpts, streamMap, streamID)...)
+        track.URI = fmt.Sprintf("%s/%s%s/%s/%s%s", c.XtreamBaseURL, prefix, c.XtreamUser, c.XtreamPassword, streamID, extension)
+
+        log.DebugLog("[category %s] Added stream: %s (ID: %s)", categoryID, track.Name, streamID)
+        tracks = append(tracks, track)
     }
+    return tracks, nil
+}
 
-    utils.DebugLog("Playlist generation complete: %d total tracks", len(playlist.Tracks))
-    return playlist, nil
+// m3uFetchConcurrency reads M3U_FETCH_CONCURRENCY, the number of categories
+// fetched at once while generating the M3U (default 8).
+func m3uFetchConcurrency() int {
+    if v := strings.TrimSpace(os.Getenv("M3U_FETCH_CONCURRENCY")); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n > 0 { return n }
+        utils.WarnLog("Invalid M3U_FETCH_CONCURRENCY: %s", v)
+    }
+    return 8
 }
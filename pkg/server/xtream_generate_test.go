@@ -0,0 +1,65 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucasduport/stream-share/pkg/config"
+)
+
+// TestXtreamGenerateM3uCategoryFails checks that a category the provider
+// fails to list fails the generation, and nothing is cached, instead of an
+// incomplete playlist being served until the next refresh.
+func TestXtreamGenerateM3uCategoryFails(t *testing.T) {
+	t.Setenv("API_CACHE_SECONDS", "0")
+	t.Cleanup(dropCachedXtreamM3u)
+	var broken atomic.Bool
+	broken.Store(true)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch {
+		case q.Get("action") == "get_live_categories":
+			w.Write([]byte(`[{"category_id":"1","category_name":"News"},{"category_id":"2","category_name":"Sports"}]`)) // nolint: errcheck
+		case q.Get("category_id") == "2" && broken.Load():
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.Write([]byte(`[{"name":"Channel ` + q.Get("category_id") + `","stream_id":"1` + q.Get("category_id") + `"}]`)) // nolint: errcheck
+		}
+	}))
+	defer upstream.Close()
+
+	c := &Config{ProxyConfig: &config.ProxyConfig{
+		HostConfig:         &config.HostConfiguration{Hostname: "iptv.example", Port: 8080},
+		XtreamBaseURL:      upstream.URL,
+		XtreamUser:         "puser",
+		XtreamPassword:     "ppass",
+		User:               "alice",
+		Password:           "secret",
+		M3UCacheExpiration: 1,
+	}}
+	apiget := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = httptest.NewRequest(http.MethodGet, "/apiget?username=alice&password=secret&output=ts", nil)
+		c.xtreamApiGet(ctx)
+		return w
+	}
+
+	if w := apiget(); w.Code == http.StatusOK {
+		t.Errorf("playlist with a failing category answered 200:\n%s", w.Body.String())
+	}
+	xtreamM3uCacheLock.RLock()
+	cached := len(xtreamM3uCache)
+	xtreamM3uCacheLock.RUnlock()
+	if cached != 0 {
+		t.Errorf("%d playlists cached after a failed generation, want none", cached)
+	}
+
+	broken.Store(false)
+	if w := apiget(); w.Code != http.StatusOK {
+		t.Errorf("playlist answered %d once the provider recovered", w.Code)
+	}
+}
@@ -21,6 +21,7 @@ package server
 import (
     "bytes"
     "encoding/json"
+    "errors"
     "fmt"
     "io/ioutil"
     "net/http"
@@ -30,7 +31,6 @@ import (
     "time"
 
     "github.com/gin-gonic/gin"
-	"github.com/jamesnetherton/m3u"
     "github.com/lucasduport/stream-share/pkg/config"
     "github.com/lucasduport/stream-share/pkg/utils"
     xtreamapi "github.com/lucasduport/stream-share/pkg/xtream"
@@ -53,12 +53,16 @@ func (c *Config) xtreamGetAuto(ctx *gin.Context) {
 
 // xtreamGet proxies get.php, caching the M3U on disk and guarding empty results.
 func (c *Config) xtreamGet(ctx *gin.Context) {
-    utils.DebugLog("Xtream backend request using Xtream credentials: user=%s, password=%s, baseURL=%s", c.XtreamUser.String(), c.XtreamPassword.String(), c.XtreamBaseURL)
+    reqLog(ctx).DebugLog("Xtream backend request using Xtream credentials: user=%s, password=%s, baseURL=%s", c.XtreamUser.String(), c.XtreamPassword.String(), c.XtreamBaseURL)
     rawURL := fmt.Sprintf("%s/get.php?username=%s&password=%s", c.XtreamBaseURL, c.XtreamUser, c.XtreamPassword)
 
+    groups, ok := requestGroupFilter(ctx)
+    if !ok {
+        return
+    }
     q := ctx.Request.URL.Query()
     for k, v := range q {
-        if k == "username" || k == "password" {
+        if k == "username" || k == "password" || k == "refresh" || k == "key" || isGroupFilterParam(k) {
             continue
         }
         rawURL = fmt.Sprintf("%s&%s=%s", rawURL, k, strings.Join(v, ","))
@@ -66,27 +70,20 @@ func (c *Config) xtreamGet(ctx *gin.Context) {
 
     m3uURL, err := url.Parse(rawURL)
     if err != nil {
-        ctx.AbortWithError(http.StatusInternalServerError, utils.PrintErrorAndReturn(err))
+        abortError(ctx, http.StatusInternalServerError, errCodeInternal, "Could not build upstream URL", err)
         return
     }
+    refresh := forcedPlaylistRefresh(ctx)
+    cacheName := m3uURL.String()
 
     xtreamM3uCacheLock.RLock()
-    meta, ok := xtreamM3uCache[m3uURL.String()]
+    meta, ok := xtreamM3uCache[cacheName]
     d := time.Since(meta.Time)
-    if !ok || d.Hours() >= float64(c.M3UCacheExpiration) {
-        utils.InfoLog("xtream cache m3u file refresh requested by %s", ctx.ClientIP())
+    if !ok || refresh || d.Hours() >= float64(c.M3UCacheExpiration) {
+        reqLog(ctx).InfoLog("xtream cache m3u file refresh requested by %s", ctx.ClientIP())
         xtreamM3uCacheLock.RUnlock()
-        playlist, err := m3u.Parse(m3uURL.String())
-        if err != nil {
-            ctx.AbortWithError(http.StatusInternalServerError, utils.PrintErrorAndReturn(err))
-            return
-        }
-        if len(playlist.Tracks) == 0 {
-            ctx.AbortWithError(http.StatusBadGateway, utils.PrintErrorAndReturn(fmt.Errorf("Xtream backend returned empty playlist")))
-            return
-        }
-        if err := c.cacheXtreamM3u(&playlist, m3uURL.String()); err != nil {
-            ctx.AbortWithError(http.StatusInternalServerError, utils.PrintErrorAndReturn(err))
+        if err := c.refreshXtreamGetM3u(cacheName); err != nil {
+            abortPlaylistError(ctx, err)
             return
         }
     } else {
@@ -95,10 +92,48 @@ func (c *Config) xtreamGet(ctx *gin.Context) {
 
     ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename=%q`, c.M3UFileName))
     xtreamM3uCacheLock.RLock()
-    path := xtreamM3uCache[m3uURL.String()].string
+    path := xtreamM3uCache[cacheName].string
     xtreamM3uCacheLock.RUnlock()
     ctx.Header("Content-Type", "application/octet-stream")
-    ctx.File(path)
+    serveFilteredPlaylist(ctx, path, groups)
+}
+
+// localLoginResponse builds the player_api login answer advertising the proxy's
+// own credentials and address instead of the provider's.
+func (c *Config) localLoginResponse() map[string]interface{} {
+    public := c.advertised()
+    now := time.Now()
+    nowUnix := strconv.FormatInt(now.Unix(), 10)
+    expDate := c.loginExpDate(now)
+
+    userInfo := map[string]interface{}{
+        "username":               c.User.String(),
+        "password":               c.Password.String(),
+        "message":                "",
+        "auth":                   "1",
+        "status":                 "Active",
+        "exp_date":               expDate,
+        "is_trial":               "0",
+        "active_cons":            "0",
+        "created_at":             nowUnix,
+        "max_connections":        "1",
+        "allowed_output_formats": liveOutputFormats,
+    }
+    c.applyProviderUserInfo(userInfo)
+
+    return map[string]interface{}{
+        "user_info":   userInfo,
+        "server_info": map[string]interface{}{
+            "url":             fmt.Sprintf("%s://%s", public.scheme, public.host),
+            "port":            strconv.Itoa(public.port),
+            "https_port":      strconv.Itoa(public.port),
+            "server_protocol": public.scheme,
+            "rtmp_port":       strconv.Itoa(public.port),
+            "timezone":        "UTC",
+            "timestamp_now":   nowUnix,
+            "time_now":        now.UTC().Format("2006-01-02 15:04:05"),
+        },
+    }
 }
 
 // xtreamPlayerAPI proxies player_api actions with a local login path to avoid brittle unmarshaling differences.
@@ -109,41 +144,9 @@ func (c *Config) xtreamPlayerAPI(ctx *gin.Context, q url.Values) {
     }
 
     if strings.TrimSpace(action) == "" {
-        protocol := "http"
-        if c.ProxyConfig.HTTPS {
-            protocol = "https"
-        }
-        now := time.Now()
-        nowUnix := strconv.FormatInt(now.Unix(), 10)
-        expDate := strconv.FormatInt(now.Add(365*24*time.Hour).Unix(), 10)
-
-        loginResp := map[string]interface{}{
-            "user_info": map[string]interface{}{
-                "username":               c.User.String(),
-                "password":               c.Password.String(),
-                "message":                "",
-                "auth":                   "1",
-                "status":                 "Active",
-                "exp_date":               expDate,
-                "is_trial":               "0",
-                "active_cons":            "0",
-                "created_at":             nowUnix,
-                "max_connections":        "1",
-                "allowed_output_formats": []string{"m3u8", "ts"},
-            },
-            "server_info": map[string]interface{}{
-                "url":             fmt.Sprintf("%s://%s", protocol, c.HostConfig.Hostname),
-                "port":            strconv.Itoa(c.AdvertisedPort),
-                "https_port":      strconv.Itoa(c.AdvertisedPort),
-                "server_protocol": protocol,
-                "rtmp_port":       strconv.Itoa(c.AdvertisedPort),
-                "timezone":        "UTC",
-                "timestamp_now":   nowUnix,
-                "time_now":        now.UTC().Format("2006-01-02 15:04:05"),
-            },
-        }
+        loginResp := c.localLoginResponse()
 
-        utils.InfoLog("Action\tlogin (local) requested by %s", ctx.ClientIP())
+        reqLog(ctx).InfoLog("Action\tlogin (local) requested by %s", ctx.ClientIP())
         if config.CacheFolder != "" {
             readableJSON, _ := json.Marshal(loginResp)
             filename := fmt.Sprintf("login_%s.json", time.Now().Format("20060102_150405"))
@@ -153,31 +156,71 @@ func (c *Config) xtreamPlayerAPI(ctx *gin.Context, q url.Values) {
         return
     }
 
-    client, err := xtreamapi.New(c.XtreamUser.String(), c.XtreamPassword.String(), c.XtreamBaseURL, ctx.Request.UserAgent())
+    // Account panel actions are answered locally: the provider's copy would
+    // expose the upstream credentials and connection limits
+    switch action {
+    case xtreamapi.GetAccountInfo, xtreamapi.GetUserInfo, xtreamapi.GetServerInfo:
+        loginResp := c.localLoginResponse()
+        if action == xtreamapi.GetUserInfo {
+            delete(loginResp, "server_info")
+        } else if action == xtreamapi.GetServerInfo {
+            delete(loginResp, "user_info")
+        }
+        reqLog(ctx).InfoLog("Action\t%s (local) requested by %s", action, ctx.ClientIP())
+        ctx.JSON(http.StatusOK, loginResp)
+        return
+    }
+
+    if !xtreamapi.IsKnownAction(action) && !envFlag("XTREAM_PASSTHROUGH_ACTIONS", true) {
+        reqLog(ctx).InfoLog("Action\t%s (unknown, not forwarded) requested by %s", action, ctx.ClientIP())
+        ctx.JSON(http.StatusOK, xtreamapi.FallbackForAction(action))
+        return
+    }
+
+    client, err := xtreamapi.New(c.XtreamUser.String(), c.XtreamPassword.String(), c.XtreamBaseURL, utils.UserAgentFor(c.XtreamBaseURL))
     if err != nil {
-        ctx.AbortWithError(http.StatusInternalServerError, utils.PrintErrorAndReturn(err))
+        abortError(ctx, http.StatusInternalServerError, errCodeUpstreamError, "Could not reach Xtream backend", err)
         return
     }
 
     resp, httpcode, contentType, err := client.Action(c.ProxyConfig, action, q)
     if err != nil {
-        ctx.AbortWithError(httpcode, utils.PrintErrorAndReturn(err))
-        return
+        // Keep player catalogs populated through a short provider outage
+        last, storedAt, ok := loadLastGood(action, q)
+        switch {
+        case ok:
+            reqLog(ctx).WarnLog("Action\t%s failed (%v), serving the copy from %s", action, err, storedAt.Format(time.RFC3339))
+            ctx.Header(staleHeader, "true")
+            resp = last
+        case errors.Is(err, xtreamapi.ErrEmptyAnswer):
+            // Players get the shaped fallback Action returned with the error
+            reqLog(ctx).WarnLog("Action\t%s: %v, serving an empty answer", action, err)
+        default:
+            abortError(ctx, httpcode, errCodeUpstreamError, fmt.Sprintf("Xtream backend failed for action: %s", action), err)
+            return
+        }
+    } else {
+        storeLastGood(action, q, resp)
     }
 
     if contentType == "application/json" {
         if s, ok := resp.(string); ok && strings.TrimSpace(s) == "" {
-            ctx.AbortWithError(http.StatusBadGateway, utils.PrintErrorAndReturn(fmt.Errorf("Xtream backend returned empty JSON response for action: %s", action)))
+            abortJSON(ctx, http.StatusBadGateway, errCodeUpstreamEmptyResponse, fmt.Sprintf("Xtream backend returned empty JSON response for action: %s", action))
             return
         }
         if b, ok := resp.([]byte); ok && len(bytes.TrimSpace(b)) == 0 {
-            ctx.AbortWithError(http.StatusBadGateway, utils.PrintErrorAndReturn(fmt.Errorf("Xtream backend returned empty JSON response for action: %s", action)))
+            abortJSON(ctx, http.StatusBadGateway, errCodeUpstreamEmptyResponse, fmt.Sprintf("Xtream backend returned empty JSON response for action: %s", action))
             return
         }
     }
 
-    utils.InfoLog("Action\t%s requested by %s", action, ctx.ClientIP())
+    reqLog(ctx).InfoLog("Action\t%s requested by %s", action, ctx.ClientIP())
     processedResp := xproc.ProcessResponse(resp)
+    // Info answers mix ints and numeric strings across providers
+    processedResp = xtreamapi.NormalizeInfo(action, processedResp)
+    if action == "get_simple_data_table" {
+        processedResp = c.decorateSimpleDataTable(processedResp, q.Get("stream_id"))
+    }
 
     if config.CacheFolder != "" {
         readableJSON, _ := json.Marshal(processedResp)
@@ -193,12 +236,12 @@ func (c *Config) xtreamPlayerAPIGET(ctx *gin.Context) { c.xtreamPlayerAPI(ctx, c
 func (c *Config) xtreamPlayerAPIPOST(ctx *gin.Context) {
     contents, err := ioutil.ReadAll(ctx.Request.Body)
     if err != nil {
-        ctx.AbortWithError(http.StatusInternalServerError, utils.PrintErrorAndReturn(err))
+        abortError(ctx, http.StatusInternalServerError, errCodeInternal, "Could not read request body", err)
         return
     }
     q, err := url.ParseQuery(string(contents))
     if err != nil {
-        ctx.AbortWithError(http.StatusInternalServerError, utils.PrintErrorAndReturn(err))
+        abortError(ctx, http.StatusBadRequest, errCodeBadRequest, "Invalid form body", err)
         return
     }
     c.xtreamPlayerAPI(ctx, q)
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lucasduport/stream-share/pkg/config"
+)
+
+// TestPlayerAPIPanelActions checks that account panel actions are answered
+// locally, and that unknown actions are forwarded only when passthrough is on.
+func TestPlayerAPIPanelActions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("API_CACHE_SECONDS", "0")
+	old := config.CacheFolder
+	config.CacheFolder = ""
+	t.Cleanup(func() { config.CacheFolder = old })
+
+	var hits atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Write([]byte(`{"provider":"answer"}`)) // nolint: errcheck
+	}))
+	defer upstream.Close()
+
+	c := &Config{ProxyConfig: &config.ProxyConfig{
+		HostConfig:     &config.HostConfiguration{Hostname: "iptv.example", Port: 8080},
+		AdvertisedPort: 8080,
+		XtreamBaseURL:  upstream.URL,
+		XtreamUser:     "provider-user",
+		XtreamPassword: "provider-secret",
+		User:           "alice",
+		Password:       "local",
+	}}
+
+	tests := []struct {
+		name, action, passthrough string
+		wantKeys                  []string
+		wantBody                  string // exact body, when set
+		wantForwarded             bool
+	}{
+		{name: "account info", action: "get_account_info", wantKeys: []string{"server_info", "user_info"}},
+		{name: "user info", action: "get_user_info", wantKeys: []string{"user_info"}},
+		{name: "server info", action: "get_server_info", wantKeys: []string{"server_info"}},
+		{name: "unknown list action not forwarded", action: "get_radio_list", passthrough: "false", wantBody: "[]"},
+		{name: "unknown action not forwarded", action: "get_reseller", passthrough: "false", wantBody: "{}"},
+		{name: "unknown action forwarded", action: "get_reseller", passthrough: "true", wantKeys: []string{"provider"}, wantForwarded: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("XTREAM_PASSTHROUGH_ACTIONS", tt.passthrough)
+			hits.Store(0)
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			ctx.Request = httptest.NewRequest(http.MethodGet, "/player_api.php", nil)
+			c.xtreamPlayerAPI(ctx, url.Values{"action": {tt.action}})
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body.String())
+			}
+			if forwarded := hits.Load() > 0; forwarded != tt.wantForwarded {
+				t.Errorf("forwarded = %v, want %v", forwarded, tt.wantForwarded)
+			}
+			if strings.Contains(w.Body.String(), "provider-secret") || strings.Contains(w.Body.String(), "provider-user") {
+				t.Errorf("body exposes the provider credentials: %s", w.Body.String())
+			}
+			if tt.wantBody != "" {
+				if got := strings.TrimSpace(w.Body.String()); got != tt.wantBody {
+					t.Errorf("body = %s, want %s", got, tt.wantBody)
+				}
+				return
+			}
+			var got map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("body %q: %v", w.Body.String(), err)
+			}
+			if len(got) != len(tt.wantKeys) {
+				t.Errorf("keys = %v, want %v", got, tt.wantKeys)
+			}
+			for _, k := range tt.wantKeys {
+				if _, ok := got[k]; !ok {
+					t.Errorf("missing %q in %v", k, got)
+				}
+			}
+			if ui, ok := got["user_info"].(map[string]interface{}); ok && ui["username"] != "alice" {
+				t.Errorf("user_info.username = %v, want alice", ui["username"])
+			}
+		})
+	}
+}
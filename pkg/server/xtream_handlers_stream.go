@@ -35,8 +35,7 @@ import (
     "errors"
 
     "github.com/gin-gonic/gin"
-    "github.com/jamesnetherton/m3u"
-    "github.com/lucasduport/stream-share/pkg/types"
+    "github.com/lucasduport/stream-share/pkg/session"
     "github.com/lucasduport/stream-share/pkg/utils"
     xtreamapi "github.com/lucasduport/stream-share/pkg/xtream"
 )
@@ -46,24 +45,32 @@ func (c *Config) xtreamApiGet(ctx *gin.Context) {
 		apiGet = "apiget"
 	)
 
+	groups, ok := requestGroupFilter(ctx)
+	if !ok {
+		return
+	}
 	var (
 		extension = ctx.Query("output")
 		cacheName = apiGet + extension
 	)
 
+	refresh := forcedPlaylistRefresh(ctx)
+
 	xtreamM3uCacheLock.RLock()
 	meta, ok := xtreamM3uCache[cacheName]
 	d := time.Since(meta.Time)
-	if !ok || d.Hours() >= float64(c.M3UCacheExpiration) {
+	if !ok || refresh || d.Hours() >= float64(c.M3UCacheExpiration) {
 		log.Printf("[stream-share] %v | %s | xtream cache API m3u file\n", time.Now().Format("2006/01/02 - 15:04:05"), ctx.ClientIP())
 		xtreamM3uCacheLock.RUnlock()
-		playlist, err := c.xtreamGenerateM3u(ctx, extension)
+		err := m3uFlights.do(cacheName, func() error {
+			playlist, err := c.xtreamGenerateM3u(reqLog(ctx), extension)
+			if err != nil {
+				return err
+			}
+			return c.cacheXtreamM3u(playlist, cacheName)
+		})
 		if err != nil {
-			ctx.AbortWithError(http.StatusInternalServerError, utils.PrintErrorAndReturn(err)) // nolint: errcheck
-			return
-		}
-		if err := c.cacheXtreamM3u(playlist, cacheName); err != nil {
-			ctx.AbortWithError(http.StatusInternalServerError, utils.PrintErrorAndReturn(err)) // nolint: errcheck
+			abortPlaylistError(ctx, err)
 			return
 		}
 	} else {
@@ -76,92 +83,86 @@ func (c *Config) xtreamApiGet(ctx *gin.Context) {
 	xtreamM3uCacheLock.RUnlock()
 	ctx.Header("Content-Type", "application/octet-stream")
 
-	ctx.File(path)
+	serveFilteredPlaylist(ctx, path, groups)
 
 }
 
 // Prefer multiplexed streaming if enabled via env, otherwise fall back to legacy stream
 // xtreamStream proxies streams; can switch to multiplexed mode via env flag.
 func (c *Config) xtreamStream(ctx *gin.Context, oriURL *url.URL) {
-    utils.DebugLog("-> Xtream streaming request: %s", ctx.Request.URL.Path)
-    utils.DebugLog("-> Proxying to Xtream upstream: %s", oriURL.String())
+    reqLog(ctx).DebugLog("-> Xtream streaming request: %s", ctx.Request.URL.Path)
+    reqLog(ctx).DebugLog("-> Proxying to Xtream upstream: %s", oriURL.String())
 
     if c.sessionManager != nil && os.Getenv("FORCE_MULTIPLEXING") == "true" {
-        utils.DebugLog("Using multiplexed streaming (FORCE_MULTIPLEXING=true)")
+        reqLog(ctx).DebugLog("Using multiplexed streaming (FORCE_MULTIPLEXING=true)")
         c.multiplexedStream(ctx, oriURL)
         return
     }
 
-    utils.DebugLog("Xtream backend request using Xtream credentials: user=%s, password=%s, baseURL=%s", c.XtreamUser.String(), c.XtreamPassword.String(), c.XtreamBaseURL)
+    reqLog(ctx).DebugLog("Xtream backend request using Xtream credentials: user=%s, password=%s, baseURL=%s", c.XtreamUser.String(), c.XtreamPassword.String(), c.XtreamBaseURL)
     rawURL := fmt.Sprintf("%s/get.php?username=%s&password=%s", c.XtreamBaseURL, c.XtreamUser, c.XtreamPassword)
 
+    groups, ok := requestGroupFilter(ctx)
+    if !ok { return }
     q := ctx.Request.URL.Query()
     for k, v := range q {
-        if k == "username" || k == "password" { continue }
+        if k == "username" || k == "password" || isGroupFilterParam(k) { continue }
         rawURL = fmt.Sprintf("%s&%s=%s", rawURL, k, strings.Join(v, ","))
     }
 
     m3uURL, err := url.Parse(rawURL)
-    if err != nil { ctx.AbortWithError(http.StatusInternalServerError, utils.PrintErrorAndReturn(err)); return }
+    if err != nil { abortError(ctx, http.StatusInternalServerError, errCodeInternal, "Could not build upstream URL", err); return }
+    cacheName := m3uURL.String()
 
     xtreamM3uCacheLock.RLock()
-    meta, ok := xtreamM3uCache[m3uURL.String()]
+    meta, ok := xtreamM3uCache[cacheName]
     d := time.Since(meta.Time)
     if !ok || d.Hours() >= float64(c.M3UCacheExpiration) {
-        utils.InfoLog("xtream cache m3u file refresh requested by %s", ctx.ClientIP())
+        reqLog(ctx).InfoLog("xtream cache m3u file refresh requested by %s", ctx.ClientIP())
         xtreamM3uCacheLock.RUnlock()
-        playlist, err := m3u.Parse(m3uURL.String())
-        if err != nil { ctx.AbortWithError(http.StatusInternalServerError, utils.PrintErrorAndReturn(err)); return }
-        if len(playlist.Tracks) == 0 { ctx.AbortWithError(http.StatusBadGateway, utils.PrintErrorAndReturn(fmt.Errorf("Xtream backend returned empty playlist"))); return }
-        if err := c.cacheXtreamM3u(&playlist, m3uURL.String()); err != nil { ctx.AbortWithError(http.StatusInternalServerError, utils.PrintErrorAndReturn(err)); return }
+        if err := c.refreshXtreamGetM3u(cacheName); err != nil { abortPlaylistError(ctx, err); return }
     } else {
         xtreamM3uCacheLock.RUnlock()
     }
 
     ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename=%q`, c.M3UFileName))
     xtreamM3uCacheLock.RLock()
-    path := xtreamM3uCache[m3uURL.String()].string
+    path := xtreamM3uCache[cacheName].string
     xtreamM3uCacheLock.RUnlock()
     ctx.Header("Content-Type", "application/octet-stream")
-    ctx.File(path)
+    serveFilteredPlaylist(ctx, path, groups)
 }
 
 func (c *Config) xtreamXMLTV(ctx *gin.Context) {
-    client, err := xtreamapi.New(c.XtreamUser.String(), c.XtreamPassword.String(), c.XtreamBaseURL, ctx.Request.UserAgent())
-    if err != nil { ctx.AbortWithError(http.StatusInternalServerError, utils.PrintErrorAndReturn(err)); return }
+    client, err := xtreamapi.New(c.XtreamUser.String(), c.XtreamPassword.String(), c.XtreamBaseURL, utils.UserAgentFor(c.XtreamBaseURL))
+    if err != nil { abortError(ctx, http.StatusInternalServerError, errCodeUpstreamError, "Could not reach Xtream backend", err); return }
     resp, err := client.GetXMLTV()
-    if err != nil { ctx.AbortWithError(http.StatusInternalServerError, utils.PrintErrorAndReturn(err)); return }
+    if err != nil { abortError(ctx, http.StatusInternalServerError, errCodeUpstreamError, "Could not fetch XMLTV guide", err); return }
     ctx.Data(http.StatusOK, "application/xml", resp)
 }
 
 func (c *Config) xtreamStreamHandler(ctx *gin.Context) {
     id := ctx.Param("id")
     rpURL, err := url.Parse(fmt.Sprintf("%s/%s/%s/%s", c.XtreamBaseURL, c.XtreamUser, c.XtreamPassword, id))
-    if err != nil { ctx.AbortWithError(http.StatusInternalServerError, utils.PrintErrorAndReturn(err)); return }
+    if err != nil { abortError(ctx, http.StatusInternalServerError, errCodeInternal, "Could not build upstream URL", err); return }
     c.xtreamStream(ctx, rpURL)
 }
 
 func (c *Config) xtreamStreamLive(ctx *gin.Context) {
-    id := ctx.Param("id")
-    rpURL, err := url.Parse(fmt.Sprintf("%s/live/%s/%s/%s", c.XtreamBaseURL, c.XtreamUser, c.XtreamPassword, id))
-    if err != nil { ctx.AbortWithError(http.StatusInternalServerError, utils.PrintErrorAndReturn(err)); return }
-    c.xtreamStream(ctx, rpURL)
+    c.serveLive(ctx, ctx.Param("id"), func(u *url.URL) { c.xtreamStream(ctx, u) })
 }
 
 func (c *Config) xtreamStreamPlay(ctx *gin.Context) {
     token := ctx.Param("token")
     t := ctx.Param("type")
     rpURL, err := url.Parse(fmt.Sprintf("%s/play/%s/%s", c.XtreamBaseURL, token, t))
-    if err != nil { ctx.AbortWithError(http.StatusInternalServerError, utils.PrintErrorAndReturn(err)); return }
+    if err != nil { abortError(ctx, http.StatusInternalServerError, errCodeInternal, "Could not build upstream URL", err); return }
     c.xtreamStream(ctx, rpURL)
 }
 
 func (c *Config) xtreamStreamTimeshift(ctx *gin.Context) {
-    duration := ctx.Param("duration")
-    start := ctx.Param("start")
-    id := ctx.Param("id")
-    rpURL, err := url.Parse(fmt.Sprintf("%s/timeshift/%s/%s/%s/%s/%s", c.XtreamBaseURL, c.XtreamUser, c.XtreamPassword, duration, start, id))
-    if err != nil { ctx.AbortWithError(http.StatusInternalServerError, utils.PrintErrorAndReturn(err)); return }
+    rpURL := c.timeshiftUpstreamURL(ctx)
+    if rpURL == nil { return }
     c.stream(ctx, rpURL)
 }
 
@@ -170,19 +171,19 @@ func (c *Config) xtreamStreamMovie(ctx *gin.Context) {
     // Normalize DB key: cached entries are stored by bare stream_id without extension
     idRaw := strings.TrimSuffix(id, path.Ext(id))
     if c.db != nil {
-        if entry, err := c.db.GetVODCache(idRaw); err == nil && entry != nil {
+        if entry, err := c.db.GetVODCache(c.db.Provider(), idRaw); err == nil && entry != nil {
             // If file exists and is ready, serve locally; if downloading, serve progressively from .part
             if fi, statErr := os.Stat(entry.FilePath); statErr == nil && !fi.IsDir() {
                 var ct string
                 if ext := strings.ToLower(path.Ext(entry.FilePath)); ext == ".ts" { ct = "video/mp2t" } else if ext == ".mkv" { ct = "video/x-matroska" } else { ct = "video/mp4" }
-                c.db.TouchVODCache(idRaw)
+                c.db.TouchVODCache(c.db.Provider(), idRaw)
                 if strings.ToLower(entry.Status) == "ready" {
-                    utils.InfoLog("Serving cached movie for %s from %s", idRaw, entry.FilePath)
+                    reqLog(ctx).InfoLog("Serving cached movie for %s from %s", idRaw, entry.FilePath)
                     serveLocalFileRange(ctx, entry.FilePath, ct, "", false)
                     return
                 }
                 // Progressive serving from growing file
-                utils.InfoLog("Serving progressively from cache (downloading) for %s from %s", idRaw, entry.FilePath)
+                reqLog(ctx).InfoLog("Serving progressively from cache (downloading) for %s from %s", idRaw, entry.FilePath)
                 serveGrowingFileRange(ctx, entry.FilePath, ct, "", false, entry.TotalBytes)
                 return
             }
@@ -190,31 +191,24 @@ func (c *Config) xtreamStreamMovie(ctx *gin.Context) {
         // Not cached yet: auto-start 7-day caching in background and serve progressively
         // Determine extension from cached M3U if available, fallback to .mp4
         basePath := "movie"
-        resolvedExt := c.findVODExtensionInCache(basePath, idRaw)
+        resolvedExt := c.streamVODExtension(reqLog(ctx), basePath, idRaw, ".mp4")
         finalID := idRaw
-        if resolvedExt == "" { resolvedExt = ".mp4" }
         finalID += resolvedExt
         upstream := fmt.Sprintf("%s/%s/%s/%s/%s", c.XtreamBaseURL, basePath, c.XtreamUser, c.XtreamPassword, finalID)
-        cacheDir := strings.TrimSpace(os.Getenv("CACHE_FOLDER"))
-        if cacheDir == "" { cacheDir = filepath.Join(os.TempDir(), "stream-share-cache") }
-        _ = os.MkdirAll(cacheDir, 0o755)
-        dest := filepath.Join(cacheDir, idRaw+resolvedExt)
+        dest := filepath.Join(cacheDir(), cacheFileName(c.db.Provider(), idRaw+resolvedExt))
         expires := time.Now().Add(7 * 24 * time.Hour)
-        // Insert pending entry
-        _ = c.db.UpsertVODCache(&types.VODCacheEntry{StreamID: idRaw, Type: "movie", FilePath: dest, Status: "downloading", ExpiresAt: expires, CreatedAt: time.Now()})
-        // Start background download only if not already in progress
-        if _, err := os.Stat(dest+".part"); err != nil {
-            go c.fetchToFile(upstream, dest, idRaw, expires)
+        if c.autoCache(reqLog(ctx), idRaw, "movie", upstream, dest, expires) {
+            // Serve progressively from growing file
+            var ct string
+            if ext := strings.ToLower(path.Ext(dest)); ext == ".ts" { ct = "video/mp2t" } else if ext == ".mkv" { ct = "video/x-matroska" } else { ct = "video/mp4" }
+            serveGrowingFileRange(ctx, dest, ct, "", false, 0)
+            return
         }
-        // Serve progressively from growing file
-        var ct string
-        if ext := strings.ToLower(path.Ext(dest)); ext == ".ts" { ct = "video/mp2t" } else if ext == ".mkv" { ct = "video/x-matroska" } else { ct = "video/mp4" }
-        serveGrowingFileRange(ctx, dest, ct, "", false, 0)
-        return
+        // Queued behind MAX_CONCURRENT_CACHE_DOWNLOADS: stream from the provider meanwhile
     }
     rpURL, err := url.Parse(fmt.Sprintf("%s/movie/%s/%s/%s", c.XtreamBaseURL, c.XtreamUser, c.XtreamPassword, id))
-    if err != nil { ctx.AbortWithError(http.StatusInternalServerError, utils.PrintErrorAndReturn(err)); return }
-    utils.DebugLog("Movie streaming request - using Xtream credentials for upstream: %s", rpURL.String())
+    if err != nil { abortError(ctx, http.StatusInternalServerError, errCodeInternal, "Could not build upstream URL", err); return }
+    reqLog(ctx).DebugLog("Movie streaming request - using Xtream credentials for upstream: %s", rpURL.String())
     c.xtreamStream(ctx, rpURL)
 }
 
@@ -222,152 +216,138 @@ func (c *Config) xtreamStreamSeries(ctx *gin.Context) {
     id := ctx.Param("id")
     idRaw := strings.TrimSuffix(id, path.Ext(id))
     if c.db != nil {
-        if entry, err := c.db.GetVODCache(idRaw); err == nil && entry != nil {
+        if entry, err := c.db.GetVODCache(c.db.Provider(), idRaw); err == nil && entry != nil {
             if fi, statErr := os.Stat(entry.FilePath); statErr == nil && !fi.IsDir() {
                 var ct string
                 if ext := strings.ToLower(path.Ext(entry.FilePath)); ext == ".ts" { ct = "video/mp2t" } else if ext == ".mkv" { ct = "video/x-matroska" } else { ct = "video/mp4" }
-                c.db.TouchVODCache(idRaw)
+                c.db.TouchVODCache(c.db.Provider(), idRaw)
                 if strings.ToLower(entry.Status) == "ready" {
-                    utils.InfoLog("Serving cached episode for %s from %s", idRaw, entry.FilePath)
+                    reqLog(ctx).InfoLog("Serving cached episode for %s from %s", idRaw, entry.FilePath)
                     serveLocalFileRange(ctx, entry.FilePath, ct, "", false)
                     return
                 }
-                utils.InfoLog("Serving progressively from cache (downloading) for %s from %s", idRaw, entry.FilePath)
+                reqLog(ctx).InfoLog("Serving progressively from cache (downloading) for %s from %s", idRaw, entry.FilePath)
                 serveGrowingFileRange(ctx, entry.FilePath, ct, "", false, entry.TotalBytes)
                 return
             }
         }
         // Not cached yet: auto-start 7-day caching in background
         basePath := "series"
-        resolvedExt := c.findVODExtensionInCache(basePath, idRaw)
+        resolvedExt := c.streamVODExtension(reqLog(ctx), basePath, idRaw, ".mkv")
         finalID := idRaw
-        if resolvedExt == "" { resolvedExt = ".mkv" }
         finalID += resolvedExt
         upstream := fmt.Sprintf("%s/%s/%s/%s/%s", c.XtreamBaseURL, basePath, c.XtreamUser, c.XtreamPassword, finalID)
-        cacheDir := strings.TrimSpace(os.Getenv("CACHE_FOLDER"))
-        if cacheDir == "" { cacheDir = filepath.Join(os.TempDir(), "stream-share-cache") }
-        _ = os.MkdirAll(cacheDir, 0o755)
-        dest := filepath.Join(cacheDir, idRaw+resolvedExt)
+        dest := filepath.Join(cacheDir(), cacheFileName(c.db.Provider(), idRaw+resolvedExt))
         expires := time.Now().Add(7 * 24 * time.Hour)
-        _ = c.db.UpsertVODCache(&types.VODCacheEntry{StreamID: idRaw, Type: "series", FilePath: dest, Status: "downloading", ExpiresAt: expires, CreatedAt: time.Now()})
-        if _, err := os.Stat(dest+".part"); err != nil {
-            go c.fetchToFile(upstream, dest, idRaw, expires)
+        if c.autoCache(reqLog(ctx), idRaw, "series", upstream, dest, expires) {
+            // Serve progressively from growing file
+            var ct string
+            if ext := strings.ToLower(path.Ext(dest)); ext == ".ts" { ct = "video/mp2t" } else if ext == ".mkv" { ct = "video/x-matroska" } else { ct = "video/mp4" }
+            serveGrowingFileRange(ctx, dest, ct, "", false, 0)
+            return
         }
-        var ct string
-        if ext := strings.ToLower(path.Ext(dest)); ext == ".ts" { ct = "video/mp2t" } else if ext == ".mkv" { ct = "video/x-matroska" } else { ct = "video/mp4" }
-        serveGrowingFileRange(ctx, dest, ct, "", false, 0)
-        return
+        // Queued behind MAX_CONCURRENT_CACHE_DOWNLOADS: stream from the provider meanwhile
     }
     rpURL, err := url.Parse(fmt.Sprintf("%s/series/%s/%s/%s", c.XtreamBaseURL, c.XtreamUser, c.XtreamPassword, id))
-    if err != nil { ctx.AbortWithError(http.StatusInternalServerError, utils.PrintErrorAndReturn(err)); return }
+    if err != nil { abortError(ctx, http.StatusInternalServerError, errCodeInternal, "Could not build upstream URL", err); return }
     c.xtreamStream(ctx, rpURL)
 }
 
 // Direct handlers using proxy credentials
 func (c *Config) xtreamProxyCredentialsStreamHandler(ctx *gin.Context) {
     id := ctx.Param("id")
-    utils.DebugLog("Direct stream request with proxy credentials: username=%s, id=%s", ctx.Param("username"), id)
+    reqLog(ctx).DebugLog("Direct stream request with proxy credentials: username=%s, id=%s", ctx.Param("username"), id)
     rpURL, err := url.Parse(fmt.Sprintf("%s/%s/%s/%s", c.XtreamBaseURL, c.XtreamUser, c.XtreamPassword, id))
-    if err != nil { utils.ErrorLog("Failed to parse upstream URL: %v", err); ctx.AbortWithStatus(500); return }
+    if err != nil { abortError(ctx, http.StatusInternalServerError, errCodeInternal, "Could not build upstream URL", err); return }
     c.multiplexedStream(ctx, rpURL)
 }
 
 func (c *Config) xtreamProxyCredentialsLiveStreamHandler(ctx *gin.Context) {
     id := ctx.Param("id")
-    utils.DebugLog("Direct live stream request with proxy credentials: username=%s, id=%s", ctx.Param("username"), id)
-    rpURL, err := url.Parse(fmt.Sprintf("%s/live/%s/%s/%s", c.XtreamBaseURL, c.XtreamUser, c.XtreamPassword, id))
-    if err != nil { utils.ErrorLog("Failed to parse upstream URL: %v", err); ctx.AbortWithStatus(500); return }
-    c.multiplexedStream(ctx, rpURL)
+    reqLog(ctx).DebugLog("Direct live stream request with proxy credentials: username=%s, id=%s", ctx.Param("username"), id)
+    c.serveLive(ctx, id, func(u *url.URL) { c.multiplexedStream(ctx, u) })
 }
 
 func (c *Config) xtreamProxyCredentialsMovieStreamHandler(ctx *gin.Context) {
     id := ctx.Param("id")
     idRaw := strings.TrimSuffix(id, path.Ext(id))
-    utils.DebugLog("Direct movie stream request with proxy credentials: username=%s, id=%s", ctx.Param("username"), id)
+    reqLog(ctx).DebugLog("Direct movie stream request with proxy credentials: username=%s, id=%s", ctx.Param("username"), id)
     if c.db != nil {
-        if entry, err := c.db.GetVODCache(idRaw); err == nil && entry != nil {
+        if entry, err := c.db.GetVODCache(c.db.Provider(), idRaw); err == nil && entry != nil {
             if fi, statErr := os.Stat(entry.FilePath); statErr == nil && !fi.IsDir() {
                 var ct string
                 if ext := strings.ToLower(path.Ext(entry.FilePath)); ext == ".ts" { ct = "video/mp2t" } else if ext == ".mkv" { ct = "video/x-matroska" } else { ct = "video/mp4" }
-                c.db.TouchVODCache(idRaw)
+                c.db.TouchVODCache(c.db.Provider(), idRaw)
                 if strings.ToLower(entry.Status) == "ready" {
-                    utils.InfoLog("Serving cached movie (proxy creds path) for %s from %s", idRaw, entry.FilePath)
+                    reqLog(ctx).InfoLog("Serving cached movie (proxy creds path) for %s from %s", idRaw, entry.FilePath)
                     serveLocalFileRange(ctx, entry.FilePath, ct, "", false)
                     return
                 }
-                utils.InfoLog("Serving progressively from cache (downloading, proxy creds) for %s from %s", idRaw, entry.FilePath)
+                reqLog(ctx).InfoLog("Serving progressively from cache (downloading, proxy creds) for %s from %s", idRaw, entry.FilePath)
                 serveGrowingFileRange(ctx, entry.FilePath, ct, "", false, entry.TotalBytes)
                 return
             }
         }
         // Auto-start caching and serve progressively
         basePath := "movie"
-        resolvedExt := c.findVODExtensionInCache(basePath, idRaw)
+        resolvedExt := c.streamVODExtension(reqLog(ctx), basePath, idRaw, ".mp4")
         finalID := idRaw
-        if resolvedExt == "" { resolvedExt = ".mp4" }
         finalID += resolvedExt
         upstream := fmt.Sprintf("%s/%s/%s/%s/%s", c.XtreamBaseURL, basePath, c.XtreamUser, c.XtreamPassword, finalID)
-        cacheDir := strings.TrimSpace(os.Getenv("CACHE_FOLDER"))
-        if cacheDir == "" { cacheDir = filepath.Join(os.TempDir(), "stream-share-cache") }
-        _ = os.MkdirAll(cacheDir, 0o755)
-        dest := filepath.Join(cacheDir, idRaw+resolvedExt)
+        dest := filepath.Join(cacheDir(), cacheFileName(c.db.Provider(), idRaw+resolvedExt))
         expires := time.Now().Add(7 * 24 * time.Hour)
-        _ = c.db.UpsertVODCache(&types.VODCacheEntry{StreamID: idRaw, Type: "movie", FilePath: dest, Status: "downloading", ExpiresAt: expires, CreatedAt: time.Now()})
-        if _, err := os.Stat(dest+".part"); err != nil {
-            go c.fetchToFile(upstream, dest, idRaw, expires)
+        if c.autoCache(reqLog(ctx), idRaw, "movie", upstream, dest, expires) {
+            // Serve progressively from growing file
+            var ct string
+            if ext := strings.ToLower(path.Ext(dest)); ext == ".ts" { ct = "video/mp2t" } else if ext == ".mkv" { ct = "video/x-matroska" } else { ct = "video/mp4" }
+            serveGrowingFileRange(ctx, dest, ct, "", false, 0)
+            return
         }
-        var ct string
-        if ext := strings.ToLower(path.Ext(dest)); ext == ".ts" { ct = "video/mp2t" } else if ext == ".mkv" { ct = "video/x-matroska" } else { ct = "video/mp4" }
-        serveGrowingFileRange(ctx, dest, ct, "", false, 0)
-        return
+        // Queued behind MAX_CONCURRENT_CACHE_DOWNLOADS: stream from the provider meanwhile
     }
     rpURL, err := url.Parse(fmt.Sprintf("%s/movie/%s/%s/%s", c.XtreamBaseURL, c.XtreamUser, c.XtreamPassword, id))
-    if err != nil { utils.ErrorLog("Failed to parse upstream URL: %v", err); ctx.AbortWithStatus(500); return }
+    if err != nil { abortError(ctx, http.StatusInternalServerError, errCodeInternal, "Could not build upstream URL", err); return }
     c.multiplexedStream(ctx, rpURL)
 }
 
 func (c *Config) xtreamProxyCredentialsSeriesStreamHandler(ctx *gin.Context) {
     id := ctx.Param("id")
     idRaw := strings.TrimSuffix(id, path.Ext(id))
-    utils.DebugLog("Direct series stream request with proxy credentials: username=%s, id=%s", ctx.Param("username"), id)
+    reqLog(ctx).DebugLog("Direct series stream request with proxy credentials: username=%s, id=%s", ctx.Param("username"), id)
     if c.db != nil {
-        if entry, err := c.db.GetVODCache(idRaw); err == nil && entry != nil {
+        if entry, err := c.db.GetVODCache(c.db.Provider(), idRaw); err == nil && entry != nil {
             if fi, statErr := os.Stat(entry.FilePath); statErr == nil && !fi.IsDir() {
                 var ct string
                 if ext := strings.ToLower(path.Ext(entry.FilePath)); ext == ".ts" { ct = "video/mp2t" } else if ext == ".mkv" { ct = "video/x-matroska" } else { ct = "video/mp4" }
-                c.db.TouchVODCache(idRaw)
+                c.db.TouchVODCache(c.db.Provider(), idRaw)
                 if strings.ToLower(entry.Status) == "ready" {
-                    utils.InfoLog("Serving cached episode (proxy creds path) for %s from %s", idRaw, entry.FilePath)
+                    reqLog(ctx).InfoLog("Serving cached episode (proxy creds path) for %s from %s", idRaw, entry.FilePath)
                     serveLocalFileRange(ctx, entry.FilePath, ct, "", false)
                     return
                 }
-                utils.InfoLog("Serving progressively from cache (downloading, proxy creds) for %s from %s", idRaw, entry.FilePath)
+                reqLog(ctx).InfoLog("Serving progressively from cache (downloading, proxy creds) for %s from %s", idRaw, entry.FilePath)
                 serveGrowingFileRange(ctx, entry.FilePath, ct, "", false, entry.TotalBytes)
                 return
             }
         }
         basePath := "series"
-        resolvedExt := c.findVODExtensionInCache(basePath, idRaw)
+        resolvedExt := c.streamVODExtension(reqLog(ctx), basePath, idRaw, ".mkv")
         finalID := idRaw
-        if resolvedExt == "" { resolvedExt = ".mkv" }
         finalID += resolvedExt
         upstream := fmt.Sprintf("%s/%s/%s/%s/%s", c.XtreamBaseURL, basePath, c.XtreamUser, c.XtreamPassword, finalID)
-        cacheDir := strings.TrimSpace(os.Getenv("CACHE_FOLDER"))
-        if cacheDir == "" { cacheDir = filepath.Join(os.TempDir(), "stream-share-cache") }
-        _ = os.MkdirAll(cacheDir, 0o755)
-        dest := filepath.Join(cacheDir, idRaw+resolvedExt)
+        dest := filepath.Join(cacheDir(), cacheFileName(c.db.Provider(), idRaw+resolvedExt))
         expires := time.Now().Add(7 * 24 * time.Hour)
-        _ = c.db.UpsertVODCache(&types.VODCacheEntry{StreamID: idRaw, Type: "series", FilePath: dest, Status: "downloading", ExpiresAt: expires, CreatedAt: time.Now()})
-        if _, err := os.Stat(dest+".part"); err != nil {
-            go c.fetchToFile(upstream, dest, idRaw, expires)
+        if c.autoCache(reqLog(ctx), idRaw, "series", upstream, dest, expires) {
+            // Serve progressively from growing file
+            var ct string
+            if ext := strings.ToLower(path.Ext(dest)); ext == ".ts" { ct = "video/mp2t" } else if ext == ".mkv" { ct = "video/x-matroska" } else { ct = "video/mp4" }
+            serveGrowingFileRange(ctx, dest, ct, "", false, 0)
+            return
         }
-        var ct string
-        if ext := strings.ToLower(path.Ext(dest)); ext == ".ts" { ct = "video/mp2t" } else if ext == ".mkv" { ct = "video/x-matroska" } else { ct = "video/mp4" }
-        serveGrowingFileRange(ctx, dest, ct, "", false, 0)
-        return
+        // Queued behind MAX_CONCURRENT_CACHE_DOWNLOADS: stream from the provider meanwhile
     }
     rpURL, err := url.Parse(fmt.Sprintf("%s/series/%s/%s/%s", c.XtreamBaseURL, c.XtreamUser, c.XtreamPassword, id))
-    if err != nil { utils.ErrorLog("Failed to parse upstream URL: %v", err); ctx.AbortWithStatus(500); return }
+    if err != nil { abortError(ctx, http.StatusInternalServerError, errCodeInternal, "Could not build upstream URL", err); return }
     c.multiplexedStream(ctx, rpURL)
 }
 
@@ -379,99 +359,126 @@ func (c *Config) xtreamHlsStream(ctx *gin.Context) {
     chunk := ctx.Param("chunk")
     s := strings.Split(chunk, "_")
     if len(s) != 2 {
-        ctx.AbortWithError(http.StatusInternalServerError, utils.PrintErrorAndReturn(errors.New("HSL malformed chunk")))
+        abortJSON(ctx, http.StatusBadRequest, errCodeInvalidParameter, "HLS malformed chunk")
         return
     }
     channel := s[0]
 
     redirURL, err := getHlsRedirectURL(channel)
-    if err != nil { ctx.AbortWithError(http.StatusInternalServerError, utils.PrintErrorAndReturn(err)); return }
+    if err != nil { abortJSON(ctx, http.StatusNotFound, errCodeNotFound, "Unknown HLS channel"); return }
 
     req, reqErr := http.NewRequestWithContext(ctx.Request.Context(), "GET", fmt.Sprintf("%s://%s/hls/%s/%s", redirURL.Scheme, redirURL.Host, ctx.Param("token"), ctx.Param("chunk")), nil)
-    if reqErr != nil { ctx.AbortWithError(http.StatusInternalServerError, utils.PrintErrorAndReturn(reqErr)); return }
+    if reqErr != nil { abortError(ctx, http.StatusInternalServerError, errCodeInternal, "Could not build upstream request", reqErr); return }
 
     mergeHttpHeader(req.Header, ctx.Request.Header)
 
     resp, doErr := http.DefaultClient.Do(req)
-    if doErr != nil { ctx.AbortWithError(http.StatusInternalServerError, utils.PrintErrorAndReturn(doErr)); return }
+    if doErr != nil { abortError(ctx, http.StatusInternalServerError, errCodeUpstreamError, "Upstream request failed", doErr); return }
     defer resp.Body.Close()
 
     if resp.StatusCode == http.StatusFound {
         loc, locErr := resp.Location()
-        if locErr != nil { ctx.AbortWithError(http.StatusInternalServerError, utils.PrintErrorAndReturn(locErr)); return }
+        if locErr != nil { abortError(ctx, http.StatusInternalServerError, errCodeUpstreamError, "Upstream returned an invalid redirect", locErr); return }
         id := ctx.Param("id")
         if strings.Contains(loc.String(), id) {
             hlsChannelsRedirectURLLock.Lock(); hlsChannelsRedirectURL[id] = *loc; hlsChannelsRedirectURLLock.Unlock()
             hlsReq, hlsReqErr := http.NewRequestWithContext(ctx.Request.Context(), "GET", loc.String(), nil)
-            if hlsReqErr != nil { ctx.AbortWithError(http.StatusInternalServerError, utils.PrintErrorAndReturn(hlsReqErr)); return }
+            if hlsReqErr != nil { abortError(ctx, http.StatusInternalServerError, errCodeInternal, "Could not build upstream request", hlsReqErr); return }
             mergeHttpHeader(hlsReq.Header, ctx.Request.Header)
             hlsResp, hlsDoErr := http.DefaultClient.Do(hlsReq)
-            if hlsDoErr != nil { ctx.AbortWithError(http.StatusInternalServerError, utils.PrintErrorAndReturn(hlsDoErr)); return }
+            if hlsDoErr != nil { abortError(ctx, http.StatusInternalServerError, errCodeUpstreamError, "Upstream request failed", hlsDoErr); return }
             defer hlsResp.Body.Close()
 
             b, readErr := ioutil.ReadAll(hlsResp.Body)
-            if readErr != nil { ctx.AbortWithError(http.StatusInternalServerError, utils.PrintErrorAndReturn(readErr)); return }
-            body := string(b)
-            body = strings.ReplaceAll(body, "/"+c.XtreamUser.String()+"/"+c.XtreamPassword.String()+"/", "/"+c.User.String()+"/"+c.Password.String()+"/")
-            utils.DebugLog("HLS stream response modified to use proxy credentials for client URLs")
+            if readErr != nil { abortError(ctx, http.StatusInternalServerError, errCodeUpstreamError, "Could not read upstream response", readErr); return }
+            body := c.rewriteHLSManifest(transformHLSManifest(loc.Path, string(b)), loc.Host)
+            c.trackHLSVariants(ctx, body)
+            reqLog(ctx).DebugLog("HLS stream response modified to use proxy credentials for client URLs")
             mergeHttpHeader(ctx.Writer.Header(), hlsResp.Header)
             ctx.Data(http.StatusOK, hlsResp.Header.Get("Content-Type"), []byte(body))
             return
         }
-        ctx.AbortWithError(http.StatusInternalServerError, utils.PrintErrorAndReturn(errors.New("Unable to HLS stream")))
+        abortJSON(ctx, http.StatusInternalServerError, errCodeUpstreamError, "Unable to HLS stream")
         return
     }
 
-    utils.DebugLog("HLS stream response status: %d", resp.StatusCode)
+    reqLog(ctx).DebugLog("HLS stream response status: %d", resp.StatusCode)
     ctx.Status(resp.StatusCode)
 }
 
 func (c *Config) hlsXtreamStream(ctx *gin.Context, oriURL *url.URL) {
-    utils.DebugLog("HLS stream request with URL: %s", oriURL.String())
+    reqLog(ctx).DebugLog("HLS stream request with URL: %s", oriURL.String())
     client := &http.Client{ CheckRedirect: func(req *http.Request, via []*http.Request) error { return http.ErrUseLastResponse } }
     req, reqErr := http.NewRequestWithContext(ctx.Request.Context(), "GET", oriURL.String(), nil)
-    if reqErr != nil { ctx.AbortWithError(http.StatusInternalServerError, utils.PrintErrorAndReturn(reqErr)); return }
+    if reqErr != nil { abortError(ctx, http.StatusInternalServerError, errCodeInternal, "Could not build upstream request", reqErr); return }
     mergeHttpHeader(req.Header, ctx.Request.Header)
     resp, doErr := client.Do(req)
-    if doErr != nil { ctx.AbortWithError(http.StatusInternalServerError, utils.PrintErrorAndReturn(doErr)); return }
+    if doErr != nil { abortError(ctx, http.StatusInternalServerError, errCodeUpstreamError, "Upstream request failed", doErr); return }
     defer resp.Body.Close()
 
     if resp.StatusCode == http.StatusFound {
         loc, locErr := resp.Location()
-        if locErr != nil { ctx.AbortWithError(http.StatusInternalServerError, utils.PrintErrorAndReturn(locErr)); return }
+        if locErr != nil { abortError(ctx, http.StatusInternalServerError, errCodeUpstreamError, "Upstream returned an invalid redirect", locErr); return }
         id := ctx.Param("id")
+        // ?output=hls requests carry a bare id; /hlsr looks channels up as <id>.m3u8
+        if id != "" && path.Ext(id) == "" { id += ".m3u8" }
         if strings.Contains(loc.String(), id) {
             hlsChannelsRedirectURLLock.Lock(); hlsChannelsRedirectURL[id] = *loc; hlsChannelsRedirectURLLock.Unlock()
             hlsReq, hlsReqErr := http.NewRequestWithContext(ctx.Request.Context(), "GET", loc.String(), nil)
-            if hlsReqErr != nil { ctx.AbortWithError(http.StatusInternalServerError, utils.PrintErrorAndReturn(hlsReqErr)); return }
+            if hlsReqErr != nil { abortError(ctx, http.StatusInternalServerError, errCodeInternal, "Could not build upstream request", hlsReqErr); return }
             mergeHttpHeader(hlsReq.Header, ctx.Request.Header)
             hlsResp, hlsDoErr := client.Do(hlsReq)
-            if hlsDoErr != nil { ctx.AbortWithError(http.StatusInternalServerError, utils.PrintErrorAndReturn(hlsDoErr)); return }
+            if hlsDoErr != nil { abortError(ctx, http.StatusInternalServerError, errCodeUpstreamError, "Upstream request failed", hlsDoErr); return }
             defer hlsResp.Body.Close()
 
             b, readErr := ioutil.ReadAll(hlsResp.Body)
-            if readErr != nil { ctx.AbortWithError(http.StatusInternalServerError, utils.PrintErrorAndReturn(readErr)); return }
-            body := string(b)
-            body = strings.ReplaceAll(body, "/"+c.XtreamUser.String()+"/"+c.XtreamPassword.String()+"/", "/"+c.User.String()+"/"+c.Password.String()+"/")
-            utils.DebugLog("HLS stream response modified to use proxy credentials for client URLs")
+            if readErr != nil { abortError(ctx, http.StatusInternalServerError, errCodeUpstreamError, "Could not read upstream response", readErr); return }
+            body := c.rewriteHLSManifest(transformHLSManifest(loc.Path, string(b)), loc.Host)
+            c.trackHLSVariants(ctx, body)
+            reqLog(ctx).DebugLog("HLS stream response modified to use proxy credentials for client URLs")
             mergeHttpHeader(ctx.Writer.Header(), hlsResp.Header)
             ctx.Data(http.StatusOK, hlsResp.Header.Get("Content-Type"), []byte(body))
             return
         }
-        ctx.AbortWithError(http.StatusInternalServerError, utils.PrintErrorAndReturn(errors.New("Unable to HLS stream")))
+        abortJSON(ctx, http.StatusInternalServerError, errCodeUpstreamError, "Unable to HLS stream")
         return
     }
 
-    utils.DebugLog("HLS stream response status: %d", resp.StatusCode)
+    // Some providers answer the manifest (or segment) directly instead of redirecting
+    if resp.StatusCode == http.StatusOK {
+        c.relayHLSResponse(ctx, resp)
+        return
+    }
+
+    reqLog(ctx).DebugLog("HLS stream response status: %d", resp.StatusCode)
     ctx.Status(resp.StatusCode)
 }
 
+// relayHLSResponse copies a 200 upstream HLS answer to the client. Manifests get
+// their URLs pointed back through the proxy; segments are streamed as is.
+func (c *Config) relayHLSResponse(ctx *gin.Context, resp *http.Response) {
+    ct := resp.Header.Get("Content-Type")
+    lct := strings.ToLower(ct)
+    if !strings.Contains(lct, "mpegurl") && !strings.HasSuffix(strings.ToLower(resp.Request.URL.Path), ".m3u8") {
+        mergeHttpHeader(ctx.Writer.Header(), resp.Header)
+        ctx.DataFromReader(http.StatusOK, resp.ContentLength, ct, resp.Body, nil)
+        return
+    }
+    b, readErr := ioutil.ReadAll(resp.Body)
+    if readErr != nil { abortError(ctx, http.StatusInternalServerError, errCodeUpstreamError, "Could not read upstream response", readErr); return }
+    body := c.rewriteHLSManifest(transformHLSManifest(resp.Request.URL.Path, string(b)), resp.Request.URL.Host)
+    c.trackHLSVariants(ctx, body)
+    mergeHttpHeader(ctx.Writer.Header(), resp.Header)
+    ctx.Header("Content-Length", strconv.Itoa(len(body)))
+    ctx.Data(http.StatusOK, ct, []byte(body))
+}
+
 func (c *Config) xtreamHlsrStream(ctx *gin.Context) {
     channel := ctx.Param("channel")
     redirURL, err := getHlsRedirectURL(channel)
-    if err != nil { ctx.AbortWithError(http.StatusInternalServerError, utils.PrintErrorAndReturn(err)); return }
+    if err != nil { abortJSON(ctx, http.StatusNotFound, errCodeNotFound, "Unknown HLS channel"); return }
     nextURL, parseErr := url.Parse(fmt.Sprintf("%s://%s/hlsr/%s/%s/%s/%s/%s/%s", redirURL.Scheme, redirURL.Host, ctx.Param("token"), c.XtreamUser, c.XtreamPassword, ctx.Param("channel"), ctx.Param("hash"), ctx.Param("chunk")))
-    if parseErr != nil { ctx.AbortWithError(http.StatusInternalServerError, utils.PrintErrorAndReturn(parseErr)); return }
+    if parseErr != nil { abortError(ctx, http.StatusInternalServerError, errCodeInternal, "Could not build upstream URL", parseErr); return }
     c.hlsXtreamStream(ctx, nextURL)
 }
 
@@ -489,6 +496,8 @@ func getHlsRedirectURL(channel string) (*url.URL, error) {
 // If a completed file exists, it behaves like serveLocalFileRange.
 // totalSize may be 0 if unknown; when known, it will be used in Content-Range.
 func serveGrowingFileRange(ctx *gin.Context, filePath string, contentType string, filename string, asAttachment bool, totalSize int64) {
+    defer session.AcquireCachedFile(filePath)()
+
     // Resolve actual path (prefer .part if exists)
     partPath := filePath + ".part"
     pathToOpen := filePath
@@ -506,6 +515,17 @@ func serveGrowingFileRange(ctx *gin.Context, filePath string, contentType string
         }
     }
 
+    // Hold back files players can't start yet (moov-at-end MP4, below min bytes)
+    if pathToOpen == partPath {
+        if !waitUntilServable(ctx, partPath, contentType) { return }
+        if _, err := os.Stat(partPath); err != nil {
+            if st, err := os.Stat(filePath); err == nil && !st.IsDir() {
+                pathToOpen = filePath
+                if totalSize == 0 { totalSize = st.Size() }
+            }
+        }
+    }
+
     // Open file
     f, err := os.Open(pathToOpen)
     if err != nil {
@@ -513,7 +533,7 @@ func serveGrowingFileRange(ctx *gin.Context, filePath string, contentType string
         ctx.Status(http.StatusNotFound)
         return
     }
-    defer f.Close()
+    defer func() { f.Close() }()
 
     // Determine dynamic size getter
     getSize := func() int64 {
@@ -521,8 +541,24 @@ func serveGrowingFileRange(ctx *gin.Context, filePath string, contentType string
         return 0
     }
 
+    // Once the download finishes the .part is renamed to filePath. A read that
+    // hit EOF just before may have missed the last bytes, and a writer that
+    // recreated the file leaves f on a stale inode, so switch to the final
+    // file at the current offset and keep serving from there.
+    switchToFinal := func(offset int64) bool {
+        if pathToOpen == filePath { return false }
+        nf, err := os.Open(filePath)
+        if err != nil { return false }
+        if _, err := nf.Seek(offset, io.SeekStart); err != nil { nf.Close(); return false }
+        reqLog(ctx).DebugLog("Growing file %s finished mid-serve, continuing from the final file at %d", path.Base(filePath), offset)
+        f.Close()
+        f, pathToOpen = nf, filePath
+        return true
+    }
+
     // Common headers
     if contentType == "" { contentType = contentTypeForPath(pathToOpen) }
+    contentType = sniffVideoContentType(f, contentType)
     ctx.Header("Content-Type", contentType)
     ctx.Header("Accept-Ranges", "bytes")
     ctx.Header("X-Accel-Buffering", "no")
@@ -547,9 +583,13 @@ func serveGrowingFileRange(ctx *gin.Context, filePath string, contentType string
                 if end >= sizeNow { end = sizeNow - 1 }
             }
             length := end - start + 1
-            tot := totalSize
-            if tot == 0 { tot = getSize() }
-            ctx.Header("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, tot))
+            tot := strconv.FormatInt(totalSize, 10)
+            if totalSize == 0 {
+                // Unknown until a running download ends
+                tot = "*"
+                if pathToOpen != partPath { tot = strconv.FormatInt(getSize(), 10) }
+            }
+            ctx.Header("Content-Range", fmt.Sprintf("bytes %d-%d/%s", start, end, tot))
             ctx.Header("Content-Length", strconv.FormatInt(length, 10))
             ctx.Status(http.StatusPartialContent)
             return
@@ -559,13 +599,9 @@ func serveGrowingFileRange(ctx *gin.Context, filePath string, contentType string
         return
     }
 
-    // GET with optional Range
-    rng := ctx.GetHeader("Range")
-    if rng == "" {
-        // Progressive full-stream: do not set Content-Length to allow chunked transfer
-        ctx.Status(http.StatusOK)
-        // Start from offset 0 and stream as file grows
-        var offset int64 = 0
+    // streamFrom writes the file from offset on, waiting for more data while
+    // the download runs, until it is complete or the client goes away
+    streamFrom := func(offset int64) {
         buf := make([]byte, 256*1024)
         for {
             // Ensure reader is at current offset
@@ -592,6 +628,86 @@ func serveGrowingFileRange(ctx *gin.Context, filePath string, contentType string
                 }
             }
             // No .part: finished file
+            if switchToFinal(offset) { continue }
+            return
+        }
+    }
+
+    // streamRange writes exactly length bytes from start, waiting for them
+    // while the download runs; it stops early only when the file ends short
+    streamRange := func(start, length int64) {
+        if _, err := f.Seek(start, io.SeekStart); err != nil { return }
+        var remaining = length
+        buf := make([]byte, 256*1024)
+        for remaining > 0 {
+            toRead := int64(len(buf))
+            if remaining < toRead { toRead = remaining }
+            n, err := f.Read(buf[:toRead])
+            if n > 0 {
+                if _, werr := ctx.Writer.Write(buf[:n]); werr != nil { return }
+                remaining -= int64(n)
+                if fl, ok := ctx.Writer.(http.Flusher); ok { fl.Flush() }
+                continue
+            }
+            if err == io.EOF || err == io.ErrUnexpectedEOF {
+                // If still downloading, wait and retry
+                if _, statErr := os.Stat(partPath); statErr == nil {
+                    select {
+                    case <-ctx.Request.Context().Done():
+                        return
+                    case <-time.After(150 * time.Millisecond):
+                        continue
+                    }
+                }
+                // Not downloading anymore: finish from the final file, or stop
+                if switchToFinal(start + length - remaining) { continue }
+                return
+            }
+            if err != nil {
+                return
+            }
+        }
+    }
+
+    // GET with optional Range
+    rng := ctx.GetHeader("Range")
+    if rng == "" {
+        // Progressive full-stream: do not set Content-Length to allow chunked transfer
+        ctx.Status(http.StatusOK)
+        // Start from offset 0 and stream as file grows
+        streamFrom(0)
+        return
+    }
+
+    // Open-ended range (a player seeking) on a file still downloading: answer
+    // as soon as start is written, rather than waiting for an end that only
+    // exists once the download is done
+    if start, ok := openRangeStart(rng); ok && pathToOpen == partPath {
+        for start >= getSize() {
+            if _, err := os.Stat(partPath); err != nil { break }
+            select {
+            case <-ctx.Request.Context().Done():
+                return
+            case <-time.After(150 * time.Millisecond):
+            }
+        }
+        // Still downloading, or finished past start: answer now. The bytes sent
+        // always match Content-Range: up to the known total size or, while that
+        // is unknown, what is written so far; the player asks for the rest.
+        if sizeNow := getSize(); start < sizeNow {
+            end, tot := sizeNow-1, "*"
+            if totalSize > 0 {
+                if start >= totalSize {
+                    ctx.Header("Content-Range", fmt.Sprintf("bytes */%d", totalSize))
+                    ctx.Status(http.StatusRequestedRangeNotSatisfiable)
+                    return
+                }
+                end, tot = totalSize-1, strconv.FormatInt(totalSize, 10)
+            }
+            ctx.Header("Content-Range", fmt.Sprintf("bytes %d-%d/%s", start, end, tot))
+            ctx.Header("Content-Length", strconv.FormatInt(end-start+1, 10))
+            ctx.Status(http.StatusPartialContent)
+            streamRange(start, end-start+1)
             return
         }
     }
@@ -615,6 +731,7 @@ func serveGrowingFileRange(ctx *gin.Context, filePath string, contentType string
         if start < sizeNow && end < sizeNow { break }
         // If no longer downloading, clamp end
         if _, err := os.Stat(partPath); err != nil {
+            if switchToFinal(start) { continue }
             if sizeNow == 0 || start >= sizeNow {
                 ctx.Header("Content-Range", fmt.Sprintf("bytes */%d", sizeNow))
                 ctx.Status(http.StatusRequestedRangeNotSatisfiable)
@@ -633,41 +750,10 @@ func serveGrowingFileRange(ctx *gin.Context, filePath string, contentType string
 
     // Ready to serve the requested (possibly clamped) range
     length := end - start + 1
-    if _, err := f.Seek(start, io.SeekStart); err != nil { ctx.Status(http.StatusInternalServerError); return }
     tot := totalSize
     if tot == 0 { tot = max64(totalSize, getSize()) }
     ctx.Header("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, tot))
     ctx.Header("Content-Length", strconv.FormatInt(length, 10))
     ctx.Status(http.StatusPartialContent)
-
-    // Stream exactly length bytes; tolerate short reads by waiting while downloading
-    var remaining = length
-    buf := make([]byte, 256*1024)
-    for remaining > 0 {
-        toRead := int64(len(buf))
-        if remaining < toRead { toRead = remaining }
-        n, err := f.Read(buf[:toRead])
-        if n > 0 {
-            if _, werr := ctx.Writer.Write(buf[:n]); werr != nil { return }
-            remaining -= int64(n)
-            if fl, ok := ctx.Writer.(http.Flusher); ok { fl.Flush() }
-            continue
-        }
-        if err == io.EOF || err == io.ErrUnexpectedEOF {
-            // If still downloading, wait and retry
-            if _, statErr := os.Stat(partPath); statErr == nil {
-                select {
-                case <-ctx.Request.Context().Done():
-                    return
-                case <-time.After(150 * time.Millisecond):
-                    continue
-                }
-            }
-            // Not downloading anymore: stop
-            return
-        }
-        if err != nil {
-            return
-        }
-    }
+    streamRange(start, length)
 }
\ No newline at end of file
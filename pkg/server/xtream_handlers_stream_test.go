@@ -0,0 +1,160 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// growingFile writes the first written bytes of data to path.part and returns
+// the full data.
+func growingFile(t *testing.T, size, written int) (string, []byte) {
+	t.Helper()
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	file := filepath.Join(t.TempDir(), "42.ts")
+	if err := os.WriteFile(file+".part", data[:written], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return file, data
+}
+
+// grow appends data[from:] to path.part in steps and then renames it to path,
+// as a finishing download does.
+func grow(t *testing.T, file string, data []byte, from int) {
+	t.Helper()
+	f, err := os.OpenFile(file+".part", os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for off := from; off < len(data); off += 500 {
+		time.Sleep(50 * time.Millisecond)
+		end := off + 500
+		if end > len(data) {
+			end = len(data)
+		}
+		if _, err := f.Write(data[off:end]); err != nil {
+			t.Error(err)
+		}
+	}
+	f.Close()
+	if err := os.Rename(file+".part", file); err != nil {
+		t.Error(err)
+	}
+}
+
+func serveRange(file string, total int64, rng string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Request = httptest.NewRequest("GET", "/movie/u/p/42.ts", nil)
+	if rng != "" {
+		ctx.Request.Header.Set("Range", rng)
+	}
+	serveGrowingFileRange(ctx, file, "video/mp2t", "", false, total)
+	return w
+}
+
+// TestServeGrowingFileOpenRange checks that bytes=N- on a file still
+// downloading answers a Content-Range the body matches.
+func TestServeGrowingFileOpenRange(t *testing.T) {
+	tests := []struct {
+		name             string
+		size, written    int
+		total            int64
+		start            int
+		wantRange        string
+		wantFrom, wantTo int // body is data[wantFrom:wantTo]
+	}{
+		{"size unknown: what is written so far", 3000, 1000, 0, 200, "bytes 200-999/*", 200, 1000},
+		{"size known: up to the end", 3000, 1000, 3000, 500, "bytes 500-2999/3000", 500, 3000},
+		{"start not written yet", 3000, 1000, 0, 1200, "", 1200, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, data := growingFile(t, tt.size, tt.written)
+			done := make(chan struct{})
+			go func() {
+				grow(t, file, data, tt.written)
+				close(done)
+			}()
+			defer func() { <-done }()
+
+			w := serveRange(file, tt.total, "bytes="+strconv.Itoa(tt.start)+"-")
+			if w.Code != 206 {
+				t.Fatalf("status = %d, want 206", w.Code)
+			}
+			cr := w.Header().Get("Content-Range")
+			if tt.wantRange != "" && cr != tt.wantRange {
+				t.Errorf("Content-Range = %q, want %q", cr, tt.wantRange)
+			}
+			var start, end int64
+			if _, err := fmt.Sscanf(cr, "bytes %d-%d/", &start, &end); err != nil {
+				t.Fatalf("Content-Range %q: %v", cr, err)
+			}
+			body := w.Body.Bytes()
+			if n := int64(len(body)); n != end-start+1 || w.Header().Get("Content-Length") != strconv.FormatInt(n, 10) {
+				t.Errorf("Content-Range %q, Content-Length %s, body %d bytes", cr, w.Header().Get("Content-Length"), n)
+			}
+			wantTo := tt.wantTo
+			if wantTo == 0 {
+				wantTo = int(end) + 1
+			}
+			if start != int64(tt.wantFrom) || !bytes.Equal(body, data[tt.wantFrom:wantTo]) {
+				t.Errorf("body is not data[%d:%d]", tt.wantFrom, wantTo)
+			}
+		})
+	}
+}
+
+// TestServeGrowingFileSwitchToFinal finishes the download in the middle of a
+// read, with a writer that puts the final file in place as a new file rather
+// than renaming the .part being read, and checks the served bytes run on
+// without a gap.
+func TestServeGrowingFileSwitchToFinal(t *testing.T) {
+	tests := []struct {
+		name     string
+		rng      string
+		total    int64
+		from, to int
+	}{
+		{"whole file", "", 0, 0, 3000},
+		{"open range of known size", "bytes=200-", 3000, 200, 3000},
+		{"bounded range of known size", "bytes=100-2499", 3000, 100, 2500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, data := growingFile(t, 3000, 1000)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				time.Sleep(300 * time.Millisecond)
+				if err := os.WriteFile(file+".tmp", data, 0o644); err != nil {
+					t.Error(err)
+					return
+				}
+				if err := os.Rename(file+".tmp", file); err != nil {
+					t.Error(err)
+				}
+				if err := os.Remove(file + ".part"); err != nil {
+					t.Error(err)
+				}
+			}()
+			defer func() { <-done }()
+
+			w := serveRange(file, tt.total, tt.rng)
+			if body := w.Body.Bytes(); !bytes.Equal(body, data[tt.from:tt.to]) {
+				t.Errorf("served %d bytes, want data[%d:%d] (%d bytes)", len(body), tt.from, tt.to, tt.to-tt.from)
+			}
+		})
+	}
+}
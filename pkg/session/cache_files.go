@@ -0,0 +1,92 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package session
+
+import (
+	"os"
+	"sync"
+
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// servedFiles counts the readers of each cached file, so the expiry sweep
+// never deletes a file a client is still playing.
+var servedFiles = struct {
+	sync.Mutex
+	n map[string]int
+}{n: make(map[string]int)}
+
+// AcquireCachedFile marks path as being served until the returned release
+// function is called.
+func AcquireCachedFile(path string) (release func()) {
+	servedFiles.Lock()
+	servedFiles.n[path]++
+	servedFiles.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			servedFiles.Lock()
+			if servedFiles.n[path]--; servedFiles.n[path] <= 0 {
+				delete(servedFiles.n, path)
+			}
+			servedFiles.Unlock()
+		})
+	}
+}
+
+// servedCachedFiles returns the paths currently being served.
+func servedCachedFiles() []string {
+	servedFiles.Lock()
+	defer servedFiles.Unlock()
+	paths := make([]string, 0, len(servedFiles.n))
+	for p := range servedFiles.n {
+		paths = append(paths, p)
+	}
+	return paths
+}
+
+// purgeExpiredVODCache removes expired cache entries and their files, keeping
+// anything that is still downloading or being served.
+func (sm *SessionManager) purgeExpiredVODCache() {
+	if sm.db == nil {
+		return
+	}
+	purged, err := sm.db.PurgeExpiredVODCache(servedCachedFiles())
+	if err != nil {
+		utils.ErrorLog("Failed to purge expired VOD cache: %v", err)
+	}
+	for _, e := range purged {
+		var freed int64
+		for _, p := range []string{e.FilePath, e.FilePath + ".part"} {
+			if st, err := os.Stat(p); err == nil && !st.IsDir() {
+				if err := os.Remove(p); err != nil {
+					utils.WarnLog("Cache purge: could not delete %s: %v", p, err)
+					continue
+				}
+				freed += st.Size()
+			}
+		}
+		title := e.Title
+		if title == "" {
+			title = e.StreamID
+		}
+		utils.InfoLog("Cache purge: removed expired %s %q (%s freed)", e.Type, title, utils.HumanBytes(freed))
+	}
+}
@@ -0,0 +1,78 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package session
+
+import (
+	"time"
+)
+
+// SetStreamLinger sets how long a stream keeps reading upstream after its
+// last viewer disconnected, so a player that briefly lost its connection
+// re-attaches to the running buffer instead of reopening the upstream.
+// 0 stops the stream as soon as the last viewer leaves.
+func (sm *SessionManager) SetStreamLinger(d time.Duration) {
+	sm.streamLock.Lock()
+	defer sm.streamLock.Unlock()
+	sm.streamLinger = d
+}
+
+// lingerOrStopLocked stops a stream whose last viewer just left, or defers
+// the stop by the linger period. Must be called with streamLock held.
+func (sm *SessionManager) lingerOrStopLocked(streamID string) {
+	if sm.streamLinger <= 0 {
+		sm.stopStream(streamID)
+		return
+	}
+	if _, pending := sm.lingerTimers[streamID]; pending {
+		return
+	}
+
+	sm.streamLog(streamID).InfoLog("Last viewer left stream %s, keeping it for %v", streamID, sm.streamLinger)
+	var timer *time.Timer
+	timer = time.AfterFunc(sm.streamLinger, func() {
+		sm.streamLock.Lock()
+		defer sm.streamLock.Unlock()
+
+		// Cancelled, or replaced by a later linger on the same stream
+		if sm.lingerTimers[streamID] != timer {
+			return
+		}
+		delete(sm.lingerTimers, streamID)
+
+		// Someone (a viewer or a recording) attached in the meantime
+		if ss, ok := sm.streamSessions[streamID]; ok && len(ss.GetViewers()) > 0 {
+			return
+		}
+		sm.streamLog(streamID).InfoLog("No viewer came back to stream %s within %v", streamID, sm.streamLinger)
+		sm.stopStream(streamID)
+	})
+	sm.lingerTimers[streamID] = timer
+}
+
+// cancelLingerLocked drops a pending deferred stop for streamID, reporting
+// whether there was one. Must be called with streamLock held.
+func (sm *SessionManager) cancelLingerLocked(streamID string) bool {
+	timer, ok := sm.lingerTimers[streamID]
+	if !ok {
+		return false
+	}
+	timer.Stop()
+	delete(sm.lingerTimers, streamID)
+	return true
+}
@@ -19,12 +19,16 @@
 package session
 
 import (
+	"container/list"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"path"
 	"sync"
+	"sync/atomic"
 	"time"
 	"strings"
 
@@ -36,21 +40,54 @@ import (
 
 // SessionManager handles user sessions and stream multiplexing
 type SessionManager struct {
-	userSessions     map[string]*types.UserSession     // username -> session
-	streamSessions   map[string]*types.StreamSession   // streamID -> session
-	streamBuffers    map[string]*StreamBuffer          // streamID -> buffer
-	db               *database.DBManager
-	tempLinks        map[string]*types.TemporaryLink   // token -> temp link
-	userLock         sync.RWMutex
-	streamLock       sync.RWMutex
-	tempLinkLock     sync.RWMutex
-	cleanupInterval  time.Duration
-	sessionTimeout   time.Duration
-	streamTimeout    time.Duration
-	tempLinkTimeout  time.Duration
-	httpClient       *http.Client
+	userSessions       map[string]*types.UserSession     // username -> session
+	streamSessions     map[string]*types.StreamSession   // streamID -> session
+	streamBuffers      map[string]*StreamBuffer          // streamID -> buffer
+	db                 *database.DBManager
+	tempLinks          map[string]*types.TemporaryLink   // token -> temp link
+	userLock           sync.RWMutex
+	streamLock         sync.RWMutex
+	tempLinkLock       sync.RWMutex
+	tempLinkOrder      *list.List               // LRU order of tempLinks tokens, most recent first
+	tempLinkElems      map[string]*list.Element // token -> element in tempLinkOrder
+	maxTempLinks       int                      // in-memory cap; the DB stays the source of truth
+	vodRequests        map[string]*types.VODRequest // token -> search result set
+	vodRequestLock     sync.RWMutex
+	recordings         map[string]*Recording // recording id -> in-progress recording
+	recordingLock      sync.RWMutex
+	timeouts           map[string]time.Time // username -> end of an admin timeout
+	timeoutLock        sync.RWMutex
+	cleanupInterval    time.Duration
+	sessionTimeout     time.Duration // guarded by streamLock, as are the tunables below
+	streamTimeout      time.Duration
+	tempLinkTimeout    time.Duration
+	clientStallTimeout time.Duration // max time a chunk may wait for a slow client
+	upstreamIdle       time.Duration // max time between upstream reads before the stream is stopped; 0 waits forever
+	joinPreroll        int           // chunks behind head a viewer joining a running stream starts at
+	streamLinger       time.Duration // how long a stream outlives its last viewer; 0 stops it at once
+	lingerTimers       map[string]*time.Timer // streamID -> deferred stop; guarded by streamLock
+	maxViewers         int                    // viewers one stream may have; 0 is unlimited
+	httpClient         *http.Client
+	streamsBlocked     bool // set by an admin stop-all; guarded by streamLock
+	bufferSizes        map[string]bufferSize // streamType -> ring geometry, "" is the fallback; guarded by streamLock
+	qualityMetrics     bool                  // collect per-stream delivery counters; guarded by streamLock
+	persistQuality     bool                  // store a quality summary when a stream stops
+	memoryProfile      string                // preset the buffer sizes came from; guarded by streamLock
 }
 
+// bufferSize is the ring geometry used for streams of one type.
+type bufferSize struct {
+	ringCap   int // chunks retained
+	chunkSize int // max bytes per upstream read
+}
+
+// ErrStreamsBlocked is returned by RequestStream while new streams are blocked.
+var ErrStreamsBlocked = errors.New("new streams are blocked by an administrator")
+
+// ErrStreamAtCapacity is returned by RequestStream when the stream already
+// has the maximum number of viewers.
+var ErrStreamAtCapacity = errors.New("stream at capacity")
+
 // StreamBuffer handles buffering and distribution of stream data
 type StreamBuffer struct {
 	streamID    string
@@ -67,25 +104,45 @@ type StreamBuffer struct {
 
 	// Ring buffer allowing clients to read at their own pace
 	ringCap     int
+	chunkSize   int                  // max bytes per upstream read
 	head        uint64               // next sequence number to write
 	ring        [][]byte             // ring storage
 	bufMu       sync.Mutex
 	cond        *sync.Cond
 	clientIndex map[string]uint64 // per-client next sequence to read
+
+	metrics *streamMetrics // nil unless quality metrics are enabled
+
+	// Tagged with the id of the request that started the stream, so its
+	// start and cleanup lines can be matched
+	log utils.RequestLogger
 }
 
 // NewSessionManager creates a new session manager
 func NewSessionManager(db *database.DBManager) *SessionManager {
 	manager := &SessionManager{
-		userSessions:    make(map[string]*types.UserSession),
-		streamSessions:  make(map[string]*types.StreamSession),
-		streamBuffers:   make(map[string]*StreamBuffer),
-		tempLinks:       make(map[string]*types.TemporaryLink),
-		db:              db,
-		cleanupInterval: 5 * time.Minute,
-		sessionTimeout:  30 * time.Minute,
-		streamTimeout:   2 * time.Minute,  // Time after which an unused stream is closed
-		tempLinkTimeout: 24 * time.Hour,
+		userSessions:       make(map[string]*types.UserSession),
+		streamSessions:     make(map[string]*types.StreamSession),
+		streamBuffers:      make(map[string]*StreamBuffer),
+		tempLinks:          make(map[string]*types.TemporaryLink),
+		tempLinkOrder:      list.New(),
+		tempLinkElems:      make(map[string]*list.Element),
+		maxTempLinks:       1000,
+		vodRequests:        make(map[string]*types.VODRequest),
+		recordings:         make(map[string]*Recording),
+		timeouts:           make(map[string]time.Time),
+		lingerTimers:       make(map[string]*time.Timer),
+		db:                 db,
+		cleanupInterval:    5 * time.Minute,
+		sessionTimeout:     30 * time.Minute,
+		streamTimeout:      2 * time.Minute,  // Time after which an unused stream is closed
+		tempLinkTimeout:    24 * time.Hour,
+		clientStallTimeout: 30 * time.Second, // CLIENT_STALL_TIMEOUT
+		upstreamIdle:       30 * time.Second, // UPSTREAM_READ_TIMEOUT
+		joinPreroll:        8,                // STREAM_PREROLL_CHUNKS
+		maxViewers:         500,              // MAX_VIEWERS_PER_STREAM
+		bufferSizes:        memoryProfiles["default"].sizes(),
+		memoryProfile:      "default",
 		httpClient: &http.Client{
 			// No global Timeout: long-running streams must not be cut after 60s
 			Transport: &http.Transport{
@@ -98,6 +155,8 @@ func NewSessionManager(db *database.DBManager) *SessionManager {
 		},
 	}
 
+	manager.loadUserTimeouts()
+
 	// Start cleanup routines
 	go manager.cleanupRoutine()
 
@@ -112,6 +171,9 @@ func (sm *SessionManager) cleanupRoutine() {
 	for range ticker.C {
 		sm.cleanupExpiredSessions()
 		sm.cleanupUnusedStreams()
+		sm.cleanupExpiredVODRequests()
+		sm.cleanupExpiredTimeouts()
+		sm.purgeExpiredVODCache()
 		
 		// Also clean up expired temporary links in the database
 		if sm.db != nil {
@@ -126,7 +188,9 @@ func (sm *SessionManager) cleanupRoutine() {
 
 // cleanupExpiredSessions removes inactive user sessions
 func (sm *SessionManager) cleanupExpiredSessions() {
+	sm.streamLock.RLock()
 	threshold := time.Now().Add(-sm.sessionTimeout)
+	sm.streamLock.RUnlock()
 	
 	sm.userLock.Lock()
 	defer sm.userLock.Unlock()
@@ -140,6 +204,7 @@ func (sm *SessionManager) cleanupExpiredSessions() {
 			if session.StreamID != "" {
 				sm.streamLock.Lock()
 				if streamSession, exists := sm.streamSessions[session.StreamID]; exists {
+					sm.closeHistory(streamSession, username)
 					if !streamSession.RemoveViewer(username) && streamSession.Active {
 						// No more viewers, stop the stream
 						sm.stopStream(session.StreamID)
@@ -155,11 +220,10 @@ func (sm *SessionManager) cleanupExpiredSessions() {
 
 // cleanupUnusedStreams stops streams that have no viewers
 func (sm *SessionManager) cleanupUnusedStreams() {
-	threshold := time.Now().Add(-sm.streamTimeout)
-	
 	sm.streamLock.Lock()
 	defer sm.streamLock.Unlock()
-	
+
+	threshold := time.Now().Add(-sm.streamTimeout)
 	for streamID, session := range sm.streamSessions {
 		if session.LastRequested.Before(threshold) && session.Active {
 			utils.InfoLog("Stream %s has been inactive for %v, stopping",
@@ -209,6 +273,16 @@ func (sm *SessionManager) RegisterUser(username, ip, userAgent string) *types.Us
 	return session
 }
 
+// ClearDiscordInfo forgets the Discord account cached on a live user session.
+func (sm *SessionManager) ClearDiscordInfo(username string) {
+	sm.userLock.Lock()
+	defer sm.userLock.Unlock()
+	if session, exists := sm.userSessions[username]; exists {
+		session.DiscordID = ""
+		session.DiscordName = ""
+	}
+}
+
 // GetUserSession retrieves a user session if it exists
 func (sm *SessionManager) GetUserSession(username string) *types.UserSession {
 	sm.userLock.RLock()
@@ -224,9 +298,20 @@ func (sm *SessionManager) GetUserSession(username string) *types.UserSession {
 	return session
 }
 
-// RequestStream handles a new stream request and implements connection multiplexing
-func (sm *SessionManager) RequestStream(username, streamID, streamType, streamTitle string,
+// RequestStream handles a new stream request and implements connection
+// multiplexing. ctx is the client request's, for its request id in logs.
+func (sm *SessionManager) RequestStream(ctx context.Context, username, streamID, streamType, streamTitle string,
 	upstreamURL *url.URL) (*StreamBuffer, error) {
+	return sm.RequestStreamBehind(ctx, username, streamID, streamType, streamTitle, upstreamURL, -1)
+}
+
+// RequestStreamBehind is RequestStream for a viewer who asks to start behind
+// chunks before the live edge of a running stream, e.g. to seek back after a
+// reconnect. The value is clamped to what the ring still holds; a negative
+// one uses the join pre-roll. A new stream always starts at its beginning.
+func (sm *SessionManager) RequestStreamBehind(ctx context.Context, username, streamID, streamType, streamTitle string,
+	upstreamURL *url.URL, behind int) (*StreamBuffer, error) {
+	log := utils.ForRequest(ctx)
 
 	// Get user session, creating if necessary
 	var userSession *types.UserSession
@@ -253,6 +338,7 @@ func (sm *SessionManager) RequestStream(username, streamID, streamType, streamTi
 	if prevStreamID != "" && prevStreamID != streamID {
 		sm.streamLock.Lock()
 		if prevStream, exists := sm.streamSessions[prevStreamID]; exists {
+			sm.closeHistory(prevStream, username)
 			if !prevStream.RemoveViewer(username) && prevStream.Active {
 				// If no more viewers, stop the previous stream
 				sm.stopStream(prevStreamID)
@@ -265,40 +351,121 @@ func (sm *SessionManager) RequestStream(username, streamID, streamType, streamTi
 	sm.streamLock.Lock()
 	defer sm.streamLock.Unlock()
 
+	if sm.streamsBlocked {
+		return nil, ErrStreamsBlocked
+	}
+
 	var streamBuffer *StreamBuffer
 
 	// If this stream already exists, add the user as a viewer and start a per-client reader
 	if existingBuffer, exists := sm.streamBuffers[streamID]; exists && existingBuffer.active {
-		utils.InfoLog("User %s joined existing stream %s", username, streamID)
+		// A new stream starts with one viewer, so only joins can hit the cap;
+		// a reconnecting viewer already holds a place
+		if streamSession, exists := sm.streamSessions[streamID]; exists && sm.maxViewers > 0 {
+			viewers := streamSession.GetViewers()
+			if _, watching := viewers[username]; !watching && len(viewers) >= sm.maxViewers {
+				log.WarnLog("User %s refused on stream %s: %d viewers already (max %d)", username, streamID, len(viewers), sm.maxViewers)
+				return nil, ErrStreamAtCapacity
+			}
+		}
+
+		if sm.cancelLingerLocked(streamID) {
+			log.InfoLog("User %s re-attached to lingering stream %s", username, streamID)
+		} else {
+			log.InfoLog("User %s joined existing stream %s", username, streamID)
+		}
 
 		if streamSession, exists := sm.streamSessions[streamID]; exists {
 			streamSession.AddViewer(username)
 			streamSession.LastRequested = time.Now()
+			// A reconnect keeps the row opened by the first connection
+			if !streamSession.HasHistoryID(username) {
+				sm.openHistory(log, streamSession, username, userSession)
+			}
 		}
 
 		// Add user as a client
-		clientChan := make(chan []byte, 256) // larger buffer to smooth jitter
+		clientChan := make(chan []byte, existingBuffer.clientQueueLen()) // larger buffer to smooth jitter
 		existingBuffer.clientsLock.Lock()
 		if existingBuffer.clientDone == nil {
 			existingBuffer.clientDone = make(map[string]chan struct{})
 		}
 		existingBuffer.clients[username] = clientChan
 		existingBuffer.clientDone[username] = make(chan struct{})
-		// Start client goroutine at current head
+		// Start client goroutine a few chunks behind head, so the player
+		// gets data to fill its buffer right away
 		existingBuffer.bufMu.Lock()
 		if existingBuffer.clientIndex == nil {
 			existingBuffer.clientIndex = make(map[string]uint64)
 		}
-		existingBuffer.clientIndex[username] = existingBuffer.head
+		if behind >= 0 {
+			existingBuffer.clientIndex[username] = existingBuffer.seekBackStart(behind)
+		} else {
+			existingBuffer.clientIndex[username] = existingBuffer.prerollStart(sm.joinPreroll)
+		}
 		existingBuffer.bufMu.Unlock()
 		existingBuffer.clientsLock.Unlock()
 
-		go sm.serveClient(existingBuffer, username)
+		go sm.serveClient(existingBuffer, username, log)
 
 		return existingBuffer, nil
 	}
 
-	// Create a new stream session
+	streamBuffer = sm.newStreamLocked(log, streamID, streamType, streamTitle, upstreamURL)
+	sm.streamSessions[streamID].AddViewer(username)
+
+	// Add the requesting user as the first client
+	streamBuffer.clientsLock.Lock()
+	streamBuffer.clients[username] = make(chan []byte, streamBuffer.clientQueueLen())
+	streamBuffer.clientDone[username] = make(chan struct{})
+	streamBuffer.clientsLock.Unlock()
+	streamBuffer.bufMu.Lock()
+	streamBuffer.clientIndex[username] = 0 // read from the first chunk of the new stream
+	streamBuffer.bufMu.Unlock()
+
+	// Start the per-client reader
+	go sm.serveClient(streamBuffer, username, log)
+
+	// Record in database
+	sm.openHistory(log, sm.streamSessions[streamID], username, userSession)
+
+	log.InfoLog("Started new stream %s for user %s", streamID, username)
+	return streamBuffer, nil
+}
+
+// openHistory records a stream_history row for a viewer and keeps its id on
+// the stream session so it can be closed when the viewer leaves.
+func (sm *SessionManager) openHistory(log utils.RequestLogger, ss *types.StreamSession, username string, us *types.UserSession) {
+	if sm.db == nil || ss == nil {
+		return
+	}
+	id, err := sm.db.AddStreamHistory(username, ss.StreamID, ss.StreamType, ss.StreamTitle, us.IPAddress, us.UserAgent)
+	if err != nil {
+		log.ErrorLog("Failed to record stream history: %v", err)
+		return
+	}
+	ss.SetHistoryID(username, id)
+}
+
+// closeHistory closes the viewer's open history row, if any.
+func (sm *SessionManager) closeHistory(ss *types.StreamSession, username string) {
+	if id, ok := ss.TakeHistoryID(username); ok {
+		sm.closeHistoryID(id)
+	}
+}
+
+func (sm *SessionManager) closeHistoryID(id int64) {
+	if sm.db == nil {
+		return
+	}
+	if err := sm.db.CloseStreamHistory(id); err != nil {
+		utils.ErrorLog("Failed to close stream history %d: %v", id, err)
+	}
+}
+
+// newStreamLocked creates the session and ring buffer for a stream and starts
+// the upstream reader, logging with log. The caller must hold streamLock.
+func (sm *SessionManager) newStreamLocked(log utils.RequestLogger, streamID, streamType, streamTitle string, upstreamURL *url.URL) *StreamBuffer {
 	streamSession := &types.StreamSession{
 		StreamID:      streamID,
 		StreamType:    streamType,
@@ -307,55 +474,78 @@ func (sm *SessionManager) RequestStream(username, streamID, streamType, streamTi
 		StartTime:     time.Now(),
 		LastRequested: time.Now(),
 		Viewers:       make(map[string]time.Time),
+		MaxViewers:    sm.maxViewers,
 		Active:        true,
 	}
-	streamSession.AddViewer(username)
 	sm.streamSessions[streamID] = streamSession
 
-	// Create a new stream buffer
-	streamBuffer = &StreamBuffer{
+	size, ok := sm.bufferSizes[streamType]
+	if !ok {
+		size = sm.bufferSizes[""]
+	}
+	streamBuffer := &StreamBuffer{
 		streamID:    streamID,
 		upstreamURL: upstreamURL.String(),
 		active:      true,
 		clients:     make(map[string]chan []byte),
 		clientDone:  make(map[string]chan struct{}),
 		stopChan:    make(chan struct{}),
-		ringCap:     256,                         // last 256 chunks retained
-		ring:        make([][]byte, 256),         // preallocate
+		ringCap:     size.ringCap,
+		chunkSize:   size.chunkSize,
+		ring:        make([][]byte, size.ringCap), // preallocate
 		clientIndex: make(map[string]uint64),
+		log:         log,
 	}
 	streamBuffer.cond = sync.NewCond(&streamBuffer.bufMu)
-
-	// Add the requesting user as the first client
-	clientChan := make(chan []byte, 256)
-	streamBuffer.clients[username] = clientChan
-	streamBuffer.clientDone[username] = make(chan struct{})
-	streamBuffer.clientIndex[username] = 0 // will follow head as it grows
-
+	if sm.qualityMetrics {
+		streamBuffer.metrics = &streamMetrics{}
+	}
 	sm.streamBuffers[streamID] = streamBuffer
 
 	// Start the upstream reader goroutine
 	go sm.streamToClients(streamBuffer, upstreamURL)
-	// Start the per-client reader
-	go sm.serveClient(streamBuffer, username)
+	return streamBuffer
+}
 
-	// Record in database
-	if sm.db != nil {
-		_, err := sm.db.AddStreamHistory(
-			username, streamID, streamType, streamTitle,
-			userSession.IPAddress, userSession.UserAgent,
-		)
-		if err != nil {
-			utils.ErrorLog("Failed to record stream history: %v", err)
-		}
+// OpenStream makes sure the upstream for streamID is being read into a ring
+// buffer without attaching a client. Used by in-process consumers such as recordings.
+func (sm *SessionManager) OpenStream(streamID, streamType, streamTitle string, upstreamURL *url.URL) error {
+	sm.streamLock.Lock()
+	defer sm.streamLock.Unlock()
+
+	if sm.streamsBlocked {
+		return ErrStreamsBlocked
+	}
+	if buffer, exists := sm.streamBuffers[streamID]; exists && buffer.active {
+		return nil
 	}
+	sm.newStreamLocked(utils.RequestLogger{}, streamID, streamType, streamTitle, upstreamURL)
+	utils.InfoLog("Opened stream %s without a viewer", streamID)
+	return nil
+}
 
-	utils.InfoLog("Started new stream %s for user %s", streamID, username)
-	return streamBuffer, nil
+// prerollStart returns the sequence a joining viewer starts reading at: up to
+// chunks behind head, never before the first chunk and never in the older half
+// of the ring, which the writer is about to overwrite. bufMu must be held.
+func (b *StreamBuffer) prerollStart(chunks int) uint64 {
+	n := uint64(max(chunks, 0))
+	n = min(n, uint64(b.ringCap/2), b.head)
+	return b.head - n
+}
+
+// seekBackStart returns the sequence a viewer asking to start chunks behind
+// head reads from. It is clamped to three quarters of the ring, leaving the
+// rest as slack so the writer doesn't overwrite the viewer's next chunk at
+// the first hiccup, and never goes before the first chunk. bufMu must be held.
+func (b *StreamBuffer) seekBackStart(chunks int) uint64 {
+	n := uint64(max(chunks, 0))
+	n = min(n, uint64(b.ringCap*3/4), b.head)
+	return b.head - n
 }
 
-// serveClient reads from the ring buffer and sends to a specific client's channel
-func (sm *SessionManager) serveClient(buffer *StreamBuffer, username string) {
+// serveClient reads from the ring buffer and sends to a specific client's
+// channel. log is tagged with the client's request.
+func (sm *SessionManager) serveClient(buffer *StreamBuffer, username string, log utils.RequestLogger) {
 	ch := func() chan []byte {
 		buffer.clientsLock.RLock()
 		defer buffer.clientsLock.RUnlock()
@@ -372,6 +562,16 @@ func (sm *SessionManager) serveClient(buffer *StreamBuffer, username string) {
 	next = buffer.clientIndex[username]
 	buffer.bufMu.Unlock()
 
+	// A half-open connection may never signal done; give up on a client that
+	// cannot take a chunk within the stall timeout.
+	sm.streamLock.RLock()
+	stallTimeout := sm.clientStallTimeout
+	sm.streamLock.RUnlock()
+	stall := time.NewTimer(stallTimeout)
+	stopTimer(stall) // armed only while a send blocks
+	defer stall.Stop()
+	stalled := false
+
 	for {
 		// Wait for data availability or done
 		buffer.bufMu.Lock()
@@ -384,6 +584,9 @@ func (sm *SessionManager) serveClient(buffer *StreamBuffer, username string) {
 		}
 		// Handle overflow: if ring wrapped and client is too far behind, fast-forward
 		if buffer.head > uint64(buffer.ringCap) && next < buffer.head-uint64(buffer.ringCap) {
+			if buffer.metrics != nil {
+				buffer.metrics.dropped(buffer.head - uint64(buffer.ringCap) - next)
+			}
 			next = buffer.head - uint64(buffer.ringCap)
 		}
 		chunk := buffer.ring[next%uint64(buffer.ringCap)]
@@ -403,31 +606,71 @@ func (sm *SessionManager) serveClient(buffer *StreamBuffer, username string) {
 		if out == nil {
 			goto EXIT
 		}
+		if buffer.metrics != nil {
+			// Try without waiting first so a full channel counts as a blocked send
+			select {
+			case out <- chunk:
+				continue
+			default:
+			}
+		}
+		stall.Reset(stallTimeout)
+		blockedAt := time.Now()
 		select {
 		case out <- chunk:
-			// ok
+			stopTimer(stall)
+			if buffer.metrics != nil {
+				buffer.metrics.blocked(time.Since(blockedAt))
+			}
 		case <-done:
 			goto EXIT
+		case <-stall.C:
+			log.WarnLog("Client %s stalled on stream %s for %v, disconnecting", username, buffer.streamID, stallTimeout)
+			if buffer.metrics != nil {
+				buffer.metrics.stalled()
+			}
+			stalled = true
+			goto EXIT
 		}
 	}
 
 EXIT:
-	// Close the outgoing data channel to signal HTTP writer to finish
+	// Close the outgoing data channel to signal HTTP writer to finish. Only
+	// this goroutine closes it; the map entries may already belong to a newer
+	// connection of the same user.
 	buffer.clientsLock.Lock()
-	if ch, ok := buffer.clients[username]; ok {
+	if ch != nil {
 		close(ch)
+	}
+	if buffer.clients[username] == ch {
 		delete(buffer.clients, username)
 	}
-	if d, ok := buffer.clientDone[username]; ok {
-		close(d) // idempotent close guarded by ok if already closed elsewhere
+	if d, ok := buffer.clientDone[username]; ok && d == done {
+		close(d) // entries are removed when closed elsewhere
 		delete(buffer.clientDone, username)
 	}
 	buffer.clientsLock.Unlock()
+
+	// Drop the viewer through the normal path so the upstream is released if it was the last one
+	if stalled {
+		sm.removeClient(log, buffer.streamID, username)
+	}
+}
+
+// stopTimer stops t and drops a tick it already sent, so the next Reset
+// cannot fire early on a stale tick, whichever timer semantics apply.
+func stopTimer(t *time.Timer) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
 }
 
 // streamToClients fetches the stream from upstream and fills the ring buffer
 func (sm *SessionManager) streamToClients(buffer *StreamBuffer, upstreamURL *url.URL) {
-	utils.DebugLog("Starting stream from %s", upstreamURL.String())
+	buffer.log.DebugLog("Starting stream from %s", upstreamURL.String())
 
 	// Create a context that cancels when the stream is stopped
 	ctx, cancel := context.WithCancel(context.Background())
@@ -440,7 +683,7 @@ func (sm *SessionManager) streamToClients(buffer *StreamBuffer, upstreamURL *url
 	// Bind the upstream request to the cancelable context
 	req, err := http.NewRequestWithContext(ctx, "GET", upstreamURL.String(), nil)
 	if err != nil {
-		utils.ErrorLog("Failed to create request: %v", err)
+		buffer.log.ErrorLog("Failed to create request: %v", err)
 		return
 	}
 
@@ -448,7 +691,7 @@ func (sm *SessionManager) streamToClients(buffer *StreamBuffer, upstreamURL *url
 	isVOD := strings.Contains(upstreamURL.Path, "/movie/") || strings.Contains(upstreamURL.Path, "/series/")
 	if isVOD {
 		h := http.Header{}
-		h.Set("User-Agent", utils.GetIPTVUserAgent())
+		h.Set("User-Agent", utils.UserAgentFor(upstreamURL.Host))
 		h.Set("Accept", "*/*")
 	h.Set("Accept-Language", utils.GetLanguageHeader())
 		h.Set("Accept-Encoding", "identity")
@@ -456,7 +699,7 @@ func (sm *SessionManager) streamToClients(buffer *StreamBuffer, upstreamURL *url
 		h.Set("Range", "bytes=0-")
 		req.Header = h
 	} else {
-		req.Header.Set("User-Agent", utils.GetIPTVUserAgent())
+		req.Header.Set("User-Agent", utils.UserAgentFor(req.URL.Host))
 		req.Header.Set("Accept", "*/*")
 		req.Header.Set("Accept-Encoding", "identity")
 		req.Header.Set("Connection", "keep-alive")
@@ -464,8 +707,8 @@ func (sm *SessionManager) streamToClients(buffer *StreamBuffer, upstreamURL *url
 
 	resp, err := sm.httpClient.Do(req)
 	if err != nil {
-		utils.ErrorLog("Failed to connect to upstream: %v", err)
-		sm.stopStream(buffer.streamID)
+		buffer.log.ErrorLog("Failed to connect to upstream: %v", err)
+		sm.stopFromUpstream(buffer)
 		return
 	}
 	defer resp.Body.Close()
@@ -473,46 +716,68 @@ func (sm *SessionManager) streamToClients(buffer *StreamBuffer, upstreamURL *url
 	// Check if response is successful. For VOD with Range requests, 206 is valid.
 	if isVOD {
 		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
-			utils.ErrorLog("Upstream returned status %d for VOD stream %s",
+			buffer.log.ErrorLog("Upstream returned status %d for VOD stream %s",
 				resp.StatusCode, buffer.streamID)
-			sm.stopStream(buffer.streamID)
+			sm.stopFromUpstream(buffer)
 			return
 		}
 	} else {
 		if resp.StatusCode != http.StatusOK {
-			utils.ErrorLog("Upstream returned status %d for stream %s",
+			buffer.log.ErrorLog("Upstream returned status %d for stream %s",
 				resp.StatusCode, buffer.streamID)
-			sm.stopStream(buffer.streamID)
+			sm.stopFromUpstream(buffer)
 			return
 		}
 	}
 
-	// Stream data into ring buffer
-	buffer.active = true
+	// Stream data into ring buffer. The buffer is active from its creation;
+	// only stopStream clears it, under bufMu and streamLock.
 
-	const chunkSize = 128 * 1024 // was 64KB; larger chunks reduce per-write overhead
-	dataBuffer := make([]byte, chunkSize)
+	// A provider that wedges the connection sends nothing and never closes it;
+	// cancel the request when no data arrived for upstreamIdle so viewers
+	// are released and can reconnect
+	sm.streamLock.RLock()
+	idleTimeout := sm.upstreamIdle
+	sm.streamLock.RUnlock()
+	var idle atomic.Bool
+	resetIdle := func() {}
+	if idleTimeout > 0 {
+		timer := time.AfterFunc(idleTimeout, func() {
+			idle.Store(true)
+			cancel()
+		})
+		defer timer.Stop()
+		resetIdle = func() { timer.Reset(idleTimeout) }
+	}
+
+	dataBuffer := make([]byte, buffer.chunkSize)
 
 	for {
 		// Stop requested
 		select {
 		case <-buffer.stopChan:
-			utils.DebugLog("Stream %s stopped", buffer.streamID)
+			buffer.log.DebugLog("Stream %s stopped", buffer.streamID)
 			return
 		default:
 		}
 
 		n, rerr := resp.Body.Read(dataBuffer)
 		if rerr != nil {
-			if rerr != io.EOF && ctx.Err() == nil {
-				utils.ErrorLog("Error reading from upstream: %v", rerr)
+			switch {
+			case idle.Load():
+				buffer.log.WarnLog("Upstream for stream %s sent nothing for %v, stopping it", buffer.streamID, idleTimeout)
+			case rerr == io.EOF:
+				buffer.log.InfoLog("Upstream closed stream %s (EOF)", buffer.streamID)
+			case ctx.Err() == nil:
+				buffer.log.ErrorLog("Error reading from upstream: %v", rerr)
 			}
-			sm.stopStream(buffer.streamID)
+			sm.stopFromUpstream(buffer)
 			return
 		}
 		if n <= 0 {
 			continue
 		}
+		resetIdle()
 
 		// Copy to ring buffer
 		chunk := make([]byte, n)
@@ -534,6 +799,17 @@ func (sm *SessionManager) streamToClients(buffer *StreamBuffer, upstreamURL *url
 	}
 }
 
+// stopFromUpstream stops the stream fed by buffer when its upstream ends or
+// fails. It takes streamLock, and leaves alone a newer stream started under
+// the same id in the meantime.
+func (sm *SessionManager) stopFromUpstream(buffer *StreamBuffer) {
+	sm.streamLock.Lock()
+	defer sm.streamLock.Unlock()
+	if sm.streamBuffers[buffer.streamID] == buffer {
+		sm.stopStream(buffer.streamID)
+	}
+}
+
 // GetClientChannel retrieves the data channel for a specific client
 func (sm *SessionManager) GetClientChannel(streamID, username string) (chan []byte, bool) {
 	sm.streamLock.RLock()
@@ -551,8 +827,13 @@ func (sm *SessionManager) GetClientChannel(streamID, username string) (chan []by
 	return channel, exists
 }
 
-// RemoveClient removes a client from a stream
-func (sm *SessionManager) RemoveClient(streamID, username string) {
+// RemoveClient removes a client from a stream. ctx is the client request's,
+// for its request id in logs.
+func (sm *SessionManager) RemoveClient(ctx context.Context, streamID, username string) {
+	sm.removeClient(utils.ForRequest(ctx), streamID, username)
+}
+
+func (sm *SessionManager) removeClient(log utils.RequestLogger, streamID, username string) {
 	sm.streamLock.Lock()
 	defer sm.streamLock.Unlock()
 
@@ -575,8 +856,7 @@ func (sm *SessionManager) RemoveClient(streamID, username string) {
 		close(d)
 		delete(buffer.clientDone, username)
 	}
-	// don’t close buffer.clients[username] here; goroutine closes it
-	delete(buffer.clients, username)
+	// buffer.clients[username] is left to the goroutine, which closes it
 	buffer.clientsLock.Unlock()
 
 	// Remove from stream session and stop the stream if last viewer
@@ -584,16 +864,20 @@ func (sm *SessionManager) RemoveClient(streamID, username string) {
 	if !exists {
 		return
 	}
+	sm.closeHistory(streamSession, username)
 	if !streamSession.RemoveViewer(username) && buffer.active {
-		sm.stopStream(streamID)
+		// Give a player that only dropped its connection a chance to come back
+		sm.lingerOrStopLocked(streamID)
 	}
 
-	utils.InfoLog("User %s removed from stream %s", username, streamID)
+	log.InfoLog("User %s removed from stream %s", username, streamID)
 }
 
 // stopStream stops an active stream
 func (sm *SessionManager) stopStream(streamID string) {
-	utils.InfoLog("Stopping stream %s", streamID)
+	log := sm.streamLog(streamID)
+	log.InfoLog("Stopping stream %s", streamID)
+	sm.cancelLingerLocked(streamID)
 
 	buffer, exists := sm.streamBuffers[streamID]
 	if !exists || !buffer.active {
@@ -602,29 +886,166 @@ func (sm *SessionManager) stopStream(streamID string) {
 
 	// Signal upstream goroutine to stop
 	close(buffer.stopChan)
+	buffer.bufMu.Lock()
 	buffer.active = false
+	buffer.bufMu.Unlock()
+	// Wake client readers parked on the ring so they can exit
+	buffer.cond.Broadcast()
 
-	// Signal all clients to stop; each goroutine closes its data channel
+	// Signal all clients to stop; each goroutine closes its data channel,
+	// which it finds in clients, so the HTTP writers return
 	buffer.clientsLock.Lock()
 	for username, d := range buffer.clientDone {
 		close(d)
 		delete(buffer.clientDone, username)
 	}
-	buffer.clients = make(map[string]chan []byte)
 	buffer.clientsLock.Unlock()
 
-	// Update the stream session
+	// Update the stream session and end the history of anyone still watching
 	if streamSession, exists := sm.streamSessions[streamID]; exists {
 		streamSession.Active = false
+		for _, id := range streamSession.TakeAllHistoryIDs() {
+			sm.closeHistoryID(id)
+		}
+		if buffer.metrics != nil && sm.persistQuality {
+			buffer.bufMu.Lock()
+			q := buffer.metrics.snapshot(buffer.head)
+			buffer.bufMu.Unlock()
+			go sm.saveQualitySummary(streamSession, q)
+		}
+	}
+
+	log.InfoLog("Stream %s stopped and all clients disconnected", streamID)
+}
+
+// streamLog returns the logger of the request that started streamID. Must be
+// called with streamLock held.
+func (sm *SessionManager) streamLog(streamID string) utils.RequestLogger {
+	if buffer, ok := sm.streamBuffers[streamID]; ok {
+		return buffer.log
+	}
+	return utils.RequestLogger{}
+}
+
+// StopAllStreams force-stops every active stream and disconnects all of its
+// viewers. When block is true, new streams are refused until SetStreamsBlocked(false).
+// It returns the number of streams stopped and viewers disconnected.
+func (sm *SessionManager) StopAllStreams(block bool) (int, int) {
+	sm.streamLock.Lock()
+	if block {
+		sm.streamsBlocked = true
+	}
+	blocked := sm.streamsBlocked
+
+	stopped, viewers := 0, 0
+	detached := make(map[string]string)
+	for streamID, buffer := range sm.streamBuffers {
+		if !buffer.active {
+			continue
+		}
+		for _, username := range sm.detachViewers(streamID) {
+			detached[username] = streamID
+			viewers++
+		}
+		sm.stopStream(streamID)
+		stopped++
+	}
+	sm.streamLock.Unlock()
+
+	// userLock is taken after streamLock is released, as cleanupExpiredSessions
+	// takes them the other way round
+	sm.clearUserStreams(detached)
+
+	utils.WarnLog("Stop-all: %d streams stopped, %d viewers disconnected (new streams blocked: %v)", stopped, viewers, blocked)
+	return stopped, viewers
+}
+
+// StopStream force-stops a single active stream, disconnecting all of its
+// viewers and releasing the upstream connection. The id may be given with or
+// without its file extension. ok is false when no such stream is active.
+func (sm *SessionManager) StopStream(streamID string) (viewers int, ok bool) {
+	sm.streamLock.Lock()
+	key := ""
+	for id, buffer := range sm.streamBuffers {
+		if !buffer.active {
+			continue
+		}
+		if id == streamID || strings.TrimSuffix(id, path.Ext(id)) == streamID {
+			key = id
+			break
+		}
+	}
+	if key == "" {
+		sm.streamLock.Unlock()
+		return 0, false
+	}
+
+	detached := make(map[string]string)
+	for _, username := range sm.detachViewers(key) {
+		detached[username] = key
 	}
+	sm.stopStream(key)
+	sm.streamLock.Unlock()
 
-	utils.InfoLog("Stream %s stopped and all clients disconnected", streamID)
+	sm.clearUserStreams(detached)
+	utils.WarnLog("Stream %s force-stopped, %d viewers disconnected", key, len(detached))
+	return len(detached), true
+}
+
+// detachViewers removes every viewer from a stream session and returns their
+// usernames. Must be called with streamLock held; the caller clears their user
+// sessions with clearUserStreams once streamLock is released.
+func (sm *SessionManager) detachViewers(streamID string) []string {
+	ss, ok := sm.streamSessions[streamID]
+	if !ok {
+		return nil
+	}
+	var usernames []string
+	for username := range ss.GetViewers() {
+		ss.RemoveViewer(username)
+		usernames = append(usernames, username)
+	}
+	return usernames
+}
+
+// clearUserStreams clears the stream from the user sessions of detached
+// viewers, keyed by username. A user who has since moved to another stream is
+// left alone. Must be called without streamLock held.
+func (sm *SessionManager) clearUserStreams(detached map[string]string) {
+	if len(detached) == 0 {
+		return
+	}
+	sm.userLock.Lock()
+	defer sm.userLock.Unlock()
+	for username, streamID := range detached {
+		if us, exists := sm.userSessions[username]; exists && us.StreamID == streamID {
+			us.StreamID = ""
+			us.StreamType = ""
+		}
+	}
+}
+
+// SetStreamsBlocked blocks or re-enables new stream requests.
+func (sm *SessionManager) SetStreamsBlocked(blocked bool) {
+	sm.streamLock.Lock()
+	sm.streamsBlocked = blocked
+	sm.streamLock.Unlock()
+	utils.InfoLog("New streams blocked: %v", blocked)
+}
+
+// StreamsBlocked reports whether new streams are currently refused.
+func (sm *SessionManager) StreamsBlocked() bool {
+	sm.streamLock.RLock()
+	defer sm.streamLock.RUnlock()
+	return sm.streamsBlocked
 }
 
 // GenerateTemporaryLink creates a temporary download link
 func (sm *SessionManager) GenerateTemporaryLink(username, streamID, title, rawURL string) (string, error) {
 	token := uuid.New().String()
+	sm.streamLock.RLock()
 	expiresAt := time.Now().Add(sm.tempLinkTimeout)
+	sm.streamLock.RUnlock()
 	
 	tempLink := &types.TemporaryLink{
 		Token:     token,
@@ -638,6 +1059,8 @@ func (sm *SessionManager) GenerateTemporaryLink(username, streamID, title, rawUR
 	// Store in memory
 	sm.tempLinkLock.Lock()
 	sm.tempLinks[token] = tempLink
+	sm.tempLinkElems[token] = sm.tempLinkOrder.PushFront(token)
+	sm.evictTempLinksLocked()
 	sm.tempLinkLock.Unlock()
 	
 	// Store in database if available
@@ -654,9 +1077,12 @@ func (sm *SessionManager) GenerateTemporaryLink(username, streamID, title, rawUR
 // GetTemporaryLink retrieves a temporary link by token
 func (sm *SessionManager) GetTemporaryLink(token string) (*types.TemporaryLink, error) {
 	// First check in memory
-	sm.tempLinkLock.RLock()
+	sm.tempLinkLock.Lock()
 	tempLink, exists := sm.tempLinks[token]
-	sm.tempLinkLock.RUnlock()
+	if e, ok := sm.tempLinkElems[token]; ok {
+		sm.tempLinkOrder.MoveToFront(e)
+	}
+	sm.tempLinkLock.Unlock()
 	
 	if exists && time.Now().Before(tempLink.ExpiresAt) {
 		return tempLink, nil
@@ -670,6 +1096,82 @@ func (sm *SessionManager) GetTemporaryLink(token string) (*types.TemporaryLink,
 	return nil, fmt.Errorf("temporary link not found or expired")
 }
 
+// StoreVODRequest keeps a VOD search result set so later steps can refer to it by token
+func (sm *SessionManager) StoreVODRequest(req *types.VODRequest) {
+	sm.vodRequestLock.Lock()
+	sm.vodRequests[req.Token] = req
+	sm.vodRequestLock.Unlock()
+
+	if sm.db != nil {
+		if err := sm.db.SaveVODRequest(req); err != nil {
+			utils.ErrorLog("Failed to store VOD request in database: %v", err)
+		}
+	}
+}
+
+// GetVODRequest retrieves a stored VOD search by token, if not expired
+func (sm *SessionManager) GetVODRequest(token string) (*types.VODRequest, error) {
+	sm.vodRequestLock.RLock()
+	req, exists := sm.vodRequests[token]
+	sm.vodRequestLock.RUnlock()
+
+	if exists {
+		if time.Now().Before(req.ExpiresAt) {
+			return req, nil
+		}
+		return nil, fmt.Errorf("VOD request expired")
+	}
+
+	if sm.db != nil {
+		return sm.db.GetVODRequest(token)
+	}
+
+	return nil, fmt.Errorf("VOD request not found or expired")
+}
+
+// cleanupExpiredVODRequests drops expired VOD searches from memory and database
+func (sm *SessionManager) cleanupExpiredVODRequests() {
+	now := time.Now()
+	sm.vodRequestLock.Lock()
+	for token, req := range sm.vodRequests {
+		if now.After(req.ExpiresAt) {
+			delete(sm.vodRequests, token)
+		}
+	}
+	sm.vodRequestLock.Unlock()
+
+	if sm.db != nil {
+		if count, err := sm.db.CleanupExpiredVODRequests(); err == nil && count > 0 {
+			utils.DebugLog("Cleaned %d expired VOD requests", count)
+		}
+	}
+}
+
+// evictTempLinksLocked drops least recently used links from memory until the
+// cap is met. Evicted links stay retrievable through the database; without
+// one, memory is their only copy and nothing is evicted. Caller holds tempLinkLock.
+func (sm *SessionManager) evictTempLinksLocked() {
+	if sm.maxTempLinks <= 0 || sm.db == nil {
+		return
+	}
+	for sm.tempLinkOrder.Len() > sm.maxTempLinks {
+		oldest := sm.tempLinkOrder.Back()
+		token := oldest.Value.(string)
+		sm.tempLinkOrder.Remove(oldest)
+		delete(sm.tempLinkElems, token)
+		delete(sm.tempLinks, token)
+		utils.DebugLog("Evicted temporary link %s from memory (cap %d)", utils.MaskString(token), sm.maxTempLinks)
+	}
+}
+
+// SetMaxTempLinks sets how many temporary links are kept in memory (0 disables the cap)
+func (sm *SessionManager) SetMaxTempLinks(n int) {
+	sm.tempLinkLock.Lock()
+	sm.maxTempLinks = n
+	sm.evictTempLinksLocked()
+	sm.tempLinkLock.Unlock()
+}
+
 // GetAllSessions returns all current user sessions
 func (sm *SessionManager) GetAllSessions() []*types.UserSession {
 	sm.userLock.RLock()
@@ -683,6 +1185,17 @@ func (sm *SessionManager) GetAllSessions() []*types.UserSession {
 	return sessions
 }
 
+// SetHLSVariant records the HLS rendition a user's player picked. It is
+// informational only and does nothing when the user has no session.
+func (sm *SessionManager) SetHLSVariant(username string, variant *types.HLSVariant) {
+	sm.userLock.Lock()
+	defer sm.userLock.Unlock()
+
+	if session, exists := sm.userSessions[username]; exists {
+		session.HLSVariant = variant
+	}
+}
+
 // GetAllStreams returns all active stream sessions
 func (sm *SessionManager) GetAllStreams() []*types.StreamSession {
 	sm.streamLock.RLock()
@@ -714,7 +1227,7 @@ func (sm *SessionManager) DisconnectUser(username string) {
 	
 	// If user was watching a stream, remove them
 	if streamID != "" {
-		sm.RemoveClient(streamID, username)
+		sm.removeClient(utils.RequestLogger{}, streamID, username)
 	}
 	
 	utils.InfoLog("User %s forcibly disconnected", username)
@@ -731,15 +1244,125 @@ func (sm *SessionManager) GetStreamInfo(streamID string) (*types.StreamSession,
 
 // SetSessionTimeout sets the user session timeout duration
 func (sm *SessionManager) SetSessionTimeout(timeout time.Duration) {
+	sm.streamLock.Lock()
+	defer sm.streamLock.Unlock()
 	sm.sessionTimeout = timeout
 }
 
+// SetUpstreamReadTimeout sets how long an upstream may send nothing before
+// its stream is stopped; 0 disables the check.
+func (sm *SessionManager) SetUpstreamReadTimeout(timeout time.Duration) {
+	sm.streamLock.Lock()
+	defer sm.streamLock.Unlock()
+	sm.upstreamIdle = timeout
+}
+
+// SetJoinPreroll sets how many already buffered chunks a viewer joining a
+// running stream receives first; 0 starts at the live edge.
+func (sm *SessionManager) SetJoinPreroll(chunks int) {
+	sm.streamLock.Lock()
+	defer sm.streamLock.Unlock()
+	sm.joinPreroll = chunks
+}
+
+// SetMaxViewersPerStream caps the viewers of one stream; 0 removes the cap.
+// Viewers of a stream share one upstream connection, so the cap protects the
+// proxy (a goroutine and a queue per viewer), not the provider.
+func (sm *SessionManager) SetMaxViewersPerStream(n int) {
+	sm.streamLock.Lock()
+	defer sm.streamLock.Unlock()
+	sm.maxViewers = n
+}
+
 // SetStreamTimeout sets the unused stream timeout duration
 func (sm *SessionManager) SetStreamTimeout(timeout time.Duration) {
+	sm.streamLock.Lock()
+	defer sm.streamLock.Unlock()
 	sm.streamTimeout = timeout
 }
 
+// SetClientStallTimeout sets how long a chunk may wait for a slow client before it is disconnected
+func (sm *SessionManager) SetClientStallTimeout(timeout time.Duration) {
+	sm.streamLock.Lock()
+	defer sm.streamLock.Unlock()
+	sm.clientStallTimeout = timeout
+}
+
+// SetBufferSize sets the ring capacity (chunks) and read chunk size (bytes)
+// for new streams of streamType; "" applies to every type. Zero keeps the
+// current value. Each active stream may hold up to ringCap*chunkSize bytes
+// (32MB with the 256 x 128KB live default), so lower both for many low-bitrate
+// streams such as radio. The ring must also cover a viewer's jitter: a client
+// lagging more than ringCap chunks skips ahead and sees a glitch.
+func (sm *SessionManager) SetBufferSize(streamType string, ringCap, chunkSize int) {
+	sm.streamLock.Lock()
+	defer sm.streamLock.Unlock()
+	apply := func(cur bufferSize) bufferSize {
+		if ringCap > 0 {
+			cur.ringCap = ringCap
+		}
+		if chunkSize > 0 {
+			cur.chunkSize = chunkSize
+		}
+		return cur
+	}
+	if streamType != "" {
+		cur, ok := sm.bufferSizes[streamType]
+		if !ok {
+			cur = sm.bufferSizes[""]
+		}
+		sm.bufferSizes[streamType] = apply(cur)
+		return
+	}
+	for t, cur := range sm.bufferSizes {
+		sm.bufferSizes[t] = apply(cur)
+	}
+}
+
 // SetTempLinkTimeout sets the temporary link expiration duration
 func (sm *SessionManager) SetTempLinkTimeout(timeout time.Duration) {
+	sm.streamLock.Lock()
+	defer sm.streamLock.Unlock()
 	sm.tempLinkTimeout = timeout
 }
+
+// Settings reports the limits and timeouts currently in effect.
+func (sm *SessionManager) Settings() map[string]interface{} {
+	sm.streamLock.RLock()
+	buffers := make(map[string]interface{}, len(sm.bufferSizes))
+	for t, b := range sm.bufferSizes {
+		if t == "" {
+			t = "default"
+		}
+		buffers[t] = map[string]int{"ring_chunks": b.ringCap, "chunk_bytes": b.chunkSize}
+	}
+	blocked := sm.streamsBlocked
+	qualityMetrics, persistQuality := sm.qualityMetrics, sm.persistQuality
+	profile := sm.memoryProfile
+	linger := sm.streamLinger
+	maxViewers := sm.maxViewers
+	sessionTimeout, streamTimeout, tempLinkTimeout := sm.sessionTimeout, sm.streamTimeout, sm.tempLinkTimeout
+	stallTimeout, upstreamIdle, joinPreroll := sm.clientStallTimeout, sm.upstreamIdle, sm.joinPreroll
+	sm.streamLock.RUnlock()
+
+	sm.tempLinkLock.RLock()
+	maxTempLinks := sm.maxTempLinks
+	sm.tempLinkLock.RUnlock()
+
+	return map[string]interface{}{
+		"session_timeout":        sessionTimeout.String(),
+		"stream_timeout":         streamTimeout.String(),
+		"temp_link_timeout":      tempLinkTimeout.String(),
+		"client_stall_timeout":   stallTimeout.String(),
+		"upstream_read_timeout":  upstreamIdle.String(),
+		"join_preroll_chunks":    joinPreroll,
+		"stream_linger":          linger.String(),
+		"max_viewers_per_stream": maxViewers,
+		"temp_link_cache_size":   maxTempLinks,
+		"stream_buffers":         buffers,
+		"streams_blocked":        blocked,
+		"quality_metrics":        qualityMetrics,
+		"persist_quality":        persistQuality,
+		"memory_profile":         profile,
+	}
+}
@@ -0,0 +1,404 @@
+package session
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lucasduport/stream-share/pkg/database"
+	"github.com/lucasduport/stream-share/pkg/types"
+)
+
+// testDB connects to the PostgreSQL database named by TEST_DATABASE_URL, and
+// skips the test when it is unset.
+func testDB(t *testing.T) *database.DBManager {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	t.Setenv("DATABASE_URL", dsn)
+	db, err := database.NewDBManager("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestTemporaryLinkCap(t *testing.T) {
+	tests := []struct {
+		name       string
+		db         func(t *testing.T) *database.DBManager
+		wantMemory int
+	}{
+		{"without a database nothing is evicted", func(*testing.T) *database.DBManager { return nil }, 5},
+		{"evicted links are read from the database", testDB, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm := NewSessionManager(tt.db(t))
+			sm.SetMaxTempLinks(2)
+			var tokens []string
+			for i := 0; i < 5; i++ {
+				token, err := sm.GenerateTemporaryLink("alice", "42", "Movie", "http://provider/movie/42.mp4")
+				if err != nil {
+					t.Fatal(err)
+				}
+				tokens = append(tokens, token)
+			}
+
+			sm.tempLinkLock.Lock()
+			inMemory := len(sm.tempLinks)
+			sm.tempLinkLock.Unlock()
+			if inMemory != tt.wantMemory {
+				t.Errorf("%d links in memory, want %d", inMemory, tt.wantMemory)
+			}
+			for i, token := range tokens {
+				link, err := sm.GetTemporaryLink(token)
+				if err != nil {
+					t.Fatalf("link %d: %v", i, err)
+				}
+				if link.Token != token || link.StreamID != "42" {
+					t.Errorf("link %d = %+v", i, link)
+				}
+			}
+		})
+	}
+}
+
+// liveUpstream serves an endless stream in small chunks until the request is
+// canceled.
+func liveUpstream(t *testing.T) *url.URL {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chunk := make([]byte, 512)
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(2 * time.Millisecond):
+			}
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+		}
+	}))
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL + "/live/u/p/1.ts")
+	return u
+}
+
+// TestStalledClientDetached checks that a viewer who stops reading is
+// disconnected after the stall timeout while the other viewer keeps streaming.
+func TestStalledClientDetached(t *testing.T) {
+	tests := []struct {
+		name    string
+		metrics bool
+	}{
+		{"without quality metrics", false},
+		{"with quality metrics", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := liveUpstream(t)
+			sm := NewSessionManager(nil)
+			sm.SetClientStallTimeout(150 * time.Millisecond)
+			sm.SetBufferSize("", 8, 512)
+			sm.SetQualityMetrics(tt.metrics, false)
+			t.Cleanup(func() { sm.StopStream("1") })
+
+			if _, err := sm.RequestStream(context.Background(), "alice", "1", "live", "Channel", upstream); err != nil {
+				t.Fatal(err)
+			}
+			alice, ok := sm.GetClientChannel("1", "alice")
+			if !ok {
+				t.Fatal("alice has no channel")
+			}
+			var received atomic.Int64
+			go func() {
+				for chunk := range alice {
+					received.Add(int64(len(chunk)))
+				}
+			}()
+			// bob joins and never reads
+			if _, err := sm.RequestStream(context.Background(), "bob", "1", "live", "Channel", upstream); err != nil {
+				t.Fatal(err)
+			}
+
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				_, attached := sm.GetClientChannel("1", "bob")
+				info, _ := sm.GetStreamInfo("1")
+				_, viewing := info.GetViewers()["bob"]
+				if !attached && !viewing {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("bob still attached=%v viewing=%v after 5s", attached, viewing)
+				}
+				time.Sleep(20 * time.Millisecond)
+			}
+
+			before := received.Load()
+			time.Sleep(300 * time.Millisecond)
+			if received.Load() <= before {
+				t.Error("alice stopped receiving data after bob was detached")
+			}
+			if _, ok := sm.GetClientChannel("1", "alice"); !ok {
+				t.Error("alice was detached")
+			}
+			if tt.metrics {
+				if q := sm.StreamQuality()["1"]; q.Stalls != 1 {
+					t.Errorf("stalls = %d, want 1", q.Stalls)
+				}
+			}
+		})
+	}
+}
+
+// TestQualityMetricsSlowClient checks that a viewer reading slower than the
+// stream arrives is counted as blocked sends and fast-forward drops, and that
+// nothing is collected with metrics off.
+func TestQualityMetricsSlowClient(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		upstream := liveUpstream(t)
+		sm := NewSessionManager(nil)
+		sm.SetClientStallTimeout(5 * time.Second)
+		sm.SetBufferSize("", 8, 512)
+		sm.SetQualityMetrics(enabled, false)
+
+		if _, err := sm.RequestStream(context.Background(), "alice", "1", "live", "Channel", upstream); err != nil {
+			t.Fatal(err)
+		}
+		alice, ok := sm.GetClientChannel("1", "alice")
+		if !ok {
+			t.Fatal("alice has no channel")
+		}
+		stop := make(chan struct{})
+		go func() {
+			for {
+				select {
+				case <-stop:
+					return
+				case <-time.After(20 * time.Millisecond):
+				}
+				if _, ok := <-alice; !ok {
+					return
+				}
+			}
+		}()
+
+		time.Sleep(500 * time.Millisecond)
+		q, collected := sm.StreamQuality()["1"]
+		close(stop)
+		sm.StopStream("1")
+
+		if !enabled {
+			if collected {
+				t.Errorf("metrics off: got %+v", q)
+			}
+			continue
+		}
+		if q.BlockedSends == 0 || q.BlockedMillis == 0 {
+			t.Errorf("blocked sends = %d (%d ms), want > 0", q.BlockedSends, q.BlockedMillis)
+		}
+		if q.DropEvents == 0 || q.DroppedChunks < q.DropEvents {
+			t.Errorf("drop events = %d, dropped chunks = %d", q.DropEvents, q.DroppedChunks)
+		}
+		if q.Stalls != 0 {
+			t.Errorf("stalls = %d, want 0", q.Stalls)
+		}
+		if q.ChunksProduced == 0 || q.DropRatio <= 0 || q.DropRatio > 1 {
+			t.Errorf("produced = %d, drop ratio = %v", q.ChunksProduced, q.DropRatio)
+		}
+	}
+}
+
+// TestStopStreamDuringSessionCleanup runs StopStream while expired sessions are
+// being cleaned up. The cleanup holds userLock and then takes streamLock, so
+// StopStream must not wait for userLock while it holds streamLock.
+func TestStopStreamDuringSessionCleanup(t *testing.T) {
+	upstream := liveUpstream(t)
+	sm := NewSessionManager(nil)
+	sm.SetBufferSize("", 8, 512)
+	for _, user := range []string{"alice", "bob"} {
+		if _, err := sm.RequestStream(context.Background(), user, "1", "live", "Channel", upstream); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Every session counts as expired
+	sm.SetSessionTimeout(-time.Hour)
+
+	// Hold userLock as cleanupExpiredSessions does while StopStream runs
+	sm.userLock.Lock()
+	stopped := make(chan int)
+	go func() {
+		viewers, _ := sm.StopStream("1")
+		stopped <- viewers
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	cleaned := make(chan struct{})
+	go func() {
+		sm.streamLock.Lock()
+		sm.streamLock.Unlock()
+		close(cleaned)
+	}()
+	select {
+	case <-cleaned:
+	case <-time.After(2 * time.Second):
+		t.Fatal("StopStream holds streamLock while waiting for userLock")
+	}
+	sm.userLock.Unlock()
+
+	select {
+	case viewers := <-stopped:
+		if viewers != 2 {
+			t.Errorf("StopStream disconnected %d viewers, want 2", viewers)
+		}
+		for _, user := range []string{"alice", "bob"} {
+			if us := sm.GetUserSession(user); us == nil || us.StreamID != "" {
+				t.Errorf("%s session after StopStream = %+v, want one without a stream", user, us)
+			}
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("StopStream did not return")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		sm.cleanupExpiredSessions()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("cleanupExpiredSessions did not return")
+	}
+	for _, user := range []string{"alice", "bob"} {
+		if sm.GetUserSession(user) != nil {
+			t.Errorf("%s still has a session after cleanup", user)
+		}
+	}
+}
+
+// TestStopAllStreams stops two streams with two viewers each, blocking new
+// streams until they are allowed again.
+func TestStopAllStreams(t *testing.T) {
+	sm := NewSessionManager(nil)
+	sm.SetBufferSize("", 8, 512)
+	viewers := map[string][]string{"1": {"alice", "bob"}, "2": {"carol", "dave"}}
+	buffers := map[string]*StreamBuffer{}
+	var channels []<-chan []byte
+	for streamID, users := range viewers {
+		upstream := liveUpstream(t)
+		for _, user := range users {
+			buffer, err := sm.RequestStream(context.Background(), user, streamID, "live", "Channel", upstream)
+			if err != nil {
+				t.Fatal(err)
+			}
+			buffers[streamID] = buffer
+			ch, ok := sm.GetClientChannel(streamID, user)
+			if !ok {
+				t.Fatalf("%s has no channel on stream %s", user, streamID)
+			}
+			channels = append(channels, ch)
+		}
+	}
+
+	stopped, disconnected := sm.StopAllStreams(true)
+	if stopped != 2 || disconnected != 4 {
+		t.Errorf("StopAllStreams = %d streams, %d viewers, want 2, 4", stopped, disconnected)
+	}
+	for streamID, buffer := range buffers {
+		buffer.bufMu.Lock()
+		active := buffer.active
+		buffer.bufMu.Unlock()
+		if active {
+			t.Errorf("stream %s still active", streamID)
+		}
+		if info, ok := sm.GetStreamInfo(streamID); ok && len(info.GetViewers()) > 0 {
+			t.Errorf("stream %s still has viewers %v", streamID, info.GetViewers())
+		}
+	}
+	for i, ch := range channels {
+		deadline := time.After(2 * time.Second)
+	drain:
+		for {
+			select {
+			case _, ok := <-ch:
+				if !ok {
+					break drain
+				}
+			case <-deadline:
+				t.Errorf("client channel %d not closed", i)
+				break drain
+			}
+		}
+	}
+	for _, users := range viewers {
+		for _, user := range users {
+			if us := sm.GetUserSession(user); us == nil || us.StreamID != "" {
+				t.Errorf("%s session after stop-all = %+v, want one without a stream", user, us)
+			}
+		}
+	}
+
+	upstream := liveUpstream(t)
+	if !sm.StreamsBlocked() {
+		t.Error("streams not blocked after StopAllStreams(true)")
+	}
+	if _, err := sm.RequestStream(context.Background(), "alice", "1", "live", "Channel", upstream); err != ErrStreamsBlocked {
+		t.Errorf("RequestStream while blocked = %v, want ErrStreamsBlocked", err)
+	}
+	sm.SetStreamsBlocked(false)
+	if _, err := sm.RequestStream(context.Background(), "alice", "1", "live", "Channel", upstream); err != nil {
+		t.Errorf("RequestStream once allowed again = %v", err)
+	}
+	sm.StopStream("1")
+}
+
+func TestVODRequestExpiry(t *testing.T) {
+	tests := []struct {
+		name string
+		db   func(t *testing.T) *database.DBManager
+	}{
+		{"in memory", func(*testing.T) *database.DBManager { return nil }},
+		{"restored from the database", testDB},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := tt.db(t)
+			sm := NewSessionManager(db)
+			now := time.Now()
+			results := []types.VODResult{{ID: "1", Title: "Movie (2020)"}, {ID: "2", Title: "Movie 2"}}
+			sm.StoreVODRequest(&types.VODRequest{Token: "t1520-live", Username: "alice", Query: "movie", Results: results, CreatedAt: now, ExpiresAt: now.Add(30 * time.Minute)})
+			sm.StoreVODRequest(&types.VODRequest{Token: "t1520-gone", Username: "alice", Query: "movie", Results: results, CreatedAt: now.Add(-time.Hour), ExpiresAt: now.Add(-time.Minute)})
+
+			// A restarted process only has the database
+			if db != nil {
+				sm = NewSessionManager(db)
+			}
+			req, err := sm.GetVODRequest("t1520-live")
+			if err != nil {
+				t.Fatalf("within expiry: %v", err)
+			}
+			if req.Username != "alice" || req.Query != "movie" || len(req.Results) != 2 || req.Results[1].ID != "2" {
+				t.Errorf("within expiry: got %+v", req)
+			}
+			if req, err := sm.GetVODRequest("t1520-gone"); err == nil {
+				t.Errorf("past expiry: got %+v", req)
+			}
+			if req, err := sm.GetVODRequest("t1520-unknown"); err == nil {
+				t.Errorf("unknown token: got %+v", req)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package session
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxClientQueue bounds the chunks queued for one viewer. The queue never
+// exceeds the ring either: queued chunks keep their memory alive after the
+// ring has moved past them.
+const maxClientQueue = 256
+
+// memoryProfile is a preset of ring geometries, selected with MEMORY_PROFILE.
+type memoryProfile struct {
+	live bufferSize // default, live and timeshift
+	vod  bufferSize // movie and series
+}
+
+// memoryProfiles holds the presets. Per stream, live holds ringCap*chunkSize:
+// 4MB in low, 32MB in default and 64MB in high; VOD holds 8MB, 64MB and 128MB.
+var memoryProfiles = map[string]memoryProfile{
+	"low": {
+		live: bufferSize{ringCap: 64, chunkSize: 64 * 1024},
+		vod:  bufferSize{ringCap: 32, chunkSize: 256 * 1024},
+	},
+	"default": {
+		live: bufferSize{ringCap: 256, chunkSize: 128 * 1024},
+		// VOD is read as fast as the link allows; bigger reads cut per-chunk overhead
+		vod: bufferSize{ringCap: 128, chunkSize: 512 * 1024},
+	},
+	"high": {
+		live: bufferSize{ringCap: 512, chunkSize: 128 * 1024},
+		vod:  bufferSize{ringCap: 256, chunkSize: 512 * 1024},
+	},
+}
+
+func (p memoryProfile) sizes() map[string]bufferSize {
+	return map[string]bufferSize{
+		"":          p.live,
+		"live":      p.live,
+		"timeshift": p.live,
+		"movie":     p.vod,
+		"series":    p.vod,
+	}
+}
+
+// SetMemoryProfile replaces every buffer size with the low, default or high
+// preset. Apply it before any per-type SetBufferSize override.
+func (sm *SessionManager) SetMemoryProfile(name string) error {
+	name = strings.ToLower(strings.TrimSpace(name))
+	p, ok := memoryProfiles[name]
+	if !ok {
+		return fmt.Errorf("unknown memory profile %q (want low, default or high)", name)
+	}
+	sm.streamLock.Lock()
+	sm.bufferSizes = p.sizes()
+	sm.memoryProfile = name
+	sm.streamLock.Unlock()
+	return nil
+}
+
+// clientQueueLen is the channel capacity for a viewer of this stream.
+func (b *StreamBuffer) clientQueueLen() int {
+	if b.ringCap < maxClientQueue {
+		return b.ringCap
+	}
+	return maxClientQueue
+}
@@ -0,0 +1,98 @@
+package session
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestMemoryProfile checks the ring geometry, the viewer queue and the bytes
+// a stream may hold under each preset.
+func TestMemoryProfile(t *testing.T) {
+	tests := []struct {
+		profile, streamType string
+		wantRing, wantChunk int
+		wantQueue           int
+	}{
+		{"low", "live", 64, 64 * 1024, 64},
+		{"low", "movie", 32, 256 * 1024, 32},
+		{"default", "live", 256, 128 * 1024, 256},
+		{"default", "series", 128, 512 * 1024, 128},
+		{"high", "live", 512, 128 * 1024, maxClientQueue},
+		{" LOW ", "timeshift", 64, 64 * 1024, 64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.profile+"/"+tt.streamType, func(t *testing.T) {
+			upstream := liveUpstream(t)
+			sm := NewSessionManager(nil)
+			if err := sm.SetMemoryProfile(tt.profile); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { sm.StopStream("1") })
+			if _, err := sm.RequestStream(context.Background(), "alice", "1", tt.streamType, "Channel", upstream); err != nil {
+				t.Fatal(err)
+			}
+
+			sm.streamLock.RLock()
+			b := sm.streamBuffers["1"]
+			sm.streamLock.RUnlock()
+			if b.ringCap != tt.wantRing || b.chunkSize != tt.wantChunk || len(b.ring) != tt.wantRing {
+				t.Errorf("ring = %d (len %d) x %d bytes, want %d x %d", b.ringCap, len(b.ring), b.chunkSize, tt.wantRing, tt.wantChunk)
+			}
+			ch, ok := sm.GetClientChannel("1", "alice")
+			if !ok {
+				t.Fatal("alice has no channel")
+			}
+			if cap(ch) != tt.wantQueue {
+				t.Errorf("viewer queue = %d, want %d", cap(ch), tt.wantQueue)
+			}
+			// The viewer reads through the ring with the configured geometry
+			select {
+			case chunk := <-ch:
+				if len(chunk) == 0 || len(chunk) > tt.wantChunk {
+					t.Errorf("chunk of %d bytes, want 1..%d", len(chunk), tt.wantChunk)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("no data received")
+			}
+		})
+	}
+}
+
+func TestMemoryProfileFootprint(t *testing.T) {
+	perStream := func(p, streamType string) int {
+		s := memoryProfiles[p].sizes()[streamType]
+		return s.ringCap * s.chunkSize
+	}
+	const mb = 1024 * 1024
+	if got := perStream("low", "live"); got != 4*mb {
+		t.Errorf("low live buffer = %d bytes, want 4MB", got)
+	}
+	if got := perStream("low", "movie"); got != 8*mb {
+		t.Errorf("low movie buffer = %d bytes, want 8MB", got)
+	}
+	for _, st := range []string{"", "live", "timeshift", "movie", "series"} {
+		if low, def := perStream("low", st), perStream("default", st); low*4 > def {
+			t.Errorf("%q: low profile holds %d bytes, default %d; want at most a quarter", st, low, def)
+		}
+	}
+
+	sm := NewSessionManager(nil)
+	if err := sm.SetMemoryProfile("tiny"); err == nil {
+		t.Error("unknown profile accepted")
+	}
+	if sm.Settings()["memory_profile"] != "default" {
+		t.Errorf("memory_profile = %v after a rejected profile", sm.Settings()["memory_profile"])
+	}
+	// Per-type overrides refine the preset
+	if err := sm.SetMemoryProfile("low"); err != nil {
+		t.Fatal(err)
+	}
+	sm.SetBufferSize("live", 16, 0)
+	if s := sm.bufferSizes["live"]; s.ringCap != 16 || s.chunkSize != 64*1024 {
+		t.Errorf("live after override = %+v, want 16 x 64KB", s)
+	}
+	if s := sm.bufferSizes["movie"]; s.ringCap != 32 {
+		t.Errorf("movie ring = %d, want the preset's 32", s.ringCap)
+	}
+}
@@ -0,0 +1,127 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package session
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/lucasduport/stream-share/pkg/types"
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// streamMetrics counts delivery problems of one stream's clients. Channel
+// sends that had to wait stand in for client-side rebuffering, fast-forwards
+// for skipped (lost) video. All fields are accessed atomically.
+type streamMetrics struct {
+	blockedSends  int64
+	blockedNanos  int64
+	dropEvents    int64
+	droppedChunks int64
+	stalls        int64
+}
+
+// QualityMetrics is a snapshot of a stream's delivery counters.
+type QualityMetrics struct {
+	BlockedSends   int64   `json:"blocked_sends"`
+	BlockedMillis  int64   `json:"blocked_ms"`
+	DropEvents     int64   `json:"drop_events"`
+	DroppedChunks  int64   `json:"dropped_chunks"`
+	Stalls         int64   `json:"stalls"`
+	ChunksProduced uint64  `json:"chunks_produced"`
+	DropRatio      float64 `json:"drop_ratio"`
+}
+
+func (m *streamMetrics) blocked(d time.Duration) {
+	atomic.AddInt64(&m.blockedSends, 1)
+	atomic.AddInt64(&m.blockedNanos, int64(d))
+}
+
+func (m *streamMetrics) dropped(chunks uint64) {
+	atomic.AddInt64(&m.dropEvents, 1)
+	atomic.AddInt64(&m.droppedChunks, int64(chunks))
+}
+
+func (m *streamMetrics) stalled() { atomic.AddInt64(&m.stalls, 1) }
+
+// snapshot reads the counters of buffer; produced is its ring head.
+func (m *streamMetrics) snapshot(produced uint64) QualityMetrics {
+	q := QualityMetrics{
+		BlockedSends:   atomic.LoadInt64(&m.blockedSends),
+		BlockedMillis:  atomic.LoadInt64(&m.blockedNanos) / int64(time.Millisecond),
+		DropEvents:     atomic.LoadInt64(&m.dropEvents),
+		DroppedChunks:  atomic.LoadInt64(&m.droppedChunks),
+		Stalls:         atomic.LoadInt64(&m.stalls),
+		ChunksProduced: produced,
+	}
+	if produced > 0 {
+		q.DropRatio = float64(q.DroppedChunks) / float64(produced)
+	}
+	return q
+}
+
+// SetQualityMetrics turns per-stream quality counters on or off for streams
+// started afterwards; persist additionally stores a summary when a stream ends.
+func (sm *SessionManager) SetQualityMetrics(enabled, persist bool) {
+	sm.streamLock.Lock()
+	sm.qualityMetrics = enabled
+	sm.persistQuality = enabled && persist
+	sm.streamLock.Unlock()
+}
+
+// StreamQuality returns the quality counters of every active stream that
+// collects them, keyed by stream id.
+func (sm *SessionManager) StreamQuality() map[string]QualityMetrics {
+	sm.streamLock.RLock()
+	defer sm.streamLock.RUnlock()
+
+	out := make(map[string]QualityMetrics)
+	for id, b := range sm.streamBuffers {
+		if b.metrics == nil || !b.active {
+			continue
+		}
+		b.bufMu.Lock()
+		head := b.head
+		b.bufMu.Unlock()
+		out[id] = b.metrics.snapshot(head)
+	}
+	return out
+}
+
+// saveQualitySummary stores the final counters of a stopped stream.
+func (sm *SessionManager) saveQualitySummary(ss *types.StreamSession, q QualityMetrics) {
+	if sm.db == nil {
+		return
+	}
+	s := &types.StreamQualitySummary{
+		StreamID:      ss.StreamID,
+		StreamType:    ss.StreamType,
+		StreamTitle:   ss.StreamTitle,
+		StartTime:     ss.StartTime,
+		EndTime:       time.Now(),
+		BlockedSends:  q.BlockedSends,
+		BlockedMillis: q.BlockedMillis,
+		DropEvents:    q.DropEvents,
+		DroppedChunks: q.DroppedChunks,
+		Stalls:        q.Stalls,
+	}
+	if err := sm.db.SaveStreamQuality(s); err != nil {
+		utils.ErrorLog("Failed to save quality summary for stream %s: %v", ss.StreamID, err)
+	}
+}
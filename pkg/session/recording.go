@@ -0,0 +1,279 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package session
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/lucasduport/stream-share/pkg/types"
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// recordingRetention is how long a finished recording stays listed in the cache.
+const recordingRetention = 7 * 24 * time.Hour
+
+// Recording is a live stream being teed from its ring buffer into a file.
+type Recording struct {
+	ID          string `json:"id"` // also the vod_cache stream_id
+	StreamID    string `json:"stream_id"`
+	Title       string `json:"title,omitempty"`
+	RequestedBy string `json:"requested_by,omitempty"`
+	// Bot command and message/interaction id that started the recording
+	OriginCommand   string    `json:"origin_command,omitempty"`
+	OriginMessageID string    `json:"origin_message_id,omitempty"`
+	FilePath        string    `json:"file_path"`
+	StartedAt       time.Time `json:"started_at"`
+	EndsAt          time.Time `json:"ends_at"`
+
+	bytes  int64 // written so far, accessed atomically
+	cancel context.CancelFunc
+}
+
+// BytesWritten returns the number of bytes written to the recording so far.
+func (r *Recording) BytesWritten() int64 { return atomic.LoadInt64(&r.bytes) }
+
+// viewerName is the pseudo-viewer that keeps the stream alive while recording.
+func (r *Recording) viewerName() string { return "recorder:" + r.ID }
+
+// StartRecording tees the active stream streamID into dest for dur. The recorder
+// reads the ring buffer on its own cursor, so a slow disk only makes it skip
+// chunks and never holds back other viewers. Open the stream first with OpenStream.
+func (sm *SessionManager) StartRecording(streamID string, dur time.Duration, dest string) (*Recording, error) {
+	if dur <= 0 {
+		return nil, fmt.Errorf("recording duration must be positive")
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return nil, fmt.Errorf("create recording dir: %w", err)
+	}
+	f, err := os.Create(dest + ".part")
+	if err != nil {
+		return nil, fmt.Errorf("create recording file: %w", err)
+	}
+
+	now := time.Now()
+	ctx, cancel := context.WithDeadline(context.Background(), now.Add(dur))
+	rec := &Recording{
+		ID:        fmt.Sprintf("rec-%s-%d", normalizeRecordingID(streamID), now.Unix()),
+		StreamID:  streamID,
+		FilePath:  dest,
+		StartedAt: now,
+		EndsAt:    now.Add(dur),
+		cancel:    cancel,
+	}
+
+	sm.streamLock.Lock()
+	buffer, exists := sm.streamBuffers[streamID]
+	if !exists || !buffer.active {
+		sm.streamLock.Unlock()
+		cancel()
+		f.Close()
+		os.Remove(dest + ".part")
+		return nil, fmt.Errorf("stream %s is not active", streamID)
+	}
+	if ss, ok := sm.streamSessions[streamID]; ok {
+		ss.AddViewer(rec.viewerName())
+		rec.Title = ss.StreamTitle
+	}
+	buffer.bufMu.Lock()
+	start := buffer.head
+	buffer.bufMu.Unlock()
+	sm.streamLock.Unlock()
+
+	sm.recordingLock.Lock()
+	sm.recordings[rec.ID] = rec
+	sm.recordingLock.Unlock()
+
+	sm.saveRecordingEntry(rec, "downloading")
+	go sm.record(ctx, buffer, rec, f, start)
+
+	utils.InfoLog("Recording %s started: stream %s for %v -> %s", rec.ID, streamID, dur, dest)
+	return rec, nil
+}
+
+// SetRecordingRequester records who asked for a recording, for the cache listing.
+func (sm *SessionManager) SetRecordingRequester(id, username, title string) {
+	sm.recordingLock.Lock()
+	rec, ok := sm.recordings[id]
+	if ok {
+		rec.RequestedBy = username
+		if title != "" {
+			rec.Title = title
+		}
+	}
+	sm.recordingLock.Unlock()
+	if ok {
+		sm.saveRecordingEntry(rec, "downloading")
+	}
+}
+
+// SetRecordingOrigin records the bot command that started a recording. It is
+// saved with the next vod_cache write, at the latest when the recording ends.
+func (sm *SessionManager) SetRecordingOrigin(id, command, messageID string) {
+	sm.recordingLock.Lock()
+	if rec, ok := sm.recordings[id]; ok {
+		rec.OriginCommand, rec.OriginMessageID = command, messageID
+	}
+	sm.recordingLock.Unlock()
+}
+
+// StopRecording ends a running recording early; the file is finalized as usual.
+func (sm *SessionManager) StopRecording(id string) bool {
+	sm.recordingLock.RLock()
+	rec, ok := sm.recordings[id]
+	sm.recordingLock.RUnlock()
+	if ok {
+		rec.cancel()
+	}
+	return ok
+}
+
+// ListRecordings returns the recordings currently in progress.
+func (sm *SessionManager) ListRecordings() []*Recording {
+	sm.recordingLock.RLock()
+	defer sm.recordingLock.RUnlock()
+	out := make([]*Recording, 0, len(sm.recordings))
+	for _, rec := range sm.recordings {
+		out = append(out, rec)
+	}
+	return out
+}
+
+// record copies chunks from the ring buffer into f until the deadline, a stop
+// request, or the upstream going away, then finalizes the file.
+func (sm *SessionManager) record(ctx context.Context, buffer *StreamBuffer, rec *Recording, f *os.File, next uint64) {
+	// Wake the reader when the recording is stopped or reaches its deadline
+	go func() {
+		<-ctx.Done()
+		buffer.bufMu.Lock()
+		buffer.cond.Broadcast()
+		buffer.bufMu.Unlock()
+	}()
+
+	w := bufio.NewWriterSize(f, 1<<20)
+	var werr error
+	skipped := uint64(0)
+	for {
+		buffer.bufMu.Lock()
+		for next == buffer.head && buffer.active && ctx.Err() == nil {
+			buffer.cond.Wait()
+		}
+		if !buffer.active || ctx.Err() != nil {
+			buffer.bufMu.Unlock()
+			break
+		}
+		if buffer.head > uint64(buffer.ringCap) && next < buffer.head-uint64(buffer.ringCap) {
+			skipped += buffer.head - uint64(buffer.ringCap) - next
+			next = buffer.head - uint64(buffer.ringCap)
+		}
+		chunk := buffer.ring[next%uint64(buffer.ringCap)]
+		next++
+		buffer.bufMu.Unlock()
+
+		if _, werr = w.Write(chunk); werr != nil {
+			utils.ErrorLog("Recording %s: write error: %v", rec.ID, werr)
+			break
+		}
+		atomic.AddInt64(&rec.bytes, int64(len(chunk)))
+	}
+	rec.cancel()
+
+	if skipped > 0 {
+		utils.WarnLog("Recording %s: disk too slow, skipped %d chunks", rec.ID, skipped)
+	}
+	if err := w.Flush(); err != nil && werr == nil {
+		werr = err
+	}
+	if err := f.Close(); err != nil && werr == nil {
+		werr = err
+	}
+
+	status := "ready"
+	switch {
+	case rec.BytesWritten() == 0:
+		status = "failed"
+		os.Remove(rec.FilePath + ".part")
+	case werr != nil:
+		status = "failed"
+	default:
+		// Partial files (upstream stopped early) are kept and finalized as well
+		if err := os.Rename(rec.FilePath+".part", rec.FilePath); err != nil {
+			utils.ErrorLog("Recording %s: finalize error: %v", rec.ID, err)
+			status = "failed"
+		}
+	}
+	sm.saveRecordingEntry(rec, status)
+
+	sm.recordingLock.Lock()
+	delete(sm.recordings, rec.ID)
+	sm.recordingLock.Unlock()
+
+	// Release the stream if the recorder was its last viewer
+	sm.streamLock.Lock()
+	if ss, ok := sm.streamSessions[rec.StreamID]; ok && sm.streamBuffers[rec.StreamID] == buffer {
+		if !ss.RemoveViewer(rec.viewerName()) && buffer.active {
+			sm.stopStream(rec.StreamID)
+		}
+	}
+	sm.streamLock.Unlock()
+
+	utils.InfoLog("Recording %s finished (%s, %d bytes)", rec.ID, status, rec.BytesWritten())
+}
+
+// saveRecordingEntry mirrors a recording into vod_cache so it shows up in /cache/list.
+func (sm *SessionManager) saveRecordingEntry(rec *Recording, status string) {
+	if sm.db == nil {
+		return
+	}
+	n := rec.BytesWritten()
+	sm.recordingLock.RLock()
+	title, requestedBy := rec.Title, rec.RequestedBy
+	originCmd, originMsg := rec.OriginCommand, rec.OriginMessageID
+	sm.recordingLock.RUnlock()
+	e := &types.VODCacheEntry{
+		Provider:        sm.db.Provider(),
+		StreamID:        rec.ID,
+		Type:            "recording",
+		Title:           title,
+		FilePath:        rec.FilePath,
+		RequestedBy:     requestedBy,
+		DownloadedBytes: n,
+		SizeBytes:       n,
+		Status:          status,
+		CreatedAt:       rec.StartedAt,
+		ExpiresAt:       rec.EndsAt.Add(recordingRetention),
+		LastAccess:      time.Now(),
+		OriginCommand:   originCmd,
+		OriginMessageID: originMsg,
+	}
+	if err := sm.db.UpsertVODCache(e); err != nil {
+		utils.ErrorLog("Recording %s: failed to persist entry: %v", rec.ID, err)
+	}
+}
+
+// normalizeRecordingID strips any container extension from a stream id.
+func normalizeRecordingID(streamID string) string {
+	return strings.TrimSuffix(streamID, filepath.Ext(streamID))
+}
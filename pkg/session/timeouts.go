@@ -0,0 +1,105 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package session
+
+import (
+	"time"
+
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// loadUserTimeouts restores the timeouts still active in the database.
+func (sm *SessionManager) loadUserTimeouts() {
+	if sm.db == nil {
+		return
+	}
+	active, err := sm.db.ListActiveUserTimeouts()
+	if err != nil {
+		utils.WarnLog("Failed to load user timeouts: %v", err)
+		return
+	}
+	sm.timeoutLock.Lock()
+	for username, until := range active {
+		sm.timeouts[username] = until
+	}
+	sm.timeoutLock.Unlock()
+	if len(active) > 0 {
+		utils.InfoLog("Restored %d active user timeouts", len(active))
+	}
+}
+
+// TimeoutUser blocks username for d and returns when the timeout ends. The
+// timeout is persisted so it survives a restart.
+func (sm *SessionManager) TimeoutUser(username string, d time.Duration) time.Time {
+	until := time.Now().Add(d)
+	sm.timeoutLock.Lock()
+	sm.timeouts[username] = until
+	sm.timeoutLock.Unlock()
+
+	if sm.db != nil {
+		if err := sm.db.SetUserTimeout(username, until); err != nil {
+			utils.WarnLog("Timeout for %s is kept in memory only: %v", username, err)
+		}
+	}
+	return until
+}
+
+// ClearUserTimeout lifts the timeout of username and reports whether one was active.
+func (sm *SessionManager) ClearUserTimeout(username string) bool {
+	sm.timeoutLock.Lock()
+	until, ok := sm.timeouts[username]
+	delete(sm.timeouts, username)
+	sm.timeoutLock.Unlock()
+	active := ok && time.Now().Before(until)
+
+	if sm.db != nil {
+		if _, err := sm.db.DeleteUserTimeout(username); err != nil {
+			utils.WarnLog("Failed to delete stored timeout for %s: %v", username, err)
+		}
+	}
+	return active
+}
+
+// IsUserTimedOut reports whether username is timed out and until when.
+func (sm *SessionManager) IsUserTimedOut(username string) (bool, time.Time) {
+	sm.timeoutLock.RLock()
+	until, ok := sm.timeouts[username]
+	sm.timeoutLock.RUnlock()
+	if !ok || !time.Now().Before(until) {
+		return false, time.Time{}
+	}
+	return true, until
+}
+
+// cleanupExpiredTimeouts forgets timeouts that have run out.
+func (sm *SessionManager) cleanupExpiredTimeouts() {
+	now := time.Now()
+	sm.timeoutLock.Lock()
+	for username, until := range sm.timeouts {
+		if !now.Before(until) {
+			delete(sm.timeouts, username)
+		}
+	}
+	sm.timeoutLock.Unlock()
+
+	if sm.db != nil {
+		if count, err := sm.db.CleanupExpiredUserTimeouts(); err == nil && count > 0 {
+			utils.DebugLog("Cleaned %d expired user timeouts", count)
+		}
+	}
+}
@@ -25,15 +25,25 @@ import (
 
 // UserSession represents an active user session
 type UserSession struct {
-	Username    string    // LDAP/local username
-	DiscordID   string    // Linked Discord ID (if available)
-	DiscordName string    // Discord username for display
-	StreamID    string    // Current stream ID
-	StreamType  string    // "live", "vod", "series"
-	StartTime   time.Time // Session start time
-	LastActive  time.Time // Last activity time
-	IPAddress   string    // User's IP address
-	UserAgent   string    // User's device/agent
+	Username    string      // LDAP/local username
+	DiscordID   string      // Linked Discord ID (if available)
+	DiscordName string      // Discord username for display
+	StreamID    string      // Current stream ID
+	StreamType  string      // "live", "vod", "series"
+	StartTime   time.Time   // Session start time
+	LastActive  time.Time   // Last activity time
+	IPAddress   string      // User's IP address
+	UserAgent   string      // User's device/agent
+	HLSVariant  *HLSVariant // Rendition last picked from an HLS master playlist, nil if none
+}
+
+// HLSVariant is one #EXT-X-STREAM-INF entry of an HLS master playlist
+type HLSVariant struct {
+	Bandwidth  int       `json:"bandwidth,omitempty"`  // Peak bits per second
+	Resolution string    `json:"resolution,omitempty"` // e.g. "1920x1080"
+	Codecs     string    `json:"codecs,omitempty"`
+	StreamID   string    `json:"stream_id,omitempty"` // Channel the master playlist belongs to
+	SelectedAt time.Time `json:"selected_at"`
 }
 
 // StreamSession represents a shared stream with multiple viewers
@@ -46,7 +56,9 @@ type StreamSession struct {
 	StartTime     time.Time            // When the stream started
 	LastRequested time.Time            // Last time any user requested this stream
 	Viewers       map[string]time.Time // Map of usernames to their last activity time
+	MaxViewers    int                  // Viewer cap of the stream, 0 for none
 	Active        bool                 // Whether the stream is currently active
+	historyIDs    map[string]int64     // username -> open stream_history row
 	lock          sync.RWMutex         // Lock for concurrent access
 }
 
@@ -84,6 +96,47 @@ func (s *StreamSession) GetViewers() map[string]time.Time {
 	return viewers
 }
 
+// SetHistoryID remembers the open stream_history row of a viewer
+func (s *StreamSession) SetHistoryID(username string, id int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.historyIDs == nil {
+		s.historyIDs = make(map[string]int64)
+	}
+	s.historyIDs[username] = id
+}
+
+// HasHistoryID reports whether a viewer already has an open history row
+func (s *StreamSession) HasHistoryID(username string) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	_, ok := s.historyIDs[username]
+	return ok
+}
+
+// TakeHistoryID removes and returns a viewer's open history row, so each row
+// is handed out for closing only once
+func (s *StreamSession) TakeHistoryID(username string) (int64, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	id, ok := s.historyIDs[username]
+	delete(s.historyIDs, username)
+	return id, ok
+}
+
+// TakeAllHistoryIDs removes and returns every open history row
+func (s *StreamSession) TakeAllHistoryIDs() map[string]int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ids := s.historyIDs
+	s.historyIDs = nil
+	return ids
+}
+
 // VODRequest represents a VOD search request and response
 type VODRequest struct {
 	Username  string
@@ -98,6 +151,7 @@ type VODRequest struct {
 type VODResult struct {
 	ID       string
 	Title    string
+	RawTitle string // provider title, before TITLE_STRIP_RULES
 	Category string
 	Duration string
 	Year     string
@@ -109,10 +163,23 @@ type VODResult struct {
 	// Type of result: "movie" or "series"
 	StreamType string
 	// Series metadata when StreamType is "series"
+	SeriesID      string // provider series id, for /series/:id/info
 	SeriesTitle   string
 	Season        int
 	Episode       int
 	EpisodeTitle  string
+	AirDate       string // episode air date when the provider exposes one
+	Plot          string // episode synopsis when the provider exposes one
+	// Parts lists every entry of a movie split into CD1/Part 1... entries, in
+	// playback order; StreamID is then the first part
+	Parts []VODPart `json:",omitempty"`
+}
+
+// VODPart is one entry of a multi-part VOD result
+type VODPart struct {
+	Part     int
+	StreamID string
+	Title    string
 }
 
 // TemporaryLink represents a generated temporary download link
@@ -125,16 +192,19 @@ type TemporaryLink struct {
 	Title     string
 }
 
-// APIResponse is a standardized API response structure
+// APIResponse is a standardized API response structure. Failed answers carry
+// a stable machine-readable Code next to the human-readable Error.
 type APIResponse struct {
 	Success bool        `json:"success"`
 	Message string      `json:"message,omitempty"`
 	Data    interface{} `json:"data,omitempty"`
 	Error   string      `json:"error,omitempty"`
+	Code    string      `json:"code,omitempty"`
 }
 
 // VODCacheEntry tracks cached VOD or series episode stored on disk
 type VODCacheEntry struct {
+	Provider    string    `json:"provider,omitempty"` // provider key, empty for the default one
 	StreamID    string    `json:"stream_id"`
 	Type        string    `json:"type"` // movie or series
 	Title       string    `json:"title,omitempty"`
@@ -146,9 +216,44 @@ type VODCacheEntry struct {
 	// Live progress
 	DownloadedBytes int64     `json:"downloaded_bytes,omitempty"`
 	TotalBytes      int64     `json:"total_bytes,omitempty"`
+	RateBytesPerSec int64     `json:"rate_bytes_per_sec,omitempty"` // rolling rate while downloading
 	SizeBytes   int64     `json:"size_bytes,omitempty"`
 	Status      string    `json:"status"` // downloading, ready, failed
+	FailureReason string  `json:"failure_reason,omitempty"` // why a failed entry failed
 	CreatedAt   time.Time `json:"created_at"`
 	ExpiresAt   time.Time `json:"expires_at"`
 	LastAccess  time.Time `json:"last_access,omitempty"`
+	// Bot command and message/interaction id that started the entry, if any
+	OriginCommand   string `json:"origin_command,omitempty"`
+	OriginMessageID string `json:"origin_message_id,omitempty"`
+}
+
+// StreamHistoryEntry is one row of stream_history
+type StreamHistoryEntry struct {
+	ID          int64      `json:"id"`
+	Username    string     `json:"username"`
+	DiscordID   string     `json:"discord_id,omitempty"`
+	StreamID    string     `json:"stream_id"`
+	StreamType  string     `json:"stream_type"`
+	StreamTitle string     `json:"stream_title,omitempty"`
+	StartTime   time.Time  `json:"start_time"`
+	EndTime     *time.Time `json:"end_time,omitempty"`
+	Duration    int64      `json:"duration_seconds,omitempty"` // set once end_time is known
+	IPAddress   string     `json:"ip_address,omitempty"`
+	UserAgent   string     `json:"user_agent,omitempty"`
+}
+
+// StreamQualitySummary is one row of stream_quality: delivery counters of a
+// stream, written when it stops
+type StreamQualitySummary struct {
+	StreamID      string    `json:"stream_id"`
+	StreamType    string    `json:"stream_type"`
+	StreamTitle   string    `json:"stream_title,omitempty"`
+	StartTime     time.Time `json:"start_time"`
+	EndTime       time.Time `json:"end_time"`
+	BlockedSends  int64     `json:"blocked_sends"`
+	BlockedMillis int64     `json:"blocked_ms"`
+	DropEvents    int64     `json:"drop_events"`
+	DroppedChunks int64     `json:"dropped_chunks"`
+	Stalls        int64     `json:"stalls"`
 }
@@ -18,16 +18,80 @@
 
 package utils
 
-import "os"
+import (
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
 
-// GetIPTVUserAgent returns the user agent to use for IPTV upstream requests
-// Uses the USER_AGENT environment variable if set, otherwise defaults to "IPTVSmartersPro"
+const defaultIPTVUserAgent = "IPTVSmartersPro"
+
+var (
+	hostUserAgentsOnce sync.Once
+	hostUserAgents     map[string]string
+	logUserAgentOnce   sync.Once
+)
+
+// GetIPTVUserAgent returns the user agent to use for IPTV upstream requests.
+// XTREAM_USER_AGENT wins over the older USER_AGENT; the default is "IPTVSmartersPro".
 func GetIPTVUserAgent() string {
-	userAgent := os.Getenv("USER_AGENT")
-	if userAgent == "" {
-		return "IPTVSmartersPro"
+	if ua := strings.TrimSpace(os.Getenv("XTREAM_USER_AGENT")); ua != "" {
+		return ua
+	}
+	if ua := strings.TrimSpace(os.Getenv("USER_AGENT")); ua != "" {
+		return ua
+	}
+	return defaultIPTVUserAgent
+}
+
+// UserAgentFor returns the user agent for requests to target, a URL or a host.
+// XTREAM_USER_AGENTS overrides it per host as "host=UA|host=UA", for providers
+// or redirect targets that only accept a given player.
+func UserAgentFor(target string) string {
+	hostUserAgentsOnce.Do(loadHostUserAgents)
+	if len(hostUserAgents) > 0 {
+		host := target
+		if u, err := url.Parse(target); err == nil && u.Host != "" {
+			host = u.Host
+		}
+		if h, _, ok := strings.Cut(host, ":"); ok {
+			host = h
+		}
+		if ua, ok := hostUserAgents[strings.ToLower(host)]; ok {
+			return ua
+		}
 	}
-	return userAgent
+	return GetIPTVUserAgent()
+}
+
+// loadHostUserAgents parses XTREAM_USER_AGENTS. "|" separates entries because
+// user agents routinely contain commas and semicolons.
+func loadHostUserAgents() {
+	hostUserAgents = make(map[string]string)
+	for _, entry := range strings.Split(os.Getenv("XTREAM_USER_AGENTS"), "|") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		host, ua, ok := strings.Cut(entry, "=")
+		host, ua = strings.ToLower(strings.TrimSpace(host)), strings.TrimSpace(ua)
+		if !ok || host == "" || ua == "" {
+			WarnLog("Ignoring invalid XTREAM_USER_AGENTS entry %q (want host=user-agent)", entry)
+			continue
+		}
+		hostUserAgents[host] = ua
+	}
+}
+
+// LogUserAgents logs the effective upstream user agents, once per process.
+func LogUserAgents() {
+	logUserAgentOnce.Do(func() {
+		InfoLog("Upstream User-Agent: %q", GetIPTVUserAgent())
+		hostUserAgentsOnce.Do(loadHostUserAgents)
+		for host, ua := range hostUserAgents {
+			InfoLog("Upstream User-Agent for %s: %q", host, ua)
+		}
+	})
 }
 
 // GetLanguageHeader returns the preferred Accept-Language header, defaulting to en_US
@@ -25,18 +25,19 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // LogConfig defines logging configuration
 var Config = struct {
-	DebugLoggingEnabled bool
+	debugLogging        atomic.Bool // see DebugLogging
 	LogLevel            LogLevel
 	LogToFile           bool
 	LogFilePath         string
 	logFile             *os.File
 }{
-	DebugLoggingEnabled: false,
 	LogLevel:            LevelInfo,
 	LogToFile:           false,
 }
@@ -53,7 +54,7 @@ const (
 
 func init() {
 	// Initialize logging configuration from environment
-	Config.DebugLoggingEnabled = os.Getenv("DEBUG_LOGGING") == "true"
+	SetDebugLogging(os.Getenv("DEBUG_LOGGING") == "true")
 	
 	// Set log level from environment
 	logLevel := strings.ToLower(os.Getenv("LOG_LEVEL"))
@@ -67,7 +68,7 @@ func init() {
 	case "error":
 		Config.LogLevel = LevelError
 	default:
-		if Config.DebugLoggingEnabled {
+		if DebugLogging() {
 			Config.LogLevel = LevelDebug
 		} else {
 			Config.LogLevel = LevelInfo
@@ -98,7 +99,18 @@ func init() {
 	
 	// Log initial configuration
 	InfoLog("Logging initialized - Debug: %v, Level: %s", 
-		Config.DebugLoggingEnabled, levelToString(Config.LogLevel))
+		DebugLogging(), levelToString(Config.LogLevel))
+}
+
+// DebugLogging reports whether debug logs are printed. It may change at run
+// time, on a SIGHUP reload, hence the atomic.
+func DebugLogging() bool {
+	return Config.debugLogging.Load()
+}
+
+// SetDebugLogging turns debug logs on or off while other goroutines log.
+func SetDebugLogging(on bool) {
+	Config.debugLogging.Store(on)
 }
 
 // Close closes any open log files
@@ -124,7 +136,7 @@ func WarnLog(format string, v ...interface{}) {
 
 // DebugLog logs a debug message if debug logging is enabled
 func DebugLog(format string, v ...interface{}) {
-	if Config.DebugLoggingEnabled {
+	if DebugLogging() {
 		logWithCaller(LevelDebug, format, v...)
 	}
 }
@@ -157,6 +169,47 @@ func logWithCaller(level LogLevel, format string, v ...interface{}) {
 	
 	// Log to standard output
 	log.Println(logMessage)
+
+	if level >= LevelWarn {
+		rememberLog(LogEntry{Time: time.Now(), Level: levelStr, Caller: caller, Message: message})
+	}
+}
+
+// LogEntry is a logged warning or error, kept in memory for status pages
+type LogEntry struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Caller  string    `json:"caller"`
+	Message string    `json:"message"`
+}
+
+// recentLogSize is how many warnings and errors RecentLogs returns at most
+const recentLogSize = 50
+
+var recentLogs struct {
+	sync.Mutex
+	entries []LogEntry
+}
+
+func rememberLog(e LogEntry) {
+	recentLogs.Lock()
+	defer recentLogs.Unlock()
+	if len(recentLogs.entries) >= recentLogSize {
+		copy(recentLogs.entries, recentLogs.entries[1:])
+		recentLogs.entries = recentLogs.entries[:recentLogSize-1]
+	}
+	recentLogs.entries = append(recentLogs.entries, e)
+}
+
+// RecentLogs returns the latest warnings and errors, newest first
+func RecentLogs() []LogEntry {
+	recentLogs.Lock()
+	defer recentLogs.Unlock()
+	out := make([]LogEntry, len(recentLogs.entries))
+	for i, e := range recentLogs.entries {
+		out[len(out)-1-i] = e
+	}
+	return out
 }
 
 // levelToString converts a LogLevel to its string representation
@@ -191,3 +244,12 @@ func CreateSampleStreamData() map[string]interface{} {
 		"total_bytes":    "2.3 GB",
 	}
 }
+
+// AuditLog records an administrative action. It is emitted regardless of LOG_LEVEL
+// so operator interventions always leave a trace.
+func AuditLog(actor, action, format string, v ...interface{}) {
+	if strings.TrimSpace(actor) == "" {
+		actor = "unknown"
+	}
+	logWithCaller(LevelInfo, "AUDIT actor=%s action=%s %s", actor, action, fmt.Sprintf(format, v...))
+}
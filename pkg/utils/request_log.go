@@ -0,0 +1,84 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"context"
+	"strings"
+)
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the request id id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request id stored in ctx, "" if there is none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestLogger logs like InfoLog and friends, with every line tagged with
+// the id of the request it belongs to so one client's journey can be followed.
+type RequestLogger struct {
+	prefix string
+}
+
+// ForRequest returns a logger for the request ctx belongs to. Without a
+// request id it logs exactly like the package functions.
+func ForRequest(ctx context.Context) RequestLogger {
+	if id := RequestID(ctx); id != "" {
+		// The prefix becomes part of a format string
+		return RequestLogger{prefix: "[req=" + strings.ReplaceAll(id, "%", "%%") + "] "}
+	}
+	return RequestLogger{}
+}
+
+// The methods call logWithCaller directly so the reported caller stays the
+// handler, not this file.
+
+// InfoLog logs an info message
+func (l RequestLogger) InfoLog(format string, v ...interface{}) {
+	if Config.LogLevel <= LevelInfo {
+		logWithCaller(LevelInfo, l.prefix+format, v...)
+	}
+}
+
+// WarnLog logs a warning message
+func (l RequestLogger) WarnLog(format string, v ...interface{}) {
+	if Config.LogLevel <= LevelWarn {
+		logWithCaller(LevelWarn, l.prefix+format, v...)
+	}
+}
+
+// DebugLog logs a debug message if debug logging is enabled
+func (l RequestLogger) DebugLog(format string, v ...interface{}) {
+	if DebugLogging() {
+		logWithCaller(LevelDebug, l.prefix+format, v...)
+	}
+}
+
+// ErrorLog logs an error message
+func (l RequestLogger) ErrorLog(format string, v ...interface{}) {
+	if Config.LogLevel <= LevelError {
+		logWithCaller(LevelError, l.prefix+format, v...)
+	}
+}
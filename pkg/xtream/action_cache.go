@@ -0,0 +1,108 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package xtream
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// defaultAPICacheSeconds is the action cache TTL when API_CACHE_SECONDS is unset.
+const defaultAPICacheSeconds = 60
+
+// actionCacheEntry is one parsed player_api answer.
+type actionCacheEntry struct {
+	body    interface{}
+	expires time.Time
+}
+
+// actionCache holds parsed catalog answers keyed by request URL (base URL,
+// credentials, action and params), shared by every Client. Cached bodies are
+// handed to several callers and must be treated as read-only.
+var (
+	actionCacheMu sync.RWMutex
+	actionCache   = map[string]actionCacheEntry{}
+)
+
+// APICacheTTL returns how long catalog answers are reused, from
+// API_CACHE_SECONDS. 0 disables the cache.
+func APICacheTTL() time.Duration {
+	if v := strings.TrimSpace(os.Getenv("API_CACHE_SECONDS")); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			return time.Duration(n) * time.Second
+		}
+		utils.WarnLog("Invalid API_CACHE_SECONDS: %s", v)
+	}
+	return defaultAPICacheSeconds * time.Second
+}
+
+// cacheableAction reports whether answers to action are catalog data that can
+// be reused for a while. Login, account and EPG answers are always fetched.
+func cacheableAction(action string) bool {
+	switch action {
+	case getLiveCategories, getLiveStreams, getVodCategories, getVodStreams,
+		getVodInfo, getSeriesCategories, getSeries, getSerieInfo:
+		return true
+	}
+	return false
+}
+
+// IsCatalogAction reports whether action answers with catalog data
+// (categories, stream lists and VOD/series info) rather than per-call data.
+func IsCatalogAction(action string) bool { return cacheableAction(action) }
+
+func cachedAction(key string) (interface{}, bool) {
+	actionCacheMu.RLock()
+	e, ok := actionCache[key]
+	actionCacheMu.RUnlock()
+	if !ok || time.Now().After(e.expires) {
+		return nil, false
+	}
+	return e.body, true
+}
+
+func storeAction(key string, body interface{}, ttl time.Duration) {
+	now := time.Now()
+	actionCacheMu.Lock()
+	defer actionCacheMu.Unlock()
+	// Series info is cached per series: drop expired entries so the map stays small
+	if len(actionCache) >= 256 {
+		for k, e := range actionCache {
+			if now.After(e.expires) {
+				delete(actionCache, k)
+			}
+		}
+	}
+	actionCache[key] = actionCacheEntry{body: body, expires: now.Add(ttl)}
+}
+
+// FlushActionCache drops every cached player_api answer, e.g. after the
+// provider updated its catalog, and returns how many were dropped.
+func FlushActionCache() int {
+	actionCacheMu.Lock()
+	defer actionCacheMu.Unlock()
+	n := len(actionCache)
+	actionCache = map[string]actionCacheEntry{}
+	return n
+}
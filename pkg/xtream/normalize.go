@@ -0,0 +1,348 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package xtream
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// infoShape lists the fields of one object of a get_vod_info/get_series_info
+// answer that players read with a fixed type. Providers send any of them as a
+// number or as a numeric string, and players built against the reference
+// panel fail to parse the other form.
+type infoShape struct {
+	ints    []string // JSON numbers
+	strings []string // numeric strings, as in the login answer
+	lists   []string // arrays, even when the provider sends "" or a single value
+}
+
+var (
+	vodInfoShape = infoShape{
+		ints:    []string{"duration_secs", "bitrate"},
+		strings: []string{"tmdb_id", "rating", "episode_run_time"},
+		lists:   []string{"backdrop_path"},
+	}
+	vodMovieDataShape = infoShape{
+		ints:    []string{"stream_id"},
+		strings: []string{"category_id", "added", "custom_sid"},
+	}
+	seriesInfoShape = infoShape{
+		strings: []string{"category_id", "rating", "episode_run_time", "last_modified", "tmdb"},
+		lists:   []string{"backdrop_path", "category_ids"},
+	}
+	seasonShape = infoShape{
+		ints: []string{"id", "season_number", "episode_count"},
+	}
+	episodeShape = infoShape{
+		ints:    []string{"episode_num", "season"},
+		strings: []string{"id", "added", "custom_sid"},
+	}
+	episodeInfoShape = infoShape{
+		ints:    []string{"duration_secs", "bitrate"},
+		strings: []string{"tmdb_id"},
+	}
+	// Listings of get_short_epg and get_simple_data_table; start and end are
+	// handled by normalizeListing
+	epgListingShape = infoShape{
+		ints:    []string{"now_playing", "has_archive"},
+		strings: []string{"id", "epg_id", "start_timestamp", "stop_timestamp"},
+	}
+)
+
+// epgTimeLayout is how the reference panel writes listing start and end.
+const epgTimeLayout = "2006-01-02 15:04:05"
+
+// DecodeEPGText reports whether listing titles and descriptions are decoded
+// from base64 before they reach players (XTREAM_EPG_DECODE, default true).
+func DecodeEPGText() bool {
+	v := strings.TrimSpace(os.Getenv("XTREAM_EPG_DECODE"))
+	if v == "" {
+		return true
+	}
+	on, err := strconv.ParseBool(v)
+	if err != nil {
+		utils.WarnLog("Invalid XTREAM_EPG_DECODE: %s", v)
+		return true
+	}
+	return on
+}
+
+// NormalizeInfo rewrites the numeric fields of a get_vod_info or
+// get_series_info answer into the types players expect, and the listings of
+// get_short_epg and get_simple_data_table (see normalizeListing). Other
+// actions are returned unchanged. resp may be shared through the action
+// cache, so changed objects are copied rather than modified.
+func NormalizeInfo(action string, resp interface{}) interface{} {
+	m, ok := resp.(map[string]interface{})
+	if !ok {
+		return resp
+	}
+	switch action {
+	case getVodInfo:
+		out := copyMap(m)
+		out["info"] = normalizeObject(m["info"], vodInfoShape)
+		out["movie_data"] = normalizeObject(m["movie_data"], vodMovieDataShape)
+		return out
+	case getSerieInfo:
+		out := copyMap(m)
+		out["info"] = normalizeObject(m["info"], seriesInfoShape)
+		if seasons, ok := m["seasons"].([]interface{}); ok {
+			list := make([]interface{}, len(seasons))
+			for i, s := range seasons {
+				list[i] = normalizeObject(s, seasonShape)
+			}
+			out["seasons"] = list
+		}
+		if _, ok := m["episodes"]; ok {
+			out["episodes"] = normalizeEpisodes(m["episodes"])
+		}
+		return out
+	case getShortEPG, getSimpleDataTable:
+		listings, ok := m["epg_listings"].([]interface{})
+		if !ok {
+			return resp
+		}
+		decode := DecodeEPGText()
+		out := copyMap(m)
+		list := make([]interface{}, len(listings))
+		for i, l := range listings {
+			list[i] = normalizeListing(l, decode)
+		}
+		out["epg_listings"] = list
+		return out
+	}
+	return resp
+}
+
+// normalizeListing converts the ids and timestamps of one EPG listing to
+// strings, the flags to numbers, and start/end to "YYYY-MM-DD HH:MM:SS" when
+// a provider sends them as Unix times. With decode, title and description
+// are turned from base64 into plain text.
+func normalizeListing(v interface{}, decode bool) interface{} {
+	m, ok := normalizeObject(v, epgListingShape).(map[string]interface{})
+	if !ok {
+		return v
+	}
+	for k, tsKey := range map[string]string{"start": "start_timestamp", "end": "stop_timestamp"} {
+		switch x := m[k].(type) {
+		case float64, json.Number:
+			if ts := asInt(x); ts > 0 {
+				m[k] = time.Unix(ts, 0).Format(epgTimeLayout)
+				if _, ok := m[tsKey]; !ok {
+					m[tsKey] = strconv.FormatInt(ts, 10)
+				}
+			}
+		}
+	}
+	if decode {
+		for _, k := range []string{"title", "description"} {
+			if s, ok := m[k].(string); ok {
+				m[k] = decodeBase64Text(s)
+			}
+		}
+	}
+	return m
+}
+
+// decodeBase64Text returns the UTF-8 text s encodes, or s itself when it is
+// not base64 of valid UTF-8 (a provider already sending plain text).
+func decodeBase64Text(s string) string {
+	t := strings.TrimSpace(s)
+	if t == "" {
+		return s
+	}
+	b, err := base64.StdEncoding.DecodeString(t)
+	if err != nil {
+		if b, err = base64.RawStdEncoding.DecodeString(t); err != nil {
+			return s
+		}
+	}
+	if !utf8.Valid(b) {
+		return s
+	}
+	for _, r := range string(b) {
+		if r < 0x20 && r != '\n' && r != '\r' && r != '\t' {
+			return s
+		}
+	}
+	return string(b)
+}
+
+// normalizeEpisodes returns the episodes keyed by season number. A few
+// providers send a flat array; it is grouped by the season of each episode.
+func normalizeEpisodes(v interface{}) interface{} {
+	out := map[string]interface{}{}
+	add := func(key string, e interface{}) {
+		em, ok := normalizeObject(e, episodeShape).(map[string]interface{})
+		if !ok {
+			return
+		}
+		if info, ok := em["info"]; ok {
+			em["info"] = normalizeObject(info, episodeInfoShape)
+		}
+		if key == "" {
+			key = strconv.FormatInt(asInt(em["season"]), 10)
+		}
+		list, _ := out[key].([]interface{})
+		out[key] = append(list, em)
+	}
+	switch eps := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(eps))
+		for k := range eps {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			list, ok := eps[k].([]interface{})
+			if !ok {
+				continue
+			}
+			out[k] = []interface{}{}
+			for _, e := range list {
+				add(k, e)
+			}
+		}
+	case []interface{}:
+		for _, e := range eps {
+			// Some panels nest one array per season
+			if inner, ok := e.([]interface{}); ok {
+				for _, ie := range inner {
+					add("", ie)
+				}
+				continue
+			}
+			add("", e)
+		}
+	default:
+		return v
+	}
+	return out
+}
+
+// normalizeObject returns a copy of v with the fields of shape converted. v
+// is returned as is when it is not an object.
+func normalizeObject(v interface{}, shape infoShape) interface{} {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return v
+	}
+	out := copyMap(m)
+	for _, k := range shape.ints {
+		if x, ok := m[k]; ok && x != nil {
+			out[k] = asInt(x)
+		}
+	}
+	for _, k := range shape.strings {
+		if x, ok := m[k]; ok && x != nil {
+			out[k] = asNumericString(x)
+		}
+	}
+	for _, k := range shape.lists {
+		if x, ok := m[k]; ok {
+			out[k] = asList(x)
+		}
+	}
+	return out
+}
+
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+// asInt reads a number sent as a JSON number or a string ("5400", "5400.0",
+// " 12 "); anything else is 0.
+func asInt(v interface{}) int64 {
+	var f float64
+	switch x := v.(type) {
+	case json.Number:
+		if n, err := x.Int64(); err == nil {
+			return n
+		}
+		f, _ = x.Float64()
+	case float64:
+		f = x
+	case int:
+		return int64(x)
+	case int64:
+		return x
+	case string:
+		s := strings.TrimSpace(x)
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n
+		}
+		f, _ = strconv.ParseFloat(s, 64)
+	case bool:
+		if x {
+			return 1
+		}
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0
+	}
+	return int64(f)
+}
+
+// asNumericString formats a number as its decimal string and leaves strings as they are.
+func asNumericString(v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case json.Number:
+		return x.String()
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case bool:
+		if x {
+			return "1"
+		}
+		return "0"
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// asList wraps a single value in an array; null and "" become an empty array.
+func asList(v interface{}) []interface{} {
+	switch x := v.(type) {
+	case []interface{}:
+		return x
+	case nil:
+		return []interface{}{}
+	case string:
+		if strings.TrimSpace(x) == "" {
+			return []interface{}{}
+		}
+	}
+	return []interface{}{v}
+}
@@ -0,0 +1,165 @@
+package xtream
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// TestNormalizeInfo feeds info answers mixing ints and numeric strings
+// through Action and checks players get one fixed type per field.
+func TestNormalizeInfo(t *testing.T) {
+	t.Setenv("API_CACHE_SECONDS", "0")
+	t.Setenv("XTREAM_SANITIZE_LEVEL", "")
+
+	tests := []struct {
+		name, action, body, want string
+	}{
+		{
+			name:   "vod info",
+			action: getVodInfo,
+			body: `{"info":{"name":"Heat","duration_secs":"10200","bitrate":4500.0,"tmdb_id":949,"rating":7.9,"episode_run_time":0,"backdrop_path":"https://img/heat.jpg"},` +
+				`"movie_data":{"stream_id":"42","name":"Heat","category_id":5,"added":1700000000,"custom_sid":null,"container_extension":"mkv"}}`,
+			want: `{"info":{"backdrop_path":["https://img/heat.jpg"],"bitrate":4500,"duration_secs":10200,"episode_run_time":"0","name":"Heat","rating":"7.9","tmdb_id":"949"},` +
+				`"movie_data":{"added":"1700000000","category_id":"5","container_extension":"mkv","custom_sid":null,"name":"Heat","stream_id":42}}`,
+		},
+		{
+			name:   "series info with episodes by season",
+			action: getSerieInfo,
+			body: `{"info":{"name":"Dark","category_id":7,"rating":"8.7","backdrop_path":"","category_ids":7,"tmdb":70523},` +
+				`"seasons":[{"id":"1","season_number":"1","episode_count":"10","name":"Season 1"}],` +
+				`"episodes":{"1":[{"id":101,"episode_num":"1","season":"1","added":"1700000000","info":{"duration_secs":"3060","bitrate":"2100","tmdb_id":1234}}]}}`,
+			want: `{"episodes":{"1":[{"added":"1700000000","episode_num":1,"id":"101","info":{"bitrate":2100,"duration_secs":3060,"tmdb_id":"1234"},"season":1}]},` +
+				`"info":{"backdrop_path":[],"category_id":"7","category_ids":[7],"name":"Dark","rating":"8.7","tmdb":"70523"},` +
+				`"seasons":[{"episode_count":10,"id":1,"name":"Season 1","season_number":1}]}`,
+		},
+		{
+			name:   "flat episode list grouped by season",
+			action: getSerieInfo,
+			body:   `{"info":{},"episodes":[{"id":"201","episode_num":1,"season":2},[{"id":"301","episode_num":"1","season":"3"}]]}`,
+			want: `{"episodes":{"2":[{"episode_num":1,"id":"201","season":2}],"3":[{"episode_num":1,"id":"301","season":3}]},` +
+				`"info":{}}`,
+		},
+		{
+			name:   "other actions untouched",
+			action: getVodStreams,
+			body:   `[{"stream_id":"42","rating":7.9}]`,
+			want:   `[{"rating":7.9,"stream_id":"42"}]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tt.body)) // nolint: errcheck
+			}))
+			defer upstream.Close()
+
+			c, err := New("user", "pass", upstream.URL, "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, _, _, err := c.Action(nil, tt.action, url.Values{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			before, _ := json.Marshal(resp)
+			got, err := json.Marshal(NormalizeInfo(tt.action, resp))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("NormalizeInfo =\n%s\nwant\n%s", got, tt.want)
+			}
+			// The answer may be shared through the action cache
+			if after, _ := json.Marshal(resp); string(after) != string(before) {
+				t.Errorf("provider answer modified:\n%s\nwas\n%s", after, before)
+			}
+		})
+	}
+}
+
+// TestNormalizeShortEPG decodes a get_short_epg answer shaped like the
+// reference panel's, plus the variants some providers send.
+func TestNormalizeShortEPG(t *testing.T) {
+	t.Setenv("API_CACHE_SECONDS", "0")
+	t.Setenv("XTREAM_SANITIZE_LEVEL", "")
+	b64 := base64.StdEncoding.EncodeToString
+	body := `{"epg_listings":[` +
+		`{"id":"12345","epg_id":"1","title":"` + b64([]byte("Journal de 20h")) + `","lang":"fr","start":"2025-01-01 20:00:00","end":"2025-01-01 20:45:00",` +
+		`"description":"` + b64([]byte("Les informations du soir.\nMétéo.")) + `","channel_id":"tf1.fr","start_timestamp":"1735761600","stop_timestamp":"1735764300","now_playing":"1","has_archive":0},` +
+		`{"id":12346,"epg_id":1,"title":"Plain title","description":"","start":1735764300,"end":1735767000,"now_playing":0,"has_archive":"0"}` +
+		`]}`
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body)) // nolint: errcheck
+	}))
+	defer upstream.Close()
+	c, err := New("user", "pass", upstream.URL, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, _, _, err := c.Action(nil, getShortEPG, url.Values{"stream_id": {"1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listing := func(decode string, i int) map[string]interface{} {
+		t.Helper()
+		t.Setenv("XTREAM_EPG_DECODE", decode)
+		out, _ := NormalizeInfo(getShortEPG, resp).(map[string]interface{})
+		listings, _ := out["epg_listings"].([]interface{})
+		if len(listings) != 2 {
+			t.Fatalf("epg_listings = %v", out["epg_listings"])
+		}
+		return listings[i].(map[string]interface{})
+	}
+
+	first := listing("", 0)
+	want := map[string]interface{}{
+		"id": "12345", "epg_id": "1", "title": "Journal de 20h", "description": "Les informations du soir.\nMétéo.",
+		"start": "2025-01-01 20:00:00", "end": "2025-01-01 20:45:00",
+		"start_timestamp": "1735761600", "stop_timestamp": "1735764300", "now_playing": int64(1), "has_archive": int64(0),
+	}
+	for k, v := range want {
+		if first[k] != v {
+			t.Errorf("listing 0 %s = %#v, want %#v", k, first[k], v)
+		}
+	}
+
+	// Unix start/end are written out and fill in the missing timestamps
+	second := listing("", 1)
+	want = map[string]interface{}{
+		"id": "12346", "epg_id": "1", "title": "Plain title", "description": "",
+		"start": time.Unix(1735764300, 0).Format(epgTimeLayout), "end": time.Unix(1735767000, 0).Format(epgTimeLayout),
+		"start_timestamp": "1735764300", "stop_timestamp": "1735767000", "now_playing": int64(0), "has_archive": int64(0),
+	}
+	for k, v := range want {
+		if second[k] != v {
+			t.Errorf("listing 1 %s = %#v, want %#v", k, second[k], v)
+		}
+	}
+
+	if got := listing("false", 0)["title"]; got != b64([]byte("Journal de 20h")) {
+		t.Errorf("title decoded with XTREAM_EPG_DECODE=false: %v", got)
+	}
+}
+
+func TestDecodeBase64Text(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"SGVsbG8=", "Hello"},
+		{"SGVsbG8", "Hello"}, // unpadded
+		{"w4l0w6k=", "Été"},
+		{"News", "News"}, // valid base64, but not text
+		{"Le journal", "Le journal"},
+		{"", ""},
+		{"/w==", "/w=="}, // not UTF-8
+	}
+	for _, tt := range tests {
+		if got := decodeBase64Text(tt.in); got != tt.want {
+			t.Errorf("decodeBase64Text(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
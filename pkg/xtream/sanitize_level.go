@@ -0,0 +1,126 @@
+/*
+ * stream-share is a project to efficiently share the use of an IPTV service.
+ * Copyright (C) 2025  Lucas Duport
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package xtream
+
+import (
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lucasduport/stream-share/pkg/utils"
+)
+
+// SanitizeLevel is how far parseActionBody goes to recover a malformed
+// answer. Each level also runs the ones below it, cheapest first.
+type SanitizeLevel int
+
+const (
+	// SanitizeStrict only accepts valid JSON.
+	SanitizeStrict SanitizeLevel = iota
+	// SanitizeLight repairs smart quotes, BOMs, trailing commas and truncation.
+	SanitizeLight
+	// SanitizeAggressive rewrites the body keeping only basic JSON characters.
+	SanitizeAggressive
+	// SanitizeExtract picks the well-formed category objects out of a
+	// category list that can't be repaired as a whole.
+	SanitizeExtract
+)
+
+var sanitizeLevelNames = []string{"strict", "light", "aggressive", "extract"}
+
+func (l SanitizeLevel) String() string {
+	if l >= 0 && int(l) < len(sanitizeLevelNames) {
+		return sanitizeLevelNames[l]
+	}
+	return strconv.Itoa(int(l))
+}
+
+// MaxSanitizeLevel reads XTREAM_SANITIZE_LEVEL, by name or number (default
+// light). Operators of clean providers can set strict to skip recovery.
+func MaxSanitizeLevel() SanitizeLevel {
+	v := strings.ToLower(strings.TrimSpace(os.Getenv("XTREAM_SANITIZE_LEVEL")))
+	if v == "" {
+		return SanitizeLight
+	}
+	for i, name := range sanitizeLevelNames {
+		if v == name || v == strconv.Itoa(i) {
+			return SanitizeLevel(i)
+		}
+	}
+	utils.WarnLog("Invalid XTREAM_SANITIZE_LEVEL: %s", v)
+	return SanitizeLight
+}
+
+// recoverJSON runs the recovery tiers up to max on a body strict decoding
+// rejected, and returns the first structured result with the tier it came from.
+func recoverJSON(action string, b []byte, max SanitizeLevel) (interface{}, SanitizeLevel, bool) {
+	for level := SanitizeLight; level <= max; level++ {
+		var v interface{}
+		var err error
+		switch level {
+		case SanitizeLight:
+			v, err = decodeJSON(sanitizeUnicodeJSON(b))
+		case SanitizeAggressive:
+			v, err = decodeJSON(sanitizeAggressively(sanitizeUnicodeJSON(b)))
+		case SanitizeExtract:
+			if !strings.HasSuffix(action, "_categories") {
+				continue
+			}
+			if cats := extractValidCategoryData(b); len(cats) > 0 {
+				v = cats
+			}
+		}
+		if err == nil && structured(v) {
+			return v, level, true
+		}
+	}
+	return nil, SanitizeStrict, false
+}
+
+// structured reports whether v is an object or a non-empty array, the only
+// results worth keeping from a repaired body.
+func structured(v interface{}) bool {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		return true
+	case []interface{}:
+		return len(t) > 0
+	}
+	return false
+}
+
+// flatObject matches JSON objects without nested objects or arrays.
+var flatObject = regexp.MustCompile(`\{[^{}\[\]]*\}`)
+
+// extractValidCategoryData returns the flat objects of b that decode, once
+// lightly sanitized, into a category with a category_id.
+func extractValidCategoryData(b []byte) []interface{} {
+	var out []interface{}
+	for _, m := range flatObject.FindAll(b, -1) {
+		v, err := decodeJSON(sanitizeUnicodeJSON(m))
+		if err != nil {
+			continue
+		}
+		if cat, ok := v.(map[string]interface{}); ok && cat["category_id"] != nil {
+			out = append(out, cat)
+		}
+	}
+	return out
+}
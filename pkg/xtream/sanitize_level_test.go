@@ -0,0 +1,107 @@
+package xtream
+
+import "testing"
+
+func TestRecoverJSONLevels(t *testing.T) {
+	const rejected = SanitizeLevel(-1)
+	tests := []struct {
+		name   string
+		action string
+		body   string
+		want   [4]SanitizeLevel // tier that recovers body, per max level strict..extract
+		items  int
+	}{
+		{
+			name:   "trailing comma",
+			action: getLiveCategories,
+			body:   `[{"category_id":"1","category_name":"News",}]`,
+			want:   [4]SanitizeLevel{rejected, SanitizeLight, SanitizeLight, SanitizeLight},
+			items:  1,
+		},
+		{
+			name:   "smart quotes",
+			action: getLiveStreams,
+			body:   `[{“stream_id”:“1”,“name”:“One”}]`,
+			want:   [4]SanitizeLevel{rejected, SanitizeLight, SanitizeLight, SanitizeLight},
+			items:  1,
+		},
+		{
+			name:   "stray character between tokens",
+			action: getLiveCategories,
+			body:   `[{"category_id":"1","category_name":"News"}#]`,
+			want:   [4]SanitizeLevel{rejected, rejected, SanitizeAggressive, SanitizeAggressive},
+			items:  1,
+		},
+		{
+			name:   "missing separator between categories",
+			action: getLiveCategories,
+			body:   `[{"category_id":"1","category_name":"News"} ~~ {"category_id":"2","category_name":"Sport"}]`,
+			want:   [4]SanitizeLevel{rejected, rejected, rejected, SanitizeExtract},
+			items:  2,
+		},
+		{
+			name:   "broken category dropped",
+			action: getVodCategories,
+			body:   `[{"category_id":"1","category_name":"News"},{"category_id":"2" "category_name":"Sport"}]`,
+			want:   [4]SanitizeLevel{rejected, rejected, rejected, SanitizeExtract},
+			items:  1,
+		},
+		{
+			name:   "extraction is for category lists only",
+			action: getLiveStreams,
+			body:   `[{"stream_id":"1","name":"One"} ~~ {"stream_id":"2","name":"Two"}]`,
+			want:   [4]SanitizeLevel{rejected, rejected, rejected, rejected},
+		},
+		{
+			name:   "not json",
+			action: getLiveCategories,
+			body:   `garbage`,
+			want:   [4]SanitizeLevel{rejected, rejected, rejected, rejected},
+		},
+	}
+	for _, tt := range tests {
+		for max := SanitizeStrict; max <= SanitizeExtract; max++ {
+			t.Run(tt.name+"/"+max.String(), func(t *testing.T) {
+				v, level, ok := recoverJSON(tt.action, []byte(tt.body), max)
+				want := tt.want[max]
+				if want == rejected {
+					if ok {
+						t.Fatalf("recovered at %s: %v, want rejected", level, v)
+					}
+					return
+				}
+				if !ok {
+					t.Fatalf("rejected, want recovered at %s", want)
+				}
+				if level != want {
+					t.Errorf("recovered at %s, want %s", level, want)
+				}
+				if items, _ := v.([]interface{}); len(items) != tt.items {
+					t.Errorf("got %d items, want %d: %v", len(items), tt.items, v)
+				}
+			})
+		}
+	}
+}
+
+func TestMaxSanitizeLevel(t *testing.T) {
+	tests := []struct {
+		env  string
+		want SanitizeLevel
+	}{
+		{"", SanitizeLight},
+		{"strict", SanitizeStrict},
+		{"Aggressive", SanitizeAggressive},
+		{" extract ", SanitizeExtract},
+		{"0", SanitizeStrict},
+		{"3", SanitizeExtract},
+		{"9", SanitizeLight},
+		{"bogus", SanitizeLight},
+	}
+	for _, tt := range tests {
+		t.Setenv("XTREAM_SANITIZE_LEVEL", tt.env)
+		if got := MaxSanitizeLevel(); got != tt.want {
+			t.Errorf("XTREAM_SANITIZE_LEVEL=%q: got %s, want %s", tt.env, got, tt.want)
+		}
+	}
+}
@@ -19,14 +19,22 @@
 package xtream
 
 import (
+    "bufio"
     "bytes"
+    "compress/flate"
+    "compress/gzip"
+    "compress/zlib"
     "context"
     "crypto/tls"
     "encoding/json"
+    "errors"
     "fmt"
     "io"
     "net/http"
     "net/url"
+    "os"
+    "regexp"
+    "strconv"
     "strings"
     "time"
     "unicode/utf8"
@@ -47,8 +55,58 @@ const (
     getSerieInfo        = "get_series_info"
     getShortEPG         = "get_short_epg"
     getSimpleDataTable  = "get_simple_data_table"
+
+    // Panel actions some players send besides the catalog ones
+    GetAccountInfo = "get_account_info"
+    GetUserInfo    = "get_user_info"
+    GetServerInfo  = "get_server_info"
+    getEPG         = "get_epg"
+    getLiveInfo    = "get_live_info"
 )
 
+// IsKnownAction reports whether action is one the proxy understands and has a
+// shaped fallback for. The empty action is the login call.
+func IsKnownAction(action string) bool {
+    switch action {
+    case "", getLiveCategories, getLiveStreams, getVodCategories, getVodStreams, getVodInfo,
+        getSeriesCategories, getSeries, getSerieInfo, getShortEPG, getSimpleDataTable,
+        GetAccountInfo, GetUserInfo, GetServerInfo, getEPG, getLiveInfo:
+        return true
+    }
+    return false
+}
+
+// FallbackForAction is the empty-but-shaped answer for action, served when the
+// provider fails or when unknown actions are not passed through.
+func FallbackForAction(action string) interface{} { return fallbackForAction(action) }
+
+// defaultMaxJSONBytes caps a player_api response when XTREAM_MAX_JSON_BYTES is unset.
+const defaultMaxJSONBytes = 10 * 1024 * 1024
+
+// ResponseTooLargeError is returned by Action when the decoded response exceeds
+// the configured cap; the body is discarded instead of parsing truncated JSON.
+type ResponseTooLargeError struct {
+    Action string
+    Limit  int64
+}
+
+func (e *ResponseTooLargeError) Error() string {
+    return fmt.Sprintf("xtream %s response exceeds %d bytes (raise XTREAM_MAX_JSON_BYTES)", e.Action, e.Limit)
+}
+
+// ErrEmptyAnswer is returned by Action, with the action's fallback, when the
+// provider answers 200 with an empty, null or HTML body.
+var ErrEmptyAnswer = errors.New("empty or non-JSON answer from the provider")
+
+// MaxJSONBytes returns the response cap from XTREAM_MAX_JSON_BYTES.
+func MaxJSONBytes() int64 {
+    if v := strings.TrimSpace(os.Getenv("XTREAM_MAX_JSON_BYTES")); v != "" {
+        if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 { return n }
+        utils.WarnLog("Invalid XTREAM_MAX_JSON_BYTES: %s", v)
+    }
+    return defaultMaxJSONBytes
+}
+
 // Client represents an Xtream API client
 type Client struct {
     Username  string
@@ -71,11 +129,12 @@ func New(user, password, baseURL, userAgent string) (*Client, error) {
             return nil
         },
     }
+    if userAgent == "" { userAgent = utils.UserAgentFor(baseURL) }
     return &Client{
         Username:  user,
         Password:  password,
         BaseURL:   baseURL,
-        UserAgent: utils.GetIPTVUserAgent(),
+        UserAgent: userAgent,
         Client:    httpClient,
     }, nil
 }
@@ -100,23 +159,45 @@ func (c *Client) Action(cfg *config.ProxyConfig, action string, q url.Values) (r
     u.RawQuery = params.Encode()
     utils.DebugLog("Xtream raw request: %s", u.String())
 
+    // Catalog answers are reused for API_CACHE_SECONDS, e.g. across one M3U generation
+    ttl := APICacheTTL()
+    cacheKey := ""
+    if ttl > 0 && cacheableAction(action) {
+        cacheKey = u.String()
+        if body, ok := cachedAction(cacheKey); ok {
+            utils.DebugLog("Xtream action=%s served from cache", action)
+            return body, http.StatusOK, contentType, nil
+        }
+    }
+
     client := &http.Client{ Timeout: 10 * time.Second, Transport: &http.Transport{ TLSClientConfig: &tls.Config{InsecureSkipVerify: true} } }
 
     var lastErr error
     var resp *http.Response
     var b []byte
+    limit := MaxJSONBytes()
 
     for i := 0; i < 5; i++ {
         req, err := http.NewRequest("GET", u.String(), nil)
         if err != nil { lastErr = err; continue }
-        req.Header.Set("User-Agent", utils.GetIPTVUserAgent())
+        req.Header.Set("User-Agent", c.UserAgent)
         req.Header.Set("Accept", "application/json, text/plain, */*")
+        // Ask for compression explicitly; we decode it ourselves so the size cap
+        // below applies to the decompressed payload.
+        req.Header.Set("Accept-Encoding", "gzip, deflate")
         resp, err = client.Do(req)
         if err != nil { lastErr = err; continue }
         defer resp.Body.Close()
         if resp.StatusCode == http.StatusOK {
-            b, err = io.ReadAll(io.LimitReader(resp.Body, 10*1024*1024))
+            body, derr := decodedBody(resp)
+            if derr != nil { lastErr = derr; continue }
+            // Read one byte past the cap so an oversized body is detected, not truncated
+            b, err = io.ReadAll(io.LimitReader(body, limit+1))
             if err != nil { lastErr = err; continue }
+            if int64(len(b)) > limit {
+                utils.WarnLog("Xtream action=%s: response larger than %d bytes, discarding it", action, limit)
+                return nil, http.StatusBadGateway, contentType, &ResponseTooLargeError{Action: action, Limit: limit}
+            }
             break
         } else {
             lastErr = fmt.Errorf("HTTP status %d", resp.StatusCode)
@@ -124,25 +205,108 @@ func (c *Client) Action(cfg *config.ProxyConfig, action string, q url.Values) (r
     }
 
     if resp == nil || resp.StatusCode != http.StatusOK || len(b) == 0 {
+        if lastErr == nil { lastErr = ErrEmptyAnswer }
         utils.DebugLog("Request failed, last error: %v", lastErr)
         return fallbackForAction(action), http.StatusBadGateway, contentType, lastErr
     }
 
-    trim := bytes.TrimSpace(b)
-    if len(trim) == 0 || bytes.Equal(trim, []byte("null")) || (len(trim) > 0 && trim[0] == '<') {
-        return fallbackForAction(action), http.StatusOK, contentType, nil
+    result, ok, err := parseActionBody(action, b, MaxSanitizeLevel())
+    if !ok {
+        // The fallback is not the provider's answer; callers must not keep it
+        return result, http.StatusBadGateway, contentType, fmt.Errorf("xtream action=%s: %w", action, err)
+    }
+    if cacheKey != "" { storeAction(cacheKey, result, ttl) }
+    return result, http.StatusOK, contentType, nil
+}
+
+// parseActionBody turns a 200 answer of the provider into the action's
+// result. Empty, null and HTML answers give the action's fallback with
+// ErrEmptyAnswer, as does a body that stays undecodable after the recovery
+// tiers up to max (see SanitizeLevel) with the decoding error; ok is false
+// then. It does no I/O, so the recovery of malformed payloads can be
+// exercised without a provider.
+func parseActionBody(action string, b []byte, max SanitizeLevel) (result interface{}, ok bool, err error) {
+    trim := bytes.TrimSpace(bytes.TrimPrefix(bytes.TrimSpace(b), []byte("\uFEFF")))
+    if len(trim) == 0 || bytes.Equal(trim, []byte("null")) || trim[0] == '<' {
+        return fallbackForAction(action), false, ErrEmptyAnswer
+    }
+    if bytes.Equal(trim, []byte("{}")) { return map[string]interface{}{}, true, nil }
+    if bytes.Equal(trim, []byte("[]")) { return []interface{}{}, true, nil }
+
+    if result, err = decodeJSON(trim); err == nil { return result, true, nil }
+    utils.DebugLog("JSON decoding failed: %v", err)
+    // Some panels send smart quotes, trailing commas or cut-off arrays
+    if repaired, level, ok := recoverJSON(action, trim, max); ok {
+        utils.WarnLog("Xtream action=%s: recovered malformed JSON answer with %s sanitizing", action, level)
+        return repaired, true, nil
     }
-    if bytes.Equal(trim, []byte("{}")) { return map[string]interface{}{}, http.StatusOK, contentType, nil }
-    if bytes.Equal(trim, []byte("[]")) { return []interface{}{}, http.StatusOK, contentType, nil }
+    return fallbackForAction(action), false, err
+}
 
-    var result interface{}
-    decoder := json.NewDecoder(bytes.NewReader(trim))
+// decodeJSON decodes one JSON value, keeping numbers as json.Number.
+func decodeJSON(b []byte) (interface{}, error) {
+    var v interface{}
+    decoder := json.NewDecoder(bytes.NewReader(b))
     decoder.UseNumber()
-    if err := decoder.Decode(&result); err != nil {
-        utils.DebugLog("JSON decoding failed: %v", err)
-        return fallbackForAction(action), http.StatusOK, contentType, err
+    if err := decoder.Decode(&v); err != nil { return nil, err }
+    return v, nil
+}
+
+// Probe times one GET of path (e.g. "player_api.php") on the provider with the
+// client's credentials, up to the response headers. The body is not read, so a
+// large playlist is not downloaded.
+func (c *Client) Probe(ctx context.Context, path string, q url.Values) (status int, latency time.Duration, err error) {
+    u, err := url.Parse(strings.TrimRight(c.BaseURL, "/") + "/" + strings.TrimLeft(path, "/"))
+    if err != nil {
+        return 0, 0, err
+    }
+    params := url.Values{}
+    for k, vs := range q {
+        params[k] = vs
+    }
+    params.Set("username", c.Username)
+    params.Set("password", c.Password)
+    u.RawQuery = params.Encode()
+
+    req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+    if err != nil {
+        return 0, 0, err
+    }
+    req.Header.Set("User-Agent", c.UserAgent)
+    start := time.Now()
+    resp, err := c.Client.Do(req)
+    latency = time.Since(start)
+    if err != nil {
+        return 0, latency, err
+    }
+    resp.Body.Close()
+    return resp.StatusCode, latency, nil
+}
+
+// decodedBody returns a reader over the decompressed response body. It honours
+// Content-Encoding and also sniffs the gzip magic for providers that omit it.
+func decodedBody(resp *http.Response) (io.Reader, error) {
+    br := bufio.NewReader(resp.Body)
+    enc := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+    if enc == "" {
+        if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b { enc = "gzip" }
+    }
+    switch enc {
+    case "gzip", "x-gzip":
+        zr, err := gzip.NewReader(br)
+        if err != nil { return nil, fmt.Errorf("invalid gzip body: %w", err) }
+        return zr, nil
+    case "deflate":
+        // Most servers send zlib-wrapped deflate; fall back to raw deflate
+        if hdr, _ := br.Peek(2); len(hdr) == 2 && hdr[0]&0x0f == 8 && (uint16(hdr[0])<<8|uint16(hdr[1]))%31 == 0 {
+            zr, err := zlib.NewReader(br)
+            if err != nil { return nil, fmt.Errorf("invalid deflate body: %w", err) }
+            return zr, nil
+        }
+        return flate.NewReader(br), nil
+    default:
+        return br, nil
     }
-    return result, http.StatusOK, contentType, nil
 }
 
 // GetXMLTV retrieves the EPG data in XMLTV format
@@ -159,7 +323,7 @@ func (c *Client) GetXMLTV() ([]byte, error) {
     defer cancel()
     req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
     if err != nil { return nil, utils.PrintErrorAndReturn(err) }
-    req.Header.Set("User-Agent", utils.GetIPTVUserAgent())
+    req.Header.Set("User-Agent", c.UserAgent)
     req.Header.Set("Accept", "application/xml, text/xml")
     resp, err := c.Client.Do(req)
     if err != nil { return nil, utils.PrintErrorAndReturn(err) }
@@ -183,7 +347,6 @@ func replaceAllNonBasicChars(input []byte) []byte {
     }
     s := string(validUTF8)
     var result strings.Builder
-    if isArray { result.WriteString("[") }
     inString := false
     inObject := false
     objectCount := 0
@@ -199,7 +362,7 @@ func replaceAllNonBasicChars(input []byte) []byte {
         case inString:
             if r < 32 || r > 126 { result.WriteRune(' ') } else { result.WriteRune(r) }
         default:
-            if r == '[' || r == ']' || r == ',' || r == ':' || r == 't' || r == 'r' || r == 'u' || r == 'e' || r == 'f' || r == 'a' || r == 'l' || r == 's' || r == 'n' || r == 'u' || r == 'l' || (r >= '0' && r <= '9') || r == '-' || r == '.' || r == ' ' { result.WriteRune(r) }
+            if r == '[' || r == ']' || r == ',' || r == ':' || r == 't' || r == 'r' || r == 'u' || r == 'e' || r == 'f' || r == 'a' || r == 'l' || r == 's' || r == 'n' || (r >= '0' && r <= '9') || r == '-' || r == '.' || r == ' ' { result.WriteRune(r) }
         }
     }
     if isArray && !strings.HasSuffix(result.String(), "]") { result.WriteString("]") }
@@ -246,9 +409,10 @@ func removeProblematicCharacters(s string) string {
     return s
 }
 
+var trailingComma = regexp.MustCompile(`,\s*([\]}])`)
+
 func fixJsonSyntaxErrors(s string) string {
-    s = strings.ReplaceAll(s, ",]", "]")
-    s = strings.ReplaceAll(s, ",}", "}")
+    s = trailingComma.ReplaceAllString(s, "$1")
     s = strings.ReplaceAll(s, ",,", ",")
     s = strings.ReplaceAll(s, "::", ":")
     return s
@@ -260,13 +424,45 @@ func normalizeQuotes(s string) string {
     return s
 }
 
+// balanceBracketsAndBraces repairs a truncated document. Brackets inside
+// strings are ignored. When a top-level array was cut inside an element, it
+// is cut back to the last complete element; otherwise the missing closers
+// are appended in nesting order.
 func balanceBracketsAndBraces(s string) string {
-    openBrackets := strings.Count(s, "[")
-    closeBrackets := strings.Count(s, "]")
-    for i := 0; i < openBrackets-closeBrackets; i++ { s += "]"; utils.DebugLog("Added missing closing bracket ]") }
-    openBraces := strings.Count(s, "{")
-    closeBraces := strings.Count(s, "}")
-    for i := 0; i < openBraces-closeBraces; i++ { s += "}"; utils.DebugLog("Added missing closing brace }") }
+    var stack []byte
+    inString, escaped := false, false
+    lastElement := -1 // end of the last complete element of a top-level array
+    for i := 0; i < len(s); i++ {
+        ch := s[i]
+        if inString {
+            switch {
+            case escaped: escaped = false
+            case ch == '\\': escaped = true
+            case ch == '"': inString = false
+            }
+            continue
+        }
+        switch ch {
+        case '"':
+            inString = true
+        case '[', '{':
+            stack = append(stack, ch)
+        case ']', '}':
+            if len(stack) > 0 { stack = stack[:len(stack)-1] }
+            if len(stack) == 1 && stack[0] == '[' { lastElement = i + 1 }
+        }
+    }
+    if len(stack) == 0 && !inString { return s }
+    if len(stack) > 1 && stack[0] == '[' && lastElement > 0 {
+        utils.DebugLog("Truncated JSON array: keeping it up to the last complete element")
+        return s[:lastElement] + "]"
+    }
+    if inString { s += `"` }
+    s = strings.TrimRight(s, " \t\r\n,")
+    for i := len(stack) - 1; i >= 0; i-- {
+        if stack[i] == '[' { s += "]" } else { s += "}" }
+    }
+    utils.DebugLog("Added %d missing closing brackets or braces", len(stack))
     return s
 }
 
@@ -281,9 +477,25 @@ func fallbackForAction(action string) interface{} {
         return createEmergencyCategoryData()
     case getLiveStreams, getVodStreams, getSeries:
         return []interface{}{}
-    case getVodInfo, getSerieInfo, getShortEPG, getSimpleDataTable:
-        return map[string]interface{}{}
+    case getShortEPG, getSimpleDataTable, getEPG:
+        return map[string]interface{}{"epg_listings": []interface{}{}}
+    case getVodInfo:
+        return map[string]interface{}{"info": map[string]interface{}{}, "movie_data": map[string]interface{}{}}
+    case getSerieInfo:
+        return map[string]interface{}{"seasons": []interface{}{}, "info": map[string]interface{}{}, "episodes": map[string]interface{}{}}
+    case getLiveInfo:
+        return map[string]interface{}{"info": map[string]interface{}{}}
+    case GetAccountInfo:
+        return map[string]interface{}{"user_info": map[string]interface{}{}, "server_info": map[string]interface{}{}}
+    case GetUserInfo:
+        return map[string]interface{}{"user_info": map[string]interface{}{}}
+    case GetServerInfo:
+        return map[string]interface{}{"server_info": map[string]interface{}{}}
     default:
+        // Unknown actions: list-like names get an array, anything else an object
+        if strings.HasSuffix(action, "_streams") || strings.HasSuffix(action, "_categories") || strings.HasSuffix(action, "_list") {
+            return []interface{}{}
+        }
         return map[string]interface{}{}
     }
 }
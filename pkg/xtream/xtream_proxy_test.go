@@ -0,0 +1,328 @@
+package xtream
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+func TestAction(t *testing.T) {
+	t.Setenv("API_CACHE_SECONDS", "0")
+	t.Setenv("XTREAM_SANITIZE_LEVEL", "")
+
+	tests := []struct {
+		name       string
+		action     string
+		body       string
+		wantStatus int
+		wantErr    error // nil: success expected
+		wantNames  []string
+	}{
+		{
+			name:       "valid answer",
+			action:     getLiveStreams,
+			body:       `[{"stream_id":1,"name":"One"},{"stream_id":2,"name":"Two"}]`,
+			wantStatus: http.StatusOK,
+			wantNames:  []string{"One", "Two"},
+		},
+		{
+			name:       "smart quotes",
+			action:     getLiveCategories,
+			body:       `[{“category_id”:“1”,“category_name”:“News”}]`,
+			wantStatus: http.StatusOK,
+			wantNames:  []string{"News"},
+		},
+		{
+			name:       "truncated array keeps complete elements",
+			action:     getLiveStreams,
+			body:       `[{"stream_id":1,"name":"One"},{"stream_id":2,"na`,
+			wantStatus: http.StatusOK,
+			wantNames:  []string{"One"},
+		},
+		{
+			name:       "trailing commas",
+			action:     getVodStreams,
+			body:       `[{"stream_id":1,"name":"One",},{"stream_id":2,"name":"Two"},]`,
+			wantStatus: http.StatusOK,
+			wantNames:  []string{"One", "Two"},
+		},
+		{
+			name:       "byte order mark",
+			action:     getSeries,
+			body:       "\uFEFF" + `[{"series_id":1,"name":"One"}]`,
+			wantStatus: http.StatusOK,
+			wantNames:  []string{"One"},
+		},
+		{
+			name:       "html page",
+			action:     getLiveCategories,
+			body:       "<html><body>Service unavailable</body></html>",
+			wantStatus: http.StatusBadGateway,
+			wantErr:    ErrEmptyAnswer,
+		},
+		{
+			name:       "empty body",
+			action:     getLiveStreams,
+			body:       "",
+			wantStatus: http.StatusBadGateway,
+			wantErr:    ErrEmptyAnswer,
+		},
+		{
+			name:       "null",
+			action:     getVodStreams,
+			body:       "null",
+			wantStatus: http.StatusBadGateway,
+			wantErr:    ErrEmptyAnswer,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got url.Values
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.URL.Query()
+				w.Write([]byte(tt.body)) // nolint: errcheck
+			}))
+			defer upstream.Close()
+
+			c, err := New("user", "pass", upstream.URL, "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, status, _, err := c.Action(nil, tt.action, url.Values{"category_id": {"3"}, "password": {"forged"}})
+			if got.Get("username") != "user" || got.Get("password") != "pass" || got.Get("action") != tt.action || got.Get("category_id") != "3" {
+				t.Errorf("upstream query = %v", got)
+			}
+			if status != tt.wantStatus {
+				t.Errorf("status = %d, want %d", status, tt.wantStatus)
+			}
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				if resp == nil {
+					t.Error("no fallback returned with the error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err = %v", err)
+			}
+			items, ok := resp.([]interface{})
+			if !ok {
+				t.Fatalf("resp = %T, want []interface{}", resp)
+			}
+			var names []string
+			for _, it := range items {
+				m, _ := it.(map[string]interface{})
+				name, _ := m["name"].(string)
+				if name == "" {
+					name, _ = m["category_name"].(string)
+				}
+				names = append(names, name)
+			}
+			if len(names) != len(tt.wantNames) {
+				t.Fatalf("names = %v, want %v", names, tt.wantNames)
+			}
+			for i := range names {
+				if names[i] != tt.wantNames[i] {
+					t.Errorf("names = %v, want %v", names, tt.wantNames)
+				}
+			}
+		})
+	}
+}
+
+func compressed(t *testing.T, newWriter func(io.Writer) io.WriteCloser, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := newWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestActionCompressed(t *testing.T) {
+	t.Setenv("API_CACHE_SECONDS", "0")
+	t.Setenv("XTREAM_SANITIZE_LEVEL", "")
+	t.Setenv("XTREAM_MAX_JSON_BYTES", "1024")
+
+	gz := func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }
+	zl := func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }
+	raw := func(w io.Writer) io.WriteCloser { fw, _ := flate.NewWriter(w, flate.DefaultCompression); return fw }
+	categories := []byte(`[{"category_id":"1","category_name":"News"}]`)
+	// Compresses to a few bytes but decodes past XTREAM_MAX_JSON_BYTES
+	bomb := append([]byte(`[{"category_id":"1","category_name":"`), bytes.Repeat([]byte("a"), 64*1024)...)
+	bomb = append(bomb, `"}]`...)
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		tooLarge bool
+	}{
+		{name: "gzip", encoding: "gzip", body: compressed(t, gz, categories)},
+		{name: "x-gzip", encoding: "x-gzip", body: compressed(t, gz, categories)},
+		{name: "zlib deflate", encoding: "deflate", body: compressed(t, zl, categories)},
+		{name: "raw deflate", encoding: "deflate", body: compressed(t, raw, categories)},
+		{name: "gzip without header", body: compressed(t, gz, categories)},
+		{name: "gzip over the cap", encoding: "gzip", body: compressed(t, gz, bomb), tooLarge: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var acceptEncoding string
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				acceptEncoding = r.Header.Get("Accept-Encoding")
+				if tt.encoding != "" {
+					w.Header().Set("Content-Encoding", tt.encoding)
+				}
+				w.Write(tt.body) // nolint: errcheck
+			}))
+			defer upstream.Close()
+
+			c, err := New("user", "pass", upstream.URL, "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, status, _, err := c.Action(nil, getLiveCategories, nil)
+			if acceptEncoding != "gzip, deflate" {
+				t.Errorf("Accept-Encoding = %q", acceptEncoding)
+			}
+			if tt.tooLarge {
+				var tle *ResponseTooLargeError
+				if !errors.As(err, &tle) || tle.Limit != 1024 {
+					t.Fatalf("err = %v, want ResponseTooLargeError with limit 1024", err)
+				}
+				if status != http.StatusBadGateway {
+					t.Errorf("status = %d, want %d", status, http.StatusBadGateway)
+				}
+				return
+			}
+			if err != nil || status != http.StatusOK {
+				t.Fatalf("status = %d, err = %v", status, err)
+			}
+			items, _ := resp.([]interface{})
+			if len(items) != 1 {
+				t.Fatalf("resp = %v, want one category", resp)
+			}
+			if m, _ := items[0].(map[string]interface{}); m["category_name"] != "News" {
+				t.Errorf("category = %v, want News", m)
+			}
+		})
+	}
+}
+
+func TestActionTooLarge(t *testing.T) {
+	t.Setenv("API_CACHE_SECONDS", "0")
+	t.Setenv("XTREAM_SANITIZE_LEVEL", "")
+	body := `[{"category_id":"1","category_name":"News"}]`
+
+	tests := []struct {
+		name     string
+		limit    string
+		tooLarge bool
+	}{
+		{name: "under the cap", limit: "1024"},
+		{name: "exactly the cap", limit: strconv.Itoa(len(body))},
+		{name: "one byte over the cap", limit: strconv.Itoa(len(body) - 1), tooLarge: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("XTREAM_MAX_JSON_BYTES", tt.limit)
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(body)) // nolint: errcheck
+			}))
+			defer upstream.Close()
+
+			c, err := New("user", "pass", upstream.URL, "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, status, _, err := c.Action(nil, getLiveCategories, nil)
+			if !tt.tooLarge {
+				if err != nil || status != http.StatusOK {
+					t.Fatalf("status = %d, err = %v", status, err)
+				}
+				if items, _ := resp.([]interface{}); len(items) != 1 {
+					t.Errorf("resp = %v, want one category", resp)
+				}
+				return
+			}
+			var tle *ResponseTooLargeError
+			if !errors.As(err, &tle) {
+				t.Fatalf("err = %v, want ResponseTooLargeError", err)
+			}
+			if tle.Action != getLiveCategories || strconv.FormatInt(tle.Limit, 10) != tt.limit {
+				t.Errorf("err = %+v", tle)
+			}
+			if status != http.StatusBadGateway || resp != nil {
+				t.Errorf("status = %d, resp = %v; want 502 and no truncated data", status, resp)
+			}
+		})
+	}
+}
+
+func TestMaxJSONBytes(t *testing.T) {
+	for v, want := range map[string]int64{
+		"":       defaultMaxJSONBytes,
+		"4096":   4096,
+		" 4096 ": 4096,
+		"0":      defaultMaxJSONBytes,
+		"-1":     defaultMaxJSONBytes,
+		"lots":   defaultMaxJSONBytes,
+	} {
+		t.Setenv("XTREAM_MAX_JSON_BYTES", v)
+		if got := MaxJSONBytes(); got != want {
+			t.Errorf("MaxJSONBytes(%q) = %d, want %d", v, got, want)
+		}
+	}
+}
+
+func TestFallbackForAction(t *testing.T) {
+	tests := []struct {
+		action string
+		known  bool
+		want   string
+	}{
+		{GetAccountInfo, true, `{"server_info":{},"user_info":{}}`},
+		{GetUserInfo, true, `{"user_info":{}}`},
+		{GetServerInfo, true, `{"server_info":{}}`},
+		{getEPG, true, `{"epg_listings":[]}`},
+		{getShortEPG, true, `{"epg_listings":[]}`},
+		{getLiveInfo, true, `{"info":{}}`},
+		{getSerieInfo, true, `{"episodes":{},"info":{},"seasons":[]}`},
+		{getVodInfo, true, `{"info":{},"movie_data":{}}`},
+		{getLiveStreams, true, `[]`},
+		{"get_radio_streams", false, `[]`},
+		{"get_radio_categories", false, `[]`},
+		{"get_reseller", false, `{}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			if got := IsKnownAction(tt.action); got != tt.known {
+				t.Errorf("IsKnownAction = %v, want %v", got, tt.known)
+			}
+			b, err := json.Marshal(FallbackForAction(tt.action))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.want {
+				t.Errorf("FallbackForAction = %s, want %s", b, tt.want)
+			}
+		})
+	}
+}